@@ -0,0 +1,298 @@
+// Package agent runs multi-turn agents: a model that plans, calls tools and
+// observes their results, step by step, until it can answer
+//
+// Usage:
+//
+//	a := &agent.Agent{
+//		Client:       client, // any langmesh.ChatClient
+//		Model:        "gpt-4o",
+//		Instructions: "You are a travel agent.",
+//		Tools:        []langmesh.Tool{searchFlights, bookFlight},
+//		Memory:       agent.NewMemoryStore(),
+//		MaxSteps:     8,
+//		MaxCostUSD:   0.50,
+//	}
+//	result, err := a.Run(ctx, "session-42", "Find me a flight to Paris")
+//	if errors.Is(err, agent.ErrMaxSteps) {
+//		// result.State can be saved and continued later with Resume
+//	}
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultMaxSteps bounds a run when Agent.MaxSteps is unset
+const DefaultMaxSteps = 10
+
+// DefaultPlanPrompt asks the model for a plan before its first action
+const DefaultPlanPrompt = "Before acting, write a short numbered plan for answering the last message. " +
+	"Do not answer it yet."
+
+var (
+	// ErrMaxSteps is returned when the agent has not answered after MaxSteps
+	// steps
+	ErrMaxSteps = errors.New("langmesh: agent did not finish within the step limit")
+	// ErrCostCap is returned when the run's estimated cost reaches
+	// MaxCostUSD before the agent answers
+	ErrCostCap = errors.New("langmesh: agent reached its cost cap")
+)
+
+// Agent is a model with tools and memory, run one step at a time: a step
+// is a completion, together with the tool calls it makes. An Agent holds
+// no run state and is safe for concurrent runs.
+type Agent struct {
+	// Name tags the agent's calls in telemetry as "agent"
+	Name string
+	// Client makes the calls. MaxCostUSD and Step.CostUSD use its pricing
+	// if it is a langmesh.CostEstimator. With a *langmesh.Client every step
+	// is in its telemetry, tagged with the run's ID and step number.
+	Client       langmesh.ChatClient
+	Model        string
+	Instructions string
+	Tools        []langmesh.Tool
+	// Memory, if set, keeps each session's conversation between runs
+	Memory Memory
+
+	// MaxSteps defaults to DefaultMaxSteps
+	MaxSteps int
+	// MaxCostUSD caps a run's estimated cost; zero means no cap
+	MaxCostUSD float64
+	// Plan has the model write a plan, without tools, before its first
+	// action in each run, with PlanPrompt or DefaultPlanPrompt
+	Plan       bool
+	PlanPrompt string
+
+	// ToolOptions configures tool execution, as for RunTools;
+	// MaxIterations is ignored
+	ToolOptions langmesh.RunToolsOptions
+	Temperature float32
+	// OnStep, if set, is called after every step
+	OnStep func(Step)
+}
+
+// StepKind is what a step did
+type StepKind string
+
+const (
+	StepPlan   StepKind = "plan"
+	StepAct    StepKind = "act"
+	StepAnswer StepKind = "answer"
+)
+
+// Step is one completion of a run, with the tool calls it made and what
+// they returned
+type Step struct {
+	Number int      `json:"number"`
+	Kind   StepKind `json:"kind"`
+	// Content is the model's text: the plan, the answer, or any commentary
+	// alongside its tool calls
+	Content      string            `json:"content,omitempty"`
+	ToolCalls    []openai.ToolCall `json:"tool_calls,omitempty"`
+	Observations []string          `json:"observations,omitempty"`
+	Usage        openai.Usage      `json:"usage"`
+	CostUSD      float64           `json:"cost_usd,omitempty"`
+	Duration     time.Duration     `json:"duration"`
+}
+
+// State is a run's progress. It marshals to JSON, so a run stopped by the
+// step limit, the cost cap, an error or a restart can be continued with
+// Resume.
+type State struct {
+	RunID    string                         `json:"run_id"`
+	Session  string                         `json:"session,omitempty"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+	Steps    []Step                         `json:"steps,omitempty"`
+	CostUSD  float64                        `json:"cost_usd,omitempty"`
+	Planned  bool                           `json:"planned,omitempty"`
+	Done     bool                           `json:"done,omitempty"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	// Answer is the model's final message content
+	Answer string
+	State  State
+}
+
+// Run adds input to the session's conversation, loaded from Memory, and
+// runs the agent until it answers. Without Memory, session only names the
+// run. The conversation is saved to Memory once the agent answers.
+func (a *Agent) Run(ctx context.Context, session, input string) (Result, error) {
+	state := State{RunID: newRunID(), Session: session}
+	if a.Memory != nil && session != "" {
+		history, err := a.Memory.Load(ctx, session)
+		if err != nil {
+			return Result{State: state}, fmt.Errorf("langmesh: agent memory: %w", err)
+		}
+		state.Messages = history
+	}
+	if len(state.Messages) == 0 && a.Instructions != "" {
+		state.Messages = append(state.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: a.Instructions})
+	}
+	state.Messages = append(state.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: input})
+	return a.Resume(ctx, state)
+}
+
+// Resume continues a run from state, as returned with an earlier Result,
+// with the step limit and cost cap applying to the whole run. A finished
+// run is returned as it is.
+func (a *Agent) Resume(ctx context.Context, state State) (Result, error) {
+	result := Result{State: state}
+	if state.Done {
+		result.Answer = lastAnswer(state.Messages)
+		return result, nil
+	}
+	if a.Client == nil || a.Model == "" {
+		return result, errors.New("langmesh: agent needs a client and a model")
+	}
+	definitions, tools := langmesh.ToolSet(a.Tools...)
+	maxSteps := a.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+
+	for {
+		s := &result.State
+		if len(s.Steps) >= maxSteps {
+			return result, ErrMaxSteps
+		}
+		if a.MaxCostUSD > 0 && s.CostUSD >= a.MaxCostUSD {
+			return result, ErrCostCap
+		}
+		stepCtx := langmesh.ContextWithTag(ctx, "agent_run", s.RunID)
+		stepCtx = langmesh.ContextWithTag(stepCtx, "agent_step", strconv.Itoa(len(s.Steps)+1))
+		if a.Name != "" {
+			stepCtx = langmesh.ContextWithTag(stepCtx, "agent", a.Name)
+		}
+
+		var step Step
+		var err error
+		if a.Plan && !s.Planned {
+			step, err = a.plan(stepCtx, s)
+		} else {
+			step, err = a.act(ctx, stepCtx, s, definitions, tools)
+		}
+		if err != nil {
+			return result, err
+		}
+		if a.OnStep != nil {
+			a.OnStep(step)
+		}
+		if step.Kind == StepAnswer {
+			s.Done = true
+			result.Answer = step.Content
+			if a.Memory != nil && s.Session != "" {
+				if err := a.Memory.Save(ctx, s.Session, s.Messages); err != nil {
+					return result, fmt.Errorf("langmesh: agent memory: %w", err)
+				}
+			}
+			return result, nil
+		}
+	}
+}
+
+// plan asks the model for a plan, adding it to the conversation
+func (a *Agent) plan(ctx context.Context, s *State) (Step, error) {
+	prompt := a.PlanPrompt
+	if prompt == "" {
+		prompt = DefaultPlanPrompt
+	}
+	messages := append(append([]openai.ChatCompletionMessage(nil), s.Messages...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: prompt})
+	resp, step, err := a.complete(ctx, s, messages, nil)
+	if err != nil {
+		return step, err
+	}
+	message := resp.Choices[0].Message
+	step.Kind = StepPlan
+	step.Content = message.Content
+	s.Messages = append(s.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: message.Content})
+	s.Planned = true
+	s.Steps = append(s.Steps, step)
+	return step, nil
+}
+
+// act has the model take its next step, running any tools it calls and
+// adding what they return to the conversation
+func (a *Agent) act(ctx, stepCtx context.Context, s *State, definitions []openai.Tool, tools map[string]langmesh.ToolFunc) (Step, error) {
+	resp, step, err := a.complete(stepCtx, s, s.Messages, definitions)
+	if err != nil {
+		return step, err
+	}
+	message := resp.Choices[0].Message
+	step.Content = message.Content
+	step.ToolCalls = message.ToolCalls
+	if len(message.ToolCalls) == 0 {
+		step.Kind = StepAnswer
+		s.Messages = append(s.Messages, message)
+		s.Steps = append(s.Steps, step)
+		return step, nil
+	}
+
+	step.Kind = StepAct
+	started := time.Now()
+	outputs, err := langmesh.ExecuteToolCalls(ctx, definitions, tools, message.ToolCalls, a.ToolOptions)
+	step.Duration += time.Since(started)
+	if err != nil {
+		// The tool calls are left unanswered, so a resumed run asks again
+		return step, err
+	}
+	step.Observations = outputs
+	s.Messages = append(s.Messages, message)
+	for i, call := range message.ToolCalls {
+		s.Messages = append(s.Messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    outputs[i],
+			ToolCallID: call.ID,
+		})
+	}
+	s.Steps = append(s.Steps, step)
+	return step, nil
+}
+
+// complete makes a step's completion, counting its cost against the run
+func (a *Agent) complete(ctx context.Context, s *State, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, Step, error) {
+	step := Step{Number: len(s.Steps) + 1}
+	started := time.Now()
+	resp, err := a.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       a.Model,
+		Messages:    messages,
+		Tools:       tools,
+		Temperature: a.Temperature,
+	})
+	step.Duration = time.Since(started)
+	if err != nil {
+		return resp, step, err
+	}
+	step.Usage = resp.Usage
+	if estimator, ok := a.Client.(langmesh.CostEstimator); ok {
+		step.CostUSD = estimator.EstimateCostUSD(a.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		s.CostUSD = (langmesh.MoneyFromFloat(s.CostUSD) + langmesh.MoneyFromFloat(step.CostUSD)).Float64()
+	}
+	if len(resp.Choices) == 0 {
+		return resp, step, errors.New("langmesh: agent got a completion with no choices")
+	}
+	return resp, step, nil
+}
+
+func lastAnswer(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleAssistant {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+func newRunID() string {
+	return "run_" + uuid.NewString()
+}
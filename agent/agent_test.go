@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	"github.com/langmesh-ai/openai-go/langmeshtest"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func toolCallResponse(name, arguments string) openai.ChatCompletionResponse {
+	resp := langmeshtest.TextResponse("")
+	resp.Choices[0].Message.ToolCalls = []openai.ToolCall{{
+		ID:       "call_" + name,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: arguments},
+	}}
+	resp.Choices[0].FinishReason = openai.FinishReasonToolCalls
+	resp.Usage = openai.Usage{PromptTokens: 400, CompletionTokens: 100, TotalTokens: 500}
+	return resp
+}
+
+type weatherArgs struct {
+	City string `json:"city"`
+}
+
+var weather = langmesh.MustNewTool("weather", "Current weather in a city", func(args weatherArgs) (string, error) {
+	return "sunny in " + args.City, nil
+})
+
+func TestAgentPlanActObserve(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.QueueText("1. Check the weather\n2. Answer")
+	mock.QueueChat(toolCallResponse("weather", `{"city":"Paris"}`))
+	mock.QueueText("Pack sunglasses.")
+
+	var steps []Step
+	a := &Agent{
+		Client:       mock,
+		Model:        "gpt-4o",
+		Instructions: "You are a travel agent.",
+		Tools:        []langmesh.Tool{weather},
+		Plan:         true,
+		OnStep:       func(s Step) { steps = append(steps, s) },
+	}
+	result, err := a.Run(context.Background(), "", "What should I pack for Paris?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Answer != "Pack sunglasses." || !result.State.Done {
+		t.Errorf("result = %+v", result)
+	}
+	kinds := []StepKind{StepPlan, StepAct, StepAnswer}
+	if len(steps) != 3 {
+		t.Fatalf("steps = %+v", steps)
+	}
+	for i, step := range steps {
+		if step.Kind != kinds[i] || step.Number != i+1 {
+			t.Errorf("step %d = %+v", i, step)
+		}
+	}
+	if obs := steps[1].Observations; len(obs) != 1 || obs[0] != "sunny in Paris" {
+		t.Errorf("observations = %q", obs)
+	}
+
+	requests := mock.ChatRequests()
+	if len(requests[0].Tools) != 0 || len(requests[1].Tools) != 1 {
+		t.Errorf("tools offered = %d, %d; the plan step gets none", len(requests[0].Tools), len(requests[1].Tools))
+	}
+	last := requests[2].Messages
+	if last[0].Content != "You are a travel agent." || last[2].Role != openai.ChatMessageRoleAssistant ||
+		last[len(last)-1].Role != openai.ChatMessageRoleTool {
+		t.Errorf("final conversation = %+v", last)
+	}
+}
+
+func TestAgentLimitsAndResume(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	for i := 0; i < 3; i++ {
+		mock.QueueChat(toolCallResponse("weather", `{"city":"Oslo"}`))
+	}
+	mock.QueueText("Bring a coat.")
+
+	mock.USDPerToken = 0.00001
+	a := &Agent{Client: mock, Model: "gpt-4o", Tools: []langmesh.Tool{weather}, MaxSteps: 2}
+	result, err := a.Run(context.Background(), "s", "Weather?")
+	if !errors.Is(err, ErrMaxSteps) || len(result.State.Steps) != 2 {
+		t.Fatalf("err = %v, steps = %d", err, len(result.State.Steps))
+	}
+
+	// The state survives serialization, and the cost cap covers the whole run
+	data, err := json.Marshal(result.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved State
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.CostUSD < 0.0099 || saved.CostUSD > 0.0101 {
+		t.Errorf("cost = %v", saved.CostUSD)
+	}
+	a.MaxSteps = 10
+	a.MaxCostUSD = 0.0149
+	result, err = a.Resume(context.Background(), saved)
+	if !errors.Is(err, ErrCostCap) || len(result.State.Steps) != 3 {
+		t.Fatalf("err = %v, steps = %d", err, len(result.State.Steps))
+	}
+
+	a.MaxCostUSD = 0
+	result, err = a.Resume(context.Background(), result.State)
+	if err != nil || result.Answer != "Bring a coat." || result.State.RunID != saved.RunID {
+		t.Errorf("result = %+v, %v", result, err)
+	}
+}
+
+func TestAgentMemory(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.QueueText("Hi Ada.")
+	mock.QueueText("Your name is Ada.")
+	a := &Agent{Client: mock, Model: "gpt-4o", Instructions: "Be brief.", Memory: NewMemoryStore()}
+
+	ctx := context.Background()
+	if _, err := a.Run(ctx, "u-1", "I am Ada."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Run(ctx, "u-1", "What is my name?"); err != nil {
+		t.Fatal(err)
+	}
+	second := mock.ChatRequests()[1].Messages
+	if len(second) != 4 || second[0].Content != "Be brief." || !strings.Contains(second[1].Content, "Ada") {
+		t.Errorf("second run conversation = %+v", second)
+	}
+}
+
+func TestAgentToolFailure(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.QueueChat(toolCallResponse("missing", `{}`))
+	a := &Agent{Client: mock, Model: "gpt-4o", Tools: []langmesh.Tool{weather}}
+	result, err := a.Run(context.Background(), "", "hi")
+	if !errors.Is(err, langmesh.ErrUnknownTool) {
+		t.Fatalf("err = %v", err)
+	}
+	// The unanswered call is not kept, so a resumed run asks the model again
+	if last := result.State.Messages[len(result.State.Messages)-1]; last.Role != openai.ChatMessageRoleUser {
+		t.Errorf("last message = %+v", last)
+	}
+}
+
+func TestAgentToolAllowList(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.QueueChat(toolCallResponse("weather", `{"city":"Oslo"}`))
+	mock.QueueText("I can't check the weather.")
+	a := &Agent{
+		Client:      mock,
+		Model:       "gpt-4o",
+		Tools:       []langmesh.Tool{weather},
+		ToolOptions: langmesh.RunToolsOptions{AllowedTools: []string{}, ReportToolErrors: true},
+	}
+	result, err := a.Run(context.Background(), "", "Weather?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obs := result.State.Steps[0].Observations; len(obs) != 1 || !strings.Contains(obs[0], "not allowed") {
+		t.Errorf("observations = %q", obs)
+	}
+}
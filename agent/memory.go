@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Memory keeps each session's conversation between runs
+type Memory interface {
+	// Load returns the session's conversation, empty for a new session
+	Load(ctx context.Context, session string) ([]openai.ChatCompletionMessage, error)
+	Save(ctx context.Context, session string, messages []openai.ChatCompletionMessage) error
+}
+
+// MemoryStore is a Memory held in process memory
+type MemoryStore struct {
+	// MaxMessages, if set, keeps only a session's system message and its
+	// most recent messages, so long sessions stay within the context window
+	MaxMessages int
+
+	mu       sync.Mutex
+	sessions map[string][]openai.ChatCompletionMessage
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string][]openai.ChatCompletionMessage)}
+}
+
+func (m *MemoryStore) Load(_ context.Context, session string) ([]openai.ChatCompletionMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), m.sessions[session]...), nil
+}
+
+func (m *MemoryStore) Save(_ context.Context, session string, messages []openai.ChatCompletionMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session] = trimHistory(append([]openai.ChatCompletionMessage(nil), messages...), m.MaxMessages)
+	return nil
+}
+
+// DirMemory is a Memory keeping each session as a JSON file in a
+// directory, replaced atomically on every save
+type DirMemory struct {
+	Dir string
+	// MaxMessages trims sessions as for MemoryStore
+	MaxMessages int
+}
+
+// NewDirMemory creates a DirMemory in dir, creating the directory if needed
+func NewDirMemory(dir string) (*DirMemory, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirMemory{Dir: dir}, nil
+}
+
+func (m *DirMemory) path(session string) string {
+	return filepath.Join(m.Dir, filepath.Base(session)+".json")
+}
+
+func (m *DirMemory) Load(_ context.Context, session string) ([]openai.ChatCompletionMessage, error) {
+	data, err := os.ReadFile(m.path(session))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []openai.ChatCompletionMessage
+	err = json.Unmarshal(data, &messages)
+	return messages, err
+}
+
+func (m *DirMemory) Save(_ context.Context, session string, messages []openai.ChatCompletionMessage) error {
+	data, err := json.Marshal(trimHistory(messages, m.MaxMessages))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.Dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path(session))
+}
+
+// trimHistory keeps a leading system message and the last max messages,
+// never starting on a tool result cut off from its call
+func trimHistory(messages []openai.ChatCompletionMessage, max int) []openai.ChatCompletionMessage {
+	if max <= 0 || len(messages) <= max {
+		return messages
+	}
+	var system []openai.ChatCompletionMessage
+	if messages[0].Role == openai.ChatMessageRoleSystem {
+		system, messages = messages[:1], messages[1:]
+	}
+	start := len(messages) - max
+	if start < 0 {
+		start = 0
+	}
+	for start < len(messages) && messages[start].Role == openai.ChatMessageRoleTool {
+		start++
+	}
+	return append(system, messages[start:]...)
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestDirMemoryTrims(t *testing.T) {
+	m, err := NewDirMemory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.MaxMessages = 2
+	ctx := context.Background()
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "sys"},
+		{Role: openai.ChatMessageRoleUser, Content: "q1"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1"}}},
+		{Role: openai.ChatMessageRoleTool, Content: "r1", ToolCallID: "c1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a1"},
+	}
+	if err := m.Save(ctx, "s", messages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Load(ctx, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tool result would be cut off from its call, so it goes too
+	if len(got) != 2 || got[0].Content != "sys" || got[1].Content != "a1" {
+		t.Errorf("loaded = %+v", got)
+	}
+	if fresh, err := m.Load(ctx, "new"); err != nil || len(fresh) != 0 {
+		t.Errorf("new session = %+v, %v", fresh, err)
+	}
+}
@@ -0,0 +1,547 @@
+package langmesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultAnthropicBaseURL is Anthropic's API root
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	// DefaultAnthropicVersion is the Messages API version requested
+	DefaultAnthropicVersion = "2023-06-01"
+	// DefaultAnthropicMaxTokens is sent for requests without MaxTokens,
+	// which Anthropic requires
+	DefaultAnthropicMaxTokens = 4096
+)
+
+// AnthropicConfig configures WithAnthropic. Zero fields take the defaults.
+type AnthropicConfig struct {
+	// APIKey defaults to the ANTHROPIC_API_KEY environment variable
+	APIKey  string
+	BaseURL string
+	Version string
+	// Match reports whether a model is served by Anthropic; by default,
+	// models named "claude-..."
+	Match     func(model string) bool
+	MaxTokens int
+}
+
+// WithAnthropic serves chat completions for Anthropic models through
+// Anthropic's Messages API. Requests and responses, streamed or not, are
+// translated at the transport, so the calls, telemetry, guards, fallbacks
+// and cost estimates are the same as for OpenAI models; switching is a
+// change of model name. Text, images, tools and tool results translate;
+// options Anthropic has no equivalent for, such as JSON mode, are dropped.
+func WithAnthropic(cfg AnthropicConfig) Option {
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultAnthropicBaseURL
+	}
+	if cfg.Version == "" {
+		cfg.Version = DefaultAnthropicVersion
+	}
+	if cfg.Match == nil {
+		cfg.Match = func(model string) bool { return strings.HasPrefix(model, "claude-") }
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = DefaultAnthropicMaxTokens
+	}
+	return func(c *Client) {
+		c.anthropicMatch = cfg.Match
+		c.transportWrappers = append(c.transportWrappers, func(base http.RoundTripper) http.RoundTripper {
+			return &anthropicTransport{base: base, cfg: cfg}
+		})
+	}
+}
+
+type anthropicTransport struct {
+	base http.RoundTripper
+	cfg  AnthropicConfig
+}
+
+func (t *anthropicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return t.base.RoundTrip(req)
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var chat openai.ChatCompletionRequest
+	if err := json.Unmarshal(body, &chat); err != nil || !t.cfg.Match(chat.Model) {
+		return t.base.RoundTrip(req)
+	}
+
+	payload, err := json.Marshal(toAnthropicRequest(chat, t.cfg.MaxTokens))
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: anthropic request: %w", err)
+	}
+	out, err := http.NewRequestWithContext(req.Context(), http.MethodPost,
+		strings.TrimSuffix(t.cfg.BaseURL, "/")+"/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	out.Header.Set("Content-Type", "application/json")
+	out.Header.Set("X-Api-Key", t.cfg.APIKey)
+	out.Header.Set("Anthropic-Version", t.cfg.Version)
+	if id := req.Header.Get(clientRequestIDHeader); id != "" {
+		out.Header.Set(clientRequestIDHeader, id)
+	}
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	translateAnthropicHeaders(resp.Header)
+	if resp.StatusCode != http.StatusOK {
+		return anthropicErrorResponse(resp)
+	}
+	if chat.Stream {
+		pr, pw := io.Pipe()
+		go translateAnthropicStream(resp.Body, pw)
+		resp.Body = pr
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.ContentLength = -1
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var msg anthropicMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("langmesh: anthropic response: %w", err)
+	}
+	converted, err := json.Marshal(msg.toOpenAI())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(converted))
+	resp.ContentLength = int64(len(converted))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicTurn    `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]any     `json:"tool_choice,omitempty"`
+	Metadata      *anthropicMetadata `json:"metadata,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicTurn struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+func toAnthropicRequest(chat openai.ChatCompletionRequest, defaultMaxTokens int) anthropicRequest {
+	out := anthropicRequest{
+		Model:         chat.Model,
+		MaxTokens:     chat.MaxTokens,
+		StopSequences: chat.Stop,
+		Stream:        chat.Stream,
+	}
+	if out.MaxTokens <= 0 {
+		out.MaxTokens = defaultMaxTokens
+	}
+	if chat.Temperature != 0 {
+		out.Temperature = &chat.Temperature
+	}
+	if chat.TopP != 0 {
+		out.TopP = &chat.TopP
+	}
+	if chat.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: chat.User}
+	}
+
+	var system []string
+	for _, m := range chat.Messages {
+		role := "user"
+		var blocks []anthropicBlock
+		switch m.Role {
+		case openai.ChatMessageRoleSystem, "developer":
+			system = append(system, messageText(m))
+			continue
+		case openai.ChatMessageRoleTool:
+			blocks = []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}}
+		case openai.ChatMessageRoleAssistant:
+			role = "assistant"
+			blocks = anthropicContent(m)
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		default:
+			blocks = anthropicContent(m)
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		// Anthropic requires turns to alternate, so consecutive messages
+		// from one side, such as several tool results, share a turn
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, anthropicTurn{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range chat.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	out.ToolChoice = anthropicToolChoice(chat.ToolChoice)
+	return out
+}
+
+func anthropicContent(m openai.ChatCompletionMessage) []anthropicBlock {
+	if len(m.MultiContent) == 0 {
+		if m.Content == "" {
+			return nil
+		}
+		return []anthropicBlock{{Type: "text", Text: m.Content}}
+	}
+	var blocks []anthropicBlock
+	for _, part := range m.MultiContent {
+		switch {
+		case part.Type == openai.ChatMessagePartTypeText:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+		case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: anthropicImageSource(part.ImageURL.URL)})
+		}
+	}
+	return blocks
+}
+
+func anthropicImageSource(rawURL string) *anthropicSource {
+	header, data, ok := strings.Cut(strings.TrimPrefix(rawURL, "data:"), ",")
+	if ok && strings.HasPrefix(rawURL, "data:") && strings.HasSuffix(header, ";base64") {
+		return &anthropicSource{Type: "base64", MediaType: strings.TrimSuffix(header, ";base64"), Data: data}
+	}
+	return &anthropicSource{Type: "url", URL: rawURL}
+}
+
+// anthropicToolChoice translates tool_choice, decoded from JSON as a string
+// or an object naming a function
+func anthropicToolChoice(choice any) map[string]any {
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			return map[string]any{"type": "auto"}
+		case "required":
+			return map[string]any{"type": "any"}
+		case "none":
+			return map[string]any{"type": "none"}
+		}
+	case map[string]any:
+		if fn, ok := v["function"].(map[string]any); ok {
+			if name, _ := fn["name"].(string); name != "" {
+				return map[string]any{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
+
+type anthropicMessage struct {
+	ID         string                `json:"id"`
+	Model      string                `json:"model"`
+	Content    []anthropicOutputPart `json:"content"`
+	StopReason string                `json:"stop_reason"`
+	Usage      anthropicUsage        `json:"usage"`
+}
+
+type anthropicOutputPart struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// promptTokens counts cached input with the rest, as OpenAI does
+func (u anthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+func (m anthropicMessage) toOpenAI() openai.ChatCompletionResponse {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var text []string
+	for _, part := range m.Content {
+		switch part.Type {
+		case "text":
+			text = append(text, part.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:       part.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: part.Name, Arguments: string(part.Input)},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "")
+	prompt := m.Usage.promptTokens()
+	return openai.ChatCompletionResponse{
+		ID:      m.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   m.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      msg,
+			FinishReason: anthropicFinishReason(m.StopReason),
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: m.Usage.OutputTokens,
+			TotalTokens:      prompt + m.Usage.OutputTokens,
+		},
+	}
+}
+
+func anthropicFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "":
+		return ""
+	}
+	return openai.FinishReasonStop
+}
+
+// anthropicErrorResponse rewrites an Anthropic error into OpenAI's shape.
+// Anthropic's 529 overloaded becomes a 503, so fallbacks treat it alike.
+func anthropicErrorResponse(resp *http.Response) (*http.Response, error) {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &parsed) != nil || parsed.Error.Message == "" {
+		parsed.Error.Message = strings.TrimSpace(string(data))
+	}
+	if resp.StatusCode == 529 {
+		resp.StatusCode = http.StatusServiceUnavailable
+		resp.Status = "503 Service Unavailable"
+	}
+	converted, _ := json.Marshal(map[string]any{"error": map[string]any{
+		"message": parsed.Error.Message,
+		"type":    parsed.Error.Type,
+		"code":    parsed.Error.Type,
+	}})
+	resp.Body = io.NopCloser(bytes.NewReader(converted))
+	resp.ContentLength = int64(len(converted))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// translateAnthropicHeaders adds the OpenAI names for Anthropic's request
+// ID and rate limit headers, so telemetry and throttling can read them
+func translateAnthropicHeaders(h http.Header) {
+	if id := h.Get("Request-Id"); id != "" && h.Get(upstreamRequestIDHeader) == "" {
+		h.Set(upstreamRequestIDHeader, id)
+	}
+	for _, kind := range []string{"Requests", "Tokens"} {
+		prefix := "Anthropic-Ratelimit-" + kind + "-"
+		if v := h.Get(prefix + "Limit"); v != "" {
+			h.Set("X-Ratelimit-Limit-"+kind, v)
+		}
+		if v := h.Get(prefix + "Remaining"); v != "" {
+			h.Set("X-Ratelimit-Remaining-"+kind, v)
+		}
+		// Anthropic gives the reset as a time; OpenAI as a duration
+		if reset, err := time.Parse(time.RFC3339, h.Get(prefix+"Reset")); err == nil {
+			h.Set("X-Ratelimit-Reset-"+kind, max(time.Until(reset), 0).Round(time.Millisecond).String())
+		}
+	}
+}
+
+// translateAnthropicStream rewrites Anthropic's stream events into OpenAI
+// chunks, ending with [DONE]
+func translateAnthropicStream(src io.ReadCloser, dst *io.PipeWriter) {
+	defer src.Close()
+	var (
+		id, model string
+		created   = time.Now().Unix()
+		// tools maps content block indexes to tool call indexes
+		tools = map[int]int{}
+	)
+	emit := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) error {
+		data, err := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(dst, "data: %s\n\n", data)
+		return err
+	}
+
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				ID    string `json:"id"`
+				Model string `json:"model"`
+			} `json:"message"`
+			ContentBlock anthropicOutputPart `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &event); err != nil {
+			continue
+		}
+
+		var err error
+		switch event.Type {
+		case "message_start":
+			id, model = event.Message.ID, event.Message.Model
+			err = emit(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				i := len(tools)
+				tools[event.Index] = i
+				err = emit(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &i,
+					ID:       event.ContentBlock.ID,
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: event.ContentBlock.Name},
+				}}}, "")
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				err = emit(openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}, "")
+			case "input_json_delta":
+				i := tools[event.Index]
+				err = emit(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &i,
+					Function: openai.FunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}, "")
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				err = emit(openai.ChatCompletionStreamChoiceDelta{}, anthropicFinishReason(event.Delta.StopReason))
+			}
+		case "message_stop":
+			_, err = io.WriteString(dst, "data: [DONE]\n\n")
+			dst.CloseWithError(err)
+			return
+		case "error":
+			data, _ := json.Marshal(map[string]any{"error": map[string]any{
+				"message": event.Error.Message, "type": event.Error.Type, "code": event.Error.Type,
+			}})
+			_, err = fmt.Fprintf(dst, "data: %s\n", data)
+			dst.CloseWithError(err)
+			return
+		}
+		if err != nil {
+			dst.CloseWithError(err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		dst.CloseWithError(err)
+		return
+	}
+	dst.CloseWithError(io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,162 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newAnthropicServer records each Messages API request and answers with
+// reply, as SSE if the request streams
+func newAnthropicServer(t *testing.T, status int, reply string) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("X-Api-Key") != "ant-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("%s %s, key %q, auth %q", r.Method, r.URL.Path, r.Header.Get("X-Api-Key"), r.Header.Get("Authorization"))
+		}
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Header().Set("Request-Id", "req_ant")
+		w.Header().Set("Anthropic-Ratelimit-Requests-Limit", "50")
+		w.Header().Set("Anthropic-Ratelimit-Requests-Remaining", "49")
+		if req["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestAnthropicChatCompletion(t *testing.T) {
+	ant, requests := newAnthropicServer(t, http.StatusOK, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-haiku-20241022",
+		"content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_2","name":"weather","input":{"city":"Oslo"}}],
+		"stop_reason":"tool_use","usage":{"input_tokens":100,"cache_read_input_tokens":20,"output_tokens":30}}`)
+	oai, calls := newChatServer(t, "from openai")
+	rec := &eventRecorder{}
+	client := NewClient("openai-key",
+		WithBaseURL(oai.URL+"/v1"),
+		withRecorder(rec),
+		WithAnthropic(AnthropicConfig{APIKey: "ant-key", BaseURL: ant.URL + "/v1"}),
+	)
+
+	resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model: "claude-3-5-haiku-20241022",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Be brief."},
+			{Role: openai.ChatMessageRoleUser, Content: "Weather in Paris and Oslo?"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+				{ID: "toolu_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+			}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "toolu_1", Content: "sunny"},
+		},
+		Tools: []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name: "weather", Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		}}},
+		ToolChoice: "required",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := (*requests)[0]
+	if sent["system"] != "Be brief." || sent["max_tokens"] != float64(DefaultAnthropicMaxTokens) {
+		t.Errorf("system %v, max_tokens %v", sent["system"], sent["max_tokens"])
+	}
+	turns, _ := json.Marshal(sent["messages"])
+	for _, want := range []string{
+		`{"content":[{"id":"toolu_1","input":{"city":"Paris"},"name":"weather","type":"tool_use"}],"role":"assistant"}`,
+		`{"content":[{"content":"sunny","tool_use_id":"toolu_1","type":"tool_result"}],"role":"user"}`,
+	} {
+		if !strings.Contains(string(turns), want) {
+			t.Errorf("messages %s\nmissing %s", turns, want)
+		}
+	}
+	if choice, _ := json.Marshal(sent["tool_choice"]); string(choice) != `{"type":"any"}` {
+		t.Errorf("tool_choice = %s", choice)
+	}
+
+	msg := resp.Choices[0].Message
+	if msg.Content != "Let me check." || len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"city":"Oslo"}` ||
+		resp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 120 || resp.Usage.CompletionTokens != 30 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+
+	event := rec.all()[0]
+	if want := estimateCost("claude-3-5-haiku-20241022", 120, 30); event.CostEstimateUSD != want || want == estimateCost("unpriced", 120, 30) {
+		t.Errorf("cost = %v, want %v at Anthropic prices", event.CostEstimateUSD, want)
+	}
+	if event.UpstreamRequestID != "req_ant" || event.RateLimit == nil || event.RateLimit.RemainingRequests != 49 {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Other models still go to OpenAI
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil || *calls != 1 {
+		t.Errorf("OpenAI model: err %v, %d calls", err, *calls)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-haiku-20241022","usage":{"input_tokens":10}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+	}
+	var sse strings.Builder
+	for _, e := range events {
+		var typed struct{ Type string }
+		_ = json.Unmarshal([]byte(e), &typed)
+		fmt.Fprintf(&sse, "event: %s\ndata: %s\n\n", typed.Type, e)
+	}
+	ant, _ := newAnthropicServer(t, http.StatusOK, sse.String())
+	client := NewClient("openai-key", WithAnthropic(AnthropicConfig{APIKey: "ant-key", BaseURL: ant.URL + "/v1"}))
+
+	resp, err := client.CollectChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:    "claude-3-5-haiku-latest",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}, StreamCollector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := resp.Choices[0].Message
+	if resp.ID != "msg_1" || msg.Content != "Hello there" || len(msg.ToolCalls) != 1 ||
+		msg.ToolCalls[0].ID != "toolu_1" || msg.ToolCalls[0].Function.Arguments != `{"q":"x"}` ||
+		resp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestAnthropicErrors(t *testing.T) {
+	ant, _ := newAnthropicServer(t, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	client := NewClient("openai-key", WithAnthropic(AnthropicConfig{APIKey: "ant-key", BaseURL: ant.URL + "/v1"}))
+
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "claude-3-haiku-20240307",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusServiceUnavailable || apiErr.Message != "Overloaded" {
+		t.Errorf("err = %#v", err)
+	}
+}
@@ -0,0 +1,424 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultRunPollInterval is how often RunAndWait checks run status when
+// RunWaitOptions.PollInterval is unset
+const DefaultRunPollInterval = time.Second
+
+var (
+	// ErrRunFailed is returned by RunAndWait when a run ends in the failed,
+	// expired, or cancelled state
+	ErrRunFailed = errors.New("langmesh: run did not complete")
+
+	// ErrNoToolHandler is returned by RunAndWait when a run requires tool
+	// outputs and RunWaitOptions.OnRequiredAction is nil
+	ErrNoToolHandler = errors.New("langmesh: run requires tool outputs but no handler is set")
+)
+
+// RunWaitOptions configures RunAndWait
+type RunWaitOptions struct {
+	// PollInterval is the delay between status checks. Defaults to
+	// DefaultRunPollInterval.
+	PollInterval time.Duration
+
+	// OnRequiredAction produces outputs for the tool calls a run is waiting
+	// on. Returning an error cancels the run.
+	OnRequiredAction func(ctx context.Context, run openai.Run, calls []openai.ToolCall) ([]openai.ToolOutput, error)
+}
+
+// trackCall runs call against the underlying client and records a
+// metadata-only telemetry event for it. Assistants endpoints report no
+// per-call usage, so tokens and cost are left to RunAndWait.
+func trackCall[T any](
+	ctx context.Context,
+	c *Client,
+	endpoint, model string,
+	call func(context.Context, *openai.Client) (T, error),
+) (T, error) {
+	return trackGroupCall(ctx, c, EndpointAssistants, endpoint, model, call)
+}
+
+// trackGroupCall is trackCall for endpoints whose timeouts are set by group
+func trackGroupCall[T any](
+	ctx context.Context,
+	c *Client,
+	group Endpoint,
+	endpoint, model string,
+	call func(context.Context, *openai.Client) (T, error),
+) (T, error) {
+	if v := c.policyView(ctx); v != nil {
+		c = v
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, group)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	var resp T
+	err := c.configErr
+	if err == nil {
+		resp, err = call(ctx, c.Client)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		c.recordTelemetry(c.newEvent(ctx, requestID, endpoint, model, startTime, err))
+	}
+
+	return resp, err
+}
+
+// CreateAssistant wraps the original method with telemetry
+func (c *Client) CreateAssistant(ctx context.Context, request openai.AssistantRequest) (openai.Assistant, error) {
+	return trackCall(ctx, c, "assistants.create", request.Model,
+		func(ctx context.Context, api *openai.Client) (openai.Assistant, error) {
+			return api.CreateAssistant(ctx, request)
+		})
+}
+
+// RetrieveAssistant wraps the original method with telemetry
+func (c *Client) RetrieveAssistant(ctx context.Context, assistantID string) (openai.Assistant, error) {
+	return trackCall(ctx, c, "assistants.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.Assistant, error) {
+			return api.RetrieveAssistant(ctx, assistantID)
+		})
+}
+
+// ModifyAssistant wraps the original method with telemetry
+func (c *Client) ModifyAssistant(
+	ctx context.Context,
+	assistantID string,
+	request openai.AssistantRequest,
+) (openai.Assistant, error) {
+	return trackCall(ctx, c, "assistants.modify", request.Model,
+		func(ctx context.Context, api *openai.Client) (openai.Assistant, error) {
+			return api.ModifyAssistant(ctx, assistantID, request)
+		})
+}
+
+// DeleteAssistant wraps the original method with telemetry
+func (c *Client) DeleteAssistant(ctx context.Context, assistantID string) (openai.AssistantDeleteResponse, error) {
+	return trackCall(ctx, c, "assistants.delete", "",
+		func(ctx context.Context, api *openai.Client) (openai.AssistantDeleteResponse, error) {
+			return api.DeleteAssistant(ctx, assistantID)
+		})
+}
+
+// ListAssistants wraps the original method with telemetry
+func (c *Client) ListAssistants(
+	ctx context.Context,
+	limit *int,
+	order, after, before *string,
+) (openai.AssistantsList, error) {
+	return trackCall(ctx, c, "assistants.list", "",
+		func(ctx context.Context, api *openai.Client) (openai.AssistantsList, error) {
+			return api.ListAssistants(ctx, limit, order, after, before)
+		})
+}
+
+// CreateThread wraps the original method with telemetry
+func (c *Client) CreateThread(ctx context.Context, request openai.ThreadRequest) (openai.Thread, error) {
+	return trackCall(ctx, c, "threads.create", "",
+		func(ctx context.Context, api *openai.Client) (openai.Thread, error) {
+			return api.CreateThread(ctx, request)
+		})
+}
+
+// RetrieveThread wraps the original method with telemetry
+func (c *Client) RetrieveThread(ctx context.Context, threadID string) (openai.Thread, error) {
+	return trackCall(ctx, c, "threads.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.Thread, error) {
+			return api.RetrieveThread(ctx, threadID)
+		})
+}
+
+// ModifyThread wraps the original method with telemetry
+func (c *Client) ModifyThread(
+	ctx context.Context,
+	threadID string,
+	request openai.ModifyThreadRequest,
+) (openai.Thread, error) {
+	return trackCall(ctx, c, "threads.modify", "",
+		func(ctx context.Context, api *openai.Client) (openai.Thread, error) {
+			return api.ModifyThread(ctx, threadID, request)
+		})
+}
+
+// DeleteThread wraps the original method with telemetry
+func (c *Client) DeleteThread(ctx context.Context, threadID string) (openai.ThreadDeleteResponse, error) {
+	return trackCall(ctx, c, "threads.delete", "",
+		func(ctx context.Context, api *openai.Client) (openai.ThreadDeleteResponse, error) {
+			return api.DeleteThread(ctx, threadID)
+		})
+}
+
+// CreateMessage wraps the original method with telemetry
+func (c *Client) CreateMessage(
+	ctx context.Context,
+	threadID string,
+	request openai.MessageRequest,
+) (openai.Message, error) {
+	return trackCall(ctx, c, "threads.messages.create", "",
+		func(ctx context.Context, api *openai.Client) (openai.Message, error) {
+			return api.CreateMessage(ctx, threadID, request)
+		})
+}
+
+// ListMessage wraps the original method with telemetry
+func (c *Client) ListMessage(
+	ctx context.Context,
+	threadID string,
+	limit *int,
+	order, after, before *string,
+) (openai.MessagesList, error) {
+	return trackCall(ctx, c, "threads.messages.list", "",
+		func(ctx context.Context, api *openai.Client) (openai.MessagesList, error) {
+			return api.ListMessage(ctx, threadID, limit, order, after, before)
+		})
+}
+
+// RetrieveMessage wraps the original method with telemetry
+func (c *Client) RetrieveMessage(ctx context.Context, threadID, messageID string) (openai.Message, error) {
+	return trackCall(ctx, c, "threads.messages.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.Message, error) {
+			return api.RetrieveMessage(ctx, threadID, messageID)
+		})
+}
+
+// ModifyMessage wraps the original method with telemetry
+func (c *Client) ModifyMessage(
+	ctx context.Context,
+	threadID, messageID string,
+	metadata map[string]any,
+) (openai.Message, error) {
+	return trackCall(ctx, c, "threads.messages.modify", "",
+		func(ctx context.Context, api *openai.Client) (openai.Message, error) {
+			return api.ModifyMessage(ctx, threadID, messageID, metadata)
+		})
+}
+
+// CreateRun wraps the original method with telemetry
+func (c *Client) CreateRun(ctx context.Context, threadID string, request openai.RunRequest) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.runs.create", request.Model,
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.CreateRun(ctx, threadID, request)
+		})
+}
+
+// RetrieveRun wraps the original method with telemetry
+func (c *Client) RetrieveRun(ctx context.Context, threadID, runID string) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.runs.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.RetrieveRun(ctx, threadID, runID)
+		})
+}
+
+// ModifyRun wraps the original method with telemetry
+func (c *Client) ModifyRun(
+	ctx context.Context,
+	threadID, runID string,
+	request openai.RunModifyRequest,
+) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.runs.modify", "",
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.ModifyRun(ctx, threadID, runID, request)
+		})
+}
+
+// ListRuns wraps the original method with telemetry
+func (c *Client) ListRuns(ctx context.Context, threadID string, pagination openai.Pagination) (openai.RunList, error) {
+	return trackCall(ctx, c, "threads.runs.list", "",
+		func(ctx context.Context, api *openai.Client) (openai.RunList, error) {
+			return api.ListRuns(ctx, threadID, pagination)
+		})
+}
+
+// SubmitToolOutputs wraps the original method with telemetry
+func (c *Client) SubmitToolOutputs(
+	ctx context.Context,
+	threadID, runID string,
+	request openai.SubmitToolOutputsRequest,
+) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.runs.submit_tool_outputs", "",
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.SubmitToolOutputs(ctx, threadID, runID, request)
+		})
+}
+
+// CancelRun wraps the original method with telemetry
+func (c *Client) CancelRun(ctx context.Context, threadID, runID string) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.runs.cancel", "",
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.CancelRun(ctx, threadID, runID)
+		})
+}
+
+// CreateThreadAndRun wraps the original method with telemetry
+func (c *Client) CreateThreadAndRun(ctx context.Context, request openai.CreateThreadAndRunRequest) (openai.Run, error) {
+	return trackCall(ctx, c, "threads.create_and_run", request.Model,
+		func(ctx context.Context, api *openai.Client) (openai.Run, error) {
+			return api.CreateThreadAndRun(ctx, request)
+		})
+}
+
+// RetrieveRunStep wraps the original method with telemetry
+func (c *Client) RetrieveRunStep(ctx context.Context, threadID, runID, stepID string) (openai.RunStep, error) {
+	return trackCall(ctx, c, "threads.runs.steps.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.RunStep, error) {
+			return api.RetrieveRunStep(ctx, threadID, runID, stepID)
+		})
+}
+
+// ListRunSteps wraps the original method with telemetry
+func (c *Client) ListRunSteps(
+	ctx context.Context,
+	threadID, runID string,
+	pagination openai.Pagination,
+) (openai.RunStepList, error) {
+	return trackCall(ctx, c, "threads.runs.steps.list", "",
+		func(ctx context.Context, api *openai.Client) (openai.RunStepList, error) {
+			return api.ListRunSteps(ctx, threadID, runID, pagination)
+		})
+}
+
+// RunAndWait starts a run on threadID and polls it until it reaches a
+// terminal status, answering tool calls with opts.OnRequiredAction along the
+// way. It records a single "threads.runs" telemetry event covering the whole
+// run, with its total token usage and wall-clock latency, instead of one
+// event per poll.
+func (c *Client) RunAndWait(
+	ctx context.Context,
+	threadID string,
+	request openai.RunRequest,
+	opts RunWaitOptions,
+) (openai.Run, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.RunAndWait(ctx, threadID, request, opts)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+	ctx, _ = withCallState(ctx, requestID)
+
+	var run openai.Run
+	err := c.configErr
+	if err == nil {
+		run, err = c.waitForRun(ctx, threadID, request, opts)
+	}
+
+	if c.instrumented(ctx) {
+		model := run.Model
+		if model == "" {
+			model = request.Model
+		}
+		event := c.newEvent(ctx, requestID, "threads.runs", model, startTime, err)
+		event.RunID = run.ID
+		event.TokenUsage = TokenUsage{
+			PromptTokens:     run.Usage.PromptTokens,
+			CompletionTokens: run.Usage.CompletionTokens,
+			TotalTokens:      run.Usage.TotalTokens,
+		}
+		event.CostEstimateUSD = c.estimateCost(model, run.Usage.PromptTokens, run.Usage.CompletionTokens)
+		c.recordTelemetry(event)
+	}
+
+	return run, err
+}
+
+func (c *Client) waitForRun(
+	ctx context.Context,
+	threadID string,
+	request openai.RunRequest,
+	opts RunWaitOptions,
+) (openai.Run, error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultRunPollInterval
+	}
+
+	run, err := c.Client.CreateRun(ctx, threadID, request)
+	if err != nil {
+		return run, err
+	}
+
+	for {
+		switch run.Status {
+		case openai.RunStatusCompleted:
+			return run, nil
+		case openai.RunStatusFailed, openai.RunStatusExpired, openai.RunStatusCancelled:
+			return run, runError(run)
+		case openai.RunStatusRequiresAction:
+			run, err = c.answerToolCalls(ctx, threadID, run, opts)
+			if err != nil {
+				return run, err
+			}
+			continue
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return run, ctx.Err()
+		case <-timer.C:
+		}
+
+		next, err := c.Client.RetrieveRun(ctx, threadID, run.ID)
+		if err != nil {
+			return run, err
+		}
+		run = next
+	}
+}
+
+func (c *Client) answerToolCalls(
+	ctx context.Context,
+	threadID string,
+	run openai.Run,
+	opts RunWaitOptions,
+) (openai.Run, error) {
+	if run.RequiredAction == nil || run.RequiredAction.SubmitToolOutputs == nil {
+		return run, fmt.Errorf("langmesh: run %s requires an unsupported action", run.ID)
+	}
+	if opts.OnRequiredAction == nil {
+		c.cancelRun(ctx, threadID, run.ID)
+		return run, ErrNoToolHandler
+	}
+
+	outputs, err := opts.OnRequiredAction(ctx, run, run.RequiredAction.SubmitToolOutputs.ToolCalls)
+	if err != nil {
+		c.cancelRun(ctx, threadID, run.ID)
+		return run, err
+	}
+	next, err := c.Client.SubmitToolOutputs(ctx, threadID, run.ID, openai.SubmitToolOutputsRequest{ToolOutputs: outputs})
+	if err != nil {
+		return run, err
+	}
+	return next, nil
+}
+
+// cancelRun makes a best-effort attempt to stop a run RunAndWait is
+// abandoning, so it does not keep consuming tokens
+func (c *Client) cancelRun(ctx context.Context, threadID, runID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	_, _ = c.Client.CancelRun(ctx, threadID, runID)
+}
+
+func runError(run openai.Run) error {
+	if run.LastError != nil {
+		return fmt.Errorf("%w: %s: %s: %s", ErrRunFailed, run.Status, run.LastError.Code, run.LastError.Message)
+	}
+	return fmt.Errorf("%w: %s", ErrRunFailed, run.Status)
+}
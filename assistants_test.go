@@ -0,0 +1,181 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newRunServer simulates a run that asks for one tool call and then
+// completes. With fail set, the run fails instead of completing.
+func newRunServer(t *testing.T, fail bool) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	status := "queued"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/threads/thread_1/runs":
+			status = "queued"
+		case strings.HasSuffix(r.URL.Path, "/submit_tool_outputs"):
+			var req openai.SubmitToolOutputsRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if len(req.ToolOutputs) != 1 || req.ToolOutputs[0].ToolCallID != "call_1" {
+				t.Errorf("unexpected tool outputs: %+v", req.ToolOutputs)
+			}
+			status = "in_progress"
+		case strings.HasSuffix(r.URL.Path, "/cancel"):
+			status = "cancelled"
+		case r.Method == http.MethodGet:
+			switch status {
+			case "queued":
+				status = "requires_action"
+			case "in_progress":
+				status = "completed"
+				if fail {
+					status = "failed"
+				}
+			}
+		}
+
+		body := map[string]any{"id": "run_1", "thread_id": "thread_1", "model": "gpt-4o", "status": status}
+		switch status {
+		case "requires_action":
+			body["required_action"] = map[string]any{
+				"type": "submit_tool_outputs",
+				"submit_tool_outputs": map[string]any{"tool_calls": []any{map[string]any{
+					"id": "call_1", "type": "function",
+					"function": map[string]any{"name": "lookup", "arguments": "{}"},
+				}}},
+			}
+		case "completed":
+			body["usage"] = map[string]any{"prompt_tokens": 100, "completion_tokens": 20, "total_tokens": 120}
+		case "failed":
+			body["last_error"] = map[string]any{"code": "server_error", "message": "boom"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &paths
+}
+
+func answerLookup(_ context.Context, _ openai.Run, calls []openai.ToolCall) ([]openai.ToolOutput, error) {
+	outputs := make([]openai.ToolOutput, len(calls))
+	for i, call := range calls {
+		outputs[i] = openai.ToolOutput{ToolCallID: call.ID, Output: "42"}
+	}
+	return outputs, nil
+}
+
+func TestRunAndWaitConsolidatesTelemetry(t *testing.T) {
+	srv, _ := newRunServer(t, false)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	run, err := client.RunAndWait(context.Background(), "thread_1", openai.RunRequest{AssistantID: "asst_1"},
+		RunWaitOptions{PollInterval: time.Millisecond, OnRequiredAction: answerLookup})
+	if err != nil {
+		t.Fatalf("RunAndWait: %v", err)
+	}
+	if run.Status != openai.RunStatusCompleted {
+		t.Fatalf("status = %s, want completed", run.Status)
+	}
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1 for the whole run", len(events))
+	}
+	event := events[0]
+	if event.Endpoint != "threads.runs" || event.RunID != "run_1" || event.Model != "gpt-4o" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.TokenUsage.TotalTokens != 120 || event.CostEstimateUSD <= 0 {
+		t.Errorf("usage not recorded: %+v cost=%v", event.TokenUsage, event.CostEstimateUSD)
+	}
+	if event.Status != "success" {
+		t.Errorf("status = %s, want success", event.Status)
+	}
+}
+
+func TestRunAndWaitFailedRun(t *testing.T) {
+	srv, _ := newRunServer(t, true)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	run, err := client.RunAndWait(context.Background(), "thread_1", openai.RunRequest{AssistantID: "asst_1"},
+		RunWaitOptions{PollInterval: time.Millisecond, OnRequiredAction: answerLookup})
+	if !errors.Is(err, ErrRunFailed) {
+		t.Fatalf("err = %v, want ErrRunFailed", err)
+	}
+	if run.Status != openai.RunStatusFailed {
+		t.Errorf("status = %s, want failed", run.Status)
+	}
+	if events := rec.all(); len(events) != 1 || events[0].Status != "error" {
+		t.Errorf("want one error event, got %+v", events)
+	}
+}
+
+func TestRunAndWaitCancelsWhenHandlerFails(t *testing.T) {
+	srv, paths := newRunServer(t, false)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+
+	handlerErr := fmt.Errorf("tool unavailable")
+	_, err := client.RunAndWait(context.Background(), "thread_1", openai.RunRequest{AssistantID: "asst_1"},
+		RunWaitOptions{
+			PollInterval: time.Millisecond,
+			OnRequiredAction: func(context.Context, openai.Run, []openai.ToolCall) ([]openai.ToolOutput, error) {
+				return nil, handlerErr
+			},
+		})
+	if !errors.Is(err, handlerErr) {
+		t.Fatalf("err = %v, want handler error", err)
+	}
+	if last := (*paths)[len(*paths)-1]; last != "POST /v1/threads/thread_1/runs/run_1/cancel" {
+		t.Errorf("last request = %s, want cancel", last)
+	}
+
+	_, err = client.RunAndWait(context.Background(), "thread_1", openai.RunRequest{AssistantID: "asst_1"},
+		RunWaitOptions{PollInterval: time.Millisecond})
+	if !errors.Is(err, ErrNoToolHandler) {
+		t.Fatalf("err = %v, want ErrNoToolHandler", err)
+	}
+}
+
+func TestAssistantWrappersRecordEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"thread_1","object":"thread"}`)
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	if _, err := client.CreateThread(context.Background(), openai.ThreadRequest{}); err != nil {
+		t.Fatalf("CreateThread: %v", err)
+	}
+	if _, err := client.CreateAssistant(context.Background(), openai.AssistantRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("CreateAssistant: %v", err)
+	}
+
+	events := rec.all()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Endpoint != "threads.create" || events[1].Endpoint != "assistants.create" || events[1].Model != "gpt-4o" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,372 @@
+package langmesh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrAuditChain is wrapped by VerifyAuditLog for a record that was altered,
+// removed or reordered
+var ErrAuditChain = errors.New("langmesh: audit chain broken")
+
+// AuditRecord is the audit log entry for one upstream HTTP request. Bodies
+// are not stored, only their SHA-256, so a copy of what was sent can be
+// proven genuine without the log holding prompts.
+type AuditRecord struct {
+	// Sequence numbers records from 1, without gaps
+	Sequence  uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Model     string    `json:"model,omitempty"`
+
+	RequestHash   string `json:"request_sha256"`
+	RequestBytes  int64  `json:"request_bytes"`
+	StatusCode    int    `json:"status_code,omitempty"`
+	ResponseHash  string `json:"response_sha256,omitempty"`
+	ResponseBytes int64  `json:"response_bytes,omitempty"`
+	// Error is set instead of the response when the request failed
+	Error string `json:"error,omitempty"`
+
+	// PrevHash is the previous record's Hash, empty for the first record
+	PrevHash string `json:"prev_hash"`
+	// Hash is the SHA-256 of the record without Hash and Signature
+	Hash string `json:"hash"`
+	// Signature is the HMAC-SHA256 of Hash, when the log has a key
+	Signature string `json:"signature,omitempty"`
+}
+
+// digest computes the record's Hash
+func (r AuditRecord) digest() string {
+	r.Hash, r.Signature = "", ""
+	// A struct of plain fields always marshals
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func auditSignature(key []byte, digest string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(digest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuditStore persists audit records. Append is called in sequence order,
+// one record at a time.
+type AuditStore interface {
+	Append(ctx context.Context, record AuditRecord) error
+	// Last returns the most recent record, or nil if the log is empty, so
+	// the chain continues across restarts
+	Last(ctx context.Context) (*AuditRecord, error)
+}
+
+// AuditLog configures WithAuditLog
+type AuditLog struct {
+	Store AuditStore
+	// HMACKey, if set, signs every record, so the chain cannot be rebuilt
+	// by someone without the key
+	HMACKey []byte
+}
+
+// WithAuditLog writes an append-only, hash-chained record of every request
+// the client sends upstream: when it was sent, by whom, to which model,
+// and digests of the request and response bodies. Each record includes
+// the hash of the one before it, so VerifyAuditLog detects any record
+// altered or removed. Records are appended once the response body is read
+// or closed; store failures are logged at LogTelemetry and never fail the
+// call. Without a Store nothing is recorded, and WithStrictMode reports it.
+func WithAuditLog(cfg AuditLog) Option {
+	return func(c *Client) {
+		c.audit = &auditChain{cfg: cfg, client: c}
+	}
+}
+
+// auditChain links records in the order they are appended
+type auditChain struct {
+	cfg    AuditLog
+	client *Client
+
+	mu     sync.Mutex
+	loaded bool
+	seq    uint64
+	prev   string
+}
+
+func (a *auditChain) append(ctx context.Context, record AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.loaded {
+		last, err := a.cfg.Store.Last(ctx)
+		if err != nil {
+			a.client.log(ctx, LogTelemetry, "audit log unreadable", "error", err)
+			return
+		}
+		if last != nil {
+			a.seq, a.prev = last.Sequence, last.Hash
+		}
+		a.loaded = true
+	}
+	record.Sequence = a.seq + 1
+	record.PrevHash = a.prev
+	record.Hash = record.digest()
+	if a.cfg.HMACKey != nil {
+		record.Signature = auditSignature(a.cfg.HMACKey, record.Hash)
+	}
+	if err := a.cfg.Store.Append(ctx, record); err != nil {
+		a.client.log(ctx, LogTelemetry, "audit log append failed", "request_id", record.RequestID, "error", err)
+		return
+	}
+	a.seq, a.prev = record.Sequence, record.Hash
+}
+
+// VerifyAuditLog checks that records, oldest first, form an unbroken
+// chain from the start of the log and, with hmacKey, are all signed by it
+func VerifyAuditLog(records []AuditRecord, hmacKey []byte) error {
+	prev := ""
+	for i, r := range records {
+		switch {
+		case r.Sequence != uint64(i+1):
+			return fmt.Errorf("%w: record %d has sequence %d", ErrAuditChain, i+1, r.Sequence)
+		case r.PrevHash != prev:
+			return fmt.Errorf("%w: record %d does not follow record %d", ErrAuditChain, r.Sequence, i)
+		case r.digest() != r.Hash:
+			return fmt.Errorf("%w: record %d was altered", ErrAuditChain, r.Sequence)
+		case hmacKey != nil && !hmac.Equal([]byte(r.Signature), []byte(auditSignature(hmacKey, r.Hash))):
+			return fmt.Errorf("%w: record %d has a bad signature", ErrAuditChain, r.Sequence)
+		}
+		prev = r.Hash
+	}
+	return nil
+}
+
+// ReadAuditLog decodes the JSON Lines written by FileAuditStore
+func ReadAuditLog(r io.Reader) ([]AuditRecord, error) {
+	var records []AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("langmesh: audit record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// MemoryAuditStore is an AuditStore held in process memory, for tests
+type MemoryAuditStore struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+// Append adds record to the log
+func (s *MemoryAuditStore) Append(_ context.Context, record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Last returns the most recent record
+func (s *MemoryAuditStore) Last(context.Context) (*AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) == 0 {
+		return nil, nil
+	}
+	last := s.records[len(s.records)-1]
+	return &last, nil
+}
+
+// Records returns a copy of the log, oldest first
+func (s *MemoryAuditStore) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+// FileAuditStore is an AuditStore appending JSON Lines to a file, synced
+// after every record
+type FileAuditStore struct {
+	Path string
+}
+
+// NewFileAuditStore creates a FileAuditStore at path, which is created on
+// the first append if it does not exist
+func NewFileAuditStore(path string) *FileAuditStore {
+	return &FileAuditStore{Path: path}
+}
+
+// Append writes record as a line at the end of the file
+func (s *FileAuditStore) Append(_ context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Last reads the file's final record
+func (s *FileAuditStore) Last(context.Context) (*AuditRecord, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := ReadAuditLog(f)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[len(records)-1], nil
+}
+
+// auditTransport records each request and its response in the audit log
+type auditTransport struct {
+	base  http.RoundTripper
+	chain *auditChain
+}
+
+func (t auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	record := AuditRecord{
+		Timestamp: time.Now().UTC(),
+		RequestID: callStateFrom(ctx).id(),
+		User:      ScopeFrom(ctx).User,
+		Method:    req.Method,
+		Host:      req.URL.Host,
+		Path:      req.URL.Path,
+	}
+
+	// Hash a copy of the body when one can be had; streamed uploads are
+	// hashed as the transport reads them
+	var reqHash *countingHash
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		reqHash = newCountingHash()
+	case req.GetBody != nil:
+		if body, err := req.GetBody(); err == nil {
+			data, err := io.ReadAll(body)
+			body.Close()
+			if err == nil {
+				reqHash = newCountingHash()
+				reqHash.Write(data)
+				var fields struct {
+					Model string `json:"model"`
+				}
+				_ = json.Unmarshal(data, &fields)
+				record.Model = fields.Model
+			}
+		}
+	}
+	if reqHash == nil {
+		reqHash = newCountingHash()
+		req = req.Clone(ctx)
+		req.Body = hashingBody{ReadCloser: req.Body, w: reqHash}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	record.RequestHash, record.RequestBytes = reqHash.sum()
+	if err != nil {
+		record.Error = err.Error()
+		t.chain.append(ctx, record)
+		return nil, err
+	}
+	record.StatusCode = resp.StatusCode
+	respHash := newCountingHash()
+	resp.Body = &auditedBody{
+		hashingBody: hashingBody{ReadCloser: resp.Body, w: respHash},
+		done: func() {
+			record.ResponseHash, record.ResponseBytes = respHash.sum()
+			t.chain.append(context.WithoutCancel(ctx), record)
+		},
+	}
+	return resp, nil
+}
+
+// countingHash is a SHA-256 that also counts the bytes written
+type countingHash struct {
+	h hash.Hash
+	n int64
+}
+
+func newCountingHash() *countingHash {
+	return &countingHash{h: sha256.New()}
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.h.Write(p)
+}
+
+func (c *countingHash) sum() (string, int64) {
+	return hex.EncodeToString(c.h.Sum(nil)), c.n
+}
+
+// hashingBody copies everything read from a body into w
+type hashingBody struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (b hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.w.Write(p[:n])
+	return n, err
+}
+
+// auditedBody calls done once the body is fully read or closed
+type auditedBody struct {
+	hashingBody
+	once sync.Once
+	done func()
+}
+
+func (b *auditedBody) Read(p []byte) (int, error) {
+	n, err := b.hashingBody.Read(p)
+	if err != nil {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *auditedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,118 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogChainsRequests(t *testing.T) {
+	srv, _ := newChatServer(t, "hello")
+	store := &MemoryAuditStore{}
+	key := []byte("audit-secret")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithAuditLog(AuditLog{Store: store, HMACKey: key}))
+
+	ctx := ContextWithUser(context.Background(), "alice")
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := store.Records()
+	if len(records) != 3 {
+		t.Fatalf("records = %d, want 3", len(records))
+	}
+	first := records[0]
+	if first.Sequence != 1 || first.PrevHash != "" || records[1].PrevHash != first.Hash {
+		t.Errorf("chain = %+v", records)
+	}
+	if first.Model != "gpt-4o-mini" || first.User != "alice" || first.Path != "/v1/chat/completions" || first.StatusCode != 200 {
+		t.Errorf("record = %+v", first)
+	}
+	if first.RequestID != rec.all()[0].RequestID {
+		t.Errorf("request ID = %q, want %q", first.RequestID, rec.all()[0].RequestID)
+	}
+	body, _ := json.Marshal(chatRequest("hi"))
+	if sum := sha256.Sum256(body); first.RequestHash != hex.EncodeToString(sum[:]) || first.RequestBytes != int64(len(body)) {
+		t.Errorf("request hash = %s over %d bytes", first.RequestHash, first.RequestBytes)
+	}
+	if first.ResponseHash == "" || first.ResponseBytes == 0 {
+		t.Errorf("response not hashed: %+v", first)
+	}
+	if err := VerifyAuditLog(records, key); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if err := VerifyAuditLog(records, []byte("other")); !errors.Is(err, ErrAuditChain) {
+		t.Errorf("wrong key: %v", err)
+	}
+
+	altered := append([]AuditRecord(nil), records...)
+	altered[1].Model = "gpt-4o"
+	if err := VerifyAuditLog(altered, key); !errors.Is(err, ErrAuditChain) {
+		t.Errorf("altered record: %v", err)
+	}
+	removed := append([]AuditRecord{records[0]}, records[2])
+	if err := VerifyAuditLog(removed, nil); !errors.Is(err, ErrAuditChain) {
+		t.Errorf("removed record: %v", err)
+	}
+}
+
+func TestFileAuditStoreContinuesChain(t *testing.T) {
+	srv, _ := newChatServer(t, "hello")
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		// A new client picks the chain up where the file ends
+		client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(&eventRecorder{}),
+			WithAuditLog(AuditLog{Store: NewFileAuditStore(path)}))
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := ReadAuditLog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Sequence != 2 {
+		t.Fatalf("records = %+v", records)
+	}
+	if err := VerifyAuditLog(records, nil); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v", info.Mode())
+	}
+}
+
+func TestAuditLogRecordsFailedRequests(t *testing.T) {
+	store := &MemoryAuditStore{}
+	client := NewClient("test-key", WithBaseURL("http://127.0.0.1:1/v1"), withRecorder(&eventRecorder{}),
+		WithAuditLog(AuditLog{Store: store}))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err == nil {
+		t.Fatal("expected connection error")
+	}
+	records := store.Records()
+	if len(records) != 1 || records[0].Error == "" || records[0].StatusCode != 0 {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestAuditLogWithoutStoreIsMisconfigured(t *testing.T) {
+	_, err := NewStrictClient("test-key", WithAuditLog(AuditLog{}))
+	if err == nil {
+		t.Error("expected misconfiguration")
+	}
+}
@@ -0,0 +1,183 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Reranker scores the candidate choices CreateBestOfN generated for
+// request, one score per candidate, higher being better
+type Reranker func(ctx context.Context, request openai.ChatCompletionRequest, candidates []openai.ChatCompletionChoice) ([]float64, error)
+
+// BestOfNResult is the outcome of CreateBestOfN
+type BestOfNResult struct {
+	// Response is the completion with Choices holding only the best
+	// candidate; its Usage covers every candidate
+	Response openai.ChatCompletionResponse
+	// Best indexes the chosen candidate in Candidates and Scores
+	Best       int
+	Candidates []openai.ChatCompletionChoice
+	Scores     []float64
+}
+
+// CreateBestOfN generates n candidate answers to request and returns the
+// one rerank scores highest. OpenAI models produce the candidates in one
+// call with the n parameter; other backends get n parallel calls, of which
+// at least one must succeed. Each call is recorded in telemetry as usual.
+// Candidates only differ when sampled, so leave Temperature above zero.
+func (c *Client) CreateBestOfN(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	n int,
+	rerank Reranker,
+) (BestOfNResult, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateBestOfN(ctx, request, n, rerank)
+	}
+	if n < 1 {
+		return BestOfNResult{}, fmt.Errorf("langmesh: best-of-n needs n of at least 1, got %d", n)
+	}
+
+	var result BestOfNResult
+	var err error
+	if c.providerFor(request.Model) == providerOpenAI {
+		request.N = n
+		result.Response, err = c.CreateChatCompletion(ctx, request)
+	} else {
+		result.Response, err = c.parallelCandidates(ctx, request, n)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Candidates = result.Response.Choices
+	if len(result.Candidates) == 0 {
+		return result, errors.New("langmesh: best-of-n got a completion with no choices")
+	}
+
+	result.Scores, err = rerank(ctx, request, result.Candidates)
+	if err != nil {
+		return result, err
+	}
+	if len(result.Scores) != len(result.Candidates) {
+		return result, fmt.Errorf("langmesh: reranker returned %d scores for %d candidates", len(result.Scores), len(result.Candidates))
+	}
+	for i, score := range result.Scores {
+		if score > result.Scores[result.Best] {
+			result.Best = i
+		}
+	}
+	result.Response.Choices = []openai.ChatCompletionChoice{result.Candidates[result.Best]}
+	return result, nil
+}
+
+// parallelCandidates makes n calls for request, merging their choices and
+// usage into one response
+func (c *Client) parallelCandidates(ctx context.Context, request openai.ChatCompletionRequest, n int) (openai.ChatCompletionResponse, error) {
+	resps := make([]openai.ChatCompletionResponse, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range resps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], errs[i] = c.CreateChatCompletion(ctx, request)
+		}(i)
+	}
+	wg.Wait()
+
+	var merged openai.ChatCompletionResponse
+	for i, resp := range resps {
+		if errs[i] != nil {
+			continue
+		}
+		if merged.ID == "" {
+			merged = resp
+			merged.Choices = nil
+			merged.Usage = openai.Usage{}
+		}
+		for _, choice := range resp.Choices {
+			choice.Index = len(merged.Choices)
+			merged.Choices = append(merged.Choices, choice)
+		}
+		merged.Usage.PromptTokens += resp.Usage.PromptTokens
+		merged.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		merged.Usage.TotalTokens += resp.Usage.TotalTokens
+	}
+	if len(merged.Choices) == 0 {
+		return merged, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+// HeuristicReranker scores each candidate with score
+func HeuristicReranker(score func(choice openai.ChatCompletionChoice) float64) Reranker {
+	return func(_ context.Context, _ openai.ChatCompletionRequest, candidates []openai.ChatCompletionChoice) ([]float64, error) {
+		scores := make([]float64, len(candidates))
+		for i, choice := range candidates {
+			scores[i] = score(choice)
+		}
+		return scores, nil
+	}
+}
+
+// EmbeddingReranker scores candidates by the cosine similarity of their
+// content to reference, such as a known good answer, embedded with model
+// through c. Candidates with no content score zero.
+func EmbeddingReranker(c *Client, model openai.EmbeddingModel, reference string) Reranker {
+	return func(ctx context.Context, _ openai.ChatCompletionRequest, candidates []openai.ChatCompletionChoice) ([]float64, error) {
+		texts := []string{reference}
+		var embedded []int
+		for i, choice := range candidates {
+			if strings.TrimSpace(choice.Message.Content) != "" {
+				texts = append(texts, choice.Message.Content)
+				embedded = append(embedded, i)
+			}
+		}
+		scores := make([]float64, len(candidates))
+		if len(embedded) == 0 {
+			return scores, nil
+		}
+		result, err := c.EmbedTexts(ctx, model, texts, EmbedOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range embedded {
+			scores[i] = CosineSimilarity(result.Embeddings[0], result.Embeddings[j+1])
+		}
+		return scores, nil
+	}
+}
+
+// JudgeReranker has judge score each candidate against rubric through c,
+// the way WithQualityScoring does, concurrently. Empty fields take the
+// quality scoring defaults. The judge calls are not recorded in telemetry.
+func JudgeReranker(c *Client, judge, rubric string) Reranker {
+	q := &qualityScorer{cfg: QualityScoring{Model: judge, Rubric: rubric}}
+	if q.cfg.Model == "" {
+		q.cfg.Model = DefaultQualityJudgeModel
+	}
+	if q.cfg.Rubric == "" {
+		q.cfg.Rubric = DefaultQualityRubric
+	}
+	return func(ctx context.Context, request openai.ChatCompletionRequest, candidates []openai.ChatCompletionChoice) ([]float64, error) {
+		scores := make([]float64, len(candidates))
+		errs := make([]error, len(candidates))
+		var wg sync.WaitGroup
+		for i, choice := range candidates {
+			wg.Add(1)
+			go func(i int, choice openai.ChatCompletionChoice) {
+				defer wg.Done()
+				resp := openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}}
+				score, err := q.score(ctx, c, request, resp)
+				scores[i], errs[i] = score.Score, err
+			}(i, choice)
+		}
+		wg.Wait()
+		return scores, errors.Join(errs...)
+	}
+}
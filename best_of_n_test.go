@@ -0,0 +1,118 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var bestOfNAnswers = []string{"Billing is monthly.", "Shipping takes three days.", "Returns are free."}
+
+// newBestOfNServer answers chat requests with one choice per requested n,
+// or a different answer per call when n is unset, judges answers about
+// shipping highest, and embeds by topic
+func newBestOfNServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			var req struct {
+				Input []string `json:"input"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			resp := openai.EmbeddingResponse{}
+			for i, text := range req.Input {
+				resp.Data = append(resp.Data, openai.Embedding{Embedding: topicVector(text), Index: i})
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.ResponseFormat != nil {
+			score := 2
+			if strings.Contains(req.Messages[1].Content, "Shipping") {
+				score = 9
+			}
+			fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"{\"score\": %d}"}}]}`, score)
+			return
+		}
+		call := int(atomic.AddInt32(&calls, 1)) - 1
+		var choices []string
+		if req.N > 1 {
+			for i := 0; i < req.N; i++ {
+				choices = append(choices, fmt.Sprintf(`{"index":%d,"message":{"role":"assistant","content":%q}}`, i, bestOfNAnswers[i%3]))
+			}
+		} else {
+			choices = []string{fmt.Sprintf(`{"index":0,"message":{"role":"assistant","content":%q}}`, bestOfNAnswers[call%3])}
+		}
+		fmt.Fprintf(w, `{"id":"c1","model":%q,"choices":[%s],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			req.Model, strings.Join(choices, ","))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestCreateBestOfN(t *testing.T) {
+	srv, calls := newBestOfNServer(t)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	longest := HeuristicReranker(func(choice openai.ChatCompletionChoice) float64 {
+		return float64(len(choice.Message.Content))
+	})
+
+	result, err := client.CreateBestOfN(context.Background(), chatRequest("tell me"), 3, longest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 1 || len(result.Candidates) != 3 || len(result.Scores) != 3 {
+		t.Fatalf("calls = %d, result = %+v", *calls, result)
+	}
+	if result.Best != 1 || len(result.Response.Choices) != 1 || result.Response.Choices[0].Message.Content != bestOfNAnswers[1] {
+		t.Errorf("best = %d, response = %+v", result.Best, result.Response.Choices)
+	}
+
+	for name, rerank := range map[string]Reranker{
+		"judge":     JudgeReranker(client, "", ""),
+		"embedding": EmbeddingReranker(client, openai.SmallEmbedding3, "How long does shipping take?"),
+	} {
+		result, err := client.CreateBestOfN(context.Background(), chatRequest("tell me"), 3, rerank)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Best != 1 {
+			t.Errorf("%s: best = %d, scores = %v", name, result.Best, result.Scores)
+		}
+	}
+
+	if _, err := client.CreateBestOfN(context.Background(), chatRequest("tell me"), 0, longest); err == nil {
+		t.Error("expected an error for n = 0")
+	}
+}
+
+func TestCreateBestOfNParallel(t *testing.T) {
+	srv, calls := newBestOfNServer(t)
+	rec := &eventRecorder{}
+	client := NewClient("", withRecorder(rec), WithLocalBackend(LocalBackend{BaseURL: srv.URL + "/v1"}))
+	first := HeuristicReranker(func(choice openai.ChatCompletionChoice) float64 {
+		return -float64(choice.Index)
+	})
+
+	result, err := client.CreateBestOfN(context.Background(), chatRequest("tell me"), 3, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 || len(rec.all()) != 3 || len(result.Candidates) != 3 {
+		t.Fatalf("calls = %d, events = %d, candidates = %d", *calls, len(rec.all()), len(result.Candidates))
+	}
+	if result.Best != 0 || result.Response.Usage.TotalTokens != 45 {
+		t.Errorf("best = %d, usage = %+v", result.Best, result.Response.Usage)
+	}
+}
@@ -0,0 +1,220 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartitionKey picks the key an event is published under: a Kafka
+// message key, so one key's events stay ordered on one partition, or a
+// NATS subject token. An empty key leaves placement to the broker.
+type PartitionKey func(TelemetryEvent) string
+
+// PartitionByModel keys events by model
+func PartitionByModel(e TelemetryEvent) string { return e.Model }
+
+// PartitionByTag keys events by the value of tag, e.g. a tenant
+func PartitionByTag(tag string) PartitionKey {
+	return func(e TelemetryEvent) string { return e.Tags[tag] }
+}
+
+// brokerMessage is one message of a batch bound for a broker
+type brokerMessage struct {
+	key   string
+	value []byte
+	// requestID is the event's, or the first event's when batched
+	requestID string
+}
+
+// encodeBrokerMessages encodes events one per message, or with batch one
+// {"events": [...]} message per key, in order of each key's first event
+func encodeBrokerMessages(events []TelemetryEvent, partition PartitionKey, batch bool) ([]brokerMessage, error) {
+	keyOf := func(e TelemetryEvent) string {
+		if partition == nil {
+			return ""
+		}
+		return partition(e)
+	}
+	if !batch {
+		out := make([]brokerMessage, 0, len(events))
+		for i, e := range events {
+			value, err := json.Marshal(eventJSON(&events[i]))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, brokerMessage{key: keyOf(e), value: value, requestID: e.RequestID})
+		}
+		return out, nil
+	}
+
+	var order []string
+	groups := make(map[string][]TelemetryEvent)
+	for _, e := range events {
+		key := keyOf(e)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+	out := make([]brokerMessage, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		value, err := json.Marshal(map[string][]TelemetryEvent{"events": group})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, brokerMessage{key: key, value: value, requestID: group[0].RequestID})
+	}
+	return out, nil
+}
+
+// brokerHeaders describes a message's body to consumers
+func brokerHeaders(batch bool) map[string]string {
+	h := map[string]string{
+		"content-type":            "application/json",
+		"langmesh-schema-version": strconv.Itoa(TelemetrySchemaVersion),
+	}
+	if batch {
+		h["langmesh-batch"] = "true"
+	}
+	return h
+}
+
+// KafkaAcks is how many replicas must acknowledge a write
+type KafkaAcks int
+
+const (
+	// KafkaAcksAll waits for every in-sync replica, the default
+	KafkaAcksAll KafkaAcks = iota
+	// KafkaAcksLeader waits for the partition leader only
+	KafkaAcksLeader
+	// KafkaAcksNone does not wait
+	KafkaAcksNone
+)
+
+// KafkaMessage is one record for KafkaProducer
+type KafkaMessage struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaProducer is the subset of a Kafka client KafkaSink needs, such as a
+// small adapter over a kafka-go Writer or a franz-go client. Produce should
+// write messages to topic with the given acks and return once they are
+// acknowledged.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, acks KafkaAcks, messages []KafkaMessage) error
+}
+
+// KafkaSink publishes telemetry to a Kafka topic, one JSON event per
+// record unless BatchEvents is set
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+	// PartitionKey sets each record's key; nil leaves records unkeyed
+	PartitionKey PartitionKey
+	// BatchEvents packs each key's events of a delivery into one record,
+	// as {"events": [...]}
+	BatchEvents bool
+	Acks        KafkaAcks
+}
+
+// Send produces events to the topic in one call
+func (s *KafkaSink) Send(ctx context.Context, events []TelemetryEvent) error {
+	messages, err := encodeBrokerMessages(events, s.PartitionKey, s.BatchEvents)
+	if err != nil || len(messages) == 0 {
+		return err
+	}
+	headers := brokerHeaders(s.BatchEvents)
+	records := make([]KafkaMessage, len(messages))
+	for i, m := range messages {
+		records[i] = KafkaMessage{Value: m.value, Headers: headers}
+		if m.key != "" {
+			records[i].Key = []byte(m.key)
+		}
+	}
+	if err := s.Producer.Produce(ctx, s.Topic, s.Acks, records); err != nil {
+		return fmt.Errorf("langmesh: kafka topic %s: %w", s.Topic, err)
+	}
+	return nil
+}
+
+// JetStreamPublisher is the subset of a NATS JetStream client NATSSink
+// needs. PublishMsg should publish to subject and, unless ctx is done
+// first, return once the stream acknowledges the message. The
+// "Nats-Msg-Id" header, the request ID and a hash of the message, lets the
+// stream drop duplicates of a retried delivery.
+type JetStreamPublisher interface {
+	PublishMsg(ctx context.Context, subject string, data []byte, headers map[string]string) error
+}
+
+// NATSSink publishes telemetry to a NATS JetStream subject, one JSON event
+// per message unless BatchEvents is set
+type NATSSink struct {
+	Publisher JetStreamPublisher
+	// Subject is published to as is, or with SubjectKey set, followed by
+	// ".<key>" so consumers can filter, e.g. "llm.telemetry.gpt-4o"
+	Subject    string
+	SubjectKey PartitionKey
+	// BatchEvents packs each key's events of a delivery into one message
+	BatchEvents bool
+	// AckTimeout bounds the wait for each message's ack; zero waits as long
+	// as the delivery's context
+	AckTimeout time.Duration
+}
+
+// Send publishes events, stopping at the first message not acknowledged
+func (s *NATSSink) Send(ctx context.Context, events []TelemetryEvent) error {
+	messages, err := encodeBrokerMessages(events, s.SubjectKey, s.BatchEvents)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		subject := s.Subject
+		if m.key != "" {
+			subject += "." + subjectToken(m.key)
+		}
+		headers := brokerHeaders(s.BatchEvents)
+		headers["Nats-Msg-Id"] = natsMsgID(m)
+		if err := s.publish(ctx, subject, m.value, headers); err != nil {
+			return fmt.Errorf("langmesh: nats subject %s: %w", subject, err)
+		}
+	}
+	return nil
+}
+
+// natsMsgID identifies a message by its request ID and a hash of its payload. A
+// retried delivery re-encodes the same payload, while heartbeats and calls
+// sharing a ContextWithRequestID ID differ, so JetStream only drops the former.
+func natsMsgID(m brokerMessage) string {
+	sum := sha256.Sum256(m.value)
+	return m.requestID + "-" + hex.EncodeToString(sum[:8])
+}
+
+func (s *NATSSink) publish(ctx context.Context, subject string, data []byte, headers map[string]string) error {
+	if s.AckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.AckTimeout)
+		defer cancel()
+	}
+	return s.Publisher.PublishMsg(ctx, subject, data, headers)
+}
+
+// subjectToken makes key a single NATS subject token, replacing the
+// separator, wildcards and whitespace
+func subjectToken(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, key)
+}
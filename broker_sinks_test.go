@@ -0,0 +1,122 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeProducer struct {
+	topic   string
+	acks    KafkaAcks
+	records []KafkaMessage
+}
+
+func (p *fakeProducer) Produce(_ context.Context, topic string, acks KafkaAcks, messages []KafkaMessage) error {
+	p.topic, p.acks = topic, acks
+	p.records = append(p.records, messages...)
+	return nil
+}
+
+type natsMessage struct {
+	subject string
+	data    []byte
+	headers map[string]string
+}
+
+type fakePublisher struct {
+	messages []natsMessage
+	err      error
+}
+
+func (p *fakePublisher) PublishMsg(ctx context.Context, subject string, data []byte, headers map[string]string) error {
+	if p.err != nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	p.messages = append(p.messages, natsMessage{subject, data, headers})
+	return nil
+}
+
+var brokerEvents = []TelemetryEvent{
+	{RequestID: "r1", Model: "gpt-4o", Tags: map[string]string{"tenant": "acme"}},
+	{RequestID: "r2", Model: "gpt-4o-mini", Tags: map[string]string{"tenant": "acme"}},
+	{RequestID: "r3", Model: "gpt-4o", Tags: map[string]string{"tenant": "globex"}},
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := &fakeProducer{}
+	sink := &KafkaSink{Producer: producer, Topic: "llm-telemetry", PartitionKey: PartitionByModel, Acks: KafkaAcksLeader}
+	if err := sink.Send(context.Background(), brokerEvents); err != nil {
+		t.Fatal(err)
+	}
+	if producer.topic != "llm-telemetry" || producer.acks != KafkaAcksLeader || len(producer.records) != 3 {
+		t.Fatalf("produced %+v", producer)
+	}
+	var event TelemetryEvent
+	if err := json.Unmarshal(producer.records[2].Value, &event); err != nil || event.RequestID != "r3" {
+		t.Errorf("record value = %s", producer.records[2].Value)
+	}
+	if string(producer.records[2].Key) != "gpt-4o" || producer.records[2].Headers["langmesh-schema-version"] != "2" {
+		t.Errorf("record = %+v", producer.records[2])
+	}
+
+	batched := &fakeProducer{}
+	sink = &KafkaSink{Producer: batched, Topic: "t", PartitionKey: PartitionByTag("tenant"), BatchEvents: true}
+	if err := sink.Send(context.Background(), brokerEvents); err != nil {
+		t.Fatal(err)
+	}
+	if len(batched.records) != 2 || string(batched.records[0].Key) != "acme" {
+		t.Fatalf("batched records = %+v", batched.records)
+	}
+	var batch map[string][]TelemetryEvent
+	if err := json.Unmarshal(batched.records[0].Value, &batch); err != nil || len(batch["events"]) != 2 {
+		t.Errorf("batch = %s", batched.records[0].Value)
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	pub := &fakePublisher{}
+	sink := &NATSSink{Publisher: pub, Subject: "llm.telemetry", SubjectKey: PartitionByModel}
+	if err := sink.Send(context.Background(), brokerEvents); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.messages) != 3 {
+		t.Fatalf("published %d messages", len(pub.messages))
+	}
+	if m := pub.messages[1]; m.subject != "llm.telemetry.gpt-4o-mini" || !strings.HasPrefix(m.headers["Nats-Msg-Id"], "r2-") {
+		t.Errorf("message = %+v", m)
+	}
+
+	// A heartbeat shares its final event's request ID but not its message
+	// ID; a retried delivery repeats it
+	pub = &fakePublisher{}
+	sink = &NATSSink{Publisher: pub, Subject: "llm.telemetry"}
+	stream := []TelemetryEvent{
+		{RequestID: "r9", Heartbeat: true, Status: "in_progress"},
+		{RequestID: "r9", Status: "success"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.Background(), stream); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := make([]string, len(pub.messages))
+	for i, m := range pub.messages {
+		ids[i] = m.headers["Nats-Msg-Id"]
+	}
+	if ids[0] == ids[1] || ids[0] != ids[2] || ids[1] != ids[3] {
+		t.Errorf("message IDs = %v", ids)
+	}
+	if got := subjectToken("ft:gpt-4o.v2 *"); got != "ft:gpt-4o_v2__" {
+		t.Errorf("subjectToken = %q", got)
+	}
+
+	stuck := &NATSSink{Publisher: &fakePublisher{err: errors.New("no ack")}, Subject: "s", AckTimeout: time.Millisecond}
+	if err := stuck.Send(context.Background(), brokerEvents); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unacknowledged publish: err = %v", err)
+	}
+}
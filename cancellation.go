@@ -0,0 +1,28 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+)
+
+// isCancelled reports whether err is the caller cancelling the call's
+// context, as opposed to a deadline passing
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// finishOnCancel records the stream's event as soon as its context ends,
+// so a caller that cancels and walks away without reading to the end or
+// closing the stream still leaves a record, with the tokens received so
+// far
+func (s *ChatCompletionStream) finishOnCancel() {
+	s.release = context.AfterFunc(s.ctx, func() { s.finishWith(s.ctx.Err()) })
+}
+
+// abort cancels the stream on behalf of a client that went away, recording
+// it as cancelled
+func (s *ChatCompletionStream) abort() {
+	s.cancel()
+	s.finishWith(context.Canceled)
+	s.Close()
+}
@@ -0,0 +1,86 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCancelledStreamRecordsPartialEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"Hello", " there"} {
+			fmt.Fprintf(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", piece)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.CreateChatCompletionStream(ctx, chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The caller gives up without reading on or closing the stream
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.all()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no event for the cancelled stream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stream.Close()
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("events = %+v", events)
+	}
+	event := events[0]
+	if event.Status != "cancelled" || event.ErrorClass != "Cancelled" || !event.Stream {
+		t.Errorf("event = %+v", event)
+	}
+	if event.TokenUsage.CompletionTokens == 0 || event.CostEstimateUSD == 0 {
+		t.Errorf("partial usage = %+v, cost %v", event.TokenUsage, event.CostEstimateUSD)
+	}
+	if got := client.Stats().CancelledCalls; got != 1 {
+		t.Errorf("CancelledCalls = %d", got)
+	}
+}
+
+func TestCancelledCompletion(t *testing.T) {
+	srv, _ := newChatServer(t, "ok")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if events := rec.all(); len(events) != 1 || events[0].Status != "cancelled" {
+		t.Errorf("events = %+v", events)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	client.CreateChatCompletion(ctx, chatRequest("hi"))
+	if events := rec.all(); len(events) != 2 || events[1].Status != "error" || events[1].ErrorClass != "Timeout" {
+		t.Errorf("timed out event = %+v", events[len(events)-1])
+	}
+	if got := client.Stats().CancelledCalls; got != 1 {
+		t.Errorf("CancelledCalls = %d", got)
+	}
+}
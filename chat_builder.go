@@ -0,0 +1,247 @@
+package langmesh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// toolNamePattern is what OpenAI accepts as a tool or participant name
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ChatBuilder assembles a chat request one message at a time, with a
+// method per role so messages cannot be given the wrong one:
+//
+//	request, err := openai.NewChat().
+//		Model("gpt-4o").
+//		System("You are a travel agent.").
+//		User("What does Paris look like?").
+//		UserImage("https://example.com/paris.jpg").
+//		Tool("search", schema).
+//		Build()
+//
+// Tool results are matched to the assistant's tool calls, so their
+// tool_call_id and name are filled in. The first mistake is kept and
+// returned by Build.
+type ChatBuilder struct {
+	request openai.ChatCompletionRequest
+	// pending are the last assistant message's tool calls not yet
+	// answered, by position
+	pending []openai.ToolCall
+	calls   int
+	err     error
+}
+
+// NewChat starts a chat request
+func NewChat() *ChatBuilder {
+	return &ChatBuilder{}
+}
+
+// Model sets the model the request is for
+func (b *ChatBuilder) Model(model string) *ChatBuilder {
+	b.request.Model = model
+	return b
+}
+
+func (b *ChatBuilder) fail(format string, args ...any) *ChatBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("langmesh: chat builder: "+format, args...)
+	}
+	return b
+}
+
+func (b *ChatBuilder) add(msg openai.ChatCompletionMessage) *ChatBuilder {
+	if len(b.pending) > 0 {
+		return b.fail("%s message before the results of tool call %q", msg.Role, b.pending[0].ID)
+	}
+	b.request.Messages = append(b.request.Messages, msg)
+	return b
+}
+
+// System adds a system message
+func (b *ChatBuilder) System(content string) *ChatBuilder {
+	return b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: content})
+}
+
+// User adds a user message
+func (b *ChatBuilder) User(content string) *ChatBuilder {
+	return b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content})
+}
+
+// UserNamed adds a user message from the participant name, to tell users
+// in a shared conversation apart
+func (b *ChatBuilder) UserNamed(name, content string) *ChatBuilder {
+	if !toolNamePattern.MatchString(name) {
+		return b.fail("invalid participant name %q", name)
+	}
+	return b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Name: name, Content: content})
+}
+
+// UserImage attaches the image at url, or a data URL, to the user message
+// just added, or adds a user message holding only the image
+func (b *ChatBuilder) UserImage(url string) *ChatBuilder {
+	if url == "" {
+		return b.fail("empty image URL")
+	}
+	image := openai.ChatMessagePart{
+		Type:     openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{URL: url},
+	}
+	msgs := b.request.Messages
+	if n := len(msgs); n > 0 && msgs[n-1].Role == openai.ChatMessageRoleUser && len(b.pending) == 0 {
+		last := &msgs[n-1]
+		if last.Content != "" {
+			last.MultiContent = []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: last.Content}}
+			last.Content = ""
+		}
+		last.MultiContent = append(last.MultiContent, image)
+		return b
+	}
+	return b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{image}})
+}
+
+// Assistant adds an assistant answer, such as a few-shot example
+func (b *ChatBuilder) Assistant(content string) *ChatBuilder {
+	return b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content})
+}
+
+// AssistantToolCall adds an assistant message calling the tool name with
+// arguments, marshaled to JSON unless already a string, or adds the call
+// to the assistant message just added by AssistantToolCall. Call IDs are
+// generated; ToolResult answers the calls in order.
+func (b *ChatBuilder) AssistantToolCall(name string, arguments any) *ChatBuilder {
+	if !toolNamePattern.MatchString(name) {
+		return b.fail("invalid tool name %q", name)
+	}
+	args, ok := arguments.(string)
+	if !ok {
+		data, err := json.Marshal(arguments)
+		if err != nil {
+			return b.fail("tool call %q arguments: %v", name, err)
+		}
+		args = string(data)
+	}
+	b.calls++
+	call := openai.ToolCall{
+		ID:       "call_" + strconv.Itoa(b.calls),
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: args},
+	}
+	msgs := b.request.Messages
+	if n := len(msgs); n > 0 && len(b.pending) > 0 && len(b.pending) == len(msgs[n-1].ToolCalls) {
+		msgs[n-1].ToolCalls = append(msgs[n-1].ToolCalls, call)
+		b.pending = append(b.pending, call)
+		return b
+	}
+	b.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{call}})
+	if b.err == nil {
+		b.pending = []openai.ToolCall{call}
+	}
+	return b
+}
+
+// ToolResult answers the oldest unanswered tool call, which must be to the
+// tool name, with output
+func (b *ChatBuilder) ToolResult(name, output string) *ChatBuilder {
+	if len(b.pending) == 0 {
+		return b.fail("result from tool %q with no tool call to answer", name)
+	}
+	call := b.pending[0]
+	if call.Function.Name != name {
+		return b.fail("result from tool %q for tool call %q to %q", name, call.ID, call.Function.Name)
+	}
+	b.pending = b.pending[1:]
+	b.request.Messages = append(b.request.Messages, openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Name:       name,
+		Content:    output,
+		ToolCallID: call.ID,
+	})
+	return b
+}
+
+// Tool offers the model the function name, with parameters described by
+// schema: a JSON schema as a jsonschema.Definition, map, json.RawMessage
+// or anything else that marshals to one
+func (b *ChatBuilder) Tool(name string, schema any) *ChatBuilder {
+	return b.ToolDescribed(name, "", schema)
+}
+
+// ToolDescribed is Tool with a description telling the model when to use
+// the tool
+func (b *ChatBuilder) ToolDescribed(name, description string, schema any) *ChatBuilder {
+	if !toolNamePattern.MatchString(name) {
+		return b.fail("invalid tool name %q", name)
+	}
+	for _, tool := range b.request.Tools {
+		if tool.Function != nil && tool.Function.Name == name {
+			return b.fail("tool %q added twice", name)
+		}
+	}
+	b.request.Tools = append(b.request.Tools, openai.Tool{
+		Type:     openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{Name: name, Description: description, Parameters: schema},
+	})
+	return b
+}
+
+// Tools offers the model tools built with NewTool
+func (b *ChatBuilder) Tools(tools ...Tool) *ChatBuilder {
+	for _, tool := range tools {
+		fn := tool.Definition.Function
+		b.ToolDescribed(fn.Name, fn.Description, fn.Parameters)
+	}
+	return b
+}
+
+// Temperature sets the sampling temperature
+func (b *ChatBuilder) Temperature(t float32) *ChatBuilder {
+	b.request.Temperature = t
+	return b
+}
+
+// MaxTokens caps the completion's tokens
+func (b *ChatBuilder) MaxTokens(n int) *ChatBuilder {
+	b.request.MaxTokens = n
+	return b
+}
+
+// JSON asks for a JSON object answer
+func (b *ChatBuilder) JSON() *ChatBuilder {
+	b.request.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	return b
+}
+
+// Build returns the request, or the first mistake made building it. A
+// request needs a model and a message, and every tool call its result.
+func (b *ChatBuilder) Build() (openai.ChatCompletionRequest, error) {
+	switch {
+	case b.err != nil:
+		return openai.ChatCompletionRequest{}, b.err
+	case b.request.Model == "":
+		return openai.ChatCompletionRequest{}, errors.New("langmesh: chat builder: no model")
+	case len(b.request.Messages) == 0:
+		return openai.ChatCompletionRequest{}, errors.New("langmesh: chat builder: no messages")
+	case len(b.pending) > 0:
+		return openai.ChatCompletionRequest{}, fmt.Errorf("langmesh: chat builder: tool call %q has no result", b.pending[0].ID)
+	}
+	request := b.request
+	request.Messages = slices.Clone(request.Messages)
+	request.Tools = slices.Clone(request.Tools)
+	return request, nil
+}
+
+// MustBuild is like Build but panics on a mistake, for requests fixed in
+// code
+func (b *ChatBuilder) MustBuild() openai.ChatCompletionRequest {
+	request, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return request
+}
@@ -0,0 +1,74 @@
+package langmesh
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestChatBuilder(t *testing.T) {
+	schema := map[string]any{"type": "object", "properties": map[string]any{"q": map[string]any{"type": "string"}}}
+	request, err := NewChat().
+		Model("gpt-4o").
+		System("You are a travel agent.").
+		User("What does Paris look like?").
+		UserImage("https://example.com/paris.jpg").
+		Tool("search", schema).
+		AssistantToolCall("search", map[string]string{"q": "Paris"}).
+		AssistantToolCall("search", `{"q":"Louvre"}`).
+		ToolResult("search", "city of light").
+		ToolResult("search", "museum").
+		Temperature(0.5).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "gpt-4o" || request.Temperature != 0.5 || len(request.Tools) != 1 || request.Tools[0].Function.Name != "search" {
+		t.Errorf("request = %+v", request)
+	}
+	msgs := request.Messages
+	if len(msgs) != 5 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if user := msgs[1]; user.Content != "" || len(user.MultiContent) != 2 || user.MultiContent[0].Text != "What does Paris look like?" ||
+		user.MultiContent[1].ImageURL.URL != "https://example.com/paris.jpg" {
+		t.Errorf("user message = %+v", user)
+	}
+	calls := msgs[2].ToolCalls
+	if msgs[2].Role != openai.ChatMessageRoleAssistant || len(calls) != 2 || calls[0].Function.Arguments != `{"q":"Paris"}` {
+		t.Errorf("assistant message = %+v", msgs[2])
+	}
+	if msgs[3].ToolCallID != calls[0].ID || msgs[4].ToolCallID != calls[1].ID || msgs[4].Name != "search" || calls[0].ID == calls[1].ID {
+		t.Errorf("tool results = %+v, %+v", msgs[3], msgs[4])
+	}
+}
+
+func TestChatBuilderMistakes(t *testing.T) {
+	for name, b := range map[string]*ChatBuilder{
+		"no model":        NewChat().User("hi"),
+		"no messages":     NewChat().Model("gpt-4o"),
+		"unanswered call": NewChat().Model("gpt-4o").User("hi").AssistantToolCall("search", "{}"),
+		"message first":   NewChat().Model("gpt-4o").AssistantToolCall("search", "{}").User("hi").ToolResult("search", "x"),
+		"wrong tool":      NewChat().Model("gpt-4o").AssistantToolCall("search", "{}").ToolResult("fetch", "x"),
+		"stray result":    NewChat().Model("gpt-4o").User("hi").ToolResult("search", "x"),
+		"bad tool name":   NewChat().Model("gpt-4o").User("hi").Tool("web search", nil),
+		"duplicate tool":  NewChat().Model("gpt-4o").User("hi").Tool("search", nil).Tool("search", nil),
+	} {
+		_, err := b.Build()
+		if err == nil || !strings.HasPrefix(err.Error(), "langmesh: chat builder: ") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestChatBuilderTools(t *testing.T) {
+	type args struct {
+		City string `json:"city"`
+	}
+	tool := MustNewTool("weather", "Current weather", func(a args) (string, error) { return "sunny", nil })
+	request := NewChat().Model("gpt-4o").User("Weather in Paris?").Tools(tool).MustBuild()
+	if fn := request.Tools[0].Function; fn.Name != "weather" || fn.Description != "Current weather" || fn.Parameters == nil {
+		t.Errorf("tool = %+v", fn)
+	}
+}
@@ -13,13 +13,15 @@
 package langmesh
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,10 +29,11 @@ import (
 )
 
 var (
-	langmeshAPIKey          = os.Getenv("langmesh_API_KEY")
-	langmeshTelemetryURL    = getEnv("langmesh_TELEMETRY_ENDPOINT", "https://api.langmesh.ai/v1/telemetry")
-	langmeshProxyEnabled    = os.Getenv("langmesh_PROXY_ENABLED") == "true"
-	langmeshBaseURL         = getEnv("langmesh_BASE_URL", "https://api.langmesh.ai/v1/openai")
+	langmeshAPIKey       = os.Getenv("langmesh_API_KEY")
+	langmeshTelemetryURL = getEnv("langmesh_TELEMETRY_ENDPOINT", "https://api.langmesh.ai/v1/telemetry")
+	langmeshProxyEnabled = os.Getenv("langmesh_PROXY_ENABLED") == "true"
+	langmeshBaseURL      = getEnv("langmesh_BASE_URL", "https://api.langmesh.ai/v1/openai")
+	langmeshTokenURL     = getEnv("langmesh_TOKEN_ENDPOINT", "https://api.langmesh.ai/v1/auth/token")
 )
 
 func getEnv(key, defaultValue string) string {
@@ -43,40 +46,198 @@ func getEnv(key, defaultValue string) string {
 // Client is a langmesh-wrapped OpenAI client
 type Client struct {
 	*openai.Client
+	authToken        string
 	telemetryEnabled bool
-	telemetryBuffer  []TelemetryEvent
-	mu               sync.Mutex
-	httpClient       *http.Client
+	sinks            []*sinkPipeline
+	flushSchedule    FlushSchedule
+	flushWake        chan struct{}
+	flushStop        chan struct{}
+	telemetryStopped *atomic.Bool
+	sampling         *TelemetrySampling
+	telemetryFilter  func(TelemetryEvent) bool
+	sampledOut       *atomic.Int64
+	unrouted         *atomic.Int64
+	urlSinks         *urlSinks
+	strictScopes     bool
+	scopeViolations  *atomic.Int64
+
+	uninstrumentedMode  UninstrumentedMode
+	uninstrumentedCalls *atomic.Int64
+	cancelledCalls      *atomic.Int64
+	observers           []eventObserver
+	guards              []requestGuard
+	guardrails          []guardrailRule
+	guardrailRetries    *int
+	verdicts            *verdictCache
+	redactor            Redactor
+	redactRequests      bool
+	contentCapture      *ContentCaptureConfig
+	errorBudgets        *errorBudgetTracker
+	latency             *latencyTracker
+	costLedger          *costLedger
+	costFormat          costFormat
+	eventRetention      *EventRetention
+	endpointTimeouts    map[Endpoint]time.Duration
+
+	embeddingChunking *EmbeddingChunking
+	experiment        *Experiment
+	shadow            *shadowRunner
+	quality           *qualityScorer
+	coalescer         *coalescer
+	hedging           *hedger
+	audit             *auditChain
+	requestLog        *requestLog
+	proxyTokens       *proxyTokenSource
+	baseTransport     http.RoundTripper
+	requestPolicy     *RequestPolicy
+	systemPrompts     SystemPromptProvider
+	jobs              *jobRunner
+	journal           RequestJournal
+	tags              map[string]string
+	modelManifest     *manifestCache
+	pricing           map[string]TokenPricing
+	reloader          *configReloader
+	configVersion     string
+	debug             *debugCounters
+	validateRequests  bool
+	streamHeartbeat   time.Duration
+	fallbacks         map[string][]string
+	tokenizer         Tokenizer
+	contextManager    *ContextManager
+	compressor        *PromptCompressor
+
+	strict    bool
+	configErr error
+
+	logger    *slog.Logger
+	logLevels map[LogEvent]slog.Level
+
+	// telemetrySecurity encrypts and secures the HTTP sinks' deliveries
+	telemetrySecurity telemetrySecurity
+
+	rateLimits      *rateLimitTracker
+	throttleReserve float64
+	keyPool         *KeyPool
+
+	local          *LocalBackend
+	anthropicMatch func(model string) bool
+
+	organization string
+	project      string
+
+	baseURL           string
+	transportWrappers []func(http.RoundTripper) http.RoundTripper
+	// apiBase and httpClient are those of the underlying client, for
+	// requests go-openai cannot make, such as streaming uploads
+	apiBase    string
+	httpClient *http.Client
+
+	policies    []Policy
+	policyViews map[string]*Client
 }
 
 // NewClient creates a new langmesh-wrapped OpenAI client
-func NewClient(authToken string) *Client {
-	config := openai.DefaultConfig(authToken)
+func NewClient(authToken string, opts ...Option) *Client {
+	client := &Client{
+		authToken:           authToken,
+		sampledOut:          new(atomic.Int64),
+		scopeViolations:     new(atomic.Int64),
+		uninstrumentedCalls: new(atomic.Int64),
+		cancelledCalls:      new(atomic.Int64),
+		unrouted:            new(atomic.Int64),
+		debug:               &debugCounters{},
+		urlSinks:            &urlSinks{},
+		rateLimits:          &rateLimitTracker{now: time.Now},
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if langmeshAPIKey != "" {
+		hosted := newSinkPipeline("langmesh", NewHTTPSink(langmeshTelemetryURL, langmeshAPIKey))
+		client.sinks = append([]*sinkPipeline{hosted}, client.sinks...)
+	}
+	client.secureSinks()
+	client.telemetryEnabled = len(client.sinks) > 0
+	client.Client = client.newOpenAIClient()
+
+	if client.telemetryEnabled {
+		client.startTelemetry()
+	}
+	if client.strict {
+		client.configErr = errors.Join(client.checkConfig(), client.checkSinks())
+	}
+	client.buildPolicyViews()
+	client.loadConfigFile()
+	client.restoreHistory()
+	client.startJobs()
+
+	return client
+}
+
+// newOpenAIClient builds the underlying go-openai client from the current
+// base URL and transport settings
+func (c *Client) newOpenAIClient() *openai.Client {
+	config := openai.DefaultConfig(c.authToken)
+	if c.baseURL != "" {
+		config.BaseURL = c.baseURL
+	}
 
-	// If proxy is enabled, route through langmesh
-	if langmeshProxyEnabled && langmeshAPIKey != "" {
+	var transport http.RoundTripper = http.DefaultTransport
+	if c.baseTransport != nil {
+		transport = c.baseTransport
+	}
+
+	if c.local != nil && c.authToken == "" {
+		transport = noAuthTransport{base: transport}
+	}
+
+	// If proxy is enabled, route through langmesh. Local backends are never
+	// proxied.
+	if langmeshProxyEnabled && langmeshAPIKey != "" && c.local == nil {
 		config.BaseURL = langmeshBaseURL
-		config.HTTPClient = &http.Client{
-			Transport: &langmeshTransport{
-				base:      http.DefaultTransport,
-				langmeshKey:   langmeshAPIKey,
-				originalKey: authToken,
-			},
+		if c.proxyTokens != nil {
+			transport = &proxyTokenTransport{
+				base:        transport,
+				host:        hostOf(langmeshBaseURL),
+				langmeshKey: langmeshAPIKey,
+				tokens:      c.proxyTokens,
+			}
+		} else {
+			transport = &langmeshTransport{
+				base:        transport,
+				host:        hostOf(langmeshBaseURL),
+				langmeshKey: langmeshAPIKey,
+				originalKey: c.authToken,
+			}
 		}
 	}
 
-	client := &Client{
-		Client:           openai.NewClientWithConfig(config),
-		telemetryEnabled: langmeshAPIKey != "",
-		telemetryBuffer:  make([]TelemetryEvent, 0, 10),
-		httpClient:       &http.Client{Timeout: 5 * time.Second},
+	transport = organizationTransport{base: transport, host: hostOf(config.BaseURL), client: c}
+	if c.keyPool != nil {
+		transport = keyPoolTransport{base: transport, host: hostOf(config.BaseURL), pool: c.keyPool, client: c}
+	}
+	if c.audit != nil && c.audit.cfg.Store != nil {
+		transport = auditTransport{base: transport, chain: c.audit}
+	}
+	if c.requestLog != nil {
+		transport = requestLogTransport{base: transport, log: c.requestLog}
 	}
 
-	if client.telemetryEnabled {
-		client.startTelemetry()
+	for _, wrap := range c.transportWrappers {
+		transport = wrap(transport)
 	}
+	transport = coverageTransport{base: transport, client: c, mode: c.uninstrumentedMode, count: c.uninstrumentedCalls}
+	transport = rateLimitTransport{base: transport, client: c}
+	transport = scopeTransport{base: transport, strict: c.strictScopes, violations: c.scopeViolations}
+	transport = captureTransport{base: transport}
+	if c.debug != nil {
+		transport = inFlightTransport{base: transport, count: &c.debug.inFlight}
+	}
+	config.HTTPClient = &http.Client{Transport: transport}
+	c.apiBase = config.BaseURL
+	c.httpClient = config.HTTPClient
 
-	return client
+	return openai.NewClientWithConfig(config)
 }
 
 // CreateChatCompletion wraps the original method with telemetry
@@ -84,137 +245,380 @@ func (c *Client) CreateChatCompletion(
 	ctx context.Context,
 	request openai.ChatCompletionRequest,
 ) (openai.ChatCompletionResponse, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateChatCompletion(ctx, request)
+	}
+
 	startTime := time.Now()
-	requestID := fmt.Sprintf("req_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
+	requestID := requestIDFor(ctx)
 
-	resp, err := c.Client.CreateChatCompletion(ctx, request)
-	endTime := time.Now()
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointChat)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
 
-	if c.telemetryEnabled {
-		event := TelemetryEvent{
-			RequestID:      requestID,
-			TimestampStart: startTime.Format(time.RFC3339),
-			TimestampEnd:   endTime.Format(time.RFC3339),
-			Model:          request.Model,
-			Endpoint:       "chat.completions",
-			LatencyMs:      endTime.Sub(startTime).Milliseconds(),
-			Status:         "success",
-		}
+	original := request
+	ctx, request = c.assignExperiment(ctx, request)
+	request = c.applySystemPrompt(ctx, request)
+	request = c.applyRequestPolicy(ctx, request)
+	request = c.redactRequest(request)
+	request, compression := c.compressPrompt(ctx, request)
+	request, truncated := c.manageContext(ctx, request)
 
-		if err != nil {
-			event.Status = "error"
-			event.ErrorClass = "Error"
-			event.ErrorMessage = err.Error()
-		} else {
-			event.TokenUsage = TokenUsage{
-				PromptTokens:     resp.Usage.PromptTokens,
-				CompletionTokens: resp.Usage.CompletionTokens,
-				TotalTokens:      resp.Usage.TotalTokens,
+	var resp openai.ChatCompletionResponse
+	var violations []string
+	requested := request.Model
+	err := c.checkModel(request, false)
+	if err == nil {
+		err = c.checkGuards(ctx, request)
+	}
+	if err == nil {
+		violations, err = c.checkRequestGuardrails(ctx, request)
+	}
+	var journalKey string
+	if err == nil {
+		journalKey, err = c.beginJournal(ctx, original, false)
+	}
+	if err == nil {
+		resp, request, err = withFallback(ctx, c, request, false, c.coalesce(c.hedge(c.Client.CreateChatCompletion)))
+		err = upstreamError(ctx, err)
+		c.completeJournal(ctx, journalKey)
+	}
+	// A response rejected by a guardrail was still paid for
+	usage := resp.Usage
+	if err == nil {
+		resp, usage, violations, err = c.checkResponseGuardrails(ctx, request, resp, violations)
+	}
+
+	if c.instrumented(ctx) {
+		event := c.newEvent(ctx, requestID, "chat.completions", request.Model, startTime, err)
+		if request.Model != requested {
+			event.FallbackFrom = requested
+		}
+		event.TruncatedMessages = truncated
+		event.GuardrailViolations = violations
+		compression.apply(&event)
+		event.TokenUsage = TokenUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		}
+		event.CostEstimateUSD = c.estimateCost(request.Model, usage.PromptTokens, usage.CompletionTokens)
+		c.applyHedge(&event, request.Model, usage)
+		// A coalesced call was paid for by the call it shared
+		if event.CoalescedInto != "" {
+			event.TokenUsage, event.CostEstimateUSD = TokenUsage{}, 0
+		}
+		if err == nil {
+			if len(resp.Choices) > 0 {
+				event.FinishReason = string(resp.Choices[0].FinishReason)
 			}
-			event.CostEstimateUSD = estimateCost(request.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+			event.SystemFingerprint = resp.SystemFingerprint
+			c.captureContent(&event, request, resp)
 		}
 
-		c.recordTelemetry(event)
+		if err != nil || !c.scoreQuality(ctx, event, request, resp) {
+			c.recordTelemetry(event)
+		}
+		if err == nil {
+			c.shadowChat(ctx, request, resp, event)
+		}
 	}
 
 	return resp, err
 }
 
-func (c *Client) recordTelemetry(event TelemetryEvent) {
-	c.mu.Lock()
-	c.telemetryBuffer = append(c.telemetryBuffer, event)
-	shouldFlush := len(c.telemetryBuffer) >= 10
-	c.mu.Unlock()
-
-	if shouldFlush {
-		c.flushTelemetry()
+// newRequestID returns an ID of the form req_<unix millis>_<8 hex digits>,
+// built with a single allocation
+func newRequestID() string {
+	const digits = "0123456789abcdef"
+	id := uuid.New()
+	var buf [32]byte
+	b := append(buf[:0], "req_"...)
+	b = strconv.AppendInt(b, time.Now().UnixMilli(), 10)
+	b = append(b, '_')
+	for _, v := range id[:4] {
+		b = append(b, digits[v>>4], digits[v&0x0f])
 	}
+	return string(b)
 }
 
-func (c *Client) flushTelemetry() {
-	c.mu.Lock()
-	if len(c.telemetryBuffer) == 0 {
-		c.mu.Unlock()
-		return
-	}
-	batch := make([]TelemetryEvent, len(c.telemetryBuffer))
-	copy(batch, c.telemetryBuffer)
-	c.telemetryBuffer = c.telemetryBuffer[:0]
-	c.mu.Unlock()
+// instrumented reports whether a call made with ctx needs a telemetry
+// event built. A configured logger needs them to log each call's finish,
+// and a CaptureCallInfo context to report its cost.
+func (c *Client) instrumented(ctx context.Context) bool {
+	return c.telemetryEnabled || len(c.observers) > 0 || c.logger != nil || callInfoFrom(ctx) != nil
+}
 
-	go func() {
-		payload := map[string]interface{}{"events": batch}
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			return
+// newEvent builds the common part of a telemetry event for a call that
+// started at startTime and has just finished with err
+func (c *Client) newEvent(
+	ctx context.Context,
+	requestID, endpoint, model string,
+	startTime time.Time,
+	err error,
+) TelemetryEvent {
+	endTime := time.Now()
+	event := TelemetryEvent{
+		RequestID:      requestID,
+		TimestampStart: formatTimestamp(startTime),
+		TimestampEnd:   formatTimestamp(endTime),
+		Model:          model,
+		Endpoint:       endpoint,
+		LatencyMs:      endTime.Sub(startTime).Milliseconds(),
+		Status:         "success",
+		Provider:       c.providerFor(model),
+		ConfigVersion:  c.configVersion,
+	}
+	if err != nil {
+		event.Status = "error"
+		if isCancelled(err) {
+			event.Status = "cancelled"
 		}
+		event.ErrorClass = errorClass(err)
+		event.ErrorMessage = c.redact(err.Error())
+	}
+	applyRuntime(&event)
+	applyScope(ctx, &event)
+	c.applyTags(&event)
+	applyAttributes(ctx, &event)
+	applyToolLoop(ctx, &event)
+	applyPrompt(ctx, &event)
+	applyExperiment(ctx, &event)
+	applyRoute(ctx, &event)
+	applySession(ctx, &event)
+	applyTrace(ctx, &event)
+	applyPriority(ctx, &event)
+	c.applyProject(ctx, &event)
+	applyJSONRepair(ctx, &event)
+	annotateUpstream(&event, callStateFrom(ctx))
+	event.callInfo = callInfoFrom(ctx)
+	return event
+}
 
-		req, err := http.NewRequest("POST", langmeshTelemetryURL, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return
-		}
+func errorClass(err error) string {
+	var guardErr *GuardError
+	if errors.As(err, &guardErr) {
+		return "GuardRejected"
+	}
+	if errors.Is(err, ErrInvalidRequest) {
+		return "InvalidRequest"
+	}
+	if isTimeout(err) {
+		return "Timeout"
+	}
+	if isCancelled(err) {
+		return "Cancelled"
+	}
+	if kind, _, _, _ := classifyUpstream(err); kind != nil {
+		return errorClasses[kind]
+	}
+	return "Error"
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+langmeshAPIKey)
+// modelPricing is USD per million input and output tokens
+var modelPricing = map[string]map[string]float64{
+	"gpt-4o":        {"input": 2.5, "output": 10.0},
+	"gpt-4o-mini":   {"input": 0.15, "output": 0.6},
+	"gpt-4-turbo":   {"input": 10.0, "output": 30.0},
+	"gpt-4":         {"input": 30.0, "output": 60.0},
+	"gpt-3.5-turbo": {"input": 0.5, "output": 1.5},
 
-		_, _ = c.httpClient.Do(req)
-		// Silent drop - telemetry must never break user's app
-	}()
-}
+	"gpt-4o-realtime-preview": {"input": 5.0, "output": 20.0},
 
-func (c *Client) startTelemetry() {
-	ticker := time.NewTicker(5 * time.Second)
-	go func() {
-		for range ticker.C {
-			c.flushTelemetry()
-		}
-	}()
+	"claude-opus-4-20250514":     {"input": 15.0, "output": 75.0},
+	"claude-sonnet-4-20250514":   {"input": 3.0, "output": 15.0},
+	"claude-3-7-sonnet-20250219": {"input": 3.0, "output": 15.0},
+	"claude-3-7-sonnet-latest":   {"input": 3.0, "output": 15.0},
+	"claude-3-5-sonnet-20241022": {"input": 3.0, "output": 15.0},
+	"claude-3-5-sonnet-latest":   {"input": 3.0, "output": 15.0},
+	"claude-3-5-haiku-20241022":  {"input": 0.8, "output": 4.0},
+	"claude-3-5-haiku-latest":    {"input": 0.8, "output": 4.0},
+	"claude-3-opus-20240229":     {"input": 15.0, "output": 75.0},
+	"claude-3-haiku-20240307":    {"input": 0.25, "output": 1.25},
+
+	"text-embedding-3-small": {"input": 0.02, "output": 0},
+	"text-embedding-3-large": {"input": 0.13, "output": 0},
+	"text-embedding-ada-002": {"input": 0.1, "output": 0},
 }
 
 func estimateCost(model string, promptTokens, completionTokens int) float64 {
-	pricing := map[string]map[string]float64{
-		"gpt-4o":        {"input": 2.5, "output": 10.0},
-		"gpt-4o-mini":   {"input": 0.15, "output": 0.6},
-		"gpt-4-turbo":   {"input": 10.0, "output": 30.0},
-		"gpt-4":         {"input": 30.0, "output": 60.0},
-		"gpt-3.5-turbo": {"input": 0.5, "output": 1.5},
-	}
-
-	modelPricing, ok := pricing[model]
+	pricing, ok := modelPricing[model]
 	if !ok {
-		modelPricing = map[string]float64{"input": 0.01, "output": 0.01}
+		pricing = map[string]float64{"input": 0.01, "output": 0.01}
 	}
 
-	return (float64(promptTokens)/1_000_000)*modelPricing["input"] +
-		(float64(completionTokens)/1_000_000)*modelPricing["output"]
+	return (tokenCost(promptTokens, pricing["input"]) + tokenCost(completionTokens, pricing["output"])).Float64()
 }
 
-// langmeshTransport adds langmesh headers to requests
+// langmeshTransport adds langmesh headers to requests for the proxy at
+// host, keeping the keys from other providers' APIs
 type langmeshTransport struct {
 	base        http.RoundTripper
-	langmeshKey     string
+	host        string
+	langmeshKey string
 	originalKey string
 }
 
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
 func (t *langmeshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.host != "" && req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
 	req.Header.Set("X-langmesh-API-Key", t.langmeshKey)
-	req.Header.Set("X-langmesh-Original-API-Key", t.originalKey)
+	original := t.originalKey
+	if key, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && key != "" {
+		// A key pool's key rather than the client's
+		original = key
+	}
+	req.Header.Set("X-langmesh-Original-API-Key", original)
 	return t.base.RoundTrip(req)
 }
 
 // TelemetryEvent represents a telemetry event
 type TelemetryEvent struct {
-	RequestID       string      `json:"request_id"`
-	TimestampStart  string      `json:"timestamp_start"`
-	TimestampEnd    string      `json:"timestamp_end"`
-	Model           string      `json:"model"`
-	Endpoint        string      `json:"endpoint"`
-	LatencyMs       int64       `json:"latency_ms"`
-	TokenUsage      TokenUsage  `json:"token_usage"`
-	CostEstimateUSD float64     `json:"cost_estimate_usd"`
-	Status          string      `json:"status"`
-	ErrorClass      string      `json:"error_class,omitempty"`
-	ErrorMessage    string      `json:"error_message,omitempty"`
+	// SchemaVersion is the TelemetrySchemaVersion the event was built with
+	SchemaVersion int `json:"schema_version"`
+
+	RequestID       string     `json:"request_id"`
+	TimestampStart  string     `json:"timestamp_start"`
+	TimestampEnd    string     `json:"timestamp_end"`
+	Model           string     `json:"model"`
+	Endpoint        string     `json:"endpoint"`
+	LatencyMs       int64      `json:"latency_ms"`
+	TokenUsage      TokenUsage `json:"token_usage"`
+	CostEstimateUSD float64    `json:"cost_estimate_usd"`
+	Status          string     `json:"status"`
+	ErrorClass      string     `json:"error_class,omitempty"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	Prompt          string     `json:"prompt,omitempty"`
+	Completion      string     `json:"completion,omitempty"`
+	PromptHash      string     `json:"prompt_hash,omitempty"`
+	CompletionHash  string     `json:"completion_hash,omitempty"`
+	ChunkCount      int        `json:"chunk_count,omitempty"`
+	RunID           string     `json:"run_id,omitempty"`
+	JobID           string     `json:"job_id,omitempty"`
+	TrainedTokens   int        `json:"trained_tokens,omitempty"`
+	UploadBytes     int64      `json:"upload_bytes,omitempty"`
+	ResponseID      string     `json:"response_id,omitempty"`
+	ToolLoopID      string     `json:"tool_loop_id,omitempty"`
+	ToolIteration   int        `json:"tool_iteration,omitempty"`
+	PromptTemplate  string     `json:"prompt_template,omitempty"`
+	PromptVersion   string     `json:"prompt_version,omitempty"`
+	Experiment      string     `json:"experiment,omitempty"`
+	Variant         string     `json:"variant,omitempty"`
+	Heartbeat       bool       `json:"heartbeat,omitempty"`
+	FallbackFrom    string     `json:"fallback_from,omitempty"`
+
+	// TruncatedMessages counts messages the context manager removed
+	TruncatedMessages int `json:"truncated_messages,omitempty"`
+	// GuardrailViolations lists violations of guardrails set to annotate,
+	// as "name: violation"
+	GuardrailViolations []string `json:"guardrail_violations,omitempty"`
+
+	// PromptTokensOriginal and PromptTokensCompressed are the prompt's token
+	// counts before and after WithPromptCompression
+	PromptTokensOriginal   int `json:"prompt_tokens_original,omitempty"`
+	PromptTokensCompressed int `json:"prompt_tokens_compressed,omitempty"`
+	// APIKeyID identifies the KeyPool key that served the call, by hash
+	APIKeyID string `json:"api_key_id,omitempty"`
+	// JSONRepairAttempt numbers CreateJSONCompletion's requests to repair
+	// a reply that did not match the schema
+	JSONRepairAttempt int `json:"json_repair_attempt,omitempty"`
+	// Provider is the backend that served the call: "openai", "anthropic"
+	// or "local"
+	Provider string `json:"provider,omitempty"`
+	// CoalescedCount counts identical calls that shared this call's
+	// response; CoalescedInto names the call whose response this one shared
+	CoalescedCount int    `json:"coalesced_count,omitempty"`
+	CoalescedInto  string `json:"coalesced_into,omitempty"`
+	// Project is the OpenAI project the call was billed to, from
+	// WithProject or ContextWithProject
+	Project string `json:"project,omitempty"`
+	// Priority is the call's ContextWithPriority priority, and QueueWaitMs how
+	// long adaptive throttling held it
+	Priority    Priority `json:"priority,omitempty"`
+	QueueWaitMs int64    `json:"queue_wait_ms,omitempty"`
+	// PolicyRewrites lists what WithRequestPolicy changed in the request,
+	// such as RewriteMaxTokens
+	PolicyRewrites []string `json:"policy_rewrites,omitempty"`
+	// Hedge describes the duplicate WithHedging sent for a slow call
+	Hedge *HedgeInfo `json:"hedge,omitempty"`
+	// ConfigVersion is the version of the WithConfigFile configuration
+	// the call was made under
+	ConfigVersion string `json:"config_version,omitempty"`
+	// SystemPromptVersion is the version of the system prompt
+	// WithSystemPromptProvider put in the request
+	SystemPromptVersion string `json:"system_prompt_version,omitempty"`
+
+	User      string            `json:"user,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+
+	// TraceID and ParentSpanID are the W3C trace context of the request
+	// the call was made for, from Middleware or ContextWithTraceParent
+	TraceID      string `json:"trace_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+
+	AudioInputSeconds  float64 `json:"audio_input_seconds,omitempty"`
+	AudioOutputSeconds float64 `json:"audio_output_seconds,omitempty"`
+	Reconnects         int     `json:"reconnects,omitempty"`
+
+	UpstreamProcessingMs int64 `json:"upstream_processing_ms,omitempty"`
+	// UpstreamOverheadMs is the latency the server's processing time does
+	// not account for: network, TLS and any queueing, together
+	UpstreamOverheadMs int64  `json:"upstream_overhead_ms,omitempty"`
+	UpstreamRegion     string `json:"upstream_region,omitempty"`
+	ServiceTier        string `json:"service_tier,omitempty"`
+	UpstreamRequestID  string `json:"upstream_request_id,omitempty"`
+
+	RateLimit *RateLimitInfo `json:"rate_limit,omitempty"`
+
+	// FinishReason is why the first choice stopped, e.g. "stop" or "length"
+	FinishReason      string `json:"finish_reason,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	Stream            bool   `json:"stream,omitempty"`
+	// RetryCount counts the call's upstream requests after the first, such
+	// as fallbacks, key pool retries and guardrail retries
+	RetryCount int `json:"retry_count,omitempty"`
+	// CacheHit marks responses the langmesh proxy served from its cache
+	CacheHit bool `json:"cache_hit,omitempty"`
+	// Cost is CostEstimateUSD in Currency, as WithCurrency and
+	// WithCostRounding report it
+	Cost     float64 `json:"cost,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+
+	// Attributes are typed values set with ContextWithAttribute
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	SDKVersion string `json:"sdk_version,omitempty"`
+	GoVersion  string `json:"go_version,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	OS         string `json:"os,omitempty"`
+	Arch       string `json:"arch,omitempty"`
+
+	SampleRate float64 `json:"sample_rate,omitempty"`
+
+	// Quality is the WithQualityScoring judgement of the completion
+	Quality *QualityScore `json:"quality,omitempty"`
+	// Shadow marks a WithShadowMode request, comparing it with the primary
+	// request it replayed
+	Shadow *ShadowComparison `json:"shadow,omitempty"`
+
+	// route names the dedicated sink the event is bound for
+	route string
+	// sinkURL overrides the sinks with the endpoint at this URL
+	sinkURL string
+	// muted events reach local observers but no sink
+	muted bool
+	// callInfo is the CaptureCallInfo of the call's context, if any
+	callInfo *CallInfo
 }
 
 // TokenUsage represents token usage
@@ -1,6 +1,11 @@
 package langmesh
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -18,3 +23,42 @@ func TestClientWithoutlangmeshKey(t *testing.T) {
 		t.Fatal("Expected client to work without langmesh_API_KEY")
 	}
 }
+
+// eventRecorder captures telemetry events in tests
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []TelemetryEvent
+}
+
+func (r *eventRecorder) observe(event TelemetryEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) all() []TelemetryEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]TelemetryEvent, len(r.events))
+	copy(out, r.events)
+	return out
+}
+
+func withRecorder(r *eventRecorder) Option {
+	return func(c *Client) {
+		c.observers = append(c.observers, r)
+	}
+}
+
+// newChatServer serves a fixed chat completion and counts requests
+func newChatServer(t *testing.T, content string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
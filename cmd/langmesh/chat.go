@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// runChat sends a prompt from the arguments or stdin and prints the reply
+func runChat(ctx context.Context, args []string, std stdio) error {
+	fs := newFlagSet("chat", std)
+	var cf clientFlags
+	cf.register(fs)
+	model := fs.String("model", "gpt-4o-mini", "model to use")
+	system := fs.String("system", "", "system prompt")
+	temperature := fs.Float64("temperature", 0, "sampling temperature (0 uses the model's default)")
+	maxTokens := fs.Int("max-tokens", 0, "maximum completion tokens (0 for no limit)")
+	stream := fs.Bool("stream", false, "print the reply as it streams")
+	jsonOut := fs.Bool("json", false, "print the response as JSON, one line per chunk when streaming")
+	verbose := fs.Bool("v", false, "print tokens, cost and latency to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: langmesh chat [flags] [prompt]\n\nThe prompt is read from stdin if not given.")
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	prompt, err := readInput(fs.Args(), std.in)
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		fmt.Fprintln(std.err, "langmesh chat: no prompt")
+		return errUsage
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	request := openai.ChatCompletionRequest{
+		Model:       *model,
+		Temperature: float32(*temperature),
+		MaxTokens:   *maxTokens,
+	}
+	if *system != "" {
+		request.Messages = append(request.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: *system})
+	}
+	request.Messages = append(request.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt})
+
+	started := time.Now()
+	if *stream {
+		err = streamChat(ctx, client, request, *jsonOut, std.out)
+	} else {
+		err = completeChat(ctx, client, request, *jsonOut, std.out)
+	}
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		printSummary(std.err, client, time.Since(started))
+	}
+	return nil
+}
+
+func completeChat(ctx context.Context, client *langmesh.Client, request openai.ChatCompletionRequest, jsonOut bool, out io.Writer) error {
+	resp, err := client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return err
+	}
+	if jsonOut {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	if len(resp.Choices) == 0 {
+		return errors.New("langmesh: the response has no choices")
+	}
+	_, err = fmt.Fprintln(out, resp.Choices[0].Message.Content)
+	return err
+}
+
+func streamChat(ctx context.Context, client *langmesh.Client, request openai.ChatCompletionRequest, jsonOut bool, out io.Writer) error {
+	stream, err := client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	enc := json.NewEncoder(out)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if jsonOut {
+			if err := enc.Encode(chunk); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(chunk.Choices) > 0 {
+			fmt.Fprint(out, chunk.Choices[0].Delta.Content)
+		}
+	}
+	if !jsonOut {
+		fmt.Fprintln(out)
+	}
+	return nil
+}
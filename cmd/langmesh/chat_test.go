@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestChat(t *testing.T) {
+	u := newUpstream(t)
+	stdout, stderr, err := runCLI(t, "", "chat", "-base-url", u.URL, "-system", "Be brief", "-v", "Say", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != "Hello\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if !strings.Contains(stderr, "1 requests, 10 prompt + 2 completion tokens") {
+		t.Errorf("summary = %q", stderr)
+	}
+	var request openai.ChatCompletionRequest
+	if err := json.Unmarshal([]byte(<-u.lastBodies), &request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "gpt-4o-mini" || len(request.Messages) != 2 ||
+		request.Messages[0].Content != "Be brief" || request.Messages[1].Content != "Say hello" {
+		t.Errorf("request = %+v", request)
+	}
+}
+
+func TestChatStdinAndJSON(t *testing.T) {
+	u := newUpstream(t)
+	stdout, _, err := runCLI(t, "What is 2+2?\n", "chat", "-base-url", u.URL, "-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(stdout), &resp); err != nil || resp.Usage.TotalTokens != 12 {
+		t.Errorf("stdout = %s (%v)", stdout, err)
+	}
+	if body := <-u.lastBodies; !strings.Contains(body, `"content":"What is 2+2?"`) {
+		t.Errorf("request = %s, want the prompt from stdin", body)
+	}
+
+	if _, _, err := runCLI(t, "  \n", "chat", "-base-url", u.URL); !errors.Is(err, errUsage) {
+		t.Errorf("empty prompt: err = %v", err)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	u := newUpstream(t)
+	stdout, _, err := runCLI(t, "", "chat", "-base-url", u.URL, "-stream", "hi")
+	if err != nil || stdout != "Hello\n" {
+		t.Errorf("stdout = %q, err = %v", stdout, err)
+	}
+
+	stdout, _, err = runCLI(t, "", "chat", "-base-url", u.URL, "-stream", "-json", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"content":"He"`) {
+		t.Errorf("chunks = %q", lines)
+	}
+}
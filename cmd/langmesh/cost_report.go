@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+)
+
+// costGroup is one row of a cost report
+type costGroup struct {
+	Key string
+	langmesh.CostLine
+}
+
+// MarshalJSON writes the row with the usage export's snake_case names
+func (g costGroup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Key              string  `json:"key"`
+		Requests         int     `json:"requests"`
+		Errors           int     `json:"errors"`
+		PromptTokens     int     `json:"prompt_tokens"`
+		CompletionTokens int     `json:"completion_tokens"`
+		CostUSD          float64 `json:"cost_usd"`
+	}{g.Key, g.Requests, g.Errors, g.PromptTokens, g.CompletionTokens, g.CostUSD})
+}
+
+// runCostReport summarizes the usage rollups a UsageExporter wrote in CSV
+func runCostReport(_ context.Context, args []string, std stdio) error {
+	fs := newFlagSet("cost-report", std)
+	by := fs.String("by", "model", "group rows by model, endpoint, hour or day")
+	since := fs.Duration("since", 0, "only count periods that ended within this long ago (0 for all)")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: langmesh cost-report [flags] file-or-dir...\n\nDirectories are searched for *.csv usage exports.")
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	key, ok := groupKeys[*by]
+	if !ok {
+		fmt.Fprintf(std.err, "langmesh cost-report: cannot group by %q\n", *by)
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	records, err := readUsageFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+	lines := map[string]langmesh.CostLine{}
+	var total langmesh.CostLine
+	for _, rec := range records {
+		if rec.PeriodEnd.Before(cutoff) {
+			continue
+		}
+		k := key(rec)
+		lines[k] = addUsage(lines[k], rec)
+		total = addUsage(total, rec)
+	}
+	groups := make([]costGroup, 0, len(lines))
+	for k, line := range lines {
+		groups = append(groups, costGroup{Key: k, CostLine: line})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if *by == "hour" || *by == "day" {
+			return groups[i].Key < groups[j].Key
+		}
+		if groups[i].CostUSD != groups[j].CostUSD {
+			return groups[i].CostUSD > groups[j].CostUSD
+		}
+		return groups[i].Key < groups[j].Key
+	})
+
+	if *jsonOut {
+		enc := json.NewEncoder(std.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			By     string      `json:"by"`
+			Groups []costGroup `json:"groups"`
+			Total  costGroup   `json:"total"`
+		}{*by, groups, costGroup{Key: "total", CostLine: total}})
+	}
+	w := tabwriter.NewWriter(std.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tERRORS\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST USD\n", strings.ToUpper(*by))
+	for _, g := range append(groups, costGroup{Key: "total", CostLine: total}) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.4f\n", g.Key, g.Requests, g.Errors, g.PromptTokens, g.CompletionTokens, g.CostUSD)
+	}
+	return w.Flush()
+}
+
+var groupKeys = map[string]func(langmesh.UsageRecord) string{
+	"model":    func(rec langmesh.UsageRecord) string { return rec.Model },
+	"endpoint": func(rec langmesh.UsageRecord) string { return rec.Endpoint },
+	"hour":     func(rec langmesh.UsageRecord) string { return rec.PeriodStart.UTC().Format("2006-01-02T15:00Z") },
+	"day":      func(rec langmesh.UsageRecord) string { return rec.PeriodStart.UTC().Format("2006-01-02") },
+}
+
+func addUsage(line langmesh.CostLine, rec langmesh.UsageRecord) langmesh.CostLine {
+	line.Requests += rec.Requests
+	line.Errors += rec.Errors
+	line.PromptTokens += rec.PromptTokens
+	line.CompletionTokens += rec.CompletionTokens
+	line.CostUSD = (langmesh.MoneyFromFloat(line.CostUSD) + langmesh.MoneyFromFloat(rec.CostUSD)).Float64()
+	return line
+}
+
+// readUsageFiles reads the usage records in paths, searching directories
+// for *.csv files
+func readUsageFiles(paths []string) ([]langmesh.UsageRecord, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.csv"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	var records []langmesh.UsageRecord
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		recs, err := langmesh.ReadUsage(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, file)
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const usageHeader = "period_start,period_end,model,endpoint,requests,errors,prompt_tokens,completion_tokens,total_tokens,cost_usd\n"
+
+func writeUsage(t *testing.T, dir, name string, rows ...string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(usageHeader+strings.Join(rows, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostReport(t *testing.T) {
+	dir := t.TempDir()
+	writeUsage(t, dir, "langmesh-usage-20240501T10.csv",
+		"2024-05-01T10:00:00Z,2024-05-01T11:00:00Z,gpt-4o,chat.completions,3,1,30,15,45,0.003",
+		"2024-05-01T10:00:00Z,2024-05-01T11:00:00Z,gpt-4o-mini,chat.completions,10,0,100,50,150,0.0001")
+	writeUsage(t, dir, "langmesh-usage-20240502T09.csv",
+		"2024-05-02T09:00:00Z,2024-05-02T10:00:00Z,gpt-4o,chat.completions,2,0,20,10,30,0.002")
+
+	stdout, _, err := runCLI(t, "", "cost-report", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "MODEL") ||
+		strings.Join(strings.Fields(lines[1]), " ") != "gpt-4o 5 1 50 25 0.0050" ||
+		strings.Join(strings.Fields(lines[3]), " ") != "total 15 1 150 75 0.0051" {
+		t.Errorf("report =\n%s", stdout)
+	}
+
+	stdout, _, err = runCLI(t, "", "cost-report", "-by", "day", "-json", filepath.Join(dir, "langmesh-usage-20240502T09.csv"), filepath.Join(dir, "langmesh-usage-20240501T10.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Groups []struct {
+			Key      string  `json:"key"`
+			Requests int     `json:"requests"`
+			CostUSD  float64 `json:"cost_usd"`
+		} `json:"groups"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Key != "2024-05-01" || report.Groups[0].Requests != 13 || report.Groups[1].CostUSD != 0.002 {
+		t.Errorf("groups = %+v, want days in order", report.Groups)
+	}
+}
+
+func TestCostReportSince(t *testing.T) {
+	dir := t.TempDir()
+	recent := time.Now().UTC().Truncate(time.Hour)
+	writeUsage(t, dir, "usage.csv",
+		"2024-05-01T10:00:00Z,2024-05-01T11:00:00Z,gpt-4o,chat.completions,3,0,30,15,45,0.003",
+		recent.Add(-time.Hour).Format(time.RFC3339)+","+recent.Format(time.RFC3339)+",gpt-4o,chat.completions,1,0,10,5,15,0.001")
+
+	stdout, _, err := runCLI(t, "", "cost-report", "-since", "24h", "-by", "endpoint", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(strings.Fields(stdout), " "), "chat.completions 1 0 10 5 0.0010") {
+		t.Errorf("report =\n%s, want only the recent period", stdout)
+	}
+}
+
+func TestCostReportErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := runCLI(t, "", "cost-report"); !errors.Is(err, errUsage) {
+		t.Errorf("no files: err = %v", err)
+	}
+	if _, _, err := runCLI(t, "", "cost-report", "-by", "color", dir); !errors.Is(err, errUsage) {
+		t.Errorf("bad -by: err = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.csv"), []byte("a,b\n1,2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCLI(t, "", "cost-report", dir); err == nil || !strings.Contains(err.Error(), "other.csv") {
+		t.Errorf("not a usage file: err = %v", err)
+	}
+}
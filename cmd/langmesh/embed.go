@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// runEmbed prints an embedding for each argument, or for each line of
+// stdin if there are none
+func runEmbed(ctx context.Context, args []string, std stdio) error {
+	fs := newFlagSet("embed", std)
+	var cf clientFlags
+	cf.register(fs)
+	model := fs.String("model", string(openai.SmallEmbedding3), "embedding model to use")
+	dimensions := fs.Int("dimensions", 0, "embedding dimensions, for models that can shorten them (0 for the model's)")
+	jsonOut := fs.Bool("json", false, "print the whole response as JSON")
+	verbose := fs.Bool("v", false, "print tokens, cost and latency to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: langmesh embed [flags] [text...]\n\nEach argument is embedded, or each line of stdin if there are none.\nEmbeddings are printed one JSON array per line, in input order.")
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		scanner := bufio.NewScanner(std.in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				inputs = append(inputs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	if len(inputs) == 0 {
+		fmt.Fprintln(std.err, "langmesh embed: no input")
+		return errUsage
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	started := time.Now()
+	resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Model:      openai.EmbeddingModel(*model),
+		Input:      inputs,
+		Dimensions: *dimensions,
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(std.out)
+	if *jsonOut {
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	} else {
+		vectors := make([][]float32, len(inputs))
+		for _, data := range resp.Data {
+			if data.Index >= 0 && data.Index < len(vectors) {
+				vectors[data.Index] = data.Embedding
+			}
+		}
+		for _, vector := range vectors {
+			if err := enc.Encode(vector); err != nil {
+				return err
+			}
+		}
+	}
+	if *verbose {
+		printSummary(std.err, client, time.Since(started))
+	}
+	return nil
+}
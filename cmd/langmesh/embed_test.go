@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestEmbed(t *testing.T) {
+	u := newUpstream(t)
+	stdout, _, err := runCLI(t, "first line\n\nsecond line\n", "embed", "-base-url", u.URL, "-dimensions", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Vectors are printed in input order, whatever order the API used
+	if stdout != "[0.5,0.5]\n[0.25,0.75]\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	var request openai.EmbeddingRequest
+	if err := json.Unmarshal([]byte(<-u.lastBodies), &request); err != nil {
+		t.Fatal(err)
+	}
+	if inputs, _ := request.Input.([]any); len(inputs) != 2 || inputs[1] != "second line" || request.Dimensions != 2 {
+		t.Errorf("request = %+v", request)
+	}
+
+	stdout, _, err = runCLI(t, "", "embed", "-base-url", u.URL, "-json", "a", "b")
+	if err != nil || !strings.Contains(stdout, `"prompt_tokens": 4`) {
+		t.Errorf("json: stdout = %s, err = %v", stdout, err)
+	}
+
+	if _, _, err := runCLI(t, "", "embed", "-base-url", u.URL); !errors.Is(err, errUsage) {
+		t.Errorf("no input: err = %v", err)
+	}
+}
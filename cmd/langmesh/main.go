@@ -0,0 +1,164 @@
+// Command langmesh tries out a langmesh configuration from the terminal:
+// chat completions, embeddings, cost reports from usage exports, and
+// replays of recorded fixtures. Every call goes through a langmesh client
+// built from the same config file an application would load, so budgets,
+// policies, fallbacks and telemetry apply as they would in production.
+//
+// Usage:
+//
+//	langmesh chat -config langmesh.yaml -v "Summarize RFC 2119"
+//	echo "hello" | langmesh embed -model text-embedding-3-small
+//	langmesh cost-report -by day usage/
+//	langmesh replay testdata/fixtures/3f2a9c1e0b7d4a66.json
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+)
+
+const usage = `Usage: langmesh <command> [flags] [args]
+
+Commands:
+  chat         send a prompt and print the reply
+  embed        print embeddings for text
+  cost-report  summarize usage export files
+  replay       re-send recorded fixtures and compare the responses
+
+Run "langmesh <command> -h" for a command's flags.
+`
+
+// errUsage marks a command line mistake that has already been reported
+var errUsage = errors.New("usage")
+
+// stdio is where a command reads input and writes output
+type stdio struct {
+	in       io.Reader
+	out, err io.Writer
+}
+
+type command func(ctx context.Context, args []string, std stdio) error
+
+var commands = map[string]command{
+	"chat":        runChat,
+	"embed":       runEmbed,
+	"cost-report": runCostReport,
+	"replay":      runReplay,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], stdio{in: os.Stdin, out: os.Stdout, err: os.Stderr})
+	stop()
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, std stdio) error {
+	if len(args) == 0 {
+		fmt.Fprint(std.err, usage)
+		return errUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(std.out, usage)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(std.err, "langmesh: unknown command %q\n\n%s", args[0], usage)
+		return errUsage
+	}
+	return cmd(ctx, args[1:], std)
+}
+
+// newFlagSet creates a command's flag set, reporting mistakes to std.err
+func newFlagSet(name string, std stdio) *flag.FlagSet {
+	fs := flag.NewFlagSet("langmesh "+name, flag.ContinueOnError)
+	fs.SetOutput(std.err)
+	return fs
+}
+
+// parse parses args, turning any mistake other than -h into errUsage
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// clientFlags are the flags of commands that make API calls
+type clientFlags struct {
+	config  string
+	apiKey  string
+	baseURL string
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", os.Getenv("LANGMESH_CONFIG"), "client config file, YAML or JSON (default $LANGMESH_CONFIG)")
+	fs.StringVar(&f.apiKey, "api-key", "", "OpenAI API key (default the config's api_key, then $OPENAI_API_KEY)")
+	fs.StringVar(&f.baseURL, "base-url", "", "API base URL, overriding the config's")
+}
+
+// client builds a client from the config file and flags. It retains cost
+// events for an hour so that commands can report what their calls cost.
+func (f *clientFlags) client(extra ...langmesh.Option) (*langmesh.Client, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	var opts []langmesh.Option
+	if f.config != "" {
+		cfg, err := langmesh.LoadConfig(f.config)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.APIKey != "" {
+			apiKey = cfg.APIKey
+		}
+		opts = cfg.Options()
+	}
+	if f.apiKey != "" {
+		apiKey = f.apiKey
+	}
+	if f.baseURL != "" {
+		opts = append(opts, langmesh.WithBaseURL(f.baseURL))
+	}
+	opts = append(opts, langmesh.WithCostRetention(time.Hour))
+	opts = append(opts, extra...)
+	return langmesh.NewClient(apiKey, opts...), nil
+}
+
+// printSummary reports the tokens and cost of the calls client has made
+func printSummary(w io.Writer, client *langmesh.Client, elapsed time.Duration) {
+	total := client.CostReport(time.Hour).Total
+	fmt.Fprintf(w, "%d requests, %d prompt + %d completion tokens, $%.6f, %s\n",
+		total.Requests, total.PromptTokens, total.CompletionTokens, total.CostUSD, elapsed.Round(time.Millisecond))
+}
+
+// readInput returns args joined by spaces, or all of stdin if there are none
+func readInput(args []string, in io.Reader) (string, error) {
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
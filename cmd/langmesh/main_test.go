@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// upstream is a fake OpenAI API answering chat completions, with content
+// "Hello" or reply if set, and embeddings
+type upstream struct {
+	*httptest.Server
+	calls      atomic.Int32
+	reply      atomic.Value
+	lastAuth   atomic.Value
+	lastBodies chan string
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{lastBodies: make(chan string, 16)}
+	u.reply.Store("Hello")
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.calls.Add(1)
+		u.lastAuth.Store(r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case u.lastBodies <- string(body):
+		default:
+		}
+		reply := u.reply.Load().(string)
+		switch {
+		case r.URL.Path == "/chat/completions" && strings.Contains(string(body), `"stream":true`):
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, part := range []string{reply[:len(reply)/2], reply[len(reply)/2:]} {
+				fmt.Fprintf(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", part)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		case r.URL.Path == "/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"c1","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`, reply)
+		case r.URL.Path == "/embeddings":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"object":"list","data":[{"object":"embedding","index":1,"embedding":[0.25,0.75]},{"object":"embedding","index":0,"embedding":[0.5,0.5]}],"usage":{"prompt_tokens":4,"total_tokens":4}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// runCLI runs the command line args with stdin, returning its output
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, stdio{in: strings.NewReader(stdin), out: &stdout, err: &stderr})
+	return stdout.String(), stderr.String(), err
+}
+
+func TestRunUsage(t *testing.T) {
+	if _, stderr, err := runCLI(t, ""); !errors.Is(err, errUsage) || !strings.Contains(stderr, "Commands:") {
+		t.Errorf("no command: err = %v, stderr = %q", err, stderr)
+	}
+	if _, stderr, err := runCLI(t, "", "frobnicate"); !errors.Is(err, errUsage) || !strings.Contains(stderr, `unknown command "frobnicate"`) {
+		t.Errorf("unknown command: err = %v, stderr = %q", err, stderr)
+	}
+	if _, _, err := runCLI(t, "", "chat", "-no-such-flag"); !errors.Is(err, errUsage) {
+		t.Errorf("bad flag: err = %v", err)
+	}
+	if stdout, _, err := runCLI(t, "", "help"); err != nil || !strings.Contains(stdout, "cost-report") {
+		t.Errorf("help: err = %v, stdout = %q", err, stdout)
+	}
+}
+
+func TestClientFlagsConfig(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	u := newUpstream(t)
+	config := filepath.Join(t.TempDir(), "langmesh.yaml")
+	if err := os.WriteFile(config, []byte("api_key: config-key\nbase_url: "+u.URL+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := runCLI(t, "", "chat", "-config", config, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if auth := u.lastAuth.Load(); auth != "Bearer config-key" {
+		t.Errorf("with a config: Authorization = %v, want the config's key", auth)
+	}
+	if _, _, err := runCLI(t, "", "chat", "-config", config, "-api-key", "flag-key", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if auth := u.lastAuth.Load(); auth != "Bearer flag-key" {
+		t.Errorf("with -api-key: Authorization = %v, want the flag's key", auth)
+	}
+	if _, _, err := runCLI(t, "", "chat", "-base-url", u.URL, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if auth := u.lastAuth.Load(); auth != "Bearer env-key" {
+		t.Errorf("without either: Authorization = %v, want $OPENAI_API_KEY", auth)
+	}
+
+	if _, _, err := runCLI(t, "", "chat", "-config", filepath.Join(t.TempDir(), "missing.yaml"), "hi"); err == nil {
+		t.Error("a missing config file was not reported")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// runReplay re-sends the requests of recorded fixtures through a client
+// built from the current config, and compares the responses with the
+// recorded ones
+func runReplay(ctx context.Context, args []string, std stdio) error {
+	fs := newFlagSet("replay", std)
+	var cf clientFlags
+	cf.register(fs)
+	offline := fs.Bool("offline", false, "answer from the fixtures' directories instead of the API, as WithReplay does")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: langmesh replay [flags] fixture.json...\n\nFixtures are the files WithRecording writes. Chat completion and embedding requests can be replayed.")
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		fixture, err := readFixture(path)
+		if err != nil {
+			return err
+		}
+		var opts []langmesh.Option
+		if *offline {
+			opts = append(opts, langmesh.WithReplay(filepath.Dir(path)))
+		}
+		client, err := cf.client(opts...)
+		if err != nil {
+			return err
+		}
+		replayed, err := replay(ctx, client, fixture)
+		client.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		recorded := describeRecorded(fixture)
+		fmt.Fprintf(std.out, "== %s: %s %s\n", path, fixture.Request.Method, fixture.Request.Path)
+		fmt.Fprintf(std.out, "recorded: %s\n", recorded)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(std.out, "replayed: error: %v\n", err)
+		case replayed == recorded:
+			fmt.Fprintf(std.out, "replayed: %s\nsame\n", replayed)
+		default:
+			fmt.Fprintf(std.out, "replayed: %s\nchanged\n", replayed)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("langmesh: %d of %d fixtures failed to replay", failed, fs.NArg())
+	}
+	return nil
+}
+
+func readFixture(path string) (langmesh.Fixture, error) {
+	var fixture langmesh.Fixture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, err
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return fixture, fmt.Errorf("langmesh: reading fixture %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// replay sends the fixture's request and describes the response
+func replay(ctx context.Context, client *langmesh.Client, fixture langmesh.Fixture) (string, error) {
+	switch {
+	case strings.HasSuffix(fixture.Request.Path, "/chat/completions"):
+		var request openai.ChatCompletionRequest
+		if err := json.Unmarshal(fixture.Request.Body, &request); err != nil {
+			return "", fmt.Errorf("langmesh: decoding the recorded request: %w", err)
+		}
+		if !request.Stream {
+			resp, err := client.CreateChatCompletion(ctx, request)
+			if err != nil {
+				return "", err
+			}
+			return describeChat(resp), nil
+		}
+		stream, err := client.CreateChatCompletionStream(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		defer stream.Close()
+		var chunks []openai.ChatCompletionStreamResponse
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return describeChunks(chunks), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			chunks = append(chunks, chunk)
+		}
+	case strings.HasSuffix(fixture.Request.Path, "/embeddings"):
+		var request openai.EmbeddingRequest
+		if err := json.Unmarshal(fixture.Request.Body, &request); err != nil {
+			return "", fmt.Errorf("langmesh: decoding the recorded request: %w", err)
+		}
+		resp, err := client.CreateEmbeddings(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		return describeEmbeddings(resp), nil
+	}
+	return "", fmt.Errorf("langmesh: cannot replay %s %s", fixture.Request.Method, fixture.Request.Path)
+}
+
+// describeRecorded describes the fixture's response as replay describes a
+// new one
+func describeRecorded(fixture langmesh.Fixture) string {
+	body := fixture.Response.Body
+	if fixture.Response.StatusCode >= 400 {
+		var errResp openai.ErrorResponse
+		if json.Unmarshal([]byte(body), &errResp) == nil && errResp.Error != nil {
+			return fmt.Sprintf("error: HTTP %d: %s", fixture.Response.StatusCode, errResp.Error.Message)
+		}
+		return fmt.Sprintf("error: HTTP %d", fixture.Response.StatusCode)
+	}
+	switch {
+	case strings.HasSuffix(fixture.Request.Path, "/embeddings"):
+		var resp openai.EmbeddingResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			return "unreadable response: " + err.Error()
+		}
+		return describeEmbeddings(resp)
+	case strings.HasPrefix(strings.TrimSpace(body), "{"):
+		var resp openai.ChatCompletionResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			return "unreadable response: " + err.Error()
+		}
+		return describeChat(resp)
+	}
+	var chunks []openai.ChatCompletionStreamResponse
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk openai.ChatCompletionStreamResponse
+		if json.Unmarshal([]byte(data), &chunk) == nil {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return describeChunks(chunks)
+}
+
+func describeChat(resp openai.ChatCompletionResponse) string {
+	if len(resp.Choices) == 0 {
+		return "no choices"
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) == 0 {
+		return msg.Content
+	}
+	calls := make([]string, len(msg.ToolCalls))
+	for i, call := range msg.ToolCalls {
+		calls[i] = call.Function.Name + "(" + call.Function.Arguments + ")"
+	}
+	return "tool calls: " + strings.Join(calls, ", ")
+}
+
+// describeChunks describes a stream by the message its chunks add up to
+func describeChunks(chunks []openai.ChatCompletionStreamResponse) string {
+	var content strings.Builder
+	var calls []openai.ToolCall
+	for _, chunk := range chunks {
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		content.WriteString(delta.Content)
+		for _, call := range delta.ToolCalls {
+			index := len(calls)
+			if call.Index != nil {
+				index = *call.Index
+			}
+			for len(calls) <= index {
+				calls = append(calls, openai.ToolCall{})
+			}
+			calls[index].Function.Name += call.Function.Name
+			calls[index].Function.Arguments += call.Function.Arguments
+		}
+	}
+	return describeChat(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+		Message: openai.ChatCompletionMessage{Content: content.String(), ToolCalls: calls},
+	}}})
+}
+
+func describeEmbeddings(resp openai.EmbeddingResponse) string {
+	dims := 0
+	if len(resp.Data) > 0 {
+		dims = len(resp.Data[0].Embedding)
+	}
+	return fmt.Sprintf("%d embeddings of %d dimensions", len(resp.Data), dims)
+}
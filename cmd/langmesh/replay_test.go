@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// record makes calls against u through a recording client and returns the
+// fixtures written
+func record(t *testing.T, u *upstream, calls func(*langmesh.Client) error) []string {
+	t.Helper()
+	dir := t.TempDir()
+	client := langmesh.NewClient("key", langmesh.WithBaseURL(u.URL), langmesh.WithRecording(dir))
+	defer client.Close()
+	if err := calls(client); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures recorded: %v", err)
+	}
+	return files
+}
+
+func TestReplay(t *testing.T) {
+	u := newUpstream(t)
+	ctx := context.Background()
+	request := openai.ChatCompletionRequest{Model: "gpt-4o-mini", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	chat := record(t, u, func(c *langmesh.Client) error {
+		_, err := c.CreateChatCompletion(ctx, request)
+		return err
+	})
+	stream := record(t, u, func(c *langmesh.Client) error {
+		s, err := c.CreateChatCompletionStream(ctx, request)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		for {
+			if _, err := s.Recv(); err != nil {
+				return nil
+			}
+		}
+	})
+	embeddings := record(t, u, func(c *langmesh.Client) error {
+		_, err := c.CreateEmbeddings(ctx, openai.EmbeddingRequest{Model: openai.SmallEmbedding3, Input: []string{"a", "b"}})
+		return err
+	})
+
+	stdout, _, err := runCLI(t, "", "replay", "-base-url", u.URL, chat[0], stream[0], embeddings[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(stdout, "\nsame\n") != 3 || !strings.Contains(stdout, "replayed: 2 embeddings of 2 dimensions") {
+		t.Errorf("unchanged upstream:\n%s", stdout)
+	}
+
+	u.reply.Store("Goodbye")
+	stdout, _, err = runCLI(t, "", "replay", "-base-url", u.URL, chat[0], stream[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(stdout, "\nchanged\n") != 2 || !strings.Contains(stdout, "recorded: Hello\nreplayed: Goodbye\n") {
+		t.Errorf("changed upstream:\n%s", stdout)
+	}
+}
+
+func TestReplayOffline(t *testing.T) {
+	u := newUpstream(t)
+	fixtures := record(t, u, func(c *langmesh.Client) error {
+		_, err := c.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o-mini", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}})
+		return err
+	})
+	calls := u.calls.Load()
+	stdout, _, err := runCLI(t, "", "replay", "-offline", "-base-url", u.URL, fixtures[0])
+	if err != nil || !strings.Contains(stdout, "replayed: Hello\nsame\n") {
+		t.Errorf("stdout = %s, err = %v", stdout, err)
+	}
+	if u.calls.Load() != calls {
+		t.Error("an offline replay called the API")
+	}
+}
+
+func TestReplayFailures(t *testing.T) {
+	u := newUpstream(t)
+	unsupported := filepath.Join(t.TempDir(), "moderation.json")
+	fixture := `{"request":{"method":"POST","path":"/moderations","body":{"input":"hi"}},"response":{"status_code":200,"body":"{}"}}`
+	if err := os.WriteFile(unsupported, []byte(fixture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := runCLI(t, "", "replay", "-base-url", u.URL, unsupported)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 fixtures failed") || !strings.Contains(stdout, "replayed: error: langmesh: cannot replay POST /moderations") {
+		t.Errorf("stdout = %s, err = %v", stdout, err)
+	}
+}
@@ -0,0 +1,123 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// WithRequestCoalescing makes concurrent identical chat requests share one
+// upstream call. While a deterministic request (temperature 0, one choice)
+// is in flight, byte-identical requests wait for its response instead of
+// sending their own. Every caller still runs its own guards and records its
+// own telemetry event: the call that went upstream counts the others in
+// CoalescedCount, and each of them names it in CoalescedInto and records no
+// tokens or cost.
+func WithRequestCoalescing() Option {
+	return func(c *Client) {
+		c.coalescer = &coalescer{calls: make(map[coalesceKey]*coalescedCall)}
+	}
+}
+
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[coalesceKey]*coalescedCall
+}
+
+// coalesceKey identifies identical requests to the same upstream client;
+// policy views with their own transport do not share calls
+type coalesceKey struct {
+	client *openai.Client
+	body   [sha256.Size]byte
+}
+
+type coalescedCall struct {
+	done      chan struct{}
+	requestID string
+	resp      openai.ChatCompletionResponse
+	err       error
+	// followers counts the calls waiting on this one
+	followers int
+}
+
+// coalescable reports whether request's response can be shared, i.e. is
+// meant to be deterministic
+func coalescable(request openai.ChatCompletionRequest) bool {
+	return request.Temperature == 0 && request.N <= 1 && !request.Stream
+}
+
+// coalesce wraps call so identical concurrent requests share one call
+func (c *Client) coalesce(
+	call func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error),
+) func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	g := c.coalescer
+	if g == nil {
+		return call
+	}
+	return func(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+		if !coalescable(request) {
+			return call(ctx, request)
+		}
+		body, err := json.Marshal(request)
+		if err != nil {
+			return call(ctx, request)
+		}
+		key := coalesceKey{client: c.Client, body: sha256.Sum256(body)}
+		state := callStateFrom(ctx)
+
+		g.mu.Lock()
+		if inflight, ok := g.calls[key]; ok {
+			inflight.followers++
+			g.mu.Unlock()
+			resp, shared, err := inflight.wait(ctx, state)
+			if !shared {
+				return call(ctx, request)
+			}
+			return resp, err
+		}
+		inflight := &coalescedCall{done: make(chan struct{}), requestID: state.id()}
+		g.calls[key] = inflight
+		g.mu.Unlock()
+
+		inflight.resp, inflight.err = call(ctx, request)
+		g.mu.Lock()
+		delete(g.calls, key)
+		followers := inflight.followers
+		g.mu.Unlock()
+		close(inflight.done)
+
+		if state != nil {
+			state.mu.Lock()
+			state.coalesced += followers
+			state.mu.Unlock()
+		}
+		return inflight.resp, inflight.err
+	}
+}
+
+// wait returns the in-flight call's result to a follower, or ctx's error
+// if ctx ends first. It reports false if the call was cut short by its own
+// context, so the follower must make its own.
+func (f *coalescedCall) wait(ctx context.Context, state *callState) (openai.ChatCompletionResponse, bool, error) {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return openai.ChatCompletionResponse{}, true, ctx.Err()
+	}
+	if errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded) {
+		return openai.ChatCompletionResponse{}, false, nil
+	}
+	if state != nil {
+		state.mu.Lock()
+		state.coalescedInto = f.requestID
+		state.mu.Unlock()
+	}
+	resp := f.resp
+	// Give each caller its own choices to modify
+	resp.Choices = append([]openai.ChatCompletionChoice(nil), resp.Choices...)
+	return resp, true, f.err
+}
@@ -0,0 +1,152 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingServer holds chat requests until release is closed
+func newBlockingServer(t *testing.T) (srv *httptest.Server, calls *int32, release chan struct{}) {
+	t.Helper()
+	calls = new(int32)
+	release = make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls, release
+}
+
+// waitForFollowers polls until n calls are waiting on an in-flight request
+func waitForFollowers(t *testing.T, g *coalescer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		g.mu.Lock()
+		waiting := 0
+		for _, call := range g.calls {
+			waiting += call.followers
+		}
+		g.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d followers waiting, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRequestCoalescingSharesResponse(t *testing.T) {
+	srv, calls, release := newBlockingServer(t)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec), WithRequestCoalescing())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.CreateChatCompletion(context.Background(), chatRequest("same"))
+			if err != nil || resp.Choices[0].Message.Content != "ok" {
+				t.Errorf("resp = %+v, err = %v", resp, err)
+			}
+		}()
+		if i == 0 {
+			for atomic.LoadInt32(calls) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	waitForFollowers(t, client.coalescer, 4)
+	close(release)
+	wg.Wait()
+
+	if atomic.LoadInt32(calls) != 1 {
+		t.Errorf("upstream calls = %d, want 1", *calls)
+	}
+	var leader TelemetryEvent
+	followers := 0
+	events := rec.all()
+	for _, e := range events {
+		if e.CoalescedCount > 0 {
+			leader = e
+		}
+	}
+	for _, e := range events {
+		if e.CoalescedInto != "" {
+			followers++
+			if e.CoalescedInto != leader.RequestID || e.CostEstimateUSD != 0 || e.TokenUsage.TotalTokens != 0 {
+				t.Errorf("follower = %+v", e)
+			}
+		}
+	}
+	if leader.CoalescedCount != 4 || leader.TokenUsage.TotalTokens != 12 || followers != 4 {
+		t.Errorf("leader = %+v, followers = %d", leader, followers)
+	}
+}
+
+func TestRequestCoalescingSkipsNondeterministic(t *testing.T) {
+	srv, calls, release := newBlockingServer(t)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithRequestCoalescing())
+	request := chatRequest("same")
+	request.Temperature = 0.7
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CreateChatCompletion(context.Background(), request); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for atomic.LoadInt32(calls) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestRequestCoalescingLeaderCancelled(t *testing.T) {
+	srv, calls, release := newBlockingServer(t)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithRequestCoalescing())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := client.CreateChatCompletion(ctx, chatRequest("same"))
+		leaderDone <- err
+	}()
+	for atomic.LoadInt32(calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	followerDone := make(chan error, 1)
+	go func() {
+		_, err := client.CreateChatCompletion(context.Background(), chatRequest("same"))
+		followerDone <- err
+	}()
+	waitForFollowers(t, client.coalescer, 1)
+	cancel()
+	if err := <-leaderDone; err == nil {
+		t.Fatal("leader succeeded after cancellation")
+	}
+	close(release)
+	if err := <-followerDone; err != nil {
+		t.Errorf("follower failed with the leader: %v", err)
+	}
+	if atomic.LoadInt32(calls) != 2 {
+		t.Errorf("upstream calls = %d, want 2", *calls)
+	}
+}
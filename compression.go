@@ -0,0 +1,164 @@
+package langmesh
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// PromptCompressor rewrites chat prompts to spend fewer tokens before they
+// are sent. Runs of whitespace are always collapsed; indentation inside
+// fenced code blocks is kept. Telemetry reports the prompt's token count
+// before and after.
+type PromptCompressor struct {
+	// MinTokens leaves prompts shorter than this unchanged
+	MinTokens int
+	// StripMarkdown removes formatting that means nothing to the model:
+	// heading markers, emphasis, horizontal rules, HTML comments and images
+	StripMarkdown bool
+	// SummarizeOver replaces the content of any message but the last that
+	// is longer than this many tokens with a summary written by
+	// SummaryModel; zero disables summarizing. A message is kept as it is
+	// if summarizing it fails.
+	SummarizeOver int
+	// SummaryModel defaults to DefaultSummaryModel
+	SummaryModel string
+}
+
+// WithPromptCompression compresses chat prompts as pc describes
+func WithPromptCompression(pc PromptCompressor) Option {
+	return func(c *Client) {
+		c.compressor = &pc
+	}
+}
+
+// compressionResult is the prompt's token count before and after
+// compression
+type compressionResult struct {
+	original   int
+	compressed int
+}
+
+func (r compressionResult) apply(event *TelemetryEvent) {
+	event.PromptTokensOriginal = r.original
+	event.PromptTokensCompressed = r.compressed
+}
+
+// compressPrompt applies the compressor to request, if one is configured
+func (c *Client) compressPrompt(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (openai.ChatCompletionRequest, compressionResult) {
+	pc := c.compressor
+	if pc == nil {
+		return request, compressionResult{}
+	}
+	original := c.countPromptTokens(request.Model, request.Messages)
+	if original < pc.MinTokens {
+		return request, compressionResult{original: original, compressed: original}
+	}
+
+	messages := make([]openai.ChatCompletionMessage, len(request.Messages))
+	for i, m := range request.Messages {
+		m.Content = pc.compressText(m.Content)
+		if len(m.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+			for j, part := range m.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					part.Text = pc.compressText(part.Text)
+				}
+				parts[j] = part
+			}
+			m.MultiContent = parts
+		}
+		if pc.SummarizeOver > 0 && i < len(request.Messages)-1 &&
+			c.countTokens(request.Model, m.Content) > pc.SummarizeOver {
+			m.Content = c.summarizeBlock(ctx, pc, m.Content)
+		}
+		messages[i] = m
+	}
+	request.Messages = messages
+	return request, compressionResult{
+		original:   original,
+		compressed: c.countPromptTokens(request.Model, messages),
+	}
+}
+
+func (c *Client) summarizeBlock(ctx context.Context, pc *PromptCompressor, text string) string {
+	model := pc.SummaryModel
+	if model == "" {
+		model = DefaultSummaryModel
+	}
+	summary, ok := c.summarizeText(ctx, model,
+		"Condense the following text as much as possible while keeping every fact, name, number and instruction in it.",
+		text)
+	if !ok || summary == "" {
+		return text
+	}
+	return summary
+}
+
+var (
+	markdownHeading  = regexp.MustCompile(`^#{1,6}\s+`)
+	markdownRule     = regexp.MustCompile(`^([-*_])(\s*([-*_]))*$`)
+	markdownImage    = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	markdownEmphasis = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	htmlComment      = regexp.MustCompile(`(?s)<!--.*?-->`)
+	whitespaceRun    = regexp.MustCompile(`[ \t]+`)
+)
+
+// compressText collapses whitespace and, if configured, strips markdown,
+// leaving fenced code blocks' layout alone
+func (pc *PromptCompressor) compressText(text string) string {
+	if text == "" {
+		return text
+	}
+	if pc.StripMarkdown {
+		text = htmlComment.ReplaceAllString(text, "")
+	}
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			out = append(out, strings.TrimSpace(line))
+			blank = false
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+
+		line = whitespaceRun.ReplaceAllString(strings.TrimSpace(line), " ")
+		if pc.StripMarkdown {
+			line = stripMarkdown(line)
+		}
+		if line == "" {
+			// Keep single blank lines, which separate paragraphs
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+func stripMarkdown(line string) string {
+	if len(line) >= 3 && markdownRule.MatchString(line) {
+		return ""
+	}
+	line = markdownHeading.ReplaceAllString(line, "")
+	line = markdownImage.ReplaceAllString(line, "")
+	line = markdownEmphasis.ReplaceAllString(line, "$2")
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,66 @@
+package langmesh
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCompressText(t *testing.T) {
+	pc := &PromptCompressor{StripMarkdown: true}
+	in := "## Overview  \n\n\n\nThis   is **very**\timportant.<!-- draft -->\n" +
+		"![badge](https://example.com/b.svg) Read on.\n---\n" +
+		"```python\ndef f():\n    return  1   \n```\n"
+	want := "Overview\n\nThis is very important.\nRead on.\n\n```python\ndef f():\n    return  1\n```"
+	if got := pc.compressText(in); got != want {
+		t.Errorf("compressText =\n%q\nwant\n%q", got, want)
+	}
+
+	plain := &PromptCompressor{}
+	if got := plain.compressText("# Keep  **this**"); got != "# Keep **this**" {
+		t.Errorf("markdown stripped without StripMarkdown: %q", got)
+	}
+}
+
+func TestPromptCompressionSummarizesLongBlocks(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence("condensed notes"))
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithPromptCompression(PromptCompressor{SummarizeOver: 50}),
+	)
+
+	block := strings.Repeat("background   detail ", 100)
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model: "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: block},
+			{Role: openai.ChatMessageRoleUser, Content: "so what?   " + block},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := requests()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want a summary and the chat", len(sent))
+	}
+	chat := sent[1].Messages
+	if chat[0].Content != "condensed notes" {
+		t.Errorf("long block not summarized: %q", chat[0].Content)
+	}
+	if !strings.HasPrefix(chat[1].Content, "so what? background detail") {
+		t.Errorf("last message should only be collapsed: %q", chat[1].Content[:40])
+	}
+
+	events := rec.all()
+	event := events[len(events)-1]
+	if event.Endpoint != "chat.completions" || event.PromptTokensOriginal <= event.PromptTokensCompressed ||
+		event.PromptTokensCompressed == 0 {
+		t.Errorf("event = %+v", event)
+	}
+}
@@ -0,0 +1,362 @@
+package langmesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is a declarative client setup, read with LoadConfig:
+//
+//	client := openai.NewClient(cfg.APIKey, cfg.Options()...)
+type Config struct {
+	// Version is stamped into telemetry as ConfigVersion by
+	// WithConfigFile; by default, a hash of the file
+	Version      string `json:"version"`
+	APIKey       string `json:"api_key"`
+	BaseURL      string `json:"base_url"`
+	Organization string `json:"organization"`
+	Project      string `json:"project"`
+	Strict       bool   `json:"strict"`
+
+	Providers ProvidersConfig `json:"providers"`
+	// Pricing overrides model prices, in USD per million tokens
+	Pricing map[string]TokenPricing `json:"pricing"`
+	Budget  *BudgetConfig           `json:"budget"`
+	// MaxRequestCostUSD rejects chat requests that could cost more
+	MaxRequestCostUSD float64 `json:"max_request_cost_usd"`
+	// RateLimits are per-user quotas, counted in memory
+	RateLimits []QuotaConfig    `json:"rate_limits"`
+	Telemetry  []SinkConfig     `json:"telemetry"`
+	Redaction  *RedactionConfig `json:"redaction"`
+	// Fallbacks maps a model to the models tried in turn when it fails
+	Fallbacks     map[string][]string `json:"fallbacks"`
+	RequestPolicy *RequestPolicy      `json:"request_policy"`
+	Sampling      *TelemetrySampling  `json:"sampling"`
+	Currency      *CurrencyConfig     `json:"currency"`
+}
+
+// ProvidersConfig configures the backends other than OpenAI
+type ProvidersConfig struct {
+	Anthropic *AnthropicProviderConfig `json:"anthropic"`
+	Local     *LocalProviderConfig     `json:"local"`
+}
+
+// AnthropicProviderConfig configures WithAnthropic
+type AnthropicProviderConfig struct {
+	APIKey  string `json:"api_key"`
+	BaseURL string `json:"base_url"`
+	Version string `json:"version"`
+	// Models are path.Match patterns of the models Anthropic serves; by
+	// default those named "claude-..."
+	Models    []string `json:"models"`
+	MaxTokens int      `json:"max_tokens"`
+}
+
+// LocalProviderConfig configures WithLocalBackend
+type LocalProviderConfig struct {
+	BaseURL string                  `json:"base_url"`
+	Pricing map[string]TokenPricing `json:"pricing"`
+}
+
+// BudgetConfig configures WithBudget
+type BudgetConfig struct {
+	LimitUSD float64        `json:"limit_usd"`
+	Window   ConfigDuration `json:"window"`
+}
+
+// CurrencyConfig configures WithCurrency and WithCostRounding
+type CurrencyConfig struct {
+	// Code is the currency costs are also reported in, such as "EUR"
+	Code string `json:"code"`
+	// Rates are fixed exchange rates, in units of each currency per US
+	// dollar, for StaticRates
+	Rates map[string]float64 `json:"rates"`
+	// Decimals rounds reported costs to this many places, if set
+	Decimals *int `json:"decimals"`
+	// Rounding is "half_even", the default, "half_up", "down" or "up"
+	Rounding RoundingMode `json:"rounding"`
+}
+
+// QuotaConfig is a Quota as written in a config file
+type QuotaConfig struct {
+	Requests int64          `json:"requests"`
+	Tokens   int64          `json:"tokens"`
+	Window   ConfigDuration `json:"window"`
+}
+
+// SinkConfig configures an HTTP telemetry sink
+type SinkConfig struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+}
+
+// RedactionConfig configures WithRedaction
+type RedactionConfig struct {
+	// Defaults applies DefaultRedactors before the rules
+	Defaults bool            `json:"defaults"`
+	Rules    []RedactionRule `json:"rules"`
+	// Requests also redacts outgoing chat messages
+	Requests bool `json:"requests"`
+}
+
+// RedactionRule replaces every match of Pattern, a regular expression,
+// with Replacement
+type RedactionRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// ConfigDuration is a duration written as a string such as "30s" or "1h"
+type ConfigDuration time.Duration
+
+func (d *ConfigDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h\": %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(parsed)
+	return nil
+}
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads a Config from a YAML or JSON file. ${VAR} in a key or
+// value is replaced by the environment variable VAR, and ${VAR:-default} by
+// default when VAR is unset or empty; a variable with neither is an error.
+// References are expanded after parsing, so they are ignored in comments
+// and a variable's value is never read as YAML or JSON.
+// Unknown keys are rejected, so typos do not go unnoticed.
+func LoadConfig(file string) (Config, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	cfg, err := ParseConfig(f)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w (%s)", err, file)
+	}
+	return cfg, nil
+}
+
+// ParseConfig reads a Config as LoadConfig does, in JSON if the document
+// starts with '{' and in YAML otherwise
+func ParseConfig(r io.Reader) (Config, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return Config{}, err
+	}
+	var tree any
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&tree); err != nil {
+			return Config{}, fmt.Errorf("langmesh: config: %w", err)
+		}
+	} else if tree, err = parseYAML(string(raw)); err != nil {
+		return Config{}, err
+	}
+	// Expanding parsed scalars, not the file text, keeps references in
+	// comments inert and stops a value from changing the document's shape
+	var missing []string
+	tree = expandTree(tree, &missing)
+	if len(missing) > 0 {
+		return Config{}, fmt.Errorf("langmesh: config: environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return Config{}, fmt.Errorf("langmesh: config: %w", err)
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return Config{}, fmt.Errorf("langmesh: config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (cfg Config) validate() error {
+	if cfg.Redaction != nil {
+		for _, rule := range cfg.Redaction.Rules {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("langmesh: config: redaction rule: %w", err)
+			}
+		}
+	}
+	for i, sink := range cfg.Telemetry {
+		if sink.URL == "" {
+			return fmt.Errorf("langmesh: config: telemetry sink %d has no url", i)
+		}
+	}
+	if cfg.Budget != nil && cfg.Budget.LimitUSD <= 0 {
+		return fmt.Errorf("langmesh: config: budget needs a positive limit_usd")
+	}
+	if cur := cfg.Currency; cur != nil && cur.Code != "" {
+		if _, err := StaticRates(cur.Rates)(0, cur.Code); err != nil {
+			return fmt.Errorf("langmesh: config: currency %s has no rate", cur.Code)
+		}
+	}
+	return nil
+}
+
+// Options returns the client options cfg describes
+func (cfg Config) Options() []Option {
+	return cfg.options(&configState{})
+}
+
+// configState is what the options of successive loads of a config share,
+// so budget spend and quota counts survive reloads
+type configState struct {
+	budget     *Budget
+	quotaStore QuotaStore
+}
+
+func (cfg Config) options(state *configState) []Option {
+	var opts []Option
+	if cfg.BaseURL != "" {
+		opts = append(opts, WithBaseURL(cfg.BaseURL))
+	}
+	if cfg.Organization != "" {
+		opts = append(opts, WithOrganization(cfg.Organization))
+	}
+	if cfg.Project != "" {
+		opts = append(opts, WithProject(cfg.Project))
+	}
+	if cfg.Strict {
+		opts = append(opts, WithStrictMode())
+	}
+	if a := cfg.Providers.Anthropic; a != nil {
+		anthropic := AnthropicConfig{APIKey: a.APIKey, BaseURL: a.BaseURL, Version: a.Version, MaxTokens: a.MaxTokens}
+		if patterns := a.Models; len(patterns) > 0 {
+			anthropic.Match = func(model string) bool { return matchModel(patterns, model) }
+		}
+		opts = append(opts, WithAnthropic(anthropic))
+	}
+	if l := cfg.Providers.Local; l != nil {
+		opts = append(opts, WithLocalBackend(LocalBackend{BaseURL: l.BaseURL, Pricing: l.Pricing}))
+	}
+	if len(cfg.Pricing) > 0 {
+		opts = append(opts, WithModelPricing(cfg.Pricing))
+	}
+	if b := cfg.Budget; b != nil {
+		if state.budget == nil {
+			state.budget = NewBudget(b.LimitUSD, time.Duration(b.Window))
+		} else {
+			state.budget.reconfigure(b.LimitUSD, time.Duration(b.Window))
+		}
+		opts = append(opts, WithBudget(state.budget))
+	}
+	if cfg.MaxRequestCostUSD > 0 {
+		opts = append(opts, WithMaxRequestCost(cfg.MaxRequestCostUSD))
+	}
+	if len(cfg.RateLimits) > 0 {
+		quotas := make([]Quota, len(cfg.RateLimits))
+		for i, q := range cfg.RateLimits {
+			quotas[i] = Quota{Requests: q.Requests, Tokens: q.Tokens, Window: time.Duration(q.Window)}
+		}
+		if state.quotaStore == nil {
+			state.quotaStore = NewMemoryQuotaStore()
+		}
+		opts = append(opts, WithQuotaManager(NewQuotaManager(state.quotaStore, quotas...)))
+	}
+	for i, sink := range cfg.Telemetry {
+		name := sink.Name
+		if name == "" {
+			name = "sink-" + strconv.Itoa(i)
+		}
+		opts = append(opts, WithTelemetrySink(name, NewHTTPSink(sink.URL, sink.APIKey)))
+	}
+	if r := cfg.Redaction; r != nil {
+		var chain RedactionChain
+		if r.Defaults {
+			chain = append(chain, DefaultRedactors()...)
+		}
+		for _, rule := range r.Rules {
+			chain = append(chain, RegexRedactor{Pattern: regexp.MustCompile(rule.Pattern), Replacement: rule.Replacement})
+		}
+		if len(chain) > 0 {
+			opts = append(opts, WithRedaction(chain...))
+		}
+		if r.Requests {
+			opts = append(opts, WithRequestRedaction())
+		}
+	}
+	for model, fallbacks := range cfg.Fallbacks {
+		opts = append(opts, WithModelFallback(model, fallbacks...))
+	}
+	if cfg.RequestPolicy != nil {
+		opts = append(opts, WithRequestPolicy(*cfg.RequestPolicy))
+	}
+	if cfg.Sampling != nil {
+		opts = append(opts, WithTelemetrySampling(*cfg.Sampling))
+	}
+	if cur := cfg.Currency; cur != nil {
+		if cur.Code != "" {
+			opts = append(opts, WithCurrency(cur.Code, StaticRates(cur.Rates)))
+		}
+		if cur.Decimals != nil {
+			opts = append(opts, WithCostRounding(*cur.Decimals, cur.Rounding))
+		}
+	}
+	return opts
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} and ${VAR:-default} references in text,
+// adding unset variables without a default to missing
+func expandEnv(text string, missing *[]string) string {
+	return envReference.ReplaceAllStringFunc(text, func(ref string) string {
+		m := envReference.FindStringSubmatch(ref)
+		if value := os.Getenv(m[1]); value != "" {
+			return value
+		}
+		if m[2] == "" {
+			*missing = append(*missing, m[1])
+		}
+		return m[3]
+	})
+}
+
+// expandTree expands environment references in the keys and string values
+// of a parsed document. Unquoted YAML scalars are typed after expansion, so
+// "max_request_cost_usd: ${MAX_COST}" reads a number.
+func expandTree(node any, missing *[]string) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[expandEnv(key, missing)] = expandTree(value, missing)
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = expandTree(v[i], missing)
+		}
+		return v
+	case string:
+		return expandEnv(v, missing)
+	case yamlPlain:
+		return plainScalar(expandEnv(string(v), missing))
+	}
+	return node
+}
@@ -0,0 +1,157 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// WithConfigFile applies the Config in file on top of the client's other
+// options, and lets it be reloaded at runtime with ReloadConfig or
+// WatchConfig. Each reload builds a fresh view of the client that calls
+// made from then on use; calls in flight finish under the configuration
+// they started with, and budget spend and quota counts carry over. A file
+// that fails to load leaves the last good configuration in effect, and
+// strict mode reports a failed first load. Telemetry sinks are fixed when
+// the client is created, so the file's telemetry section is not applied;
+// its api_key, if set, replaces the client's. Events carry the file's
+// version in ConfigVersion.
+func WithConfigFile(file string) Option {
+	return func(c *Client) {
+		c.reloader = &configReloader{file: file}
+	}
+}
+
+type configReloader struct {
+	file string
+
+	// mu serializes reloads
+	mu    sync.Mutex
+	state configState
+	// seen is the checksum of the contents last read, loaded or not
+	seen [sha256.Size]byte
+
+	view atomic.Pointer[Client]
+}
+
+// current returns the client view of the last good configuration
+func (r *configReloader) current() *Client {
+	if r == nil {
+		return nil
+	}
+	return r.view.Load()
+}
+
+// loadConfigFile makes the first load of a WithConfigFile configuration
+func (c *Client) loadConfigFile() {
+	if c.reloader == nil {
+		return
+	}
+	if err := c.ReloadConfig(); err != nil && c.strict {
+		c.configErr = errors.Join(c.configErr, misconfigured("%v", err))
+	}
+}
+
+// ReloadConfig loads the WithConfigFile configuration again
+func (c *Client) ReloadConfig() error {
+	r := c.reloader
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := os.ReadFile(r.file)
+	if err == nil {
+		r.seen = sha256.Sum256(data)
+		err = c.applyConfig(data)
+	}
+	if err != nil {
+		c.log(context.Background(), LogConfig, "config reload failed", "file", r.file, "error", err)
+		return err
+	}
+	c.log(context.Background(), LogConfig, "config reloaded", "file", r.file, "version", r.view.Load().configVersion)
+	return nil
+}
+
+// applyConfig builds and installs the client view for the config in data
+func (c *Client) applyConfig(data []byte) error {
+	r := c.reloader
+	cfg, err := ParseConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w (%s)", err, r.file)
+	}
+	version := cfg.Version
+	if version == "" {
+		version = hex.EncodeToString(r.seen[:6])
+	}
+	cfg.Telemetry = nil
+	opts := cfg.options(&r.state)
+	if cfg.APIKey != "" {
+		opts = append(opts, func(d *Client) { d.authToken = cfg.APIKey })
+	}
+
+	view := c.derive(opts)
+	view.configVersion = version
+	view.policies = c.policies
+	view.buildPolicyViews()
+	r.view.Store(view)
+	return nil
+}
+
+// WatchConfig reloads the WithConfigFile configuration on SIGHUP and, if
+// interval is positive, whenever the file's contents change, checked that
+// often, until ctx ends. Failed reloads are logged and keep the last good
+// configuration.
+func (c *Client) WatchConfig(ctx context.Context, interval time.Duration) {
+	r := c.reloader
+	if r == nil {
+		return
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	c.goroutine("config.watch", func() {
+		defer signal.Stop(hangup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				c.ReloadConfig()
+			case <-tick:
+				if r.changed() {
+					c.ReloadConfig()
+				}
+			}
+		}
+	})
+}
+
+// changed reports whether the file differs from the contents last read,
+// so a broken file is reported once rather than on every check
+func (r *configReloader) changed() bool {
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sha256.Sum256(data) != r.seen
+}
@@ -0,0 +1,109 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const reloadConfigYAML = `version: %s
+pricing:
+  gpt-4o-mini:
+    input: %d
+    output: %d
+budget:
+  limit_usd: 1
+  window: 1h
+`
+
+func writeConfig(t *testing.T, file, version string, input, output int) {
+	t.Helper()
+	doc := fmt.Sprintf(reloadConfigYAML, version, input, output)
+	if err := os.WriteFile(file, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	srv, _ := newChatServer(t, "ok")
+	file := filepath.Join(t.TempDir(), "langmesh.yaml")
+	writeConfig(t, file, "v1", 100, 200)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec), WithConfigFile(file))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, file, "v2", 1000, 2000)
+	if err := client.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	events := rec.all()
+	if len(events) != 2 || events[0].ConfigVersion != "v1" || events[1].ConfigVersion != "v2" {
+		t.Fatalf("events = %+v", events)
+	}
+	if math.Abs(events[0].CostEstimateUSD-0.002) > 1e-9 || math.Abs(events[1].CostEstimateUSD-0.02) > 1e-9 {
+		t.Errorf("costs = %v, %v", events[0].CostEstimateUSD, events[1].CostEstimateUSD)
+	}
+	if spent := client.reloader.state.budget.Spent(); math.Abs(spent-0.022) > 1e-9 {
+		t.Errorf("budget spent = %v, want spend kept across reloads", spent)
+	}
+
+	if err := os.WriteFile(file, []byte("api_kye: sk-test"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReloadConfig(); err == nil {
+		t.Error("expected a reload error")
+	}
+	if got := client.reloader.current().configVersion; got != "v2" {
+		t.Errorf("version after failed reload = %q", got)
+	}
+}
+
+func TestReloadConfigDefaultVersion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "langmesh.json")
+	if err := os.WriteFile(file, []byte(`{"fallbacks": {"gpt-4o": ["gpt-4o-mini"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("test-key", WithConfigFile(file))
+	view := client.policyView(context.Background())
+	if view == nil || len(view.configVersion) != 12 || view.fallbacks["gpt-4o"][0] != "gpt-4o-mini" {
+		t.Fatalf("view = %+v", view)
+	}
+	if len(client.fallbacks) != 0 {
+		t.Error("reload changed the base client")
+	}
+}
+
+func TestReloadConfigStrict(t *testing.T) {
+	client := NewClient("test-key", WithStrictMode(), WithConfigFile(filepath.Join(t.TempDir(), "missing.yaml")))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err == nil {
+		t.Error("expected a configuration error")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "langmesh.yaml")
+	writeConfig(t, file, "v1", 100, 200)
+	client := NewClient("test-key", WithConfigFile(file))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.WatchConfig(ctx, 5*time.Millisecond)
+
+	writeConfig(t, file, "v2", 100, 200)
+	deadline := time.Now().Add(2 * time.Second)
+	for client.reloader.current().configVersion != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("config change not picked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
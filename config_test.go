@@ -0,0 +1,169 @@
+package langmesh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigYAML = `# Platform defaults
+api_key: ${TEST_LANGMESH_OPENAI_KEY}
+base_url: ${TEST_LANGMESH_BASE_URL:-https://api.openai.com/v1}
+project: proj_search
+
+providers:
+  anthropic:
+    api_key: "sk-ant-test"
+    models: [claude-*]
+  local:
+    base_url: http://localhost:8000/v1
+    pricing:
+      llama3:
+        input: 0.1
+        output: 0.2
+
+budget:
+  limit_usd: 250
+  window: 24h
+max_request_cost_usd: 0.5
+rate_limits:
+  - requests: 60
+    window: 1m
+  - tokens: 100000
+    window: 1h
+
+telemetry:
+  - name: warehouse
+    url: https://collector.example.com/events
+    api_key: ${TEST_LANGMESH_SINK_KEY:-}
+
+redaction:
+  defaults: true
+  requests: false
+  rules:
+    - pattern: 'ACME-\d+'
+      replacement: "[ACCOUNT]"
+
+fallbacks:
+  gpt-4o:
+    - gpt-4o-mini
+    - gpt-3.5-turbo
+`
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("TEST_LANGMESH_OPENAI_KEY", "sk-from-env")
+	file := filepath.Join(t.TempDir(), "langmesh.yaml")
+	if err := os.WriteFile(file, []byte(testConfigYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey != "sk-from-env" || cfg.BaseURL != "https://api.openai.com/v1" || cfg.Project != "proj_search" {
+		t.Errorf("top level = %+v", cfg)
+	}
+	if a := cfg.Providers.Anthropic; a == nil || a.APIKey != "sk-ant-test" || a.Models[0] != "claude-*" {
+		t.Errorf("anthropic = %+v", a)
+	}
+	if l := cfg.Providers.Local; l == nil || l.Pricing["llama3"].Output != 0.2 {
+		t.Errorf("local = %+v", l)
+	}
+	if b := cfg.Budget; b == nil || b.LimitUSD != 250 || time.Duration(b.Window) != 24*time.Hour {
+		t.Errorf("budget = %+v", b)
+	}
+	if len(cfg.RateLimits) != 2 || cfg.RateLimits[0].Requests != 60 || time.Duration(cfg.RateLimits[1].Window) != time.Hour {
+		t.Errorf("rate limits = %+v", cfg.RateLimits)
+	}
+	if len(cfg.Telemetry) != 1 || cfg.Telemetry[0].Name != "warehouse" || cfg.Telemetry[0].APIKey != "" {
+		t.Errorf("telemetry = %+v", cfg.Telemetry)
+	}
+	if r := cfg.Redaction; r == nil || !r.Defaults || r.Rules[0].Pattern != `ACME-\d+` || r.Rules[0].Replacement != "[ACCOUNT]" {
+		t.Errorf("redaction = %+v", r)
+	}
+	if f := cfg.Fallbacks["gpt-4o"]; len(f) != 2 || f[1] != "gpt-3.5-turbo" {
+		t.Errorf("fallbacks = %v", cfg.Fallbacks)
+	}
+
+	client := NewClient(cfg.APIKey, cfg.Options()...)
+	if got := client.fallbacks["gpt-4o"]; len(got) != 2 {
+		t.Errorf("client fallbacks = %v", got)
+	}
+	if client.providerFor("claude-3-5-haiku-latest") != providerAnthropic || client.providerFor("llama3") != providerLocal {
+		t.Error("providers not configured")
+	}
+	if got := client.redact("account ACME-42, mail bob@example.com"); got != "account [ACCOUNT], mail [EMAIL]" {
+		t.Errorf("redact = %q", got)
+	}
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	t.Setenv("TEST_LANGMESH_MODEL", "gpt-4o")
+	cfg, err := ParseConfig(strings.NewReader(`{"fallbacks": {"${TEST_LANGMESH_MODEL}": ["gpt-4o-mini"]}, "budget": {"limit_usd": 5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Fallbacks["gpt-4o"][0] != "gpt-4o-mini" || cfg.Budget.LimitUSD != 5 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestParseConfigEnvInValuesOnly(t *testing.T) {
+	t.Setenv("TEST_LANGMESH_PROJECT", "proj_a\nstrict: true # x")
+	t.Setenv("TEST_LANGMESH_MAX_COST", "0.25")
+	cfg, err := ParseConfig(strings.NewReader(`# api_key: ${TEST_LANGMESH_UNSET_VARIABLE}
+project: ${TEST_LANGMESH_PROJECT}
+organization: "${TEST_LANGMESH_MAX_COST}"
+max_request_cost_usd: ${TEST_LANGMESH_MAX_COST}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Project != "proj_a\nstrict: true # x" || cfg.Strict {
+		t.Errorf("project = %q, strict = %v; want the value kept as one string", cfg.Project, cfg.Strict)
+	}
+	if cfg.Organization != "0.25" || cfg.MaxRequestCostUSD != 0.25 {
+		t.Errorf("organization = %q, max cost = %v", cfg.Organization, cfg.MaxRequestCostUSD)
+	}
+
+	t.Setenv("TEST_LANGMESH_PROJECT", `x", "strict": true, "y": "`)
+	cfg, err = ParseConfig(strings.NewReader(`{"project": "${TEST_LANGMESH_PROJECT}"}`))
+	if err != nil || cfg.Strict || cfg.Project != `x", "strict": true, "y": "` {
+		t.Errorf("cfg = %+v, %v; want the value kept as one string", cfg, err)
+	}
+}
+
+func TestParseConfigCurrency(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader("currency:\n  code: eur\n  rates:\n    EUR: 0.5\n  decimals: 2\n  rounding: up\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur := cfg.Currency; cur == nil || cur.Rates["EUR"] != 0.5 || cur.Decimals == nil || *cur.Decimals != 2 || cur.Rounding != RoundUp {
+		t.Fatalf("currency = %+v", cfg.Currency)
+	}
+	client := NewClient("test-key", cfg.Options()...)
+	if f := client.costFormat; f.currency != "EUR" || !f.rounded || f.decimals != 2 || f.rounding != RoundUp {
+		t.Errorf("cost format = %+v", f)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, doc := range []string{
+		"api_kye: sk-test",
+		"api_key: ${TEST_LANGMESH_UNSET_VARIABLE}",
+		"budget:\n  limit_usd: 5\n  window: 5",
+		"budget:\n  limit_usd: 0",
+		"redaction:\n  rules:\n    - pattern: '('",
+		"telemetry:\n  - name: nowhere",
+		"currency:\n  code: EUR",
+		"currency:\n  decimals: 2\n  rounding: sideways",
+		"base_url: a\n  project: b",
+		`{"api_key": 1}`,
+	} {
+		if _, err := ParseConfig(strings.NewReader(doc)); err == nil {
+			t.Errorf("%q: expected an error", doc)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package langmesh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultCaptureMaxLength = 2000
+
+// ContentCaptureConfig controls how prompt and completion text is included
+// in telemetry when content capture is enabled
+type ContentCaptureConfig struct {
+	// MaxLength truncates captured text to this many bytes (default 2000)
+	MaxLength int
+	// SampleRate is the fraction of requests whose content is captured, in
+	// (0, 1]. Zero captures every request.
+	SampleRate float64
+	// HashOnly sends SHA-256 digests of the full text instead of the text itself
+	HashOnly bool
+}
+
+// WithContentCapture opts in to including prompt and completion text in
+// telemetry. Captured text passes through the redaction pipeline configured
+// with WithRedaction before truncation or hashing.
+func WithContentCapture(cfg ContentCaptureConfig) Option {
+	return func(c *Client) {
+		if cfg.MaxLength <= 0 {
+			cfg.MaxLength = defaultCaptureMaxLength
+		}
+		c.contentCapture = &cfg
+	}
+}
+
+func (c *Client) captureContent(event *TelemetryEvent, request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) {
+	cfg := c.contentCapture
+	if cfg == nil {
+		return
+	}
+	if cfg.SampleRate > 0 && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+		return
+	}
+
+	prompt := c.redact(renderMessages(request.Messages))
+	var completion string
+	if len(resp.Choices) > 0 {
+		completion = c.redact(resp.Choices[0].Message.Content)
+	}
+
+	if cfg.HashOnly {
+		event.PromptHash = hashContent(prompt)
+		event.CompletionHash = hashContent(completion)
+		return
+	}
+	event.Prompt = truncate(prompt, cfg.MaxLength)
+	event.Completion = truncate(completion, cfg.MaxLength)
+}
+
+func renderMessages(messages []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString(m.Role)
+		b.WriteString(": ")
+		b.WriteString(m.Content)
+		for _, part := range m.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				b.WriteString(part.Text)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func hashContent(text string) string {
+	if text == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate cuts text to at most max bytes without splitting a UTF-8 sequence
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	cut := max
+	for cut > 0 && !utf8RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,194 @@
+package langmesh
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ContentVerdict is the outcome of a content safety check
+type ContentVerdict struct {
+	Flagged    bool
+	Categories []string
+}
+
+// ContentChecker decides whether request content is safe to send
+type ContentChecker interface {
+	CheckContent(ctx context.Context, content string) (ContentVerdict, error)
+}
+
+// ContentCheckerFunc adapts a function to ContentChecker
+type ContentCheckerFunc func(ctx context.Context, content string) (ContentVerdict, error)
+
+// CheckContent calls f
+func (f ContentCheckerFunc) CheckContent(ctx context.Context, content string) (ContentVerdict, error) {
+	return f(ctx, content)
+}
+
+// WithContentGuard rejects chat requests that checker flags with a
+// GuardError carrying GuardReasonContentFlagged. name identifies the guard
+// in errors and in the verdict cache.
+func WithContentGuard(name string, checker ContentChecker) Option {
+	return func(c *Client) {
+		c.guards = append(c.guards, contentGuard{name: name, checker: checker})
+	}
+}
+
+// WithModerationGuard rejects chat requests the OpenAI moderation endpoint
+// flags
+func WithModerationGuard() Option {
+	return func(c *Client) {
+		c.guards = append(c.guards, contentGuard{name: "moderation", checker: moderationChecker{}})
+	}
+}
+
+// maxVerdictEntries bounds the verdict cache, evicting the least recently
+// used verdicts beyond it
+const maxVerdictEntries = 4096
+
+// WithVerdictCache remembers content guard verdicts for ttl, keyed by guard
+// and content hash, so retries and regenerations of the same request are
+// not checked again. Check errors are never cached.
+func WithVerdictCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.verdicts = newVerdictCache(ttl, maxVerdictEntries)
+	}
+}
+
+type contentGuard struct {
+	name    string
+	checker ContentChecker
+}
+
+func (g contentGuard) check(ctx context.Context, c *Client, request openai.ChatCompletionRequest) error {
+	content := renderMessages(request.Messages)
+	key := g.name + ":" + hashContent(content)
+
+	verdict, ok := c.verdicts.get(key)
+	if !ok {
+		checker := g.checker
+		if m, isModeration := checker.(moderationChecker); isModeration {
+			m.client = c
+			checker = m
+		}
+		var err error
+		verdict, err = checker.CheckContent(ctx, content)
+		if err != nil {
+			return err
+		}
+		c.verdicts.put(key, verdict)
+	}
+
+	if !verdict.Flagged {
+		return nil
+	}
+	return &GuardError{
+		Reason:     GuardReasonContentFlagged,
+		Guard:      g.name,
+		Categories: verdict.Categories,
+	}
+}
+
+// moderationChecker checks content with the moderation endpoint of the
+// client whose guard is running
+type moderationChecker struct {
+	client *Client
+}
+
+func (m moderationChecker) CheckContent(ctx context.Context, content string) (ContentVerdict, error) {
+	ctx, _ = withCallState(ctx, callStateFrom(ctx).id())
+	resp, err := m.client.Client.Moderations(ctx, openai.ModerationRequest{Input: content})
+	if err != nil {
+		return ContentVerdict{}, err
+	}
+	var verdict ContentVerdict
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Categories = append(verdict.Categories, flaggedCategories(result.Categories)...)
+	}
+	return verdict, nil
+}
+
+func flaggedCategories(categories openai.ResultCategories) []string {
+	data, _ := json.Marshal(categories)
+	var flags map[string]bool
+	_ = json.Unmarshal(data, &flags)
+	var out []string
+	for name, flagged := range flags {
+		if flagged {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type verdictEntry struct {
+	key     string
+	verdict ContentVerdict
+	expires time.Time
+}
+
+// verdictCache is an LRU of content guard verdicts. Expired verdicts are
+// dropped when looked up, or evicted once least recently used. A nil cache
+// holds nothing.
+type verdictCache struct {
+	ttl     time.Duration
+	max     int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func newVerdictCache(ttl time.Duration, max int) *verdictCache {
+	return &verdictCache{ttl: ttl, max: max, order: list.New(), entries: make(map[string]*list.Element), now: time.Now}
+}
+
+func (v *verdictCache) get(key string) (ContentVerdict, bool) {
+	if v == nil {
+		return ContentVerdict{}, false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	el, ok := v.entries[key]
+	if !ok {
+		return ContentVerdict{}, false
+	}
+	e := el.Value.(*verdictEntry)
+	if v.now().After(e.expires) {
+		v.order.Remove(el)
+		delete(v.entries, key)
+		return ContentVerdict{}, false
+	}
+	v.order.MoveToFront(el)
+	return e.verdict, true
+}
+
+func (v *verdictCache) put(key string, verdict ContentVerdict) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entry := &verdictEntry{key: key, verdict: verdict, expires: v.now().Add(v.ttl)}
+	if el, ok := v.entries[key]; ok {
+		el.Value = entry
+		v.order.MoveToFront(el)
+		return
+	}
+	v.entries[key] = v.order.PushFront(entry)
+	for v.order.Len() > v.max {
+		oldest := v.order.Back()
+		v.order.Remove(oldest)
+		delete(v.entries, oldest.Value.(*verdictEntry).key)
+	}
+}
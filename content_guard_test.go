@@ -0,0 +1,40 @@
+package langmesh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerdictCacheExpiresAndEvicts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	v := newVerdictCache(time.Minute, 2)
+	v.now = func() time.Time { return now }
+
+	v.put("a", ContentVerdict{Flagged: true})
+	v.put("b", ContentVerdict{})
+	v.get("a")
+	v.put("c", ContentVerdict{})
+	if _, ok := v.get("b"); ok {
+		t.Error("least recently used verdict was kept")
+	}
+	if verdict, ok := v.get("a"); !ok || !verdict.Flagged {
+		t.Errorf("get(a) = %+v, %v", verdict, ok)
+	}
+	if len(v.entries) != 2 || v.order.Len() != 2 {
+		t.Errorf("cache holds %d verdicts, want 2", len(v.entries))
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := v.get("a"); ok {
+		t.Error("expired verdict returned")
+	}
+	if _, ok := v.entries["a"]; ok {
+		t.Error("expired verdict kept after lookup")
+	}
+
+	var none *verdictCache
+	none.put("a", ContentVerdict{})
+	if _, ok := none.get("a"); ok {
+		t.Error("nil cache returned a verdict")
+	}
+}
@@ -0,0 +1,54 @@
+package langmesh
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCaptureContentRedactsAndTruncates(t *testing.T) {
+	client := NewClient("test-key", WithRedaction(), WithContentCapture(ContentCaptureConfig{MaxLength: 20}))
+	request := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{
+		{Role: "user", Content: "reach me at a@b.io please, it is urgent"},
+	}}
+	resp := openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+		{Message: openai.ChatCompletionMessage{Content: "ok"}},
+	}}
+
+	var event TelemetryEvent
+	client.captureContent(&event, request, resp)
+
+	if event.Prompt != "user: reach me at [E" {
+		t.Errorf("prompt = %q", event.Prompt)
+	}
+	if event.Completion != "ok" {
+		t.Errorf("completion = %q", event.Completion)
+	}
+}
+
+func TestCaptureContentHashOnly(t *testing.T) {
+	client := NewClient("test-key", WithContentCapture(ContentCaptureConfig{HashOnly: true}))
+	var event TelemetryEvent
+	client.captureContent(&event, openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{
+		{Role: "user", Content: "secret"},
+	}}, openai.ChatCompletionResponse{})
+
+	if event.Prompt != "" || len(event.PromptHash) != 64 {
+		t.Errorf("expected hash only, got prompt=%q hash=%q", event.Prompt, event.PromptHash)
+	}
+	if event.CompletionHash != "" {
+		t.Errorf("empty completion should not be hashed: %q", event.CompletionHash)
+	}
+}
+
+func TestContentNotCapturedByDefault(t *testing.T) {
+	client := NewClient("test-key")
+	var event TelemetryEvent
+	client.captureContent(&event, openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{
+		{Role: "user", Content: strings.Repeat("x", 10)},
+	}}, openai.ChatCompletionResponse{})
+	if event.Prompt != "" {
+		t.Errorf("content captured without opt-in: %q", event.Prompt)
+	}
+}
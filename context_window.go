@@ -0,0 +1,254 @@
+package langmesh
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TruncationStrategy selects how ContextManager shortens a conversation that
+// does not fit the model's context window
+type TruncationStrategy int
+
+const (
+	// DropOldest removes the oldest messages until the request fits
+	DropOldest TruncationStrategy = iota
+	// SlidingWindow keeps only the most recent WindowMessages messages, then
+	// drops older ones if the request still does not fit
+	SlidingWindow
+	// SummarizeOldest replaces the messages that do not fit with a summary
+	// written by SummaryModel, dropping them instead if summarizing fails
+	SummarizeOldest
+)
+
+// DefaultSummaryModel writes summaries when ContextManager.SummaryModel is
+// empty
+const DefaultSummaryModel = "gpt-4o-mini"
+
+// defaultContextWindows are the context sizes, in tokens, of known models
+var defaultContextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+}
+
+// ContextManager keeps chat requests within the model's context window.
+// Leading system messages and the final message are always kept, and an
+// assistant message with tool calls is dropped together with its tool
+// results. Requests for models with no known window are sent unchanged.
+type ContextManager struct {
+	Strategy TruncationStrategy
+	// ContextWindows adds or overrides model context sizes in tokens
+	ContextWindows map[string]int
+	// ReserveTokens is kept free for the completion in addition to the
+	// request's MaxTokens
+	ReserveTokens int
+	// WindowMessages is the number of recent messages SlidingWindow keeps
+	WindowMessages int
+	// SummaryModel writes summaries for SummarizeOldest
+	SummaryModel string
+}
+
+// WithContextManager trims chat requests that would exceed their model's
+// context window. Token counts use the configured tokenizer, or the
+// estimate, so set ReserveTokens to leave headroom when estimating.
+func WithContextManager(cm ContextManager) Option {
+	return func(c *Client) {
+		c.contextManager = &cm
+	}
+}
+
+func (cm *ContextManager) window(model string) int {
+	if n, ok := cm.ContextWindows[model]; ok {
+		return n
+	}
+	return defaultContextWindows[model]
+}
+
+// manageContext fits request into its model's window and reports how many
+// messages were removed
+func (c *Client) manageContext(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (openai.ChatCompletionRequest, int) {
+	cm := c.contextManager
+	if cm == nil {
+		return request, 0
+	}
+	window := cm.window(request.Model)
+	if window == 0 {
+		return request, 0
+	}
+	budget := window - request.MaxTokens - cm.ReserveTokens
+
+	head, units, last := splitConversation(request.Messages)
+	fits := func(units [][]openai.ChatCompletionMessage, extra ...openai.ChatCompletionMessage) bool {
+		return c.countPromptTokens(request.Model, joinConversation(head, units, last, extra...)) <= budget
+	}
+
+	dropped := 0
+	if cm.Strategy == SlidingWindow && cm.WindowMessages > 0 {
+		for len(units) > 0 && countMessages(units)+len(last) > cm.WindowMessages {
+			dropped += len(units[0])
+			units = units[1:]
+		}
+	}
+	if !fits(units) {
+		cut := 0
+		for cut < len(units) && !fits(units[cut:]) {
+			cut++
+		}
+		old := units[:cut]
+		units = units[cut:]
+		dropped += countMessages(old)
+		if cm.Strategy == SummarizeOldest {
+			if summary, ok := c.summarize(ctx, cm, old); ok {
+				// Make room for the summary itself
+				for len(units) > 0 && !fits(units, summary) {
+					dropped += len(units[0])
+					units = units[1:]
+				}
+				if fits(units, summary) {
+					request.Messages = joinConversation(head, units, last, summary)
+					return request, dropped
+				}
+			}
+		}
+	}
+	if dropped == 0 {
+		return request, 0
+	}
+	request.Messages = joinConversation(head, units, last)
+	return request, dropped
+}
+
+// splitConversation separates leading system messages and the final message
+// from the droppable history, grouping each assistant tool call message with
+// the tool results that answer it
+func splitConversation(messages []openai.ChatCompletionMessage) (
+	head []openai.ChatCompletionMessage,
+	units [][]openai.ChatCompletionMessage,
+	last []openai.ChatCompletionMessage,
+) {
+	if len(messages) == 0 {
+		return nil, nil, nil
+	}
+	i := 0
+	for i < len(messages)-1 && messages[i].Role == openai.ChatMessageRoleSystem {
+		i++
+	}
+	head = messages[:i]
+
+	end := len(messages) - 1
+	for end > i && messages[end].Role == openai.ChatMessageRoleTool {
+		end--
+	}
+	last = messages[end:]
+
+	for _, m := range messages[i:end] {
+		if m.Role == openai.ChatMessageRoleTool && len(units) > 0 {
+			units[len(units)-1] = append(units[len(units)-1], m)
+			continue
+		}
+		units = append(units, []openai.ChatCompletionMessage{m})
+	}
+	return head, units, last
+}
+
+func joinConversation(
+	head []openai.ChatCompletionMessage,
+	units [][]openai.ChatCompletionMessage,
+	last []openai.ChatCompletionMessage,
+	extra ...openai.ChatCompletionMessage,
+) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(head)+len(extra)+countMessages(units)+len(last))
+	out = append(out, head...)
+	out = append(out, extra...)
+	for _, unit := range units {
+		out = append(out, unit...)
+	}
+	return append(out, last...)
+}
+
+func countMessages(units [][]openai.ChatCompletionMessage) int {
+	n := 0
+	for _, unit := range units {
+		n += len(unit)
+	}
+	return n
+}
+
+// summarize condenses units into a single system message with the summary
+// model, recording the call as its own telemetry event
+func (c *Client) summarize(
+	ctx context.Context,
+	cm *ContextManager,
+	units [][]openai.ChatCompletionMessage,
+) (openai.ChatCompletionMessage, bool) {
+	if len(units) == 0 {
+		return openai.ChatCompletionMessage{}, false
+	}
+	model := cm.SummaryModel
+	if model == "" {
+		model = DefaultSummaryModel
+	}
+
+	var transcript strings.Builder
+	for _, unit := range units {
+		for _, m := range unit {
+			transcript.WriteString(m.Role)
+			transcript.WriteString(": ")
+			transcript.WriteString(m.Content)
+			transcript.WriteByte('\n')
+		}
+	}
+
+	summary, ok := c.summarizeText(ctx, model,
+		"Summarize the conversation so far in a few sentences, keeping facts, decisions and open questions.",
+		transcript.String())
+	if !ok {
+		return openai.ChatCompletionMessage{}, false
+	}
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "Summary of earlier conversation: " + summary,
+	}, true
+}
+
+// summarizeText asks model to condense text as instruction directs,
+// recording the call as a "chat.completions.summary" event
+func (c *Client) summarizeText(ctx context.Context, model, instruction, text string) (string, bool) {
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+	ctx, _ = withCallState(ctx, requestID)
+	request := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: instruction},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+	}
+	resp, err := c.Client.CreateChatCompletion(ctx, request)
+
+	if c.instrumented(ctx) {
+		event := c.newEvent(ctx, requestID, "chat.completions.summary", model, startTime, err)
+		if err == nil {
+			event.TokenUsage = TokenUsage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
+			}
+			event.CostEstimateUSD = c.estimateCost(model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		}
+		c.recordTelemetry(event)
+	}
+
+	if err != nil || len(resp.Choices) == 0 {
+		return "", false
+	}
+	return resp.Choices[0].Message.Content, true
+}
@@ -0,0 +1,155 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// summaryReply answers summary-model requests with a fixed summary
+func summaryReply(w http.ResponseWriter, req openai.ChatCompletionRequest, _ int) {
+	content := "ok"
+	if req.Model == DefaultSummaryModel {
+		content = "they talked"
+	}
+	writeChatReply(w, req.Model, content, 5, 2)
+}
+
+// longConversation is a system prompt, n turns of about 14 tokens each, and
+// a final question
+func longConversation(n int) []openai.ChatCompletionMessage {
+	messages := []openai.ChatCompletionMessage{{Role: "system", Content: "be brief"}}
+	for i := 0; i < n; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages = append(messages, openai.ChatCompletionMessage{Role: role, Content: fmt.Sprintf("turn %d %s", i, strings.Repeat("x", 32))})
+	}
+	return append(messages, openai.ChatCompletionMessage{Role: "user", Content: "question"})
+}
+
+func contents(messages []openai.ChatCompletionMessage) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = strings.SplitN(m.Content, " x", 2)[0]
+	}
+	return out
+}
+
+func TestContextManagerDropOldest(t *testing.T) {
+	srv, reqs := newRecordingServer(t, summaryReply)
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithContextManager(ContextManager{ContextWindows: map[string]int{"gpt-4o": 50}}),
+		withRecorder(rec),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: longConversation(6)}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	sent := reqs()[0].Messages
+	if got := fmt.Sprint(contents(sent)); got != "[be brief turn 4 turn 5 question]" {
+		t.Errorf("sent %s", got)
+	}
+	if got := rec.all()[0].TruncatedMessages; got != 4 {
+		t.Errorf("TruncatedMessages = %d", got)
+	}
+	if len(req.Messages) != 8 {
+		t.Error("caller's messages were modified")
+	}
+}
+
+func TestContextManagerKeepsToolResultsWithCall(t *testing.T) {
+	srv, reqs := newRecordingServer(t, summaryReply)
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithContextManager(ContextManager{ContextWindows: map[string]int{"gpt-4o": 30}}),
+	)
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: "user", Content: "weather? " + strings.Repeat("x", 40)},
+		{Role: "assistant", ToolCalls: []openai.ToolCall{{ID: "1", Type: "function", Function: openai.FunctionCall{Name: "weather"}}}},
+		{Role: "tool", ToolCallID: "1", Content: "sunny " + strings.Repeat("x", 20)},
+		{Role: "assistant", Content: "it is sunny"},
+		{Role: "user", Content: "thanks"},
+	}
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: messages}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	sent := reqs()[0].Messages
+	if sent[0].Role == "tool" {
+		t.Fatalf("tool result sent without its call: %+v", sent)
+	}
+	if got := fmt.Sprint(contents(sent)); got != "[it is sunny thanks]" {
+		t.Errorf("sent %s", got)
+	}
+}
+
+func TestContextManagerSlidingWindow(t *testing.T) {
+	srv, reqs := newRecordingServer(t, summaryReply)
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithContextManager(ContextManager{Strategy: SlidingWindow, WindowMessages: 3}),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: longConversation(6)}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(contents(reqs()[0].Messages)); got != "[be brief turn 4 turn 5 question]" {
+		t.Errorf("sent %s", got)
+	}
+}
+
+func TestContextManagerSummarize(t *testing.T) {
+	srv, reqs := newRecordingServer(t, summaryReply)
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithContextManager(ContextManager{Strategy: SummarizeOldest, ContextWindows: map[string]int{"gpt-4o": 70}}),
+		withRecorder(rec),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: longConversation(6)}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	all := reqs()
+	if len(all) != 2 || all[0].Model != DefaultSummaryModel {
+		t.Fatalf("requests = %+v", all)
+	}
+	if !strings.Contains(all[0].Messages[1].Content, "turn 0") {
+		t.Errorf("summary transcript = %q", all[0].Messages[1].Content)
+	}
+	sent := all[1].Messages
+	if sent[1].Role != "system" || !strings.Contains(sent[1].Content, "they talked") {
+		t.Errorf("summary not inserted: %+v", sent)
+	}
+	events := rec.all()
+	if len(events) != 2 || events[0].Endpoint != "chat.completions.summary" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestContextManagerUnknownModel(t *testing.T) {
+	srv, reqs := newRecordingServer(t, summaryReply)
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithContextManager(ContextManager{ContextWindows: map[string]int{"gpt-4o": 10}}),
+	)
+	req := openai.ChatCompletionRequest{Model: "custom-model", Messages: longConversation(6)}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs()[0].Messages) != 8 {
+		t.Error("request for a model with no known window was trimmed")
+	}
+}
@@ -0,0 +1,269 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ConversationStore persists conversation history by session ID
+type ConversationStore interface {
+	// Load returns the stored history, or nil for an unknown session
+	Load(ctx context.Context, sessionID string) ([]openai.ChatCompletionMessage, error)
+	Save(ctx context.Context, sessionID string, messages []openai.ChatCompletionMessage) error
+}
+
+// ConversationOptions configures a Conversation
+type ConversationOptions struct {
+	// SystemPrompt is pinned to the start of every request and never trimmed
+	SystemPrompt string
+	// Store persists history between turns; nil keeps it in memory only
+	Store ConversationStore
+	// MaxHistoryTokens trims the oldest turns once the history exceeds it;
+	// zero keeps everything
+	MaxHistoryTokens int
+}
+
+// Conversation keeps the message history of one chat session, appending each
+// exchange and tagging its telemetry with the session ID. Turns are
+// serialized, so a Conversation is safe for concurrent use.
+type Conversation struct {
+	client    *Client
+	sessionID string
+	opts      ConversationOptions
+
+	mu      sync.Mutex
+	history []openai.ChatCompletionMessage
+}
+
+// NewConversation starts or resumes the session sessionID, loading its
+// history from opts.Store
+func (c *Client) NewConversation(ctx context.Context, sessionID string, opts ConversationOptions) (*Conversation, error) {
+	conv := &Conversation{client: c, sessionID: sessionID, opts: opts}
+	if opts.Store != nil {
+		history, err := opts.Store.Load(ctx, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("langmesh: load conversation %s: %w", sessionID, err)
+		}
+		conv.history = history
+	}
+	return conv, nil
+}
+
+// SessionID returns the conversation's session ID
+func (v *Conversation) SessionID() string {
+	return v.sessionID
+}
+
+// Messages returns a copy of the history, without the pinned system prompt
+func (v *Conversation) Messages() []openai.ChatCompletionMessage {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), v.history...)
+}
+
+// Send sends request.Messages as the next turn, preceded by the system
+// prompt and history. On success the turn and the assistant's reply are
+// appended to the history and saved; on failure the history is unchanged.
+func (v *Conversation) Send(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (openai.ChatCompletionResponse, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	turn := request.Messages
+	request.Messages = v.prompt(append(append([]openai.ChatCompletionMessage(nil), v.history...), turn...))
+	resp, err := v.client.CreateChatCompletion(ContextWithSession(ctx, v.sessionID), request)
+	if err != nil {
+		return resp, err
+	}
+
+	history := append(append([]openai.ChatCompletionMessage(nil), v.history...), turn...)
+	if len(resp.Choices) > 0 {
+		history = append(history, resp.Choices[0].Message)
+	}
+	history = v.trim(request.Model, history)
+	if v.opts.Store != nil {
+		if err := v.opts.Store.Save(ctx, v.sessionID, history); err != nil {
+			return resp, fmt.Errorf("langmesh: save conversation %s: %w", v.sessionID, err)
+		}
+	}
+	v.history = history
+	return resp, nil
+}
+
+// Say sends content as a user message and returns the reply's text
+func (v *Conversation) Say(ctx context.Context, model, content string) (string, error) {
+	resp, err := v.Send(ctx, openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: content}},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (v *Conversation) prompt(history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if v.opts.SystemPrompt == "" {
+		return history
+	}
+	pinned := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: v.opts.SystemPrompt}
+	return append([]openai.ChatCompletionMessage{pinned}, history...)
+}
+
+// trim drops the oldest turns until history fits MaxHistoryTokens, keeping
+// tool results with the call that produced them
+func (v *Conversation) trim(model string, history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if v.opts.MaxHistoryTokens <= 0 {
+		return history
+	}
+	head, units, last := splitConversation(history)
+	for len(units) > 0 && v.client.countPromptTokens(model, joinConversation(head, units, last)) > v.opts.MaxHistoryTokens {
+		units = units[1:]
+	}
+	return joinConversation(head, units, last)
+}
+
+// ContextWithSession tags telemetry for calls made with the returned context
+// with sessionID
+func ContextWithSession(ctx context.Context, sessionID string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.session = sessionID
+	})
+}
+
+// applySession copies the session on ctx onto event
+func applySession(ctx context.Context, event *TelemetryEvent) {
+	if carrier := carrierFrom(ctx); carrier != nil {
+		event.SessionID = carrier.session
+	}
+}
+
+// MemoryStore is a ConversationStore held in process memory
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string][]openai.ChatCompletionMessage
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string][]openai.ChatCompletionMessage)}
+}
+
+// Load returns a copy of the session's history
+func (s *MemoryStore) Load(_ context.Context, sessionID string) ([]openai.ChatCompletionMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), s.sessions[sessionID]...), nil
+}
+
+// Save replaces the session's history
+func (s *MemoryStore) Save(_ context.Context, sessionID string, messages []openai.ChatCompletionMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = append([]openai.ChatCompletionMessage(nil), messages...)
+	return nil
+}
+
+// FileStore is a ConversationStore keeping one JSON file per session in a
+// directory
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates a FileStore in dir, which must exist
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (s *FileStore) path(sessionID string) string {
+	return filepath.Join(s.Dir, url.PathEscape(sessionID)+".json")
+}
+
+// Load reads the session's file
+func (s *FileStore) Load(_ context.Context, sessionID string) ([]openai.ChatCompletionMessage, error) {
+	data, err := os.ReadFile(s.path(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []openai.ChatCompletionMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Save writes the session's file, replacing it atomically
+func (s *FileStore) Save(_ context.Context, sessionID string, messages []openai.ChatCompletionMessage) error {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(sessionID))
+}
+
+// RedisClient is the subset of a Redis client RedisStore needs. Adapt your
+// client of choice to it; ok is false for a missing key.
+type RedisClient interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// RedisStore is a ConversationStore keeping each session's history as JSON
+// under Prefix + session ID
+type RedisStore struct {
+	Client RedisClient
+	Prefix string
+	// TTL expires idle sessions; zero keeps them forever
+	TTL time.Duration
+}
+
+// Load reads the session's key
+func (s *RedisStore) Load(ctx context.Context, sessionID string) ([]openai.ChatCompletionMessage, error) {
+	data, ok, err := s.Client.Get(ctx, s.Prefix+sessionID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var messages []openai.ChatCompletionMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Save writes the session's key, refreshing its TTL
+func (s *RedisStore) Save(ctx context.Context, sessionID string, messages []openai.ChatCompletionMessage) error {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(ctx, s.Prefix+sessionID, data, s.TTL)
+}
@@ -0,0 +1,137 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// echoReply replies with how many messages each request carried, and fails
+// requests whose last message is "fail"
+func echoReply(w http.ResponseWriter, req openai.ChatCompletionRequest, _ int) {
+	if req.Messages[len(req.Messages)-1].Content == "fail" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"bad","type":"invalid_request_error"}}`)
+		return
+	}
+	writeChatReply(w, "gpt-4o", fmt.Sprintf("seen %d", len(req.Messages)), 1, 1)
+}
+
+func TestConversationKeepsHistory(t *testing.T) {
+	srv, reqs := newRecordingServer(t, echoReply)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	conv, err := client.NewConversation(ctx, "s1", ConversationOptions{SystemPrompt: "be brief", Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.Say(ctx, "gpt-4o", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conv.Say(ctx, "gpt-4o", "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "seen 4" {
+		t.Errorf("reply = %q", reply)
+	}
+	if first := reqs()[1].Messages[0]; first.Role != "system" || first.Content != "be brief" {
+		t.Errorf("system prompt not pinned: %+v", first)
+	}
+	for _, event := range rec.all() {
+		if event.SessionID != "s1" {
+			t.Errorf("event SessionID = %q", event.SessionID)
+		}
+	}
+
+	if _, err := conv.Say(ctx, "gpt-4o", "fail"); err == nil {
+		t.Fatal("expected the failed turn's error")
+	}
+	if n := len(conv.Messages()); n != 4 {
+		t.Errorf("failed turn changed history to %d messages", n)
+	}
+
+	resumed, err := client.NewConversation(ctx, "s1", ConversationOptions{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resumed.Messages(); len(got) != 4 || got[3].Content != "seen 4" {
+		t.Errorf("resumed history = %+v", got)
+	}
+}
+
+func TestConversationTrimsHistory(t *testing.T) {
+	srv, _ := newRecordingServer(t, echoReply)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	ctx := context.Background()
+
+	conv, _ := client.NewConversation(ctx, "s2", ConversationOptions{SystemPrompt: "pinned", MaxHistoryTokens: 30})
+	for i := 0; i < 5; i++ {
+		if _, err := conv.Say(ctx, "gpt-4o", fmt.Sprintf("message %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := conv.Messages()
+	if got := client.countPromptTokens("gpt-4o", history); got > 30 {
+		t.Errorf("history is %d tokens", got)
+	}
+	if last := history[len(history)-1]; last.Role != "assistant" {
+		t.Errorf("latest reply trimmed: %+v", history)
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	ctx := context.Background()
+	if got, err := store.Load(ctx, "tenant/a"); err != nil || got != nil {
+		t.Fatalf("unknown session = %v, %v", got, err)
+	}
+	messages := []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}
+	if err := store.Save(ctx, "tenant/a", messages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load(ctx, "tenant/a")
+	if err != nil || len(got) != 1 || got[0].Content != "hi" {
+		t.Errorf("loaded %+v, %v", got, err)
+	}
+}
+
+type mapRedis struct {
+	values map[string][]byte
+	ttls   map[string]time.Duration
+}
+
+func (m *mapRedis) Get(_ context.Context, key string) ([]byte, bool, error) {
+	v, ok := m.values[key]
+	return v, ok, nil
+}
+
+func (m *mapRedis) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.values[key] = value
+	m.ttls[key] = ttl
+	return nil
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	redis := &mapRedis{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	store := &RedisStore{Client: redis, Prefix: "conv:", TTL: time.Hour}
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "s", []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	if redis.ttls["conv:s"] != time.Hour {
+		t.Errorf("ttls = %v", redis.ttls)
+	}
+	got, err := store.Load(ctx, "s")
+	if err != nil || len(got) != 1 {
+		t.Errorf("loaded %+v, %v", got, err)
+	}
+}
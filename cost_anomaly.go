@@ -0,0 +1,243 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CostAnomalyConfig configures WithCostAnomalyDetection. Zero fields take
+// the defaults.
+type CostAnomalyConfig struct {
+	// Window is the period spend is summed over (default 5m)
+	Window time.Duration
+	// Baselines is how many preceding windows form the baseline (default 12)
+	Baselines int
+	// ZScore flags a window spending this many standard deviations above
+	// the baseline mean. It defaults to 3 unless PercentOver is set.
+	ZScore float64
+	// PercentOver flags a window spending this much more than the baseline
+	// mean, e.g. 200 for triple; zero disables it
+	PercentOver float64
+	// MinSpendUSD ignores windows spending less, so a quiet baseline does
+	// not make every cent a spike (default 0.10)
+	MinSpendUSD float64
+	// GroupBy tracks spend per key, e.g. PartitionByModel or
+	// PartitionByTag("agent"); nil tracks total spend
+	GroupBy func(TelemetryEvent) string
+	// OnAnomaly is called, on its own goroutine, once per window and key
+	// that is flagged
+	OnAnomaly func(CostAnomaly)
+	// WebhookURL, if set, is sent each anomaly as a JSON POST
+	WebhookURL string
+}
+
+// CostAnomaly is a window whose spend was flagged against its baseline
+type CostAnomaly struct {
+	// Key is the GroupBy key, empty for total spend
+	Key         string    `json:"key"`
+	WindowStart time.Time `json:"window_start"`
+	// SpendUSD is the window's spend when it was flagged; the window may
+	// not be over yet
+	SpendUSD        float64 `json:"spend_usd"`
+	BaselineMeanUSD float64 `json:"baseline_mean_usd"`
+	BaselineStdDev  float64 `json:"baseline_stddev_usd"`
+	// ZScore is measured against a deviation of at least a tenth of the
+	// mean. ZScore and PercentOver are zero when the baseline spent nothing.
+	ZScore      float64 `json:"z_score"`
+	PercentOver float64 `json:"percent_over"`
+}
+
+// WithCostAnomalyDetection watches the client's spend for spikes, such as
+// a runaway agent loop, comparing each window's spend with the windows
+// before it. A window is flagged as soon as its spend crosses a threshold,
+// so alerts arrive while the spike is still under way. Anomalies are
+// logged at LogBudget and sent to OnAnomaly and WebhookURL.
+func WithCostAnomalyDetection(cfg CostAnomalyConfig) Option {
+	return func(c *Client) {
+		if cfg.Window <= 0 {
+			cfg.Window = 5 * time.Minute
+		}
+		if cfg.Baselines <= 0 {
+			cfg.Baselines = 12
+		}
+		if cfg.ZScore <= 0 && cfg.PercentOver <= 0 {
+			cfg.ZScore = 3
+		}
+		if cfg.MinSpendUSD <= 0 {
+			cfg.MinSpendUSD = 0.10
+		}
+		c.observers = append(c.observers, &costAnomalyDetector{
+			client:  c,
+			cfg:     cfg,
+			keys:    make(map[string]*spendWindows),
+			now:     time.Now,
+			webhook: &http.Client{Timeout: 5 * time.Second},
+		})
+	}
+}
+
+type costAnomalyDetector struct {
+	client  *Client
+	cfg     CostAnomalyConfig
+	mu      sync.Mutex
+	keys    map[string]*spendWindows
+	now     func() time.Time
+	webhook *http.Client
+}
+
+// spendWindows holds one key's spend in a ring of the current window and
+// its baselines
+type spendWindows struct {
+	spend []float64
+	slots []int64
+	// first is the window the key was first seen in; earlier windows are
+	// unknown rather than empty
+	first   int64
+	flagged int64
+}
+
+// minBaselines is how many windows of history a key needs before it can
+// be flagged
+const minBaselines = 3
+
+func (d *costAnomalyDetector) observe(event TelemetryEvent) {
+	if event.Heartbeat || event.CostEstimateUSD <= 0 {
+		return
+	}
+	key := ""
+	if d.cfg.GroupBy != nil {
+		key = d.cfg.GroupBy(event)
+	}
+	d.mu.Lock()
+	w, slot := d.add(key, event.CostEstimateUSD, d.now())
+	anomaly, ok := d.check(w, slot)
+	if ok {
+		w.flagged = slot
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	anomaly.Key = key
+	anomaly.WindowStart = time.Unix(0, slot*int64(d.cfg.Window))
+	d.client.log(context.Background(), LogBudget, "cost anomaly detected",
+		"key", key, "spend_usd", anomaly.SpendUSD, "baseline_mean_usd", anomaly.BaselineMeanUSD,
+		"z_score", anomaly.ZScore)
+	go d.notify(anomaly)
+}
+
+func (d *costAnomalyDetector) history() time.Duration {
+	return d.cfg.Window * time.Duration(d.cfg.Baselines+1)
+}
+
+// restore adds stored spend to the baselines without flagging it
+func (d *costAnomalyDetector) restore(event TelemetryEvent, at time.Time) {
+	if event.Heartbeat || event.CostEstimateUSD <= 0 {
+		return
+	}
+	key := ""
+	if d.cfg.GroupBy != nil {
+		key = d.cfg.GroupBy(event)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.add(key, event.CostEstimateUSD, at)
+}
+
+// add counts cost in key's window for at, returning the key's windows and
+// the window's slot. d.mu must be held.
+func (d *costAnomalyDetector) add(key string, cost float64, at time.Time) (*spendWindows, int64) {
+	slot := at.UnixNano() / int64(d.cfg.Window)
+	size := d.cfg.Baselines + 1
+	w, ok := d.keys[key]
+	if !ok {
+		w = &spendWindows{spend: make([]float64, size), slots: make([]int64, size), first: slot, flagged: -1}
+		d.keys[key] = w
+	}
+	// Restored history can predate the window the key was first seen in
+	w.first = min(w.first, slot)
+	idx := int(slot % int64(size))
+	if w.slots[idx] != slot {
+		w.slots[idx] = slot
+		w.spend[idx] = 0
+	}
+	w.spend[idx] = addUSD(w.spend[idx], cost)
+	return w, slot
+}
+
+// check compares the current window's spend with its baseline
+func (d *costAnomalyDetector) check(w *spendWindows, slot int64) (CostAnomaly, bool) {
+	size := int64(len(w.spend))
+	current := w.spend[slot%size]
+	if w.flagged == slot || current < d.cfg.MinSpendUSD {
+		return CostAnomaly{}, false
+	}
+	history := min(slot-w.first, int64(d.cfg.Baselines))
+	if history < minBaselines {
+		return CostAnomaly{}, false
+	}
+	var sum, sumSq float64
+	for s := slot - history; s < slot; s++ {
+		var spend float64
+		if i := s % size; w.slots[i] == s {
+			spend = w.spend[i]
+		}
+		sum += spend
+		sumSq += spend * spend
+	}
+	n := float64(history)
+	mean := sum / n
+	std := math.Sqrt(max(sumSq/n-mean*mean, 0))
+	a := CostAnomaly{SpendUSD: current, BaselineMeanUSD: mean, BaselineStdDev: std}
+
+	zHit, pctHit := false, false
+	// A perfectly steady baseline would make any rise infinitely unusual
+	if dev := max(std, mean/10); dev > 0 {
+		a.ZScore = (current - mean) / dev
+		zHit = d.cfg.ZScore > 0 && a.ZScore >= d.cfg.ZScore
+	} else {
+		zHit = d.cfg.ZScore > 0
+	}
+	if mean > 0 {
+		a.PercentOver = (current - mean) / mean * 100
+		pctHit = d.cfg.PercentOver > 0 && a.PercentOver >= d.cfg.PercentOver
+	} else {
+		pctHit = d.cfg.PercentOver > 0
+	}
+	return a, zHit || pctHit
+}
+
+func (d *costAnomalyDetector) notify(a CostAnomaly) {
+	if d.cfg.OnAnomaly != nil {
+		d.cfg.OnAnomaly(a)
+	}
+	if d.cfg.WebhookURL == "" {
+		return
+	}
+	if err := d.post(a); err != nil {
+		d.client.log(context.Background(), LogBudget, "cost anomaly webhook failed", "error", err)
+	}
+}
+
+func (d *costAnomalyDetector) post(a CostAnomaly) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := d.webhook.Post(d.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("langmesh: cost anomaly webhook returned %s", resp.Status)
+	}
+	return nil
+}
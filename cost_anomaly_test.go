@@ -0,0 +1,102 @@
+package langmesh
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newAnomalyDetector(t *testing.T, cfg CostAnomalyConfig) (*costAnomalyDetector, *time.Time) {
+	t.Helper()
+	client := NewClient("test-key", WithCostAnomalyDetection(cfg))
+	d := client.observers[len(client.observers)-1].(*costAnomalyDetector)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestCostAnomalyZScore(t *testing.T) {
+	anomalies := make(chan CostAnomaly, 4)
+	d, now := newAnomalyDetector(t, CostAnomalyConfig{
+		Window:    time.Minute,
+		GroupBy:   PartitionByModel,
+		OnAnomaly: func(a CostAnomaly) { anomalies <- a },
+	})
+
+	// A baseline of $1-1.20 a minute
+	for i := 0; i < 6; i++ {
+		d.observe(TelemetryEvent{Model: "gpt-4o", CostEstimateUSD: 1 + float64(i%3)/10})
+		*now = now.Add(time.Minute)
+	}
+	// The spike is flagged mid-window, once
+	for i := 0; i < 10; i++ {
+		d.observe(TelemetryEvent{Model: "gpt-4o", CostEstimateUSD: 0.5})
+	}
+	d.observe(TelemetryEvent{Model: "gpt-4o-mini", CostEstimateUSD: 5})
+
+	select {
+	case a := <-anomalies:
+		if a.Key != "gpt-4o" || a.SpendUSD != 1.5 || a.ZScore < 3 || !a.WindowStart.Equal(*now) {
+			t.Errorf("anomaly = %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("spike not flagged")
+	}
+	select {
+	case a := <-anomalies:
+		t.Errorf("flagged again: %+v", a)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCostAnomalyPercentOverWebhook(t *testing.T) {
+	received := make(chan CostAnomaly, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a CostAnomaly
+		_ = json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	t.Cleanup(hook.Close)
+	d, now := newAnomalyDetector(t, CostAnomalyConfig{
+		Window:      time.Hour,
+		Baselines:   4,
+		PercentOver: 100,
+		WebhookURL:  hook.URL,
+	})
+
+	for i := 0; i < 4; i++ {
+		d.observe(TelemetryEvent{CostEstimateUSD: 1})
+		*now = now.Add(time.Hour)
+	}
+	d.observe(TelemetryEvent{CostEstimateUSD: 1.9})
+	d.observe(TelemetryEvent{Heartbeat: true, CostEstimateUSD: 1})
+	select {
+	case a := <-received:
+		t.Fatalf("flagged below threshold: %+v", a)
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.observe(TelemetryEvent{CostEstimateUSD: 0.2})
+	select {
+	case a := <-received:
+		if a.BaselineMeanUSD != 1 || a.PercentOver < 100 {
+			t.Errorf("anomaly = %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestCostAnomalyNeedsHistory(t *testing.T) {
+	called := make(chan CostAnomaly, 1)
+	d, now := newAnomalyDetector(t, CostAnomalyConfig{Window: time.Minute, OnAnomaly: func(a CostAnomaly) { called <- a }})
+	d.observe(TelemetryEvent{CostEstimateUSD: 0.2})
+	*now = now.Add(2 * time.Minute)
+	d.observe(TelemetryEvent{CostEstimateUSD: 50})
+	select {
+	case a := <-called:
+		t.Errorf("flagged without a baseline: %+v", a)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
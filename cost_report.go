@@ -0,0 +1,288 @@
+package langmesh
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCostRetention is how much telemetry WithCostRetention keeps when
+// given no duration
+const DefaultCostRetention = 24 * time.Hour
+
+// CostLine is the spend of one group of requests
+type CostLine struct {
+	Requests         int
+	Errors           int
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	// Cost is CostUSD in the report's Currency
+	Cost float64
+
+	// cost is the exact sum behind CostUSD
+	cost Money
+}
+
+func (l *CostLine) add(event *TelemetryEvent) {
+	l.Requests++
+	if event.Status == "error" {
+		l.Errors++
+	}
+	l.PromptTokens += event.TokenUsage.PromptTokens
+	l.CompletionTokens += event.TokenUsage.CompletionTokens
+	l.cost += MoneyFromFloat(event.CostEstimateUSD)
+}
+
+func (l *CostLine) merge(o CostLine) {
+	l.Requests += o.Requests
+	l.Errors += o.Errors
+	l.PromptTokens += o.PromptTokens
+	l.CompletionTokens += o.CompletionTokens
+	l.cost += o.cost
+}
+
+// format sets the line's reported costs from its exact sum
+func (l *CostLine) format(f *costFormat) {
+	l.CostUSD = f.round(l.cost).Float64()
+	l.Cost, _, _ = f.local(l.cost)
+}
+
+// CostReport is the spend recorded between Since and Until
+type CostReport struct {
+	Since time.Time
+	Until time.Time
+	// Currency is the currency of the lines' Cost: USD, or the one set
+	// with WithCurrency
+	Currency string
+	Total    CostLine
+
+	ByModel    map[string]CostLine
+	ByEndpoint map[string]CostLine
+	// ByProject is keyed by OpenAI project, empty for requests without one
+	ByProject map[string]CostLine
+	// ByTag is keyed by tag name and then tag value, for requests carrying
+	// ContextWithTag
+	ByTag map[string]map[string]CostLine
+}
+
+// WithCostRetention keeps a per-minute summary of the last retention of
+// telemetry in memory for Client.CostReport. A zero retention keeps
+// DefaultCostRetention.
+func WithCostRetention(retention time.Duration) Option {
+	return func(c *Client) {
+		if retention <= 0 {
+			retention = DefaultCostRetention
+		}
+		c.costLedger = &costLedger{retention: retention, now: time.Now}
+		c.observers = append(c.observers, c.costLedger)
+	}
+}
+
+// CostReport aggregates the spend of requests finished in the last window,
+// grouped by model, endpoint, project and tag. It is computed locally from the
+// retention kept by WithCostRetention, to the minute, and is empty without
+// it.
+func (c *Client) CostReport(window time.Duration) CostReport {
+	if c.costLedger == nil {
+		now := time.Now()
+		if c.eventRetention == nil {
+			return CostReport{Since: now.Add(-window), Until: now, Currency: c.reportCurrency()}
+		}
+		report, err := c.eventRetention.CostReport(context.Background(), now.Add(-window), now)
+		if err != nil {
+			c.log(context.Background(), LogTelemetry, "cost report from the event store failed", "error", err)
+		}
+		report.Currency = c.reportCurrency()
+		report.Total.format(&c.costFormat)
+		report.formatLines(&c.costFormat)
+		return report
+	}
+	report := c.costLedger.report(window)
+	report.Currency = c.reportCurrency()
+	report.Total.format(&c.costFormat)
+	report.formatLines(&c.costFormat)
+	return report
+}
+
+// reportCurrency is the currency costs are reported in besides USD
+func (c *Client) reportCurrency() string {
+	if c.costFormat.convert == nil {
+		return "USD"
+	}
+	return c.costFormat.currency
+}
+
+// formatLines sets the reported costs of every grouped line
+func (r *CostReport) formatLines(f *costFormat) {
+	for _, lines := range []map[string]CostLine{r.ByModel, r.ByEndpoint, r.ByProject} {
+		formatLines(lines, f)
+	}
+	for _, lines := range r.ByTag {
+		formatLines(lines, f)
+	}
+}
+
+func formatLines(lines map[string]CostLine, f *costFormat) {
+	for key, line := range lines {
+		line.format(f)
+		lines[key] = line
+	}
+}
+
+// costMinute is the spend of requests finished within one minute
+type costMinute struct {
+	start      int64
+	total      CostLine
+	byModel    map[string]*CostLine
+	byEndpoint map[string]*CostLine
+	byProject  map[string]*CostLine
+	byTag      map[string]map[string]*CostLine
+}
+
+func newCostMinute(start int64) *costMinute {
+	return &costMinute{
+		start:      start,
+		byModel:    make(map[string]*CostLine),
+		byEndpoint: make(map[string]*CostLine),
+		byProject:  make(map[string]*CostLine),
+		byTag:      make(map[string]map[string]*CostLine),
+	}
+}
+
+type costLedger struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu sync.Mutex
+	// minutes is oldest first
+	minutes []*costMinute
+}
+
+func (l *costLedger) observe(event TelemetryEvent) {
+	if event.Heartbeat {
+		return
+	}
+	l.add(&event, l.now())
+}
+
+func (l *costLedger) history() time.Duration {
+	return l.retention
+}
+
+func (l *costLedger) restore(event TelemetryEvent, at time.Time) {
+	l.add(&event, at)
+}
+
+// add counts event in the minute of at
+func (l *costLedger) add(event *TelemetryEvent, at time.Time) {
+	minute := at.Truncate(time.Minute).Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(l.now())
+	// Live events land in the last minute; restored ones may be older
+	i := len(l.minutes)
+	for i > 0 && l.minutes[i-1].start > minute {
+		i--
+	}
+	var m *costMinute
+	if i > 0 && l.minutes[i-1].start == minute {
+		m = l.minutes[i-1]
+	} else {
+		m = newCostMinute(minute)
+		l.minutes = append(l.minutes, nil)
+		copy(l.minutes[i+1:], l.minutes[i:])
+		l.minutes[i] = m
+	}
+	m.add(event)
+}
+
+func (m *costMinute) add(event *TelemetryEvent) {
+	m.total.add(event)
+	lineFor(m.byModel, event.Model).add(event)
+	lineFor(m.byEndpoint, event.Endpoint).add(event)
+	lineFor(m.byProject, event.Project).add(event)
+	for key, value := range event.Tags {
+		values, ok := m.byTag[key]
+		if !ok {
+			values = make(map[string]*CostLine)
+			m.byTag[key] = values
+		}
+		lineFor(values, value).add(event)
+	}
+}
+
+func lineFor(lines map[string]*CostLine, key string) *CostLine {
+	line, ok := lines[key]
+	if !ok {
+		line = &CostLine{}
+		lines[key] = line
+	}
+	return line
+}
+
+// prune drops minutes that have aged out of the retention
+func (l *costLedger) prune(now time.Time) {
+	cutoff := now.Add(-l.retention).Truncate(time.Minute).Unix()
+	drop := 0
+	for drop < len(l.minutes) && l.minutes[drop].start < cutoff {
+		drop++
+	}
+	if drop > 0 {
+		clear(l.minutes[:drop])
+		l.minutes = l.minutes[drop:]
+	}
+}
+
+func (l *costLedger) report(window time.Duration) CostReport {
+	now := l.now()
+	report := newCostReport(now.Add(-window), now)
+	since := report.Since.Truncate(time.Minute).Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	for _, m := range l.minutes {
+		if m.start < since {
+			continue
+		}
+		report.merge(m)
+	}
+	return report
+}
+
+func newCostReport(since, until time.Time) CostReport {
+	return CostReport{
+		Since:      since,
+		Until:      until,
+		ByModel:    make(map[string]CostLine),
+		ByEndpoint: make(map[string]CostLine),
+		ByProject:  make(map[string]CostLine),
+		ByTag:      make(map[string]map[string]CostLine),
+	}
+}
+
+// merge adds a minute's spend to the report
+func (r *CostReport) merge(m *costMinute) {
+	r.Total.merge(m.total)
+	mergeLines(r.ByModel, m.byModel)
+	mergeLines(r.ByEndpoint, m.byEndpoint)
+	mergeLines(r.ByProject, m.byProject)
+	for key, values := range m.byTag {
+		out, ok := r.ByTag[key]
+		if !ok {
+			out = make(map[string]CostLine)
+			r.ByTag[key] = out
+		}
+		mergeLines(out, values)
+	}
+}
+
+func mergeLines(into map[string]CostLine, from map[string]*CostLine) {
+	for key, line := range from {
+		sum := into[key]
+		sum.merge(*line)
+		into[key] = sum
+	}
+}
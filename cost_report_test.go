@@ -0,0 +1,66 @@
+package langmesh
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCostReportGroupsRetainedSpend(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithCostRetention(time.Hour))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client.costLedger.now = func() time.Time { return now }
+
+	chat := func(ctx context.Context, model string) {
+		t.Helper()
+		_, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	chat(ContextWithTag(ctx, "team", "search"), "gpt-4o")
+	now = now.Add(30 * time.Minute)
+	chat(ContextWithTag(ctx, "team", "search"), "gpt-4o-mini")
+	chat(ContextWithTag(ctx, "team", "ads"), "gpt-4o-mini")
+
+	report := client.CostReport(10 * time.Minute)
+	if report.Total.Requests != 2 || report.ByModel["gpt-4o"].Requests != 0 {
+		t.Errorf("10 minute report = %+v", report)
+	}
+	if search := report.ByTag["team"]["search"]; search.Requests != 1 || search.CostUSD <= 0 {
+		t.Errorf("search = %+v", search)
+	}
+
+	report = client.CostReport(time.Hour)
+	if report.ByModel["gpt-4o"].Requests != 1 || report.ByEndpoint["chat.completions"].Requests != 3 {
+		t.Errorf("hour report = %+v", report)
+	}
+	sum := 0.0
+	for _, line := range report.ByModel {
+		sum += line.CostUSD
+	}
+	if math.Abs(sum-report.Total.CostUSD) > 1e-12 {
+		t.Errorf("model costs sum to %v, total %v", sum, report.Total.CostUSD)
+	}
+
+	// The first request ages out of the retention
+	now = now.Add(45 * time.Minute)
+	if got := client.CostReport(24 * time.Hour).Total.Requests; got != 2 {
+		t.Errorf("after retention, report counts %d requests", got)
+	}
+}
+
+func TestCostReportWithoutRetention(t *testing.T) {
+	client := NewClient("test-key")
+	if report := client.CostReport(time.Hour); report.Total.Requests != 0 || report.Until.Sub(report.Since) != time.Hour {
+		t.Errorf("report = %+v", report)
+	}
+}
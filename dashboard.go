@@ -0,0 +1,214 @@
+package langmesh
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// DefaultDashboardWindow is how far back the dashboard looks when the page
+// asks for no window
+const DefaultDashboardWindow = 24 * time.Hour
+
+// dashboardBuckets is about how many points the requests-over-time chart
+// has
+const dashboardBuckets = 60
+
+// DashboardSummary is what the dashboard shows for a time range
+type DashboardSummary struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// StepSeconds is the width of each bucket
+	StepSeconds int64             `json:"step_seconds"`
+	Buckets     []DashboardBucket `json:"buckets"`
+	// Models are ordered by cost, highest first
+	Models []DashboardLine `json:"models"`
+	Total  DashboardLine   `json:"total"`
+}
+
+// DashboardBucket counts the requests that ended in one step of the range
+type DashboardBucket struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+	Errors   int       `json:"errors"`
+	CostUSD  float64   `json:"cost_usd"`
+}
+
+// DashboardLine summarizes the requests of a model, or of all of them
+type DashboardLine struct {
+	Model     string  `json:"model,omitempty"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	CostUSD   float64 `json:"cost_usd"`
+	P50Ms     int64   `json:"p50_ms"`
+	P95Ms     int64   `json:"p95_ms"`
+	P99Ms     int64   `json:"p99_ms"`
+}
+
+// dashboardLine accumulates a DashboardLine
+type dashboardLine struct {
+	requests, errors int
+	cost             Money
+	latencies        []time.Duration
+}
+
+func (l *dashboardLine) add(event TelemetryEvent) {
+	l.requests++
+	if event.Status == "error" {
+		l.errors++
+	}
+	l.cost += MoneyFromFloat(event.CostEstimateUSD)
+	l.latencies = append(l.latencies, time.Duration(event.LatencyMs)*time.Millisecond)
+}
+
+func (l *dashboardLine) line(model string) DashboardLine {
+	out := DashboardLine{Model: model, Requests: l.requests, Errors: l.errors, CostUSD: l.cost.Float64()}
+	if l.requests == 0 {
+		return out
+	}
+	out.ErrorRate = float64(l.errors) / float64(l.requests)
+	sort.Slice(l.latencies, func(i, j int) bool { return l.latencies[i] < l.latencies[j] })
+	out.P50Ms = percentile(l.latencies, 0.50).Milliseconds()
+	out.P95Ms = percentile(l.latencies, 0.95).Milliseconds()
+	out.P99Ms = percentile(l.latencies, 0.99).Milliseconds()
+	return out
+}
+
+// Summarize builds the dashboard's summary of the stored events q selects,
+// over q.Since to q.Until. A zero Until is now.
+func (r *EventRetention) Summarize(ctx context.Context, q EventQuery) (DashboardSummary, error) {
+	if q.Until.IsZero() {
+		q.Until = r.now()
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-DefaultDashboardWindow)
+	}
+	q.Limit = 0
+	step := dashboardStep(q.Until.Sub(q.Since))
+	summary := DashboardSummary{
+		Since:       q.Since,
+		Until:       q.Until,
+		StepSeconds: int64(step / time.Second),
+		Models:      []DashboardLine{},
+	}
+	events, err := r.Query(ctx, q)
+	if err != nil {
+		return summary, err
+	}
+
+	start := q.Since.Truncate(step)
+	buckets := make([]dashboardLine, int((q.Until.Sub(start)+step-1)/step))
+	var total dashboardLine
+	byModel := make(map[string]*dashboardLine)
+	for _, event := range events {
+		total.add(event)
+		m, ok := byModel[event.Model]
+		if !ok {
+			m = &dashboardLine{}
+			byModel[event.Model] = m
+		}
+		m.add(event)
+		if i := int(event.EndTime().Sub(start) / step); i >= 0 && i < len(buckets) {
+			b := &buckets[i]
+			b.requests++
+			if event.Status == "error" {
+				b.errors++
+			}
+			b.cost += MoneyFromFloat(event.CostEstimateUSD)
+		}
+	}
+	summary.Buckets = make([]DashboardBucket, len(buckets))
+	for i, b := range buckets {
+		summary.Buckets[i] = DashboardBucket{
+			Start:    start.Add(time.Duration(i) * step),
+			Requests: b.requests,
+			Errors:   b.errors,
+			CostUSD:  b.cost.Float64(),
+		}
+	}
+	for model, m := range byModel {
+		summary.Models = append(summary.Models, m.line(model))
+	}
+	sort.Slice(summary.Models, func(i, j int) bool {
+		if summary.Models[i].CostUSD != summary.Models[j].CostUSD {
+			return summary.Models[i].CostUSD > summary.Models[j].CostUSD
+		}
+		return summary.Models[i].Model < summary.Models[j].Model
+	})
+	summary.Total = total.line("")
+	return summary, nil
+}
+
+// dashboardStep divides window into about dashboardBuckets whole minutes
+func dashboardStep(window time.Duration) time.Duration {
+	return max(time.Minute, (window / dashboardBuckets).Truncate(time.Minute))
+}
+
+// DashboardHandler serves a dashboard of the stored telemetry: requests
+// over time, cost by model, error rates and latency percentiles. The page
+// loads its data as JSON from "data" next to it, which takes the query
+// parameters window (a duration), model, endpoint, user, project and
+// tag=key:value. It needs no external service, and is meant for
+// development; protect it as you would any page showing usage.
+func (r *EventRetention) DashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasSuffix(req.URL.Path, "/data") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(dashboardPage)
+			return
+		}
+		q, err := dashboardQuery(req, r.now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		summary, err := r.Summarize(req.Context(), q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	})
+}
+
+// dashboardQuery reads the data request's filters
+func dashboardQuery(req *http.Request, now time.Time) (EventQuery, error) {
+	params := req.URL.Query()
+	window := DefaultDashboardWindow
+	if s := params.Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return EventQuery{}, fmt.Errorf("langmesh: bad dashboard window %q", s)
+		}
+		window = d
+	}
+	q := EventQuery{
+		Since:    now.Add(-window),
+		Until:    now,
+		Model:    params.Get("model"),
+		Endpoint: params.Get("endpoint"),
+		User:     params.Get("user"),
+		Project:  params.Get("project"),
+	}
+	for _, tag := range params["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			return EventQuery{}, fmt.Errorf("langmesh: bad dashboard tag %q, want key:value", tag)
+		}
+		if q.Tags == nil {
+			q.Tags = make(map[string]string)
+		}
+		q.Tags[key] = value
+	}
+	return q, nil
+}
@@ -0,0 +1,100 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDashboard(t *testing.T, now time.Time) *EventRetention {
+	t.Helper()
+	store := NewMemoryEventStore()
+	var events []TelemetryEvent
+	for i := 0; i < 10; i++ {
+		event := storedEvent("gpt-4o", "success", now.Add(-time.Duration(i)*time.Minute-time.Second), 0.1, map[string]string{"agent": "triage"})
+		event.LatencyMs = int64(100 * (i + 1))
+		events = append(events, event)
+	}
+	failed := storedEvent("gpt-4o-mini", "error", now.Add(-30*time.Minute), 0, nil)
+	failed.LatencyMs = 50
+	events = append(events, failed)
+	// Outside the default window
+	events = append(events, storedEvent("gpt-4o", "success", now.Add(-48*time.Hour), 5, nil))
+	store.Append(context.Background(), events)
+
+	r := NewEventRetention(store, 0)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestSummarize(t *testing.T) {
+	// Recent enough not to be pruned
+	now := time.Now().UTC().Truncate(time.Hour)
+	r := newDashboard(t, now)
+	summary, err := r.Summarize(context.Background(), EventQuery{Until: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total.Requests != 11 || summary.Total.Errors != 1 || summary.Total.CostUSD != 1 {
+		t.Errorf("total = %+v", summary.Total)
+	}
+	if len(summary.Models) != 2 || summary.Models[0].Model != "gpt-4o" {
+		t.Fatalf("models = %+v", summary.Models)
+	}
+	if m := summary.Models[0]; m.Requests != 10 || m.ErrorRate != 0 || m.P50Ms != 500 || m.P99Ms != 900 {
+		t.Errorf("gpt-4o = %+v", m)
+	}
+	if m := summary.Models[1]; m.ErrorRate != 1 || m.P95Ms != 50 {
+		t.Errorf("gpt-4o-mini = %+v", m)
+	}
+
+	if summary.StepSeconds != 24*60 {
+		t.Errorf("step = %ds, want 24m for a day", summary.StepSeconds)
+	}
+	requests := 0
+	for _, b := range summary.Buckets {
+		requests += b.Requests
+	}
+	if requests != 11 || summary.Buckets[len(summary.Buckets)-1].Requests == 0 {
+		t.Errorf("buckets hold %d requests", requests)
+	}
+}
+
+func TestDashboardHandler(t *testing.T) {
+	now := time.Now()
+	srv := httptest.NewServer(http.StripPrefix("/dashboard", newDashboard(t, now).DashboardHandler()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/dashboard/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("page content type = %q", resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get(srv.URL + "/dashboard/data?window=1h&tag=agent:triage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary DashboardSummary
+	err = json.NewDecoder(resp.Body).Decode(&summary)
+	resp.Body.Close()
+	if err != nil || summary.Total.Requests != 10 || len(summary.Models) != 1 {
+		t.Errorf("data = %+v, %v", summary, err)
+	}
+
+	resp, err = http.Get(srv.URL + "/dashboard/data?window=soon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad window: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,251 @@
+package langmesh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DatasetConfig selects and prepares the logged requests
+// BuildFineTuningDataset turns into examples. Zero fields select
+// everything.
+type DatasetConfig struct {
+	// Models keeps only requests for these models
+	Models []string
+	// Tags must all be set, with these values, on the requests' events
+	Tags map[string]string
+	// MinQuality keeps only requests whose WithQualityScoring score is at
+	// least this. When it is set, unscored requests are dropped.
+	MinQuality float64
+	// Events are the requests' telemetry events, matched to log entries
+	// by request ID, for Tags and MinQuality; for example from
+	// EventRetention.Query
+	Events []TelemetryEvent
+
+	// ValidationFraction of the examples, in [0, 1), go to Validation.
+	// Examples are assigned by a hash of their content, so rebuilding
+	// from more traffic keeps earlier examples on the same side.
+	ValidationFraction float64
+	// Scrub redacts the text of every message and tool call, after
+	// WithRedaction redacted the log. Nil uses DefaultRedactors.
+	Scrub Redactor
+}
+
+// FineTuningExample is a line of an OpenAI chat fine-tuning file
+type FineTuningExample struct {
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+	Tools    []openai.Tool                  `json:"tools,omitempty"`
+}
+
+// FineTuningDataset is what BuildFineTuningDataset made of a log
+type FineTuningDataset struct {
+	Train      []FineTuningExample
+	Validation []FineTuningExample
+	Stats      DatasetStats
+}
+
+// DatasetStats counts what happened to each log entry
+type DatasetStats struct {
+	Entries int
+	// Unusable entries are not successful, complete chat completions:
+	// other endpoints, failures, truncated bodies, and replies cut off by
+	// max_tokens or the content filter
+	Unusable int
+	// Filtered entries did not match the model, tags or quality
+	Filtered   int
+	Duplicates int
+	Kept       int
+}
+
+// BuildFineTuningDataset converts chat completions logged by
+// WithRequestLog into fine-tuning examples: each request's messages and
+// tools, followed by the reply. Examples are scrubbed, then deduplicated
+// on their content, and split into training and validation sets, in log
+// order.
+func BuildFineTuningDataset(entries []RequestLogEntry, cfg DatasetConfig) FineTuningDataset {
+	scrub := cfg.Scrub
+	if scrub == nil {
+		scrub = DefaultRedactors()
+	}
+	events := make(map[string]TelemetryEvent, len(cfg.Events))
+	for _, e := range cfg.Events {
+		// A scored event wins when a request ID appears more than once
+		if _, ok := events[e.RequestID]; !ok || e.Quality != nil {
+			events[e.RequestID] = e
+		}
+	}
+
+	var ds FineTuningDataset
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, entry := range entries {
+		ds.Stats.Entries++
+		request, reply, ok := loggedChat(entry)
+		if !ok {
+			ds.Stats.Unusable++
+			continue
+		}
+		if !cfg.selects(request.Model, events[entry.CustomID]) {
+			ds.Stats.Filtered++
+			continue
+		}
+
+		example := FineTuningExample{Tools: request.Tools}
+		for _, m := range append(request.Messages, reply) {
+			example.Messages = append(example.Messages, scrubMessage(m, scrub))
+		}
+		key, err := json.Marshal(example)
+		if err != nil {
+			ds.Stats.Unusable++
+			continue
+		}
+		sum := sha256.Sum256(key)
+		if seen[sum] {
+			ds.Stats.Duplicates++
+			continue
+		}
+		seen[sum] = true
+		ds.Stats.Kept++
+		if float64(binary.BigEndian.Uint64(sum[:]))/(1<<64) < cfg.ValidationFraction {
+			ds.Validation = append(ds.Validation, example)
+		} else {
+			ds.Train = append(ds.Train, example)
+		}
+	}
+	return ds
+}
+
+func (cfg DatasetConfig) selects(model string, event TelemetryEvent) bool {
+	if len(cfg.Models) > 0 && !containsFold(cfg.Models, model) {
+		return false
+	}
+	for key, value := range cfg.Tags {
+		if v, ok := event.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	if cfg.MinQuality > 0 {
+		if event.Quality == nil || event.Quality.Error != "" || event.Quality.Score < cfg.MinQuality {
+			return false
+		}
+	}
+	return true
+}
+
+// loggedChat decodes a logged chat completion and its first reply, from a
+// JSON response or a stream
+func loggedChat(entry RequestLogEntry) (openai.ChatCompletionRequest, openai.ChatCompletionMessage, bool) {
+	var request openai.ChatCompletionRequest
+	if !strings.HasSuffix(entry.URL, "/chat/completions") || entry.Truncated || entry.Response == nil ||
+		entry.Response.StatusCode != 200 || json.Unmarshal(entry.Body, &request) != nil || len(request.Messages) == 0 {
+		return request, openai.ChatCompletionMessage{}, false
+	}
+
+	var resp openai.ChatCompletionResponse
+	if body := bytes.TrimSpace(entry.Response.Body); len(body) > 0 && body[0] == '"' {
+		var stream string
+		if json.Unmarshal(body, &stream) != nil {
+			return request, openai.ChatCompletionMessage{}, false
+		}
+		var a streamAssembler
+		scanner := bufio.NewScanner(strings.NewReader(stream))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			var chunk openai.ChatCompletionStreamResponse
+			if ok && data != "[DONE]" && json.Unmarshal([]byte(data), &chunk) == nil {
+				a.add(chunk)
+			}
+		}
+		resp = a.response()
+	} else if json.Unmarshal(body, &resp) != nil {
+		return request, openai.ChatCompletionMessage{}, false
+	}
+
+	if len(resp.Choices) == 0 {
+		return request, openai.ChatCompletionMessage{}, false
+	}
+	choice := resp.Choices[0]
+	reply := choice.Message
+	if choice.FinishReason == openai.FinishReasonLength || choice.FinishReason == openai.FinishReasonContentFilter ||
+		(reply.Content == "" && len(reply.ToolCalls) == 0 && reply.FunctionCall == nil) {
+		return request, openai.ChatCompletionMessage{}, false
+	}
+	if reply.Role == "" {
+		reply.Role = openai.ChatMessageRoleAssistant
+	}
+	return request, reply, true
+}
+
+// scrubMessage redacts a copy of m's text and tool call arguments
+func scrubMessage(m openai.ChatCompletionMessage, scrub Redactor) openai.ChatCompletionMessage {
+	m.Content = scrub.Redact(m.Content)
+	if len(m.MultiContent) > 0 {
+		parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+		for i, part := range m.MultiContent {
+			part.Text = scrub.Redact(part.Text)
+			parts[i] = part
+		}
+		m.MultiContent = parts
+	}
+	if len(m.ToolCalls) > 0 {
+		calls := make([]openai.ToolCall, len(m.ToolCalls))
+		for i, call := range m.ToolCalls {
+			call.Function.Arguments = scrub.Redact(call.Function.Arguments)
+			calls[i] = call
+		}
+		m.ToolCalls = calls
+	}
+	if m.FunctionCall != nil {
+		fc := *m.FunctionCall
+		fc.Arguments = scrub.Redact(fc.Arguments)
+		m.FunctionCall = &fc
+	}
+	return m
+}
+
+// WriteFineTuningJSONL writes examples one per line, as the fine-tuning
+// API expects its training and validation files
+func WriteFineTuningJSONL(w io.Writer, examples []FineTuningExample) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, example := range examples {
+		if err := enc.Encode(example); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadRequestLogDir reads every RequestLogJSONL file WithRequestLog wrote
+// to dir, oldest first
+func ReadRequestLogDir(dir string) ([]RequestLogEntry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "requests-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var entries []RequestLogEntry
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		more, err := ReadRequestLog(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, file)
+		}
+		entries = append(entries, more...)
+	}
+	return entries, nil
+}
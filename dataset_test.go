@@ -0,0 +1,115 @@
+package langmesh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// loggedEntry is a request log entry of a chat completion for model
+func loggedEntry(id, model, prompt, reply, finish string) RequestLogEntry {
+	body, _ := json.Marshal(chatRequest(prompt))
+	body = bytes.Replace(body, []byte(`"gpt-4o-mini"`), []byte(fmt.Sprintf("%q", model)), 1)
+	resp := fmt.Sprintf(`{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":%q}]}`, reply, finish)
+	return RequestLogEntry{
+		CustomID: id,
+		Method:   "POST",
+		URL:      "/v1/chat/completions",
+		Body:     body,
+		Response: &LoggedResponse{StatusCode: 200, Body: json.RawMessage(resp)},
+	}
+}
+
+func TestBuildFineTuningDataset(t *testing.T) {
+	stream, _ := json.Marshal("data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Str\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"eamed\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	streamed := loggedEntry("r5", "gpt-4o", "stream it", "", "stop")
+	streamed.Response.Body = stream
+	failed := loggedEntry("r6", "gpt-4o", "hi", "", "")
+	failed.Response.StatusCode = 429
+
+	entries := []RequestLogEntry{
+		loggedEntry("r1", "gpt-4o", "mail me at bob@example.com", "Done", "stop"),
+		loggedEntry("r2", "gpt-4o", "mail me at bob@example.com", "Done", "stop"),
+		loggedEntry("r3", "gpt-4o", "write an essay", "Once upon", "length"),
+		loggedEntry("r4", "gpt-3.5-turbo", "hi", "Hello", "stop"),
+		streamed,
+		failed,
+		{CustomID: "r7", Method: "POST", URL: "/v1/embeddings", Response: &LoggedResponse{StatusCode: 200}},
+	}
+	ds := BuildFineTuningDataset(entries, DatasetConfig{Models: []string{"gpt-4o"}})
+	want := DatasetStats{Entries: 7, Unusable: 3, Filtered: 1, Duplicates: 1, Kept: 2}
+	if ds.Stats != want {
+		t.Errorf("stats = %+v, want %+v", ds.Stats, want)
+	}
+	if len(ds.Train) != 2 || len(ds.Validation) != 0 {
+		t.Fatalf("train = %+v, validation = %+v", ds.Train, ds.Validation)
+	}
+	first := ds.Train[0].Messages
+	if len(first) != 2 || first[0].Content != "mail me at [EMAIL]" || first[1].Role != "assistant" || first[1].Content != "Done" {
+		t.Errorf("first example = %+v", first)
+	}
+	if got := ds.Train[1].Messages[1].Content; got != "Streamed" {
+		t.Errorf("streamed reply = %q", got)
+	}
+
+	var out bytes.Buffer
+	if err := WriteFineTuningJSONL(&out, ds.Train); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"messages":[{"role":"user","content":"mail me at [EMAIL]"}`) {
+		t.Errorf("jsonl = %s", out.String())
+	}
+}
+
+func TestBuildFineTuningDatasetFilters(t *testing.T) {
+	var entries []RequestLogEntry
+	var events []TelemetryEvent
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("r%d", i)
+		entries = append(entries, loggedEntry(id, "gpt-4o", fmt.Sprintf("question %d", i), "answer", "stop"))
+		event := TelemetryEvent{RequestID: id, Tags: map[string]string{"agent": "support"}}
+		if i%2 == 0 {
+			event.Quality = &QualityScore{Score: 0.9}
+		}
+		if i%4 == 0 {
+			event.Tags["agent"] = "triage"
+		}
+		events = append(events, event)
+	}
+
+	ds := BuildFineTuningDataset(entries, DatasetConfig{
+		Events:             events,
+		Tags:               map[string]string{"agent": "support"},
+		MinQuality:         0.8,
+		ValidationFraction: 0.2,
+	})
+	// Even IDs are scored, and a quarter of all are triage
+	if ds.Stats.Kept != 50 || ds.Stats.Filtered != 150 {
+		t.Fatalf("stats = %+v", ds.Stats)
+	}
+	if n := len(ds.Validation); n < 3 || n > 20 {
+		t.Errorf("validation has %d of 50 examples, want about 10", n)
+	}
+
+	// The split is stable when more traffic is added
+	entries = append(entries, loggedEntry("new", "gpt-4o", "new", "answer", "stop"))
+	events = append(events, TelemetryEvent{RequestID: "new", Tags: map[string]string{"agent": "support"}, Quality: &QualityScore{Score: 1}})
+	again := BuildFineTuningDataset(entries, DatasetConfig{
+		Events:             events,
+		Tags:               map[string]string{"agent": "support"},
+		MinQuality:         0.8,
+		ValidationFraction: 0.2,
+	})
+	if again.Stats.Kept != 51 || len(again.Validation) < len(ds.Validation) {
+		t.Fatalf("rebuilt stats = %+v", again.Stats)
+	}
+	before, _ := json.Marshal(ds.Validation)
+	after, _ := json.Marshal(again.Validation[:len(ds.Validation)])
+	if !bytes.Equal(before, after) {
+		t.Error("validation examples moved when traffic was added")
+	}
+}
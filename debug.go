@@ -0,0 +1,174 @@
+package langmesh
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+)
+
+// DebugState is a snapshot of the resources a client holds, for tracking
+// down leaks. The client's background goroutines also carry a "langmesh"
+// pprof label naming their task, so they can be picked out of a goroutine
+// profile.
+type DebugState struct {
+	// InFlightRequests counts upstream HTTP requests whose response has not
+	// been read to the end or closed, including open streams
+	InFlightRequests int64 `json:"in_flight_requests"`
+	// Goroutines counts running background goroutines by task, such as
+	// "telemetry.flush" and "shadow"
+	Goroutines map[string]int64 `json:"goroutines"`
+	// TelemetryBuffers counts events waiting for delivery by sink
+	TelemetryBuffers map[string]int `json:"telemetry_buffers"`
+	// TelemetryScheduler is set while the telemetry flush goroutine runs;
+	// Close stops it
+	TelemetryScheduler bool `json:"telemetry_scheduler"`
+	// CoalescingCalls counts upstream calls that identical requests can
+	// still join
+	CoalescingCalls int `json:"coalescing_calls"`
+	// QualityScorings counts quality scorings in progress
+	QualityScorings int    `json:"quality_scorings"`
+	ConfigVersion   string `json:"config_version,omitempty"`
+}
+
+// debugCounters is shared by a client and its policy and config views
+type debugCounters struct {
+	inFlight atomic.Int64
+
+	mu         sync.Mutex
+	goroutines map[string]int64
+}
+
+// goroutine runs fn in a goroutine counted, and labelled for pprof, under
+// task
+func (c *Client) goroutine(task string, fn func()) {
+	d := c.debug
+	if d == nil {
+		go fn()
+		return
+	}
+	d.add(task, 1)
+	go func() {
+		defer d.add(task, -1)
+		pprof.Do(context.Background(), pprof.Labels("langmesh", task), func(context.Context) { fn() })
+	}()
+}
+
+func (d *debugCounters) add(task string, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.goroutines == nil {
+		d.goroutines = make(map[string]int64)
+	}
+	d.goroutines[task] += n
+	if d.goroutines[task] == 0 {
+		delete(d.goroutines, task)
+	}
+}
+
+// DebugState returns a snapshot of the client's resources
+func (c *Client) DebugState() DebugState {
+	s := DebugState{
+		Goroutines:       map[string]int64{},
+		TelemetryBuffers: map[string]int{},
+	}
+	if d := c.debug; d != nil {
+		s.InFlightRequests = d.inFlight.Load()
+		d.mu.Lock()
+		for task, n := range d.goroutines {
+			s.Goroutines[task] = n
+		}
+		d.mu.Unlock()
+	}
+	for _, p := range c.sinks {
+		s.TelemetryBuffers[p.name] = p.pending()
+	}
+	for _, p := range c.urlSinks.all() {
+		s.TelemetryBuffers[p.name] = p.pending()
+	}
+	s.TelemetryScheduler = c.telemetryStopped != nil && !c.telemetryStopped.Load()
+	if g := c.coalescer; g != nil {
+		g.mu.Lock()
+		s.CoalescingCalls = len(g.calls)
+		g.mu.Unlock()
+	}
+	if q := c.quality; q != nil {
+		s.QualityScorings = len(q.slots)
+	}
+	if view := c.reloader.current(); view != nil {
+		s.ConfigVersion = view.configVersion
+	}
+	return s
+}
+
+// PublishExpvar publishes DebugState as the expvar variable name, served
+// at /debug/vars alongside the runtime's memstats. Like expvar.Publish, it
+// panics if name is already in use.
+func (c *Client) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return c.DebugState() }))
+}
+
+// Close stops the telemetry flush goroutine after a final flush, and the
+// job workers once their current jobs finish. The client stays usable;
+// events recorded afterwards are delivered as they arrive, and jobs
+// submitted afterwards stay queued. Close does not wait for deliveries or
+// jobs in progress. It closes the WithRequestLog file; requests logged
+// afterwards start a new one.
+func (c *Client) Close() error {
+	c.stopTelemetry()
+	c.stopJobs()
+	if c.requestLog != nil {
+		return c.requestLog.close()
+	}
+	return nil
+}
+
+func (p *sinkPipeline) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.buffer.events)
+}
+
+// inFlightTransport counts upstream requests until their response body is
+// read to the end or closed
+type inFlightTransport struct {
+	base  http.RoundTripper
+	count *atomic.Int64
+}
+
+func (t inFlightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.count.Add(-1)
+		return resp, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, count: t.count}
+	return resp, nil
+}
+
+type inFlightBody struct {
+	io.ReadCloser
+	count *atomic.Int64
+	once  sync.Once
+}
+
+func (b *inFlightBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *inFlightBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *inFlightBody) done() {
+	b.once.Do(func() { b.count.Add(-1) })
+}
@@ -0,0 +1,76 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDebugStateInFlight(t *testing.T) {
+	srv := newStreamServer(t, "Hello", "world")
+	client := NewClient("test-key", WithBaseURL(srv.URL))
+	stream, err := client.CreateChatCompletionStream(context.Background(), chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.DebugState().InFlightRequests; got != 1 {
+		t.Errorf("open stream: in flight = %d", got)
+	}
+	stream.Close()
+	if got := client.DebugState().InFlightRequests; got != 0 {
+		t.Errorf("closed stream: in flight = %d", got)
+	}
+
+	chat, _ := newChatServer(t, "ok")
+	client = NewClient("test-key", WithBaseURL(chat.URL))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.DebugState().InFlightRequests; got != 0 {
+		t.Errorf("after completion: in flight = %d", got)
+	}
+}
+
+func TestDebugStateTelemetry(t *testing.T) {
+	client := NewClient("test-key", WithTelemetrySink("slow", TelemetrySinkFunc(func(context.Context, []TelemetryEvent) error {
+		return nil
+	})), WithFlushSchedule(FlushSchedule{MinInterval: time.Hour, MaxLatency: time.Hour}))
+	client.recordTelemetry(TelemetryEvent{RequestID: "r1"})
+
+	state := client.DebugState()
+	if !state.TelemetryScheduler || state.Goroutines["telemetry.flush"] != 1 || state.TelemetryBuffers["slow"] != 1 {
+		t.Fatalf("state = %+v", state)
+	}
+
+	client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state = client.DebugState()
+		if len(state.Goroutines) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines after Close = %v", state.Goroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if state.TelemetryScheduler || state.TelemetryBuffers["slow"] != 0 {
+		t.Errorf("state after Close = %+v", state)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	client := NewClient("test-key")
+	name := fmt.Sprintf("langmesh_test_%d", time.Now().UnixNano())
+	client.PublishExpvar(name)
+	var state DebugState
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Goroutines == nil {
+		t.Errorf("state = %+v", state)
+	}
+}
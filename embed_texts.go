@@ -0,0 +1,238 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultEmbedBatchSize is the most inputs OpenAI takes in one
+	// embeddings request
+	DefaultEmbedBatchSize = 2048
+	// DefaultEmbedBatchTokens is the most tokens OpenAI takes in one
+	// embeddings request
+	DefaultEmbedBatchTokens = 300000
+	// DefaultEmbedConcurrency is how many batches EmbedTexts sends at once
+	// unless told otherwise
+	DefaultEmbedConcurrency = 4
+	// DefaultEmbedRetries is how many times EmbedTexts retries a failed
+	// batch unless told otherwise
+	DefaultEmbedRetries = 2
+)
+
+// EmbedOptions configures EmbedTexts. Zero fields take the defaults.
+type EmbedOptions struct {
+	// BatchSize caps the inputs in one request
+	BatchSize int
+	// BatchTokens caps the estimated tokens in one request
+	BatchTokens int
+	// Concurrency caps the requests in flight
+	Concurrency int
+	// Retries is how many times a batch failing with a rate limit, server
+	// or network error is retried, waiting RetryBackoff, doubled each
+	// time, in between; a negative value disables retries
+	Retries      int
+	RetryBackoff time.Duration
+	// Dimensions shortens the vectors, for models that support it
+	Dimensions int
+}
+
+// EmbedResult is the outcome of EmbedTexts
+type EmbedResult struct {
+	// Embeddings holds one vector per input, in input order
+	Embeddings [][]float32
+	// PromptTokens and CostUSD total every batch
+	PromptTokens int
+	CostUSD      float64
+	// Batches is the number of requests the inputs were split into
+	Batches int
+}
+
+// EmbedTexts embeds any number of texts, splitting them into batches
+// within the API's per-request limits and sending those concurrently.
+// Failed batches are retried on their own; if one still fails, the
+// vectors of the batches that succeeded are returned with the error. Each
+// batch goes through CreateEmbeddings, so it is recorded in telemetry and
+// chunked by WithEmbeddingChunking.
+func (c *Client) EmbedTexts(
+	ctx context.Context,
+	model openai.EmbeddingModel,
+	texts []string,
+	opts EmbedOptions,
+) (EmbedResult, error) {
+	opts = opts.withDefaults()
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			return EmbedResult{}, fmt.Errorf("langmesh: embedding input %d is empty", i)
+		}
+	}
+
+	batches := embedBatches(texts, opts.BatchSize, opts.BatchTokens)
+	result := EmbedResult{Embeddings: make([][]float32, len(texts)), Batches: len(batches)}
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	next := make(chan [2]int)
+	for w := 0; w < min(opts.Concurrency, len(batches)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for span := range next {
+				resp, err := c.embedBatch(ctx, model, texts[span[0]:span[1]], opts)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("langmesh: embedding inputs %d-%d: %w", span[0], span[1]-1, err)
+					}
+				} else {
+					for _, d := range resp.Data {
+						if d.Index >= 0 && span[0]+d.Index < span[1] {
+							result.Embeddings[span[0]+d.Index] = d.Embedding
+						}
+					}
+					result.PromptTokens += resp.Usage.PromptTokens
+					result.CostUSD = addUSD(result.CostUSD, c.estimateCost(string(model), resp.Usage.PromptTokens, 0))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, span := range batches {
+		next <- span
+	}
+	close(next)
+	wg.Wait()
+	return result, firstErr
+}
+
+func (o EmbedOptions) withDefaults() EmbedOptions {
+	if o.BatchSize <= 0 || o.BatchSize > DefaultEmbedBatchSize {
+		o.BatchSize = DefaultEmbedBatchSize
+	}
+	if o.BatchTokens <= 0 {
+		o.BatchTokens = DefaultEmbedBatchTokens
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultEmbedConcurrency
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultEmbedRetries
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = time.Second
+	}
+	return o
+}
+
+// embedBatches splits texts into [start, end) spans within both limits.
+// A text over the token limit gets a batch of its own.
+func embedBatches(texts []string, size, tokens int) [][2]int {
+	var spans [][2]int
+	start, total := 0, 0
+	for i, text := range texts {
+		n := estimateTokens(text)
+		if i > start && (i-start >= size || total+n > tokens) {
+			spans = append(spans, [2]int{start, i})
+			start, total = i, 0
+		}
+		total += n
+	}
+	if start < len(texts) {
+		spans = append(spans, [2]int{start, len(texts)})
+	}
+	return spans
+}
+
+func (c *Client) embedBatch(
+	ctx context.Context,
+	model openai.EmbeddingModel,
+	texts []string,
+	opts EmbedOptions,
+) (openai.EmbeddingResponse, error) {
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input:      texts,
+			Model:      model,
+			Dimensions: opts.Dimensions,
+		})
+		if err == nil || attempt >= opts.Retries || !retryableEmbedError(err) {
+			return resp, err
+		}
+		c.log(ctx, LogRetry, "retrying embedding batch", "inputs", len(texts), "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		}
+		backoff *= 2
+	}
+}
+
+// retryableEmbedError reports whether a batch failing with err may succeed
+// if sent again
+func retryableEmbedError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrGuardRejected) || errors.Is(err, ErrMisconfigured) {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests || reqErr.HTTPStatusCode >= 500
+	}
+	return true
+}
+
+// ChunkText splits text on whitespace into chunks of about size estimated
+// tokens, each starting with the last overlap tokens of the one before, for
+// embedding long documents
+func ChunkText(text string, size, overlap int) []string {
+	if size <= 0 {
+		return nil
+	}
+	overlap = min(max(overlap, 0), size/2)
+	words := strings.Fields(text)
+	var chunks []string
+	for start := 0; start < len(words); {
+		end, tokens := start, 0
+		for end < len(words) {
+			n := estimateTokens(words[end]) + 1
+			if end > start && tokens+n > size {
+				break
+			}
+			tokens += n
+			end++
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+		// Step back over enough words to cover the overlap, always moving on
+		back, kept := end, 0
+		for back > start+1 {
+			n := estimateTokens(words[back-1]) + 1
+			if kept+n > overlap {
+				break
+			}
+			kept += n
+			back--
+		}
+		start = back
+	}
+	return chunks
+}
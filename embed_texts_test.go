@@ -0,0 +1,105 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestEmbedTextsBatchesAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.EmbeddingRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		inputs, _ := req.Input.([]any)
+		mu.Lock()
+		flaky := !failed && inputs[0] == "text 3"
+		failed = failed || flaky
+		if !flaky {
+			batches = append(batches, len(inputs))
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if flaky {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"try again","type":"server_error"}}`)
+			return
+		}
+		resp := openai.EmbeddingResponse{Model: openai.SmallEmbedding3}
+		// Reply out of order; each vector holds its input's number
+		for i := len(inputs) - 1; i >= 0; i-- {
+			n, _ := strconv.Atoi(strings.TrimPrefix(inputs[i].(string), "text "))
+			resp.Data = append(resp.Data, openai.Embedding{Embedding: []float32{float32(n)}, Index: i})
+		}
+		resp.Usage.PromptTokens = 2 * len(inputs)
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	texts := make([]string, 8)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+	}
+	result, err := client.EmbedTexts(context.Background(), openai.SmallEmbedding3, texts, EmbedOptions{
+		BatchSize:    3,
+		Concurrency:  2,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vec := range result.Embeddings {
+		if len(vec) != 1 || vec[0] != float32(i) {
+			t.Errorf("embedding %d = %v", i, vec)
+		}
+	}
+	if result.Batches != 3 || result.PromptTokens != 16 || result.CostUSD <= 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if !failed || len(rec.all()) != 4 {
+		t.Errorf("failed %v, %d events; want the failed batch retried", failed, len(rec.all()))
+	}
+}
+
+func TestEmbedBatchesRespectTokenLimit(t *testing.T) {
+	texts := []string{strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 400), "d"}
+	got := embedBatches(texts, 10, 25)
+	want := [][2]int{{0, 2}, {2, 3}, {3, 4}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	words := make([]string, 20)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%02d", i)
+	}
+	// Each word estimates to one token plus one for its space
+	chunks := ChunkText(strings.Join(words, " "), 10, 4)
+	if len(chunks) != 6 {
+		t.Fatalf("chunks = %q", chunks)
+	}
+	if chunks[0] != "w00 w01 w02 w03 w04" || !strings.HasPrefix(chunks[1], "w03 w04 w05") {
+		t.Errorf("chunks = %q", chunks)
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "w19") {
+		t.Errorf("last chunk %q", last)
+	}
+	if ChunkText("", 10, 2) != nil {
+		t.Error("empty text produced chunks")
+	}
+}
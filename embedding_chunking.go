@@ -0,0 +1,165 @@
+package langmesh
+
+import (
+	"math"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultEmbeddingMaxTokens = 8191
+
+// ChunkPooling selects how vectors for a split input are returned
+type ChunkPooling string
+
+const (
+	// ChunkPoolingMean averages chunk vectors into one normalized vector per input
+	ChunkPoolingMean ChunkPooling = "mean"
+	// ChunkPoolingNone returns one vector per chunk, each carrying the Index of
+	// the input it came from
+	ChunkPoolingNone ChunkPooling = "none"
+)
+
+// EmbeddingChunking configures transparent splitting of oversized embedding inputs
+type EmbeddingChunking struct {
+	// MaxTokens is the per-input limit of the embedding model (default 8191)
+	MaxTokens int
+	// Pooling defaults to ChunkPoolingMean
+	Pooling ChunkPooling
+}
+
+// WithEmbeddingChunking splits string inputs that exceed the model's token
+// limit into chunks instead of letting the request fail. Token counts are
+// estimated, so leave headroom below the model's hard limit.
+func WithEmbeddingChunking(cfg EmbeddingChunking) Option {
+	return func(c *Client) {
+		if cfg.MaxTokens <= 0 {
+			cfg.MaxTokens = defaultEmbeddingMaxTokens
+		}
+		if cfg.Pooling == "" {
+			cfg.Pooling = ChunkPoolingMean
+		}
+		c.embeddingChunking = &cfg
+	}
+}
+
+// chunkEmbeddingInputs rewrites oversized string inputs into chunks. owners
+// maps each chunk to its original input index and is nil when nothing was split.
+func (c *Client) chunkEmbeddingInputs(conv openai.EmbeddingRequestConverter) (openai.EmbeddingRequestConverter, []int) {
+	cfg := c.embeddingChunking
+	if cfg == nil {
+		return conv, nil
+	}
+	req := conv.Convert()
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []string:
+		inputs = in
+	default:
+		return conv, nil
+	}
+
+	split := false
+	chunks := make([]string, 0, len(inputs))
+	owners := make([]int, 0, len(inputs))
+	for i, text := range inputs {
+		if estimateTokens(text) <= cfg.MaxTokens {
+			chunks = append(chunks, text)
+			owners = append(owners, i)
+			continue
+		}
+		split = true
+		for _, chunk := range splitByTokens(text, cfg.MaxTokens) {
+			chunks = append(chunks, chunk)
+			owners = append(owners, i)
+		}
+	}
+	if !split {
+		return conv, nil
+	}
+	req.Input = chunks
+	return req, owners
+}
+
+// poolEmbeddings maps chunk vectors back onto the caller's inputs
+func (c *Client) poolEmbeddings(resp openai.EmbeddingResponse, owners []int) openai.EmbeddingResponse {
+	for i := range resp.Data {
+		if resp.Data[i].Index < len(owners) {
+			resp.Data[i].Index = owners[resp.Data[i].Index]
+		}
+	}
+	if c.embeddingChunking.Pooling != ChunkPoolingMean {
+		return resp
+	}
+
+	var pooled []openai.Embedding
+	for _, d := range resp.Data {
+		if n := len(pooled); n > 0 && pooled[n-1].Index == d.Index {
+			last := &pooled[n-1]
+			for j := range last.Embedding {
+				if j < len(d.Embedding) {
+					last.Embedding[j] += d.Embedding[j]
+				}
+			}
+			continue
+		}
+		vec := make([]float32, len(d.Embedding))
+		copy(vec, d.Embedding)
+		pooled = append(pooled, openai.Embedding{Object: d.Object, Embedding: vec, Index: d.Index})
+	}
+	for i := range pooled {
+		normalize(pooled[i].Embedding)
+	}
+	resp.Data = pooled
+	return resp
+}
+
+func normalize(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
+
+// splitByTokens breaks text on whitespace into pieces of at most maxTokens
+// estimated tokens, hard-cutting words that are longer than a whole chunk
+func splitByTokens(text string, maxTokens int) []string {
+	maxChars := maxTokens * 4
+	var chunks []string
+	var b strings.Builder
+	for _, word := range strings.Fields(text) {
+		for len(word) > maxChars {
+			if b.Len() > 0 {
+				chunks = append(chunks, b.String())
+				b.Reset()
+			}
+			cut := len(truncate(word, maxChars))
+			if cut == 0 {
+				cut = maxChars
+			}
+			chunks = append(chunks, word[:cut])
+			word = word[cut:]
+		}
+		if b.Len() > 0 && b.Len()+1+len(word) > maxChars {
+			chunks = append(chunks, b.String())
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(word)
+	}
+	if b.Len() > 0 {
+		chunks = append(chunks, b.String())
+	}
+	return chunks
+}
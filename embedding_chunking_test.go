@@ -0,0 +1,84 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newEmbeddingServer returns a unit vector along axis i for the i-th input
+func newEmbeddingServer(t *testing.T, inputs *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		*inputs = req.Input
+		resp := openai.EmbeddingResponse{Model: openai.SmallEmbedding3}
+		for i := range req.Input {
+			vec := make([]float32, 4)
+			vec[i%4] = 1
+			resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Embedding: vec, Index: i})
+		}
+		resp.Usage.PromptTokens = 7
+		resp.Usage.TotalTokens = 7
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEmbeddingChunkingMeanPool(t *testing.T) {
+	var sent []string
+	srv := newEmbeddingServer(t, &sent)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec),
+		WithEmbeddingChunking(EmbeddingChunking{MaxTokens: 3}))
+
+	long := strings.Repeat("word ", 4) // 20 chars, two 12-char chunks
+	resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+		Input: []string{"short", long},
+		Model: openai.SmallEmbedding3,
+	})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 chunks upstream, got %q", sent)
+	}
+	if len(resp.Data) != 2 || resp.Data[1].Index != 1 {
+		t.Fatalf("expected one pooled vector per input, got %+v", resp.Data)
+	}
+	v := resp.Data[1].Embedding
+	if v[1] < 0.70 || v[1] > 0.71 || v[2] < 0.70 || v[2] > 0.71 {
+		t.Errorf("pooled vector not mean-normalized: %v", v)
+	}
+	if events := rec.all(); len(events) != 1 || events[0].ChunkCount != 3 {
+		t.Errorf("chunk count not recorded: %+v", events)
+	}
+}
+
+func TestEmbeddingChunkingPerChunk(t *testing.T) {
+	var sent []string
+	srv := newEmbeddingServer(t, &sent)
+	client := NewClient("test-key", WithBaseURL(srv.URL),
+		WithEmbeddingChunking(EmbeddingChunking{MaxTokens: 3, Pooling: ChunkPoolingNone}))
+
+	resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+		Input: []string{strings.Repeat("word ", 4)},
+		Model: openai.SmallEmbedding3,
+	})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Index != 0 || resp.Data[1].Index != 0 {
+		t.Errorf("expected two chunk vectors for input 0, got %+v", resp.Data)
+	}
+}
@@ -0,0 +1,126 @@
+package langmesh
+
+import (
+	"context"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// CreateEmbeddings wraps the original method with telemetry
+func (c *Client) CreateEmbeddings(
+	ctx context.Context,
+	conv openai.EmbeddingRequestConverter,
+) (openai.EmbeddingResponse, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateEmbeddings(ctx, conv)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointEmbeddings)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	conv, owners := c.chunkEmbeddingInputs(conv)
+	var resp openai.EmbeddingResponse
+	embedding := conv.Convert()
+	err := c.checkStrict(string(embedding.Model), false)
+	if err == nil {
+		err = c.checkCostGuards(ctx, string(embedding.Model), c.countTokens(string(embedding.Model), inputText(embedding.Input)), 0)
+	}
+	if err == nil {
+		resp, err = c.Client.CreateEmbeddings(ctx, conv)
+		err = upstreamError(ctx, err)
+	}
+	if err == nil && owners != nil {
+		resp = c.poolEmbeddings(resp, owners)
+	}
+
+	if c.instrumented(ctx) {
+		model := string(conv.Convert().Model)
+		event := c.newEvent(ctx, requestID, "embeddings", model, startTime, err)
+		event.ChunkCount = len(owners)
+		if err == nil {
+			event.TokenUsage = TokenUsage{
+				PromptTokens: resp.Usage.PromptTokens,
+				TotalTokens:  resp.Usage.TotalTokens,
+			}
+			event.CostEstimateUSD = c.estimateCost(model, resp.Usage.PromptTokens, 0)
+		}
+		c.recordTelemetry(event)
+	}
+
+	return resp, err
+}
+
+// CreateImage wraps the original method with telemetry
+func (c *Client) CreateImage(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateImage(ctx, request)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointImages)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	var resp openai.ImageResponse
+	err := c.configErr
+	if err == nil {
+		resp, err = c.Client.CreateImage(ctx, request)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		c.recordTelemetry(c.newEvent(ctx, requestID, "images.generations", request.Model, startTime, err))
+	}
+
+	return resp, err
+}
+
+// CreateTranscription wraps the original method with telemetry
+func (c *Client) CreateTranscription(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateTranscription(ctx, request)
+	}
+	return c.audioCall(ctx, "audio.transcriptions", request, c.Client.CreateTranscription)
+}
+
+// CreateTranslation wraps the original method with telemetry
+func (c *Client) CreateTranslation(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateTranslation(ctx, request)
+	}
+	return c.audioCall(ctx, "audio.translations", request, c.Client.CreateTranslation)
+}
+
+func (c *Client) audioCall(
+	ctx context.Context,
+	endpoint string,
+	request openai.AudioRequest,
+	call func(context.Context, openai.AudioRequest) (openai.AudioResponse, error),
+) (openai.AudioResponse, error) {
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointAudio)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	var resp openai.AudioResponse
+	err := c.configErr
+	if err == nil {
+		resp, err = call(ctx, request)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		c.recordTelemetry(c.newEvent(ctx, requestID, endpoint, request.Model, startTime, err))
+	}
+
+	return resp, err
+}
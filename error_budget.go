@@ -0,0 +1,176 @@
+package langmesh
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const errorBudgetBuckets = 60
+
+// ErrorBudgetConfig defines a success-rate objective tracked per model over a
+// rolling window
+type ErrorBudgetConfig struct {
+	// SLO is the target success rate, e.g. 0.99
+	SLO float64
+	// Window is the rolling window the SLO is measured over (default 1h)
+	Window time.Duration
+	// BurnRateThreshold triggers OnBurn when the observed error rate exceeds
+	// this multiple of the allowed rate (default 2)
+	BurnRateThreshold float64
+	// MinRequests avoids alerting on tiny samples (default 20)
+	MinRequests int
+	// OnBurn is called once each time a model crosses the threshold. It runs
+	// on the request goroutine and must not block.
+	OnBurn func(ErrorBudgetStatus)
+}
+
+// ErrorBudgetStatus is the current error budget position for one model
+type ErrorBudgetStatus struct {
+	Model       string
+	Requests    int
+	Errors      int
+	SuccessRate float64
+	// BurnRate is the error rate divided by the rate the SLO allows; 1 means
+	// the budget is being consumed exactly as fast as the window allows
+	BurnRate float64
+	// BudgetRemaining is the fraction of the window's error budget left,
+	// clamped at zero
+	BudgetRemaining float64
+	Exhausted       bool
+}
+
+// WithErrorBudget tracks per-model error budgets, exposed via Client.Stats
+func WithErrorBudget(cfg ErrorBudgetConfig) Option {
+	return func(c *Client) {
+		if cfg.Window <= 0 {
+			cfg.Window = time.Hour
+		}
+		if cfg.BurnRateThreshold <= 0 {
+			cfg.BurnRateThreshold = 2
+		}
+		if cfg.MinRequests <= 0 {
+			cfg.MinRequests = 20
+		}
+		c.errorBudgets = &errorBudgetTracker{
+			client: c,
+			cfg:    cfg,
+			models: make(map[string]*rollingCounts),
+			now:    time.Now,
+		}
+		c.observers = append(c.observers, c.errorBudgets)
+	}
+}
+
+type errorBudgetTracker struct {
+	client *Client
+	cfg    ErrorBudgetConfig
+	mu     sync.Mutex
+	models map[string]*rollingCounts
+	now    func() time.Time
+}
+
+// rollingCounts keeps request and error counts in fixed time buckets
+type rollingCounts struct {
+	requests [errorBudgetBuckets]int
+	errors   [errorBudgetBuckets]int
+	slots    [errorBudgetBuckets]int64
+	burning  bool
+}
+
+func (t *errorBudgetTracker) bucket(now time.Time) int64 {
+	return now.UnixNano() / int64(t.cfg.Window/errorBudgetBuckets)
+}
+
+func (t *errorBudgetTracker) observe(event TelemetryEvent) {
+	if event.ErrorClass == "GuardRejected" || event.ErrorClass == "InvalidRequest" {
+		// Requests rejected client-side never reached the model
+		return
+	}
+	if event.Heartbeat {
+		return
+	}
+
+	now := t.now()
+	slot := t.bucket(now)
+	idx := int(slot % errorBudgetBuckets)
+
+	t.mu.Lock()
+	counts, ok := t.models[event.Model]
+	if !ok {
+		counts = &rollingCounts{}
+		t.models[event.Model] = counts
+	}
+	if counts.slots[idx] != slot {
+		counts.slots[idx] = slot
+		counts.requests[idx] = 0
+		counts.errors[idx] = 0
+	}
+	counts.requests[idx]++
+	if event.Status == "error" {
+		counts.errors[idx]++
+	}
+	status := t.status(event.Model, counts, slot)
+	fire := false
+	if status.Requests >= t.cfg.MinRequests && status.BurnRate >= t.cfg.BurnRateThreshold {
+		fire = !counts.burning
+		counts.burning = true
+	} else {
+		counts.burning = false
+	}
+	t.mu.Unlock()
+
+	if !fire {
+		return
+	}
+	t.client.log(context.Background(), LogBudget, "error budget burning",
+		"model", status.Model, "burn_rate", status.BurnRate, "budget_remaining", status.BudgetRemaining)
+	if t.cfg.OnBurn != nil {
+		t.cfg.OnBurn(status)
+	}
+}
+
+func (t *errorBudgetTracker) status(model string, counts *rollingCounts, current int64) ErrorBudgetStatus {
+	s := ErrorBudgetStatus{Model: model}
+	for i := 0; i < errorBudgetBuckets; i++ {
+		if current-counts.slots[i] >= errorBudgetBuckets {
+			continue
+		}
+		s.Requests += counts.requests[i]
+		s.Errors += counts.errors[i]
+	}
+	if s.Requests == 0 {
+		s.SuccessRate = 1
+		s.BudgetRemaining = 1
+		return s
+	}
+	errorRate := float64(s.Errors) / float64(s.Requests)
+	s.SuccessRate = 1 - errorRate
+	allowed := 1 - t.cfg.SLO
+	if allowed <= 0 {
+		if s.Errors > 0 {
+			s.Exhausted = true
+		} else {
+			s.BudgetRemaining = 1
+		}
+		return s
+	}
+	s.BurnRate = errorRate / allowed
+	s.BudgetRemaining = 1 - s.BurnRate
+	if s.BudgetRemaining <= 0 {
+		s.BudgetRemaining = 0
+		s.Exhausted = true
+	}
+	return s
+}
+
+func (t *errorBudgetTracker) snapshot() map[string]ErrorBudgetStatus {
+	current := t.bucket(t.now())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]ErrorBudgetStatus, len(t.models))
+	for model, counts := range t.models {
+		out[model] = t.status(model, counts, current)
+	}
+	return out
+}
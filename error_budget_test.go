@@ -0,0 +1,39 @@
+package langmesh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorBudgetBurnCallback(t *testing.T) {
+	var alerts []ErrorBudgetStatus
+	client := NewClient("test-key", WithErrorBudget(ErrorBudgetConfig{
+		SLO:         0.9,
+		Window:      time.Minute,
+		MinRequests: 10,
+		OnBurn:      func(s ErrorBudgetStatus) { alerts = append(alerts, s) },
+	}))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.errorBudgets.now = func() time.Time { return now }
+
+	for i := 0; i < 8; i++ {
+		client.errorBudgets.observe(TelemetryEvent{Model: "gpt-4o", Status: "success"})
+	}
+	for i := 0; i < 4; i++ {
+		client.errorBudgets.observe(TelemetryEvent{Model: "gpt-4o", Status: "error"})
+	}
+	client.errorBudgets.observe(TelemetryEvent{Model: "gpt-4o", Status: "error", ErrorClass: "GuardRejected"})
+
+	if len(alerts) != 1 {
+		t.Fatalf("expected one burn alert, got %d", len(alerts))
+	}
+	status := client.Stats().ErrorBudgets["gpt-4o"]
+	if status.Requests != 12 || status.Errors != 4 || !status.Exhausted {
+		t.Errorf("status = %+v", status)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if s := client.Stats().ErrorBudgets["gpt-4o"]; s.Requests != 0 || s.BudgetRemaining != 1 {
+		t.Errorf("window did not roll: %+v", s)
+	}
+}
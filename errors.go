@@ -0,0 +1,128 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Upstream failures callers commonly handle, matched via errors.Is
+var (
+	ErrRateLimited           = errors.New("langmesh: rate limited")
+	ErrContextLengthExceeded = errors.New("langmesh: context length exceeded")
+	ErrInvalidAPIKey         = errors.New("langmesh: invalid API key")
+	ErrContentFiltered       = errors.New("langmesh: content filtered")
+	ErrServerOverloaded      = errors.New("langmesh: server overloaded")
+)
+
+// errorClasses names each kind of upstream failure in telemetry
+var errorClasses = map[error]string{
+	ErrRateLimited:           "RateLimited",
+	ErrContextLengthExceeded: "ContextLengthExceeded",
+	ErrInvalidAPIKey:         "InvalidAPIKey",
+	ErrContentFiltered:       "ContentFiltered",
+	ErrServerOverloaded:      "ServerOverloaded",
+}
+
+// UpstreamError is returned for an API failure of a known kind. It
+// matches its kind via errors.Is, and unwraps to the *openai.APIError or
+// *openai.RequestError it was built from.
+type UpstreamError struct {
+	// Kind is one of ErrRateLimited, ErrContextLengthExceeded,
+	// ErrInvalidAPIKey, ErrContentFiltered or ErrServerOverloaded
+	Kind       error
+	StatusCode int
+	// Code and Type are the API's error code and type, when it sent them
+	Code string
+	Type string
+	// RetryAfter is how long the API asked to wait before retrying; zero
+	// if it did not say
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the error's Kind
+func (e *UpstreamError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// upstreamError returns err as an *UpstreamError if it is an API failure
+// of a known kind, taking RetryAfter from the call's last response
+func upstreamError(ctx context.Context, err error) error {
+	var typed *UpstreamError
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	kind, status, code, errType := classifyUpstream(err)
+	if kind == nil {
+		return err
+	}
+	typed = &UpstreamError{Kind: kind, StatusCode: status, Code: code, Type: errType, Err: err}
+	if kind == ErrRateLimited || kind == ErrServerOverloaded {
+		typed.RetryAfter = retryAfter(callStateFrom(ctx).responseHeader())
+	}
+	return typed
+}
+
+// classifyUpstream returns the kind of API failure err is, or nil, with
+// the failure's status, code and type
+func classifyUpstream(err error) (kind error, status int, code, errType string) {
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status, errType = apiErr.HTTPStatusCode, apiErr.Type
+		code, _ = apiErr.Code.(string)
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		return nil, 0, "", ""
+	}
+	switch {
+	case code == "context_length_exceeded":
+		kind = ErrContextLengthExceeded
+	case code == "content_filter" || code == "content_policy_violation":
+		kind = ErrContentFiltered
+	case code == "invalid_api_key" || status == http.StatusUnauthorized:
+		kind = ErrInvalidAPIKey
+	// An exhausted quota is a billing problem, not one waiting fixes
+	case status == http.StatusTooManyRequests && code != "insufficient_quota":
+		kind = ErrRateLimited
+	case status == http.StatusServiceUnavailable || status == 529:
+		kind = ErrServerOverloaded
+	}
+	return kind, status, code, errType
+}
+
+// retryAfter reads the wait a response asked for from its Retry-After
+// header, in seconds or as a date, or else from its rate limit resets
+func retryAfter(h http.Header) time.Duration {
+	if h == nil {
+		return 0
+	}
+	if value := h.Get("Retry-After"); value != "" {
+		if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0)
+		}
+	}
+	if info := parseRateLimit(h); info != nil {
+		return max(info.ResetRequests, info.ResetTokens)
+	}
+	return 0
+}
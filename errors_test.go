@@ -0,0 +1,81 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestUpstreamErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		kind       error
+		class      string
+	}{
+		{"rate limit", 429, "7", `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`, ErrRateLimited, "RateLimited"},
+		{"context", 400, "", `{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`, ErrContextLengthExceeded, "ContextLengthExceeded"},
+		{"api key", 401, "", `{"error":{"message":"bad key","type":"invalid_request_error","code":"invalid_api_key"}}`, ErrInvalidAPIKey, "InvalidAPIKey"},
+		{"content", 400, "", `{"error":{"message":"flagged","type":"invalid_request_error","code":"content_filter"}}`, ErrContentFiltered, "ContentFiltered"},
+		{"overloaded", 503, "", `{"error":{"message":"busy","type":"server_error"}}`, ErrServerOverloaded, "ServerOverloaded"},
+		{"quota", 429, "", `{"error":{"message":"no credit","type":"insufficient_quota","code":"insufficient_quota"}}`, nil, "Error"},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+		rec := &eventRecorder{}
+		client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+		_, err := client.CreateChatCompletion(context.Background(), chatRequest("hi"))
+		srv.Close()
+
+		var upstream *UpstreamError
+		if tc.kind == nil {
+			if errors.As(err, &upstream) {
+				t.Errorf("%s: err = %v, want no kind", tc.name, err)
+			}
+		} else if !errors.Is(err, tc.kind) || !errors.As(err, &upstream) || upstream.StatusCode != tc.status {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.kind)
+		}
+		var apiErr *openai.APIError
+		if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != tc.status {
+			t.Errorf("%s: APIError not unwrapped from %v", tc.name, err)
+		}
+		if class := rec.all()[0].ErrorClass; class != tc.class {
+			t.Errorf("%s: error class = %q, want %q", tc.name, class, tc.class)
+		}
+		if tc.kind == ErrRateLimited && upstream.RetryAfter != 7*time.Second {
+			t.Errorf("RetryAfter = %v", upstream.RetryAfter)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	for _, tc := range []struct {
+		header http.Header
+		min    time.Duration
+		max    time.Duration
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second, 3 * time.Second},
+		{http.Header{"Retry-After": {at}}, 58 * time.Second, time.Minute},
+		{http.Header{"X-Ratelimit-Limit-Requests": {"100"}, "X-Ratelimit-Reset-Requests": {"1.5s"}}, 1500 * time.Millisecond, 1500 * time.Millisecond},
+		{nil, 0, 0},
+	} {
+		if got := retryAfter(tc.header); got < tc.min || got > tc.max {
+			t.Errorf("retryAfter(%v) = %v", tc.header, got)
+		}
+	}
+}
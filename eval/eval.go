@@ -0,0 +1,209 @@
+// Package eval runs datasets of prompts through models offline and scores
+// the answers, for comparing models, prompts and settings before they
+// reach production
+//
+// Usage:
+//
+//	dataset, err := eval.LoadDataset("testdata/support.jsonl")
+//	runner := &eval.Runner{
+//		Client:  client, // any langmesh.ChatClient
+//		Models:  []string{"gpt-4o", "gpt-4o-mini"},
+//		Graders: []eval.Grader{eval.ExactMatch{IgnoreCase: true}},
+//	}
+//	report, err := runner.Run(ctx, dataset)
+//	report.WriteText(os.Stdout)
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultConcurrency is how many cases Runner runs at once
+const DefaultConcurrency = 4
+
+// Case is one prompt and the criteria its answer is graded against
+type Case struct {
+	Name string `json:"name"`
+	// Prompt is sent as a user message after System; set Messages instead
+	// for a full conversation
+	Prompt   string                         `json:"prompt,omitempty"`
+	System   string                         `json:"system,omitempty"`
+	Messages []openai.ChatCompletionMessage `json:"messages,omitempty"`
+
+	// Expected is the reference answer for ExactMatch, EmbeddingSimilarity
+	// and Judge
+	Expected string `json:"expected,omitempty"`
+	// Pattern is the regular expression Regex matches when it has none of
+	// its own
+	Pattern string `json:"pattern,omitempty"`
+	// Rubric replaces the Judge's rubric for this case
+	Rubric string `json:"rubric,omitempty"`
+}
+
+// messages returns the conversation sent for the case
+func (c Case) messages() []openai.ChatCompletionMessage {
+	if len(c.Messages) > 0 {
+		return c.Messages
+	}
+	var messages []openai.ChatCompletionMessage
+	if c.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: c.System})
+	}
+	return append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: c.Prompt})
+}
+
+// Dataset is a named list of cases
+type Dataset struct {
+	Name  string
+	Cases []Case
+}
+
+// LoadDataset reads a JSON Lines file of cases, naming the dataset after
+// the file
+func LoadDataset(path string) (Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer f.Close()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return ParseDataset(name, f)
+}
+
+// ParseDataset reads JSON Lines of cases from r. Blank lines are skipped
+// and unnamed cases are named by line number.
+func ParseDataset(name string, r io.Reader) (Dataset, error) {
+	d := Dataset{Name: name}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return Dataset{}, fmt.Errorf("langmesh: dataset %s line %d: %w", name, line, err)
+		}
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("line-%d", line)
+		}
+		d.Cases = append(d.Cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return Dataset{}, fmt.Errorf("langmesh: dataset %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// Runner sends each case of a dataset to each model and grades the answers
+type Runner struct {
+	// Client makes the calls. The report includes estimated costs if it is
+	// a langmesh.CostEstimator, and with a *langmesh.Client every call is in
+	// its telemetry as usual.
+	Client  langmesh.ChatClient
+	Models  []string
+	Graders []Grader
+
+	Temperature float32
+	MaxTokens   int
+	// Concurrency is how many cases run at once (default
+	// DefaultConcurrency)
+	Concurrency int
+}
+
+// Run evaluates d against every model. Failed calls and grader errors are
+// recorded on their cases; Run itself fails only for an unusable runner or
+// a cancelled ctx.
+func (r *Runner) Run(ctx context.Context, d Dataset) (*Report, error) {
+	if r.Client == nil || len(r.Models) == 0 {
+		return nil, errors.New("langmesh: eval runner needs a client and at least one model")
+	}
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	report := &Report{Dataset: d.Name, StartedAt: time.Now()}
+	results := make([][]CaseResult, len(r.Models))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for m, model := range r.Models {
+		results[m] = make([]CaseResult, len(d.Cases))
+		for i, c := range d.Cases {
+			wg.Add(1)
+			go func(m, i int, model string, c Case) {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					results[m][i] = CaseResult{Case: c.Name, Model: model, Error: ctx.Err().Error()}
+					return
+				}
+				defer func() { <-slots }()
+				results[m][i] = r.runCase(ctx, model, c)
+			}(m, i, model, c)
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for m, model := range r.Models {
+		report.Models = append(report.Models, summarize(model, results[m]))
+	}
+	report.Duration = time.Since(report.StartedAt)
+	return report, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, model string, c Case) CaseResult {
+	result := CaseResult{Case: c.Name, Model: model}
+	start := time.Now()
+	resp, err := r.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       model,
+		Messages:    c.messages(),
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+	})
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.PromptTokens = resp.Usage.PromptTokens
+	result.CompletionTokens = resp.Usage.CompletionTokens
+	if estimator, ok := r.Client.(langmesh.CostEstimator); ok {
+		result.CostUSD = estimator.EstimateCostUSD(model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	}
+	if len(resp.Choices) > 0 {
+		result.Output = resp.Choices[0].Message.Content
+	}
+
+	result.Pass = true
+	result.Scores = make(map[string]Score, len(r.Graders))
+	for _, g := range r.Graders {
+		score, err := g.Grade(ctx, c, result.Output)
+		if err != nil {
+			result.Error = fmt.Sprintf("grader %s: %v", g.Name(), err)
+			result.Pass = false
+			continue
+		}
+		result.Scores[g.Name()] = score
+		result.Pass = result.Pass && score.Pass
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/langmesh-ai/openai-go/langmeshtest"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const dataset = `{"name":"capital","prompt":"Capital of France?","expected":"Paris"}
+
+{"prompt":"2+2?","expected":"4","system":"Answer with a number"}
+`
+
+func TestParseDataset(t *testing.T) {
+	d, err := ParseDataset("basics", strings.NewReader(dataset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Cases) != 2 || d.Cases[0].Name != "capital" || d.Cases[1].Name != "line-3" {
+		t.Fatalf("cases = %+v", d.Cases)
+	}
+	if m := d.Cases[1].messages(); len(m) != 2 || m[0].Role != openai.ChatMessageRoleSystem || m[1].Content != "2+2?" {
+		t.Errorf("messages = %+v", m)
+	}
+	if _, err := ParseDataset("bad", strings.NewReader("{")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRunnerReport(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.USDPerToken = 0.00001
+	mock.ChatFunc = func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		switch {
+		case req.Model == "small" && prompt == "2+2?":
+			return openai.ChatCompletionResponse{}, errors.New("overloaded")
+		case req.Model == "small":
+			resp := langmeshtest.TextResponse("Lyon")
+			resp.Usage = openai.Usage{PromptTokens: 400, CompletionTokens: 100}
+			return resp, nil
+		case prompt == "2+2?":
+			return langmeshtest.TextResponse("4"), nil
+		}
+		resp := langmeshtest.TextResponse(" paris\n")
+		resp.Usage = openai.Usage{PromptTokens: 800, CompletionTokens: 200}
+		return resp, nil
+	}
+	d, _ := ParseDataset("basics", strings.NewReader(dataset))
+	runner := &Runner{
+		Client:  mock,
+		Models:  []string{"large", "small"},
+		Graders: []Grader{ExactMatch{IgnoreCase: true}},
+	}
+
+	report, err := runner.Run(context.Background(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, small := report.Models[0], report.Models[1]
+	if large.Accuracy != 1 || large.Passed != 2 || large.CostUSD != 0.01 || large.MeanScores["exact_match"] != 1 {
+		t.Errorf("large = %+v", large)
+	}
+	if small.Accuracy != 0 || small.Failed != 2 || small.Errors != 1 || small.Cases[1].Error != "overloaded" {
+		t.Errorf("small = %+v", small)
+	}
+	if got := mock.Calls("CreateChatCompletion"); got != 4 {
+		t.Errorf("calls = %d", got)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"large  100.0%", "FAIL small capital: exact_match (output differs from expected)", "FAIL small line-3: overloaded"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, text.String())
+		}
+	}
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded.Models[1].Cases) != 2 {
+		t.Errorf("json = %s, err = %v", js.String(), err)
+	}
+}
+
+func TestRunnerNeedsModels(t *testing.T) {
+	if _, err := (&Runner{Client: langmeshtest.NewMockClient()}).Run(context.Background(), Dataset{}); err == nil {
+		t.Error("expected an error without models")
+	}
+}
@@ -0,0 +1,207 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Score is a grader's verdict on one answer
+type Score struct {
+	// Value is in [0, 1]
+	Value  float64 `json:"value"`
+	Pass   bool    `json:"pass"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// Grader scores a model's output for a case
+type Grader interface {
+	// Name labels the grader's scores in reports
+	Name() string
+	Grade(ctx context.Context, c Case, output string) (Score, error)
+}
+
+// GraderFunc adapts a function to a Grader
+func GraderFunc(name string, grade func(ctx context.Context, c Case, output string) (Score, error)) Grader {
+	return graderFunc{name: name, grade: grade}
+}
+
+type graderFunc struct {
+	name  string
+	grade func(ctx context.Context, c Case, output string) (Score, error)
+}
+
+func (g graderFunc) Name() string { return g.name }
+
+func (g graderFunc) Grade(ctx context.Context, c Case, output string) (Score, error) {
+	return g.grade(ctx, c, output)
+}
+
+// passFail scores a yes or no check
+func passFail(pass bool, reason string) Score {
+	if pass {
+		return Score{Value: 1, Pass: true}
+	}
+	return Score{Reason: reason}
+}
+
+// ExactMatch passes outputs equal to the case's Expected answer, ignoring
+// surrounding whitespace
+type ExactMatch struct {
+	IgnoreCase bool
+}
+
+func (ExactMatch) Name() string { return "exact_match" }
+
+func (g ExactMatch) Grade(_ context.Context, c Case, output string) (Score, error) {
+	got, want := strings.TrimSpace(output), strings.TrimSpace(c.Expected)
+	if g.IgnoreCase {
+		return passFail(strings.EqualFold(got, want), "output differs from expected"), nil
+	}
+	return passFail(got == want, "output differs from expected"), nil
+}
+
+// Regex passes outputs matching Pattern, or the case's Pattern if Pattern
+// is nil
+type Regex struct {
+	Pattern *regexp.Regexp
+}
+
+func (Regex) Name() string { return "regex" }
+
+func (g Regex) Grade(_ context.Context, c Case, output string) (Score, error) {
+	re := g.Pattern
+	if re == nil {
+		if c.Pattern == "" {
+			return Score{}, errors.New("no pattern")
+		}
+		var err error
+		if re, err = regexp.Compile(c.Pattern); err != nil {
+			return Score{}, err
+		}
+	}
+	return passFail(re.MatchString(output), "output does not match "+re.String()), nil
+}
+
+// EmbeddingClient creates embeddings; *langmesh.Client implements it
+type EmbeddingClient interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// EmbeddingSimilarity scores outputs by the cosine similarity of their
+// embedding to the Expected answer's
+type EmbeddingSimilarity struct {
+	Client EmbeddingClient
+	// Model defaults to text-embedding-3-small
+	Model openai.EmbeddingModel
+	// Threshold is the similarity an output needs to pass (default 0.8)
+	Threshold float64
+}
+
+func (EmbeddingSimilarity) Name() string { return "embedding_similarity" }
+
+func (g EmbeddingSimilarity) Grade(ctx context.Context, c Case, output string) (Score, error) {
+	model := g.Model
+	if model == "" {
+		model = openai.SmallEmbedding3
+	}
+	threshold := g.Threshold
+	if threshold <= 0 {
+		threshold = 0.8
+	}
+	resp, err := g.Client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: []string{c.Expected, output},
+		Model: model,
+	})
+	if err != nil {
+		return Score{}, err
+	}
+	if len(resp.Data) != 2 {
+		return Score{}, fmt.Errorf("got %d embeddings, want 2", len(resp.Data))
+	}
+	sim := langmesh.CosineSimilarity(resp.Data[0].Embedding, resp.Data[1].Embedding)
+	score := Score{Value: math.Max(sim, 0), Pass: sim >= threshold}
+	if !score.Pass {
+		score.Reason = fmt.Sprintf("similarity %.3f below %.3f", sim, threshold)
+	}
+	return score, nil
+}
+
+// DefaultJudgeRubric is the Judge's rubric when neither it nor the case
+// sets one
+const DefaultJudgeRubric = "The answer is correct, complete and consistent with the expected answer, if one is given."
+
+// Judge asks a model to score outputs against a rubric, LLM-as-judge
+type Judge struct {
+	Client langmesh.ChatClient
+	// Model defaults to gpt-4o-mini
+	Model  string
+	Rubric string
+	// Threshold is the score, in [0, 1], an output needs to pass (default
+	// 0.7)
+	Threshold float64
+}
+
+func (Judge) Name() string { return "judge" }
+
+const judgeInstructions = `You are grading an AI assistant's answer against a rubric. ` +
+	`Reply with a JSON object: {"score": <integer 0-10>, "reason": "<one sentence>"}.`
+
+func (g Judge) Grade(ctx context.Context, c Case, output string) (Score, error) {
+	model := g.Model
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	rubric := c.Rubric
+	if rubric == "" {
+		rubric = g.Rubric
+	}
+	if rubric == "" {
+		rubric = DefaultJudgeRubric
+	}
+	threshold := g.Threshold
+	if threshold <= 0 {
+		threshold = 0.7
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Rubric:\n%s\n\nConversation:\n", rubric)
+	for _, m := range c.messages() {
+		fmt.Fprintf(&prompt, "%s: %s\n", m.Role, m.Content)
+	}
+	if c.Expected != "" {
+		fmt.Fprintf(&prompt, "\nExpected answer:\n%s\n", c.Expected)
+	}
+	fmt.Fprintf(&prompt, "\nAnswer to grade:\n%s", output)
+
+	resp, err := g.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: judgeInstructions},
+			{Role: openai.ChatMessageRoleUser, Content: prompt.String()},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return Score{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Score{}, errors.New("judge returned no choices")
+	}
+	var verdict struct {
+		Score  *float64 `json:"score"`
+		Reason string   `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &verdict); err != nil || verdict.Score == nil {
+		return Score{}, fmt.Errorf("unreadable verdict %q", resp.Choices[0].Message.Content)
+	}
+	value := math.Min(math.Max(*verdict.Score/10, 0), 1)
+	return Score{Value: value, Pass: value >= threshold, Reason: verdict.Reason}, nil
+}
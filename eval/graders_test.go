@@ -0,0 +1,71 @@
+package eval
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/langmesh-ai/openai-go/langmeshtest"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRegexGrader(t *testing.T) {
+	ctx := context.Background()
+	score, err := Regex{}.Grade(ctx, Case{Pattern: `^\d{4}-\d{2}$`}, "2024-05")
+	if err != nil || !score.Pass || score.Value != 1 {
+		t.Errorf("case pattern: %+v, %v", score, err)
+	}
+	score, _ = Regex{Pattern: regexp.MustCompile(`(?i)refund`)}.Grade(ctx, Case{}, "no luck")
+	if score.Pass || score.Reason == "" {
+		t.Errorf("fixed pattern: %+v", score)
+	}
+	if _, err := (Regex{}).Grade(ctx, Case{}, "x"); err == nil {
+		t.Error("expected an error without a pattern")
+	}
+}
+
+func TestEmbeddingSimilarityGrader(t *testing.T) {
+	mock := langmeshtest.NewMockClient()
+	mock.EmbeddingsFunc = func(_ context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error) {
+		inputs := conv.Convert().Input.([]string)
+		vectors := map[string][]float32{"Paris": {1, 0}, "paris": {0.9, 0.1}, "Berlin": {0, 1}}
+		var resp openai.EmbeddingResponse
+		for _, in := range inputs {
+			resp.Data = append(resp.Data, openai.Embedding{Embedding: vectors[in]})
+		}
+		return resp, nil
+	}
+	g := EmbeddingSimilarity{Client: mock}
+	ctx, c := context.Background(), Case{Expected: "Paris"}
+
+	if score, err := g.Grade(ctx, c, "paris"); err != nil || !score.Pass || score.Value < 0.99 {
+		t.Errorf("similar: %+v, %v", score, err)
+	}
+	if score, err := g.Grade(ctx, c, "Berlin"); err != nil || score.Pass || score.Value != 0 {
+		t.Errorf("different: %+v, %v", score, err)
+	}
+}
+
+func TestJudgeGrader(t *testing.T) {
+	mock := langmeshtest.NewMockClient().
+		QueueText(`{"score": 8, "reason": "correct but terse"}`).
+		QueueText(`{"score": 3}`).
+		QueueText("I think it's fine")
+	g := Judge{Client: mock, Rubric: "Be polite"}
+	ctx, c := context.Background(), Case{Prompt: "Capital of France?", Expected: "Paris", Rubric: "Name the city"}
+
+	score, err := g.Grade(ctx, c, "Paris")
+	if err != nil || !score.Pass || score.Value != 0.8 || score.Reason != "correct but terse" {
+		t.Errorf("score = %+v, %v", score, err)
+	}
+	req := mock.ChatRequests()[0]
+	if req.Model != "gpt-4o-mini" || req.ResponseFormat == nil || !regexp.MustCompile(`(?s)Name the city.*Capital of France\?.*Paris`).MatchString(req.Messages[1].Content) {
+		t.Errorf("request = %+v", req)
+	}
+	if score, _ := g.Grade(ctx, c, "Lyon"); score.Pass {
+		t.Errorf("low score passed: %+v", score)
+	}
+	if _, err := g.Grade(ctx, c, "Paris"); err == nil {
+		t.Error("expected an error for an unreadable verdict")
+	}
+}
@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+)
+
+// CaseResult is one model's answer to one case
+type CaseResult struct {
+	Case   string `json:"case"`
+	Model  string `json:"model"`
+	Output string `json:"output"`
+	// Pass is set when the call succeeded and every grader passed
+	Pass   bool             `json:"pass"`
+	Scores map[string]Score `json:"scores,omitempty"`
+	// Error is the failed call or grader, if any
+	Error string `json:"error,omitempty"`
+
+	LatencyMs        int64   `json:"latency_ms"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// ModelReport aggregates one model's results
+type ModelReport struct {
+	Model string       `json:"model"`
+	Cases []CaseResult `json:"cases"`
+
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	// Errors counts cases whose call or grading failed; they are also
+	// counted as failed
+	Errors int `json:"errors"`
+	// Accuracy is the fraction of cases passed
+	Accuracy float64 `json:"accuracy"`
+	// MeanScores averages each grader's score over the cases it graded
+	MeanScores map[string]float64 `json:"mean_scores,omitempty"`
+
+	CostUSD          float64 `json:"cost_usd"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	MeanLatencyMs    int64   `json:"mean_latency_ms"`
+	P50LatencyMs     int64   `json:"p50_latency_ms"`
+	P95LatencyMs     int64   `json:"p95_latency_ms"`
+}
+
+// Report is the outcome of Runner.Run
+type Report struct {
+	Dataset   string        `json:"dataset"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	Models    []ModelReport `json:"models"`
+}
+
+func summarize(model string, cases []CaseResult) ModelReport {
+	m := ModelReport{Model: model, Cases: cases}
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	latencies := make([]int64, 0, len(cases))
+	var totalLatency int64
+	var cost langmesh.Money
+	for _, c := range cases {
+		if c.Pass {
+			m.Passed++
+		} else {
+			m.Failed++
+		}
+		if c.Error != "" {
+			m.Errors++
+		}
+		for name, s := range c.Scores {
+			sums[name] += s.Value
+			counts[name]++
+		}
+		cost += langmesh.MoneyFromFloat(c.CostUSD)
+		m.PromptTokens += c.PromptTokens
+		m.CompletionTokens += c.CompletionTokens
+		latencies = append(latencies, c.LatencyMs)
+		totalLatency += c.LatencyMs
+	}
+	m.CostUSD = cost.Float64()
+	if len(cases) == 0 {
+		return m
+	}
+	m.Accuracy = float64(m.Passed) / float64(len(cases))
+	if len(sums) > 0 {
+		m.MeanScores = make(map[string]float64, len(sums))
+		for name, sum := range sums {
+			m.MeanScores[name] = sum / float64(counts[name])
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	m.MeanLatencyMs = totalLatency / int64(len(cases))
+	m.P50LatencyMs = latencies[(len(latencies)-1)/2]
+	m.P95LatencyMs = latencies[(len(latencies)-1)*95/100]
+	return m
+}
+
+// WriteJSON writes the report, every case included, as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a summary table of the models followed by the cases
+// each failed
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "dataset %s, %d models, %s\n\n", r.Dataset, len(r.Models), r.Duration.Round(time.Millisecond))
+	fmt.Fprintln(tw, "MODEL\tACCURACY\tPASSED\tFAILED\tERRORS\tCOST\tP50\tP95")
+	for _, m := range r.Models {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%d\t%d\t%d\t$%.4f\t%dms\t%dms\n",
+			m.Model, m.Accuracy*100, m.Passed, m.Failed, m.Errors, m.CostUSD, m.P50LatencyMs, m.P95LatencyMs)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, m := range r.Models {
+		for _, c := range m.Cases {
+			if c.Pass {
+				continue
+			}
+			reason := c.Error
+			if reason == "" {
+				reason = failedScores(c.Scores)
+			}
+			if _, err := fmt.Fprintf(w, "FAIL %s %s: %s\n", m.Model, c.Case, reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// failedScores lists the graders an answer failed, by name
+func failedScores(scores map[string]Score) string {
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := ""
+	for _, name := range names {
+		s := scores[name]
+		if s.Pass {
+			continue
+		}
+		if out != "" {
+			out += "; "
+		}
+		out += name
+		if s.Reason != "" {
+			out += " (" + s.Reason + ")"
+		}
+	}
+	return out
+}
@@ -0,0 +1,324 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultEventRetention is how long NewEventRetention keeps events when
+// given no duration
+const DefaultEventRetention = 7 * 24 * time.Hour
+
+// maxPendingEvents caps the events an EventRetention holds while its store
+// is failing; the oldest are dropped beyond it
+const maxPendingEvents = 10_000
+
+// EventQuery selects stored events. Zero fields match every event.
+type EventQuery struct {
+	// Since and Until bound the events' end time, Until exclusive
+	Since time.Time
+	Until time.Time
+
+	Model    string
+	Endpoint string
+	// Status is "success", "error" or "cancelled"
+	Status  string
+	User    string
+	Project string
+	// Tags must all be set on the event, with these values
+	Tags map[string]string
+
+	// Limit keeps the latest Limit matches
+	Limit int
+}
+
+// Match reports whether event is selected by q, except for Limit. Stores
+// use it to filter what their indexes do not.
+func (q EventQuery) Match(event TelemetryEvent) bool {
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		at := event.EndTime()
+		if at.Before(q.Since) || (!q.Until.IsZero() && !at.Before(q.Until)) {
+			return false
+		}
+	}
+	if (q.Model != "" && event.Model != q.Model) ||
+		(q.Endpoint != "" && event.Endpoint != q.Endpoint) ||
+		(q.Status != "" && event.Status != q.Status) ||
+		(q.User != "" && event.User != q.User) ||
+		(q.Project != "" && event.Project != q.Project) {
+		return false
+	}
+	for key, value := range q.Tags {
+		if v, ok := event.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// EndTime parses TimestampEnd, or TimestampStart if the event has no end.
+// It is the zero time if neither parses.
+func (e TelemetryEvent) EndTime() time.Time {
+	for _, ts := range []string{e.TimestampEnd, e.TimestampStart} {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// EventStore keeps telemetry events for EventRetention. Query returns
+// matches oldest first. Stores must be safe for concurrent use.
+// NewMemoryEventStore keeps events in memory; the langmeshbolt module
+// keeps them in a file.
+type EventStore interface {
+	Append(ctx context.Context, events []TelemetryEvent) error
+	Query(ctx context.Context, q EventQuery) ([]TelemetryEvent, error)
+	// Prune deletes events that ended before before
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// MemoryEventStore is an EventStore in memory, for tests and processes
+// that only need their own history
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events []TelemetryEvent
+}
+
+// NewMemoryEventStore creates an empty MemoryEventStore
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{}
+}
+
+func (s *MemoryEventStore) Append(_ context.Context, events []TelemetryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *MemoryEventStore) Query(ctx context.Context, q EventQuery) ([]TelemetryEvent, error) {
+	s.mu.Lock()
+	var out []TelemetryEvent
+	for _, event := range s.events {
+		if q.Match(event) {
+			out = append(out, event)
+		}
+	}
+	s.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].EndTime().Before(out[j].EndTime()) })
+	return limitEvents(out, q.Limit), ctx.Err()
+}
+
+func (s *MemoryEventStore) Prune(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if !event.EndTime().Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	clear(s.events[len(kept):])
+	s.events = kept
+	return nil
+}
+
+// limitEvents keeps the last limit of events, if limit is positive
+func limitEvents(events []TelemetryEvent, limit int) []TelemetryEvent {
+	if limit > 0 && len(events) > limit {
+		return events[len(events)-limit:]
+	}
+	return events
+}
+
+// EventRetention writes a client's telemetry events to an EventStore, so
+// they can be queried, reported on and fed back into cost reports and
+// anomaly detection after a restart, without the remote backend. Events
+// are written every second and pruned once past the retention.
+type EventRetention struct {
+	store     EventStore
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending []TelemetryEvent
+	// dropped counts events discarded while the store was failing
+	dropped int64
+
+	// flushMu serializes writes, so events reach the store in order
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewEventRetention keeps events in store for retention, or for
+// DefaultEventRetention if it is zero, until Close is called
+func NewEventRetention(store EventStore, retention time.Duration) *EventRetention {
+	if retention <= 0 {
+		retention = DefaultEventRetention
+	}
+	r := &EventRetention{
+		store:     store,
+		retention: retention,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// WithEventRetention records every request's telemetry in r. Without
+// WithCostRetention, CostReport is computed from r's store, and on startup
+// WithCostRetention and WithCostAnomalyDetection are given the history
+// they need from it.
+func WithEventRetention(r *EventRetention) Option {
+	return func(c *Client) {
+		c.eventRetention = r
+		c.observers = append(c.observers, r)
+	}
+}
+
+func (r *EventRetention) run() {
+	defer close(r.done)
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Minute)
+	defer prune.Stop()
+	_ = r.store.Prune(context.Background(), r.now().Add(-r.retention))
+	for {
+		select {
+		case <-flush.C:
+			_ = r.Flush(context.Background())
+		case <-prune.C:
+			_ = r.store.Prune(context.Background(), r.now().Add(-r.retention))
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *EventRetention) observe(event TelemetryEvent) {
+	if event.Heartbeat {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, event)
+	if over := len(r.pending) - maxPendingEvents; over > 0 {
+		clear(r.pending[:over])
+		r.pending = r.pending[over:]
+		r.dropped += int64(over)
+	}
+}
+
+// Flush writes the events recorded so far. Events the store fails to take
+// are kept for the next flush.
+func (r *EventRetention) Flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	err := r.store.Append(ctx, batch)
+	if err != nil {
+		r.mu.Lock()
+		r.pending = append(batch, r.pending...)
+		r.mu.Unlock()
+		return fmt.Errorf("langmesh: storing events: %w", err)
+	}
+	return nil
+}
+
+// Dropped counts events discarded because the store kept failing
+func (r *EventRetention) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Query flushes recorded events and returns the stored events q selects,
+// oldest first
+func (r *EventRetention) Query(ctx context.Context, q EventQuery) ([]TelemetryEvent, error) {
+	if err := r.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return r.store.Query(ctx, q)
+}
+
+// CostReport aggregates the stored spend of requests that ended between
+// since and until, as Client.CostReport does in memory. Its costs are in
+// USD and unrounded.
+func (r *EventRetention) CostReport(ctx context.Context, since, until time.Time) (CostReport, error) {
+	events, err := r.Query(ctx, EventQuery{Since: since, Until: until})
+	if err != nil {
+		return CostReport{Since: since, Until: until}, err
+	}
+	m := newCostMinute(0)
+	for i := range events {
+		m.add(&events[i])
+	}
+	report := newCostReport(since, until)
+	report.merge(m)
+	f := &costFormat{}
+	report.Total.format(f)
+	report.formatLines(f)
+	return report, nil
+}
+
+// Close stops the background writes and pruning and flushes remaining
+// events
+func (r *EventRetention) Close() error {
+	close(r.stop)
+	<-r.done
+	return r.Flush(context.Background())
+}
+
+// restorer is an observer that can be seeded with stored history
+type restorer interface {
+	// history is how far back the observer needs events
+	history() time.Duration
+	// restore adds an event that ended at, without acting on it
+	restore(event TelemetryEvent, at time.Time)
+}
+
+// restoreHistory seeds the observers that keep history from the
+// WithEventRetention store
+func (c *Client) restoreHistory() {
+	if c.eventRetention == nil {
+		return
+	}
+	var restorers []restorer
+	var longest time.Duration
+	for _, o := range c.observers {
+		if r, ok := o.(restorer); ok {
+			restorers = append(restorers, r)
+			longest = max(longest, r.history())
+		}
+	}
+	if len(restorers) == 0 {
+		return
+	}
+	since := time.Now().Add(-longest)
+	events, err := c.eventRetention.store.Query(context.Background(), EventQuery{Since: since})
+	if err != nil {
+		c.log(context.Background(), LogTelemetry, "restoring history from the event store failed", "error", err)
+		return
+	}
+	for _, event := range events {
+		at := event.EndTime()
+		for _, r := range restorers {
+			if at.After(time.Now().Add(-r.history())) {
+				r.restore(event, at)
+			}
+		}
+	}
+}
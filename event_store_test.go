@@ -0,0 +1,151 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// storedEvent is an event that ended at, for seeding stores
+func storedEvent(model, status string, at time.Time, cost float64, tags map[string]string) TelemetryEvent {
+	return TelemetryEvent{
+		Model:           model,
+		Endpoint:        "chat.completions",
+		Status:          status,
+		TimestampStart:  at.Add(-time.Second).Format(time.RFC3339),
+		TimestampEnd:    at.Format(time.RFC3339),
+		CostEstimateUSD: cost,
+		Tags:            tags,
+	}
+}
+
+func TestMemoryEventStoreQuery(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryEventStore()
+	// Appended out of order; queries return them oldest first
+	store.Append(ctx, []TelemetryEvent{
+		storedEvent("gpt-4o", "success", base.Add(2*time.Minute), 0.3, map[string]string{"agent": "triage"}),
+		storedEvent("gpt-4o-mini", "error", base, 0.1, nil),
+		storedEvent("gpt-4o", "success", base.Add(time.Minute), 0.2, map[string]string{"agent": "support"}),
+	})
+
+	for _, tc := range []struct {
+		name  string
+		query EventQuery
+		want  []float64
+	}{
+		{"all", EventQuery{}, []float64{0.1, 0.2, 0.3}},
+		{"model", EventQuery{Model: "gpt-4o"}, []float64{0.2, 0.3}},
+		{"status", EventQuery{Status: "error"}, []float64{0.1}},
+		{"tag", EventQuery{Tags: map[string]string{"agent": "triage"}}, []float64{0.3}},
+		{"range", EventQuery{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, []float64{0.2}},
+		{"limit", EventQuery{Limit: 2}, []float64{0.2, 0.3}},
+	} {
+		events, err := store.Query(ctx, tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []float64
+		for _, e := range events {
+			got = append(got, e.CostEstimateUSD)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && (got[0] != tc.want[0] || got[len(got)-1] != tc.want[len(tc.want)-1])) {
+			t.Errorf("%s: costs = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if err := store.Prune(ctx, base.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := store.Query(ctx, EventQuery{}); len(events) != 2 {
+		t.Errorf("after Prune: %d events, want 2", len(events))
+	}
+}
+
+func TestEventRetention(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	store := NewMemoryEventStore()
+	retention := NewEventRetention(store, time.Hour)
+	defer retention.Close()
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithEventRetention(retention))
+	ctx := ContextWithTag(context.Background(), "agent", "triage")
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Query sees events not yet written by the background flush
+	events, err := retention.Query(context.Background(), EventQuery{Tags: map[string]string{"agent": "triage"}})
+	if err != nil || len(events) != 1 || events[0].Model != "gpt-4o-mini" {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	// Without WithCostRetention, CostReport comes from the store
+	report := client.CostReport(time.Hour)
+	if report.Total.Requests != 1 || report.Total.CostUSD != events[0].CostEstimateUSD || report.ByTag["agent"]["triage"].Requests != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+// failingStore fails Append until healed
+type failingStore struct {
+	*MemoryEventStore
+	failing bool
+}
+
+func (s *failingStore) Append(ctx context.Context, events []TelemetryEvent) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	return s.MemoryEventStore.Append(ctx, events)
+}
+
+func TestEventRetentionKeepsEventsTheStoreRejects(t *testing.T) {
+	store := &failingStore{MemoryEventStore: NewMemoryEventStore(), failing: true}
+	retention := NewEventRetention(store, time.Hour)
+	defer retention.Close()
+	retention.observe(storedEvent("gpt-4o", "success", time.Now(), 0.1, nil))
+	if err := retention.Flush(context.Background()); err == nil {
+		t.Fatal("Flush did not report the store's error")
+	}
+	store.failing = false
+	events, err := retention.Query(context.Background(), EventQuery{})
+	if err != nil || len(events) != 1 {
+		t.Errorf("events = %+v, %v, want the event kept for the next flush", events, err)
+	}
+}
+
+func TestEventRetentionRestoresHistory(t *testing.T) {
+	store := NewMemoryEventStore()
+	now := time.Now()
+	var history []TelemetryEvent
+	for i := 1; i <= 4; i++ {
+		history = append(history, storedEvent("gpt-4o", "success", now.Add(-time.Duration(i)*time.Minute), 1, nil))
+	}
+	// Older than any observer needs
+	history = append(history, storedEvent("gpt-4o", "success", now.Add(-48*time.Hour), 100, nil))
+	store.Append(context.Background(), history)
+
+	anomalies := make(chan CostAnomaly, 1)
+	retention := NewEventRetention(store, 0)
+	defer retention.Close()
+	client := NewClient("test-key",
+		WithEventRetention(retention),
+		WithCostRetention(time.Hour),
+		WithCostAnomalyDetection(CostAnomalyConfig{Window: time.Minute, Baselines: 4, OnAnomaly: func(a CostAnomaly) { anomalies <- a }}),
+	)
+
+	if total := client.CostReport(time.Hour).Total; total.Requests != 4 || total.CostUSD != 4 {
+		t.Errorf("restored report total = %+v", total)
+	}
+	// The restored baseline lets the first live spike be flagged
+	client.observers[len(client.observers)-1].observe(storedEvent("gpt-4o", "success", now, 20, nil))
+	select {
+	case a := <-anomalies:
+		if a.SpendUSD != 20 || a.BaselineMeanUSD != 1 {
+			t.Errorf("anomaly = %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("spike after a restart was not flagged")
+	}
+}
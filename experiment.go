@@ -0,0 +1,158 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/google/uuid"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Variant is one arm of an experiment. Zero fields leave the request as the
+// caller built it.
+type Variant struct {
+	Name string
+	// Weight is the variant's relative share of traffic; zero counts as 1
+	Weight int
+
+	Model       string
+	Temperature *float32
+	// PromptVersion selects the template version PromptRegistry.Apply
+	// renders when called with no explicit version on a context assigned
+	// by Experiment.Assign
+	PromptVersion string
+}
+
+// Experiment splits traffic between variants. Requests whose context carries a
+// user (see ContextWithUser and BeginRequest) are assigned by a hash of the
+// user, so each user consistently sees the same variant; other requests are
+// split at random in proportion to the weights.
+type Experiment struct {
+	name     string
+	variants []Variant
+	total    uint64
+}
+
+// NewExperiment creates an experiment over variants
+func NewExperiment(name string, variants ...Variant) (*Experiment, error) {
+	if name == "" || len(variants) == 0 {
+		return nil, fmt.Errorf("langmesh: experiment needs a name and at least one variant")
+	}
+	e := &Experiment{name: name}
+	seen := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		if v.Name == "" || seen[v.Name] {
+			return nil, fmt.Errorf("langmesh: experiment %s: variant names must be unique and non-empty", name)
+		}
+		if v.Weight < 0 {
+			return nil, fmt.Errorf("langmesh: experiment %s: variant %s has negative weight", name, v.Name)
+		}
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		seen[v.Name] = true
+		e.variants = append(e.variants, v)
+		e.total += uint64(v.Weight)
+	}
+	return e, nil
+}
+
+// Name returns the experiment name
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// VariantFor returns the variant key is deterministically assigned to
+func (e *Experiment) VariantFor(key string) Variant {
+	h := fnv.New64a()
+	h.Write([]byte(e.name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	point := h.Sum64() % e.total
+	for _, v := range e.variants {
+		if point < uint64(v.Weight) {
+			return v
+		}
+		point -= uint64(v.Weight)
+	}
+	return e.variants[len(e.variants)-1]
+}
+
+// Assign picks the variant for the request on ctx and records it there, so
+// telemetry for calls made with the returned context is tagged with the
+// experiment and variant. A context already assigned to e keeps its variant.
+func (e *Experiment) Assign(ctx context.Context) (context.Context, Variant) {
+	if carrier := carrierFrom(ctx); carrier != nil && carrier.experiment.name == e.name {
+		for _, v := range e.variants {
+			if v.Name == carrier.experiment.variant.Name {
+				return ctx, v
+			}
+		}
+	}
+
+	key := ScopeFrom(ctx).User
+	if key == "" {
+		key = uuid.NewString()
+	}
+	v := e.VariantFor(key)
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.experiment = experimentRef{name: e.name, variant: v}
+	}), v
+}
+
+// Apply overrides request with the variant's model and temperature
+func (v Variant) Apply(request openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	if v.Model != "" {
+		request.Model = v.Model
+	}
+	if v.Temperature != nil {
+		request.Temperature = *v.Temperature
+	}
+	return request
+}
+
+// WithExperiment assigns every chat request the client makes to a variant
+// of e and applies it
+func WithExperiment(e *Experiment) Option {
+	return func(c *Client) {
+		c.experiment = e
+	}
+}
+
+type experimentRef struct {
+	name    string
+	variant Variant
+}
+
+// assignExperiment assigns and applies the client's experiment, if any
+func (c *Client) assignExperiment(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (context.Context, openai.ChatCompletionRequest) {
+	if c.experiment == nil {
+		return ctx, request
+	}
+	ctx, v := c.experiment.Assign(ctx)
+	return ctx, v.Apply(request)
+}
+
+// experimentPromptVersion returns the prompt version chosen by the variant
+// assigned on ctx
+func experimentPromptVersion(ctx context.Context) string {
+	carrier := carrierFrom(ctx)
+	if carrier == nil {
+		return ""
+	}
+	return carrier.experiment.variant.PromptVersion
+}
+
+// applyExperiment copies the experiment assignment on ctx onto event
+func applyExperiment(ctx context.Context, event *TelemetryEvent) {
+	carrier := carrierFrom(ctx)
+	if carrier == nil || carrier.experiment.name == "" {
+		return
+	}
+	event.Experiment = carrier.experiment.name
+	event.Variant = carrier.experiment.variant.Name
+}
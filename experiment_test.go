@@ -0,0 +1,108 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestExperimentDeterministicByUser(t *testing.T) {
+	e, err := NewExperiment("model-test", Variant{Name: "control"}, Variant{Name: "mini", Model: "gpt-4o-mini"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		_, first := e.Assign(ContextWithUser(context.Background(), user))
+		_, again := e.Assign(ContextWithUser(context.Background(), user))
+		if first.Name != again.Name {
+			t.Fatalf("user %s assigned %s then %s", user, first.Name, again.Name)
+		}
+		counts[first.Name]++
+	}
+	if counts["control"] < 400 || counts["mini"] < 400 {
+		t.Errorf("uneven split: %v", counts)
+	}
+
+	ctx, v := e.Assign(context.Background())
+	if _, again := e.Assign(ctx); again.Name != v.Name {
+		t.Error("assigned context changed variant")
+	}
+}
+
+func TestExperimentWeights(t *testing.T) {
+	e, err := NewExperiment("rollout", Variant{Name: "old", Weight: 9}, Variant{Name: "new", Weight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCount := 0
+	for i := 0; i < 2000; i++ {
+		if e.VariantFor(fmt.Sprint(i)).Name == "new" {
+			newCount++
+		}
+	}
+	if newCount < 120 || newCount > 280 {
+		t.Errorf("new variant got %d of 2000, want about 200", newCount)
+	}
+
+	if _, err := NewExperiment("dup", Variant{Name: "a"}, Variant{Name: "a"}); err == nil {
+		t.Error("duplicate variant names accepted")
+	}
+}
+
+func TestWithExperimentAppliesAndTags(t *testing.T) {
+	var gotModel string
+	var gotTemp float32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotModel, gotTemp = req.Model, req.Temperature
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	temp := float32(0.2)
+	e, _ := NewExperiment("cheap", Variant{Name: "mini", Model: "gpt-4o-mini", Temperature: &temp})
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithExperiment(e), withRecorder(rec))
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if gotModel != "gpt-4o-mini" || gotTemp != 0.2 {
+		t.Errorf("sent model %s temperature %v", gotModel, gotTemp)
+	}
+	event := rec.all()[0]
+	if event.Experiment != "cheap" || event.Variant != "mini" || event.Model != "gpt-4o-mini" {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestExperimentSelectsPromptVersion(t *testing.T) {
+	r := NewPromptRegistry()
+	for _, version := range []string{"a", "b"} {
+		_ = r.Register(PromptTemplate{
+			Name:     "sys",
+			Version:  version,
+			Messages: []openai.ChatCompletionMessage{{Role: "system", Content: "prompt " + version}},
+		})
+	}
+	e, _ := NewExperiment("prompt-test", Variant{Name: "first", PromptVersion: "a"})
+
+	ctx, _ := e.Assign(context.Background())
+	_, req, err := r.Apply(ctx, "sys", "", nil, openai.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Messages[0].Content != "prompt a" {
+		t.Errorf("rendered %q, want the variant's version", req.Messages[0].Content)
+	}
+}
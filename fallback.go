@@ -0,0 +1,74 @@
+package langmesh
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// WithModelFallback retries chat requests for primary on each fallback in
+// turn when the model rejects them for context length, is rate limited
+// (429), or is overloaded (503 or 529). The telemetry event reports the model
+// that served the request, with FallbackFrom set to the one requested.
+// Fallbacks that strict mode, validation or the request policy would reject
+// are skipped.
+func WithModelFallback(primary string, fallbacks ...string) Option {
+	return func(c *Client) {
+		if c.fallbacks == nil {
+			c.fallbacks = make(map[string][]string)
+		}
+		c.fallbacks[primary] = fallbacks
+	}
+}
+
+// withFallback runs call for request.Model and then for each configured
+// fallback until one succeeds or fails for a reason a smaller model cannot
+// fix. Fallbacks failing the model checks the request passed, such as the
+// request policy's allowed models, are skipped. It returns the request as
+// last sent.
+func withFallback[T any](
+	ctx context.Context,
+	c *Client,
+	request openai.ChatCompletionRequest,
+	stream bool,
+	call func(context.Context, openai.ChatCompletionRequest) (T, error),
+) (T, openai.ChatCompletionRequest, error) {
+	chain := c.fallbacks[request.Model]
+	resp, err := call(ctx, request)
+	for _, next := range chain {
+		if err == nil || !shouldFallback(err) {
+			break
+		}
+		candidate := request
+		candidate.Model = next
+		if checkErr := c.checkModel(candidate, stream); checkErr != nil {
+			c.log(ctx, LogRetry, "skipping fallback model",
+				"model", request.Model, "fallback", next, "error", checkErr)
+			continue
+		}
+		c.log(ctx, LogRetry, "falling back to another model",
+			"model", request.Model, "fallback", next, "error", err)
+		request = candidate
+		resp, err = call(ctx, request)
+	}
+	return resp, request, err
+}
+
+// checkModel runs the checks that depend on request's model: strict mode,
+// validation, and the request policy
+func (c *Client) checkModel(request openai.ChatCompletionRequest, stream bool) error {
+	err := c.checkStrict(request.Model, stream)
+	if err == nil {
+		err = c.validateRequest(request)
+	}
+	if err == nil {
+		err = c.checkRequestPolicy(request.Model)
+	}
+	return err
+}
+
+// shouldFallback reports whether err is one a different model may avoid
+func shouldFallback(err error) bool {
+	kind, _, _, _ := classifyUpstream(err)
+	return kind == ErrContextLengthExceeded || kind == ErrRateLimited || kind == ErrServerOverloaded
+}
@@ -0,0 +1,129 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newFallbackServer fails requests for the models in failures with the given
+// status and error code, and answers everything else
+func newFallbackServer(t *testing.T, failures map[string]int, code string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var models []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		models = append(models, req.Model)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if status, ok := failures[req.Model]; ok {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":{"message":"nope","type":"invalid_request_error","code":%q}}`, code)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"c1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`, req.Model)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), models...)
+	}
+}
+
+func TestModelFallbackOnRateLimit(t *testing.T) {
+	srv, models := newFallbackServer(t, map[string]int{"gpt-4o": 429, "gpt-4-turbo": 503}, "rate_limit_exceeded")
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithModelFallback("gpt-4o", "gpt-4-turbo", "gpt-4o-mini"),
+		withRecorder(rec),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(models()); got != "[gpt-4o gpt-4-turbo gpt-4o-mini]" {
+		t.Errorf("models tried = %s", got)
+	}
+	event := rec.all()[0]
+	if event.Model != "gpt-4o-mini" || event.FallbackFrom != "gpt-4o" || event.Status != "success" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.CostEstimateUSD != estimateCost("gpt-4o-mini", 10, 2) {
+		t.Errorf("cost priced on the wrong model: %v", event.CostEstimateUSD)
+	}
+}
+
+func TestModelFallbackOnContextLength(t *testing.T) {
+	srv, models := newFallbackServer(t, map[string]int{"gpt-4": 400}, "context_length_exceeded")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithModelFallback("gpt-4", "gpt-4o"))
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	resp, err := client.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "gpt-4o" || len(models()) != 2 {
+		t.Errorf("served by %s after %v", resp.Model, models())
+	}
+}
+
+func TestModelFallbackSkipsOtherErrors(t *testing.T) {
+	srv, models := newFallbackServer(t, map[string]int{"gpt-4o": 400}, "invalid_api_key")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithModelFallback("gpt-4o", "gpt-4o-mini"))
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err == nil {
+		t.Fatal("expected the primary's error")
+	}
+	if got := models(); len(got) != 1 {
+		t.Errorf("fell back on a non-retryable error: %v", got)
+	}
+}
+
+func TestModelFallbackSkipsDisallowedModels(t *testing.T) {
+	srv, models := newFallbackServer(t, map[string]int{"gpt-4o": 429}, "rate_limit_exceeded")
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithModelFallback("gpt-4o", "gpt-3.5-turbo", "gpt-4o-mini"),
+		WithRequestPolicy(RequestPolicy{AllowedModels: []string{"gpt-4o", "gpt-4o-mini"}}),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CreateChatCompletionStream(context.Background(), req)
+	if err == nil {
+		stream.Close()
+	}
+	if got := fmt.Sprint(models()); got != "[gpt-4o gpt-4o-mini gpt-4o gpt-4o-mini]" {
+		t.Errorf("models tried = %s, want the disallowed fallback skipped", got)
+	}
+
+	client = NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithModelFallback("gpt-4o", "gpt-3.5-turbo"),
+		WithRequestPolicy(RequestPolicy{BlockedModels: []string{"gpt-3.5*"}}),
+	)
+	_, err = client.CreateChatCompletion(context.Background(), req)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want the primary's rate limit once no fallback is allowed", err)
+	}
+	if got := models(); got[len(got)-1] != "gpt-4o" {
+		t.Errorf("models tried = %v", got)
+	}
+}
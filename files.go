@@ -0,0 +1,222 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// CreateFile wraps the original method with telemetry. It reads the whole
+// file into memory; use UploadFile for large files.
+func (c *Client) CreateFile(ctx context.Context, request openai.FileRequest) (openai.File, error) {
+	return trackGroupCall(ctx, c, EndpointFiles, "files.create", "",
+		func(ctx context.Context, api *openai.Client) (openai.File, error) {
+			return api.CreateFile(ctx, request)
+		})
+}
+
+// CreateFileBytes wraps the original method with telemetry
+func (c *Client) CreateFileBytes(ctx context.Context, request openai.FileBytesRequest) (openai.File, error) {
+	return trackGroupCall(ctx, c, EndpointFiles, "files.create", "",
+		func(ctx context.Context, api *openai.Client) (openai.File, error) {
+			return api.CreateFileBytes(ctx, request)
+		})
+}
+
+// ListFiles wraps the original method with telemetry
+func (c *Client) ListFiles(ctx context.Context) (openai.FilesList, error) {
+	return trackGroupCall(ctx, c, EndpointFiles, "files.list", "",
+		func(ctx context.Context, api *openai.Client) (openai.FilesList, error) {
+			return api.ListFiles(ctx)
+		})
+}
+
+// GetFile wraps the original method with telemetry
+func (c *Client) GetFile(ctx context.Context, fileID string) (openai.File, error) {
+	return trackGroupCall(ctx, c, EndpointFiles, "files.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.File, error) {
+			return api.GetFile(ctx, fileID)
+		})
+}
+
+// DeleteFile wraps the original method with telemetry
+func (c *Client) DeleteFile(ctx context.Context, fileID string) error {
+	_, err := trackGroupCall(ctx, c, EndpointFiles, "files.delete", "",
+		func(ctx context.Context, api *openai.Client) (struct{}, error) {
+			return struct{}{}, api.DeleteFile(ctx, fileID)
+		})
+	return err
+}
+
+// GetFileContent wraps the original method with telemetry. The endpoint
+// timeout covers reading the content, and is released when it is closed.
+func (c *Client) GetFileContent(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.GetFileContent(ctx, fileID)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointFiles)
+	ctx, _ = withCallState(ctx, requestID)
+
+	var content io.ReadCloser
+	err := c.configErr
+	if err == nil {
+		content, err = c.Client.GetFileContent(ctx, fileID)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		c.recordTelemetry(c.newEvent(ctx, requestID, "files.content", "", startTime, err))
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return cancelOnClose{ReadCloser: content, cancel: cancel}, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r cancelOnClose) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// FileUpload describes a file streamed to the Files API by UploadFile
+type FileUpload struct {
+	// Name is the file name reported to the API
+	Name    string
+	Purpose openai.PurposeType
+	Reader  io.Reader
+	// Size is the total length of Reader, if known, passed to OnProgress
+	Size int64
+	// OnProgress is called as the upload proceeds with the bytes sent so
+	// far and Size
+	OnProgress func(sent, total int64)
+}
+
+// UploadFile streams upload.Reader to the Files API as multipart form data
+// without buffering it in memory. It records a "files.upload" telemetry
+// event with the bytes sent and the upload's duration.
+func (c *Client) UploadFile(ctx context.Context, upload FileUpload) (openai.File, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.UploadFile(ctx, upload)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointFiles)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	counter := &progressReader{r: upload.Reader, total: upload.Size, report: upload.OnProgress}
+	var file openai.File
+	err := c.configErr
+	if err == nil {
+		file, err = c.streamUpload(ctx, upload, counter)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		event := c.newEvent(ctx, requestID, "files.upload", "", startTime, err)
+		event.UploadBytes = counter.sent
+		c.recordTelemetry(event)
+	}
+
+	return file, err
+}
+
+func (c *Client) streamUpload(ctx context.Context, upload FileUpload, body io.Reader) (openai.File, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(writeUploadForm(form, upload, body))
+	}()
+	// Closing the pipe unblocks the writer if the server answers before
+	// reading the whole body; waiting for it keeps the byte count settled
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+
+	req, err := c.newAPIRequest(ctx, http.MethodPost, "/files", pr)
+	if err != nil {
+		return openai.File{}, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return openai.File{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return openai.File{}, decodeAPIError(resp)
+	}
+	var file openai.File
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		return openai.File{}, fmt.Errorf("langmesh: decode upload response: %w", err)
+	}
+	return file, nil
+}
+
+func writeUploadForm(form *multipart.Writer, upload FileUpload, body io.Reader) error {
+	if err := form.WriteField("purpose", string(upload.Purpose)); err != nil {
+		return err
+	}
+	part, err := form.CreateFormFile("file", upload.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, body); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// decodeAPIError converts a failed response into the error types go-openai
+// returns, so callers can inspect uploads' errors the same way
+func decodeAPIError(resp *http.Response) error {
+	var errResp openai.ErrorResponse
+	err := json.NewDecoder(resp.Body).Decode(&errResp)
+	if err != nil || errResp.Error == nil {
+		return &openai.RequestError{HTTPStatusCode: resp.StatusCode, Err: err}
+	}
+	errResp.Error.HTTPStatusCode = resp.StatusCode
+	return errResp.Error
+}
+
+// progressReader counts bytes read through it and reports them
+type progressReader struct {
+	r      io.Reader
+	sent   int64
+	total  int64
+	report func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		if p.report != nil {
+			p.report(p.sent, p.total)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,121 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newFilesServer accepts multipart uploads, reporting the file's size, and
+// serves "content" for any file's content
+func newFilesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+			mr, err := r.MultipartReader()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var purpose, name string
+			var size int64
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					break
+				}
+				if part.FormName() == "purpose" {
+					data, _ := io.ReadAll(part)
+					purpose = string(data)
+					continue
+				}
+				name = part.FileName()
+				size, _ = io.Copy(io.Discard, part)
+			}
+			if purpose == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"message":"purpose required","type":"invalid_request_error"}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"id":"file-1","object":"file","bytes":%d,"filename":%q,"purpose":%q}`, size, name, purpose)
+		case strings.HasSuffix(r.URL.Path, "/content"):
+			fmt.Fprint(w, "content")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUploadFileStreams(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newFilesServer(t).URL+"/v1"), withRecorder(rec))
+
+	const size = 3 << 20
+	var lastSent, lastTotal int64
+	file, err := client.UploadFile(context.Background(), FileUpload{
+		Name:    "train.jsonl",
+		Purpose: openai.PurposeFineTune,
+		// A plain io.Reader, so nothing can learn its length up front
+		Reader:     io.LimitReader(zeros{}, size),
+		Size:       size,
+		OnProgress: func(sent, total int64) { lastSent, lastTotal = sent, total },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Bytes != size || file.FileName != "train.jsonl" || file.Purpose != "fine-tune" {
+		t.Errorf("file = %+v", file)
+	}
+	if lastSent != size || lastTotal != size {
+		t.Errorf("progress ended at %d/%d", lastSent, lastTotal)
+	}
+	event := rec.all()[0]
+	if event.Endpoint != "files.upload" || event.UploadBytes != size {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestUploadFileAPIError(t *testing.T) {
+	client := NewClient("test-key", WithBaseURL(newFilesServer(t).URL+"/v1"))
+	_, err := client.UploadFile(context.Background(), FileUpload{Name: "x", Reader: strings.NewReader("data")})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestGetFileContentOutlivesCall(t *testing.T) {
+	client := NewClient("test-key",
+		WithBaseURL(newFilesServer(t).URL+"/v1"),
+		WithEndpointTimeout(EndpointFiles, time.Minute),
+	)
+	content, err := client.GetFileContent(context.Background(), "file-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, content); err != nil || buf.String() != "content" {
+		t.Errorf("read %q, %v", buf.String(), err)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
@@ -0,0 +1,226 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultFineTunePollInterval is how often WaitForFineTune checks a job
+// when FineTuneWaitOptions.PollInterval is zero
+const DefaultFineTunePollInterval = 10 * time.Second
+
+// ErrFineTuneFailed is returned by FineTuneWatch.Wait when the job ends in
+// any status other than succeeded
+var ErrFineTuneFailed = errors.New("langmesh: fine-tuning job did not succeed")
+
+// fineTunePricing is USD per million training tokens by base model
+var fineTunePricing = map[string]float64{
+	"gpt-4o":        25.0,
+	"gpt-4o-mini":   3.0,
+	"gpt-3.5-turbo": 8.0,
+	"davinci-002":   6.0,
+	"babbage-002":   0.4,
+}
+
+// estimateFineTuneCost prices trainedTokens for a job on model, matching
+// dated snapshots such as gpt-4o-mini-2024-07-18 to their base model
+func estimateFineTuneCost(model string, trainedTokens int) float64 {
+	price, ok := fineTunePricing[model]
+	if !ok {
+		price = 0.01
+		match := ""
+		for base, p := range fineTunePricing {
+			if strings.HasPrefix(model, base+"-") && len(base) > len(match) {
+				price, match = p, base
+			}
+		}
+	}
+	return tokenCost(trainedTokens, price).Float64()
+}
+
+// CreateFineTuningJob wraps the original method with telemetry
+func (c *Client) CreateFineTuningJob(
+	ctx context.Context,
+	request openai.FineTuningJobRequest,
+) (openai.FineTuningJob, error) {
+	return trackGroupCall(ctx, c, EndpointFineTuning, "fine_tuning.jobs.create", request.Model,
+		func(ctx context.Context, api *openai.Client) (openai.FineTuningJob, error) {
+			return api.CreateFineTuningJob(ctx, request)
+		})
+}
+
+// RetrieveFineTuningJob wraps the original method with telemetry
+func (c *Client) RetrieveFineTuningJob(ctx context.Context, jobID string) (openai.FineTuningJob, error) {
+	return trackGroupCall(ctx, c, EndpointFineTuning, "fine_tuning.jobs.retrieve", "",
+		func(ctx context.Context, api *openai.Client) (openai.FineTuningJob, error) {
+			return api.RetrieveFineTuningJob(ctx, jobID)
+		})
+}
+
+// CancelFineTuningJob wraps the original method with telemetry
+func (c *Client) CancelFineTuningJob(ctx context.Context, jobID string) (openai.FineTuningJob, error) {
+	return trackGroupCall(ctx, c, EndpointFineTuning, "fine_tuning.jobs.cancel", "",
+		func(ctx context.Context, api *openai.Client) (openai.FineTuningJob, error) {
+			return api.CancelFineTuningJob(ctx, jobID)
+		})
+}
+
+// ListFineTuningJobEvents wraps the original method with telemetry
+func (c *Client) ListFineTuningJobEvents(
+	ctx context.Context,
+	jobID string,
+	setters ...openai.ListFineTuningJobEventsParameter,
+) (openai.FineTuningJobEventList, error) {
+	return trackGroupCall(ctx, c, EndpointFineTuning, "fine_tuning.jobs.events", "",
+		func(ctx context.Context, api *openai.Client) (openai.FineTuningJobEventList, error) {
+			return api.ListFineTuningJobEvents(ctx, jobID, setters...)
+		})
+}
+
+// FineTuneWaitOptions configures WaitForFineTune
+type FineTuneWaitOptions struct {
+	// PollInterval defaults to DefaultFineTunePollInterval
+	PollInterval time.Duration
+}
+
+// FineTuneWatch follows a fine-tuning job started by WaitForFineTune
+type FineTuneWatch struct {
+	events chan openai.FineTuneEvent
+	done   chan struct{}
+	job    openai.FineTuningJob
+	err    error
+}
+
+// Events delivers the job's events oldest first as they appear, and is
+// closed once the job finishes or waiting fails
+func (w *FineTuneWatch) Events() <-chan openai.FineTuneEvent {
+	return w.events
+}
+
+// Wait blocks until the job finishes and returns its final state, discarding
+// any events not yet received from Events. A job that fails or is
+// cancelled returns an error wrapping ErrFineTuneFailed.
+func (w *FineTuneWatch) Wait() (openai.FineTuningJob, error) {
+	for range w.events {
+	}
+	<-w.done
+	return w.job, w.err
+}
+
+// WaitForFineTune polls jobID until it finishes, streaming its events
+// through the returned watch. It records a single "fine_tuning.jobs" event
+// covering the job, with its trained tokens and estimated training cost.
+// Receive from the watch's Events or call Wait, or polling stalls.
+func (c *Client) WaitForFineTune(ctx context.Context, jobID string, opts FineTuneWaitOptions) *FineTuneWatch {
+	if v := c.policyView(ctx); v != nil {
+		return v.WaitForFineTune(ctx, jobID, opts)
+	}
+	w := &FineTuneWatch{
+		events: make(chan openai.FineTuneEvent),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(w.done)
+		startTime := time.Now()
+		requestID := requestIDFor(ctx)
+		ctx, _ := withCallState(ctx, requestID)
+
+		w.job, w.err = c.followFineTune(ctx, jobID, opts, w.events)
+		close(w.events)
+
+		if c.instrumented(ctx) {
+			event := c.newEvent(ctx, requestID, "fine_tuning.jobs", w.job.Model, startTime, w.err)
+			event.JobID = jobID
+			event.TrainedTokens = w.job.TrainedTokens
+			event.TokenUsage = TokenUsage{PromptTokens: w.job.TrainedTokens, TotalTokens: w.job.TrainedTokens}
+			event.CostEstimateUSD = estimateFineTuneCost(w.job.Model, w.job.TrainedTokens)
+			c.recordTelemetry(event)
+		}
+	}()
+	return w
+}
+
+func (c *Client) followFineTune(
+	ctx context.Context,
+	jobID string,
+	opts FineTuneWaitOptions,
+	events chan<- openai.FineTuneEvent,
+) (openai.FineTuningJob, error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultFineTunePollInterval
+	}
+	if err := c.configErr; err != nil {
+		return openai.FineTuningJob{}, err
+	}
+
+	var seen fineTuneCursor
+	for {
+		job, err := c.Client.RetrieveFineTuningJob(ctx, jobID)
+		if err != nil {
+			return job, err
+		}
+		list, err := c.Client.ListFineTuningJobEvents(ctx, jobID)
+		if err != nil {
+			return job, err
+		}
+		for _, event := range seen.fresh(list.Data) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return job, ctx.Err()
+			}
+		}
+
+		switch job.Status {
+		case "succeeded":
+			return job, nil
+		case "failed", "cancelled":
+			return job, fmt.Errorf("%w: %s %s", ErrFineTuneFailed, job.ID, job.Status)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return job, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// fineTuneCursor tracks which job events have been delivered. Events carry
+// no ID, so they are identified by creation time and message.
+type fineTuneCursor struct {
+	latest int64
+	atTime map[string]bool
+}
+
+// fresh returns the events in list, which the API orders newest first, that
+// have not been seen before, oldest first
+func (f *fineTuneCursor) fresh(list []openai.FineTuneEvent) []openai.FineTuneEvent {
+	var out []openai.FineTuneEvent
+	for i := len(list) - 1; i >= 0; i-- {
+		e := list[i]
+		switch {
+		case e.CreatedAt < f.latest:
+			continue
+		case e.CreatedAt > f.latest:
+			f.latest = e.CreatedAt
+			f.atTime = map[string]bool{}
+		case f.atTime[e.Message]:
+			continue
+		}
+		if f.atTime == nil {
+			f.atTime = map[string]bool{}
+		}
+		f.atTime[e.Message] = true
+		out = append(out, e)
+	}
+	return out
+}
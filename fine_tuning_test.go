@@ -0,0 +1,103 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFineTuneServer reports job ft-1 running for two polls, adding an event
+// each poll, then finishing with status final
+func newFineTuneServer(t *testing.T, final string) *httptest.Server {
+	t.Helper()
+	var polls int32
+	events := []string{
+		`{"object":"fine_tuning.job.event","created_at":1,"level":"info","message":"created"}`,
+		`{"object":"fine_tuning.job.event","created_at":2,"level":"info","message":"step 1"}`,
+		`{"object":"fine_tuning.job.event","created_at":2,"level":"info","message":"step 2"}`,
+		`{"object":"fine_tuning.job.event","created_at":3,"level":"info","message":"done"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		n := int(atomic.LoadInt32(&polls))
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/events"):
+			visible := events[:min(n+1, len(events))]
+			var newestFirst []string
+			for i := len(visible) - 1; i >= 0; i-- {
+				newestFirst = append(newestFirst, visible[i])
+			}
+			fmt.Fprintf(w, `{"object":"list","data":[%s]}`, strings.Join(newestFirst, ","))
+		case strings.HasSuffix(r.URL.Path, "/ft-1"):
+			n = int(atomic.AddInt32(&polls, 1))
+			status := "running"
+			if n >= 3 {
+				status = final
+			}
+			fmt.Fprintf(w, `{"id":"ft-1","model":"gpt-4o-mini-2024-07-18","status":%q,"trained_tokens":2000000}`, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWaitForFineTune(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newFineTuneServer(t, "succeeded").URL+"/v1"), withRecorder(rec))
+
+	watch := client.WaitForFineTune(context.Background(), "ft-1", FineTuneWaitOptions{PollInterval: time.Millisecond})
+	var messages []string
+	for e := range watch.Events() {
+		messages = append(messages, e.Message)
+	}
+	job, err := watch.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(messages, ","); got != "created,step 1,step 2,done" {
+		t.Errorf("events = %s", got)
+	}
+	if job.Status != "succeeded" {
+		t.Errorf("job = %+v", job)
+	}
+
+	events := rec.all()
+	final := events[len(events)-1]
+	if final.Endpoint != "fine_tuning.jobs" || final.JobID != "ft-1" || final.TrainedTokens != 2000000 {
+		t.Errorf("event = %+v", final)
+	}
+	if final.CostEstimateUSD != 6.0 {
+		t.Errorf("cost = %v, want gpt-4o-mini training price", final.CostEstimateUSD)
+	}
+}
+
+func TestWaitForFineTuneFailure(t *testing.T) {
+	client := NewClient("test-key", WithBaseURL(newFineTuneServer(t, "failed").URL+"/v1"))
+	_, err := client.WaitForFineTune(context.Background(), "ft-1", FineTuneWaitOptions{PollInterval: time.Millisecond}).Wait()
+	if !errors.Is(err, ErrFineTuneFailed) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestFineTuningWrappersRecordTelemetry(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newFineTuneServer(t, "succeeded").URL+"/v1"), withRecorder(rec))
+	if _, err := client.RetrieveFineTuningJob(context.Background(), "ft-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListFineTuningJobEvents(context.Background(), "ft-1"); err != nil {
+		t.Fatal(err)
+	}
+	events := rec.all()
+	if len(events) != 2 || events[0].Endpoint != "fine_tuning.jobs.retrieve" || events[1].Endpoint != "fine_tuning.jobs.events" {
+		t.Errorf("events = %+v", events)
+	}
+}
@@ -0,0 +1,277 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrGuardRejected matches every GuardError via errors.Is
+var ErrGuardRejected = errors.New("langmesh: request rejected by guard")
+
+// GuardReason is a machine-readable code explaining why a guard rejected a request
+type GuardReason string
+
+const (
+	GuardReasonBudgetExceeded  GuardReason = "budget_exceeded"
+	GuardReasonMaxCostExceeded GuardReason = "max_cost_exceeded"
+	GuardReasonContentFlagged  GuardReason = "content_flagged"
+)
+
+// GuardError is returned when a budget, quota, or max-cost guard rejects a
+// request before it is sent. It carries enough detail for callers to render
+// an actionable message to end users.
+type GuardError struct {
+	Reason GuardReason
+	// Guard names the guard that rejected the request
+	Guard string
+	// CurrentSpendUSD is the spend already counted against the limit
+	CurrentSpendUSD float64
+	// LimitUSD is the configured limit
+	LimitUSD float64
+	// RequestCostUSD is the estimated cost of the rejected request, when known
+	RequestCostUSD float64
+	// ResetAt is when the limit resets; zero if it never does
+	ResetAt time.Time
+	// Categories lists what a content guard flagged
+	Categories []string
+	// Violation describes what a guardrail or quota rejected
+	Violation string
+	// User is the user a quota rejected
+	User string
+}
+
+func (e *GuardError) Error() string {
+	if e.Reason == GuardReasonGuardrail || e.Reason == GuardReasonLoopDetected || e.Reason == GuardReasonModelNotAllowed {
+		return fmt.Sprintf("langmesh: %s rejected request (%s): %s", e.Guard, e.Reason, e.Violation)
+	}
+	if e.Reason == GuardReasonQuotaExceeded {
+		msg := fmt.Sprintf("langmesh: %s rejected request (%s): user %q used %s", e.Guard, e.Reason, e.User, e.Violation)
+		if !e.ResetAt.IsZero() {
+			msg += ", resets at " + e.ResetAt.Format(time.RFC3339)
+		}
+		return msg
+	}
+	if e.Reason == GuardReasonContentFlagged {
+		msg := fmt.Sprintf("langmesh: %s rejected request (%s)", e.Guard, e.Reason)
+		if len(e.Categories) > 0 {
+			msg += ": " + strings.Join(e.Categories, ", ")
+		}
+		return msg
+	}
+	msg := fmt.Sprintf("langmesh: %s rejected request (%s): spend $%.4f of $%.4f limit",
+		e.Guard, e.Reason, e.CurrentSpendUSD, e.LimitUSD)
+	if e.RequestCostUSD > 0 {
+		msg += fmt.Sprintf(", request estimated at $%.4f", e.RequestCostUSD)
+	}
+	if !e.ResetAt.IsZero() {
+		msg += ", resets at " + e.ResetAt.Format(time.RFC3339)
+	}
+	return msg
+}
+
+// Is reports whether target is ErrGuardRejected, or ErrLoopDetected for
+// loop detection
+func (e *GuardError) Is(target error) bool {
+	return target == ErrGuardRejected || (target == ErrLoopDetected && e.Reason == GuardReasonLoopDetected)
+}
+
+// requestGuard inspects a chat request before client sends it
+type requestGuard interface {
+	check(ctx context.Context, c *Client, request openai.ChatCompletionRequest) error
+}
+
+// costGuard is a requestGuard limiting spend, which embeddings and the
+// Responses API are checked against too, given their model and estimated
+// input and maximum output tokens
+type costGuard interface {
+	checkCost(ctx context.Context, c *Client, model string, promptTokens, maxTokens int) error
+}
+
+// Budget caps spend over a fixed window. A Budget may be shared between
+// clients to enforce one limit across them.
+type Budget struct {
+	limit       float64
+	window      time.Duration
+	mu          sync.Mutex
+	spent       Money
+	windowStart time.Time
+	now         func() time.Time
+}
+
+// NewBudget creates a budget allowing limitUSD of spend per window. A zero
+// window never resets.
+func NewBudget(limitUSD float64, window time.Duration) *Budget {
+	return &Budget{
+		limit:       limitUSD,
+		window:      window,
+		windowStart: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// reconfigure changes the budget's limit and window, keeping its spend
+func (b *Budget) reconfigure(limitUSD float64, window time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit, b.window = limitUSD, window
+	b.roll()
+}
+
+// WithBudget rejects requests with a GuardError once b is exhausted. Chat
+// completions, embeddings and the Responses API are checked; all calls'
+// costs are counted.
+func WithBudget(b *Budget) Option {
+	return func(c *Client) {
+		c.guards = append(c.guards, b)
+		c.observers = append(c.observers, b)
+	}
+}
+
+// Spent returns the spend counted in the current window
+func (b *Budget) Spent() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	return b.spent.Float64()
+}
+
+// ResetAt returns when the current window ends
+func (b *Budget) ResetAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	return b.resetAt()
+}
+
+func (b *Budget) resetAt() time.Time {
+	if b.window <= 0 {
+		return time.Time{}
+	}
+	return b.windowStart.Add(b.window)
+}
+
+func (b *Budget) roll() {
+	if b.window <= 0 {
+		return
+	}
+	now := b.now()
+	for !now.Before(b.windowStart.Add(b.window)) {
+		b.windowStart = b.windowStart.Add(b.window)
+		b.spent = 0
+	}
+}
+
+func (b *Budget) check(context.Context, *Client, openai.ChatCompletionRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	if b.spent < MoneyFromFloat(b.limit) {
+		return nil
+	}
+	return &GuardError{
+		Reason:          GuardReasonBudgetExceeded,
+		Guard:           "budget",
+		CurrentSpendUSD: b.spent.Float64(),
+		LimitUSD:        b.limit,
+		ResetAt:         b.resetAt(),
+	}
+}
+
+func (b *Budget) checkCost(ctx context.Context, c *Client, _ string, _, _ int) error {
+	return b.check(ctx, c, openai.ChatCompletionRequest{})
+}
+
+func (b *Budget) observe(event TelemetryEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.spent += MoneyFromFloat(event.CostEstimateUSD)
+}
+
+// maxCostGuard rejects requests whose worst-case cost exceeds a ceiling
+type maxCostGuard struct {
+	limit float64
+}
+
+// WithMaxRequestCost rejects requests whose worst-case cost, estimated from
+// the prompt and MaxTokens, exceeds limitUSD: chat completions, embeddings,
+// and Responses API requests, costed on their input and MaxOutputTokens.
+// Requests without a maximum are costed on the prompt alone.
+func WithMaxRequestCost(limitUSD float64) Option {
+	return func(c *Client) {
+		c.guards = append(c.guards, maxCostGuard{limit: limitUSD})
+	}
+}
+
+func (g maxCostGuard) check(ctx context.Context, c *Client, request openai.ChatCompletionRequest) error {
+	return g.checkCost(ctx, c, request.Model, c.countPromptTokens(request.Model, request.Messages), request.MaxTokens)
+}
+
+func (g maxCostGuard) checkCost(_ context.Context, c *Client, model string, promptTokens, maxTokens int) error {
+	cost := c.estimateCost(model, promptTokens, maxTokens)
+	if cost <= g.limit {
+		return nil
+	}
+	return &GuardError{
+		Reason:         GuardReasonMaxCostExceeded,
+		Guard:          "max_request_cost",
+		LimitUSD:       g.limit,
+		RequestCostUSD: cost,
+	}
+}
+
+func (c *Client) checkGuards(ctx context.Context, request openai.ChatCompletionRequest) error {
+	for _, g := range c.guards {
+		if err := g.check(ctx, c, request); err != nil {
+			c.logRejection(ctx, request.Model, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCostGuards runs the spend guards for a call to an endpoint other
+// than chat
+func (c *Client) checkCostGuards(ctx context.Context, model string, promptTokens, maxTokens int) error {
+	for _, g := range c.guards {
+		if cg, ok := g.(costGuard); ok {
+			if err := cg.checkCost(ctx, c, model, promptTokens, maxTokens); err != nil {
+				c.logRejection(ctx, model, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) logRejection(ctx context.Context, model string, err error) {
+	var guardErr *GuardError
+	if errors.As(err, &guardErr) && (guardErr.Reason == GuardReasonBudgetExceeded ||
+		guardErr.Reason == GuardReasonMaxCostExceeded || guardErr.Reason == GuardReasonQuotaExceeded ||
+		guardErr.Reason == GuardReasonLoopDetected) {
+		c.log(ctx, LogBudget, "request rejected",
+			"guard", guardErr.Guard, "reason", string(guardErr.Reason), "model", model, "error", err)
+	}
+}
+
+// inputText is the text of an embeddings or Responses API input, for
+// estimating its tokens: strings as they are, anything else as JSON
+func inputText(input any) string {
+	switch v := input.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, "\n")
+	}
+	data, _ := json.Marshal(input)
+	return string(data)
+}
@@ -0,0 +1,94 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestBudgetGuardError(t *testing.T) {
+	b := NewBudget(1.0, time.Hour)
+	start := b.windowStart
+	b.now = func() time.Time { return start.Add(10 * time.Minute) }
+	b.observe(TelemetryEvent{CostEstimateUSD: 1.25})
+
+	client := NewClient("test-key", WithBudget(b))
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"})
+
+	if !errors.Is(err, ErrGuardRejected) {
+		t.Fatalf("expected ErrGuardRejected, got %v", err)
+	}
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) {
+		t.Fatalf("expected *GuardError, got %T", err)
+	}
+	if guardErr.Reason != GuardReasonBudgetExceeded {
+		t.Errorf("reason = %q", guardErr.Reason)
+	}
+	if guardErr.CurrentSpendUSD != 1.25 || guardErr.LimitUSD != 1.0 {
+		t.Errorf("spend/limit = %v/%v", guardErr.CurrentSpendUSD, guardErr.LimitUSD)
+	}
+	if !guardErr.ResetAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("reset at = %v, want %v", guardErr.ResetAt, start.Add(time.Hour))
+	}
+
+	b.now = func() time.Time { return start.Add(61 * time.Minute) }
+	if b.Spent() != 0 {
+		t.Errorf("expected spend to reset after window, got %v", b.Spent())
+	}
+}
+
+func TestMaxRequestCostGuard(t *testing.T) {
+	g := maxCostGuard{limit: 0.01}
+	err := g.check(context.Background(), nil, openai.ChatCompletionRequest{Model: "gpt-4", MaxTokens: 4000})
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.Reason != GuardReasonMaxCostExceeded {
+		t.Fatalf("expected max cost rejection, got %v", err)
+	}
+	if guardErr.RequestCostUSD <= 0.01 {
+		t.Errorf("request cost = %v", guardErr.RequestCostUSD)
+	}
+	if err := g.check(context.Background(), nil, openai.ChatCompletionRequest{Model: "gpt-4o-mini", MaxTokens: 100}); err != nil {
+		t.Errorf("cheap request rejected: %v", err)
+	}
+}
+
+func TestSpendGuardsCoverEmbeddingsAndResponses(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unexpected call", http.StatusTeapot)
+	}))
+	t.Cleanup(srv.Close)
+
+	b := NewBudget(1.0, time.Hour)
+	b.observe(TelemetryEvent{CostEstimateUSD: 1.25})
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithBudget(b))
+	ctx := context.Background()
+
+	_, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{Model: openai.SmallEmbedding3, Input: []string{"a", "b"}})
+	if !errors.Is(err, ErrGuardRejected) {
+		t.Errorf("embeddings: err = %v", err)
+	}
+	if _, err := client.CreateResponse(ctx, ResponseRequest{Model: "gpt-4o", Input: "hi"}); !errors.Is(err, ErrGuardRejected) {
+		t.Errorf("responses: err = %v", err)
+	}
+	if _, err := client.StreamResponse(ctx, ResponseRequest{Model: "gpt-4o", Input: "hi"}); !errors.Is(err, ErrGuardRejected) {
+		t.Errorf("streamed responses: err = %v", err)
+	}
+
+	capped := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithMaxRequestCost(0.01))
+	_, err = capped.CreateResponse(ctx, ResponseRequest{Model: "gpt-4", Input: "hi", MaxOutputTokens: 4000})
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.Reason != GuardReasonMaxCostExceeded {
+		t.Errorf("max cost: err = %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("rejected requests reached the server %d times", calls)
+	}
+}
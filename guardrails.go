@@ -0,0 +1,307 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// GuardReasonGuardrail is the GuardError reason for a blocking guardrail
+const GuardReasonGuardrail GuardReason = "guardrail_violation"
+
+// Guardrail validates chat requests before they are sent and responses
+// before they are returned. Each check returns a description of the
+// violation, or "" if the request or response passes.
+type Guardrail interface {
+	Name() string
+	CheckRequest(ctx context.Context, request openai.ChatCompletionRequest) string
+	CheckResponse(ctx context.Context, request openai.ChatCompletionRequest, response openai.ChatCompletionResponse) string
+}
+
+// GuardrailAction is what the client does when a guardrail reports a
+// violation
+type GuardrailAction int
+
+const (
+	// GuardrailBlock fails the call with a GuardError carrying
+	// GuardReasonGuardrail
+	GuardrailBlock GuardrailAction = iota
+	// GuardrailRetry resends a rejected response's request with the
+	// violation added as a system instruction, up to the retry limit, and
+	// then blocks. Request violations cannot be retried and block at once.
+	GuardrailRetry
+	// GuardrailAnnotate lets the call through and records the violation in
+	// the telemetry event's GuardrailViolations
+	GuardrailAnnotate
+)
+
+// DefaultGuardrailRetries is how many times GuardrailRetry resends a
+// request unless WithGuardrailRetries overrides it
+const DefaultGuardrailRetries = 1
+
+type guardrailRule struct {
+	guardrail Guardrail
+	action    GuardrailAction
+}
+
+// WithGuardrail applies g to every chat completion, taking action on
+// violations. Streams are checked on the request only.
+func WithGuardrail(g Guardrail, action GuardrailAction) Option {
+	return func(c *Client) {
+		c.guardrails = append(c.guardrails, guardrailRule{guardrail: g, action: action})
+	}
+}
+
+// WithGuardrailRetries sets how many times GuardrailRetry resends a request
+func WithGuardrailRetries(n int) Option {
+	return func(c *Client) {
+		c.guardrailRetries = &n
+	}
+}
+
+func (c *Client) guardrailRetryLimit() int {
+	if c.guardrailRetries != nil {
+		return *c.guardrailRetries
+	}
+	return DefaultGuardrailRetries
+}
+
+func guardrailError(name, violation string) error {
+	return &GuardError{Reason: GuardReasonGuardrail, Guard: name, Violation: violation}
+}
+
+// checkRequestGuardrails runs the request checks, returning the violations
+// to annotate or the error of the first blocking one
+func (c *Client) checkRequestGuardrails(ctx context.Context, request openai.ChatCompletionRequest) ([]string, error) {
+	var annotations []string
+	for _, rule := range c.guardrails {
+		violation := rule.guardrail.CheckRequest(ctx, request)
+		if violation == "" {
+			continue
+		}
+		if rule.action == GuardrailAnnotate {
+			annotations = append(annotations, rule.guardrail.Name()+": "+violation)
+			continue
+		}
+		return annotations, guardrailError(rule.guardrail.Name(), violation)
+	}
+	return annotations, nil
+}
+
+// checkResponseGuardrails runs the response checks on resp, retrying as
+// configured. It returns the response to hand back, the usage of every
+// attempt including retries, and the violations to annotate.
+func (c *Client) checkResponseGuardrails(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	resp openai.ChatCompletionResponse,
+	annotations []string,
+) (openai.ChatCompletionResponse, openai.Usage, []string, error) {
+	annotations = annotations[:len(annotations):len(annotations)]
+	usage := resp.Usage
+	for retries := 0; ; retries++ {
+		// Only the violations of the response handed back are annotated
+		noted := annotations
+		var retry *guardrailRule
+		var violation string
+		for i, rule := range c.guardrails {
+			violation = rule.guardrail.CheckResponse(ctx, request, resp)
+			if violation == "" {
+				continue
+			}
+			if rule.action == GuardrailAnnotate {
+				noted = append(noted, rule.guardrail.Name()+": "+violation)
+				continue
+			}
+			retry = &c.guardrails[i]
+			break
+		}
+		if retry == nil {
+			return resp, usage, noted, nil
+		}
+		if retry.action == GuardrailBlock || retries >= c.guardrailRetryLimit() {
+			return resp, usage, noted, guardrailError(retry.guardrail.Name(), violation)
+		}
+
+		c.log(ctx, LogRetry, "retrying after guardrail violation",
+			"guardrail", retry.guardrail.Name(), "violation", violation, "model", request.Model)
+		stricter := request
+		stricter.Messages = append(append([]openai.ChatCompletionMessage(nil), request.Messages...),
+			responseMessage(resp),
+			openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleSystem,
+				Content: fmt.Sprintf("Your previous response was rejected: %s. "+
+					"Respond again and make sure the new response does not repeat the problem.", violation),
+			})
+		next, _, err := withFallback(ctx, c, stricter, false, c.Client.CreateChatCompletion)
+		if err != nil {
+			return resp, usage, annotations, err
+		}
+		resp = next
+		usage.PromptTokens += next.Usage.PromptTokens
+		usage.CompletionTokens += next.Usage.CompletionTokens
+		usage.TotalTokens += next.Usage.TotalTokens
+	}
+}
+
+func responseMessage(resp openai.ChatCompletionResponse) openai.ChatCompletionMessage {
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	}
+	return resp.Choices[0].Message
+}
+
+func responseText(resp openai.ChatCompletionResponse) string {
+	var b strings.Builder
+	for _, choice := range resp.Choices {
+		b.WriteString(choice.Message.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// requestOnly and responseOnly fill in the phase a built-in guardrail does
+// not check
+type requestOnly struct{}
+
+func (requestOnly) CheckResponse(context.Context, openai.ChatCompletionRequest, openai.ChatCompletionResponse) string {
+	return ""
+}
+
+type responseOnly struct{}
+
+func (responseOnly) CheckRequest(context.Context, openai.ChatCompletionRequest) string {
+	return ""
+}
+
+type maxPromptLength struct {
+	requestOnly
+	limit int
+}
+
+// MaxPromptLength rejects requests whose messages total more than limit
+// characters
+func MaxPromptLength(limit int) Guardrail {
+	return maxPromptLength{limit: limit}
+}
+
+func (g maxPromptLength) Name() string { return "max_prompt_length" }
+
+func (g maxPromptLength) CheckRequest(_ context.Context, request openai.ChatCompletionRequest) string {
+	n := 0
+	for _, m := range request.Messages {
+		n += len([]rune(m.Content))
+		for _, part := range m.MultiContent {
+			n += len([]rune(part.Text))
+		}
+	}
+	if n > g.limit {
+		return fmt.Sprintf("prompt is %d characters, limit %d", n, g.limit)
+	}
+	return ""
+}
+
+// keywordGuardrail flags whole-word, case-insensitive matches in requests
+// and responses
+type keywordGuardrail struct {
+	name    string
+	label   string
+	pattern *regexp.Regexp
+}
+
+func newKeywordGuardrail(name, label string, words []string) keywordGuardrail {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	g := keywordGuardrail{name: name, label: label}
+	if len(quoted) > 0 {
+		g.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return g
+}
+
+func (g keywordGuardrail) Name() string { return g.name }
+
+func (g keywordGuardrail) match(text string) string {
+	if g.pattern == nil {
+		return ""
+	}
+	if found := g.pattern.FindString(text); found != "" {
+		return fmt.Sprintf("%s %q", g.label, strings.ToLower(found))
+	}
+	return ""
+}
+
+func (g keywordGuardrail) CheckRequest(_ context.Context, request openai.ChatCompletionRequest) string {
+	return g.match(renderMessages(request.Messages))
+}
+
+func (g keywordGuardrail) CheckResponse(_ context.Context, _ openai.ChatCompletionRequest, response openai.ChatCompletionResponse) string {
+	return g.match(responseText(response))
+}
+
+// BannedTopics flags requests and responses mentioning any of keywords,
+// matched as whole words regardless of case
+func BannedTopics(keywords ...string) Guardrail {
+	return newKeywordGuardrail("banned_topics", "mentions banned topic", keywords)
+}
+
+// profanity is the built-in word list used by ProfanityFilter
+var profanity = []string{
+	"asshole", "bastard", "bitch", "bullshit", "crap", "damn", "dick",
+	"fuck", "fucking", "motherfucker", "piss", "shit", "slut", "whore",
+}
+
+// ProfanityFilter flags requests and responses containing profanity from a
+// built-in English word list, extended by extra
+func ProfanityFilter(extra ...string) Guardrail {
+	return newKeywordGuardrail("profanity", "contains profanity", append(append([]string(nil), profanity...), extra...))
+}
+
+type validJSON struct {
+	responseOnly
+}
+
+// ValidJSON rejects responses whose content is not valid JSON, for use with
+// JSON mode or prompts asking for JSON
+func ValidJSON() Guardrail {
+	return validJSON{}
+}
+
+func (validJSON) Name() string { return "valid_json" }
+
+func (validJSON) CheckResponse(_ context.Context, _ openai.ChatCompletionRequest, response openai.ChatCompletionResponse) string {
+	for i, choice := range response.Choices {
+		if !json.Valid([]byte(choice.Message.Content)) {
+			return fmt.Sprintf("choice %d is not valid JSON", i)
+		}
+	}
+	return ""
+}
+
+type maxOutputTokens struct {
+	responseOnly
+	limit int
+}
+
+// MaxOutputTokens rejects responses that used more than limit completion
+// tokens
+func MaxOutputTokens(limit int) Guardrail {
+	return maxOutputTokens{limit: limit}
+}
+
+func (maxOutputTokens) Name() string { return "max_output_tokens" }
+
+func (g maxOutputTokens) CheckResponse(_ context.Context, _ openai.ChatCompletionRequest, response openai.ChatCompletionResponse) string {
+	if n := response.Usage.CompletionTokens; n > g.limit {
+		return fmt.Sprintf("response used %d completion tokens, limit %d", n, g.limit)
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func chatRequest(content string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: content}},
+	}
+}
+
+func TestGuardrailBlocksRequest(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence("ok"))
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithGuardrail(BannedTopics("Elections"), GuardrailBlock),
+	)
+
+	_, err := client.CreateChatCompletion(context.Background(), chatRequest("who will win the elections?"))
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.Reason != GuardReasonGuardrail || guardErr.Guard != "banned_topics" {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(err.Error(), `"elections"`) {
+		t.Errorf("error does not name the topic: %v", err)
+	}
+	if n := len(requests()); n != 0 {
+		t.Errorf("blocked request was sent %d times", n)
+	}
+	if event := rec.all()[0]; event.ErrorClass != "GuardRejected" {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestGuardrailRetriesWithStricterPrompt(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence("sure, here you go", `{"answer":42}`))
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithGuardrail(ValidJSON(), GuardrailRetry),
+	)
+
+	resp, err := client.CreateChatCompletion(context.Background(), chatRequest("answer in JSON"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != `{"answer":42}` {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+	sent := requests()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests", len(sent))
+	}
+	retry := sent[1].Messages
+	if len(retry) != 3 || retry[1].Content != "sure, here you go" || retry[2].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("retry messages = %+v", retry)
+	}
+	if event := rec.all()[0]; event.TokenUsage.TotalTokens != 28 {
+		t.Errorf("usage of both attempts not recorded: %+v", event.TokenUsage)
+	}
+}
+
+func TestGuardrailRetryLimit(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence("not json"))
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithGuardrail(ValidJSON(), GuardrailRetry),
+		WithGuardrailRetries(2),
+	)
+
+	_, err := client.CreateChatCompletion(context.Background(), chatRequest("answer in JSON"))
+	if !errors.Is(err, ErrGuardRejected) {
+		t.Fatalf("err = %v", err)
+	}
+	if n := len(requests()); n != 3 {
+		t.Errorf("sent %d requests, want the original and 2 retries", n)
+	}
+	if event := rec.all()[0]; event.CostEstimateUSD == 0 {
+		t.Error("rejected responses were not costed")
+	}
+}
+
+func TestGuardrailAnnotates(t *testing.T) {
+	srv, _ := newRecordingServer(t, replySequence("well damn, that's a long answer"))
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithGuardrail(MaxPromptLength(5), GuardrailAnnotate),
+		WithGuardrail(ProfanityFilter(), GuardrailAnnotate),
+		WithGuardrail(MaxOutputTokens(3), GuardrailAnnotate),
+	)
+
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("a longer prompt")); err != nil {
+		t.Fatal(err)
+	}
+	got := rec.all()[0].GuardrailViolations
+	want := []string{
+		"max_prompt_length: prompt is 15 characters, limit 5",
+		`profanity: contains profanity "damn"`,
+		"max_output_tokens: response used 4 completion tokens, limit 3",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations = %q", got)
+	}
+}
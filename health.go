@@ -0,0 +1,127 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// HealthCheckResult is the outcome of one health probe
+type HealthCheckResult struct {
+	// Provider is the backend probed: "openai", "anthropic" or "local"
+	Provider string `json:"provider"`
+	// Model is the model sent a completion, or empty for the models list
+	Model string `json:"model,omitempty"`
+	// Reachable is set when the backend answered, even with an error
+	Reachable bool `json:"reachable"`
+	// AuthOK is set when the backend accepted the credentials
+	AuthOK bool `json:"auth_ok"`
+	// Succeeded is set when the probe got a successful response
+	Succeeded bool          `json:"succeeded"`
+	Latency   time.Duration `json:"latency_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Health is the client's view of its backends
+type Health struct {
+	// Healthy is set when every probe succeeded
+	Healthy bool                `json:"healthy"`
+	Checks  []HealthCheckResult `json:"checks"`
+}
+
+// HealthCheck probes the configured backend by listing its models, and
+// each of models with a one-token chat completion, so backends reached
+// only for some models, such as Anthropic's, are covered too. Probes run
+// concurrently within ctx. The completions are recorded as
+// "chat.completions.health" events; the models list is free and is not.
+// Calling it at startup also warms up the connection pool.
+func (c *Client) HealthCheck(ctx context.Context, models ...string) Health {
+	results := make([]HealthCheckResult, len(models)+1)
+	var wg sync.WaitGroup
+	wg.Add(len(results))
+	go func() {
+		defer wg.Done()
+		results[0] = c.probeModels(ctx)
+	}()
+	for i, model := range models {
+		go func(i int, model string) {
+			defer wg.Done()
+			results[i+1] = c.probeCompletion(ctx, model)
+		}(i, model)
+	}
+	wg.Wait()
+
+	health := Health{Healthy: true, Checks: results}
+	for _, r := range results {
+		health.Healthy = health.Healthy && r.Succeeded
+	}
+	return health
+}
+
+// HealthHandler serves HealthCheck as JSON, with status 503 when
+// unhealthy, for readiness probes
+func (c *Client) HealthHandler(models ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := c.HealthCheck(r.Context(), models...)
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
+func (c *Client) probeModels(ctx context.Context) HealthCheckResult {
+	provider := providerOpenAI
+	if c.local != nil {
+		provider = providerLocal
+	}
+	ctx, _ = withCallState(ctx, requestIDFor(ctx))
+	start := time.Now()
+	_, err := c.Client.ListModels(ctx)
+	return healthResult(provider, "", time.Since(start), err)
+}
+
+func (c *Client) probeCompletion(ctx context.Context, model string) HealthCheckResult {
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+	ctx, _ = withCallState(ctx, requestID)
+	resp, err := c.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     model,
+		MaxTokens: 1,
+		Messages:  []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping"}},
+	})
+	latency := time.Since(startTime)
+
+	if c.instrumented(ctx) {
+		event := c.newEvent(ctx, requestID, "chat.completions.health", model, startTime, err)
+		if err == nil {
+			event.TokenUsage = TokenUsage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
+			}
+			event.CostEstimateUSD = c.estimateCost(model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		}
+		c.recordTelemetry(event)
+	}
+
+	return healthResult(c.providerFor(model), model, latency, err)
+}
+
+func healthResult(provider, model string, latency time.Duration, err error) HealthCheckResult {
+	result := HealthCheckResult{Provider: provider, Model: model, Latency: latency}
+	if err == nil {
+		result.Reachable, result.AuthOK, result.Succeeded = true, true, true
+		return result
+	}
+	result.Error = err.Error()
+	_, status, _, _ := classifyUpstream(err)
+	result.Reachable = status != 0
+	result.AuthOK = result.Reachable && status != http.StatusUnauthorized && status != http.StatusForbidden
+	return result
+}
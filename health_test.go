@@ -0,0 +1,75 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model"}]}`))
+		case "/v1/chat/completions":
+			var body struct {
+				Model     string `json:"model"`
+				MaxTokens int    `json:"max_tokens"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Model == "gpt-retired" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"message":"no such model","type":"invalid_request_error","code":"model_not_found"}}`))
+				return
+			}
+			if body.MaxTokens != 1 {
+				t.Errorf("max_tokens = %d", body.MaxTokens)
+			}
+			w.Write([]byte(chatResponseBody))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithUninstrumentedCalls(UninstrumentedFail))
+	health := client.HealthCheck(context.Background(), "gpt-4o-mini")
+	if !health.Healthy || len(health.Checks) != 2 {
+		t.Fatalf("health = %+v", health)
+	}
+	if c := health.Checks[0]; c.Provider != "openai" || c.Model != "" || !c.AuthOK || c.Latency <= 0 {
+		t.Errorf("models check = %+v", c)
+	}
+	if events := rec.all(); len(events) != 1 || events[0].Endpoint != "chat.completions.health" {
+		t.Errorf("events = %+v", events)
+	}
+
+	health = client.HealthCheck(context.Background(), "gpt-retired")
+	if c := health.Checks[1]; health.Healthy || !c.Reachable || !c.AuthOK || c.Succeeded || c.Error == "" {
+		t.Errorf("failed check = %+v", health)
+	}
+
+	w := httptest.NewRecorder()
+	client.HealthHandler("gpt-retired").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d", w.Code)
+	}
+}
+
+func TestHealthCheckUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"bad key","type":"invalid_request_error","code":"invalid_api_key"}}`))
+	}))
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	if c := client.HealthCheck(context.Background()).Checks[0]; !c.Reachable || c.AuthOK {
+		t.Errorf("bad key check = %+v", c)
+	}
+	srv.Close()
+	if c := client.HealthCheck(context.Background()).Checks[0]; c.Reachable || c.Succeeded {
+		t.Errorf("closed server check = %+v", c)
+	}
+}
@@ -0,0 +1,209 @@
+package langmesh
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultHedgeDelay is how long a chat call waits before hedging while
+// too few calls to its model have completed to know their p95
+const DefaultHedgeDelay = 2 * time.Second
+
+// hedgeMinSamples is how many completed calls a model needs before its
+// p95 latency sets the hedge delay
+const hedgeMinSamples = 20
+
+// hedgeRefresh is how many completed calls to a model pass between
+// recomputing its p95, so choosing a delay never sorts samples
+const hedgeRefresh = 32
+
+// Hedging configures WithHedging
+type Hedging struct {
+	// Delay is how long the primary request may run before the hedge is
+	// sent; zero uses the p95 latency of recent calls to the model,
+	// recomputed every 32 calls
+	Delay time.Duration
+	// Model serves the hedge, e.g. a cheaper one; empty resends the
+	// request's model
+	Model string
+}
+
+// HedgeInfo describes the hedge of a chat call
+type HedgeInfo struct {
+	Model   string `json:"model"`
+	DelayMs int64  `json:"delay_ms"`
+	// Won is set when the hedge's response was used
+	Won bool `json:"won"`
+	// ExtraCostUSD estimates the prompt tokens of the cancelled request,
+	// which are billed even though its response was discarded
+	ExtraCostUSD float64 `json:"extra_cost_usd"`
+}
+
+// WithHedging reduces tail latency of chat completions: when a request
+// has not returned within the hedge delay, a duplicate is sent, to
+// cfg.Model if set, and whichever succeeds first is used while the other
+// is cancelled. A call that fails fast is returned as is, without
+// hedging. The call's telemetry event reports the hedge in Hedge, and
+// once the hedge is sent its cost includes the cancelled request's prompt.
+// Streaming calls are not hedged.
+func WithHedging(cfg Hedging) Option {
+	return func(c *Client) {
+		c.hedging = &hedger{cfg: cfg, latency: make(map[string]*hedgeLatency)}
+	}
+}
+
+type hedger struct {
+	cfg Hedging
+
+	mu      sync.Mutex
+	latency map[string]*hedgeLatency
+}
+
+// hedgeLatency is a model's recent latencies and their cached p95
+type hedgeLatency struct {
+	window   latencyWindow
+	observed atomic.Int64
+	// p95 is zero until hedgeMinSamples calls have completed
+	p95 atomic.Int64
+}
+
+// delay returns how long a call to model runs before it is hedged
+func (h *hedger) delay(model string) time.Duration {
+	if h.cfg.Delay > 0 {
+		return h.cfg.Delay
+	}
+	h.mu.Lock()
+	w := h.latency[model]
+	h.mu.Unlock()
+	if w != nil {
+		if p95 := time.Duration(w.p95.Load()); p95 > 0 {
+			return p95
+		}
+	}
+	return DefaultHedgeDelay
+}
+
+func (h *hedger) observe(model string, d time.Duration) {
+	h.mu.Lock()
+	w, ok := h.latency[model]
+	if !ok {
+		w = &hedgeLatency{}
+		h.latency[model] = w
+	}
+	h.mu.Unlock()
+	w.window.add(d)
+	if n := w.observed.Add(1); n == hedgeMinSamples || (n > hedgeMinSamples && n%hedgeRefresh == 0) {
+		w.p95.Store(int64(w.window.summary().P95))
+	}
+}
+
+type hedgeResult struct {
+	resp   openai.ChatCompletionResponse
+	err    error
+	hedged bool
+}
+
+// hedge wraps call so slow requests are raced against a duplicate
+func (c *Client) hedge(
+	call func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error),
+) func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	h := c.hedging
+	if h == nil {
+		return call
+	}
+	return func(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+		results := make(chan hedgeResult, 2)
+		run := func(ctx context.Context, request openai.ChatCompletionRequest, hedged bool) context.CancelFunc {
+			ctx, cancel := context.WithCancel(ctx)
+			c.goroutine("hedge", func() {
+				start := time.Now()
+				resp, err := call(ctx, request)
+				if err == nil {
+					h.observe(request.Model, time.Since(start))
+				}
+				results <- hedgeResult{resp: resp, err: err, hedged: hedged}
+			})
+			return cancel
+		}
+
+		state := callStateFrom(ctx)
+		delay := h.delay(request.Model)
+		cancelPrimary := run(ctx, request, false)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case r := <-results:
+			cancelPrimary()
+			return r.resp, r.err
+		case <-timer.C:
+		case <-ctx.Done():
+			cancelPrimary()
+			return openai.ChatCompletionResponse{}, ctx.Err()
+		}
+
+		hedged := request
+		if h.cfg.Model != "" {
+			hedged.Model = h.cfg.Model
+		}
+		// The hedge records its upstream metadata apart, so the loser's
+		// cannot overwrite the winner's
+		hedgeCtx, hedgeState := withCallState(ctx, state.id())
+		cancelHedge := run(hedgeCtx, hedged, true)
+		c.log(ctx, LogRetry, "hedging slow request", "model", request.Model, "hedge", hedged.Model, "delay", delay)
+
+		winner := <-results
+		if winner.err != nil {
+			// The other request may still succeed; if both fail, the
+			// primary's error is returned
+			if other := <-results; other.err == nil || winner.hedged {
+				winner = other
+			}
+		}
+		cancelPrimary()
+		cancelHedge()
+
+		info := &HedgeInfo{Model: hedged.Model, DelayMs: delay.Milliseconds(), Won: winner.hedged}
+		if winner.hedged {
+			state.adopt(hedgeState)
+		}
+		if state != nil {
+			state.mu.Lock()
+			state.hedge = info
+			state.mu.Unlock()
+		}
+		return winner.resp, winner.err
+	}
+}
+
+// adopt takes the upstream metadata of other, whose response was used
+func (s *callState) adopt(other *callState) {
+	if s == nil {
+		return
+	}
+	other.mu.Lock()
+	header, status, tier, key := other.header, other.statusCode, other.serviceTier, other.apiKeyID
+	other.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header, s.statusCode, s.serviceTier, s.apiKeyID = header, status, tier, key
+}
+
+// applyHedge prices a hedged call: the model that answered pays for the
+// response, and the cancelled request for its prompt
+func (c *Client) applyHedge(event *TelemetryEvent, requested string, usage openai.Usage) {
+	info := event.Hedge
+	if info == nil {
+		return
+	}
+	loser := info.Model
+	if info.Won {
+		event.CostEstimateUSD = c.estimateCost(info.Model, usage.PromptTokens, usage.CompletionTokens)
+		loser = requested
+	}
+	info.ExtraCostUSD = c.estimateCost(loser, usage.PromptTokens, 0)
+	event.CostEstimateUSD = addUSD(event.CostEstimateUSD, info.ExtraCostUSD)
+}
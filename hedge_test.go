@@ -0,0 +1,99 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	var cancelled int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Model == "gpt-4o" && slow.Load() {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":1000,"completion_tokens":100,"total_tokens":1100}}`,
+			body.Model, body.Model)
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithHedging(Hedging{Delay: 50 * time.Millisecond, Model: "gpt-4o-mini"}))
+	request := chatRequest("hi")
+	request.Model = "gpt-4o"
+
+	start := time.Now()
+	resp, err := client.CreateChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "gpt-4o-mini" || time.Since(start) > time.Second {
+		t.Errorf("got %q after %v, want the hedge's response", resp.Choices[0].Message.Content, time.Since(start))
+	}
+	event := rec.all()[0]
+	if event.Hedge == nil || !event.Hedge.Won || event.Hedge.Model != "gpt-4o-mini" || event.Hedge.DelayMs != 50 {
+		t.Fatalf("hedge = %+v", event.Hedge)
+	}
+	// The hedge's tokens at its price, plus the primary's prompt at gpt-4o's
+	extra := client.estimateCost("gpt-4o", 1000, 0)
+	if want := client.estimateCost("gpt-4o-mini", 1000, 100) + extra; event.Hedge.ExtraCostUSD != extra || event.CostEstimateUSD != want {
+		t.Errorf("cost = %v (extra %v), want %v", event.CostEstimateUSD, event.Hedge.ExtraCostUSD, want)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("losing request was not cancelled")
+	}
+
+	slow.Store(false)
+	if _, err := client.CreateChatCompletion(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if event := rec.all()[1]; event.Hedge != nil {
+		t.Errorf("fast call hedged: %+v", event.Hedge)
+	}
+}
+
+func TestHedgeDelayFollowsP95(t *testing.T) {
+	h := &hedger{latency: make(map[string]*hedgeLatency)}
+	if d := h.delay("gpt-4o"); d != DefaultHedgeDelay {
+		t.Errorf("delay = %v before any samples", d)
+	}
+	for i := 1; i <= 3*hedgeRefresh; i++ {
+		h.observe("gpt-4o", time.Duration(i)*10*time.Millisecond)
+	}
+	if d := h.delay("gpt-4o"); d != 910*time.Millisecond {
+		t.Errorf("delay = %v, want p95", d)
+	}
+	// The p95 is cached until the next refresh
+	for i := 1; i < hedgeRefresh; i++ {
+		h.observe("gpt-4o", 10*time.Second)
+	}
+	if d := h.delay("gpt-4o"); d != 910*time.Millisecond {
+		t.Errorf("delay = %v, want the cached p95", d)
+	}
+	h.observe("gpt-4o", 10*time.Second)
+	if d := h.delay("gpt-4o"); d != 10*time.Second {
+		t.Errorf("delay = %v, want the refreshed p95", d)
+	}
+}
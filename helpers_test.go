@@ -0,0 +1,55 @@
+package langmesh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chatResponder writes the response to the nth chat request a recording
+// server received, counting from zero
+type chatResponder func(w http.ResponseWriter, req openai.ChatCompletionRequest, n int)
+
+// newRecordingServer answers chat requests with respond, recording each
+// decoded request. The returned function lists the requests so far.
+func newRecordingServer(t *testing.T, respond chatResponder) (*httptest.Server, func() []openai.ChatCompletionRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		n := len(requests) - 1
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		respond(w, req, n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []openai.ChatCompletionRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]openai.ChatCompletionRequest(nil), requests...)
+	}
+}
+
+// writeChatReply writes a chat completion from model saying content
+func writeChatReply(w http.ResponseWriter, model, content string, promptTokens, completionTokens int) {
+	encoded, _ := json.Marshal(content)
+	fmt.Fprintf(w, `{"id":"c1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":%s}}],"usage":{"prompt_tokens":%d,"completion_tokens":%d,"total_tokens":%d}}`,
+		model, encoded, promptTokens, completionTokens, promptTokens+completionTokens)
+}
+
+// replySequence answers each request with the next of replies, repeating
+// the last once they run out
+func replySequence(replies ...string) chatResponder {
+	return func(w http.ResponseWriter, req openai.ChatCompletionRequest, n int) {
+		writeChatReply(w, req.Model, replies[min(n, len(replies)-1)], 10, 4)
+	}
+}
@@ -0,0 +1,276 @@
+package langmesh
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// HNSWConfig tunes an HNSWIndex. Zero fields take the defaults.
+type HNSWConfig struct {
+	// M is the number of neighbors kept per node, twice that on the
+	// bottom layer; defaults to 16
+	M int
+	// EfConstruction is the candidate list size when inserting; defaults
+	// to 200
+	EfConstruction int
+	// EfSearch is the candidate list size when searching, raised to k if
+	// smaller; defaults to 64
+	EfSearch int
+}
+
+// HNSWIndex is an approximate index using a hierarchical navigable small
+// world graph, for indexes too large to scan. Deleted entries are left in
+// the graph for navigation and dropped from results.
+type HNSWIndex struct {
+	mu     sync.RWMutex
+	config HNSWConfig
+	nodes  []*hnswNode
+	ids    map[string]int32
+	entry  int32
+	top    int
+	dim    int
+	live   int
+	levels float64
+	rng    *rand.Rand
+}
+
+type hnswNode struct {
+	VectorEntry
+	// neighbors holds the node's links on each layer it is on
+	neighbors [][]int32
+	deleted   bool
+}
+
+// NewHNSWIndex creates an empty HNSW index
+func NewHNSWIndex(config HNSWConfig) *HNSWIndex {
+	if config.M <= 0 {
+		config.M = 16
+	}
+	if config.EfConstruction <= 0 {
+		config.EfConstruction = 200
+	}
+	if config.EfSearch <= 0 {
+		config.EfSearch = 64
+	}
+	return &HNSWIndex{
+		config: config,
+		ids:    make(map[string]int32),
+		entry:  -1,
+		levels: 1 / math.Log(float64(max(config.M, 2))),
+		// A fixed seed keeps graphs, and so results, reproducible
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+// Add inserts or replaces entries
+func (x *HNSWIndex) Add(entries ...VectorEntry) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, e := range entries {
+		if x.live == 0 && len(x.nodes) > 0 {
+			// Everything was deleted; start a fresh graph
+			x.nodes, x.ids, x.entry, x.top = nil, make(map[string]int32), -1, 0
+		}
+		if err := checkDimension(&x.dim, len(e.Vector), len(x.nodes) == 0); err != nil {
+			return err
+		}
+		e.Vector = normalized(e.Vector)
+		if old, ok := x.ids[e.ID]; ok {
+			x.nodes[old].deleted = true
+			x.live--
+		}
+		x.insert(e)
+	}
+	return nil
+}
+
+func (x *HNSWIndex) insert(e VectorEntry) {
+	level := int(-math.Log(1-x.rng.Float64()) * x.levels)
+	id := int32(len(x.nodes))
+	node := &hnswNode{VectorEntry: e, neighbors: make([][]int32, level+1)}
+	x.nodes = append(x.nodes, node)
+	x.ids[e.ID] = id
+	x.live++
+	if x.entry < 0 {
+		x.entry, x.top = id, level
+		return
+	}
+
+	cur := x.entry
+	for l := x.top; l > level; l-- {
+		cur = x.greedy(e.Vector, cur, l)
+	}
+	for l := min(level, x.top); l >= 0; l-- {
+		candidates := x.searchLayer(e.Vector, cur, x.config.EfConstruction, l)
+		limit := x.maxNeighbors(l)
+		chosen := candidates[:min(len(candidates), x.config.M)]
+		node.neighbors[l] = make([]int32, 0, len(chosen))
+		for _, c := range chosen {
+			node.neighbors[l] = append(node.neighbors[l], c.id)
+			x.link(c.id, id, l, limit)
+		}
+		cur = candidates[0].id
+	}
+	if level > x.top {
+		x.entry, x.top = id, level
+	}
+}
+
+func (x *HNSWIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * x.config.M
+	}
+	return x.config.M
+}
+
+// link adds to to from's neighbors on level, keeping the nearest limit
+func (x *HNSWIndex) link(from, to int32, level, limit int) {
+	n := x.nodes[from]
+	n.neighbors[level] = append(n.neighbors[level], to)
+	if len(n.neighbors[level]) <= limit {
+		return
+	}
+	links := n.neighbors[level]
+	sort.Slice(links, func(i, j int) bool {
+		return angularDistance(n.Vector, x.nodes[links[i]].Vector) < angularDistance(n.Vector, x.nodes[links[j]].Vector)
+	})
+	n.neighbors[level] = links[:limit]
+}
+
+// greedy walks level toward q from start, returning the nearest node found
+func (x *HNSWIndex) greedy(q []float32, start int32, level int) int32 {
+	cur := start
+	best := angularDistance(q, x.nodes[cur].Vector)
+	for improved := true; improved; {
+		improved = false
+		for _, n := range x.nodes[cur].neighbors[level] {
+			if d := angularDistance(q, x.nodes[n].Vector); d < best {
+				cur, best, improved = n, d, true
+			}
+		}
+	}
+	return cur
+}
+
+// searchLayer returns the ef nodes on level nearest q found from start,
+// nearest first
+func (x *HNSWIndex) searchLayer(q []float32, start int32, ef, level int) []hnswCandidate {
+	first := hnswCandidate{id: start, dist: angularDistance(q, x.nodes[start].Vector)}
+	visited := map[int32]bool{start: true}
+	candidates := &candidateHeap{items: []hnswCandidate{first}}
+	results := &candidateHeap{items: []hnswCandidate{first}, farthest: true}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if c.dist > results.items[0].dist && results.Len() >= ef {
+			break
+		}
+		for _, n := range x.nodes[c.id].neighbors[level] {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+			d := angularDistance(q, x.nodes[n].Vector)
+			if results.Len() < ef || d < results.items[0].dist {
+				heap.Push(candidates, hnswCandidate{id: n, dist: d})
+				heap.Push(results, hnswCandidate{id: n, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+	out := results.items
+	sort.Slice(out, func(i, j int) bool { return out[i].dist < out[j].dist })
+	return out
+}
+
+// Search walks the graph for the k nearest live entries
+func (x *HNSWIndex) Search(query []float32, k int) []SearchResult {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if k <= 0 || x.entry < 0 || len(query) != x.dim {
+		return nil
+	}
+	q := normalized(query)
+	cur := x.entry
+	for l := x.top; l > 0; l-- {
+		cur = x.greedy(q, cur, l)
+	}
+	// Widen the search by the deleted nodes it may have to skip
+	ef := max(x.config.EfSearch, k) + len(x.nodes) - x.live
+	var results []SearchResult
+	for _, c := range x.searchLayer(q, cur, ef, 0) {
+		n := x.nodes[c.id]
+		if n.deleted {
+			continue
+		}
+		results = append(results, SearchResult{VectorEntry: n.VectorEntry, Score: dot(q, n.Vector)})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// Delete marks the entry with id deleted
+func (x *HNSWIndex) Delete(id string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	i, ok := x.ids[id]
+	if !ok {
+		return false
+	}
+	delete(x.ids, id)
+	x.nodes[i].deleted = true
+	x.live--
+	return true
+}
+
+// Len returns the number of live entries
+func (x *HNSWIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.live
+}
+
+// Entries returns every live entry
+func (x *HNSWIndex) Entries() []VectorEntry {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	out := make([]VectorEntry, 0, x.live)
+	for _, n := range x.nodes {
+		if !n.deleted {
+			out = append(out, n.VectorEntry)
+		}
+	}
+	return out
+}
+
+type hnswCandidate struct {
+	id   int32
+	dist float64
+}
+
+// candidateHeap is a min-heap by distance, or a max-heap if farthest
+type candidateHeap struct {
+	items    []hnswCandidate
+	farthest bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.farthest {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(v any)    { h.items = append(h.items, v.(hnswCandidate)) }
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
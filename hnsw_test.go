@@ -0,0 +1,78 @@
+package langmesh
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHNSWRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	random := func() []float32 {
+		vec := make([]float32, 16)
+		for i := range vec {
+			vec[i] = float32(rng.NormFloat64())
+		}
+		return vec
+	}
+	flat, hnsw := NewFlatIndex(), NewHNSWIndex(HNSWConfig{})
+	for i := 0; i < 1000; i++ {
+		e := VectorEntry{ID: fmt.Sprint(i), Vector: random()}
+		if err := flat.Add(e); err != nil {
+			t.Fatal(err)
+		}
+		if err := hnsw.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, total := 0, 0
+	for q := 0; q < 50; q++ {
+		query := random()
+		want := map[string]bool{}
+		for _, r := range flat.Search(query, 10) {
+			want[r.ID] = true
+		}
+		for _, r := range hnsw.Search(query, 10) {
+			if want[r.ID] {
+				found++
+			}
+		}
+		total += 10
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("recall@10 = %.2f, want at least 0.9", recall)
+	}
+
+	query := random()
+	best := hnsw.Search(query, 1)[0].ID
+	if !hnsw.Delete(best) || hnsw.Len() != 999 {
+		t.Fatalf("delete %s: len %d", best, hnsw.Len())
+	}
+	for _, r := range hnsw.Search(query, 10) {
+		if r.ID == best {
+			t.Errorf("deleted entry %s returned", best)
+		}
+	}
+	if n := len(hnsw.Entries()); n != 999 {
+		t.Errorf("entries = %d", n)
+	}
+}
+
+func TestHNSWReplaceAndEmpty(t *testing.T) {
+	index := NewHNSWIndex(HNSWConfig{M: 2})
+	if index.Search([]float32{1, 0}, 3) != nil {
+		t.Error("results from an empty index")
+	}
+	_ = index.Add(VectorEntry{ID: "a", Vector: []float32{1, 0}, Text: "old"})
+	_ = index.Add(VectorEntry{ID: "a", Vector: []float32{0, 1}, Text: "new"})
+	got := index.Search([]float32{0, 1}, 5)
+	if index.Len() != 1 || len(got) != 1 || got[0].Text != "new" {
+		t.Errorf("after replace: len %d, results %+v", index.Len(), got)
+	}
+
+	index.Delete("a")
+	if err := index.Add(VectorEntry{ID: "b", Vector: []float32{1, 2, 3}}); err != nil {
+		t.Errorf("new dimension after emptying: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package langmesh
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrUninstrumented is returned, with UninstrumentedFail, for API calls made
+// through an openai.Client method langmesh does not wrap
+var ErrUninstrumented = errors.New("langmesh: call made through an un-instrumented method")
+
+// wrappedMethods lists the openai.Client methods Client overrides with
+// instrumented versions. TestWrappedMethodsComplete keeps it in sync.
+var wrappedMethods = map[string]bool{
+	"CreateChatCompletion":       true,
+	"CreateChatCompletionStream": true,
+	"CreateEmbeddings":           true,
+	"CreateImage":                true,
+	"CreateTranscription":        true,
+	"CreateTranslation":          true,
+
+	"CreateAssistant":    true,
+	"RetrieveAssistant":  true,
+	"ModifyAssistant":    true,
+	"DeleteAssistant":    true,
+	"ListAssistants":     true,
+	"CreateThread":       true,
+	"RetrieveThread":     true,
+	"ModifyThread":       true,
+	"DeleteThread":       true,
+	"CreateMessage":      true,
+	"ListMessage":        true,
+	"RetrieveMessage":    true,
+	"ModifyMessage":      true,
+	"CreateRun":          true,
+	"RetrieveRun":        true,
+	"ModifyRun":          true,
+	"ListRuns":           true,
+	"SubmitToolOutputs":  true,
+	"CancelRun":          true,
+	"CreateThreadAndRun": true,
+	"RetrieveRunStep":    true,
+	"ListRunSteps":       true,
+
+	"CreateFineTuningJob":     true,
+	"RetrieveFineTuningJob":   true,
+	"CancelFineTuningJob":     true,
+	"ListFineTuningJobEvents": true,
+
+	"CreateFile":      true,
+	"CreateFileBytes": true,
+	"ListFiles":       true,
+	"GetFile":         true,
+	"DeleteFile":      true,
+	"GetFileContent":  true,
+}
+
+// InstrumentationReport lists which openai.Client methods record telemetry
+// when called on a Client and which pass straight through
+type InstrumentationReport struct {
+	Wrapped     []string
+	PassThrough []string
+}
+
+// InstrumentationReport describes the client's telemetry coverage of the
+// underlying openai.Client API
+func (c *Client) InstrumentationReport() InstrumentationReport {
+	var report InstrumentationReport
+	t := reflect.TypeOf(&openai.Client{})
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		if wrappedMethods[name] {
+			report.Wrapped = append(report.Wrapped, name)
+		} else {
+			report.PassThrough = append(report.PassThrough, name)
+		}
+	}
+	sort.Strings(report.Wrapped)
+	sort.Strings(report.PassThrough)
+	return report
+}
+
+// UninstrumentedMode controls API calls made through methods langmesh does
+// not wrap
+type UninstrumentedMode int
+
+const (
+	// UninstrumentedAllow lets such calls through silently
+	UninstrumentedAllow UninstrumentedMode = iota
+	// UninstrumentedWarn lets them through and logs each one
+	UninstrumentedWarn
+	// UninstrumentedFail rejects them with ErrUninstrumented before anything
+	// is sent upstream
+	UninstrumentedFail
+)
+
+// WithUninstrumentedCalls sets how the client treats API calls that bypass
+// telemetry, so teams can guarantee no spend goes unrecorded
+func WithUninstrumentedCalls(mode UninstrumentedMode) Option {
+	return func(c *Client) {
+		c.uninstrumentedMode = mode
+	}
+}
+
+// coverageTransport spots requests made without a wrapper method: every
+// wrapper attaches a callState to the context before calling upstream
+type coverageTransport struct {
+	base   http.RoundTripper
+	client *Client
+	mode   UninstrumentedMode
+	count  *atomic.Int64
+}
+
+func (t coverageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if callStateFrom(req.Context()) == nil {
+		t.count.Add(1)
+		switch t.mode {
+		case UninstrumentedWarn:
+			t.client.log(req.Context(), LogUninstrumented, "un-instrumented call",
+				"method", req.Method, "path", req.URL.Path)
+		case UninstrumentedFail:
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, ErrUninstrumented
+		}
+	}
+	t.client.log(req.Context(), LogRequest, "request started", "method", req.Method, "path", req.URL.Path)
+	return t.base.RoundTrip(req)
+}
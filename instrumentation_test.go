@@ -0,0 +1,100 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TestWrappedMethodsComplete checks wrappedMethods against the methods this
+// package actually defines on Client
+func TestWrappedMethodsComplete(t *testing.T) {
+	upstream := reflect.TypeOf(&openai.Client{})
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defined := map[string]bool{}
+	for _, file := range pkgs["langmesh"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil {
+				continue
+			}
+			star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+			if !ok {
+				continue
+			}
+			if ident, ok := star.X.(*ast.Ident); ok && ident.Name == "Client" {
+				if _, shadows := upstream.MethodByName(fn.Name.Name); shadows {
+					defined[fn.Name.Name] = true
+				}
+			}
+		}
+	}
+
+	for name := range defined {
+		if !wrappedMethods[name] {
+			t.Errorf("%s is wrapped but missing from wrappedMethods", name)
+		}
+	}
+	for name := range wrappedMethods {
+		if !defined[name] {
+			t.Errorf("wrappedMethods lists %s, which Client does not override", name)
+		}
+	}
+}
+
+func TestInstrumentationReport(t *testing.T) {
+	report := NewClient("test-key").InstrumentationReport()
+	contains := func(list []string, name string) bool {
+		for _, s := range list {
+			if s == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(report.Wrapped, "CreateChatCompletion") || contains(report.PassThrough, "CreateChatCompletion") {
+		t.Errorf("CreateChatCompletion not reported as wrapped: %+v", report)
+	}
+	if !contains(report.PassThrough, "ListModels") {
+		t.Errorf("ListModels not reported as pass-through: %+v", report)
+	}
+}
+
+func TestUninstrumentedCalls(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	_, _ = client.ListModels(context.Background())
+	if got := client.Stats().UninstrumentedCalls; got != 1 {
+		t.Errorf("UninstrumentedCalls = %d, want 1", got)
+	}
+
+	strict := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithUninstrumentedCalls(UninstrumentedFail))
+	before := *calls
+	if _, err := strict.ListModels(context.Background()); !errors.Is(err, ErrUninstrumented) {
+		t.Fatalf("err = %v, want ErrUninstrumented", err)
+	}
+	if *calls != before {
+		t.Error("un-instrumented call reached the server")
+	}
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := strict.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Errorf("wrapped call rejected: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package langmesh
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatClient is the chat completion surface of Client. Depend on it instead
+// of *Client so code can be tested with langmeshtest.MockClient.
+type ChatClient interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// FullClient covers the commonly used Client methods
+type FullClient interface {
+	ChatClient
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+	Moderations(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error)
+	CreateImage(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error)
+	CreateTranscription(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error)
+	ListModels(ctx context.Context) (openai.ModelsList, error)
+}
+
+// CostEstimator prices calls. Code accepting a ChatClient checks for it to
+// report costs; *Client and langmeshtest.MockClient implement it.
+type CostEstimator interface {
+	EstimateCostUSD(model string, promptTokens, completionTokens int) float64
+}
+
+var (
+	_ ChatClient    = (*Client)(nil)
+	_ FullClient    = (*Client)(nil)
+	_ CostEstimator = (*Client)(nil)
+)
@@ -0,0 +1,484 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultJobWorkers is how many jobs run at once unless configured
+	DefaultJobWorkers = 4
+	// DefaultJobQueueSize is how many jobs can wait for a worker unless
+	// configured
+	DefaultJobQueueSize = 1024
+	// DefaultJobTimeout bounds each job unless configured
+	DefaultJobTimeout = 10 * time.Minute
+	// DefaultJobPollInterval is how often WaitJob checks the store for jobs
+	// another process runs
+	DefaultJobPollInterval = time.Second
+)
+
+var (
+	// ErrJobsDisabled is returned by the job methods of a client without
+	// WithJobs
+	ErrJobsDisabled = errors.New("langmesh: jobs are not enabled; see WithJobs")
+	// ErrJobNotFound is returned for a job ID the store does not know
+	ErrJobNotFound = errors.New("langmesh: job not found")
+	// ErrJobQueueFull is returned by SubmitChatCompletion while every
+	// queue slot is taken
+	ErrJobQueueFull = errors.New("langmesh: job queue is full")
+)
+
+// JobID identifies a submitted job
+type JobID string
+
+// JobStatus is where a job is in its lifecycle
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Done reports whether the job has finished, one way or another
+func (s JobStatus) Done() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Job is a chat completion submitted with SubmitChatCompletion
+type Job struct {
+	ID       JobID                          `json:"id"`
+	Status   JobStatus                      `json:"status"`
+	Request  openai.ChatCompletionRequest   `json:"request"`
+	Response *openai.ChatCompletionResponse `json:"response,omitempty"`
+	Error    string                         `json:"error,omitempty"`
+
+	// User, Tags and Policy are the submitting context's, restored when
+	// the job runs
+	User   string            `json:"user,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Policy string            `json:"policy,omitempty"`
+
+	SubmittedAt time.Time `json:"submitted_at"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+}
+
+// JobStore persists jobs. With a durable store, jobs outlive the process:
+// their results can be fetched after a restart, and jobs left queued or
+// running are run again.
+type JobStore interface {
+	Save(ctx context.Context, job Job) error
+	// Load returns the job, or ErrJobNotFound
+	Load(ctx context.Context, id JobID) (Job, error)
+	// Unfinished returns the queued and running jobs, oldest first
+	Unfinished(ctx context.Context) ([]Job, error)
+}
+
+// Jobs configures WithJobs. Zero fields take the defaults.
+type Jobs struct {
+	// Store defaults to a MemoryJobStore
+	Store     JobStore
+	Workers   int
+	QueueSize int
+	// Timeout bounds each job's completion
+	Timeout      time.Duration
+	PollInterval time.Duration
+	// Webhook, if set, is told of every job that finishes, so other
+	// services need not poll
+	Webhook *JobWebhook
+}
+
+// WithJobs runs chat completions submitted with SubmitChatCompletion on a
+// pool of background workers, so callers such as web handlers can return
+// at once and fetch the result later. Jobs are recorded in telemetry like
+// any other call, tagged with "job_id". With a durable Store, jobs that
+// were queued or running when the process stopped are run again when the
+// next client starts, so a job may be sent more than once. Requests are
+// stored as submitted, before any redaction.
+func WithJobs(cfg Jobs) Option {
+	return func(c *Client) {
+		if cfg.Store == nil {
+			cfg.Store = NewMemoryJobStore()
+		}
+		if cfg.Workers <= 0 {
+			cfg.Workers = DefaultJobWorkers
+		}
+		if cfg.QueueSize <= 0 {
+			cfg.QueueSize = DefaultJobQueueSize
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultJobTimeout
+		}
+		if cfg.PollInterval <= 0 {
+			cfg.PollInterval = DefaultJobPollInterval
+		}
+		c.jobs = &jobRunner{
+			cfg:     cfg,
+			queue:   make(chan JobID, cfg.QueueSize),
+			stop:    make(chan struct{}),
+			running: make(map[JobID]context.CancelFunc),
+			waiters: make(map[JobID]chan struct{}),
+		}
+	}
+}
+
+type jobRunner struct {
+	cfg      Jobs
+	queue    chan JobID
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	running map[JobID]context.CancelFunc
+	// waiters are closed when the job finishes in this process
+	waiters map[JobID]chan struct{}
+}
+
+// startJobs starts the workers and requeues the store's unfinished jobs
+func (c *Client) startJobs() {
+	r := c.jobs
+	if r == nil {
+		return
+	}
+	for i := 0; i < r.cfg.Workers; i++ {
+		c.goroutine("jobs.worker", c.runJobs)
+	}
+	unfinished, err := r.cfg.Store.Unfinished(context.Background())
+	if err != nil {
+		c.log(context.Background(), LogJobs, "unfinished jobs unreadable", "error", err)
+		return
+	}
+	for _, job := range unfinished {
+		select {
+		case r.queue <- job.ID:
+		default:
+			c.log(context.Background(), LogJobs, "job queue full, unfinished job left queued", "job_id", job.ID)
+		}
+	}
+}
+
+// SubmitChatCompletion stores request as a job and queues it, returning
+// its ID at once. The user, tags and policy on ctx apply to the job; ctx's
+// cancellation does not. Follow the job with PollJob and WaitJob, or
+// CancelJob it.
+func (c *Client) SubmitChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (JobID, error) {
+	r := c.jobs
+	if r == nil {
+		return "", ErrJobsDisabled
+	}
+	scope := ScopeFrom(ctx)
+	job := Job{
+		ID:          JobID("job_" + uuid.NewString()),
+		Status:      JobQueued,
+		Request:     request,
+		User:        scope.User,
+		Tags:        scope.Tags,
+		Policy:      PolicyFromContext(ctx),
+		SubmittedAt: time.Now(),
+	}
+	if err := r.cfg.Store.Save(ctx, job); err != nil {
+		return "", fmt.Errorf("langmesh: saving job: %w", err)
+	}
+	select {
+	case r.queue <- job.ID:
+		return job.ID, nil
+	default:
+		job.Status, job.Error, job.FinishedAt = JobFailed, ErrJobQueueFull.Error(), time.Now()
+		r.cfg.Store.Save(ctx, job)
+		return "", ErrJobQueueFull
+	}
+}
+
+// PollJob returns the job's current state
+func (c *Client) PollJob(ctx context.Context, id JobID) (Job, error) {
+	if c.jobs == nil {
+		return Job{}, ErrJobsDisabled
+	}
+	return c.jobs.cfg.Store.Load(ctx, id)
+}
+
+// WaitJob blocks until the job finishes or ctx ends, returning its last
+// known state
+func (c *Client) WaitJob(ctx context.Context, id JobID) (Job, error) {
+	r := c.jobs
+	if r == nil {
+		return Job{}, ErrJobsDisabled
+	}
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// Register before loading, so a job finishing in between still
+		// wakes the wait
+		done := r.waiter(id)
+		job, err := r.cfg.Store.Load(ctx, id)
+		if err != nil || job.Status.Done() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-done:
+		case <-ticker.C:
+		}
+	}
+}
+
+// CancelJob stops the job: a queued job will not run, and a running one
+// in this process has its request cancelled. Finished jobs are left alone.
+func (c *Client) CancelJob(ctx context.Context, id JobID) error {
+	r := c.jobs
+	if r == nil {
+		return ErrJobsDisabled
+	}
+	job, err := r.cfg.Store.Load(ctx, id)
+	if err != nil || job.Status.Done() {
+		return err
+	}
+	r.mu.Lock()
+	cancel := r.running[id]
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		return nil
+	}
+	job.Status, job.FinishedAt = JobCancelled, time.Now()
+	if err := r.cfg.Store.Save(ctx, job); err != nil {
+		return err
+	}
+	r.finished(id)
+	c.notifyJob(job)
+	return nil
+}
+
+func (r *jobRunner) waiter(id JobID) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, ok := r.waiters[id]
+	if !ok {
+		ch = make(chan struct{})
+		r.waiters[id] = ch
+	}
+	return ch
+}
+
+// finished wakes the job's waiters
+func (r *jobRunner) finished(id JobID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ch, ok := r.waiters[id]; ok {
+		close(ch)
+		delete(r.waiters, id)
+	}
+}
+
+// stopJobs stops the workers once their current jobs finish. Jobs still
+// queued stay so in the store.
+func (c *Client) stopJobs() {
+	if r := c.jobs; r != nil {
+		r.stopOnce.Do(func() { close(r.stop) })
+	}
+}
+
+func (c *Client) runJobs() {
+	r := c.jobs
+	for {
+		select {
+		case <-r.stop:
+			return
+		case id := <-r.queue:
+			c.runJob(id)
+		}
+	}
+}
+
+func (c *Client) runJob(id JobID) {
+	r := c.jobs
+	store := r.cfg.Store
+	bg := context.Background()
+	job, err := store.Load(bg, id)
+	if err != nil {
+		c.log(bg, LogJobs, "job unreadable", "job_id", id, "error", err)
+		return
+	}
+	if job.Status.Done() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(bg, r.cfg.Timeout)
+	defer cancel()
+	if job.User != "" {
+		ctx = ContextWithUser(ctx, job.User)
+	}
+	for k, v := range job.Tags {
+		ctx = ContextWithTag(ctx, k, v)
+	}
+	ctx = ContextWithTag(ctx, "job_id", string(job.ID))
+	if job.Policy != "" {
+		ctx = ContextWithPolicy(ctx, job.Policy)
+	}
+
+	r.mu.Lock()
+	r.running[id] = cancel
+	r.mu.Unlock()
+	job.Status, job.StartedAt = JobRunning, time.Now()
+	if err := store.Save(bg, job); err != nil {
+		c.log(bg, LogJobs, "job state not saved", "job_id", id, "error", err)
+	}
+
+	resp, err := c.CreateChatCompletion(ctx, job.Request)
+	r.mu.Lock()
+	delete(r.running, id)
+	r.mu.Unlock()
+
+	job.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		job.Status, job.Response = JobSucceeded, &resp
+	case isCancelled(err):
+		job.Status, job.Error = JobCancelled, err.Error()
+	default:
+		job.Status, job.Error = JobFailed, err.Error()
+	}
+	if err := store.Save(bg, job); err != nil {
+		c.log(bg, LogJobs, "job result not saved", "job_id", id, "error", err)
+	}
+	r.finished(id)
+	c.notifyJob(job)
+}
+
+// MemoryJobStore is a JobStore held in process memory; its jobs do not
+// survive a restart
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[JobID]Job
+}
+
+// NewMemoryJobStore creates an empty MemoryJobStore
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[JobID]Job)}
+}
+
+func (s *MemoryJobStore) Save(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) Load(_ context.Context, id JobID) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+func (s *MemoryJobStore) Unfinished(context.Context) ([]Job, error) {
+	s.mu.Lock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if !job.Status.Done() {
+			jobs = append(jobs, job)
+		}
+	}
+	s.mu.Unlock()
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// DirJobStore is a durable JobStore keeping each job as a JSON file in a
+// directory, replaced atomically on every save
+type DirJobStore struct {
+	Dir string
+}
+
+// NewDirJobStore creates a DirJobStore in dir, creating the directory if
+// needed
+func NewDirJobStore(dir string) (*DirJobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirJobStore{Dir: dir}, nil
+}
+
+func (s *DirJobStore) path(id JobID) string {
+	return filepath.Join(s.Dir, filepath.Base(string(id))+".json")
+}
+
+func (s *DirJobStore) Save(_ context.Context, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".job-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(job.ID))
+}
+
+func (s *DirJobStore) Load(_ context.Context, id JobID) (Job, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
+
+func (s *DirJobStore) Unfinished(ctx context.Context) ([]Job, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, file := range files {
+		job, err := s.Load(ctx, JobID(filepath.Base(file[:len(file)-len(".json")])))
+		if err != nil {
+			return nil, err
+		}
+		if !job.Status.Done() {
+			jobs = append(jobs, job)
+		}
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].SubmittedAt.Before(jobs[j].SubmittedAt) })
+}
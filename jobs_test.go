@@ -0,0 +1,175 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitChatCompletion(t *testing.T) {
+	srv, _ := newChatServer(t, "later")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec), WithJobs(Jobs{}))
+	t.Cleanup(func() { client.Close() })
+
+	ctx := ContextWithTag(ContextWithUser(context.Background(), "u-1"), "feature", "reports")
+	id, err := client.SubmitChatCompletion(ctx, chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := client.WaitJob(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobSucceeded || job.Response == nil || job.Response.Choices[0].Message.Content != "later" {
+		t.Fatalf("job = %+v", job)
+	}
+	if job.StartedAt.IsZero() || job.FinishedAt.Before(job.StartedAt) {
+		t.Errorf("times = %v, %v", job.StartedAt, job.FinishedAt)
+	}
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("got %d events", len(events))
+	}
+	if e := events[0]; e.User != "u-1" || e.Tags["feature"] != "reports" || e.Tags["job_id"] != string(id) {
+		t.Errorf("event = %+v", e)
+	}
+
+	if _, err := client.PollJob(context.Background(), "job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("unknown job err = %v", err)
+	}
+	if _, err := NewClient("test-key").SubmitChatCompletion(ctx, chatRequest("hi")); !errors.Is(err, ErrJobsDisabled) {
+		t.Errorf("disabled err = %v", err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithJobs(Jobs{Workers: 1}))
+	t.Cleanup(func() { client.Close() })
+	ctx := context.Background()
+
+	running, err := client.SubmitChatCompletion(ctx, chatRequest("slow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := client.SubmitChatCompletion(ctx, chatRequest("never"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := client.CancelJob(ctx, queued); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CancelJob(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []JobID{running, queued} {
+		job, err := client.WaitJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != JobCancelled {
+			t.Errorf("job %s status = %s", id, job.Status)
+		}
+	}
+	select {
+	case <-started:
+		t.Error("cancelled queued job was sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	store := NewMemoryJobStore()
+	client := NewClient("test-key", WithJobs(Jobs{Store: store, QueueSize: 1}))
+	// Stop the workers so the queue stays full
+	client.Close()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx := context.Background()
+	if _, err := client.SubmitChatCompletion(ctx, chatRequest("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SubmitChatCompletion(ctx, chatRequest("second")); !errors.Is(err, ErrJobQueueFull) {
+		t.Fatalf("err = %v", err)
+	}
+	unfinished, _ := store.Unfinished(ctx)
+	if len(unfinished) != 1 || unfinished[0].Request.Messages[0].Content != "first" {
+		t.Errorf("unfinished = %+v", unfinished)
+	}
+}
+
+func TestDirJobStoreResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A job left queued by a process that stopped
+	ctx := context.Background()
+	left := Job{ID: "job_left", Status: JobQueued, Request: chatRequest("resume"), SubmittedAt: time.Now()}
+	done := Job{ID: "job_done", Status: JobSucceeded, Request: chatRequest("done"), SubmittedAt: time.Now()}
+	for _, job := range []Job{left, done} {
+		if err := store.Save(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, calls := newChatServer(t, "resumed")
+	restarted, _ := NewDirJobStore(dir)
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithJobs(Jobs{Store: restarted}))
+	t.Cleanup(func() { client.Close() })
+
+	job, err := client.WaitJob(ctx, left.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobSucceeded || job.Response.Choices[0].Message.Content != "resumed" {
+		t.Fatalf("job = %+v", job)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("calls = %d, want only the unfinished job run", n)
+	}
+	if got, err := store.Load(ctx, done.ID); err != nil || got.Status != JobSucceeded {
+		t.Errorf("finished job = %+v, %v", got, err)
+	}
+	if _, err := store.Load(ctx, "job_none"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("missing job err = %v", err)
+	}
+}
+
+func TestWaitJobPollsStore(t *testing.T) {
+	// A job another process runs only shows up in the shared store
+	store := NewMemoryJobStore()
+	client := NewClient("test-key", WithJobs(Jobs{Store: store, PollInterval: 5 * time.Millisecond}))
+	client.Close()
+	ctx := context.Background()
+	job := Job{ID: "job_remote", Status: JobRunning, SubmittedAt: time.Now()}
+	store.Save(ctx, job)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		job.Status = JobFailed
+		job.Error = "upstream down"
+		store.Save(ctx, job)
+	}()
+
+	got, err := client.WaitJob(ctx, job.ID)
+	if err != nil || got.Status != JobFailed || got.Error != "upstream down" {
+		t.Errorf("job = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,153 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultWebhookAttempts is how many times a job webhook is tried
+	// unless configured
+	DefaultWebhookAttempts = 5
+	// DefaultWebhookBackoff is the wait before a job webhook's first retry
+	// unless configured; it doubles with every retry
+	DefaultWebhookBackoff = time.Second
+	// DefaultWebhookTolerance is how old a job webhook VerifyJobWebhook
+	// accepts
+	DefaultWebhookTolerance = 5 * time.Minute
+
+	// WebhookSignatureHeader carries a job webhook's signature, as
+	// "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the body
+	WebhookSignatureHeader = "X-Langmesh-Signature"
+	// WebhookTimestampHeader carries the Unix time a job webhook was signed
+	WebhookTimestampHeader = "X-Langmesh-Timestamp"
+)
+
+// ErrWebhookSignature is returned by VerifyJobWebhook for a request not
+// signed with the secret, or signed too long ago
+var ErrWebhookSignature = errors.New("langmesh: invalid job webhook signature")
+
+// JobWebhook configures Jobs.Webhook
+type JobWebhook struct {
+	// URL receives a POST of the job, as JSON, when it finishes
+	URL string
+	// Secret signs each delivery; see VerifyJobWebhook
+	Secret []byte
+	// Attempts and Backoff bound the retries of a delivery that failed
+	// with a network error, a 429 or a 5xx
+	Attempts int
+	Backoff  time.Duration
+	// HTTPClient defaults to one with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// notifyJob delivers the finished job to the webhook in the background
+func (c *Client) notifyJob(job Job) {
+	hook := c.jobs.cfg.Webhook
+	if hook == nil || hook.URL == "" {
+		return
+	}
+	c.goroutine("jobs.webhook", func() {
+		if err := hook.deliver(job); err != nil {
+			c.log(context.Background(), LogJobs, "job webhook not delivered", "job_id", job.ID, "error", err)
+		}
+	})
+}
+
+func (h *JobWebhook) deliver(job Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	attempts, backoff, client := h.Attempts, h.Backoff, h.HTTPClient
+	if attempts <= 0 {
+		attempts = DefaultWebhookAttempts
+	}
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(client, job, body)
+		if err == nil || !retry || attempt == attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes one delivery, reporting whether a failure is worth retrying
+func (h *JobWebhook) post(client *http.Client, job Job, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Langmesh-Job-Id", string(job.ID))
+	req.Header.Set("X-Langmesh-Job-Status", string(job.Status))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+webhookSignature(h.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("langmesh: job webhook returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyJobWebhook checks that a job webhook request was signed with
+// secret within the last DefaultWebhookTolerance and returns its job. A
+// delivery may be retried after a response was lost, so receivers should
+// handle the same job ID more than once.
+func VerifyJobWebhook(r *http.Request, secret []byte) (Job, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Job{}, err
+	}
+	timestamp := r.Header.Get(WebhookTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Job{}, ErrWebhookSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > DefaultWebhookTolerance || age < -DefaultWebhookTolerance {
+		return Job{}, ErrWebhookSignature
+	}
+	want := "sha256=" + webhookSignature(secret, timestamp, body)
+	if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte(want)) {
+		return Job{}, ErrWebhookSignature
+	}
+	var job Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
@@ -0,0 +1,98 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJobWebhook(t *testing.T) {
+	secret := []byte("hook-secret")
+	var attempts int32
+	delivered := make(chan Job, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		job, err := VerifyJobWebhook(r, secret)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Langmesh-Job-Status") != string(job.Status) {
+			t.Errorf("status header = %q", r.Header.Get("X-Langmesh-Job-Status"))
+		}
+		delivered <- job
+	}))
+	t.Cleanup(hook.Close)
+
+	srv, _ := newChatServer(t, "done")
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithJobs(Jobs{
+		Webhook: &JobWebhook{URL: hook.URL, Secret: secret, Backoff: time.Millisecond},
+	}))
+	t.Cleanup(func() { client.Close() })
+
+	id, err := client.SubmitChatCompletion(context.Background(), chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-delivered:
+		if job.ID != id || job.Status != JobSucceeded || job.Response.Choices[0].Message.Content != "done" {
+			t.Errorf("delivered = %+v", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("attempts = %d, want a retry after the 503", n)
+	}
+}
+
+func TestJobWebhookGivesUpOnClientError(t *testing.T) {
+	var attempts int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	t.Cleanup(hook.Close)
+
+	h := &JobWebhook{URL: hook.URL, Backoff: time.Millisecond}
+	if err := h.deliver(Job{ID: "job_1", Status: JobFailed}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("attempts = %d, want no retries on a 410", n)
+	}
+}
+
+func TestVerifyJobWebhook(t *testing.T) {
+	secret := []byte("s")
+	body := []byte(`{"id":"job_1","status":"failed"}`)
+	request := func(secret []byte, signedAt time.Time) *http.Request {
+		ts := strconv.FormatInt(signedAt.Unix(), 10)
+		r := httptest.NewRequest("POST", "/hook", bytes.NewReader(body))
+		r.Header.Set(WebhookTimestampHeader, ts)
+		r.Header.Set(WebhookSignatureHeader, "sha256="+webhookSignature(secret, ts, body))
+		return r
+	}
+
+	job, err := VerifyJobWebhook(request(secret, time.Now()), secret)
+	if err != nil || job.ID != "job_1" || job.Status != JobFailed {
+		t.Errorf("job = %+v, %v", job, err)
+	}
+	if _, err := VerifyJobWebhook(request([]byte("other"), time.Now()), secret); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("wrong secret err = %v", err)
+	}
+	if _, err := VerifyJobWebhook(request(secret, time.Now().Add(-time.Hour)), secret); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("replayed err = %v", err)
+	}
+}
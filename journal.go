@@ -0,0 +1,282 @@
+package langmesh
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// idempotencyKeyHeader carries a journaled request's idempotency key
+// upstream, for gateways and proxies that deduplicate on it
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// JournalEntry is a chat request the journal recorded before sending it
+type JournalEntry struct {
+	// Key is the request's idempotency key; a retry reuses it
+	Key       string `json:"key"`
+	RequestID string `json:"request_id"`
+	// Request is the request as the caller made it, before any rewriting
+	Request openai.ChatCompletionRequest `json:"request"`
+	Stream  bool                         `json:"stream,omitempty"`
+	User    string                       `json:"user,omitempty"`
+	Tags    map[string]string            `json:"tags,omitempty"`
+	Policy  string                       `json:"policy,omitempty"`
+	SentAt  time.Time                    `json:"sent_at"`
+}
+
+// RequestJournal is a write-ahead log of chat requests. Begin is called
+// before a request is sent and Complete once it has an outcome, success or
+// error, so after a crash the requests that were in flight are those with
+// no Complete.
+type RequestJournal interface {
+	Begin(ctx context.Context, entry JournalEntry) error
+	Complete(ctx context.Context, key string) error
+	// Incomplete returns the entries begun and never completed, oldest
+	// first
+	Incomplete(ctx context.Context) ([]JournalEntry, error)
+}
+
+// WithRequestJournal records every chat request, streamed or not, in
+// journal before it is sent. A request that cannot be journaled is not
+// sent, so no call goes unrecorded. After a restart, IncompleteRequests
+// lists the calls whose outcome was lost and RetryJournaled sends one
+// again under its idempotency key. Journal entries hold full requests.
+func WithRequestJournal(journal RequestJournal) Option {
+	return func(c *Client) {
+		c.journal = journal
+	}
+}
+
+type idempotencyKey struct{}
+
+// ContextWithIdempotencyKey makes the call made with the returned context
+// journal and send key as its idempotency key, instead of its request ID
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// beginJournal records request, as the caller made it, before it is sent.
+// It returns the entry's key, or "" without a journal.
+func (c *Client) beginJournal(ctx context.Context, request openai.ChatCompletionRequest, stream bool) (string, error) {
+	if c.journal == nil {
+		return "", nil
+	}
+	state := callStateFrom(ctx)
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if key == "" {
+		key = state.id()
+	}
+	scope := ScopeFrom(ctx)
+	entry := JournalEntry{
+		Key:       key,
+		RequestID: state.id(),
+		Request:   request,
+		Stream:    stream,
+		User:      scope.User,
+		Tags:      scope.Tags,
+		Policy:    PolicyFromContext(ctx),
+		SentAt:    time.Now().UTC(),
+	}
+	if err := c.journal.Begin(ctx, entry); err != nil {
+		return "", fmt.Errorf("langmesh: journaling request: %w", err)
+	}
+	if state != nil {
+		state.mu.Lock()
+		state.idempotencyKey = key
+		state.mu.Unlock()
+	}
+	return key, nil
+}
+
+// completeJournal marks the journaled call key as having an outcome
+func (c *Client) completeJournal(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := c.journal.Complete(context.WithoutCancel(ctx), key); err != nil {
+		c.log(ctx, LogTelemetry, "journal entry not completed", "key", key, "error", err)
+	}
+}
+
+// IncompleteRequests lists the journaled calls sent without an outcome
+// recorded, such as those in flight when the process crashed. Calls still
+// in flight in this process are listed too.
+func (c *Client) IncompleteRequests(ctx context.Context) ([]JournalEntry, error) {
+	if c.journal == nil {
+		return nil, errors.New("langmesh: no request journal; see WithRequestJournal")
+	}
+	return c.journal.Incomplete(ctx)
+}
+
+// RetryJournaled sends entry's request again, as a non-streamed chat
+// completion with the user, tags, policy and idempotency key it was first
+// sent with. Upstream may already have processed, and billed, the first
+// attempt; the idempotency key lets a deduplicating gateway tell.
+func (c *Client) RetryJournaled(ctx context.Context, entry JournalEntry) (openai.ChatCompletionResponse, error) {
+	if entry.User != "" {
+		ctx = ContextWithUser(ctx, entry.User)
+	}
+	for k, v := range entry.Tags {
+		ctx = ContextWithTag(ctx, k, v)
+	}
+	if entry.Policy != "" {
+		ctx = ContextWithPolicy(ctx, entry.Policy)
+	}
+	ctx = ContextWithIdempotencyKey(ctx, entry.Key)
+	request := entry.Request
+	request.Stream = false
+	return c.CreateChatCompletion(ctx, request)
+}
+
+// DiscardJournaled marks the journaled call key complete without retrying
+// it
+func (c *Client) DiscardJournaled(ctx context.Context, key string) error {
+	if c.journal == nil {
+		return errors.New("langmesh: no request journal; see WithRequestJournal")
+	}
+	return c.journal.Complete(ctx, key)
+}
+
+// journalRecord is a line of a FileJournal
+type journalRecord struct {
+	Begin    *JournalEntry `json:"begin,omitempty"`
+	Complete string        `json:"complete,omitempty"`
+}
+
+// FileJournal is a RequestJournal appending JSON Lines to a file, synced
+// after every record
+type FileJournal struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileJournal creates a FileJournal at path, which is created on the
+// first record if it does not exist
+func NewFileJournal(path string) *FileJournal {
+	return &FileJournal{Path: path}
+}
+
+func (j *FileJournal) Begin(_ context.Context, entry JournalEntry) error {
+	return j.append(journalRecord{Begin: &entry})
+}
+
+func (j *FileJournal) Complete(_ context.Context, key string) error {
+	return j.append(journalRecord{Complete: key})
+}
+
+func (j *FileJournal) append(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (j *FileJournal) Incomplete(context.Context) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.incomplete()
+}
+
+func (j *FileJournal) incomplete() ([]JournalEntry, error) {
+	f, err := os.Open(j.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	open := make(map[string]JournalEntry)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A crash can leave the last line half written
+			continue
+		}
+		switch {
+		case record.Begin != nil:
+			if _, ok := open[record.Begin.Key]; !ok {
+				order = append(order, record.Begin.Key)
+			}
+			open[record.Begin.Key] = *record.Begin
+		case record.Complete != "":
+			delete(open, record.Complete)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	entries := make([]JournalEntry, 0, len(open))
+	for _, key := range order {
+		if entry, ok := open[key]; ok {
+			entries = append(entries, entry)
+			delete(open, key)
+		}
+	}
+	return entries, nil
+}
+
+// Compact rewrites the file to hold only the incomplete entries, so it
+// does not grow without bound. Records appended concurrently wait for it.
+func (j *FileJournal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries, err := j.incomplete()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.Path), ".journal-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for i := range entries {
+		line, err := json.Marshal(journalRecord{Begin: &entries[i]})
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), j.Path)
+}
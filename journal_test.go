@@ -0,0 +1,126 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestJournal(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, chatResponseBody)
+	}))
+	t.Cleanup(srv.Close)
+
+	journal := NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithRequestJournal(journal))
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "req-1" {
+		t.Errorf("idempotency keys = %q", keys)
+	}
+	if entries, err := client.IncompleteRequests(ctx); err != nil || len(entries) != 0 {
+		t.Errorf("incomplete after success = %+v, %v", entries, err)
+	}
+
+	// Another process crashed with a call in flight
+	left := JournalEntry{Key: "order-42", RequestID: "req-0", Request: chatRequest("bill"), User: "u-1", SentAt: time.Now()}
+	if err := journal.Begin(ctx, left); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewClient("test-key", WithBaseURL(srv.URL), WithRequestJournal(NewFileJournal(journal.Path)))
+	entries, err := restarted.IncompleteRequests(ctx)
+	if err != nil || len(entries) != 1 || entries[0].Key != "order-42" || entries[0].User != "u-1" {
+		t.Fatalf("incomplete = %+v, %v", entries, err)
+	}
+	if _, err := restarted.RetryJournaled(ctx, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if keys[1] != "order-42" {
+		t.Errorf("retry idempotency key = %q", keys[1])
+	}
+	if entries, _ := restarted.IncompleteRequests(ctx); len(entries) != 0 {
+		t.Errorf("incomplete after retry = %+v", entries)
+	}
+}
+
+func TestRequestJournalStream(t *testing.T) {
+	srv := newStreamServer(t, "Hel", "lo")
+	journal := NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithRequestJournal(journal))
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := journal.Incomplete(context.Background())
+	if len(entries) != 1 || !entries[0].Stream {
+		t.Fatalf("in flight = %+v", entries)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if entries, _ := journal.Incomplete(context.Background()); len(entries) != 0 {
+		t.Errorf("incomplete after stream = %+v", entries)
+	}
+}
+
+func TestRequestJournalFailureBlocksSend(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	journal := NewFileJournal(filepath.Join(t.TempDir(), "missing", "journal.jsonl"))
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithRequestJournal(journal))
+
+	_, err := client.CreateChatCompletion(context.Background(), chatRequest("hi"))
+	if err == nil || !strings.Contains(err.Error(), "journaling request") {
+		t.Fatalf("err = %v", err)
+	}
+	if n := atomic.LoadInt32(calls); n != 0 {
+		t.Errorf("%d requests sent without a journal entry", n)
+	}
+}
+
+func TestFileJournalCompact(t *testing.T) {
+	ctx := context.Background()
+	journal := NewFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	for _, key := range []string{"a", "b", "c"} {
+		if err := journal.Begin(ctx, JournalEntry{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Complete(ctx, "b")
+	// A half-written line left by a crash
+	f, _ := os.OpenFile(journal.Path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"begin":{"ke`)
+	f.Close()
+
+	if err := journal.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := journal.Incomplete(ctx)
+	if err != nil || len(entries) != 2 || entries[0].Key != "a" || entries[1].Key != "c" {
+		t.Errorf("entries = %+v, %v", entries, err)
+	}
+	data, _ := os.ReadFile(journal.Path)
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("compacted to %d lines", lines)
+	}
+}
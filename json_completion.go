@@ -0,0 +1,350 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultJSONAttempts bounds CreateJSONCompletion when
+// JSONCompletionOptions.MaxAttempts is unset
+const DefaultJSONAttempts = 3
+
+// ErrJSONValidation is returned by CreateJSONCompletion when no attempt
+// produced JSON matching the schema
+var ErrJSONValidation = errors.New("langmesh: completion did not match the JSON schema")
+
+// JSONCompletionOptions configures CreateJSONCompletion
+type JSONCompletionOptions struct {
+	// Schema is the JSON Schema the reply must match: a json.RawMessage,
+	// or any value that marshals to one. The supported keywords are type,
+	// enum, const, properties, required, additionalProperties, items,
+	// anyOf, minimum, maximum, minLength, maxLength, pattern, minItems and
+	// maxItems; others are ignored.
+	Schema any
+
+	// MaxAttempts caps the completions made, the first included. Defaults
+	// to DefaultJSONAttempts.
+	MaxAttempts int
+}
+
+// JSONCompletionResult is the outcome of CreateJSONCompletion
+type JSONCompletionResult struct {
+	// Response is the last chat completion received
+	Response openai.ChatCompletionResponse
+
+	// Value is the reply that matched the schema
+	Value json.RawMessage
+
+	// Attempts is the number of completions made
+	Attempts int
+
+	// Errors are the last reply's validation errors, if it did not match
+	Errors []string
+}
+
+// CreateJSONCompletion requests JSON output matching opts.Schema. The
+// schema is added to the prompt and JSON mode is enabled unless request
+// sets a response format. A reply that does not match is sent back with
+// its validation errors for the model to repair, up to MaxAttempts
+// completions. Repairs are recorded in telemetry with JSONRepairAttempt
+// set.
+func (c *Client) CreateJSONCompletion(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	opts JSONCompletionOptions,
+) (JSONCompletionResult, error) {
+	raw, schema, err := parseJSONSchema(opts.Schema)
+	if err != nil {
+		return JSONCompletionResult{}, err
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultJSONAttempts
+	}
+	if request.ResponseFormat == nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	messages := append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "Reply with only a JSON value matching this JSON Schema:\n" + string(raw),
+	}}, request.Messages...)
+
+	var result JSONCompletionResult
+	for result.Attempts < maxAttempts {
+		result.Attempts++
+		attemptCtx := ctx
+		if repair := result.Attempts - 1; repair > 0 {
+			attemptCtx = deriveCarrier(ctx, func(s *scopeCarrier) { s.jsonRepair = repair })
+		}
+
+		request.Messages = messages
+		resp, err := c.CreateChatCompletion(attemptCtx, request)
+		if err != nil {
+			return result, err
+		}
+		result.Response = resp
+		if len(resp.Choices) == 0 {
+			return result, fmt.Errorf("langmesh: JSON completion got a completion with no choices")
+		}
+
+		reply := resp.Choices[0].Message
+		result.Errors = schema.validateDocument(reply.Content)
+		if len(result.Errors) == 0 {
+			result.Value = json.RawMessage(reply.Content)
+			return result, nil
+		}
+		messages = append(messages, reply, openai.ChatCompletionMessage{
+			Role: openai.ChatMessageRoleUser,
+			Content: "Your reply does not match the JSON Schema:\n- " + strings.Join(result.Errors, "\n- ") +
+				"\nReply again with only the corrected JSON.",
+		})
+	}
+	return result, fmt.Errorf("%w after %d attempts: %s", ErrJSONValidation, result.Attempts, strings.Join(result.Errors, "; "))
+}
+
+// applyJSONRepair copies the CreateJSONCompletion repair attempt on ctx
+// onto event
+func applyJSONRepair(ctx context.Context, event *TelemetryEvent) {
+	if carrier := carrierFrom(ctx); carrier != nil {
+		event.JSONRepairAttempt = carrier.jsonRepair
+	}
+}
+
+// jsonSchema is the subset of JSON Schema CreateJSONCompletion validates
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []any                  `json:"enum"`
+	Const                json.RawMessage        `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+
+	pattern    *regexp.Regexp
+	additional *jsonSchema
+	closed     bool
+}
+
+// schemaTypes is a schema's type, written as one name or a list
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+func parseJSONSchema(schema any) (json.RawMessage, *jsonSchema, error) {
+	raw, ok := schema.(json.RawMessage)
+	if !ok {
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return nil, nil, fmt.Errorf("langmesh: marshal JSON schema: %w", err)
+		}
+		raw = data
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, nil, fmt.Errorf("langmesh: parse JSON schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, nil, err
+	}
+	return raw, &s, nil
+}
+
+// compile parses the keywords validation needs in another form
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("langmesh: JSON schema pattern: %w", err)
+		}
+		s.pattern = re
+	}
+	switch trimmed := strings.TrimSpace(string(s.AdditionalProperties)); trimmed {
+	case "", "true":
+	case "false":
+		s.closed = true
+	default:
+		s.additional = &jsonSchema{}
+		if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+			return fmt.Errorf("langmesh: JSON schema additionalProperties: %w", err)
+		}
+	}
+	children := []*jsonSchema{s.Items, s.additional}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	children = append(children, s.AnyOf...)
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDocument returns what is wrong with text as an instance of s,
+// or nil if it matches
+func (s *jsonSchema) validateDocument(text string) []string {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return []string{"reply is not valid JSON: " + err.Error()}
+	}
+	return s.validate("$", value)
+}
+
+func (s *jsonSchema) validate(path string, value any) []string {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return []string{fmt.Sprintf("%s: must be %s, got %s", path, strings.Join(s.Type, " or "), jsonTypeOf(value))}
+	}
+	var problems []string
+	if len(s.Enum) > 0 && !containsJSON(s.Enum, value) {
+		allowed, _ := json.Marshal(s.Enum)
+		problems = append(problems, fmt.Sprintf("%s: must be one of %s", path, allowed))
+	}
+	if len(s.Const) > 0 {
+		var want any
+		if json.Unmarshal(s.Const, &want) == nil && !reflect.DeepEqual(want, value) {
+			problems = append(problems, fmt.Sprintf("%s: must be %s", path, s.Const))
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, alt := range s.AnyOf {
+			if len(alt.validate(path, value)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("%s: matches none of the anyOf schemas", path))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %d characters", path, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%s: must match %s", path, s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %v", path, *s.Maximum))
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at least %d items", path, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at most %d items", path, *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "." + name
+			switch prop, ok := s.Properties[name]; {
+			case ok:
+				problems = append(problems, prop.validate(child, v[name])...)
+			case s.closed:
+				problems = append(problems, fmt.Sprintf("%s: property not allowed", child))
+			case s.additional != nil:
+				problems = append(problems, s.additional.validate(child, v[name])...)
+			}
+		}
+	}
+	return problems
+}
+
+func (t schemaTypes) matches(value any) bool {
+	actual := jsonTypeOf(value)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf names the JSON Schema type of a decoded value, calling whole
+// numbers integers
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func containsJSON(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	_, schema, err := parseJSONSchema(json.RawMessage(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := schema.validateDocument(`{"name":"Ada","age":36,"role":"admin","tags":["x"]}`); problems != nil {
+		t.Errorf("valid document rejected: %v", problems)
+	}
+	got := schema.validateDocument(`{"name":"","age":1.5,"role":"root","tags":["a",2,"c"],"email":"a@b"}`)
+	want := []string{
+		"$.age: must be integer, got number",
+		`$.email: property not allowed`,
+		"$.name: must be at least 1 characters",
+		`$.role: must be one of ["admin","user"]`,
+		"$.tags: must have at most 2 items",
+		"$.tags[1]: must be string, got integer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := schema.validateDocument(`{"name": "Ada"`); len(got) != 1 || !strings.HasPrefix(got[0], "reply is not valid JSON") {
+		t.Errorf("malformed JSON: %v", got)
+	}
+	if got := schema.validateDocument(`{}`); len(got) != 2 {
+		t.Errorf("missing properties: %v", got)
+	}
+}
+
+func TestCreateJSONCompletionRepairs(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence(`{"name":"Ada"}`, `{"name":"Ada","age":36}`))
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	result, err := client.CreateJSONCompletion(context.Background(), chatRequest("who wrote the first program?"),
+		JSONCompletionOptions{Schema: json.RawMessage(personSchema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Attempts != 2 || string(result.Value) != `{"name":"Ada","age":36}` {
+		t.Errorf("result = %+v", result)
+	}
+
+	sent := requests()
+	if sent[0].ResponseFormat == nil || sent[0].ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+		t.Errorf("JSON mode not enabled: %+v", sent[0].ResponseFormat)
+	}
+	if !strings.Contains(sent[0].Messages[0].Content, `"additionalProperties"`) {
+		t.Errorf("schema not in the prompt: %q", sent[0].Messages[0].Content)
+	}
+	feedback := sent[1].Messages[len(sent[1].Messages)-1]
+	if feedback.Role != openai.ChatMessageRoleUser || !strings.Contains(feedback.Content, `$: missing required property "age"`) {
+		t.Errorf("feedback = %+v", feedback)
+	}
+
+	events := rec.all()
+	if len(events) != 2 || events[0].JSONRepairAttempt != 0 || events[1].JSONRepairAttempt != 1 {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestCreateJSONCompletionGivesUp(t *testing.T) {
+	srv, requests := newRecordingServer(t, replySequence(`not json`))
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+
+	result, err := client.CreateJSONCompletion(context.Background(), chatRequest("hi"), JSONCompletionOptions{
+		Schema:      map[string]any{"type": "object"},
+		MaxAttempts: 2,
+	})
+	if !errors.Is(err, ErrJSONValidation) || result.Attempts != 2 || len(result.Errors) != 1 {
+		t.Errorf("err = %v, result = %+v", err, result)
+	}
+	if n := len(requests()); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
@@ -0,0 +1,270 @@
+package langmesh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultKeyCooldown is how long a key that hit a 429 is rested when the
+// response does not say when to retry
+const DefaultKeyCooldown = 30 * time.Second
+
+// APIKey is one key of a KeyPool
+type APIKey struct {
+	Key string
+	// Organization is sent as OpenAI-Organization when set
+	Organization string
+	// Weight is the key's share of requests relative to the other keys',
+	// e.g. in proportion to its rate limits. Zero means 1.
+	Weight float64
+}
+
+// KeyStatus is a pool key's current state
+type KeyStatus struct {
+	// ID is the hash of the key recorded in telemetry
+	ID           string
+	Organization string
+	Weight       float64
+	// Headroom is the smaller share of the request and token limits left,
+	// 1 before the key's limits are known
+	Headroom float64
+	// CoolingUntil is when a key that hit a 429 is next used
+	CoolingUntil time.Time
+	Requests     int64
+}
+
+// KeyPool spreads requests across several API keys, for example across
+// organizations, in proportion to their weights scaled by the rate limit
+// headroom each key last reported. Keys that get a 429 cool down until the
+// limit resets. A pool may be shared between clients.
+type KeyPool struct {
+	// Cooldown rests a key that got a 429 without Retry-After or reset
+	// headers; zero means DefaultKeyCooldown
+	Cooldown time.Duration
+
+	mu   sync.Mutex
+	keys []*pooledKey
+	now  func() time.Time
+}
+
+type pooledKey struct {
+	APIKey
+	id string
+	// current is the key's smooth weighted round robin counter
+	current  float64
+	limits   *RateLimitInfo
+	limitsAt time.Time
+	cooling  time.Time
+	requests int64
+}
+
+// NewKeyPool creates a pool of keys
+func NewKeyPool(keys ...APIKey) *KeyPool {
+	p := &KeyPool{now: time.Now}
+	for _, k := range keys {
+		if k.Weight <= 0 {
+			k.Weight = 1
+		}
+		p.keys = append(p.keys, &pooledKey{APIKey: k, id: keyID(k.Key)})
+	}
+	return p
+}
+
+// WithKeyPool sends each OpenAI request with a key from pool instead of
+// the client's own, and records the hashed key as APIKeyID in telemetry.
+// A request that gets a 429 is retried once on each other key with room.
+// The pool's balancing replaces adaptive throttling, which would pace by
+// whichever key answered last.
+func WithKeyPool(pool *KeyPool) Option {
+	return func(c *Client) {
+		c.keyPool = pool
+	}
+}
+
+// keyID hashes key, so telemetry can tell keys apart without holding them
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:6])
+}
+
+// Keys returns the state of every key in the pool
+func (p *KeyPool) Keys() []KeyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	out := make([]KeyStatus, len(p.keys))
+	for i, k := range p.keys {
+		out[i] = KeyStatus{
+			ID:           k.id,
+			Organization: k.Organization,
+			Weight:       k.Weight,
+			Headroom:     k.headroom(now),
+			CoolingUntil: k.cooling,
+			Requests:     k.requests,
+		}
+	}
+	return out
+}
+
+// headroom is the share of the key's tightest limit left at now, counting
+// a limit whose reset has passed as full
+func (k *pooledKey) headroom(now time.Time) float64 {
+	if k.limits == nil {
+		return 1
+	}
+	elapsed := now.Sub(k.limitsAt)
+	share := func(remaining, limit int64, reset time.Duration) float64 {
+		if limit <= 0 || reset <= elapsed {
+			return 1
+		}
+		return max(float64(remaining), 0) / float64(limit)
+	}
+	return min(
+		share(k.limits.RemainingRequests, k.limits.LimitRequests, k.limits.ResetRequests),
+		share(k.limits.RemainingTokens, k.limits.LimitTokens, k.limits.ResetTokens),
+	)
+}
+
+// pick chooses the next key by smooth weighted round robin over the keys
+// with room, skipping tried. With none, it returns nil if any key was
+// skipped, and otherwise the key that recovers first.
+func (p *KeyPool) pick(tried map[*pooledKey]bool) *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) == 0 {
+		return nil
+	}
+	now := p.now()
+	var best *pooledKey
+	total := 0.0
+	for _, k := range p.keys {
+		if tried[k] || now.Before(k.cooling) {
+			continue
+		}
+		weight := k.Weight * k.headroom(now)
+		if weight <= 0 {
+			continue
+		}
+		k.current += weight
+		total += weight
+		if best == nil || k.current > best.current {
+			best = k
+		}
+	}
+	if best != nil {
+		best.current -= total
+	} else if len(tried) > 0 {
+		return nil
+	} else {
+		best = p.keys[0]
+		for _, k := range p.keys[1:] {
+			if k.recovery(now).Before(best.recovery(now)) {
+				best = k
+			}
+		}
+	}
+	best.requests++
+	return best
+}
+
+// recovery is when a key without room will next have some
+func (k *pooledKey) recovery(now time.Time) time.Time {
+	at := k.cooling
+	if k.limits != nil {
+		reset := max(k.limits.ResetRequests, k.limits.ResetTokens)
+		if t := k.limitsAt.Add(reset); t.After(at) {
+			at = t
+		}
+	}
+	if at.Before(now) {
+		return now
+	}
+	return at
+}
+
+// observe records a response's rate limits for k, cooling it down after a
+// 429. It returns the cooldown, zero if the key is not cooling.
+func (p *KeyPool) observe(k *pooledKey, resp *http.Response) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	info := parseRateLimit(resp.Header)
+	if info != nil {
+		k.limits = info
+		k.limitsAt = now
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	wait := p.Cooldown
+	if wait <= 0 {
+		wait = DefaultKeyCooldown
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if info != nil {
+		if reset := max(info.ResetRequests, info.ResetTokens); reset > 0 {
+			wait = reset
+		}
+	}
+	k.cooling = now.Add(wait)
+	return wait
+}
+
+// keyPoolTransport sets each request to host's key from the pool
+type keyPoolTransport struct {
+	base   http.RoundTripper
+	host   string
+	pool   *KeyPool
+	client *Client
+}
+
+func (t keyPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	key := t.pool.pick(nil)
+	if key == nil {
+		return t.base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	tried := make(map[*pooledKey]bool)
+	body := req.Body
+	for {
+		out := req.Clone(ctx)
+		out.Body = body
+		out.Header.Set("Authorization", "Bearer "+key.Key)
+		if key.Organization != "" {
+			out.Header.Set(organizationHeader, key.Organization)
+		}
+		callStateFrom(ctx).setAPIKey(key.id)
+
+		resp, err := t.base.RoundTrip(out)
+		if err != nil {
+			return nil, err
+		}
+		wait := t.pool.observe(key, resp)
+		if wait == 0 {
+			return resp, nil
+		}
+		t.client.log(ctx, LogRetry, "api key rate limited, cooling down", "key", key.id, "cooldown", wait)
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		tried[key] = true
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+		next := t.pool.pick(tried)
+		if next == nil {
+			body.Close()
+			return resp, nil
+		}
+		resp.Body.Close()
+		key = next
+	}
+}
@@ -0,0 +1,117 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newKeyServer answers chat requests, counting them by key, and rejects
+// keys in limited with a 429
+func newKeyServer(t *testing.T, limited map[string]bool) (*httptest.Server, func() map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mu.Lock()
+		counts[auth]++
+		mu.Unlock()
+		if limited[auth] {
+			w.Header().Set("Retry-After", "20")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"slow down","type":"requests"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		out := make(map[string]int, len(counts))
+		for k, v := range counts {
+			out[k] = v
+		}
+		return out
+	}
+}
+
+func TestKeyPoolWeights(t *testing.T) {
+	srv, counts := newKeyServer(t, nil)
+	pool := NewKeyPool(APIKey{Key: "sk-a", Weight: 3}, APIKey{Key: "sk-b", Organization: "org-b"})
+	client := NewClient("unused", WithBaseURL(srv.URL+"/v1"), WithKeyPool(pool))
+	for i := 0; i < 8; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := counts()
+	if got["Bearer sk-a"] != 6 || got["Bearer sk-b"] != 2 || got["Bearer unused"] != 0 {
+		t.Errorf("requests by key = %v", got)
+	}
+}
+
+func TestKeyPoolHeadroom(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	pool := NewKeyPool(APIKey{Key: "a"}, APIKey{Key: "b"})
+	pool.now = func() time.Time { return now }
+	exhausted := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	exhausted.Header.Set("X-Ratelimit-Limit-Requests", "100")
+	exhausted.Header.Set("X-Ratelimit-Remaining-Requests", "0")
+	exhausted.Header.Set("X-Ratelimit-Reset-Requests", "10s")
+	pool.observe(pool.keys[0], exhausted)
+
+	for i := 0; i < 3; i++ {
+		if k := pool.pick(nil); k.Key != "b" {
+			t.Fatalf("picked exhausted key %s", k.Key)
+		}
+	}
+	if h := pool.Keys()[0].Headroom; h != 0 {
+		t.Errorf("headroom = %v", h)
+	}
+	now = now.Add(11 * time.Second)
+	if h := pool.Keys()[0].Headroom; h != 1 {
+		t.Errorf("headroom after reset = %v", h)
+	}
+}
+
+func TestKeyPoolCoolsDownRateLimitedKeys(t *testing.T) {
+	srv, counts := newKeyServer(t, map[string]bool{"Bearer sk-a": true})
+	pool := NewKeyPool(APIKey{Key: "sk-a", Weight: 10}, APIKey{Key: "sk-b"})
+	rec := &eventRecorder{}
+	logs := &logBuffer{}
+	client := NewClient("unused", WithBaseURL(srv.URL+"/v1"), WithKeyPool(pool), withRecorder(rec),
+		WithLogger(newTestLogger(logs)))
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := counts(); got["Bearer sk-a"] != 1 || got["Bearer sk-b"] != 3 {
+		t.Errorf("requests by key = %v", got)
+	}
+	status := pool.Keys()
+	if until := status[0].CoolingUntil; time.Until(until) < 15*time.Second {
+		t.Errorf("cooling until %v, want Retry-After", until)
+	}
+	for _, e := range rec.all() {
+		if e.APIKeyID != keyID("sk-b") || e.APIKeyID != status[1].ID {
+			t.Errorf("APIKeyID = %q", e.APIKeyID)
+		}
+	}
+	cooldowns := 0
+	for _, record := range logs.records() {
+		if record["msg"] == "langmesh: api key rate limited, cooling down" && record["key"] == status[0].ID {
+			cooldowns++
+		}
+	}
+	if cooldowns != 1 {
+		t.Errorf("logged %d cooldowns", cooldowns)
+	}
+}
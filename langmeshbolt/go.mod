@@ -0,0 +1,17 @@
+module github.com/langmesh-ai/openai-go/langmeshbolt
+
+go 1.21
+
+require (
+	github.com/langmesh-ai/openai-go v0.0.0-20261014114332-eb1935dd1109
+	go.etcd.io/bbolt v1.3.10
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/sashabaranov/go-openai v1.20.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+)
+
+// Builds in this repository use the parent module as checked out
+replace github.com/langmesh-ai/openai-go => ../
@@ -0,0 +1,127 @@
+// Package langmeshbolt is a langmesh.EventStore in a bbolt file, so that a
+// client's telemetry survives restarts without a remote backend
+package langmeshbolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var eventsBucket = []byte("events")
+
+// Store keeps telemetry events in a bbolt database, keyed by end time
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the store at path. Only one process can have it
+// open at a time; Open waits up to a second for another to close it.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: opening event store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("langmesh: opening event store %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Append writes events in one transaction
+func (s *Store) Append(_ context.Context, events []langmesh.TelemetryEvent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(eventKey(event.EndTime(), seq), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query scans the events between q.Since and q.Until, oldest first
+func (s *Store) Query(ctx context.Context, q langmesh.EventQuery) ([]langmesh.TelemetryEvent, error) {
+	var out []langmesh.TelemetryEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		var until []byte
+		if !q.Until.IsZero() {
+			until = eventKey(q.Until, 0)
+		}
+		for k, v := c.Seek(eventKey(q.Since, 0)); k != nil; k, v = c.Next() {
+			if until != nil && string(k) >= string(until) {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var event langmesh.TelemetryEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return fmt.Errorf("langmesh: reading stored event: %w", err)
+			}
+			if q.Match(event) {
+				out = append(out, event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+// Prune deletes events that ended before before
+func (s *Store) Prune(_ context.Context, before time.Time) error {
+	end := eventKey(before, 0)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, _ := c.First(); k != nil && string(k) < string(end); k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// eventKey orders events by end time, then by the order they were written.
+// Times before the Unix epoch, such as the zero time, sort first.
+func eventKey(at time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	var nanos uint64
+	if at.After(time.Unix(0, 0)) {
+		nanos = uint64(at.UnixNano())
+	}
+	binary.BigEndian.PutUint64(key, nanos)
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
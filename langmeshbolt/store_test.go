@@ -0,0 +1,102 @@
+package langmeshbolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+)
+
+var _ langmesh.EventStore = (*Store)(nil)
+
+func event(model string, at time.Time, cost float64) langmesh.TelemetryEvent {
+	return langmesh.TelemetryEvent{
+		Model:           model,
+		Status:          "success",
+		TimestampEnd:    at.Format(time.RFC3339),
+		CostEstimateUSD: cost,
+		Tags:            map[string]string{"agent": model},
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	err = store.Append(ctx, []langmesh.TelemetryEvent{
+		event("gpt-4o", base.Add(2*time.Minute), 0.3),
+		event("gpt-4o-mini", base, 0.1),
+		event("gpt-4o", base.Add(time.Minute), 0.2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events survive reopening
+	store.Close()
+	if store, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, tc := range []struct {
+		name  string
+		query langmesh.EventQuery
+		want  []float64
+	}{
+		{"all", langmesh.EventQuery{}, []float64{0.1, 0.2, 0.3}},
+		{"model", langmesh.EventQuery{Model: "gpt-4o"}, []float64{0.2, 0.3}},
+		{"tag", langmesh.EventQuery{Tags: map[string]string{"agent": "gpt-4o-mini"}}, []float64{0.1}},
+		{"range", langmesh.EventQuery{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, []float64{0.2}},
+		{"limit", langmesh.EventQuery{Limit: 1}, []float64{0.3}},
+	} {
+		events, err := store.Query(ctx, tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []float64
+		for _, e := range events {
+			got = append(got, e.CostEstimateUSD)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: costs = %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: costs = %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+
+	if err := store.Prune(ctx, base.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := store.Query(ctx, langmesh.EventQuery{}); len(events) != 2 || events[0].CostEstimateUSD != 0.2 {
+		t.Errorf("after Prune: %+v", events)
+	}
+}
+
+func TestStoreWithEventRetention(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	store.Append(context.Background(), []langmesh.TelemetryEvent{event("gpt-4o", now.Add(-time.Minute), 0.25)})
+
+	retention := langmesh.NewEventRetention(store, time.Hour)
+	defer retention.Close()
+	report, err := retention.CostReport(context.Background(), now.Add(-time.Hour), now)
+	if err != nil || report.Total.Requests != 1 || report.ByModel["gpt-4o"].CostUSD != 0.25 {
+		t.Errorf("report = %+v, %v", report, err)
+	}
+}
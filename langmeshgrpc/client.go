@@ -0,0 +1,123 @@
+package langmeshgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Client calls a Proxy service from Go with go-openai types. Failures the
+// proxy reported come back as *openai.APIError, as from the HTTP proxy;
+// transport failures as gRPC status errors.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient creates a Client over conn
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// CreateChatCompletion makes a chat completion through the proxy
+func (c *Client) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest, opts ...grpc.CallOption) (openai.ChatCompletionResponse, error) {
+	var resp openai.ChatCompletionResponse
+	err := c.invoke(ctx, methodChat, req, &resp, opts)
+	return resp, err
+}
+
+// CreateEmbeddings makes an embeddings request through the proxy
+func (c *Client) CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequest, opts ...grpc.CallOption) (openai.EmbeddingResponse, error) {
+	var resp openai.EmbeddingResponse
+	err := c.invoke(ctx, methodEmbeddings, req, &resp, opts)
+	return resp, err
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp any, opts []grpc.CallOption) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	out := new(wrapperspb.BytesValue)
+	if err := c.conn.Invoke(ctx, method, wrapperspb.Bytes(body), out, opts...); err != nil {
+		return apiError(err)
+	}
+	return json.Unmarshal(out.GetValue(), resp)
+}
+
+// ChatCompletionStream is a chat completion streamed through the proxy
+type ChatCompletionStream struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+// CreateChatCompletionStream starts streaming a chat completion through
+// the proxy. Close the stream when done with it.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, opts ...grpc.CallOption) (*ChatCompletionStream, error) {
+	req.Stream = true
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], methodChatStream, opts...)
+	if err == nil {
+		err = stream.SendMsg(wrapperspb.Bytes(body))
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		cancel()
+		return nil, apiError(err)
+	}
+	return &ChatCompletionStream{stream: stream, cancel: cancel}, nil
+}
+
+// Recv returns the next chunk, and io.EOF once the stream is complete
+func (s *ChatCompletionStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	var chunk openai.ChatCompletionStreamResponse
+	msg := new(wrapperspb.BytesValue)
+	if err := s.stream.RecvMsg(msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			return chunk, io.EOF
+		}
+		return chunk, apiError(err)
+	}
+	err := json.Unmarshal(msg.GetValue(), &chunk)
+	return chunk, err
+}
+
+// Close ends the stream, cancelling the upstream call if it is still
+// running
+func (s *ChatCompletionStream) Close() {
+	s.cancel()
+}
+
+// apiError recovers the proxy's error body from a status, if it has one
+func apiError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var body openai.ErrorResponse
+	httpStatus := 0
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *wrapperspb.BytesValue:
+			_ = json.Unmarshal(d.GetValue(), &body)
+		case *wrapperspb.Int32Value:
+			httpStatus = int(d.GetValue())
+		}
+	}
+	if body.Error == nil {
+		return err
+	}
+	body.Error.HTTPStatusCode = httpStatus
+	return body.Error
+}
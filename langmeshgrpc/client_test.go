@@ -0,0 +1,68 @@
+package langmeshgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	"github.com/langmesh-ai/openai-go/langmeshproxy"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestClient(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	caller := NewClient(dial(t, langmeshproxy.New(client)))
+	ctx := context.Background()
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+
+	resp, err := caller.CreateChatCompletion(ctx, req)
+	if err != nil || resp.Choices[0].Message.Content != "Hello" {
+		t.Fatalf("chat = %+v, %v", resp, err)
+	}
+
+	stream, err := caller.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	var got strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if got.String() != "Hello" {
+		t.Errorf("streamed content = %q", got.String())
+	}
+
+	embeddings, err := caller.CreateEmbeddings(ctx, openai.EmbeddingRequest{Model: openai.SmallEmbedding3, Input: "hi"})
+	if err != nil || len(embeddings.Data) != 1 || embeddings.Data[0].Embedding[0] != 0.5 {
+		t.Errorf("embeddings = %+v, %v", embeddings, err)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	client := langmesh.NewClient("upstream-key",
+		langmesh.WithBaseURL(upstream.URL),
+		langmesh.WithBudget(langmesh.NewBudget(0, time.Hour)),
+	)
+	caller := NewClient(dial(t, langmeshproxy.New(client)))
+
+	_, err := caller.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusTooManyRequests || apiErr.Code != "budget_exceeded" {
+		t.Fatalf("err = %v, want the proxy's 429 budget_exceeded", err)
+	}
+}
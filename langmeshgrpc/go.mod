@@ -0,0 +1,21 @@
+module github.com/langmesh-ai/openai-go/langmeshgrpc
+
+go 1.21
+
+require (
+	github.com/langmesh-ai/openai-go v0.0.0-20261014114332-eb1935dd1109
+	github.com/sashabaranov/go-openai v1.20.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+// Builds in this repository use the parent module as checked out
+replace github.com/langmesh-ai/openai-go => ../
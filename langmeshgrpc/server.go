@@ -0,0 +1,249 @@
+// Package langmeshgrpc serves the langmesh proxy over gRPC, for platforms
+// that standardize on gRPC rather than REST. Calls run through the same
+// langmeshproxy.Handler as the HTTP proxy, with its client's telemetry,
+// budgets and redaction and the handler's cache. The service is defined in
+// langmesh.proto; its messages are OpenAI JSON bodies.
+//
+// It is a module of its own, so that the gRPC dependency stays out of
+// langmesh.
+//
+// Usage:
+//
+//	handler := langmeshproxy.New(client, langmeshproxy.WithCache(5*time.Minute))
+//	srv := grpc.NewServer()
+//	langmeshgrpc.New(handler).Register(srv)
+//	lis, err := net.Listen("tcp", ":9090")
+//	srv.Serve(lis)
+package langmeshgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/langmesh-ai/openai-go/langmeshproxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	// ServiceName is the gRPC service in langmesh.proto
+	ServiceName = "langmesh.v1.Proxy"
+
+	methodChat       = "/" + ServiceName + "/CreateChatCompletion"
+	methodChatStream = "/" + ServiceName + "/CreateChatCompletionStream"
+	methodEmbeddings = "/" + ServiceName + "/CreateEmbeddings"
+)
+
+// Server implements the Proxy service on top of a langmeshproxy.Handler
+type Server struct {
+	handler   *langmeshproxy.Handler
+	authorize func(context.Context) error
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithAuthorizer rejects calls for which authorize returns an error,
+// before any upstream call is made. The incoming metadata is in ctx, for
+// metadata.FromIncomingContext. An error that is not a gRPC status is
+// returned as Unauthenticated.
+func WithAuthorizer(authorize func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.authorize = authorize
+	}
+}
+
+// New creates a Server backed by handler
+func New(handler *langmeshproxy.Handler, opts ...Option) *Server {
+	s := &Server{handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the Proxy service with a gRPC server
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	registrar.RegisterService(&serviceDesc, s)
+}
+
+// proxyServer is the service's handler type
+type proxyServer interface {
+	CreateChatCompletion(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+	CreateChatCompletionStream(*wrapperspb.BytesValue, grpc.ServerStream) error
+	CreateEmbeddings(context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*proxyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "CreateChatCompletion", Handler: unaryHandler(methodChat, proxyServer.CreateChatCompletion)},
+		{MethodName: "CreateEmbeddings", Handler: unaryHandler(methodEmbeddings, proxyServer.CreateEmbeddings)},
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "CreateChatCompletionStream",
+		ServerStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			in := new(wrapperspb.BytesValue)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(proxyServer).CreateChatCompletionStream(in, stream)
+		},
+	}},
+	Metadata: "langmesh.proto",
+}
+
+// unaryHandler adapts a unary method to grpc.MethodDesc, as generated code
+// would
+func unaryHandler(
+	fullMethod string,
+	method func(proxyServer, context.Context, *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error),
+) func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(wrapperspb.BytesValue)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return method(srv.(proxyServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+			return method(srv.(proxyServer), ctx, req.(*wrapperspb.BytesValue))
+		})
+	}
+}
+
+// CreateChatCompletion serves a chat completion, setting the
+// "x-langmesh-cache: hit" header when it came from the cache
+func (s *Server) CreateChatCompletion(ctx context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	// Cached responses are kept per caller credential, as over HTTP
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		ctx = langmeshproxy.ContextWithCaller(ctx, md.Get("authorization")[0])
+	}
+	resp, cached, err := s.handler.ChatCompletion(ctx, in.GetValue())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if cached {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-langmesh-cache", "hit"))
+	}
+	return marshal(resp)
+}
+
+// CreateChatCompletionStream streams a chat completion. A caller that
+// cancels the RPC cancels the upstream call.
+func (s *Server) CreateChatCompletionStream(in *wrapperspb.BytesValue, out grpc.ServerStream) error {
+	ctx := out.Context()
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	stream, err := s.handler.ChatCompletionStream(ctx, in.GetValue())
+	if err != nil {
+		return statusError(err)
+	}
+	defer stream.Close()
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return statusError(err)
+		}
+		msg, err := marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if err := out.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// CreateEmbeddings serves an embeddings request
+func (s *Server) CreateEmbeddings(ctx context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := s.handler.Embeddings(ctx, in.GetValue())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return marshal(resp)
+}
+
+func (s *Server) check(ctx context.Context) error {
+	if s.authorize == nil {
+		return nil
+	}
+	err := s.authorize(ctx)
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+func marshal(v any) (*wrapperspb.BytesValue, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+// statusError turns an error from the pipeline into a gRPC status carrying
+// the HTTP proxy's error body and status as details
+func statusError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	httpStatus, body := langmeshproxy.DescribeError(err)
+	st := status.New(grpcCode(httpStatus), err.Error())
+	if detailed, detailErr := st.WithDetails(wrapperspb.Bytes(body), wrapperspb.Int32(int32(httpStatus))); detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcCode maps an HTTP status onto the gRPC code for it
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,173 @@
+package langmeshgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	"github.com/langmesh-ai/openai-go/langmeshproxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newUpstream(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/chat/completions" && strings.Contains(string(body), `"stream":true`):
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, p := range []string{"Hel", "lo"} {
+				fmt.Fprintf(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", p)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		case r.URL.Path == "/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+		case r.URL.Path == "/embeddings":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.5,0.25]}],"usage":{"prompt_tokens":1,"total_tokens":1}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// dial serves handler over an in-memory listener and connects to it
+func dial(t *testing.T, handler *langmeshproxy.Handler, opts ...Option) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	New(handler, opts...).Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServerChatCompletionCache(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	conn := dial(t, langmeshproxy.New(client, langmeshproxy.WithCache(time.Minute)))
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	for i := 0; i < 2; i++ {
+		out := new(wrapperspb.BytesValue)
+		var header metadata.MD
+		if err := conn.Invoke(context.Background(), methodChat, wrapperspb.Bytes(body), out, grpc.Header(&header)); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if !strings.Contains(string(out.GetValue()), `"content":"Hello"`) {
+			t.Errorf("response = %s", out.GetValue())
+		}
+		if hit := len(header.Get("x-langmesh-cache")) > 0; hit != (i == 1) {
+			t.Errorf("call %d: cache header = %v", i, header.Get("x-langmesh-cache"))
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("upstream saw %d calls, want the second served from the cache", *calls)
+	}
+
+	// Another caller's credential does not share those entries
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer other")
+	if err := conn.Invoke(ctx, methodChat, wrapperspb.Bytes(body), new(wrapperspb.BytesValue)); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("upstream saw %d calls, want another caller's request sent upstream", *calls)
+	}
+}
+
+func TestServerChatCompletionStream(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	conn := dial(t, langmeshproxy.New(client))
+
+	stream, err := conn.NewStream(context.Background(), &serviceDesc.Streams[0], methodChatStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(wrapperspb.Bytes([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	var chunks []string
+	for {
+		msg := new(wrapperspb.BytesValue)
+		err := stream.RecvMsg(msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(msg.GetValue()))
+	}
+	if len(chunks) != 2 || !strings.Contains(chunks[0], `"content":"Hel"`) {
+		t.Errorf("chunks = %q", chunks)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key",
+		langmesh.WithBaseURL(upstream.URL),
+		langmesh.WithBudget(langmesh.NewBudget(0, time.Hour)),
+	)
+	conn := dial(t, langmeshproxy.New(client), WithAuthorizer(func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get("authorization")) == 0 {
+			return errors.New("missing token")
+		}
+		return nil
+	}))
+	ctx := context.Background()
+	invoke := func(ctx context.Context, body string) error {
+		return conn.Invoke(ctx, methodChat, wrapperspb.Bytes([]byte(body)), new(wrapperspb.BytesValue))
+	}
+
+	if err := invoke(ctx, `{"model":"gpt-4o"}`); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("without a token: err = %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer t")
+	if err := invoke(ctx, `{not json`); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad json: err = %v", err)
+	}
+	err := invoke(ctx, `{"model":"gpt-4o"}`)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("over budget: err = %v", err)
+	}
+	details := status.Convert(err).Details()
+	if len(details) != 2 || !strings.Contains(string(details[0].(*wrapperspb.BytesValue).GetValue()), "budget_exceeded") ||
+		details[1].(*wrapperspb.Int32Value).GetValue() != http.StatusTooManyRequests {
+		t.Errorf("details = %v", details)
+	}
+	if *calls != 0 {
+		t.Error("rejected requests reached upstream")
+	}
+}
@@ -0,0 +1,531 @@
+// Package langmeshproxy exposes a langmesh client as an OpenAI-compatible
+// HTTP server, so services in any language get langmesh telemetry, budgets,
+// redaction, and caching by pointing their OpenAI SDK at it
+//
+// Usage:
+//
+//	client := langmesh.NewClient(os.Getenv("OPENAI_API_KEY"), langmesh.WithRedaction(), langmesh.WithRequestRedaction())
+//	handler := langmeshproxy.New(client,
+//		langmeshproxy.WithAuthorizer(checkToken), // required; every route spends the server's key
+//		langmeshproxy.WithCache(5*time.Minute),
+//		langmeshproxy.WithPassthrough("https://api.openai.com/v1", os.Getenv("OPENAI_API_KEY")),
+//	)
+//	if err := handler.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":8080", handler)
+package langmeshproxy
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const maxRequestBytes = 32 << 20
+
+// DefaultCacheEntries bounds WithCache's cache unless WithCacheEntries
+// changes it
+const DefaultCacheEntries = 1024
+
+// Handler serves the OpenAI REST API on top of a langmesh client. Chat
+// completions and embeddings run through the client; every other path is
+// forwarded upstream unchanged when passthrough is configured.
+//
+// Every route spends the client's API key, so serving HTTP requires
+// WithAuthorizer; an authorizer returning nil opts into open access.
+type Handler struct {
+	client       *langmesh.Client
+	mux          *http.ServeMux
+	passthrough  http.Handler
+	authorize    func(*http.Request) error
+	cache        *responseCache
+	cacheEntries int
+	configErr    error
+}
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithPassthrough forwards unhandled paths to upstreamURL (e.g.
+// "https://api.openai.com/v1"). SSE responses are flushed as they arrive.
+//
+// The caller's Authorization header is REPLACED with apiKey, so anyone the
+// authorizer admits spends on that key.
+func WithPassthrough(upstreamURL, apiKey string) Option {
+	return func(h *Handler) {
+		target, err := url.Parse(upstreamURL)
+		if err == nil && (target.Scheme == "" || target.Host == "") {
+			err = errors.New("want an absolute URL")
+		}
+		if err != nil {
+			h.configErr = errors.Join(h.configErr, fmt.Errorf("langmeshproxy: passthrough URL %q: %w", upstreamURL, err))
+			return
+		}
+		proxy := &httputil.ReverseProxy{
+			Director: func(r *http.Request) {
+				r.URL.Scheme = target.Scheme
+				r.URL.Host = target.Host
+				r.URL.Path = singleJoin(target.Path, strings.TrimPrefix(r.URL.Path, "/v1"))
+				r.Host = target.Host
+				r.Header.Set("Authorization", "Bearer "+apiKey)
+			},
+			FlushInterval: -1,
+		}
+		h.passthrough = proxy
+	}
+}
+
+// WithAuthorizer rejects incoming requests for which authorize returns an
+// error, before any upstream call is made. ServeHTTP refuses every request
+// without one.
+func WithAuthorizer(authorize func(*http.Request) error) Option {
+	return func(h *Handler) {
+		h.authorize = authorize
+	}
+}
+
+// WithCache serves identical non-streaming chat completion requests from
+// memory for ttl. Entries are per caller, as identified by the request's
+// Authorization header or ContextWithCaller, and the least recently used
+// are evicted beyond DefaultCacheEntries or WithCacheEntries.
+func WithCache(ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.cache = newResponseCache(ttl, DefaultCacheEntries)
+	}
+}
+
+// WithCacheEntries bounds the WithCache cache to n responses, in any
+// order with WithCache
+func WithCacheEntries(n int) Option {
+	return func(h *Handler) {
+		h.cacheEntries = n
+	}
+}
+
+// New creates a proxy handler backed by client. A misconfigured handler,
+// see Err, fails every request.
+func New(client *langmesh.Client, opts ...Option) *Handler {
+	h := &Handler{client: client, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.cache != nil && h.cacheEntries > 0 {
+		h.cache.max = h.cacheEntries
+	}
+	h.mux.HandleFunc("/v1/chat/completions", h.handleChat)
+	h.mux.HandleFunc("/v1/embeddings", h.handleEmbeddings)
+	h.mux.HandleFunc("/", h.handleOther)
+	return h
+}
+
+var errNoAuthorizer = errors.New("langmeshproxy: every route spends the server's API key and needs WithAuthorizer")
+
+// Err reports the misconfigurations that stop the handler serving HTTP,
+// such as an invalid passthrough URL or a missing authorizer. Front ends
+// calling ChatCompletion and the other methods authorize calls themselves,
+// and only fail on the other misconfigurations.
+func (h *Handler) Err() error {
+	if h.authorize == nil {
+		return errors.Join(h.configErr, errNoAuthorizer)
+	}
+	return h.configErr
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "misconfigured", err.Error())
+		return
+	}
+	if err := h.authorize(r); err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "unauthorized", err.Error())
+		return
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		r = r.WithContext(ContextWithCaller(r.Context(), auth))
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+type callerKey struct{}
+
+// ContextWithCaller identifies the caller of ChatCompletion, whose cached
+// responses are kept apart from other callers'. ServeHTTP uses the
+// Authorization header; other front ends pass their credential or
+// authorized identity.
+func ContextWithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+func callerFrom(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+func (h *Handler) handleOther(w http.ResponseWriter, r *http.Request) {
+	if h.passthrough == nil {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown_url", "unknown path "+r.URL.Path)
+		return
+	}
+	h.passthrough.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method_not_allowed", "use POST")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid_body", err.Error())
+		return
+	}
+	req, err := parseChatRequest(body)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if req.Stream {
+		h.streamChat(w, r, req)
+		return
+	}
+
+	resp, cached, err := h.chat(r.Context(), body, req)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	if h.cache != nil {
+		result := "miss"
+		if cached {
+			result = "hit"
+		}
+		w.Header().Set("X-Langmesh-Cache", result)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ChatCompletion runs a chat completion request body through the same
+// pipeline as /v1/chat/completions, the cache included, as for serving it
+// over another protocol. It reports whether the response was cached. A
+// "stream" field is ignored.
+func (h *Handler) ChatCompletion(ctx context.Context, body []byte) (openai.ChatCompletionResponse, bool, error) {
+	req, err := parseChatRequest(body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, false, err
+	}
+	req.Stream = false
+	return h.chat(ctx, body, req)
+}
+
+// ChatCompletionStream starts streaming a chat completion request body
+// through the same pipeline as /v1/chat/completions
+func (h *Handler) ChatCompletionStream(ctx context.Context, body []byte) (*langmesh.ChatCompletionStream, error) {
+	if h.configErr != nil {
+		return nil, h.configErr
+	}
+	req, err := parseChatRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	return h.client.CreateChatCompletionStream(ctx, req)
+}
+
+func parseChatRequest(body []byte) (openai.ChatCompletionRequest, error) {
+	var req openai.ChatCompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, &requestError{code: "invalid_json", message: err.Error()}
+	}
+	return req, nil
+}
+
+// chat serves req from the cache, keyed by its caller and body, or from
+// the client
+func (h *Handler) chat(ctx context.Context, body []byte, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, bool, error) {
+	if h.configErr != nil {
+		return openai.ChatCompletionResponse{}, false, h.configErr
+	}
+	key := cacheKey(callerFrom(ctx), body)
+	if h.cache != nil {
+		if cached, ok := h.cache.get(key); ok {
+			return cached, true, nil
+		}
+	}
+	resp, err := h.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return resp, false, err
+	}
+	if h.cache != nil {
+		h.cache.put(key, resp)
+	}
+	return resp, false, nil
+}
+
+func (h *Handler) streamChat(w http.ResponseWriter, r *http.Request, req openai.ChatCompletionRequest) {
+	stream, err := h.client.CreateChatCompletionStream(r.Context(), req)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	defer stream.Close()
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		}
+		if err != nil {
+			// Headers are already sent; report the failure in-band the way
+			// OpenAI does
+			data, _ := json.Marshal(errorBody("server_error", "stream_error", err.Error()))
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			// Client went away
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method_not_allowed", "use POST")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid_body", err.Error())
+		return
+	}
+	resp, err := h.Embeddings(r.Context(), body)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Embeddings runs an embeddings request body through the same pipeline as
+// /v1/embeddings
+func (h *Handler) Embeddings(ctx context.Context, body []byte) (openai.EmbeddingResponse, error) {
+	var raw struct {
+		Input          json.RawMessage                `json:"input"`
+		Model          openai.EmbeddingModel          `json:"model"`
+		User           string                         `json:"user"`
+		EncodingFormat openai.EmbeddingEncodingFormat `json:"encoding_format"`
+		Dimensions     int                            `json:"dimensions"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return openai.EmbeddingResponse{}, &requestError{code: "invalid_json", message: err.Error()}
+	}
+	req := openai.EmbeddingRequest{
+		Model:          raw.Model,
+		User:           raw.User,
+		EncodingFormat: raw.EncodingFormat,
+		Dimensions:     raw.Dimensions,
+	}
+	var single string
+	var many []string
+	var tokens [][]int
+	switch {
+	case json.Unmarshal(raw.Input, &single) == nil:
+		req.Input = []string{single}
+	case json.Unmarshal(raw.Input, &many) == nil:
+		req.Input = many
+	case json.Unmarshal(raw.Input, &tokens) == nil:
+		req.Input = tokens
+	default:
+		return openai.EmbeddingResponse{}, &requestError{code: "invalid_input", message: "input must be a string, array of strings, or array of token arrays"}
+	}
+	return h.client.CreateEmbeddings(ctx, req)
+}
+
+// requestError is a request the proxy could not parse
+type requestError struct {
+	code, message string
+}
+
+func (e *requestError) Error() string {
+	return "langmesh: invalid request: " + e.message
+}
+
+// writeClientError writes err as DescribeError describes it
+func writeClientError(w http.ResponseWriter, err error) {
+	status, body := describeError(err)
+	writeJSON(w, status, body)
+}
+
+// DescribeError maps an error from the proxy's pipeline onto the HTTP
+// status and OpenAI-style JSON error body the proxy answers with. Spend
+// guard rejections become 429s carrying the guard's spend details; content
+// guard rejections and unparseable requests become 400s.
+func DescribeError(err error) (int, []byte) {
+	status, body := describeError(err)
+	data, _ := json.Marshal(body)
+	return status, data
+}
+
+func describeError(err error) (int, errorResponse) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return http.StatusBadRequest, errorBody("invalid_request_error", reqErr.code, reqErr.message)
+	}
+	var guardErr *langmesh.GuardError
+	if errors.As(err, &guardErr) {
+		body := errorBody("langmesh_guard_error", string(guardErr.Reason), guardErr.Error())
+		body.Error.CurrentSpendUSD = guardErr.CurrentSpendUSD
+		body.Error.LimitUSD = guardErr.LimitUSD
+		if !guardErr.ResetAt.IsZero() {
+			body.Error.ResetAt = guardErr.ResetAt.Format(time.RFC3339)
+		}
+		status := http.StatusTooManyRequests
+		if guardErr.Reason == langmesh.GuardReasonContentFlagged {
+			status = http.StatusBadRequest
+		}
+		return status, body
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		status := apiErr.HTTPStatusCode
+		if status == 0 {
+			status = http.StatusBadGateway
+		}
+		code, _ := apiErr.Code.(string)
+		return status, errorBody(apiErr.Type, code, apiErr.Message)
+	}
+	var upstreamErr *openai.RequestError
+	if errors.As(err, &upstreamErr) && upstreamErr.HTTPStatusCode > 0 {
+		return upstreamErr.HTTPStatusCode, errorBody("upstream_error", "", err.Error())
+	}
+	return http.StatusBadGateway, errorBody("upstream_error", "", err.Error())
+}
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message         string  `json:"message"`
+	Type            string  `json:"type"`
+	Code            string  `json:"code,omitempty"`
+	CurrentSpendUSD float64 `json:"current_spend_usd,omitempty"`
+	LimitUSD        float64 `json:"limit_usd,omitempty"`
+	ResetAt         string  `json:"reset_at,omitempty"`
+}
+
+func errorBody(typ, code, message string) errorResponse {
+	return errorResponse{Error: errorDetail{Message: message, Type: typ, Code: code}}
+}
+
+func writeError(w http.ResponseWriter, status int, typ, code, message string) {
+	writeJSON(w, status, errorBody(typ, code, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func singleJoin(a, b string) string {
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+type cacheEntry struct {
+	key     string
+	resp    openai.ChatCompletionResponse
+	expires time.Time
+}
+
+// responseCache is an LRU of at most max responses. Expired entries are
+// dropped when looked up, or evicted once least recently used.
+type responseCache struct {
+	ttl     time.Duration
+	max     int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newResponseCache(ttl time.Duration, max int) *responseCache {
+	return &responseCache{ttl: ttl, max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func cacheKey(caller string, body []byte) string {
+	h := sha256.New()
+	callerSum := sha256.Sum256([]byte(caller))
+	h.Write(callerSum[:])
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *responseCache) get(key string) (openai.ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return openai.ChatCompletionResponse{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return openai.ChatCompletionResponse{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.resp, true
+}
+
+func (c *responseCache) put(key string, resp openai.ChatCompletionResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		el.Value = &cacheEntry{key: key, resp: resp, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, resp: resp, expires: expires})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
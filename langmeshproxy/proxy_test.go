@@ -0,0 +1,227 @@
+package langmeshproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func newUpstream(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch {
+		case r.URL.Path == "/chat/completions":
+			body, _ := io.ReadAll(r.Body)
+			if strings.Contains(string(body), `"stream":true`) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, p := range []string{"Hel", "lo"} {
+					fmt.Fprintf(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", p)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+		case r.URL.Path == "/models":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4o"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// allowAll admits every caller, for tests not about authorization
+var allowAll = WithAuthorizer(func(*http.Request) error { return nil })
+
+func newProxyClient(t *testing.T, client *langmesh.Client, opts ...Option) *openai.Client {
+	t.Helper()
+	proxy := httptest.NewServer(New(client, append([]Option{allowAll}, opts...)...))
+	t.Cleanup(proxy.Close)
+	cfg := openai.DefaultConfig("caller-key")
+	cfg.BaseURL = proxy.URL + "/v1"
+	return openai.NewClientWithConfig(cfg)
+}
+
+func TestProxyChatCacheAndPassthrough(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	caller := newProxyClient(t, client, WithCache(time.Minute), WithPassthrough(upstream.URL, "upstream-key"),
+		WithAuthorizer(func(r *http.Request) error { return nil }))
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	for i := 0; i < 2; i++ {
+		resp, err := caller.CreateChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("chat %d: %v", i, err)
+		}
+		if resp.Choices[0].Message.Content != "Hello" {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("second identical request should be cached, upstream saw %d calls", *calls)
+	}
+
+	models, err := caller.ListModels(context.Background())
+	if err != nil || len(models.Models) != 1 {
+		t.Fatalf("passthrough models: %+v, %v", models, err)
+	}
+}
+
+func TestProxyStreamPassthrough(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	caller := newProxyClient(t, client)
+
+	stream, err := caller.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Close()
+	var got strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		got.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if got.String() != "Hello" {
+		t.Errorf("streamed content = %q", got.String())
+	}
+}
+
+func TestProxyGuardRejectionIs429(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key",
+		langmesh.WithBaseURL(upstream.URL),
+		langmesh.WithBudget(langmesh.NewBudget(0, time.Hour)),
+	)
+	caller := newProxyClient(t, client)
+
+	_, err := caller.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"})
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusTooManyRequests || apiErr.Code != "budget_exceeded" {
+		t.Fatalf("expected 429 budget_exceeded, got %v", err)
+	}
+	if *calls != 0 {
+		t.Errorf("rejected request reached upstream")
+	}
+}
+
+func TestHandlerChatCompletionForOtherProtocols(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	h := New(client, WithCache(time.Minute))
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	for i, wantCached := range []bool{false, true} {
+		resp, cached, err := h.ChatCompletion(context.Background(), body)
+		if err != nil || cached != wantCached || resp.Choices[0].Message.Content != "Hello" {
+			t.Errorf("call %d: cached = %v, err = %v", i, cached, err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("upstream saw %d calls", *calls)
+	}
+
+	_, _, err := h.ChatCompletion(context.Background(), []byte(`{`))
+	if status, body := DescribeError(err); status != http.StatusBadRequest || !strings.Contains(string(body), "invalid_json") {
+		t.Errorf("bad body: %d %s", status, body)
+	}
+}
+
+func TestProxyCacheIsPerCaller(t *testing.T) {
+	upstream, calls := newUpstream(t)
+	client := langmesh.NewClient("upstream-key", langmesh.WithBaseURL(upstream.URL))
+	proxy := httptest.NewServer(New(client, WithCache(time.Minute), allowAll))
+	t.Cleanup(proxy.Close)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	for _, key := range []string{"tenant-a", "tenant-b", "tenant-a"} {
+		cfg := openai.DefaultConfig(key)
+		cfg.BaseURL = proxy.URL + "/v1"
+		if _, err := openai.NewClientWithConfig(cfg).CreateChatCompletion(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 2 {
+		t.Errorf("upstream saw %d calls, want one per caller", *calls)
+	}
+}
+
+func TestProxyCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResponseCache(time.Minute, 2)
+	for _, key := range []string{"a", "b"} {
+		c.put(key, openai.ChatCompletionResponse{ID: key})
+	}
+	c.get("a")
+	c.put("c", openai.ChatCompletionResponse{ID: "c"})
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if resp, ok := c.get(key); !ok || resp.ID != key {
+			t.Errorf("get(%s) = %v, %v", key, resp.ID, ok)
+		}
+	}
+	if len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("cache holds %d entries, want 2", len(c.entries))
+	}
+}
+
+func TestProxyMisconfigured(t *testing.T) {
+	client := langmesh.NewClient("upstream-key")
+	allow := allowAll
+	for name, h := range map[string]*Handler{
+		"no authorizer": New(client, WithPassthrough("https://api.openai.com/v1", "k")),
+		"open chat":     New(client, WithCache(time.Minute)),
+		"bad URL":       New(client, WithPassthrough("://nope", "k"), allow),
+		"relative URL":  New(client, WithPassthrough("api.openai.com", "k"), allow),
+	} {
+		if h.Err() == nil {
+			t.Errorf("%s: Err() = nil", name)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d", name, rec.Code)
+		}
+	}
+	if h := New(client, WithPassthrough("https://api.openai.com/v1", "k"), allow); h.Err() != nil {
+		t.Errorf("valid passthrough: %v", h.Err())
+	}
+}
+
+func TestWithCacheEntriesInAnyOrder(t *testing.T) {
+	client := langmesh.NewClient("upstream-key")
+	for name, h := range map[string]*Handler{
+		"before WithCache": New(client, WithCacheEntries(3), WithCache(time.Minute), allowAll),
+		"after WithCache":  New(client, WithCache(time.Minute), WithCacheEntries(3), allowAll),
+	} {
+		if h.cache.max != 3 {
+			t.Errorf("%s: cache holds %d entries, want 3", name, h.cache.max)
+		}
+	}
+	if h := New(client, WithCacheEntries(3), allowAll); h.cache != nil {
+		t.Error("WithCacheEntries enabled the cache")
+	}
+}
@@ -0,0 +1,224 @@
+// Package langmeshtest provides test doubles for code built on the langmesh
+// client interfaces
+//
+// Usage:
+//
+//	mock := langmeshtest.NewMockClient()
+//	mock.QueueText("hello")
+//	mock.QueueError(errors.New("boom"))
+//
+//	svc := NewService(mock) // accepts langmesh.ChatClient
+package langmeshtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type chatStep struct {
+	resp openai.ChatCompletionResponse
+	err  error
+}
+
+// MockClient is a configurable langmesh.FullClient. Chat calls consume queued
+// responses and errors in order, falling back to ChatFunc and then to
+// DefaultChat once the queue is empty. Other methods call their *Func field
+// when set and return zero values otherwise.
+type MockClient struct {
+	// Latency is applied before every call; cancelling the context cuts it short
+	Latency time.Duration
+	// DefaultChat is returned when no step is queued and ChatFunc is nil
+	DefaultChat openai.ChatCompletionResponse
+	// USDPerToken prices every prompt and completion token in
+	// EstimateCostUSD
+	USDPerToken float64
+
+	ChatFunc          func(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	EmbeddingsFunc    func(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+	ModerationsFunc   func(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error)
+	ImageFunc         func(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error)
+	TranscriptionFunc func(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error)
+	ListModelsFunc    func(ctx context.Context) (openai.ModelsList, error)
+
+	mu           sync.Mutex
+	queue        []chatStep
+	chatRequests []openai.ChatCompletionRequest
+	calls        map[string]int
+}
+
+var (
+	_ langmesh.FullClient    = (*MockClient)(nil)
+	_ langmesh.CostEstimator = (*MockClient)(nil)
+)
+
+// NewMockClient creates an empty mock
+func NewMockClient() *MockClient {
+	return &MockClient{calls: make(map[string]int)}
+}
+
+// QueueChat schedules resp as the next chat completion result
+func (m *MockClient) QueueChat(resp openai.ChatCompletionResponse) *MockClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, chatStep{resp: resp})
+	return m
+}
+
+// QueueText schedules a single-choice assistant reply with the given content
+func (m *MockClient) QueueText(content string) *MockClient {
+	return m.QueueChat(TextResponse(content))
+}
+
+// QueueError schedules err as the next chat completion result
+func (m *MockClient) QueueError(err error) *MockClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, chatStep{err: err})
+	return m
+}
+
+// ChatRequests returns every chat request received, in order
+func (m *MockClient) ChatRequests() []openai.ChatCompletionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]openai.ChatCompletionRequest, len(m.chatRequests))
+	copy(out, m.chatRequests)
+	return out
+}
+
+// Calls returns how many times the named method was called
+func (m *MockClient) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+// TextResponse builds a chat response with one assistant choice
+func TextResponse(content string) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Object: "chat.completion",
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}
+}
+
+func (m *MockClient) begin(ctx context.Context, method string) error {
+	m.mu.Lock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[method]++
+	m.mu.Unlock()
+
+	if m.Latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(m.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CreateChatCompletion returns the next scripted result
+func (m *MockClient) CreateChatCompletion(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (openai.ChatCompletionResponse, error) {
+	m.mu.Lock()
+	m.chatRequests = append(m.chatRequests, request)
+	m.mu.Unlock()
+
+	if err := m.begin(ctx, "CreateChatCompletion"); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	m.mu.Lock()
+	if len(m.queue) > 0 {
+		step := m.queue[0]
+		m.queue = m.queue[1:]
+		m.mu.Unlock()
+		return step.resp, step.err
+	}
+	m.mu.Unlock()
+
+	if m.ChatFunc != nil {
+		return m.ChatFunc(ctx, request)
+	}
+	return m.DefaultChat, nil
+}
+
+// CreateEmbeddings calls EmbeddingsFunc when set
+func (m *MockClient) CreateEmbeddings(
+	ctx context.Context,
+	conv openai.EmbeddingRequestConverter,
+) (openai.EmbeddingResponse, error) {
+	if err := m.begin(ctx, "CreateEmbeddings"); err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	if m.EmbeddingsFunc != nil {
+		return m.EmbeddingsFunc(ctx, conv)
+	}
+	return openai.EmbeddingResponse{}, nil
+}
+
+// Moderations calls ModerationsFunc when set
+func (m *MockClient) Moderations(
+	ctx context.Context,
+	request openai.ModerationRequest,
+) (openai.ModerationResponse, error) {
+	if err := m.begin(ctx, "Moderations"); err != nil {
+		return openai.ModerationResponse{}, err
+	}
+	if m.ModerationsFunc != nil {
+		return m.ModerationsFunc(ctx, request)
+	}
+	return openai.ModerationResponse{}, nil
+}
+
+// CreateImage calls ImageFunc when set
+func (m *MockClient) CreateImage(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error) {
+	if err := m.begin(ctx, "CreateImage"); err != nil {
+		return openai.ImageResponse{}, err
+	}
+	if m.ImageFunc != nil {
+		return m.ImageFunc(ctx, request)
+	}
+	return openai.ImageResponse{}, nil
+}
+
+// CreateTranscription calls TranscriptionFunc when set
+func (m *MockClient) CreateTranscription(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
+	if err := m.begin(ctx, "CreateTranscription"); err != nil {
+		return openai.AudioResponse{}, err
+	}
+	if m.TranscriptionFunc != nil {
+		return m.TranscriptionFunc(ctx, request)
+	}
+	return openai.AudioResponse{}, nil
+}
+
+// ListModels calls ListModelsFunc when set
+func (m *MockClient) ListModels(ctx context.Context) (openai.ModelsList, error) {
+	if err := m.begin(ctx, "ListModels"); err != nil {
+		return openai.ModelsList{}, err
+	}
+	if m.ListModelsFunc != nil {
+		return m.ListModelsFunc(ctx)
+	}
+	return openai.ModelsList{}, nil
+}
+
+// EstimateCostUSD prices the tokens at USDPerToken, whatever the model
+func (m *MockClient) EstimateCostUSD(_ string, promptTokens, completionTokens int) float64 {
+	return float64(promptTokens+completionTokens) * m.USDPerToken
+}
@@ -0,0 +1,49 @@
+package langmeshtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestMockClientScript(t *testing.T) {
+	boom := errors.New("boom")
+	m := NewMockClient().QueueText("first").QueueError(boom)
+	m.DefaultChat = TextResponse("default")
+	ctx := context.Background()
+	req := openai.ChatCompletionRequest{Model: "gpt-4o"}
+
+	resp, err := m.CreateChatCompletion(ctx, req)
+	if err != nil || resp.Choices[0].Message.Content != "first" {
+		t.Fatalf("call 1 = %v, %v", resp, err)
+	}
+	if _, err := m.CreateChatCompletion(ctx, req); !errors.Is(err, boom) {
+		t.Fatalf("call 2 err = %v", err)
+	}
+	resp, _ = m.CreateChatCompletion(ctx, req)
+	if resp.Choices[0].Message.Content != "default" {
+		t.Fatalf("call 3 = %v", resp)
+	}
+	if m.Calls("CreateChatCompletion") != 3 || len(m.ChatRequests()) != 3 {
+		t.Errorf("calls not recorded")
+	}
+}
+
+func TestMockClientLatencyHonoursContext(t *testing.T) {
+	m := NewMockClient()
+	m.Latency = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := m.CreateChatCompletion(ctx, openai.ChatCompletionRequest{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("latency ignored context cancellation")
+	}
+}
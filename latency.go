@@ -0,0 +1,306 @@
+package langmesh
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LatencyKey identifies a latency series tracked by WithLatencyTracking
+type LatencyKey struct {
+	Model    string
+	Endpoint string
+}
+
+// LatencySLO is a latency objective, e.g. p95 under 3s, over the most
+// recent Window of requests
+type LatencySLO struct {
+	// Model and Endpoint restrict the SLO; empty matches every one, and
+	// the SLO is checked for each model and endpoint separately
+	Model    string
+	Endpoint string
+	// Percentile is the quantile checked, e.g. 0.95; SLOs outside (0, 1]
+	// are ignored
+	Percentile float64
+	// Threshold is the latency the percentile must stay under
+	Threshold time.Duration
+	// Window is how far back the percentile looks (default 5m). It moves
+	// in steps of a thirtieth of the longest window tracked, and counts
+	// every request in it however busy the model is.
+	Window time.Duration
+	// MinRequests avoids alerting on tiny samples (default 20)
+	MinRequests int
+}
+
+// LatencySLOViolation reports an SLO whose percentile crossed its threshold
+type LatencySLOViolation struct {
+	SLO      LatencySLO
+	Key      LatencyKey
+	Observed time.Duration
+	Requests int
+}
+
+// LatencyTracking configures WithLatencyTracking
+type LatencyTracking struct {
+	SLOs []LatencySLO
+	// OnViolation is called once each time a model and endpoint start
+	// violating an SLO. It runs on the request goroutine and must not
+	// block.
+	OnViolation func(LatencySLOViolation)
+}
+
+// WithLatencyTracking keeps latency histograms per model and endpoint,
+// whose percentiles over the last 5 minutes, or the longest SLO window,
+// are exposed via Client.Stats, and checks them against cfg.SLOs.
+// Percentiles are accurate to two significant digits, rounded down.
+// Requests rejected before they were sent are not counted.
+func WithLatencyTracking(cfg LatencyTracking) Option {
+	return func(c *Client) {
+		longest := 5 * time.Minute
+		for i := range cfg.SLOs {
+			if cfg.SLOs[i].Window <= 0 {
+				cfg.SLOs[i].Window = 5 * time.Minute
+			}
+			if cfg.SLOs[i].MinRequests <= 0 {
+				cfg.SLOs[i].MinRequests = 20
+			}
+			longest = max(longest, cfg.SLOs[i].Window)
+		}
+		t := &latencyTracker{
+			client:    c,
+			cfg:       cfg,
+			slot:      longest / latencySlots,
+			series:    make(map[LatencyKey]*latencySeries),
+			violating: make(map[sloState]bool),
+			now:       time.Now,
+		}
+		// The last window is the whole ring, summarized by Stats
+		for _, slo := range cfg.SLOs {
+			t.windows = append(t.windows, int64(min((slo.Window+t.slot-1)/t.slot, latencySlots)))
+		}
+		t.windows = append(t.windows, latencySlots)
+		c.latency = t
+		c.observers = append(c.observers, c.latency)
+	}
+}
+
+type latencyTracker struct {
+	client *Client
+	cfg    LatencyTracking
+	// slot is the width of each histogram in a series' ring
+	slot time.Duration
+	// windows is how many slots each SLO, then Stats, sums
+	windows   []int64
+	mu        sync.Mutex
+	series    map[LatencyKey]*latencySeries
+	violating map[sloState]bool
+	now       func() time.Time
+}
+
+// sloState identifies one SLO applied to one series
+type sloState struct {
+	slo int
+	key LatencyKey
+}
+
+// latencySlots is how many histograms a series keeps, each covering a
+// thirtieth of the longest window
+const latencySlots = 30
+
+// latencyBuckets is the size of a latencyHistogram: exact milliseconds up
+// to 10ms, then 90 buckets per decade, two significant digits, up to
+// 999s
+const latencyBuckets = 10 + 90*5
+
+// latencyHistogram counts latencies in fixed buckets
+type latencyHistogram struct {
+	counts [latencyBuckets]uint32
+	total  int64
+	max    time.Duration
+}
+
+func latencyBucket(d time.Duration) int {
+	ms := d.Milliseconds()
+	if ms < 10 {
+		return int(max(ms, 0))
+	}
+	decade := 0
+	for ms >= 100 {
+		ms /= 10
+		decade++
+	}
+	return min(10+decade*90+int(ms-10), latencyBuckets-1)
+}
+
+// latencyBucketFloor is the smallest latency counted in bucket i
+func latencyBucketFloor(i int) time.Duration {
+	if i < 10 {
+		return time.Duration(i) * time.Millisecond
+	}
+	ms := int64((i-10)%90 + 10)
+	for decade := (i - 10) / 90; decade > 0; decade-- {
+		ms *= 10
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	h.counts[latencyBucket(d)]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// merge adds o's counts to h, or subtracts them when sign is -1
+func (h *latencyHistogram) merge(o *latencyHistogram, sign int64) {
+	for i, n := range o.counts {
+		h.counts[i] = uint32(int64(h.counts[i]) + sign*int64(n))
+	}
+	h.total += sign * o.total
+}
+
+// quantile returns the floor of the bucket holding the p quantile, as
+// percentile picks from sorted samples
+func (h *latencyHistogram) quantile(p float64) time.Duration {
+	rank := int64(float64(h.total-1) * p)
+	var seen int64
+	for i, n := range h.counts {
+		if seen += int64(n); seen > rank {
+			return latencyBucketFloor(i)
+		}
+	}
+	return latencyBucketFloor(latencyBuckets - 1)
+}
+
+// latencySeries is a ring of per-slot histograms, with a running sum per
+// window so checking an SLO does not revisit every slot
+type latencySeries struct {
+	ring  [latencySlots]latencyHistogram
+	slots [latencySlots]int64
+	sums  []latencyHistogram
+	last  int64
+	count int64
+}
+
+// advance retires the slots that have left each window by slot
+func (s *latencySeries) advance(slot int64, windows []int64) {
+	if slot <= s.last {
+		return
+	}
+	if slot-s.last >= latencySlots {
+		s.ring = [latencySlots]latencyHistogram{}
+		for i := range s.sums {
+			s.sums[i] = latencyHistogram{}
+		}
+		s.slots[slot%latencySlots], s.last = slot, slot
+		return
+	}
+	for next := s.last + 1; next <= slot; next++ {
+		for i, n := range windows {
+			old := next - n
+			if idx := old % latencySlots; old >= 0 && s.slots[idx] == old {
+				s.sums[i].merge(&s.ring[idx], -1)
+			}
+		}
+		idx := next % latencySlots
+		s.ring[idx], s.slots[idx] = latencyHistogram{}, next
+	}
+	s.last = slot
+}
+
+func (s *latencySeries) add(slot int64, windows []int64, d time.Duration) {
+	if s.sums == nil {
+		s.sums = make([]latencyHistogram, len(windows))
+		s.last = slot
+		s.slots[slot%latencySlots] = slot
+	}
+	// A clock stepping back counts in the newest slot
+	slot = max(slot, s.last)
+	s.advance(slot, windows)
+	s.count++
+	s.ring[slot%latencySlots].add(d)
+	for i := range s.sums {
+		s.sums[i].add(d)
+	}
+}
+
+// summary describes the last window, the whole ring
+func (s *latencySeries) summary() LatencySummary {
+	all := &s.sums[len(s.sums)-1]
+	if all.total == 0 {
+		return LatencySummary{Count: s.count}
+	}
+	summary := LatencySummary{
+		Count: s.count,
+		P50:   all.quantile(0.50),
+		P95:   all.quantile(0.95),
+		P99:   all.quantile(0.99),
+	}
+	for i := range s.ring {
+		if s.slots[i] > s.last-latencySlots {
+			summary.Max = max(summary.Max, s.ring[i].max)
+		}
+	}
+	return summary
+}
+
+func (t *latencyTracker) observe(event TelemetryEvent) {
+	if event.ErrorClass == "GuardRejected" || event.ErrorClass == "InvalidRequest" || event.Heartbeat {
+		// Requests rejected client-side never reached the model
+		return
+	}
+	if event.Status == "cancelled" {
+		// A cancelled call's latency is the caller's, not the model's
+		return
+	}
+	key := LatencyKey{Model: event.Model, Endpoint: event.Endpoint}
+	now := t.now()
+
+	var violations []LatencySLOViolation
+	t.mu.Lock()
+	series, ok := t.series[key]
+	if !ok {
+		series = &latencySeries{}
+		t.series[key] = series
+	}
+	series.add(now.UnixNano()/int64(t.slot), t.windows, time.Duration(event.LatencyMs)*time.Millisecond)
+	for i, slo := range t.cfg.SLOs {
+		if (slo.Model != "" && slo.Model != key.Model) || (slo.Endpoint != "" && slo.Endpoint != key.Endpoint) ||
+			slo.Percentile <= 0 || slo.Percentile > 1 {
+			continue
+		}
+		state := sloState{slo: i, key: key}
+		window := &series.sums[i]
+		if window.total < int64(slo.MinRequests) {
+			continue
+		}
+		observed := window.quantile(slo.Percentile)
+		if observed < slo.Threshold {
+			t.violating[state] = false
+			continue
+		}
+		if !t.violating[state] {
+			t.violating[state] = true
+			violations = append(violations, LatencySLOViolation{SLO: slo, Key: key, Observed: observed, Requests: int(window.total)})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, v := range violations {
+		t.client.log(context.Background(), LogBudget, "latency SLO violated",
+			"model", v.Key.Model, "endpoint", v.Key.Endpoint, "percentile", v.SLO.Percentile,
+			"observed", v.Observed, "threshold", v.SLO.Threshold)
+		if t.cfg.OnViolation != nil {
+			t.cfg.OnViolation(v)
+		}
+	}
+}
+
+func (t *latencyTracker) snapshot() map[LatencyKey]LatencySummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[LatencyKey]LatencySummary, len(t.series))
+	for key, series := range t.series {
+		out[key] = series.summary()
+	}
+	return out
+}
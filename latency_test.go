@@ -0,0 +1,115 @@
+package langmesh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithLatencyTracking(LatencyTracking{}))
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary, ok := client.Stats().Latency[LatencyKey{Model: "gpt-4o-mini", Endpoint: "chat.completions"}]
+	if !ok || summary.Count != 3 || summary.P99 < summary.P50 {
+		t.Errorf("latency = %+v, %v", summary, ok)
+	}
+}
+
+func TestLatencySLO(t *testing.T) {
+	var violations []LatencySLOViolation
+	client := NewClient("test-key", WithLatencyTracking(LatencyTracking{
+		SLOs: []LatencySLO{
+			{Endpoint: "chat.completions", Percentile: 0.95, Threshold: 3 * time.Second, Window: time.Minute, MinRequests: 10},
+		},
+		OnViolation: func(v LatencySLOViolation) { violations = append(violations, v) },
+	}))
+	tracker := client.latency
+	now := time.Unix(1_700_000_000, 0)
+	tracker.now = func() time.Time { return now }
+	observe := func(model string, ms int64) {
+		tracker.observe(TelemetryEvent{Model: model, Endpoint: "chat.completions", LatencyMs: ms})
+	}
+
+	for i := 0; i < 9; i++ {
+		observe("gpt-4o", 5000)
+	}
+	if len(violations) != 0 {
+		t.Fatal("fired below MinRequests")
+	}
+	observe("gpt-4o", 5000)
+	observe("gpt-4o", 5000)
+	if len(violations) != 1 || violations[0].Key.Model != "gpt-4o" || violations[0].Observed != 5*time.Second {
+		t.Fatalf("violations = %+v, want one for gpt-4o", violations)
+	}
+	tracker.observe(TelemetryEvent{Model: "gpt-4o", Endpoint: "embeddings", LatencyMs: 9000})
+	tracker.observe(TelemetryEvent{Model: "gpt-4o", Endpoint: "chat.completions", LatencyMs: 9000, ErrorClass: "GuardRejected"})
+
+	// Old samples leave the window and the SLO recovers, then can fire again
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 10; i++ {
+		observe("gpt-4o", 100)
+	}
+	for i := 0; i < 10; i++ {
+		observe("gpt-4o", 4000)
+	}
+	if len(violations) != 2 {
+		t.Errorf("violations = %d, want a second after recovery", len(violations))
+	}
+	if count := client.Stats().Latency[LatencyKey{Model: "gpt-4o", Endpoint: "chat.completions"}].Count; count != 31 {
+		t.Errorf("count = %d, want rejected request skipped", count)
+	}
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	for _, tc := range []struct{ in, floor time.Duration }{
+		{0, 0},
+		{7 * time.Millisecond, 7 * time.Millisecond},
+		{99 * time.Millisecond, 99 * time.Millisecond},
+		{345 * time.Millisecond, 340 * time.Millisecond},
+		{3 * time.Second, 3 * time.Second},
+		{3049 * time.Millisecond, 3 * time.Second},
+		{time.Hour, 990 * time.Second},
+	} {
+		if got := latencyBucketFloor(latencyBucket(tc.in)); got != tc.floor {
+			t.Errorf("%v counted as %v, want %v", tc.in, got, tc.floor)
+		}
+	}
+}
+
+func TestLatencySLOCountsWholeWindow(t *testing.T) {
+	var violations []LatencySLOViolation
+	client := NewClient("test-key", WithLatencyTracking(LatencyTracking{
+		SLOs:        []LatencySLO{{Percentile: 0.5, Threshold: 3 * time.Second, Window: time.Minute}},
+		OnViolation: func(v LatencySLOViolation) { violations = append(violations, v) },
+	}))
+	tracker := client.latency
+	now := time.Unix(1_700_000_000, 0)
+	tracker.now = func() time.Time { return now }
+
+	// More requests than any sample buffer would hold, all within the window
+	for i := 0; i < 2000; i++ {
+		tracker.observe(TelemetryEvent{Model: "gpt-4o", Endpoint: "chat.completions", LatencyMs: 100})
+	}
+	now = now.Add(30 * time.Second)
+	for i := 0; i < 1500; i++ {
+		tracker.observe(TelemetryEvent{Model: "gpt-4o", Endpoint: "chat.completions", LatencyMs: 5000})
+	}
+	if len(violations) != 0 {
+		t.Fatalf("violations = %+v; the median of the window is 100ms", violations)
+	}
+
+	now = now.Add(45 * time.Second)
+	tracker.observe(TelemetryEvent{Model: "gpt-4o", Endpoint: "chat.completions", LatencyMs: 5000})
+	if len(violations) != 1 || violations[0].Requests != 1501 {
+		t.Errorf("violations = %+v, want one once the fast requests left the window", violations)
+	}
+	summary := client.Stats().Latency[LatencyKey{Model: "gpt-4o", Endpoint: "chat.completions"}]
+	if summary.Count != 3501 || summary.P50 != 100*time.Millisecond || summary.Max != 5*time.Second {
+		t.Errorf("summary = %+v, want the last 5 minutes", summary)
+	}
+}
@@ -0,0 +1,142 @@
+package langmesh
+
+import (
+	"net/http"
+)
+
+// DefaultLocalBaseURL is Ollama's OpenAI-compatible API root
+const DefaultLocalBaseURL = "http://localhost:11434/v1"
+
+const (
+	providerOpenAI    = "openai"
+	providerAnthropic = "anthropic"
+	providerLocal     = "local"
+)
+
+// TokenPricing is a model's price in USD per million tokens
+type TokenPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// LocalBackend configures WithLocalBackend
+type LocalBackend struct {
+	// BaseURL is the server's OpenAI-compatible API root, by default
+	// DefaultLocalBaseURL. vLLM and LM Studio serve theirs at
+	// http://localhost:8000/v1 and http://localhost:1234/v1.
+	BaseURL string
+	// Pricing prices models, e.g. by what the hardware serving them costs.
+	// Models not listed cost nothing.
+	Pricing map[string]TokenPricing
+}
+
+// WithLocalBackend points the client at an OpenAI-compatible server such as
+// Ollama, vLLM or LM Studio. Costs come from the backend's Pricing instead
+// of OpenAI's, so they are zero unless priced; strict mode accepts models
+// without pricing; the langmesh proxy is bypassed; and with an empty API key
+// no Authorization header is sent. Events are tagged with provider "local".
+// Models served by WithAnthropic keep Anthropic's pricing.
+func WithLocalBackend(cfg LocalBackend) Option {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultLocalBaseURL
+	}
+	return func(c *Client) {
+		c.baseURL = cfg.BaseURL
+		c.local = &cfg
+	}
+}
+
+// providerFor names the backend that serves model
+func (c *Client) providerFor(model string) string {
+	switch {
+	case c == nil:
+		return providerOpenAI
+	case c.anthropicMatch != nil && c.anthropicMatch(model):
+		return providerAnthropic
+	case c.local != nil:
+		return providerLocal
+	default:
+		return providerOpenAI
+	}
+}
+
+// EstimateCostUSD estimates what a call to model using these tokens costs,
+// with the pricing of the backend that would serve it
+func (c *Client) EstimateCostUSD(model string, promptTokens, completionTokens int) float64 {
+	return c.estimateCost(model, promptTokens, completionTokens)
+}
+
+// WithModelPricing prices models, overriding the manifest and built-in
+// prices, e.g. for negotiated rates or models the package does not know
+func WithModelPricing(prices map[string]TokenPricing) Option {
+	return func(c *Client) {
+		c.pricing = make(map[string]TokenPricing, len(prices))
+		for model, p := range prices {
+			c.pricing[model] = p
+		}
+	}
+}
+
+// estimateCost prices a call to model with the pricing of the backend
+// serving it
+func (c *Client) estimateCost(model string, promptTokens, completionTokens int) float64 {
+	if pricing, ok := c.configuredPricing(model); ok {
+		return (tokenCost(promptTokens, pricing.Input) + tokenCost(completionTokens, pricing.Output)).Float64()
+	}
+	if info, ok := c.manifestPricing(model); ok {
+		return (tokenCost(promptTokens, info.InputPerMillionUSD) + tokenCost(completionTokens, info.OutputPerMillionUSD)).Float64()
+	}
+	if c.providerFor(model) != providerLocal {
+		return estimateCost(model, promptTokens, completionTokens)
+	}
+	pricing := c.local.Pricing[model]
+	return (tokenCost(promptTokens, pricing.Input) + tokenCost(completionTokens, pricing.Output)).Float64()
+}
+
+// knownPricing reports whether model's cost can be estimated. Local models
+// are free unless priced, so always can be.
+func (c *Client) knownPricing(model string) bool {
+	if c.providerFor(model) == providerLocal {
+		return true
+	}
+	if _, ok := c.configuredPricing(model); ok {
+		return true
+	}
+	if _, ok := c.manifestPricing(model); ok {
+		return true
+	}
+	_, ok := modelPricing[model]
+	return ok
+}
+
+// configuredPricing returns model's WithModelPricing price
+func (c *Client) configuredPricing(model string) (TokenPricing, bool) {
+	if c == nil {
+		return TokenPricing{}, false
+	}
+	pricing, ok := c.pricing[model]
+	return pricing, ok
+}
+
+// manifestPricing returns model's manifest entry if it has a price
+func (c *Client) manifestPricing(model string) (ModelInfo, bool) {
+	if c == nil || c.modelManifest == nil {
+		return ModelInfo{}, false
+	}
+	info, ok := c.modelManifest.lookup(c, model)
+	return info, ok && (info.InputPerMillionUSD > 0 || info.OutputPerMillionUSD > 0)
+}
+
+// noAuthTransport drops the Authorization header go-openai sends even with
+// an empty key, which some local servers reject
+type noAuthTransport struct {
+	base http.RoundTripper
+}
+
+func (t noAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		req = req.Clone(req.Context())
+		req.Header.Del("Authorization")
+	}
+	return t.base.RoundTrip(req)
+}
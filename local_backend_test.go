@@ -0,0 +1,91 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestLocalBackend(t *testing.T) {
+	var mu sync.Mutex
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000000,"completion_tokens":500000,"total_tokens":1500000}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client, err := NewStrictClient("",
+		withRecorder(rec),
+		WithLocalBackend(LocalBackend{
+			BaseURL: srv.URL + "/v1",
+			Pricing: map[string]TokenPricing{"llama3.1:70b": {Input: 0.2, Output: 0.4}},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, model := range []string{"llama3.1:70b", "qwen2.5:7b"} {
+		_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", model, err)
+		}
+	}
+
+	events := rec.all()
+	if len(events) != 2 {
+		t.Fatalf("got %d events", len(events))
+	}
+	if events[0].Provider != "local" || math.Abs(events[0].CostEstimateUSD-0.4) > 1e-9 {
+		t.Errorf("priced model: provider %q, cost %v", events[0].Provider, events[0].CostEstimateUSD)
+	}
+	if events[1].CostEstimateUSD != 0 {
+		t.Errorf("unpriced model cost %v, want 0", events[1].CostEstimateUSD)
+	}
+	for _, a := range auth {
+		if a != "" {
+			t.Errorf("Authorization sent without a key: %q", a)
+		}
+	}
+}
+
+func TestLocalBackendKeepsKeyAndAnthropicPricing(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	client := NewClient("vllm-key",
+		WithLocalBackend(LocalBackend{BaseURL: srv.URL + "/v1"}),
+		WithAnthropic(AnthropicConfig{APIKey: "ak"}),
+	)
+	if got := client.providerFor("claude-3-5-haiku-latest"); got != "anthropic" {
+		t.Errorf("claude provider = %q", got)
+	}
+	if cost := client.estimateCost("claude-3-5-haiku-latest", 1_000_000, 0); cost != 0.8 {
+		t.Errorf("claude cost = %v, want Anthropic's", cost)
+	}
+
+	var sent string
+	keyed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("Authorization")
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(keyed.Close)
+	client = NewClient("vllm-key", WithLocalBackend(LocalBackend{BaseURL: keyed.URL + "/v1"}))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if sent != "Bearer vllm-key" {
+		t.Errorf("Authorization = %q", sent)
+	}
+}
@@ -0,0 +1,92 @@
+package langmesh
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogEvent identifies a kind of message the client logs, each at its own
+// level
+type LogEvent string
+
+const (
+	// LogRequest covers the start of every upstream HTTP request and the
+	// finish of every wrapped call
+	LogRequest LogEvent = "request"
+	// LogRetry covers model fallbacks, realtime reconnects, rate limit
+	// throttling and embedding batch retries
+	LogRetry LogEvent = "retry"
+	// LogTelemetry covers telemetry batches a sink failed to accept
+	LogTelemetry LogEvent = "telemetry"
+	// LogBudget covers requests rejected by a budget, cost, quota or loop
+	// guard, models burning their error budget and cost anomalies
+	LogBudget LogEvent = "budget"
+	// LogUninstrumented covers calls that bypass telemetry, when
+	// WithUninstrumentedCalls is set to UninstrumentedWarn
+	LogUninstrumented LogEvent = "uninstrumented"
+	// LogConfig covers WithConfigFile reloads and reloads that failed
+	LogConfig LogEvent = "config"
+	// LogJobs covers jobs that could not be stored, read or requeued, and
+	// job webhooks that could not be delivered
+	LogJobs LogEvent = "jobs"
+)
+
+// DefaultLogLevels are used for each event unless WithLogLevel overrides
+// them
+var DefaultLogLevels = map[LogEvent]slog.Level{
+	LogRequest:        slog.LevelDebug,
+	LogRetry:          slog.LevelWarn,
+	LogTelemetry:      slog.LevelWarn,
+	LogBudget:         slog.LevelWarn,
+	LogUninstrumented: slog.LevelWarn,
+	LogConfig:         slog.LevelInfo,
+	LogJobs:           slog.LevelWarn,
+}
+
+// WithLogger sends the client's logs to logger instead of slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithLogLevel logs messages of kind event at level
+func WithLogLevel(event LogEvent, level slog.Level) Option {
+	return func(c *Client) {
+		if c.logLevels == nil {
+			c.logLevels = make(map[LogEvent]slog.Level)
+		}
+		c.logLevels[event] = level
+	}
+}
+
+// log writes msg with attrs at the level configured for event
+func (c *Client) log(ctx context.Context, event LogEvent, msg string, args ...any) {
+	logger := c.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level, ok := c.logLevels[event]
+	if !ok {
+		level = DefaultLogLevels[event]
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, "langmesh: "+msg, append(args, "event", string(event))...)
+}
+
+// logFinished logs a wrapped call's outcome from its telemetry event
+func (c *Client) logFinished(event *TelemetryEvent) {
+	args := []any{
+		"request_id", event.RequestID,
+		"endpoint", event.Endpoint,
+		"model", event.Model,
+		"status", event.Status,
+		"latency_ms", event.LatencyMs,
+	}
+	if event.ErrorMessage != "" {
+		args = append(args, "error", event.ErrorMessage)
+	}
+	c.log(context.Background(), LogRequest, "request finished", args...)
+}
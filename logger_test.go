@@ -0,0 +1,136 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// logBuffer collects JSON log records written by concurrent goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) records() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]any
+		if json.Unmarshal([]byte(line), &record) == nil {
+			out = append(out, record)
+		}
+	}
+	return out
+}
+
+func (b *logBuffer) find(msg string) map[string]any {
+	for _, record := range b.records() {
+		if record["msg"] == "langmesh: "+msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func newTestLogger(b *logBuffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLoggerRequestsAndFallbacks(t *testing.T) {
+	srv, _ := newFallbackServer(t, map[string]int{"gpt-4o": 429}, "rate_limit_exceeded")
+	logs := &logBuffer{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithModelFallback("gpt-4o", "gpt-4o-mini"),
+		WithLogger(newTestLogger(logs)),
+		WithLogLevel(LogRequest, slog.LevelInfo),
+	)
+
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := 0
+	for _, record := range logs.records() {
+		if record["msg"] == "langmesh: request started" {
+			started++
+		}
+	}
+	if started != 2 {
+		t.Errorf("logged %d request starts, want one per attempt", started)
+	}
+	retry := logs.find("falling back to another model")
+	if retry == nil || retry["level"] != "WARN" || retry["fallback"] != "gpt-4o-mini" || retry["event"] != "retry" {
+		t.Errorf("retry record = %v", retry)
+	}
+	finished := logs.find("request finished")
+	if finished == nil || finished["level"] != "INFO" || finished["model"] != "gpt-4o-mini" || finished["status"] != "success" {
+		t.Errorf("finish record = %v", finished)
+	}
+}
+
+func TestLoggerTelemetryFailure(t *testing.T) {
+	srv, _ := newChatServer(t, "ok")
+	logs := &logBuffer{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithTelemetrySink("broken", TelemetrySinkFunc(func(context.Context, []TelemetryEvent) error {
+			return errors.New("sink down")
+		})),
+		WithLogger(newTestLogger(logs)),
+	)
+	client.recordTelemetry(TelemetryEvent{Endpoint: "chat.completions"})
+	client.flushTelemetry()
+
+	deadline := time.Now().Add(time.Second)
+	var record map[string]any
+	for record == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		record = logs.find("telemetry delivery failed")
+	}
+	if record == nil || record["sink"] != "broken" || record["error"] != "sink down" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestLoggerBudgetRejection(t *testing.T) {
+	srv, _ := newChatServer(t, "ok")
+	logs := &logBuffer{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithBudget(NewBudget(0, 0)),
+		WithLogger(newTestLogger(logs)),
+		WithLogLevel(LogBudget, slog.LevelError),
+	)
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if !errors.Is(err, ErrGuardRejected) {
+		t.Fatalf("err = %v", err)
+	}
+	record := logs.find("request rejected")
+	if record == nil || record["level"] != "ERROR" || record["reason"] != "budget_exceeded" {
+		t.Errorf("record = %v", record)
+	}
+}
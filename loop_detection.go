@@ -0,0 +1,192 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrLoopDetected matches GuardErrors from WithLoopDetection via errors.Is
+var ErrLoopDetected = errors.New("langmesh: runaway loop detected")
+
+// GuardReasonLoopDetected is the GuardError reason for a request stopped by
+// WithLoopDetection
+const GuardReasonLoopDetected GuardReason = "loop_detected"
+
+const (
+	// DefaultMaxRepeats is how many identical prompts WithLoopDetection allows
+	// within RepeatWindow
+	DefaultMaxRepeats = 5
+	// DefaultRepeatWindow is the period identical prompts are counted over
+	DefaultRepeatWindow = time.Minute
+	// DefaultMaxToolDepth is how many consecutive tool call rounds
+	// WithLoopDetection allows before the model answers
+	DefaultMaxToolDepth = 25
+	// loopSessionIdle is how long an untouched session's tokens are kept
+	loopSessionIdle = time.Hour
+)
+
+// LoopDetectionConfig configures WithLoopDetection. Zero fields take the
+// defaults; a negative limit turns that check off.
+type LoopDetectionConfig struct {
+	// MaxRepeats rejects a prompt already sent this many times within
+	// RepeatWindow by the same user and session
+	MaxRepeats   int
+	RepeatWindow time.Duration
+	// MaxToolDepth rejects a request whose messages end in more rounds of
+	// tool calls than this since the last user message, whether from
+	// RunTools or a hand-written loop
+	MaxToolDepth int
+	// MaxSessionTokens rejects calls in a session (ContextWithSession or a
+	// Conversation) that has already used this many tokens; zero means no
+	// ceiling
+	MaxSessionTokens int
+}
+
+// WithLoopDetection stops runaway agents: chat requests that repeat a
+// prompt too often, nest tool calls too deeply, or belong to a session
+// over its token ceiling fail before they are sent with a GuardError that
+// matches ErrLoopDetected.
+func WithLoopDetection(cfg LoopDetectionConfig) Option {
+	return func(c *Client) {
+		if cfg.MaxRepeats == 0 {
+			cfg.MaxRepeats = DefaultMaxRepeats
+		}
+		if cfg.RepeatWindow <= 0 {
+			cfg.RepeatWindow = DefaultRepeatWindow
+		}
+		if cfg.MaxToolDepth == 0 {
+			cfg.MaxToolDepth = DefaultMaxToolDepth
+		}
+		d := &loopDetector{
+			cfg:      cfg,
+			repeats:  make(map[[sha256.Size]byte][]time.Time),
+			sessions: make(map[string]*sessionUsage),
+			now:      time.Now,
+		}
+		c.guards = append(c.guards, d)
+		c.observers = append(c.observers, d)
+	}
+}
+
+type sessionUsage struct {
+	tokens   int
+	lastSeen time.Time
+}
+
+type loopDetector struct {
+	cfg      LoopDetectionConfig
+	mu       sync.Mutex
+	repeats  map[[sha256.Size]byte][]time.Time
+	sessions map[string]*sessionUsage
+	checks   int
+	now      func() time.Time
+}
+
+func (d *loopDetector) check(ctx context.Context, _ *Client, request openai.ChatCompletionRequest) error {
+	if depth := toolDepth(request.Messages); d.cfg.MaxToolDepth > 0 && depth > d.cfg.MaxToolDepth {
+		return loopError(fmt.Sprintf("%d rounds of tool calls, limit %d", depth, d.cfg.MaxToolDepth))
+	}
+
+	scope := ScopeFrom(ctx)
+	session := ""
+	if carrier := carrierFrom(ctx); carrier != nil {
+		session = carrier.session
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Sweep idle entries every so often rather than on every check
+	if d.checks++; d.checks%1024 == 0 {
+		d.sweep(now)
+	}
+	if u := d.sessions[session]; session != "" && d.cfg.MaxSessionTokens > 0 && u != nil &&
+		u.tokens >= d.cfg.MaxSessionTokens {
+		return loopError(fmt.Sprintf("session %s used %d tokens, limit %d", session, u.tokens, d.cfg.MaxSessionTokens))
+	}
+	if d.cfg.MaxRepeats > 0 {
+		key := promptKey(scope.User, session, request)
+		recent := d.repeats[key][:0]
+		for _, at := range d.repeats[key] {
+			if now.Sub(at) < d.cfg.RepeatWindow {
+				recent = append(recent, at)
+			}
+		}
+		if len(recent) >= d.cfg.MaxRepeats {
+			d.repeats[key] = recent
+			return loopError(fmt.Sprintf("identical prompt sent %d times in %s", len(recent), d.cfg.RepeatWindow))
+		}
+		d.repeats[key] = append(recent, now)
+	}
+	return nil
+}
+
+func (d *loopDetector) observe(event TelemetryEvent) {
+	// Heartbeats carry the stream's running usage, which the final event
+	// reports again
+	if event.Heartbeat || event.SessionID == "" || d.cfg.MaxSessionTokens <= 0 || event.TokenUsage.TotalTokens == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.sessions[event.SessionID]
+	if !ok {
+		u = &sessionUsage{}
+		d.sessions[event.SessionID] = u
+	}
+	u.tokens += event.TokenUsage.TotalTokens
+	u.lastSeen = d.now()
+}
+
+// sweep drops prompts not repeated within the window and idle sessions
+func (d *loopDetector) sweep(now time.Time) {
+	for key, times := range d.repeats {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= d.cfg.RepeatWindow {
+			delete(d.repeats, key)
+		}
+	}
+	for id, u := range d.sessions {
+		if now.Sub(u.lastSeen) >= loopSessionIdle {
+			delete(d.sessions, id)
+		}
+	}
+}
+
+func loopError(violation string) error {
+	return &GuardError{Reason: GuardReasonLoopDetected, Guard: "loop_detector", Violation: violation}
+}
+
+// toolDepth counts the assistant tool call rounds after the last user
+// message
+func toolDepth(messages []openai.ChatCompletionMessage) int {
+	depth := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if m.Role == openai.ChatMessageRoleUser {
+			break
+		}
+		if m.Role == openai.ChatMessageRoleAssistant && (len(m.ToolCalls) > 0 || m.FunctionCall != nil) {
+			depth++
+		}
+	}
+	return depth
+}
+
+// promptKey identifies a prompt from one user and session
+func promptKey(user, session string, request openai.ChatCompletionRequest) [sha256.Size]byte {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	// Encoding plain strings and messages cannot fail
+	_ = enc.Encode([]string{user, session, request.Model})
+	_ = enc.Encode(request.Messages)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
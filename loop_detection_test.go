@@ -0,0 +1,133 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestLoopDetectionRepeatedPrompt(t *testing.T) {
+	srv, calls := newChatServer(t, "again")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"),
+		WithLoopDetection(LoopDetectionConfig{MaxRepeats: 2, RepeatWindow: time.Minute}))
+	d := client.guards[len(client.guards)-1].(*loopDetector)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(ctx, chatRequest("same")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another user's identical prompt is counted separately
+	if _, err := client.CreateChatCompletion(ContextWithUser(ctx, "other"), chatRequest("same")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.CreateChatCompletion(ctx, chatRequest("same"))
+	var guardErr *GuardError
+	if !errors.Is(err, ErrLoopDetected) || !errors.Is(err, ErrGuardRejected) ||
+		!errors.As(err, &guardErr) || guardErr.Reason != GuardReasonLoopDetected {
+		t.Fatalf("err = %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("server calls = %d, want 3", *calls)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("same")); err != nil {
+		t.Errorf("after window: %v", err)
+	}
+}
+
+func TestLoopDetectionToolDepth(t *testing.T) {
+	d := &loopDetector{cfg: LoopDetectionConfig{MaxRepeats: -1, MaxToolDepth: 2}, now: time.Now}
+	round := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_1"}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "{}"},
+	}
+	request := chatRequest("plan a trip")
+	for i := 0; i < 2; i++ {
+		request.Messages = append(request.Messages, round...)
+	}
+	if err := d.check(context.Background(), nil, request); err != nil {
+		t.Fatalf("at limit: %v", err)
+	}
+	request.Messages = append(request.Messages, round...)
+	if err := d.check(context.Background(), nil, request); !errors.Is(err, ErrLoopDetected) {
+		t.Fatalf("err = %v", err)
+	}
+	// A new user message resets the depth
+	request.Messages = append(request.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "thanks"})
+	if err := d.check(context.Background(), nil, request); err != nil {
+		t.Errorf("after user message: %v", err)
+	}
+}
+
+func TestLoopDetectionSessionTokens(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"),
+		WithLoopDetection(LoopDetectionConfig{MaxSessionTokens: 30}))
+
+	ctx := ContextWithSession(context.Background(), "sess_1")
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(ctx, chatRequest("turn")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := client.CreateChatCompletion(ctx, chatRequest("turn 3"))
+	if !errors.Is(err, ErrLoopDetected) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := client.CreateChatCompletion(ContextWithSession(context.Background(), "sess_2"), chatRequest("turn 3")); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
+
+func TestLoopDetectionSkipsStreamHeartbeats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			fmt.Fprint(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"thinking hard about it\"}}]}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":20,\"total_tokens\":25}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithStreamHeartbeat(10*time.Millisecond),
+		WithLoopDetection(LoopDetectionConfig{MaxSessionTokens: 100}), withRecorder(rec))
+	d := client.guards[len(client.guards)-1].(*loopDetector)
+
+	ctx := ContextWithSession(context.Background(), "sess_1")
+	stream, err := client.CreateChatCompletionStream(ctx, chatRequest("think"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+
+	events := rec.all()
+	final := events[len(events)-1]
+	if len(events) < 3 || final.Heartbeat {
+		t.Fatalf("got %d events, want heartbeats before the final event", len(events))
+	}
+	d.mu.Lock()
+	tokens := d.sessions["sess_1"].tokens
+	d.mu.Unlock()
+	if tokens != final.TokenUsage.TotalTokens {
+		t.Errorf("session tokens = %d, want the final event's %d", tokens, final.TokenUsage.TotalTokens)
+	}
+}
@@ -0,0 +1,567 @@
+// Package mcp connects to Model Context Protocol servers, over stdio or
+// SSE, and exposes their tools and resources as langmesh tools, so existing
+// MCP tool servers work with RunTools and agents
+//
+// Usage:
+//
+//	server, err := mcp.DialStdio(ctx, exec.Command("npx", "-y", "@modelcontextprotocol/server-filesystem", dir))
+//	defer server.Close()
+//	tools, err := server.Tools(ctx)
+//	definitions, funcs := langmesh.ToolSet(tools...)
+//	request.Tools = definitions
+//	result, err := client.RunTools(ctx, request, funcs, langmesh.RunToolsOptions{})
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ProtocolVersion is the MCP revision the client speaks
+const ProtocolVersion = "2024-11-05"
+
+// ErrClosed is returned for calls on a connection that has closed
+var ErrClosed = errors.New("langmesh: mcp connection closed")
+
+// Error is a JSON-RPC error returned by the server
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("langmesh: mcp error %d: %s", e.Code, e.Message)
+}
+
+// Option configures a connection
+type Option func(*options)
+
+type options struct {
+	name, version string
+	prefix        string
+	httpClient    *http.Client
+	header        http.Header
+}
+
+// WithClientInfo sets the name and version the client introduces itself
+// with, "langmesh" by default
+func WithClientInfo(name, version string) Option {
+	return func(o *options) { o.name, o.version = name, version }
+}
+
+// WithToolPrefix prefixes the names of the server's tools as returned by
+// Tools, so tools from several servers cannot collide. Calls go to the
+// server under the tool's own name.
+func WithToolPrefix(prefix string) Option {
+	return func(o *options) { o.prefix = prefix }
+}
+
+// WithHTTPClient sets the HTTP client for SSE connections
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.httpClient = client }
+}
+
+// WithHeader adds headers, such as Authorization, to every SSE request
+func WithHeader(header http.Header) Option {
+	return func(o *options) { o.header = header }
+}
+
+// transport carries JSON-RPC messages to and from the server
+type transport interface {
+	send(ctx context.Context, data []byte) error
+	// receive returns the server's next message, and an error once the
+	// connection is closed
+	receive() ([]byte, error)
+	close() error
+}
+
+// ServerInfo is what the server said about itself when connecting
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Instructions, if the server sent any, describe how to use it and can
+	// be added to the system prompt
+	Instructions string `json:"-"`
+}
+
+// Client is a connection to one MCP server. It is safe for concurrent use.
+type Client struct {
+	t      transport
+	prefix string
+	server ServerInfo
+	caps   serverCapabilities
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[int64]chan rpcMessage
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+type serverCapabilities struct {
+	Tools     *json.RawMessage `json:"tools,omitempty"`
+	Resources *json.RawMessage `json:"resources,omitempty"`
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// incoming is rpcMessage as received, with params left undecoded
+type incoming struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+func newOptions(opts []Option) options {
+	o := options{name: "langmesh", version: "1.0"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// connect starts reading from t and makes the initialize handshake
+func connect(ctx context.Context, t transport, o options) (*Client, error) {
+	c := &Client{
+		t:       t,
+		prefix:  o.prefix,
+		pending: make(map[int64]chan rpcMessage),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+
+	var init struct {
+		ServerInfo   ServerInfo         `json:"serverInfo"`
+		Capabilities serverCapabilities `json:"capabilities"`
+		Instructions string             `json:"instructions"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]string{"name": o.name, "version": o.version},
+	}, &init)
+	if err == nil {
+		err = c.notify(ctx, "notifications/initialized", nil)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("langmesh: mcp initialize: %w", err)
+	}
+	c.server = init.ServerInfo
+	c.server.Instructions = init.Instructions
+	c.caps = init.Capabilities
+	return c, nil
+}
+
+// Server returns what the server said about itself
+func (c *Client) Server() ServerInfo {
+	return c.server
+}
+
+// Close closes the connection, stopping a stdio server
+func (c *Client) Close() error {
+	err := c.t.close()
+	c.fail(ErrClosed)
+	return err
+}
+
+// fail ends the connection with err, failing calls still waiting
+func (c *Client) fail(err error) {
+	c.closeOnce.Do(func() {
+		if !errors.Is(err, ErrClosed) {
+			err = fmt.Errorf("%w: %v", ErrClosed, err)
+		}
+		c.err = err
+		close(c.done)
+	})
+}
+
+// read dispatches the server's messages until the connection closes
+func (c *Client) read() {
+	for {
+		data, err := c.t.receive()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		data = []byte(strings.TrimSpace(string(data)))
+		if len(data) > 0 && data[0] == '[' {
+			var batch []json.RawMessage
+			if json.Unmarshal(data, &batch) == nil {
+				for _, msg := range batch {
+					c.dispatch(msg)
+				}
+			}
+			continue
+		}
+		c.dispatch(data)
+	}
+}
+
+func (c *Client) dispatch(data []byte) {
+	var msg incoming
+	if err := json.Unmarshal(data, &msg); err != nil {
+		// Not JSON-RPC, such as a server logging to stdout
+		return
+	}
+	switch {
+	case msg.Method != "" && len(msg.ID) > 0:
+		go c.answer(msg)
+	case msg.Method != "":
+		// Notifications, such as list changes, need no answer
+	default:
+		var id int64
+		if json.Unmarshal(msg.ID, &id) != nil {
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- rpcMessage{Result: msg.Result, Error: msg.Error}
+		}
+	}
+}
+
+// answer replies to a request from the server. Only pings are supported.
+func (c *Client) answer(req incoming) {
+	reply := rpcMessage{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "ping" {
+		reply.Result = json.RawMessage("{}")
+	} else {
+		reply.Error = &Error{Code: -32601, Message: "method not found: " + req.Method}
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = c.t.send(ctx, data)
+}
+
+// call makes a request and decodes its result into result, if not nil
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	id := c.nextID.Add(1)
+	ch := make(chan rpcMessage, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(id)), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if err := c.t.send(ctx, data); err != nil {
+		return err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-ctx.Done():
+		cancelCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = c.notify(cancelCtx, "notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	data, err := json.Marshal(rpcMessage{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return c.t.send(ctx, data)
+}
+
+// ToolInfo describes one of the server's tools
+type ToolInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// Content is a piece of a tool result or an embedded resource
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Data is base64, for images and audio
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// CallResult is what a tool call returned
+type CallResult struct {
+	Content []Content `json:"content"`
+	// IsError reports that the tool failed, with Content saying why
+	IsError bool `json:"isError,omitempty"`
+}
+
+// Text renders the result for a model: its text, with other content
+// reduced to a placeholder
+func (r CallResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, content := range r.Content {
+		switch {
+		case content.Type == "text":
+			parts = append(parts, content.Text)
+		case content.Resource != nil:
+			parts = append(parts, content.Resource.render())
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", content.Type, content.MimeType))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Resource describes one of the server's resources
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is a resource as read, either text or a base64 blob
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+func (r ResourceContents) render() string {
+	if r.Blob != "" {
+		return fmt.Sprintf("[%s: %s, %d bytes of base64]", r.URI, r.MimeType, len(r.Blob))
+	}
+	return r.Text
+}
+
+// ListTools returns the server's tools
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	err := c.paginate(ctx, "tools/list", func(page json.RawMessage) error {
+		var result struct {
+			Tools []ToolInfo `json:"tools"`
+		}
+		err := json.Unmarshal(page, &result)
+		tools = append(tools, result.Tools...)
+		return err
+	})
+	return tools, err
+}
+
+// CallTool calls a tool with its arguments as a JSON object. A tool that
+// fails reports it in the result, with IsError set, rather than as an error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (CallResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallResult
+	err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments}, &result)
+	return result, err
+}
+
+// ListResources returns the server's resources, or none if it has no
+// resources capability
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	if c.caps.Resources == nil {
+		return nil, nil
+	}
+	var resources []Resource
+	err := c.paginate(ctx, "resources/list", func(page json.RawMessage) error {
+		var result struct {
+			Resources []Resource `json:"resources"`
+		}
+		err := json.Unmarshal(page, &result)
+		resources = append(resources, result.Resources...)
+		return err
+	})
+	return resources, err
+}
+
+// ReadResource reads a resource by URI
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]ResourceContents, error) {
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	err := c.call(ctx, "resources/read", map[string]string{"uri": uri}, &result)
+	return result.Contents, err
+}
+
+// paginate calls a list method, following its cursors
+func (c *Client) paginate(ctx context.Context, method string, page func(json.RawMessage) error) error {
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var result json.RawMessage
+		if err := c.call(ctx, method, params, &result); err != nil {
+			return err
+		}
+		if err := page(result); err != nil {
+			return err
+		}
+		var next struct {
+			NextCursor string `json:"nextCursor"`
+		}
+		_ = json.Unmarshal(result, &next)
+		if next.NextCursor == "" || next.NextCursor == cursor {
+			return nil
+		}
+		cursor = next.NextCursor
+	}
+}
+
+// Tools returns the server's tools as langmesh tools, each proxying calls
+// to the server. A tool result with IsError set is returned as an error,
+// which RunToolsOptions.ReportToolErrors passes back to the model. If the
+// server has resources, a "read_resource" tool is added for reading them.
+func (c *Client) Tools(ctx context.Context) ([]langmesh.Tool, error) {
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tools := make([]langmesh.Tool, 0, len(infos)+1)
+	for _, info := range infos {
+		tools = append(tools, c.tool(info))
+	}
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) > 0 {
+		tools = append(tools, c.resourceTool(resources))
+	}
+	return tools, nil
+}
+
+func (c *Client) tool(info ToolInfo) langmesh.Tool {
+	name := info.Name
+	return langmesh.Tool{
+		Definition: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        c.prefix + name,
+				Description: info.Description,
+				Parameters:  objectSchema(info.InputSchema),
+			},
+		},
+		Func: func(ctx context.Context, arguments string) (string, error) {
+			result, err := c.CallTool(ctx, name, json.RawMessage(strings.TrimSpace(arguments)))
+			if err != nil {
+				return "", err
+			}
+			if result.IsError {
+				return "", fmt.Errorf("langmesh: mcp tool %q failed: %s", name, result.Text())
+			}
+			return result.Text(), nil
+		},
+	}
+}
+
+// resourceTool lets the model read any of resources by URI
+func (c *Client) resourceTool(resources []Resource) langmesh.Tool {
+	var description strings.Builder
+	description.WriteString("Read one of these resources by URI:")
+	uris := make([]string, 0, len(resources))
+	for _, r := range resources {
+		uris = append(uris, r.URI)
+		fmt.Fprintf(&description, "\n- %s: %s", r.URI, r.Name)
+		if r.Description != "" {
+			fmt.Fprintf(&description, ", %s", r.Description)
+		}
+	}
+	schema, _ := json.Marshal(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"uri": map[string]any{"type": "string", "enum": uris},
+		},
+		"required":             []string{"uri"},
+		"additionalProperties": false,
+	})
+	return langmesh.Tool{
+		Definition: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        c.prefix + "read_resource",
+				Description: description.String(),
+				Parameters:  json.RawMessage(schema),
+			},
+		},
+		Func: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				URI string `json:"uri"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("langmesh: read_resource arguments: %w", err)
+			}
+			contents, err := c.ReadResource(ctx, args.URI)
+			if err != nil {
+				return "", err
+			}
+			parts := make([]string, 0, len(contents))
+			for _, content := range contents {
+				parts = append(parts, content.render())
+			}
+			return strings.Join(parts, "\n"), nil
+		},
+	}
+}
+
+// objectSchema returns a tool's input schema as OpenAI accepts it: an
+// object with properties, even if the server left them out
+func objectSchema(raw json.RawMessage) json.RawMessage {
+	schema := map[string]any{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &schema); err != nil || schema == nil {
+			schema = map[string]any{}
+		}
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]any{}
+	}
+	data, _ := json.Marshal(schema)
+	return data
+}
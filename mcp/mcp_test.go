@@ -0,0 +1,239 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	langmesh "github.com/langmesh-ai/openai-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TestMain lets the test binary double as a stdio MCP server
+func TestMain(m *testing.M) {
+	if os.Getenv("LANGMESH_FAKE_MCP_SERVER") == "1" {
+		fake := &fakeServer{}
+		out := bufio.NewWriter(os.Stdout)
+		in := bufio.NewScanner(os.Stdin)
+		for in.Scan() {
+			for _, reply := range fake.handle(in.Bytes()) {
+				out.Write(append(reply, '\n'))
+			}
+			out.Flush()
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServer answers JSON-RPC messages like an MCP server with two pages
+// of tools and one resource
+type fakeServer struct {
+	pinged atomic.Bool
+	header atomic.Value
+}
+
+func (s *fakeServer) handle(data []byte) [][]byte {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Cursor    string          `json:"cursor"`
+			Name      string          `json:"name"`
+			URI       string          `json:"uri"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+	if msg.Method == "" {
+		if string(msg.ID) == `"srv-1"` {
+			s.pinged.Store(true)
+		}
+		return nil
+	}
+	if msg.Method == "notifications/initialized" {
+		return [][]byte{[]byte(`{"jsonrpc":"2.0","id":"srv-1","method":"ping"}`)}
+	}
+
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"serverInfo":      map[string]string{"name": "fake", "version": "0.1"},
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			"instructions":    "Use echo to repeat text.",
+		}
+	case "tools/list":
+		if msg.Params.Cursor == "" {
+			result = map[string]any{"nextCursor": "2", "tools": []map[string]any{{
+				"name":        "echo",
+				"description": "Repeats text",
+				"inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]string{"type": "string"}}, "required": []string{"text"}},
+			}}}
+		} else {
+			result = map[string]any{"tools": []map[string]any{{"name": "fail"}}}
+		}
+	case "tools/call":
+		var args struct {
+			Text string `json:"text"`
+		}
+		_ = json.Unmarshal(msg.Params.Arguments, &args)
+		switch msg.Params.Name {
+		case "echo":
+			result = map[string]any{"content": []map[string]string{{"type": "text", "text": "echo: " + args.Text}, {"type": "image", "data": "AAAA", "mimeType": "image/png"}}}
+		case "fail":
+			result = map[string]any{"isError": true, "content": []map[string]string{{"type": "text", "text": "disk full"}}}
+		default:
+			return [][]byte{fmt.Appendf(nil, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32602,"message":"unknown tool %s"}}`, msg.ID, msg.Params.Name)}
+		}
+	case "resources/list":
+		result = map[string]any{"resources": []map[string]string{{"uri": "file:///readme", "name": "README", "description": "Project overview"}}}
+	case "resources/read":
+		result = map[string]any{"contents": []map[string]string{{"uri": msg.Params.URI, "text": "Hello from " + msg.Params.URI}}}
+	default:
+		return [][]byte{fmt.Appendf(nil, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not found"}}`, msg.ID)}
+	}
+	reply, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+	return [][]byte{reply}
+}
+
+// newSSEServer serves fake over the HTTP with SSE transport
+func newSSEServer(t *testing.T, fake *fakeServer) *httptest.Server {
+	t.Helper()
+	outbox := make(chan []byte, 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		fake.header.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": hello\n\nevent: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case msg := <-outbox:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("session") != "1" || r.Method != http.MethodPost {
+			http.Error(w, "bad session", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		for _, reply := range fake.handle(data) {
+			outbox <- reply
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialFake(t *testing.T, opts ...Option) (*Client, *fakeServer) {
+	t.Helper()
+	fake := &fakeServer{}
+	srv := newSSEServer(t, fake)
+	c, err := DialSSE(context.Background(), srv.URL+"/sse", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, fake
+}
+
+func TestClientHandshake(t *testing.T) {
+	c, _ := dialFake(t)
+	if info := c.Server(); info.Name != "fake" || info.Version != "0.1" || info.Instructions != "Use echo to repeat text." {
+		t.Errorf("server = %+v", info)
+	}
+	tools, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 || tools[0].Name != "echo" || tools[1].Name != "fail" {
+		t.Errorf("tools = %+v, want both pages", tools)
+	}
+}
+
+func TestClientTools(t *testing.T) {
+	c, _ := dialFake(t, WithToolPrefix("fake_"))
+	ctx := context.Background()
+	tools, err := c.Tools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions, funcs := langmesh.ToolSet(tools...)
+	var names []string
+	for _, def := range definitions {
+		names = append(names, def.Function.Name)
+	}
+	if fmt.Sprint(names) != "[fake_echo fake_fail fake_read_resource]" {
+		t.Fatalf("tools = %v", names)
+	}
+	// A schema the server left empty is still an object with properties
+	if params := string(definitions[1].Function.Parameters.(json.RawMessage)); params != `{"properties":{},"type":"object"}` {
+		t.Errorf("fail parameters = %s", params)
+	}
+
+	call := func(name, arguments string) openai.ToolCall {
+		return openai.ToolCall{ID: "call_" + name, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+	}
+	outputs, err := langmesh.ExecuteToolCalls(ctx, definitions, funcs, []openai.ToolCall{
+		call("fake_echo", `{"text":"hi"}`),
+		call("fake_fail", `{}`),
+		call("fake_read_resource", `{"uri":"file:///readme"}`),
+	}, langmesh.RunToolsOptions{ReportToolErrors: true, ValidateArguments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0] != "echo: hi\n[image image/png]" {
+		t.Errorf("echo output = %q", outputs[0])
+	}
+	if !strings.Contains(outputs[1], "disk full") || !strings.HasPrefix(outputs[1], "error:") {
+		t.Errorf("fail output = %q", outputs[1])
+	}
+	if outputs[2] != "Hello from file:///readme" {
+		t.Errorf("read_resource output = %q", outputs[2])
+	}
+	if desc := definitions[2].Function.Description; !strings.Contains(desc, "file:///readme: README, Project overview") {
+		t.Errorf("read_resource description = %q", desc)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, fake := dialFake(t)
+	ctx := context.Background()
+
+	_, err := c.CallTool(ctx, "missing", nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32602 {
+		t.Errorf("err = %v, want the server's error", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !fake.pinged.Load(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the server's ping was not answered")
+		}
+	}
+
+	c.Close()
+	if _, err := c.ListTools(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("after Close: err = %v, want ErrClosed", err)
+	}
+}
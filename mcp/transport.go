@@ -0,0 +1,242 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stopGrace is how long a stdio server has to exit after its stdin closes
+// before it is killed
+const stopGrace = 5 * time.Second
+
+// DialStdio starts cmd as an MCP server, speaking newline-delimited
+// JSON-RPC over its stdin and stdout, and connects to it. The server's
+// stderr goes wherever cmd.Stderr points. Close stops the server.
+func DialStdio(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: mcp stdio: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: mcp stdio: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("langmesh: mcp stdio: %w", err)
+	}
+	t := &stdioTransport{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout), exited: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(t.exited)
+	}()
+	return connect(ctx, t, newOptions(opts))
+}
+
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	exited chan struct{}
+
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+func (t *stdioTransport) send(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) receive() ([]byte, error) {
+	for {
+		line, err := t.stdout.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// close closes the server's stdin, as it is asked to exit, killing it if it
+// has not after stopGrace
+func (t *stdioTransport) close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		err = t.stdin.Close()
+		select {
+		case <-t.exited:
+		case <-time.After(stopGrace):
+			_ = t.cmd.Process.Kill()
+			<-t.exited
+		}
+	})
+	return err
+}
+
+// DialSSE connects to an MCP server over HTTP with server-sent events: the
+// server's messages arrive on an event stream from url, and the client's
+// are posted to the endpoint the stream names
+func DialSSE(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	t := &sseTransport{http: o.httpClient, header: o.header}
+	if t.http == nil {
+		t.http = http.DefaultClient
+	}
+	if err := t.open(ctx, url); err != nil {
+		return nil, fmt.Errorf("langmesh: mcp sse: %w", err)
+	}
+	return connect(ctx, t, o)
+}
+
+type sseTransport struct {
+	http     *http.Client
+	header   http.Header
+	endpoint string
+
+	stream *bufio.Reader
+	body   io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// open starts the event stream, which outlives ctx, and waits for its
+// endpoint event
+func (t *sseTransport) open(ctx context.Context, rawURL string) error {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.http.Do(req)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("event stream returned %s", resp.Status)
+	}
+	t.body = resp.Body
+	t.stream = bufio.NewReader(resp.Body)
+
+	for {
+		event, data, err := t.next()
+		if err != nil {
+			t.close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("waiting for endpoint: %w", err)
+		}
+		if event != "endpoint" {
+			continue
+		}
+		endpoint, err := base.Parse(strings.TrimSpace(data))
+		if err != nil {
+			t.close()
+			return fmt.Errorf("endpoint %q: %w", data, err)
+		}
+		t.endpoint = endpoint.String()
+		return nil
+	}
+}
+
+func (t *sseTransport) setHeaders(req *http.Request) {
+	for key, values := range t.header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+}
+
+// next reads the stream's next event
+func (t *sseTransport) next() (event, data string, err error) {
+	var lines []string
+	for {
+		line, err := t.stream.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if lines == nil && event == "" {
+				continue
+			}
+			return event, strings.Join(lines, "\n"), nil
+		case strings.HasPrefix(line, ":"):
+			// A comment, such as a keepalive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			lines = append(lines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (t *sseTransport) receive() ([]byte, error) {
+	for {
+		event, data, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		if event == "" || event == "message" {
+			return []byte(data), nil
+		}
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("langmesh: mcp sse: posting a message returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *sseTransport) close() error {
+	t.cancel()
+	if t.body != nil {
+		return t.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestDialStdio(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LANGMESH_FAKE_MCP_SERVER=1")
+	cmd.Stderr = os.Stderr
+	c, err := DialStdio(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server().Name != "fake" {
+		t.Errorf("server = %+v", c.Server())
+	}
+	result, err := c.CallTool(context.Background(), "echo", []byte(`{"text":"over stdio"}`))
+	if err != nil || result.Content[0].Text != "echo: over stdio" {
+		t.Errorf("result = %+v, %v", result, err)
+	}
+
+	started := time.Now()
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+	if time.Since(started) > stopGrace/2 || cmd.ProcessState == nil {
+		t.Error("the server did not exit when its stdin closed")
+	}
+}
+
+func TestDialSSEHeaders(t *testing.T) {
+	c, fake := dialFake(t, WithHeader(http.Header{"Authorization": {"Bearer token"}}))
+	if got := fake.header.Load(); got != "Bearer token" {
+		t.Errorf("Authorization = %v", got)
+	}
+	if c.t.(*sseTransport).endpoint == "" {
+		t.Error("no endpoint")
+	}
+}
+
+func TestDialSSEWithoutEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DialSSE(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the dial deadline", err)
+	}
+}
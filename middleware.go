@@ -0,0 +1,150 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// traceparentHeader carries W3C trace context, in incoming requests and
+// upstream
+const traceparentHeader = "Traceparent"
+
+// MiddlewareConfig is how Middleware attributes incoming HTTP requests.
+// Empty header names take the defaults below.
+type MiddlewareConfig struct {
+	// UserHeader holds the user calls are attributed to, "X-User-Id" by
+	// default
+	UserHeader string
+	// TenantHeader holds the tenant, set as the "tenant" tag, "X-Tenant-Id"
+	// by default
+	TenantHeader string
+	// RequestIDHeader holds the incoming request's ID, set as the
+	// "http_request_id" tag, "X-Request-Id" by default
+	RequestIDHeader string
+	// TagHeaders maps more headers to the tags they set
+	TagHeaders map[string]string
+	// Identify, if set, adds to or overrides what the headers attribute,
+	// e.g. from an authenticated session. It runs after the headers are
+	// read and sees their Scope.
+	Identify func(r *http.Request, s *Scope)
+}
+
+func (cfg MiddlewareConfig) header(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+// Middleware attributes every langmesh call made while handling a
+// request: its user, tenant and request ID become the calls' user and
+// tags, and its W3C traceparent the parent of their traces. Calls made
+// after the handler returns, with its request's context, are counted as
+// scope violations, as with BeginRequest. Echo can use it through
+// echo.WrapMiddleware; for gin, call BeginHTTPRequest in a handler.
+func Middleware(cfg MiddlewareConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, end := BeginHTTPRequest(r, cfg)
+			defer end()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// BeginHTTPRequest starts the request scope Middleware would for r. Call
+// end once the request is handled.
+func BeginHTTPRequest(r *http.Request, cfg MiddlewareConfig) (ctx context.Context, end func()) {
+	s := Scope{User: r.Header.Get(cfg.header(cfg.UserHeader, "X-User-Id"))}
+	tag := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if s.Tags == nil {
+			s.Tags = make(map[string]string)
+		}
+		s.Tags[key] = value
+	}
+	tag("tenant", r.Header.Get(cfg.header(cfg.TenantHeader, "X-Tenant-Id")))
+	tag("http_request_id", r.Header.Get(cfg.header(cfg.RequestIDHeader, "X-Request-Id")))
+	for header, key := range cfg.TagHeaders {
+		tag(key, r.Header.Get(header))
+	}
+	if cfg.Identify != nil {
+		cfg.Identify(r, &s)
+	}
+	ctx, end = BeginRequest(r.Context(), s)
+	if tp := r.Header.Get(traceparentHeader); tp != "" {
+		ctx = ContextWithTraceParent(ctx, tp)
+	}
+	return ctx, end
+}
+
+// traceContext is a parsed W3C traceparent
+type traceContext struct {
+	traceID string
+	spanID  string
+	flags   string
+}
+
+// parseTraceparent reads a version 00 traceparent, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+func parseTraceparent(s string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceContext{}, false
+	}
+	tc := traceContext{traceID: parts[1], spanID: parts[2], flags: parts[3]}
+	if !isLowerHex(tc.traceID, 32) || !isLowerHex(tc.spanID, 16) || !isLowerHex(tc.flags, 2) ||
+		strings.Trim(tc.traceID, "0") == "" || strings.Trim(tc.spanID, "0") == "" {
+		return traceContext{}, false
+	}
+	return tc, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithTraceParent makes the W3C traceparent the parent of calls made
+// with the returned context: their events carry its trace and span IDs, and
+// their upstream requests a traceparent in the same trace. An invalid
+// traceparent is ignored.
+func ContextWithTraceParent(ctx context.Context, traceparent string) context.Context {
+	tc, ok := parseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+	return deriveCarrier(ctx, func(c *scopeCarrier) { c.trace = tc })
+}
+
+// applyTrace copies the trace parent on ctx onto event
+func applyTrace(ctx context.Context, event *TelemetryEvent) {
+	if carrier := liveCarrier(ctx); carrier != nil {
+		event.TraceID = carrier.trace.traceID
+		event.ParentSpanID = carrier.trace.spanID
+	}
+}
+
+// upstreamTraceparent is the traceparent for an upstream request made with
+// ctx, a new span in its trace, or "" outside one
+func upstreamTraceparent(ctx context.Context) string {
+	carrier := liveCarrier(ctx)
+	if carrier == nil || carrier.trace.traceID == "" {
+		return ""
+	}
+	span := make([]byte, 8)
+	rand.Read(span)
+	return "00-" + carrier.trace.traceID + "-" + hex.EncodeToString(span) + "-" + carrier.trace.flags
+}
@@ -0,0 +1,74 @@
+package langmesh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var upstream string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Get("Traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`))
+	}))
+	defer srv.Close()
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	handler := Middleware(MiddlewareConfig{
+		TagHeaders: map[string]string{"X-Feature": "feature"},
+		Identify: func(r *http.Request, s *Scope) {
+			if s.User == "" {
+				s.User = "anonymous"
+			}
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := client.CreateChatCompletion(r.Context(), chatRequest("hi")); err != nil {
+			t.Error(err)
+		}
+	}))
+	req := httptest.NewRequest("POST", "/ask", nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	req.Header.Set("X-Request-Id", "req-42")
+	req.Header.Set("X-Feature", "search")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("%d events", len(events))
+	}
+	e := events[0]
+	if e.User != "anonymous" || e.Tags["tenant"] != "acme" || e.Tags["http_request_id"] != "req-42" || e.Tags["feature"] != "search" {
+		t.Errorf("attribution = %q %v", e.User, e.Tags)
+	}
+	if e.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || e.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("trace = %q %q", e.TraceID, e.ParentSpanID)
+	}
+	if !strings.HasPrefix(upstream, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || strings.Contains(upstream, "00f067aa0ba902b7") {
+		t.Errorf("upstream traceparent = %q, want a new span in the trace", upstream)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tc := range []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		// Later versions may append fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	} {
+		if _, ok := parseTraceparent(tc.in); ok != tc.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tc.in, ok, tc.ok)
+		}
+	}
+}
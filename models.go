@@ -0,0 +1,283 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultModelManifestRefresh is how often a model manifest is fetched
+// again unless configured otherwise
+const DefaultModelManifestRefresh = time.Hour
+
+// ModelInfo describes what a model can do and what it costs
+type ModelInfo struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by,omitempty"`
+	// ContextWindow is the model's context size in tokens, prompt and
+	// completion together
+	ContextWindow int `json:"context_window,omitempty"`
+	// MaxOutputTokens caps the completion, when lower than the window
+	MaxOutputTokens int  `json:"max_output_tokens,omitempty"`
+	Vision          bool `json:"vision,omitempty"`
+	Tools           bool `json:"tools,omitempty"`
+	JSONMode        bool `json:"json_mode,omitempty"`
+	// InputPerMillionUSD and OutputPerMillionUSD price the model's tokens
+	InputPerMillionUSD  float64 `json:"input_per_million_usd,omitempty"`
+	OutputPerMillionUSD float64 `json:"output_per_million_usd,omitempty"`
+	// Available is set by ListModelInfo for models the API key can use
+	Available bool `json:"available,omitempty"`
+}
+
+// modelCapabilities are the capabilities of known models; windows and
+// prices come from defaultContextWindows and modelPricing
+var modelCapabilities = map[string]ModelInfo{
+	"gpt-4o":                  {MaxOutputTokens: 16384, Vision: true, Tools: true, JSONMode: true},
+	"gpt-4o-mini":             {MaxOutputTokens: 16384, Vision: true, Tools: true, JSONMode: true},
+	"gpt-4-turbo":             {MaxOutputTokens: 4096, Vision: true, Tools: true, JSONMode: true},
+	"gpt-4":                   {Tools: true},
+	"gpt-3.5-turbo":           {MaxOutputTokens: 4096, Tools: true, JSONMode: true},
+	"gpt-4o-realtime-preview": {ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true},
+
+	"claude-opus-4-20250514":     {ContextWindow: 200000, MaxOutputTokens: 32000, Vision: true, Tools: true},
+	"claude-sonnet-4-20250514":   {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true},
+	"claude-3-7-sonnet-20250219": {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true},
+	"claude-3-7-sonnet-latest":   {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true},
+	"claude-3-5-sonnet-20241022": {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true},
+	"claude-3-5-sonnet-latest":   {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true},
+	"claude-3-5-haiku-20241022":  {ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true},
+	"claude-3-5-haiku-latest":    {ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true},
+	"claude-3-opus-20240229":     {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true},
+	"claude-3-haiku-20240307":    {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true},
+
+	"text-embedding-3-small": {ContextWindow: 8191},
+	"text-embedding-3-large": {ContextWindow: 8191},
+	"text-embedding-ada-002": {ContextWindow: 8191},
+}
+
+// builtinModelInfo returns what the package knows of model
+func builtinModelInfo(model string) (ModelInfo, bool) {
+	info, known := modelCapabilities[model]
+	if window, ok := defaultContextWindows[model]; ok {
+		info.ContextWindow, known = window, true
+	}
+	if pricing, ok := modelPricing[model]; ok {
+		info.InputPerMillionUSD, info.OutputPerMillionUSD, known = pricing["input"], pricing["output"], true
+	}
+	info.ID = model
+	return info, known
+}
+
+// modelSnapshot matches the date suffix of pinned model versions
+var modelSnapshot = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// ModelInfo returns what is known of model: from the model manifest if
+// one is configured, else from the package's built-in registry. Pinned
+// snapshots such as gpt-4o-2024-08-06 fall back to their model's entry.
+func (c *Client) ModelInfo(model string) (ModelInfo, bool) {
+	if info, ok := c.lookupModel(model); ok {
+		return info, true
+	}
+	if base := modelSnapshot.ReplaceAllString(model, ""); base != model {
+		if info, ok := c.lookupModel(base); ok {
+			info.ID = model
+			return info, true
+		}
+	}
+	return ModelInfo{ID: model}, false
+}
+
+func (c *Client) lookupModel(model string) (ModelInfo, bool) {
+	if c.modelManifest != nil {
+		if info, ok := c.modelManifest.lookup(c, model); ok {
+			return info, true
+		}
+	}
+	if c.providerFor(model) == providerLocal {
+		pricing := c.local.Pricing[model]
+		return ModelInfo{ID: model, InputPerMillionUSD: pricing.Input, OutputPerMillionUSD: pricing.Output}, true
+	}
+	return builtinModelInfo(model)
+}
+
+// ListModelInfo lists the models the API key can use, each with what is
+// known of it, followed by known models the key cannot use
+func (c *Client) ListModelInfo(ctx context.Context) ([]ModelInfo, error) {
+	list, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []ModelInfo
+	seen := make(map[string]bool, len(list.Models))
+	for _, m := range list.Models {
+		info, _ := c.ModelInfo(m.ID)
+		info.OwnedBy = m.OwnedBy
+		info.Available = true
+		out = append(out, info)
+		seen[m.ID] = true
+	}
+	var missing []string
+	for model := range c.knownModels() {
+		if !seen[model] {
+			missing = append(missing, model)
+		}
+	}
+	sort.Strings(missing)
+	for _, model := range missing {
+		info, _ := c.ModelInfo(model)
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// knownModels returns the models of the registry and manifest
+func (c *Client) knownModels() map[string]bool {
+	models := make(map[string]bool)
+	for model := range modelCapabilities {
+		models[model] = true
+	}
+	for model := range modelPricing {
+		models[model] = true
+	}
+	if c.modelManifest != nil {
+		for model := range c.modelManifest.snapshot() {
+			models[model] = true
+		}
+	}
+	return models
+}
+
+// ModelManifest configures WithModelManifest
+type ModelManifest struct {
+	// URL serves JSON of the form {"models": [ModelInfo, ...]}
+	URL string
+	// Refresh is how often the manifest is fetched again
+	Refresh time.Duration
+	// HTTPClient fetches the manifest; http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// WithModelManifest loads model metadata from a remote manifest, so new
+// models and price changes need no release. Manifest entries replace the
+// built-in ones, prices included, so cost estimates follow the manifest.
+// The manifest is fetched in the background when first needed and again
+// after each Refresh; until then, and whenever a fetch fails, the last
+// good copy or the built-in registry is used. RefreshModels fetches it
+// immediately.
+func WithModelManifest(cfg ModelManifest) Option {
+	return func(c *Client) {
+		if cfg.Refresh <= 0 {
+			cfg.Refresh = DefaultModelManifestRefresh
+		}
+		if cfg.HTTPClient == nil {
+			cfg.HTTPClient = http.DefaultClient
+		}
+		c.modelManifest = &manifestCache{cfg: cfg}
+	}
+}
+
+// RefreshModels fetches the model manifest now
+func (c *Client) RefreshModels(ctx context.Context) error {
+	if c.modelManifest == nil {
+		return nil
+	}
+	return c.modelManifest.refresh(ctx)
+}
+
+// manifestCache holds the last good model manifest, shared by policy views
+type manifestCache struct {
+	cfg ModelManifest
+
+	mu         sync.RWMutex
+	models     map[string]ModelInfo
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+func (m *manifestCache) snapshot() map[string]ModelInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.models
+}
+
+// lookup returns model's manifest entry, starting a background refresh if
+// the manifest is due one
+func (m *manifestCache) lookup(c *Client, model string) (ModelInfo, bool) {
+	m.mu.Lock()
+	if !m.refreshing && time.Since(m.fetchedAt) >= m.cfg.Refresh {
+		m.refreshing = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := m.refresh(ctx); err != nil {
+				c.log(ctx, LogRequest, "model manifest refresh failed", "url", m.cfg.URL, "error", err)
+			}
+		}()
+	}
+	info, ok := m.models[model]
+	m.mu.Unlock()
+	return info, ok
+}
+
+func (m *manifestCache) refresh(ctx context.Context) error {
+	models, err := m.fetch(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshing = false
+	// A failed fetch waits a full interval too, rather than retrying on
+	// every lookup
+	m.fetchedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	m.models = models
+	return nil
+}
+
+func (m *manifestCache) fetch(ctx context.Context) (map[string]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("langmesh: model manifest: status %d", resp.StatusCode)
+	}
+	return parseModelManifest(resp.Body)
+}
+
+// parseModelManifest decodes and checks a manifest, rejecting it whole if
+// any entry is invalid
+func parseModelManifest(r io.Reader) (map[string]ModelInfo, error) {
+	var manifest struct {
+		Models []ModelInfo `json:"models"`
+	}
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("langmesh: model manifest: %w", err)
+	}
+	models := make(map[string]ModelInfo, len(manifest.Models))
+	for i, info := range manifest.Models {
+		switch {
+		case info.ID == "":
+			return nil, fmt.Errorf("langmesh: model manifest: entry %d has no id", i)
+		case info.ContextWindow < 0 || info.MaxOutputTokens < 0 ||
+			info.InputPerMillionUSD < 0 || info.OutputPerMillionUSD < 0:
+			return nil, fmt.Errorf("langmesh: model manifest: %s has a negative limit or price", info.ID)
+		case models[info.ID].ID != "":
+			return nil, fmt.Errorf("langmesh: model manifest: %s is listed twice", info.ID)
+		}
+		info.Available = false
+		models[info.ID] = info
+	}
+	return models, nil
+}
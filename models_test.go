@@ -0,0 +1,108 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestModelInfoBuiltin(t *testing.T) {
+	client := NewClient("test-key")
+	info, ok := client.ModelInfo("gpt-4o")
+	if !ok || info.ContextWindow != 128000 || !info.Vision || !info.Tools || info.InputPerMillionUSD != 2.5 {
+		t.Errorf("gpt-4o = %+v, %v", info, ok)
+	}
+	if info, ok := client.ModelInfo("gpt-4o-2024-08-06"); !ok || info.ID != "gpt-4o-2024-08-06" || info.ContextWindow != 128000 {
+		t.Errorf("snapshot = %+v, %v", info, ok)
+	}
+	if info, ok := client.ModelInfo("gpt-4"); !ok || info.Vision || info.JSONMode {
+		t.Errorf("gpt-4 = %+v", info)
+	}
+	if _, ok := client.ModelInfo("no-such-model"); ok {
+		t.Error("unknown model reported known")
+	}
+}
+
+func TestModelManifest(t *testing.T) {
+	var fetches int32
+	manifest := `{"models":[
+		{"id":"gpt-4o","context_window":128000,"vision":true,"tools":true,"json_mode":true,"input_per_million_usd":2,"output_per_million_usd":8},
+		{"id":"gpt-5","context_window":400000,"vision":true,"tools":true,"input_per_million_usd":1.25,"output_per_million_usd":10}
+	]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(manifest))
+		case "/v1/models":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"object":"list","data":[{"id":"gpt-5","object":"model","owned_by":"openai"},{"id":"ft:custom","object":"model","owned_by":"acme"}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"),
+		WithModelManifest(ModelManifest{URL: srv.URL + "/manifest.json", Refresh: time.Hour}))
+	if err := client.RefreshModels(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	info, ok := client.ModelInfo("gpt-5")
+	if !ok || info.ContextWindow != 400000 {
+		t.Errorf("gpt-5 = %+v, %v", info, ok)
+	}
+	// Manifest prices drive cost estimates
+	if cost := client.EstimateCostUSD("gpt-4o", 1_000_000, 0); cost != 2 {
+		t.Errorf("cost = %v, want manifest price 2", cost)
+	}
+	if _, ok := client.ModelInfo("gpt-4o-mini"); !ok {
+		t.Error("built-in model missing from manifest not found")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1 while fresh", n)
+	}
+
+	models, err := client.ListModelInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if models[0].ID != "gpt-5" || !models[0].Available || models[0].OwnedBy != "openai" || models[0].ContextWindow != 400000 {
+		t.Errorf("first = %+v", models[0])
+	}
+	if models[1].ID != "ft:custom" || !models[1].Available {
+		t.Errorf("second = %+v", models[1])
+	}
+	for _, m := range models[2:] {
+		if m.Available {
+			t.Errorf("%s listed as available", m.ID)
+		}
+	}
+}
+
+func TestModelManifestRejectsInvalid(t *testing.T) {
+	for _, manifest := range []string{
+		`{"models":[{"context_window":1000}]}`,
+		`{"models":[{"id":"a","context_window":-1}]}`,
+		`{"models":[{"id":"a"},{"id":"a"}]}`,
+		`not json`,
+	} {
+		if _, err := parseModelManifest(strings.NewReader(manifest)); err == nil {
+			t.Errorf("%s: expected an error", manifest)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[{"id":"gpt-4o","context_window":-5}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	client := NewClient("test-key", WithModelManifest(ModelManifest{URL: srv.URL}))
+	if err := client.RefreshModels(context.Background()); err == nil {
+		t.Error("expected an invalid manifest to be rejected")
+	}
+	if info, _ := client.ModelInfo("gpt-4o"); info.ContextWindow != 128000 {
+		t.Errorf("built-in entry not kept: %+v", info)
+	}
+}
@@ -0,0 +1,222 @@
+package langmesh
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of a currency in units of 10⁻⁸ of its major unit,
+// which for USD is a millionth of a cent. Costs are priced and added up in
+// Money, so totals over millions of calls are exact where float64 sums
+// drift; the float64 costs in events and reports are converted from it.
+type Money int64
+
+// moneyScale is the number of Money units in one unit of a currency
+const moneyScale = 100_000_000
+
+// MoneyFromFloat converts an amount such as a CostEstimateUSD to Money,
+// rounding to the nearest unit
+func MoneyFromFloat(amount float64) Money {
+	return Money(math.Round(amount * moneyScale))
+}
+
+// Float64 returns the amount in the currency's major unit
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// String formats the amount as a decimal with at least two places and no
+// trailing zeros beyond them, such as "0.0025" or "12.50"
+func (m Money) String() string {
+	sign := ""
+	u := uint64(m)
+	if m < 0 {
+		sign = "-"
+		u = uint64(-m)
+	}
+	frac := fmt.Sprintf("%08d", u%moneyScale)
+	frac = strings.TrimRight(frac, "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return sign + strconv.FormatUint(u/moneyScale, 10) + "." + frac
+}
+
+// RoundingMode is how Round treats an amount between two steps
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds halves to the even step, so rounding errors
+	// cancel out over many amounts
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds halves away from zero
+	RoundHalfUp
+	// RoundDown truncates toward zero
+	RoundDown
+	// RoundUp rounds away from zero, so that no amount is under-reported
+	RoundUp
+)
+
+var roundingModeNames = map[RoundingMode]string{
+	RoundHalfEven: "half_even",
+	RoundHalfUp:   "half_up",
+	RoundDown:     "down",
+	RoundUp:       "up",
+}
+
+// MarshalText writes the mode as in a config file, e.g. "half_even"
+func (r RoundingMode) MarshalText() ([]byte, error) {
+	name, ok := roundingModeNames[r]
+	if !ok {
+		return nil, fmt.Errorf("langmesh: unknown rounding mode %d", int(r))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText reads a mode written by MarshalText
+func (r *RoundingMode) UnmarshalText(text []byte) error {
+	for mode, name := range roundingModeNames {
+		if name == string(text) {
+			*r = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("langmesh: unknown rounding mode %q, want half_even, half_up, down or up", text)
+}
+
+// Round rounds m to decimals places of the currency's major unit, e.g. 2
+// for cents. Decimals of 8 or more leave m as it is.
+func (m Money) Round(decimals int, mode RoundingMode) Money {
+	if decimals >= 8 {
+		return m
+	}
+	step := int64(moneyScale)
+	for i := 0; i < decimals; i++ {
+		step /= 10
+	}
+	v := int64(m)
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	q, r := v/step, v%step
+	switch mode {
+	case RoundUp:
+		if r > 0 {
+			q++
+		}
+	case RoundHalfUp:
+		if 2*r >= step {
+			q++
+		}
+	case RoundHalfEven:
+		if 2*r > step || (2*r == step && q%2 == 1) {
+			q++
+		}
+	}
+	if neg {
+		q = -q
+	}
+	return Money(q * step)
+}
+
+// tokenCost prices tokens at perMillion, in USD per million tokens
+func tokenCost(tokens int, perMillion float64) Money {
+	return Money(math.Round(float64(tokens) * perMillion * (moneyScale / 1_000_000)))
+}
+
+// addUSD adds two dollar amounts in Money, so that running totals kept as
+// float64 stay exact to the Money unit
+func addUSD(a, b float64) float64 {
+	return (MoneyFromFloat(a) + MoneyFromFloat(b)).Float64()
+}
+
+// CurrencyConverter converts an amount in USD to currency, an ISO 4217 code
+// such as "EUR"
+type CurrencyConverter func(usd Money, currency string) (Money, error)
+
+// StaticRates converts with fixed exchange rates, in units of each currency
+// per US dollar, such as {"EUR": 0.92}
+func StaticRates(rates map[string]float64) CurrencyConverter {
+	fixed := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		fixed[strings.ToUpper(code)] = rate
+	}
+	return func(usd Money, currency string) (Money, error) {
+		if strings.EqualFold(currency, "USD") {
+			return usd, nil
+		}
+		rate, ok := fixed[strings.ToUpper(currency)]
+		if !ok {
+			return 0, fmt.Errorf("langmesh: no exchange rate for %s", currency)
+		}
+		return Money(math.Round(float64(usd) * rate)), nil
+	}
+}
+
+// costFormat is how a client reports costs: the currency, besides USD,
+// and the rounding of reported amounts
+type costFormat struct {
+	currency string
+	convert  CurrencyConverter
+	rounded  bool
+	decimals int
+	rounding RoundingMode
+}
+
+// WithCurrency also reports costs in currency, converted from USD with
+// convert: in each event's Cost and Currency, in CostReport and in
+// CallInfo.Cost. Costs are still priced, budgeted and exported in USD.
+func WithCurrency(currency string, convert CurrencyConverter) Option {
+	return func(c *Client) {
+		c.costFormat.currency = strings.ToUpper(currency)
+		c.costFormat.convert = convert
+	}
+}
+
+// WithCostRounding rounds the costs CostReport, CallInfo.Cost and events'
+// converted Cost report to decimals places with mode, after adding them
+// up. Events' CostEstimateUSD keeps full precision, so that totals built
+// from events stay exact.
+func WithCostRounding(decimals int, mode RoundingMode) Option {
+	return func(c *Client) {
+		c.costFormat.rounded = true
+		c.costFormat.decimals = decimals
+		c.costFormat.rounding = mode
+	}
+}
+
+// applyCurrency sets the event's Cost in the WithCurrency currency, or in
+// USD rounded for WithCostRounding. An amount the converter fails on is
+// left out.
+func (c *Client) applyCurrency(event *TelemetryEvent) {
+	if (c.costFormat.convert == nil && !c.costFormat.rounded) || event.Currency != "" {
+		return
+	}
+	if cost, currency, err := c.costFormat.local(MoneyFromFloat(event.CostEstimateUSD)); err == nil {
+		event.Cost, event.Currency = cost, currency
+	}
+}
+
+// round rounds an amount for reporting
+func (f *costFormat) round(amount Money) Money {
+	if !f.rounded {
+		return amount
+	}
+	return amount.Round(f.decimals, f.rounding)
+}
+
+// local converts an amount in USD to the reporting currency and rounds it.
+// Without WithCurrency, the currency is USD.
+func (f *costFormat) local(usd Money) (float64, string, error) {
+	if f.convert == nil {
+		return f.round(usd).Float64(), "USD", nil
+	}
+	amount, err := f.convert(usd, f.currency)
+	if err != nil {
+		return 0, "", err
+	}
+	return f.round(amount).Float64(), f.currency, nil
+}
@@ -0,0 +1,109 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMoneyRound(t *testing.T) {
+	for _, tc := range []struct {
+		amount   float64
+		decimals int
+		mode     RoundingMode
+		want     string
+	}{
+		{0.125, 2, RoundHalfEven, "0.12"},
+		{0.135, 2, RoundHalfEven, "0.14"},
+		{0.125, 2, RoundHalfUp, "0.13"},
+		{-0.125, 2, RoundHalfUp, "-0.13"},
+		{0.12999, 2, RoundDown, "0.12"},
+		{0.12001, 2, RoundUp, "0.13"},
+		{-0.12001, 2, RoundUp, "-0.13"},
+		{0.00000001, 2, RoundUp, "0.01"},
+		{2.5, 0, RoundHalfEven, "2.00"},
+		{0.12345678, 8, RoundDown, "0.12345678"},
+	} {
+		m := MoneyFromFloat(tc.amount)
+		if got := m.Round(tc.decimals, tc.mode).String(); got != tc.want {
+			t.Errorf("%v rounded to %d with mode %d = %s, want %s", tc.amount, tc.decimals, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestCostSumsAreExact(t *testing.T) {
+	client := NewClient("test-key", WithCostRetention(time.Hour))
+	budget := NewBudget(100, 0)
+	var float float64
+	for i := 0; i < 1000; i++ {
+		event := TelemetryEvent{Model: "gpt-4o", Endpoint: "chat.completions", CostEstimateUSD: 0.1}
+		client.costLedger.observe(event)
+		budget.observe(event)
+		float += event.CostEstimateUSD
+	}
+	if float == 100 {
+		t.Fatal("float64 addition no longer drifts; pick another amount")
+	}
+	if total := client.CostReport(time.Hour).Total.CostUSD; total != 100 {
+		t.Errorf("report total = %v, want exactly 100", total)
+	}
+	if spent := budget.Spent(); spent != 100 {
+		t.Errorf("budget spent = %v, want exactly 100", spent)
+	}
+	if err := budget.check(context.Background(), client, chatRequest("hi")); err == nil {
+		t.Error("the budget is spent but did not reject the request")
+	}
+}
+
+func TestWithCurrency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1000,"completion_tokens":1000,"total_tokens":2000}}`))
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithCostRetention(time.Hour),
+		WithModelPricing(map[string]TokenPricing{"gpt-4o": {Input: 2.5, Output: 10}}),
+		WithCurrency("eur", StaticRates(map[string]float64{"EUR": 0.9})),
+		WithCostRounding(2, RoundUp),
+	)
+
+	ctx, info := CaptureCallInfo(context.Background())
+	request := chatRequest("hi")
+	request.Model = "gpt-4o"
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// $0.0125 a call: €0.01125, rounded up for each call but not for the total
+	event := rec.all()[0]
+	if event.CostEstimateUSD != 0.0125 || event.Cost != 0.02 || event.Currency != "EUR" {
+		t.Errorf("event cost = $%v, %v %s", event.CostEstimateUSD, event.Cost, event.Currency)
+	}
+	if cost, currency := info.Cost(); cost != 0.02 || currency != "EUR" || info.CostUSD() != 0.0125 {
+		t.Errorf("info cost = %v %s, $%v", cost, currency, info.CostUSD())
+	}
+	report := client.CostReport(time.Hour)
+	if report.Currency != "EUR" || report.Total.CostUSD != 0.03 || report.Total.Cost != 0.03 || report.ByModel["gpt-4o"].Cost != 0.03 {
+		t.Errorf("report = %s %+v, by model %+v", report.Currency, report.Total, report.ByModel)
+	}
+}
+
+func TestStaticRates(t *testing.T) {
+	convert := StaticRates(map[string]float64{"jpy": 150})
+	if yen, err := convert(MoneyFromFloat(0.5), "JPY"); err != nil || yen.String() != "75.00" {
+		t.Errorf("JPY = %v, %v", yen, err)
+	}
+	if usd, err := convert(MoneyFromFloat(0.5), "USD"); err != nil || usd.String() != "0.50" {
+		t.Errorf("USD = %v, %v", usd, err)
+	}
+	if _, err := convert(MoneyFromFloat(0.5), "GBP"); err == nil {
+		t.Error("a currency without a rate converted")
+	}
+}
@@ -0,0 +1,18 @@
+package langmesh
+
+// Option configures a Client at construction time
+type Option func(*Client)
+
+// WithBaseURL points the client at a different OpenAI-compatible API root.
+// The langmesh proxy, when enabled, still takes precedence.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = url
+	}
+}
+
+// eventObserver receives every telemetry event recorded by the client,
+// whether or not hosted telemetry is enabled
+type eventObserver interface {
+	observe(event TelemetryEvent)
+}
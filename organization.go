@@ -0,0 +1,86 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	organizationHeader = "OpenAI-Organization"
+	projectHeader      = "OpenAI-Project"
+)
+
+// WithOrganization sends org as the OpenAI-Organization header, for
+// accounts in several organizations. KeyPool keys with their own
+// Organization keep it.
+func WithOrganization(org string) Option {
+	return func(c *Client) {
+		c.organization = org
+	}
+}
+
+// WithProject sends project as the OpenAI-Project header, attributing
+// usage to that OpenAI project. Telemetry records the project so spend can
+// be split by it.
+func WithProject(project string) Option {
+	return func(c *Client) {
+		c.project = project
+	}
+}
+
+type organizationKey struct{}
+
+type projectKey struct{}
+
+// ContextWithOrganization overrides the client's organization for calls made
+// with the returned context
+func ContextWithOrganization(ctx context.Context, org string) context.Context {
+	return context.WithValue(ctx, organizationKey{}, org)
+}
+
+// ContextWithProject overrides the client's project for calls made with the
+// returned context
+func ContextWithProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectKey{}, project)
+}
+
+// organizationFor returns the organization and project for calls made with
+// ctx
+func (c *Client) organizationFor(ctx context.Context) (org, project string) {
+	org, project = c.organization, c.project
+	if v, ok := ctx.Value(organizationKey{}).(string); ok {
+		org = v
+	}
+	if v, ok := ctx.Value(projectKey{}).(string); ok {
+		project = v
+	}
+	return org, project
+}
+
+// applyProject copies the project for ctx onto event
+func (c *Client) applyProject(ctx context.Context, event *TelemetryEvent) {
+	_, event.Project = c.organizationFor(ctx)
+}
+
+// organizationTransport sets the organization and project headers on
+// requests to host. An organization already set by a KeyPool key is kept.
+type organizationTransport struct {
+	base   http.RoundTripper
+	host   string
+	client *Client
+}
+
+func (t organizationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	org, project := t.client.organizationFor(req.Context())
+	if req.URL.Host != t.host || (org == "" && project == "") {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if org != "" && req.Header.Get(organizationHeader) == "" {
+		req.Header.Set(organizationHeader, org)
+	}
+	if project != "" {
+		req.Header.Set(projectHeader, project)
+	}
+	return t.base.RoundTrip(req)
+}
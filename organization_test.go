@@ -0,0 +1,87 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newHeaderServer answers chat requests, recording each request's headers
+func newHeaderServer(t *testing.T) (*httptest.Server, func() []http.Header) {
+	t.Helper()
+	var mu sync.Mutex
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1000,"completion_tokens":100,"total_tokens":1100}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]http.Header(nil), headers...)
+	}
+}
+
+func TestOrganizationAndProjectHeaders(t *testing.T) {
+	srv, headers := newHeaderServer(t)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithOrganization("org-main"), WithProject("proj_web"), WithCostRetention(time.Hour))
+
+	ctx := context.Background()
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	batch := ContextWithProject(ContextWithOrganization(ctx, "org-research"), "proj_batch")
+	if _, err := client.CreateChatCompletion(batch, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	h := headers()
+	if h[0].Get("OpenAI-Organization") != "org-main" || h[0].Get("OpenAI-Project") != "proj_web" {
+		t.Errorf("client headers = %v", h[0])
+	}
+	if h[1].Get("OpenAI-Organization") != "org-research" || h[1].Get("OpenAI-Project") != "proj_batch" {
+		t.Errorf("context headers = %v", h[1])
+	}
+	events := rec.all()
+	if events[0].Project != "proj_web" || events[1].Project != "proj_batch" {
+		t.Errorf("projects = %q, %q", events[0].Project, events[1].Project)
+	}
+	report := client.CostReport(time.Hour)
+	if line := report.ByProject["proj_batch"]; line.Requests != 1 || line.CostUSD != events[1].CostEstimateUSD {
+		t.Errorf("ByProject = %+v", report.ByProject)
+	}
+}
+
+func TestOrganizationKeepsKeyPoolOrganization(t *testing.T) {
+	srv, headers := newHeaderServer(t)
+	pool := NewKeyPool(APIKey{Key: "sk-a", Organization: "org-key"})
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithKeyPool(pool),
+		WithOrganization("org-default"), WithProject("proj_web"))
+
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if h := headers()[0]; h.Get("OpenAI-Organization") != "org-key" || h.Get("OpenAI-Project") != "proj_web" {
+		t.Errorf("headers = %v", h)
+	}
+}
+
+func TestNoOrganizationHeadersByDefault(t *testing.T) {
+	srv, headers := newHeaderServer(t)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if h := headers()[0]; h.Get("OpenAI-Organization") != "" || h.Get("OpenAI-Project") != "" {
+		t.Errorf("headers = %v", h)
+	}
+}
@@ -0,0 +1,154 @@
+package langmesh
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Policy is a named bundle of client options, such as an "interactive",
+// "batch", or "regulated" profile, so teams can standardize behavior instead
+// of repeating option lists
+type Policy struct {
+	Name    string
+	Options []Option
+}
+
+// NewPolicy creates a policy applying opts
+func NewPolicy(name string, opts ...Option) Policy {
+	return Policy{Name: name, Options: opts}
+}
+
+// ComposePolicy creates a policy applying each part in order, so later parts
+// override earlier ones
+func ComposePolicy(name string, parts ...Policy) Policy {
+	var opts []Option
+	for _, p := range parts {
+		opts = append(opts, p.Options...)
+	}
+	return Policy{Name: name, Options: opts}
+}
+
+// With returns a copy of p extended with opts
+func (p Policy) With(opts ...Option) Policy {
+	combined := make([]Option, 0, len(p.Options)+len(opts))
+	combined = append(combined, p.Options...)
+	combined = append(combined, opts...)
+	return Policy{Name: p.Name, Options: combined}
+}
+
+// WithPolicy applies p to every request made by the client
+func WithPolicy(p Policy) Option {
+	return func(c *Client) {
+		for _, opt := range p.Options {
+			opt(c)
+		}
+	}
+}
+
+// WithPolicies registers policies that individual requests can select with
+// ContextWithPolicy. A selected policy is layered on top of the client's own
+// options. Telemetry sinks always come from the client; policies cannot add
+// their own.
+func WithPolicies(policies ...Policy) Option {
+	return func(c *Client) {
+		c.policies = append(c.policies, policies...)
+	}
+}
+
+// ContextWithPolicy selects a policy registered with WithPolicies for calls
+// made with the returned context. Unknown names leave the client's defaults in
+// effect.
+func ContextWithPolicy(ctx context.Context, name string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) { c.policy = name })
+}
+
+// PolicyFromContext returns the policy name selected with ContextWithPolicy
+func PolicyFromContext(ctx context.Context) string {
+	carrier := liveCarrier(ctx)
+	if carrier == nil {
+		return ""
+	}
+	return carrier.policy
+}
+
+// policyView returns the client configured for the policy selected on ctx,
+// or nil to use c itself
+func (c *Client) policyView(ctx context.Context) *Client {
+	if view := c.reloader.current(); view != nil {
+		if v := view.policyView(ctx); v != nil {
+			return v
+		}
+		return view
+	}
+	if len(c.policyViews) == 0 {
+		return nil
+	}
+	name := PolicyFromContext(ctx)
+	if name == "" {
+		return nil
+	}
+	return c.policyViews[name]
+}
+
+func (c *Client) buildPolicyViews() {
+	if len(c.policies) == 0 {
+		return
+	}
+	c.policyViews = make(map[string]*Client, len(c.policies))
+	for _, p := range c.policies {
+		c.policyViews[p.Name] = c.derive(p.Options)
+	}
+}
+
+// derive returns a copy of c with opts applied on top. Slices and maps are
+// cloned so options cannot mutate c's configuration, while telemetry sinks
+// and the flush scheduler stay shared.
+func (c *Client) derive(opts []Option) *Client {
+	d := &Client{}
+	*d = *c
+	d.policies = nil
+	d.policyViews = nil
+	d.reloader = nil
+	d.observers = append([]eventObserver(nil), c.observers...)
+	d.guards = append([]requestGuard(nil), c.guards...)
+	d.guardrails = append([]guardrailRule(nil), c.guardrails...)
+	d.transportWrappers = append([]func(http.RoundTripper) http.RoundTripper(nil), c.transportWrappers...)
+	if c.fallbacks != nil {
+		d.fallbacks = make(map[string][]string, len(c.fallbacks))
+		for k, v := range c.fallbacks {
+			d.fallbacks[k] = v
+		}
+	}
+	if c.endpointTimeouts != nil {
+		d.endpointTimeouts = make(map[Endpoint]time.Duration, len(c.endpointTimeouts))
+		for k, v := range c.endpointTimeouts {
+			d.endpointTimeouts[k] = v
+		}
+	}
+	if c.tags != nil {
+		d.tags = make(map[string]string, len(c.tags))
+		for k, v := range c.tags {
+			d.tags[k] = v
+		}
+	}
+	if c.logLevels != nil {
+		d.logLevels = make(map[LogEvent]slog.Level, len(c.logLevels))
+		for k, v := range c.logLevels {
+			d.logLevels[k] = v
+		}
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.sinks = c.sinks
+	d.telemetryEnabled = c.telemetryEnabled
+	if d.strict && d.configErr == nil {
+		d.configErr = d.checkConfig()
+	}
+	d.Client = d.newOpenAIClient()
+	return d
+}
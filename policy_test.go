@@ -0,0 +1,43 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestPolicySelectedPerRequest(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+
+	exhausted := NewBudget(0, time.Hour)
+	regulated := NewPolicy("regulated", WithBudget(exhausted))
+	batch := ComposePolicy("batch", NewPolicy("slow", WithEndpointTimeout(EndpointChat, time.Minute)))
+
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec), WithPolicies(regulated, batch))
+	req := openai.ChatCompletionRequest{Model: "gpt-4o"}
+
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("default request: %v", err)
+	}
+	if _, err := client.CreateChatCompletion(ContextWithPolicy(context.Background(), "batch"), req); err != nil {
+		t.Fatalf("batch request: %v", err)
+	}
+	_, err := client.CreateChatCompletion(ContextWithPolicy(context.Background(), "regulated"), req)
+	if !errors.Is(err, ErrGuardRejected) {
+		t.Fatalf("regulated request should hit its budget, got %v", err)
+	}
+
+	if *calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", *calls)
+	}
+	if n := len(rec.all()); n != 3 {
+		t.Errorf("policy views must share the client's observers, got %d events", n)
+	}
+	if len(client.guards) != 0 || client.endpointTimeouts != nil {
+		t.Errorf("policy options leaked into the base client")
+	}
+}
@@ -0,0 +1,249 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrTemplateNotFound is returned when a prompt template or version is not
+// registered
+var ErrTemplateNotFound = errors.New("langmesh: prompt template not found")
+
+// TemplateSyntax selects how prompt template messages are parsed
+type TemplateSyntax int
+
+const (
+	// GoTemplate parses messages with text/template, e.g. "Hello {{.name}}"
+	GoTemplate TemplateSyntax = iota
+	// MustacheTemplate substitutes mustache-style variables, e.g.
+	// "Hello {{name}}", from a map or struct
+	MustacheTemplate
+)
+
+// PromptTemplate is a versioned set of chat messages whose contents are
+// templates
+type PromptTemplate struct {
+	Name     string
+	Version  string
+	Syntax   TemplateSyntax
+	Messages []openai.ChatCompletionMessage
+}
+
+// RenderedPrompt is the output of rendering a template
+type RenderedPrompt struct {
+	Name     string
+	Version  string
+	Messages []openai.ChatCompletionMessage
+}
+
+// PromptRegistry stores prompt templates by name and version
+type PromptRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]*compiledPrompt
+	latest    map[string]string
+	versions  map[string][]string
+}
+
+type compiledPrompt struct {
+	template PromptTemplate
+	render   []func(vars any) (string, error)
+}
+
+// NewPromptRegistry creates an empty registry
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{
+		templates: make(map[string]map[string]*compiledPrompt),
+		latest:    make(map[string]string),
+		versions:  make(map[string][]string),
+	}
+}
+
+// Register parses t and adds it to the registry. The most recently
+// registered version of a name is its latest. Registering an existing name
+// and version replaces it.
+func (r *PromptRegistry) Register(t PromptTemplate) error {
+	if t.Name == "" || t.Version == "" {
+		return fmt.Errorf("langmesh: prompt template needs a name and version")
+	}
+	compiled := &compiledPrompt{template: t}
+	for i, msg := range t.Messages {
+		render, err := compileMessage(t, i, msg.Content)
+		if err != nil {
+			return err
+		}
+		compiled.render = append(compiled.render, render)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates[t.Name] == nil {
+		r.templates[t.Name] = make(map[string]*compiledPrompt)
+	}
+	if _, exists := r.templates[t.Name][t.Version]; !exists {
+		r.versions[t.Name] = append(r.versions[t.Name], t.Version)
+	}
+	r.templates[t.Name][t.Version] = compiled
+	r.latest[t.Name] = t.Version
+	return nil
+}
+
+// Versions lists the registered versions of name in registration order
+func (r *PromptRegistry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.versions[name]...)
+}
+
+// Render renders version of the named template with vars. An empty version
+// selects the latest.
+func (r *PromptRegistry) Render(name, version string, vars any) (RenderedPrompt, error) {
+	r.mu.RLock()
+	if version == "" {
+		version = r.latest[name]
+	}
+	compiled := r.templates[name][version]
+	r.mu.RUnlock()
+	if compiled == nil {
+		return RenderedPrompt{}, fmt.Errorf("%w: %s@%s", ErrTemplateNotFound, name, version)
+	}
+
+	out := RenderedPrompt{Name: name, Version: version}
+	for i, render := range compiled.render {
+		content, err := render(vars)
+		if err != nil {
+			return RenderedPrompt{}, fmt.Errorf("langmesh: render %s@%s message %d: %w", name, version, i, err)
+		}
+		msg := compiled.template.Messages[i]
+		msg.Content = content
+		out.Messages = append(out.Messages, msg)
+	}
+	return out, nil
+}
+
+// Apply renders the template and prepends its messages to request. An empty
+// version selects the one chosen by an experiment variant assigned on ctx,
+// or else the latest. The returned context records the template name and
+// version in the telemetry of calls made with it.
+func (r *PromptRegistry) Apply(
+	ctx context.Context,
+	name, version string,
+	vars any,
+	request openai.ChatCompletionRequest,
+) (context.Context, openai.ChatCompletionRequest, error) {
+	if version == "" {
+		version = experimentPromptVersion(ctx)
+	}
+	rendered, err := r.Render(name, version, vars)
+	if err != nil {
+		return ctx, request, err
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(rendered.Messages)+len(request.Messages))
+	messages = append(messages, rendered.Messages...)
+	request.Messages = append(messages, request.Messages...)
+	return ContextWithPromptTemplate(ctx, rendered.Name, rendered.Version), request, nil
+}
+
+// promptRef identifies the template a request was rendered from
+type promptRef struct {
+	name    string
+	version string
+}
+
+// ContextWithPromptTemplate records that calls made with the returned context
+// use the given template version
+func ContextWithPromptTemplate(ctx context.Context, name, version string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.prompt = promptRef{name: name, version: version}
+	})
+}
+
+// applyPrompt copies the prompt template on ctx onto event
+func applyPrompt(ctx context.Context, event *TelemetryEvent) {
+	carrier := carrierFrom(ctx)
+	if carrier == nil {
+		return
+	}
+	event.PromptTemplate = carrier.prompt.name
+	event.PromptVersion = carrier.prompt.version
+}
+
+func compileMessage(t PromptTemplate, i int, source string) (func(vars any) (string, error), error) {
+	switch t.Syntax {
+	case GoTemplate:
+		tmpl, err := template.New(fmt.Sprintf("%s@%s/%d", t.Name, t.Version, i)).
+			Option("missingkey=error").
+			Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("langmesh: parse %s@%s message %d: %w", t.Name, t.Version, i, err)
+		}
+		return func(vars any) (string, error) {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, vars); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		}, nil
+	case MustacheTemplate:
+		return func(vars any) (string, error) { return renderMustache(source, vars) }, nil
+	}
+	return nil, fmt.Errorf("langmesh: prompt template %s@%s has unknown syntax %d", t.Name, t.Version, t.Syntax)
+}
+
+var mustacheVar = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.]+)\s*\}\}`)
+
+// renderMustache replaces each {{path}} with the value found by following
+// the dot-separated path through maps and struct fields in vars
+func renderMustache(source string, vars any) (string, error) {
+	var missing []string
+	out := mustacheVar.ReplaceAllStringFunc(source, func(m string) string {
+		path := mustacheVar.FindStringSubmatch(m)[1]
+		value, ok := lookupPath(reflect.ValueOf(vars), strings.Split(path, "."))
+		if !ok {
+			missing = append(missing, path)
+			return m
+		}
+		return fmt.Sprint(value)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing variables: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func lookupPath(v reflect.Value, path []string) (any, bool) {
+	for _, key := range path {
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		case reflect.Struct:
+			v = v.FieldByName(key)
+		default:
+			return nil, false
+		}
+		if !v.IsValid() {
+			return nil, false
+		}
+	}
+	if !v.CanInterface() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
@@ -0,0 +1,110 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestPromptRegistryVersions(t *testing.T) {
+	r := NewPromptRegistry()
+	for _, version := range []string{"v1", "v2"} {
+		err := r.Register(PromptTemplate{
+			Name:    "greet",
+			Version: version,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: version + ": greet {{.Name}}"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := r.Render("greet", "", map[string]string{"Name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "v2" || latest.Messages[0].Content != "v2: greet Ada" {
+		t.Errorf("latest = %+v", latest)
+	}
+	pinned, err := r.Render("greet", "v1", map[string]string{"Name": "Ada"})
+	if err != nil || pinned.Messages[0].Content != "v1: greet Ada" {
+		t.Errorf("pinned = %+v, %v", pinned, err)
+	}
+	if got := r.Versions("greet"); len(got) != 2 || got[0] != "v1" {
+		t.Errorf("Versions = %v", got)
+	}
+
+	if _, err := r.Render("greet", "v3", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("err = %v, want ErrTemplateNotFound", err)
+	}
+	if _, err := r.Render("greet", "", map[string]string{}); err == nil {
+		t.Error("missing variable rendered without error")
+	}
+}
+
+func TestMustacheTemplate(t *testing.T) {
+	r := NewPromptRegistry()
+	err := r.Register(PromptTemplate{
+		Name:     "summary",
+		Version:  "1",
+		Syntax:   MustacheTemplate,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Summarize {{ doc.title }} for {{user}}"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]any{"user": "Ada", "doc": struct {
+		title string
+		Title string
+	}{Title: "Q3"}}
+	if _, err := r.Render("summary", "", vars); err == nil || !strings.Contains(err.Error(), "doc.title") {
+		t.Errorf("unexported field rendered: %v", err)
+	}
+	vars["doc"] = map[string]string{"title": "Q3"}
+	out, err := r.Render("summary", "", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Messages[0].Content; got != "Summarize Q3 for Ada" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestPromptApplyRecordsTelemetry(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	r := NewPromptRegistry()
+	if err := r.Register(PromptTemplate{
+		Name:     "support",
+		Version:  "2024-06",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You help {{.}}"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}
+	ctx, req, err := r.Apply(context.Background(), "support", "", "Acme", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Content != "You help Acme" {
+		t.Fatalf("messages = %+v", req.Messages)
+	}
+	if _, err := client.CreateChatCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	event := rec.all()[0]
+	if event.PromptTemplate != "support" || event.PromptVersion != "2024-06" {
+		t.Errorf("template not recorded: %q@%q", event.PromptTemplate, event.PromptVersion)
+	}
+}
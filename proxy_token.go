@@ -0,0 +1,156 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyTokenRefresh is how long before expiry a proxy token is
+// replaced unless configured otherwise
+const DefaultProxyTokenRefresh = 30 * time.Second
+
+// ProxyToken is a short-lived credential for the langmesh proxy
+type ProxyToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// ProxyTokenExchange configures WithProxyTokenExchange. Zero fields take
+// the defaults.
+type ProxyTokenExchange struct {
+	// URL is the token endpoint, langmesh_TOKEN_ENDPOINT or langmesh's by
+	// default. It is sent a POST authorized with the langmesh API key and
+	// answers with an OAuth 2.0 token response: access_token and
+	// expires_in.
+	URL string
+	// Fetch replaces the exchange, e.g. to get tokens from your own STS
+	Fetch func(ctx context.Context) (ProxyToken, error)
+	// RefreshBefore is how long before expiry a token is replaced
+	RefreshBefore time.Duration
+	// HTTPClient sends the exchange; by default it uses the client's
+	// transport
+	HTTPClient *http.Client
+}
+
+// WithProxyTokenExchange authenticates to the langmesh proxy with
+// short-lived tokens instead of forwarding API keys: the client exchanges
+// its langmesh API key for a token, sends only the token to the proxy, and
+// replaces it before it expires. The OpenAI key never leaves the process;
+// the proxy uses the keys configured for your langmesh account. It has no
+// effect unless the proxy is enabled.
+func WithProxyTokenExchange(cfg ProxyTokenExchange) Option {
+	return func(c *Client) {
+		if cfg.URL == "" {
+			cfg.URL = langmeshTokenURL
+		}
+		if cfg.RefreshBefore <= 0 {
+			cfg.RefreshBefore = DefaultProxyTokenRefresh
+		}
+		c.proxyTokens = &proxyTokenSource{cfg: cfg}
+	}
+}
+
+// proxyTokenSource caches the current proxy token, shared by policy views
+type proxyTokenSource struct {
+	cfg ProxyTokenExchange
+
+	mu      sync.Mutex
+	current ProxyToken
+}
+
+// token returns a token valid for at least RefreshBefore, fetching one if
+// needed. Concurrent callers wait for a single fetch.
+func (s *proxyTokenSource) token(ctx context.Context, langmeshKey string, base http.RoundTripper) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.Token != "" && time.Until(s.current.ExpiresAt) > s.cfg.RefreshBefore {
+		return s.current.Token, nil
+	}
+	fetch := s.cfg.Fetch
+	if fetch == nil {
+		fetch = func(ctx context.Context) (ProxyToken, error) { return s.exchange(ctx, langmeshKey, base) }
+	}
+	token, err := fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("langmesh: proxy token exchange: %w", err)
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("langmesh: proxy token exchange returned no token")
+	}
+	s.current = token
+	return token.Token, nil
+}
+
+// invalidate drops token if it is still the cached one, after the proxy
+// rejected it
+func (s *proxyTokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.Token == token {
+		s.current = ProxyToken{}
+	}
+}
+
+func (s *proxyTokenSource) exchange(ctx context.Context, langmeshKey string, base http.RoundTripper) (ProxyToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return ProxyToken{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+langmeshKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := s.cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Transport: base, Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProxyToken{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return ProxyToken{}, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ProxyToken{}, err
+	}
+	return ProxyToken{Token: body.AccessToken, ExpiresAt: time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)}, nil
+}
+
+// proxyTokenTransport authorizes requests for the proxy at host with a
+// proxy token, removing the API key go-openai set
+type proxyTokenTransport struct {
+	base        http.RoundTripper
+	host        string
+	langmeshKey string
+	tokens      *proxyTokenSource
+}
+
+func (t *proxyTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.host != "" && req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.tokens.token(req.Context(), t.langmeshKey, t.base)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Del("X-langmesh-API-Key")
+	req.Header.Del("X-langmesh-Original-API-Key")
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// Revoked early; the next request fetches a new token
+		t.tokens.invalidate(token)
+	}
+	return resp, err
+}
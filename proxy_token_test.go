@@ -0,0 +1,110 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withProxy routes new clients through a fake langmesh proxy at srv for the
+// rest of the test
+func withProxy(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	enabled, key, base, telemetry := langmeshProxyEnabled, langmeshAPIKey, langmeshBaseURL, langmeshTelemetryURL
+	t.Cleanup(func() {
+		langmeshProxyEnabled, langmeshAPIKey, langmeshBaseURL, langmeshTelemetryURL = enabled, key, base, telemetry
+	})
+	langmeshProxyEnabled, langmeshAPIKey = true, "lm-key"
+	langmeshBaseURL, langmeshTelemetryURL = srv.URL+"/v1/openai", srv.URL+"/v1/telemetry"
+}
+
+func TestProxyTokenExchange(t *testing.T) {
+	var mu sync.Mutex
+	var auth []string
+	var exchanges int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			n := atomic.AddInt32(&exchanges, 1)
+			if r.Header.Get("Authorization") != "Bearer lm-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"jwt-%d","token_type":"Bearer","expires_in":300}`, n)
+		case strings.HasPrefix(r.URL.Path, "/v1/openai"):
+			mu.Lock()
+			auth = append(auth, r.Header.Get("Authorization")+"|"+r.Header.Get("X-langmesh-Original-API-Key"))
+			n := len(auth)
+			mu.Unlock()
+			if n == 2 {
+				// Revoked after its first use
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":{"message":"token revoked"}}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	withProxy(t, srv)
+
+	client := NewClient("sk-openai", withRecorder(&eventRecorder{}),
+		WithProxyTokenExchange(ProxyTokenExchange{URL: srv.URL + "/token"}))
+	ctx := context.Background()
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err == nil {
+		t.Fatal("expected the revoked token to be rejected")
+	}
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"Bearer jwt-1|", "Bearer jwt-1|", "Bearer jwt-2|"}
+	if fmt.Sprint(auth) != fmt.Sprint(want) {
+		t.Errorf("proxy saw %q, want %q", auth, want)
+	}
+	for _, a := range auth {
+		if strings.Contains(a, "sk-openai") {
+			t.Errorf("OpenAI key forwarded: %q", a)
+		}
+	}
+	if n := atomic.LoadInt32(&exchanges); n != 2 {
+		t.Errorf("exchanges = %d, want 2", n)
+	}
+}
+
+func TestProxyTokenRefreshesBeforeExpiry(t *testing.T) {
+	var fetches int32
+	source := &proxyTokenSource{cfg: ProxyTokenExchange{
+		RefreshBefore: time.Minute,
+		Fetch: func(context.Context) (ProxyToken, error) {
+			n := atomic.AddInt32(&fetches, 1)
+			// Expires inside the refresh window, so every call refreshes
+			return ProxyToken{Token: fmt.Sprintf("t%d", n), ExpiresAt: time.Now().Add(30 * time.Second)}, nil
+		},
+	}}
+	for i := 1; i <= 2; i++ {
+		token, err := source.token(context.Background(), "", nil)
+		if err != nil || token != fmt.Sprintf("t%d", i) {
+			t.Errorf("token = %q, %v", token, err)
+		}
+	}
+
+	failing := &proxyTokenSource{cfg: ProxyTokenExchange{
+		Fetch: func(context.Context) (ProxyToken, error) { return ProxyToken{}, nil },
+	}}
+	if _, err := failing.token(context.Background(), "", nil); err == nil {
+		t.Error("expected an error for an empty token")
+	}
+}
@@ -0,0 +1,175 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultQualityJudgeModel is the judge WithQualityScoring uses unless
+	// configured otherwise
+	DefaultQualityJudgeModel = "gpt-4o-mini"
+	// DefaultQualityRubric is what the judge scores answers against unless
+	// configured otherwise
+	DefaultQualityRubric = "The answer is correct, relevant to the request, complete and clearly written."
+	// DefaultQualityTimeout bounds each scoring
+	DefaultQualityTimeout = 30 * time.Second
+	// DefaultQualityMaxInFlight caps concurrent scorings
+	DefaultQualityMaxInFlight = 4
+)
+
+// QualityScoring configures WithQualityScoring. Zero fields take the
+// defaults.
+type QualityScoring struct {
+	// Model is the judge model; a cheap one keeps scoring affordable
+	Model  string
+	Rubric string
+	// SampleRate is the fraction of chat completions scored, in (0, 1];
+	// zero scores every completion
+	SampleRate float64
+	Timeout    time.Duration
+	// MaxInFlight caps concurrent scorings; completions sampled while it
+	// is reached are recorded unscored
+	MaxInFlight int
+	// Scorer replaces the judge, e.g. with a heuristic or a custom grading
+	// prompt
+	Scorer func(ctx context.Context, request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) (QualityScore, error)
+}
+
+// QualityScore is the judged quality of a completion
+type QualityScore struct {
+	// Score is in [0, 1]
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason,omitempty"`
+	// Judge is the model that scored the completion
+	Judge string `json:"judge,omitempty"`
+	// CostUSD is the estimated cost of the judge call
+	CostUSD float64 `json:"cost_usd,omitempty"`
+	// Error is set instead of a score when scoring failed
+	Error string `json:"error,omitempty"`
+}
+
+// WithQualityScoring has a judge model score a sample of chat completions
+// against a rubric, attaching the result to their telemetry events as
+// Quality, so answer quality can be tracked over time. Scoring runs in the
+// background and never delays the response; a scored call's event is
+// recorded once its score is in, or scoring has failed or timed out.
+// Judge calls are priced on the event, not recorded as calls of their own.
+func WithQualityScoring(cfg QualityScoring) Option {
+	return func(c *Client) {
+		if cfg.Model == "" {
+			cfg.Model = DefaultQualityJudgeModel
+		}
+		if cfg.Rubric == "" {
+			cfg.Rubric = DefaultQualityRubric
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultQualityTimeout
+		}
+		if cfg.MaxInFlight <= 0 {
+			cfg.MaxInFlight = DefaultQualityMaxInFlight
+		}
+		c.quality = &qualityScorer{cfg: cfg, slots: make(chan struct{}, cfg.MaxInFlight)}
+	}
+}
+
+type qualityScorer struct {
+	cfg   QualityScoring
+	slots chan struct{}
+}
+
+// scoreQuality starts scoring a sampled completion, taking over recording
+// its event. It reports false, leaving the event to the caller, if the
+// completion is not scored.
+func (c *Client) scoreQuality(
+	ctx context.Context,
+	event TelemetryEvent,
+	request openai.ChatCompletionRequest,
+	resp openai.ChatCompletionResponse,
+) bool {
+	q := c.quality
+	if q == nil || len(resp.Choices) == 0 {
+		return false
+	}
+	if rate := q.cfg.SampleRate; rate > 0 && rate < 1 && !sampledIn(event.RequestID, rate) {
+		return false
+	}
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		c.log(ctx, LogRequest, "quality scoring skipped, too many in flight", "request_id", event.RequestID)
+		return false
+	}
+
+	// The caller's CallInfo is complete when the call returns, not once
+	// the judge has scored it
+	event.callInfo.finish(&event)
+	event.callInfo = nil
+	ctx = backgroundContext(ctx)
+	c.goroutine("quality", func() {
+		defer func() { <-q.slots }()
+		ctx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+		score, err := q.score(ctx, c, request, resp)
+		if err != nil {
+			score.Error = err.Error()
+		}
+		event.Quality = &score
+		c.recordTelemetry(event)
+	})
+	return true
+}
+
+func (q *qualityScorer) score(
+	ctx context.Context,
+	c *Client,
+	request openai.ChatCompletionRequest,
+	resp openai.ChatCompletionResponse,
+) (QualityScore, error) {
+	if q.cfg.Scorer != nil {
+		return q.cfg.Scorer(ctx, request, resp)
+	}
+	score := QualityScore{Judge: q.cfg.Model}
+	ctx, _ = withCallState(ctx, newRequestID())
+	judged, err := c.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: q.cfg.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: qualityJudgeInstructions},
+			{Role: openai.ChatMessageRoleUser, Content: qualityJudgePrompt(q.cfg.Rubric, request, resp)},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return score, err
+	}
+	score.CostUSD = c.estimateCost(q.cfg.Model, judged.Usage.PromptTokens, judged.Usage.CompletionTokens)
+	if len(judged.Choices) == 0 {
+		return score, errors.New("langmesh: quality judge returned no choices")
+	}
+	var verdict struct {
+		Score  *float64 `json:"score"`
+		Reason string   `json:"reason"`
+	}
+	content := judged.Choices[0].Message.Content
+	if err := json.Unmarshal([]byte(content), &verdict); err != nil || verdict.Score == nil {
+		return score, fmt.Errorf("langmesh: unreadable quality verdict %q", truncate(content, 200))
+	}
+	score.Score = math.Min(math.Max(*verdict.Score/10, 0), 1)
+	score.Reason = verdict.Reason
+	return score, nil
+}
+
+const qualityJudgeInstructions = `You are monitoring the quality of an AI assistant's answers. ` +
+	`Score the final answer against the rubric. ` +
+	`Reply with a JSON object: {"score": <integer 0-10>, "reason": "<one sentence>"}.`
+
+func qualityJudgePrompt(rubric string, request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) string {
+	return fmt.Sprintf("Rubric:\n%s\n\nConversation:\n%s\nAnswer to score:\n%s",
+		rubric, renderMessages(request.Messages), resp.Choices[0].Message.Content)
+}
@@ -0,0 +1,107 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newJudgeServer answers the judge model with verdict and other models
+// with "Paris"
+func newJudgeServer(t *testing.T, verdict string) (*httptest.Server, chan openai.ChatCompletionRequest) {
+	t.Helper()
+	judged := make(chan openai.ChatCompletionRequest, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		content := "Paris"
+		if req.Model == "judge" {
+			content = verdict
+			judged <- req
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"c1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":100,"completion_tokens":10,"total_tokens":110}}`, req.Model, content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, judged
+}
+
+func TestQualityScoringAttachesJudgeScore(t *testing.T) {
+	srv, judged := newJudgeServer(t, `{"score": 9, "reason": "accurate"}`)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithQualityScoring(QualityScoring{Model: "judge", Rubric: "Names the right city"}))
+
+	ctx, info := CaptureCallInfo(context.Background())
+	resp, err := client.CreateChatCompletion(ctx, chatRequest("Capital of France?"))
+	if err != nil || resp.Choices[0].Message.Content != "Paris" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	primaryID := info.RequestID()
+
+	events := waitForEvents(t, rec, 1)
+	q := events[0].Quality
+	if events[0].Model != "gpt-4o-mini" || q == nil || q.Score != 0.9 || q.Reason != "accurate" || q.Judge != "judge" {
+		t.Fatalf("event = %+v, quality = %+v", events[0], q)
+	}
+	req := <-judged
+	prompt := req.Messages[1].Content
+	if !strings.Contains(prompt, "Names the right city") || !strings.Contains(prompt, "user: Capital of France?") ||
+		!strings.HasSuffix(prompt, "Paris") || req.ResponseFormat == nil {
+		t.Errorf("judge request = %+v", req)
+	}
+	if info.RequestID() != primaryID {
+		t.Error("judge call overwrote the caller's CallInfo")
+	}
+}
+
+func TestQualityScoringRecordsFailures(t *testing.T) {
+	srv, _ := newJudgeServer(t, "looks good to me")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithQualityScoring(QualityScoring{Model: "judge"}))
+
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, 1)
+	if q := events[0].Quality; q == nil || q.Error == "" || q.Score != 0 || q.CostUSD <= 0 {
+		t.Errorf("quality = %+v", q)
+	}
+}
+
+func TestQualityScoringCustomScorer(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+	scored := 0
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithQualityScoring(QualityScoring{
+			SampleRate: 0.5,
+			Scorer: func(context.Context, openai.ChatCompletionRequest, openai.ChatCompletionResponse) (QualityScore, error) {
+				return QualityScore{Score: 1}, nil
+			},
+		}))
+
+	for i := 0; i < 40; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range waitForEvents(t, rec, 40) {
+		if e.Quality != nil {
+			if e.Quality.Score != 1 {
+				t.Errorf("quality = %+v", e.Quality)
+			}
+			scored++
+		}
+	}
+	if scored == 0 || scored == 40 {
+		t.Errorf("scored %d of 40 at rate 0.5", scored)
+	}
+}
@@ -0,0 +1,296 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// GuardReasonQuotaExceeded is the GuardError reason for a user over quota
+const GuardReasonQuotaExceeded GuardReason = "quota_exceeded"
+
+// quotaBuckets is how many sub-windows a quota's sliding window is counted
+// in, or fewer for windows under a minute
+const quotaBuckets = 60
+
+// Quota limits one user's requests and tokens over a sliding window. A zero
+// limit is not enforced.
+type Quota struct {
+	Requests int64
+	Tokens   int64
+	Window   time.Duration
+}
+
+// bucketSize is the width of the quota's sub-windows, at least a second
+func (q Quota) bucketSize() time.Duration {
+	return max(q.Window/quotaBuckets, time.Second)
+}
+
+// buckets is how many sub-windows cover the quota's window. Quotas with the
+// same bucket size share counters and differ only in how many they sum.
+func (q Quota) buckets() int64 {
+	size := q.bucketSize()
+	return max(int64((q.Window+size-1)/size), 1)
+}
+
+// QuotaStore holds quota counters, so one store can be shared by every
+// process using an API key. Keys are opaque strings.
+type QuotaStore interface {
+	// Add increments key by n, expiring it ttl after it was created
+	Add(ctx context.Context, key string, n int64, ttl time.Duration) error
+	// Get returns the value of each key, zero for missing keys
+	Get(ctx context.Context, keys []string) ([]int64, error)
+}
+
+// QuotaUsage is a user's consumption of one quota
+type QuotaUsage struct {
+	Quota    Quota
+	Requests int64
+	Tokens   int64
+	// ResetAt is when the oldest counted use leaves the window
+	ResetAt time.Time
+}
+
+// QuotaManager enforces per-user quotas, for a backend sharing one API key
+// fairly between its end users. Users are identified by ContextWithUser;
+// requests without a user are not limited. Quotas are checked before chat
+// requests and every call's usage is counted after it finishes.
+type QuotaManager struct {
+	store  QuotaStore
+	quotas []Quota
+	// Limits overrides the quotas for particular users, e.g. by plan. A nil
+	// result falls back to the manager's quotas.
+	Limits func(user string) []Quota
+	prefix string
+	now    func() time.Time
+}
+
+// NewQuotaManager creates a manager enforcing quotas, keeping counters in
+// store, or in memory if store is nil
+func NewQuotaManager(store QuotaStore, quotas ...Quota) *QuotaManager {
+	if store == nil {
+		store = NewMemoryQuotaStore()
+	}
+	return &QuotaManager{
+		store:  store,
+		quotas: quotas,
+		prefix: "langmesh:quota:",
+		now:    time.Now,
+	}
+}
+
+// WithQuotaManager rejects chat requests from users over quota with a
+// GuardError carrying GuardReasonQuotaExceeded. The manager may be shared
+// between clients.
+func WithQuotaManager(q *QuotaManager) Option {
+	return func(c *Client) {
+		c.guards = append(c.guards, q)
+		c.observers = append(c.observers, q)
+	}
+}
+
+func (q *QuotaManager) quotasFor(user string) []Quota {
+	if q.Limits != nil {
+		if quotas := q.Limits(user); quotas != nil {
+			return quotas
+		}
+	}
+	return q.quotas
+}
+
+func (q *QuotaManager) key(user, kind string, size time.Duration, bucket int64) string {
+	return q.prefix + user + ":" + kind + ":" + strconv.FormatInt(int64(size/time.Second), 10) + ":" +
+		strconv.FormatInt(bucket, 10)
+}
+
+// Usage returns user's consumption of each of their quotas
+func (q *QuotaManager) Usage(ctx context.Context, user string) ([]QuotaUsage, error) {
+	quotas := q.quotasFor(user)
+	out := make([]QuotaUsage, 0, len(quotas))
+	now := q.now()
+	for _, quota := range quotas {
+		size, n := quota.bucketSize(), quota.buckets()
+		current := now.UnixNano() / int64(size)
+		keys := make([]string, 0, 2*n)
+		for b := current - n + 1; b <= current; b++ {
+			keys = append(keys, q.key(user, "r", size, b), q.key(user, "t", size, b))
+		}
+		values, err := q.store.Get(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		usage := QuotaUsage{Quota: quota}
+		for i := 0; i+1 < len(values); i += 2 {
+			if usage.ResetAt.IsZero() && (values[i] > 0 || values[i+1] > 0) {
+				oldest := current - n + 1 + int64(i/2)
+				usage.ResetAt = time.Unix(0, (oldest+n)*int64(size))
+			}
+			usage.Requests += values[i]
+			usage.Tokens += values[i+1]
+		}
+		out = append(out, usage)
+	}
+	return out, nil
+}
+
+// check rejects requests from users at any of their limits. A store that
+// cannot be read lets requests through rather than failing them all.
+func (q *QuotaManager) check(ctx context.Context, c *Client, _ openai.ChatCompletionRequest) error {
+	return q.checkUser(ctx, c, ScopeFrom(ctx).User)
+}
+
+func (q *QuotaManager) checkCost(ctx context.Context, c *Client, _ string, _, _ int) error {
+	return q.checkUser(ctx, c, ScopeFrom(ctx).User)
+}
+
+func (q *QuotaManager) checkUser(ctx context.Context, c *Client, user string) error {
+	if user == "" {
+		return nil
+	}
+	usages, err := q.Usage(ctx, user)
+	if err != nil {
+		c.log(ctx, LogBudget, "quota store unavailable", "user", user, "error", err)
+		return nil
+	}
+	for _, u := range usages {
+		var violation string
+		switch {
+		case u.Quota.Requests > 0 && u.Requests >= u.Quota.Requests:
+			violation = fmt.Sprintf("%d of %d requests per %s", u.Requests, u.Quota.Requests, u.Quota.Window)
+		case u.Quota.Tokens > 0 && u.Tokens >= u.Quota.Tokens:
+			violation = fmt.Sprintf("%d of %d tokens per %s", u.Tokens, u.Quota.Tokens, u.Quota.Window)
+		default:
+			continue
+		}
+		return &GuardError{
+			Reason:    GuardReasonQuotaExceeded,
+			Guard:     "quota",
+			User:      user,
+			Violation: violation,
+			ResetAt:   u.ResetAt,
+		}
+	}
+	return nil
+}
+
+func (q *QuotaManager) observe(event TelemetryEvent) {
+	q.count(event, event.User)
+}
+
+// count adds event's request and tokens to user's usage
+func (q *QuotaManager) count(event TelemetryEvent, user string) {
+	if user == "" || event.Heartbeat || event.ErrorClass == "GuardRejected" || event.ErrorClass == "InvalidRequest" {
+		return
+	}
+	ctx := context.Background()
+	now := q.now()
+	// Quotas sharing a bucket size share counters, which must live as long
+	// as the widest of them reads
+	spans := make(map[time.Duration]int64)
+	for _, quota := range q.quotasFor(user) {
+		size := quota.bucketSize()
+		spans[size] = max(spans[size], quota.buckets())
+	}
+	for size, n := range spans {
+		bucket := now.UnixNano() / int64(size)
+		ttl := size * time.Duration(n+1)
+		// Failures only under-count; the next check reads what did land
+		_ = q.store.Add(ctx, q.key(user, "r", size, bucket), 1, ttl)
+		if tokens := int64(event.TokenUsage.TotalTokens); tokens > 0 {
+			_ = q.store.Add(ctx, q.key(user, "t", size, bucket), tokens, ttl)
+		}
+	}
+}
+
+type quotaEntry struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryQuotaStore is a QuotaStore for a single process
+type MemoryQuotaStore struct {
+	mu      sync.Mutex
+	entries map[string]quotaEntry
+	adds    int
+	now     func() time.Time
+}
+
+// NewMemoryQuotaStore creates an empty in-memory store
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{entries: make(map[string]quotaEntry), now: time.Now}
+}
+
+// Add increments key by n
+func (s *MemoryQuotaStore) Add(_ context.Context, key string, n int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	// Sweep expired counters every so often rather than on every add
+	if s.adds++; s.adds%1024 == 0 {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	e, ok := s.entries[key]
+	if !ok || now.After(e.expires) {
+		e = quotaEntry{expires: now.Add(ttl)}
+	}
+	e.value += n
+	s.entries[key] = e
+	return nil
+}
+
+// Get returns the live value of each key
+func (s *MemoryQuotaStore) Get(_ context.Context, keys []string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := make([]int64, len(keys))
+	for i, k := range keys {
+		if e, ok := s.entries[k]; ok && !now.After(e.expires) {
+			out[i] = e.value
+		}
+	}
+	return out, nil
+}
+
+// RedisCounterClient is the subset of a Redis client RedisQuotaStore needs.
+// IncrBy should run INCRBY and, when it creates the key, EXPIRE, e.g. in a
+// pipeline; MGet should return zero for missing keys.
+type RedisCounterClient interface {
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) error
+	MGet(ctx context.Context, keys ...string) ([]int64, error)
+}
+
+// RedisQuotaStore is a QuotaStore shared between processes through Redis
+type RedisQuotaStore struct {
+	Client RedisCounterClient
+	Prefix string
+}
+
+// Add increments Prefix + key by n
+func (s *RedisQuotaStore) Add(ctx context.Context, key string, n int64, ttl time.Duration) error {
+	return s.Client.IncrBy(ctx, s.Prefix+key, n, ttl)
+}
+
+// Get reads every key in one MGET
+func (s *RedisQuotaStore) Get(ctx context.Context, keys []string) ([]int64, error) {
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = s.Prefix + k
+	}
+	values, err := s.Client.MGet(ctx, prefixed...)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(keys) {
+		return nil, fmt.Errorf("langmesh: redis MGET returned %d values for %d keys", len(values), len(keys))
+	}
+	return values, nil
+}
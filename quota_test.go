@@ -0,0 +1,143 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedisCounter is an in-memory RedisCounterClient ignoring TTLs
+type fakeRedisCounter struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func (f *fakeRedisCounter) IncrBy(_ context.Context, key string, n int64, _ time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] += n
+	return nil
+}
+
+func (f *fakeRedisCounter) MGet(_ context.Context, keys ...string) ([]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]int64, len(keys))
+	for i, k := range keys {
+		out[i] = f.values[k]
+	}
+	return out, nil
+}
+
+func TestQuotaManagerPerUser(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryQuotaStore()
+	store.now = func() time.Time { return now }
+	quotas := NewQuotaManager(store, Quota{Requests: 2, Window: time.Hour})
+	quotas.now = store.now
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithQuotaManager(quotas))
+
+	alice := ContextWithUser(context.Background(), "alice")
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(alice, chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+	_, err := client.CreateChatCompletion(alice, chatRequest("hi"))
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.Reason != GuardReasonQuotaExceeded || guardErr.User != "alice" {
+		t.Fatalf("err = %v", err)
+	}
+	if want := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC); !guardErr.ResetAt.Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", guardErr.ResetAt, want)
+	}
+	if !strings.Contains(err.Error(), "2 of 2 requests") {
+		t.Errorf("error = %v", err)
+	}
+
+	if _, err := client.CreateChatCompletion(ContextWithUser(context.Background(), "bob"), chatRequest("hi")); err != nil {
+		t.Errorf("bob limited by alice's usage: %v", err)
+	}
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Errorf("anonymous request limited: %v", err)
+	}
+
+	// The first request leaves the window
+	now = now.Add(45 * time.Minute)
+	if _, err := client.CreateChatCompletion(alice, chatRequest("hi")); err != nil {
+		t.Errorf("after the window slid: %v", err)
+	}
+}
+
+func TestQuotaManagerTokensAndOverrides(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	redis := &fakeRedisCounter{values: map[string]int64{}}
+	quotas := NewQuotaManager(&RedisQuotaStore{Client: redis, Prefix: "app:"}, Quota{Tokens: 1, Window: time.Minute})
+	quotas.Limits = func(user string) []Quota {
+		if user == "pro" {
+			return []Quota{{Tokens: 1000, Window: time.Minute}}
+		}
+		return nil
+	}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithQuotaManager(quotas))
+
+	for _, user := range []string{"free", "pro"} {
+		ctx := ContextWithUser(context.Background(), user)
+		if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+		_, err := client.CreateChatCompletion(ctx, chatRequest("hi"))
+		if limited := errors.Is(err, ErrGuardRejected); limited != (user == "free") {
+			t.Errorf("%s: second request err = %v", user, err)
+		}
+	}
+
+	usage, err := quotas.Usage(context.Background(), "pro")
+	if err != nil || len(usage) != 1 || usage[0].Requests != 2 || usage[0].Tokens == 0 {
+		t.Errorf("pro usage = %+v, %v", usage, err)
+	}
+	for key := range redis.values {
+		if !strings.HasPrefix(key, "app:langmesh:quota:") {
+			t.Errorf("unprefixed key %q", key)
+		}
+	}
+}
+
+func TestQuotaManagerSubMinuteWindow(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryQuotaStore()
+	store.now = func() time.Time { return now }
+	quotas := NewQuotaManager(store, Quota{Requests: 2, Window: 10 * time.Second}, Quota{Requests: 3, Window: 30 * time.Second})
+	quotas.now = store.now
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithQuotaManager(quotas))
+
+	alice := ContextWithUser(context.Background(), "alice")
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(alice, chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := client.CreateChatCompletion(alice, chatRequest("hi"))
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || !strings.Contains(guardErr.Violation, "per 10s") {
+		t.Fatalf("err = %v, want the 10s quota", err)
+	}
+	if want := now.Add(10 * time.Second); !guardErr.ResetAt.Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", guardErr.ResetAt, want)
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, err := client.CreateChatCompletion(alice, chatRequest("hi")); err != nil {
+		t.Fatalf("after 10s: %v", err)
+	}
+	_, err = client.CreateChatCompletion(alice, chatRequest("hi"))
+	if !errors.As(err, &guardErr) || !strings.Contains(guardErr.Violation, "3 of 3 requests per 30s") {
+		t.Errorf("err = %v, want the 30s quota", err)
+	}
+}
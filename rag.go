@@ -0,0 +1,136 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultRetrievalTopK is how many chunks a Retriever injects unless told
+// otherwise
+const DefaultRetrievalTopK = 4
+
+// Retriever adds the index entries most relevant to a chat request to its
+// prompt
+type Retriever struct {
+	Index VectorIndex
+	// Model embeds queries; it must be the model the index was built with
+	Model openai.EmbeddingModel
+	// TopK defaults to DefaultRetrievalTopK
+	TopK int
+	// MinScore drops entries less similar to the query than this
+	MinScore float32
+}
+
+// IndexTexts embeds the Text of entries that have no Vector with EmbedTexts
+// and adds every entry to index
+func (c *Client) IndexTexts(
+	ctx context.Context,
+	index VectorIndex,
+	model openai.EmbeddingModel,
+	entries []VectorEntry,
+	opts EmbedOptions,
+) error {
+	var texts []string
+	var pending []int
+	for i, e := range entries {
+		if len(e.Vector) == 0 {
+			texts = append(texts, e.Text)
+			pending = append(pending, i)
+		}
+	}
+	if len(texts) > 0 {
+		result, err := c.EmbedTexts(ctx, model, texts, opts)
+		if err != nil {
+			return err
+		}
+		entries = append([]VectorEntry(nil), entries...)
+		for j, i := range pending {
+			entries[i].Vector = result.Embeddings[j]
+		}
+	}
+	return index.Add(entries...)
+}
+
+// Retrieve returns the entries most relevant to query
+func (c *Client) Retrieve(ctx context.Context, r Retriever, query string) ([]SearchResult, error) {
+	resp, err := c.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{Input: []string{query}, Model: r.Model})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("langmesh: retrieve: no embedding returned for the query")
+	}
+	k := r.TopK
+	if k <= 0 {
+		k = DefaultRetrievalTopK
+	}
+	results := r.Index.Search(resp.Data[0].Embedding, k)
+	kept := results[:0]
+	for _, res := range results {
+		if res.Score >= r.MinScore {
+			kept = append(kept, res)
+		}
+	}
+	return kept, nil
+}
+
+// CreateRAGCompletion retrieves the entries most relevant to the last user
+// message and sends request with them in a system message placed before
+// it. It returns the entries used alongside the response.
+func (c *Client) CreateRAGCompletion(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	r Retriever,
+) (openai.ChatCompletionResponse, []SearchResult, error) {
+	last := -1
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == openai.ChatMessageRoleUser {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return openai.ChatCompletionResponse{}, nil, fmt.Errorf("langmesh: RAG completion needs a user message to retrieve for")
+	}
+	results, err := c.Retrieve(ctx, r, messageText(request.Messages[last]))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, nil, err
+	}
+	if len(results) > 0 {
+		messages := make([]openai.ChatCompletionMessage, 0, len(request.Messages)+1)
+		messages = append(messages, request.Messages[:last]...)
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: retrievalPrompt(results),
+		})
+		request.Messages = append(messages, request.Messages[last:]...)
+	}
+	resp, err := c.CreateChatCompletion(ctx, request)
+	return resp, results, err
+}
+
+func retrievalPrompt(results []SearchResult) string {
+	var b strings.Builder
+	b.WriteString("Answer using the following context where it is relevant.")
+	for i, res := range results {
+		fmt.Fprintf(&b, "\n\n[%d] %s", i+1, res.Text)
+	}
+	return b.String()
+}
+
+// messageText joins a message's text content and parts
+func messageText(m openai.ChatCompletionMessage) string {
+	if len(m.MultiContent) == 0 {
+		return m.Content
+	}
+	var parts []string
+	for _, part := range m.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
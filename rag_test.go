@@ -0,0 +1,82 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// topicVector embeds text by which of a few topics it mentions
+func topicVector(text string) []float32 {
+	vec := make([]float32, 3)
+	for i, topic := range []string{"billing", "shipping", "returns"} {
+		if strings.Contains(strings.ToLower(text), topic) {
+			vec[i] = 1
+		}
+	}
+	vec[2] += 0.01
+	return vec
+}
+
+func TestCreateRAGCompletion(t *testing.T) {
+	var mu sync.Mutex
+	var chats []openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			var req struct {
+				Input []string `json:"input"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			resp := openai.EmbeddingResponse{}
+			for i, text := range req.Input {
+				resp.Data = append(resp.Data, openai.Embedding{Embedding: topicVector(text), Index: i})
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		chats = append(chats, req)
+		mu.Unlock()
+		fmt.Fprint(w, `{"id":"c1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`)
+	}))
+	t.Cleanup(srv.Close)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+
+	index := NewFlatIndex()
+	err := client.IndexTexts(context.Background(), index, openai.SmallEmbedding3, []VectorEntry{
+		{ID: "1", Text: "Billing happens monthly."},
+		{ID: "2", Text: "Shipping takes three days."},
+		{ID: "3", Text: "Returns are free.", Vector: []float32{0, 0, 1}},
+	}, EmbedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "Be brief."},
+		{Role: openai.ChatMessageRoleUser, Content: "How long does shipping take?"},
+	}}
+	_, used, err := client.CreateRAGCompletion(context.Background(), request,
+		Retriever{Index: index, Model: openai.SmallEmbedding3, TopK: 2, MinScore: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 1 || used[0].ID != "2" {
+		t.Fatalf("used = %+v", used)
+	}
+	sent := chats[0].Messages
+	if len(sent) != 3 || sent[1].Role != openai.ChatMessageRoleSystem ||
+		!strings.Contains(sent[1].Content, "[1] Shipping takes three days.") || sent[2].Content != request.Messages[1].Content {
+		t.Errorf("sent = %+v", sent)
+	}
+}
@@ -0,0 +1,139 @@
+package langmesh
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultThrottleReserve is the share of the rate limit below which
+// adaptive throttling starts spacing out requests
+const DefaultThrottleReserve = 0.1
+
+// WithAdaptiveThrottling paces requests by the rate limits OpenAI reports.
+// Once the remaining requests or tokens fall below reserve, a share of the
+// limit, requests are spaced out increasingly as the allowance runs down,
+// and held until the reset once it is exhausted. A reserve of zero means
+// DefaultThrottleReserve. Held requests are sent in ContextWithPriority order.
+// Waits end early if the request's context does.
+func WithAdaptiveThrottling(reserve float64) Option {
+	return func(c *Client) {
+		if reserve <= 0 {
+			reserve = DefaultThrottleReserve
+		}
+		c.throttleReserve = reserve
+	}
+}
+
+// LastRateLimit returns the rate limits reported with the most recent
+// response, or nil before any response carried them
+func (c *Client) LastRateLimit() *RateLimitInfo {
+	info, _ := c.rateLimits.snapshot()
+	return info
+}
+
+// rateLimitTracker holds the latest rate limits seen by a client and its
+// policy views, which share an API key
+type rateLimitTracker struct {
+	mu   sync.Mutex
+	last *RateLimitInfo
+	at   time.Time
+	// next is the earliest a paced request may be sent
+	next time.Time
+	now  func() time.Time
+
+	sched scheduler
+}
+
+func (t *rateLimitTracker) snapshot() (*RateLimitInfo, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		return nil, time.Time{}
+	}
+	info := *t.last
+	return &info, t.at
+}
+
+func (t *rateLimitTracker) observe(info *RateLimitInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = info
+	t.at = t.now()
+}
+
+// delay returns how long to hold a request, reserving its slot when the
+// allowance is being paced
+func (t *rateLimitTracker) delay(reserve float64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		return 0
+	}
+	now := t.now()
+	elapsed := now.Sub(t.at)
+	requests := throttleInterval(t.last.RemainingRequests, t.last.LimitRequests, t.last.ResetRequests-elapsed, reserve)
+	tokens := throttleInterval(t.last.RemainingTokens, t.last.LimitTokens, t.last.ResetTokens-elapsed, reserve)
+	if requests < 0 || tokens < 0 {
+		// Exhausted: everyone waits for the reset instead of queueing
+		return max(-requests, -tokens)
+	}
+	interval := max(requests, tokens)
+	if interval == 0 {
+		return 0
+	}
+	start := now
+	if t.next.After(start) {
+		start = t.next
+	}
+	t.next = start.Add(interval)
+	return start.Sub(now)
+}
+
+// throttleInterval is the spacing for one limit with reset left until it
+// resets, or minus the wait for the reset if it is exhausted
+func throttleInterval(remaining, limit int64, reset time.Duration, reserve float64) time.Duration {
+	if limit <= 0 || reset <= 0 {
+		return 0
+	}
+	if remaining <= 0 {
+		return -reset
+	}
+	threshold := reserve * float64(limit)
+	if float64(remaining) >= threshold {
+		return 0
+	}
+	return time.Duration(float64(reset) * (1 - float64(remaining)/threshold))
+}
+
+// rateLimitTransport records the rate limits of every response and, with
+// adaptive throttling, holds requests the limits have no room for
+type rateLimitTransport struct {
+	base   http.RoundTripper
+	client *Client
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.client
+	if c.throttleReserve > 0 && c.keyPool == nil {
+		wait, err := c.rateLimits.sched.acquire(req.Context(), c, c.rateLimits, c.throttleReserve)
+		if wait > 0 {
+			callStateFrom(req.Context()).addQueueWait(wait)
+			c.log(req.Context(), LogRetry, "throttled for rate limit",
+				"path", req.URL.Path, "priority", PriorityFrom(req.Context()), "wait", wait)
+		}
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		if info := parseRateLimit(resp.Header); info != nil {
+			c.rateLimits.observe(info)
+		}
+	}
+	return resp, err
+}
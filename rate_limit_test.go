@@ -0,0 +1,95 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRateLimitedServer answers chat requests reporting remaining of 100
+// requests, resetting in a minute
+func newRateLimitedServer(t *testing.T, remaining int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Ratelimit-Limit-Requests", "100")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", strconv.Itoa(remaining))
+		w.Header().Set("X-Ratelimit-Reset-Requests", "1m0s")
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestLastRateLimit(t *testing.T) {
+	srv, _ := newRateLimitedServer(t, 42)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	if client.LastRateLimit() != nil {
+		t.Fatal("rate limit reported before any response")
+	}
+
+	ctx, info := CaptureCallInfo(context.Background())
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	last := client.LastRateLimit()
+	if last == nil || last.RemainingRequests != 42 || last.ResetRequests != time.Minute {
+		t.Errorf("LastRateLimit = %+v", last)
+	}
+	if perCall := info.RateLimit(); perCall == nil || *perCall != *last {
+		t.Errorf("CallInfo.RateLimit = %+v", perCall)
+	}
+}
+
+func TestAdaptiveThrottlingHoldsUntilReset(t *testing.T) {
+	srv, calls := newRateLimitedServer(t, 0)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithAdaptiveThrottling(0))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.CreateChatCompletion(ctx, chatRequest("hi"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the wait to hit the deadline", err)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("server saw %d requests, want the exhausted one held", n)
+	}
+}
+
+func TestRateLimitTrackerPacing(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := &rateLimitTracker{now: func() time.Time { return now }}
+	tracker.observe(&RateLimitInfo{LimitRequests: 100, RemainingRequests: 50, ResetRequests: time.Minute})
+	if d := tracker.delay(0.1); d != 0 {
+		t.Errorf("delay above the reserve = %v", d)
+	}
+
+	// Half the reserve left: each request takes half the reset window
+	tracker.observe(&RateLimitInfo{LimitRequests: 100, RemainingRequests: 5, ResetRequests: time.Minute})
+	if d := tracker.delay(0.1); d != 0 {
+		t.Errorf("first paced delay = %v", d)
+	}
+	if d := tracker.delay(0.1); d != 30*time.Second {
+		t.Errorf("second paced delay = %v, want 30s", d)
+	}
+
+	tracker.observe(&RateLimitInfo{LimitTokens: 1000, RemainingTokens: 0, ResetTokens: 10 * time.Second})
+	now = now.Add(4 * time.Second)
+	if d := tracker.delay(0.1); d != 6*time.Second {
+		t.Errorf("exhausted delay = %v, want the rest of the reset", d)
+	}
+	now = now.Add(10 * time.Second)
+	if d := tracker.delay(0.1); d != 0 {
+		t.Errorf("delay after the reset = %v", d)
+	}
+}
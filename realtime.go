@@ -0,0 +1,421 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRealtimeModel is used when RealtimeOptions.Model is empty
+const DefaultRealtimeModel = "gpt-4o-realtime-preview"
+
+// RealtimeReconnected is the Type of the event a RealtimeSession delivers
+// after re-establishing a dropped connection. Server-side session state is
+// lost on reconnect, so resend any session.update.
+const RealtimeReconnected = "langmesh.reconnected"
+
+// realtimePCMBytesPerSecond is the rate of the API's default pcm16 audio:
+// 24kHz, 16-bit, mono
+const realtimePCMBytesPerSecond = 24000 * 2
+
+// RealtimeEvent is one client or server event. Type is the event type and
+// Data the complete JSON event, including the type field.
+type RealtimeEvent struct {
+	Type string
+	Data json.RawMessage
+}
+
+// NewRealtimeEvent builds a client event of type eventType from fields
+func NewRealtimeEvent(eventType string, fields map[string]any) (RealtimeEvent, error) {
+	event := make(map[string]any, len(fields)+1)
+	for k, v := range fields {
+		event[k] = v
+	}
+	event["type"] = eventType
+	data, err := json.Marshal(event)
+	if err != nil {
+		return RealtimeEvent{}, err
+	}
+	return RealtimeEvent{Type: eventType, Data: data}, nil
+}
+
+// RealtimeOptions configures a RealtimeSession
+type RealtimeOptions struct {
+	Model string
+	// ReconnectAttempts is how many times a dropped connection is redialed
+	// before the session fails; zero disables reconnection
+	ReconnectAttempts int
+	// ReconnectBackoff is the wait before the first redial, doubling after
+	// each failure; it defaults to one second
+	ReconnectBackoff time.Duration
+	// Buffer is the capacity of the incoming and outgoing channels
+	Buffer int
+}
+
+// RealtimeSession is a Realtime API WebSocket session. Server events arrive
+// on Incoming, which is closed when the session ends; client events are sent
+// through Outgoing. It records one "realtime" telemetry event when closed,
+// covering the session's duration, audio seconds in each direction and the
+// token usage of every completed response.
+type RealtimeSession struct {
+	client *Client
+	ctx    context.Context
+	url    string
+	header http.Header
+	opts   RealtimeOptions
+
+	incoming chan RealtimeEvent
+	outgoing chan RealtimeEvent
+	done     chan struct{}
+	wg       sync.WaitGroup
+	dialMu   sync.Mutex
+
+	mu         sync.Mutex
+	conn       *wsConn
+	closed     bool
+	err        error
+	reconnects int
+	usage      TokenUsage
+	audioIn    int
+	audioOut   int
+
+	requestID string
+	startTime time.Time
+	closeOnce sync.Once
+}
+
+// NewRealtimeSession connects to the Realtime API. ctx bounds the whole
+// session; cancel it or call Close to end the session.
+func (c *Client) NewRealtimeSession(ctx context.Context, opts RealtimeOptions) (*RealtimeSession, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.NewRealtimeSession(ctx, opts)
+	}
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	if opts.Model == "" {
+		opts.Model = DefaultRealtimeModel
+	}
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = time.Second
+	}
+
+	s := &RealtimeSession{
+		client:    c,
+		ctx:       ctx,
+		url:       realtimeURL(c.apiBase, opts.Model),
+		header:    http.Header{"Openai-Beta": {"realtime=v1"}},
+		opts:      opts,
+		incoming:  make(chan RealtimeEvent, opts.Buffer),
+		outgoing:  make(chan RealtimeEvent, opts.Buffer),
+		done:      make(chan struct{}),
+		requestID: requestIDFor(ctx),
+		startTime: time.Now(),
+	}
+	if c.authToken != "" {
+		s.header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	s.header.Set(clientRequestIDHeader, s.requestID)
+
+	conn, err := dialWebSocket(ctx, s.url, s.header)
+	if err != nil {
+		s.err = err
+		s.record()
+		return nil, err
+	}
+	s.conn = conn
+
+	s.wg.Add(2)
+	go s.readLoop()
+	go s.writeLoop()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// realtimeURL turns the REST API base into the realtime WebSocket endpoint
+func realtimeURL(apiBase, model string) string {
+	base := strings.TrimRight(apiBase, "/")
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	case strings.HasPrefix(base, "http://"):
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return base + "/realtime?model=" + url.QueryEscape(model)
+}
+
+// Incoming delivers server events
+func (s *RealtimeSession) Incoming() <-chan RealtimeEvent {
+	return s.incoming
+}
+
+// Outgoing accepts client events
+func (s *RealtimeSession) Outgoing() chan<- RealtimeEvent {
+	return s.outgoing
+}
+
+// Send queues event, failing if the session has ended
+func (s *RealtimeSession) Send(ctx context.Context, event RealtimeEvent) error {
+	select {
+	case s.outgoing <- event:
+		return nil
+	case <-s.done:
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return errWSClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendText adds a user text message to the conversation and asks for a
+// response
+func (s *RealtimeSession) SendText(ctx context.Context, text string) error {
+	item, err := NewRealtimeEvent("conversation.item.create", map[string]any{
+		"item": map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": []map[string]any{{"type": "input_text", "text": text}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Send(ctx, item); err != nil {
+		return err
+	}
+	create, _ := NewRealtimeEvent("response.create", nil)
+	return s.Send(ctx, create)
+}
+
+// AppendAudio appends pcm16 audio to the input buffer
+func (s *RealtimeSession) AppendAudio(ctx context.Context, pcm []byte) error {
+	event, err := NewRealtimeEvent("input_audio_buffer.append", map[string]any{
+		"audio": base64.StdEncoding.EncodeToString(pcm),
+	})
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, event)
+}
+
+// Err returns the error that ended the session, or nil if it was closed
+func (s *RealtimeSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the session and records its telemetry
+func (s *RealtimeSession) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		conn := s.conn
+		s.mu.Unlock()
+		close(s.done)
+		if conn != nil {
+			_ = conn.close()
+		}
+		s.wg.Wait()
+		close(s.incoming)
+		s.record()
+	})
+	return nil
+}
+
+// fail ends the session with err
+func (s *RealtimeSession) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil && !s.closed {
+		s.err = err
+	}
+	s.mu.Unlock()
+	go s.Close()
+}
+
+func (s *RealtimeSession) readLoop() {
+	defer s.wg.Done()
+	conn := s.current()
+	for conn != nil {
+		_, data, err := conn.readMessage()
+		if err != nil {
+			if conn = s.reconnect(conn, err); conn != nil {
+				s.deliver(RealtimeEvent{Type: RealtimeReconnected, Data: json.RawMessage(`{"type":"` + RealtimeReconnected + `"}`)})
+			}
+			continue
+		}
+		var head struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(data, &head)
+		s.observe(head.Type, data)
+		if !s.deliver(RealtimeEvent{Type: head.Type, Data: data}) {
+			return
+		}
+	}
+}
+
+func (s *RealtimeSession) writeLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case event := <-s.outgoing:
+			if event.Type == "input_audio_buffer.append" {
+				s.countAudioIn(event.Data)
+			}
+			for {
+				conn := s.current()
+				if conn == nil {
+					return
+				}
+				err := conn.writeMessage(wsText, event.Data)
+				if err == nil {
+					break
+				}
+				if s.reconnect(conn, err) == nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *RealtimeSession) deliver(event RealtimeEvent) bool {
+	select {
+	case s.incoming <- event:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *RealtimeSession) current() *wsConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.conn
+}
+
+// reconnect replaces failed after err, returning the connection to use or nil
+// if the session is over. Readers and writers that hit the same failure share
+// one redial. A close from the server ends the session without one.
+func (s *RealtimeSession) reconnect(failed *wsConn, err error) *wsConn {
+	s.dialMu.Lock()
+	defer s.dialMu.Unlock()
+	if conn := s.current(); conn != failed {
+		return conn
+	}
+	_ = failed.conn.Close()
+	if errors.Is(err, errWSClosed) {
+		go s.Close()
+		return nil
+	}
+
+	backoff := s.opts.ReconnectBackoff
+	for attempt := 0; attempt < s.opts.ReconnectAttempts; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		s.client.log(s.ctx, LogRetry, "reconnecting realtime session",
+			"request_id", s.requestID, "attempt", attempt+1, "error", err)
+		conn, dialErr := dialWebSocket(s.ctx, s.url, s.header)
+		if dialErr != nil {
+			err = dialErr
+			backoff *= 2
+			continue
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.close()
+			return nil
+		}
+		s.conn = conn
+		s.reconnects++
+		s.mu.Unlock()
+		return conn
+	}
+	s.fail(err)
+	return nil
+}
+
+// observe accumulates usage and audio from server events
+func (s *RealtimeSession) observe(eventType string, data []byte) {
+	switch eventType {
+	case "response.audio.delta":
+		var e struct {
+			Delta string `json:"delta"`
+		}
+		if json.Unmarshal(data, &e) == nil {
+			s.mu.Lock()
+			s.audioOut += base64.StdEncoding.DecodedLen(len(e.Delta))
+			s.mu.Unlock()
+		}
+	case "response.done":
+		var e struct {
+			Response struct {
+				Usage struct {
+					InputTokens  int `json:"input_tokens"`
+					OutputTokens int `json:"output_tokens"`
+					TotalTokens  int `json:"total_tokens"`
+				} `json:"usage"`
+			} `json:"response"`
+		}
+		if json.Unmarshal(data, &e) == nil {
+			s.mu.Lock()
+			s.usage.PromptTokens += e.Response.Usage.InputTokens
+			s.usage.CompletionTokens += e.Response.Usage.OutputTokens
+			s.usage.TotalTokens += e.Response.Usage.TotalTokens
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *RealtimeSession) countAudioIn(data []byte) {
+	var e struct {
+		Audio string `json:"audio"`
+	}
+	if json.Unmarshal(data, &e) == nil {
+		s.mu.Lock()
+		s.audioIn += base64.StdEncoding.DecodedLen(len(e.Audio))
+		s.mu.Unlock()
+	}
+}
+
+func (s *RealtimeSession) record() {
+	c := s.client
+	if !c.instrumented(s.ctx) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event := c.newEvent(s.ctx, s.requestID, "realtime", s.opts.Model, s.startTime, s.err)
+	event.TokenUsage = s.usage
+	event.CostEstimateUSD = c.estimateCost(s.opts.Model, s.usage.PromptTokens, s.usage.CompletionTokens)
+	event.AudioInputSeconds = float64(s.audioIn) / realtimePCMBytesPerSecond
+	event.AudioOutputSeconds = float64(s.audioOut) / realtimePCMBytesPerSecond
+	event.Reconnects = s.reconnects
+	c.recordTelemetry(event)
+}
@@ -0,0 +1,155 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acceptWebSocket completes the server side of the handshake
+func acceptWebSocket(t *testing.T, w http.ResponseWriter, r *http.Request) *wsConn {
+	t.Helper()
+	if r.Header.Get("Openai-Beta") != "realtime=v1" || r.Header.Get("Authorization") != "Bearer test-key" {
+		t.Errorf("handshake headers = %v", r.Header)
+	}
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+	brw.Flush()
+	return &wsConn{conn: conn, br: brw.Reader}
+}
+
+func serverEvent(t *testing.T, ws *wsConn, event string) {
+	t.Helper()
+	if err := ws.writeMessage(wsText, []byte(event)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRealtimeSession(t *testing.T) {
+	received := make(chan string, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("model"); got != DefaultRealtimeModel {
+			t.Errorf("model = %q", got)
+		}
+		ws := acceptWebSocket(t, w, r)
+		for {
+			_, data, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+			var e struct{ Type string }
+			_ = json.Unmarshal(data, &e)
+			received <- e.Type
+			if e.Type == "response.create" {
+				second := base64.StdEncoding.EncodeToString(make([]byte, realtimePCMBytesPerSecond))
+				serverEvent(t, ws, `{"type":"response.audio.delta","delta":"`+second+`"}`)
+				serverEvent(t, ws, `{"type":"response.done","response":{"usage":{"input_tokens":10,"output_tokens":20,"total_tokens":30}}}`)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+	ctx := context.Background()
+	session, err := client.NewRealtimeSession(ctx, RealtimeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SendText(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.AppendAudio(ctx, make([]byte, realtimePCMBytesPerSecond/2)); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for event := range session.Incoming() {
+		types = append(types, event.Type)
+		if event.Type == "response.done" {
+			break
+		}
+	}
+	for i := 0; i < 3; i++ {
+		<-received
+	}
+	session.Close()
+
+	if got := strings.Join(types, ","); got != "response.audio.delta,response.done" {
+		t.Errorf("events = %s", got)
+	}
+	event := rec.all()[0]
+	if event.Endpoint != "realtime" || event.Status != "success" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.TokenUsage.TotalTokens != 30 || event.AudioInputSeconds != 0.5 || event.AudioOutputSeconds != 1 {
+		t.Errorf("usage = %+v, audio %v/%v", event.TokenUsage, event.AudioInputSeconds, event.AudioOutputSeconds)
+	}
+}
+
+func TestRealtimeSessionReconnects(t *testing.T) {
+	var dials int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws := acceptWebSocket(t, w, r)
+		if atomic.AddInt32(&dials, 1) == 1 {
+			// Drop the first connection without a close frame
+			ws.conn.Close()
+			return
+		}
+		serverEvent(t, ws, `{"type":"session.created"}`)
+		for {
+			if _, _, err := ws.readMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+	session, err := client.NewRealtimeSession(context.Background(), RealtimeOptions{
+		ReconnectAttempts: 2,
+		ReconnectBackoff:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-session.Incoming()
+	second := <-session.Incoming()
+	session.Close()
+
+	if first.Type != RealtimeReconnected || second.Type != "session.created" {
+		t.Errorf("events = %s, %s", first.Type, second.Type)
+	}
+	if got := rec.all()[0].Reconnects; got != 1 {
+		t.Errorf("Reconnects = %d", got)
+	}
+}
+
+func TestRealtimeSessionFailsWithoutReconnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptWebSocket(t, w, r).conn.Close()
+	}))
+	defer srv.Close()
+
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	session, err := client.NewRealtimeSession(context.Background(), RealtimeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range session.Incoming() {
+	}
+	if session.Err() == nil {
+		t.Error("dropped connection ended the session without an error")
+	}
+}
@@ -0,0 +1,189 @@
+package langmesh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrFixtureNotFound is returned in replay mode when no recorded response
+// matches a request
+var ErrFixtureNotFound = errors.New("langmesh: no recorded fixture for request")
+
+// Fixture is one recorded request/response pair as stored on disk
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+// FixtureRequest is the recorded part of an outgoing request
+type FixtureRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// FixtureResponse is the recorded upstream response. Streaming responses are
+// stored as the raw SSE body.
+type FixtureResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// WithRecording writes every request/response pair to dir as JSON fixtures
+// keyed by a hash of the method, path, and body
+func WithRecording(dir string) Option {
+	return func(c *Client) {
+		c.transportWrappers = append(c.transportWrappers, func(base http.RoundTripper) http.RoundTripper {
+			return &recordingTransport{base: base, dir: dir}
+		})
+	}
+}
+
+// WithReplay serves responses from fixtures previously captured with
+// WithRecording and never contacts the API. Requests without a fixture fail
+// with ErrFixtureNotFound.
+func WithReplay(dir string) Option {
+	return func(c *Client) {
+		c.transportWrappers = append(c.transportWrappers, func(http.RoundTripper) http.RoundTripper {
+			return &replayTransport{dir: dir}
+		})
+	}
+}
+
+type recordingTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := Fixture{
+		Request: FixtureRequest{Method: req.Method, Path: req.URL.Path, Body: jsonOrNil(reqBody)},
+		Response: FixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     fixtureHeaders(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return resp, nil
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return resp, nil
+	}
+	// A failed write must not fail the live request being recorded
+	_ = os.WriteFile(fixturePath(t.dir, req.Method, req.URL.Path, reqBody), data, 0o644)
+	return resp, nil
+}
+
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	path := fixturePath(t.dir, req.Method, req.URL.Path, reqBody)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s %s (%s)", ErrFixtureNotFound, req.Method, req.URL.Path, filepath.Base(path))
+		}
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("langmesh: corrupt fixture %s: %w", path, err)
+	}
+	header := fixture.Response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(fixture.Response.Body)),
+		ContentLength: int64(len(fixture.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func fixturePath(dir, method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))[:16]+".json")
+}
+
+func jsonOrNil(body []byte) json.RawMessage {
+	if len(body) == 0 || !json.Valid(body) {
+		return nil
+	}
+	return json.RawMessage(body)
+}
+
+// fixtureHeaders keeps only headers that affect how responses are parsed,
+// so fixtures don't capture cookies or account identifiers
+func fixtureHeaders(h http.Header) http.Header {
+	out := http.Header{}
+	for _, k := range []string{"Content-Type", "X-Request-Id", "Openai-Model", "Openai-Processing-Ms"} {
+		if v := h.Get(k); v != "" {
+			out.Set(k, v)
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Ratelimit-") {
+			out[k] = v
+		}
+	}
+	return out
+}
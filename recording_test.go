@@ -0,0 +1,50 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	request := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+	}
+
+	recorder := NewClient("test-key", WithBaseURL(srv.URL), WithRecording(dir))
+	if _, err := recorder.CreateChatCompletion(context.Background(), request); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	replayer := NewClient("test-key", WithBaseURL(srv.URL), WithReplay(dir))
+	resp, err := replayer.CreateChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "hi" || resp.Usage.TotalTokens != 4 {
+		t.Errorf("unexpected replayed response %+v", resp)
+	}
+	if calls != 1 {
+		t.Errorf("replay hit the server: %d calls", calls)
+	}
+
+	request.Messages[0].Content = "something else"
+	_, err = replayer.CreateChatCompletion(context.Background(), request)
+	if !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("expected ErrFixtureNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package langmesh
+
+import (
+	"regexp"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Redactor scrubs sensitive data from text
+type Redactor interface {
+	Redact(text string) string
+}
+
+// RedactorFunc adapts a function to Redactor
+type RedactorFunc func(text string) string
+
+// Redact calls f
+func (f RedactorFunc) Redact(text string) string {
+	return f(text)
+}
+
+// RegexRedactor replaces every match of Pattern with Replacement
+type RegexRedactor struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Redact replaces matches of r.Pattern
+func (r RegexRedactor) Redact(text string) string {
+	return r.Pattern.ReplaceAllString(text, r.Replacement)
+}
+
+// RedactionChain applies each redactor in order
+type RedactionChain []Redactor
+
+// Redact runs text through every redactor in the chain
+func (rc RedactionChain) Redact(text string) string {
+	for _, r := range rc {
+		text = r.Redact(text)
+	}
+	return text
+}
+
+// Built-in detectors for common PII
+var (
+	EmailRedactor = RegexRedactor{
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+	}
+	PhoneRedactor = RegexRedactor{
+		Pattern:     regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{3}\)|\b\d{3})[ .\-]?\d{3}[ .\-]?\d{4}\b`),
+		Replacement: "[PHONE]",
+	}
+	SSNRedactor = RegexRedactor{
+		Pattern:     regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Replacement: "[SSN]",
+	}
+	CreditCardRedactor Redactor = RedactorFunc(redactCreditCards)
+)
+
+// DefaultRedactors returns the built-in email, credit card, SSN, and phone
+// detectors. SSNs run before phone numbers so they are not mislabelled.
+func DefaultRedactors() RedactionChain {
+	return RedactionChain{EmailRedactor, CreditCardRedactor, SSNRedactor, PhoneRedactor}
+}
+
+var cardCandidate = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+
+// redactCreditCards masks digit runs that pass the Luhn check, leaving
+// order numbers and other long integers alone
+func redactCreditCards(text string) string {
+	return cardCandidate.ReplaceAllStringFunc(text, func(match string) string {
+		digits := make([]int, 0, len(match))
+		for _, r := range match {
+			if r >= '0' && r <= '9' {
+				digits = append(digits, int(r-'0'))
+			}
+		}
+		if len(digits) < 13 || len(digits) > 19 || !luhnValid(digits) {
+			return match
+		}
+		return "[CREDIT_CARD]"
+	})
+}
+
+func luhnValid(digits []int) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// WithRedaction scrubs telemetry text (error messages and any captured
+// content) with the given redactors. With no arguments DefaultRedactors is used.
+func WithRedaction(redactors ...Redactor) Option {
+	return func(c *Client) {
+		if len(redactors) == 0 {
+			c.redactor = DefaultRedactors()
+			return
+		}
+		c.redactor = RedactionChain(redactors)
+	}
+}
+
+// WithRequestRedaction additionally rewrites outgoing chat messages with the
+// configured redactors before they are sent to OpenAI
+func WithRequestRedaction() Option {
+	return func(c *Client) {
+		c.redactRequests = true
+	}
+}
+
+func (c *Client) redact(text string) string {
+	if c.redactor == nil || text == "" {
+		return text
+	}
+	return c.redactor.Redact(text)
+}
+
+// redactRequest returns a copy of request with message text scrubbed. The
+// caller's message slice is never modified.
+func (c *Client) redactRequest(request openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	if !c.redactRequests || c.redactor == nil {
+		return request
+	}
+	messages := make([]openai.ChatCompletionMessage, len(request.Messages))
+	for i, m := range request.Messages {
+		m.Content = c.redact(m.Content)
+		if len(m.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+			for j, part := range m.MultiContent {
+				part.Text = c.redact(part.Text)
+				parts[j] = part
+			}
+			m.MultiContent = parts
+		}
+		messages[i] = m
+	}
+	request.Messages = messages
+	return request
+}
@@ -0,0 +1,36 @@
+package langmesh
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestDefaultRedactors(t *testing.T) {
+	cases := map[string]string{
+		"mail jane.doe@example.com now":     "mail [EMAIL] now",
+		"call 415-555-0123 today":           "call [PHONE] today",
+		"ssn 123-45-6789":                   "ssn [SSN]",
+		"card 4111 1111 1111 1111 on file":  "card [CREDIT_CARD] on file",
+		"order 1234567890123 is not a card": "order 1234567890123 is not a card",
+	}
+	r := DefaultRedactors()
+	for in, want := range cases {
+		if got := r.Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactRequestCopiesMessages(t *testing.T) {
+	client := NewClient("test-key", WithRedaction(), WithRequestRedaction())
+	original := []openai.ChatCompletionMessage{{Role: "user", Content: "I am bob@example.com"}}
+	redacted := client.redactRequest(openai.ChatCompletionRequest{Messages: original})
+
+	if redacted.Messages[0].Content != "I am [EMAIL]" {
+		t.Errorf("redacted content = %q", redacted.Messages[0].Content)
+	}
+	if original[0].Content != "I am bob@example.com" {
+		t.Errorf("caller's messages were modified: %q", original[0].Content)
+	}
+}
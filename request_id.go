@@ -0,0 +1,215 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// clientRequestIDHeader carries the langmesh request ID upstream. OpenAI
+	// logs it against its own ID, so support can find a call by either.
+	clientRequestIDHeader = "X-Client-Request-Id"
+	// upstreamRequestIDHeader is OpenAI's ID for the request
+	upstreamRequestIDHeader = "X-Request-Id"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID makes calls made with the returned context use id as
+// their request ID, in telemetry and upstream, instead of generating one
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFor returns the ID set by ContextWithRequestID, or a new one
+func requestIDFor(ctx context.Context) string {
+	if id, _ := ctx.Value(requestIDKey{}).(string); id != "" {
+		return id
+	}
+	return newRequestID()
+}
+
+// RateLimitInfo is the rate limit state OpenAI reported with a response
+type RateLimitInfo struct {
+	LimitRequests     int64         `json:"limit_requests"`
+	LimitTokens       int64         `json:"limit_tokens"`
+	RemainingRequests int64         `json:"remaining_requests"`
+	RemainingTokens   int64         `json:"remaining_tokens"`
+	ResetRequests     time.Duration `json:"reset_requests"`
+	ResetTokens       time.Duration `json:"reset_tokens"`
+}
+
+// parseRateLimit reads the x-ratelimit-* headers, returning nil if there
+// are none
+func parseRateLimit(h http.Header) *RateLimitInfo {
+	if h.Get("X-Ratelimit-Limit-Requests") == "" && h.Get("X-Ratelimit-Limit-Tokens") == "" {
+		return nil
+	}
+	integer := func(name string) int64 {
+		n, _ := strconv.ParseInt(h.Get(name), 10, 64)
+		return n
+	}
+	duration := func(name string) time.Duration {
+		d, _ := time.ParseDuration(h.Get(name))
+		return d
+	}
+	return &RateLimitInfo{
+		LimitRequests:     integer("X-Ratelimit-Limit-Requests"),
+		LimitTokens:       integer("X-Ratelimit-Limit-Tokens"),
+		RemainingRequests: integer("X-Ratelimit-Remaining-Requests"),
+		RemainingTokens:   integer("X-Ratelimit-Remaining-Tokens"),
+		ResetRequests:     duration("X-Ratelimit-Reset-Requests"),
+		ResetTokens:       duration("X-Ratelimit-Reset-Tokens"),
+	}
+}
+
+// CallInfo collects the IDs, rate limits and costs of calls made with a
+// context returned by CaptureCallInfo. With several upstream requests,
+// such as fallbacks or sequential calls, it holds the latest. The cost
+// figures are those of the call's telemetry event, set when the call
+// returns, or when a stream finishes.
+type CallInfo struct {
+	mu                sync.Mutex
+	requestID         string
+	upstreamRequestID string
+	rateLimit         *RateLimitInfo
+
+	model      string
+	provider   string
+	usage      TokenUsage
+	costUSD    float64
+	cost       float64
+	currency   string
+	latency    time.Duration
+	retryCount int
+	cacheHit   bool
+}
+
+type callInfoKey struct{}
+
+// CaptureCallInfo returns a context whose calls report their IDs and
+// costs to info
+func CaptureCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	info := &CallInfo{}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+func callInfoFrom(ctx context.Context) *CallInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info
+}
+
+func (i *CallInfo) record(requestID string, h http.Header) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.requestID = requestID
+	i.upstreamRequestID = h.Get(upstreamRequestIDHeader)
+	i.rateLimit = parseRateLimit(h)
+}
+
+// finish records the outcome of the call event describes
+func (i *CallInfo) finish(event *TelemetryEvent) {
+	if i == nil || event.Heartbeat {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.requestID = event.RequestID
+	i.model = event.Model
+	i.provider = event.Provider
+	i.usage = event.TokenUsage
+	i.costUSD = event.CostEstimateUSD
+	i.cost, i.currency = event.CostEstimateUSD, "USD"
+	if event.Currency != "" {
+		i.cost, i.currency = event.Cost, event.Currency
+	}
+	i.latency = time.Duration(event.LatencyMs) * time.Millisecond
+	i.retryCount = event.RetryCount
+	i.cacheHit = event.CacheHit
+}
+
+// RequestID is the langmesh request ID, as recorded in telemetry
+func (i *CallInfo) RequestID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.requestID
+}
+
+// UpstreamRequestID is OpenAI's ID for the request, for OpenAI support
+func (i *CallInfo) UpstreamRequestID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.upstreamRequestID
+}
+
+// RateLimit is the rate limits OpenAI reported with the response, or nil
+func (i *CallInfo) RateLimit() *RateLimitInfo {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rateLimit
+}
+
+// Model is the model that served the call, after any fallback
+func (i *CallInfo) Model() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.model
+}
+
+// Provider is the backend that served the call: "openai", "anthropic" or
+// "local"
+func (i *CallInfo) Provider() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.provider
+}
+
+// Usage is the call's token usage
+func (i *CallInfo) Usage() TokenUsage {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.usage
+}
+
+// CostUSD is the call's estimated cost, from the client's pricing
+func (i *CallInfo) CostUSD() float64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.costUSD
+}
+
+// Cost is the call's estimated cost in the WithCurrency currency, rounded
+// as WithCostRounding says, or CostUSD without one
+func (i *CallInfo) Cost() (amount float64, currency string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cost, i.currency
+}
+
+// Latency is how long the call took, to the millisecond
+func (i *CallInfo) Latency() time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.latency
+}
+
+// RetryCount counts the call's upstream requests after the first
+func (i *CallInfo) RetryCount() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.retryCount
+}
+
+// CacheHit reports whether the langmesh proxy served the call from its
+// cache
+func (i *CallInfo) CacheHit() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cacheHit
+}
@@ -0,0 +1,94 @@
+package langmesh
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("X-Client-Request-Id")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req_upstream")
+		w.Header().Set("X-Ratelimit-Limit-Requests", "500")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "499")
+		w.Header().Set("X-Ratelimit-Limit-Tokens", "30000")
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "29985")
+		w.Header().Set("X-Ratelimit-Reset-Requests", "120ms")
+		w.Header().Set("X-Ratelimit-Reset-Tokens", "6m0s")
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	ctx, info := CaptureCallInfo(context.Background())
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	event := rec.all()[0]
+	if sent == "" || sent != event.RequestID || info.RequestID() != event.RequestID {
+		t.Errorf("sent %q, info %q, event %q", sent, info.RequestID(), event.RequestID)
+	}
+	if info.UpstreamRequestID() != "req_upstream" || event.UpstreamRequestID != "req_upstream" {
+		t.Errorf("upstream ID: info %q, event %q", info.UpstreamRequestID(), event.UpstreamRequestID)
+	}
+	want := RateLimitInfo{
+		LimitRequests:     500,
+		LimitTokens:       30000,
+		RemainingRequests: 499,
+		RemainingTokens:   29985,
+		ResetRequests:     120 * time.Millisecond,
+		ResetTokens:       6 * time.Minute,
+	}
+	if event.RateLimit == nil || *event.RateLimit != want {
+		t.Errorf("RateLimit = %+v", event.RateLimit)
+	}
+
+	ctx = ContextWithRequestID(context.Background(), "trace-42")
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if event := rec.all()[1]; sent != "trace-42" || event.RequestID != "trace-42" {
+		t.Errorf("sent %q, event %q", sent, event.RequestID)
+	}
+}
+
+func TestCallInfoCost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"model":"gpt-4o-mini"`) {
+			http.Error(w, `{"error":{"message":"overloaded","type":"server_error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Langmesh-Cache", "hit")
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000,"completion_tokens":500,"total_tokens":1500}}`))
+	}))
+	t.Cleanup(srv.Close)
+	// No sinks, observers or logger: the call is instrumented for info alone
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithModelFallback("gpt-4o-mini", "gpt-4o"))
+
+	ctx, info := CaptureCallInfo(context.Background())
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if info.Model() != "gpt-4o" || info.Provider() != "openai" || info.RetryCount() != 1 || !info.CacheHit() {
+		t.Errorf("model %q, provider %q, retries %d, cache hit %v", info.Model(), info.Provider(), info.RetryCount(), info.CacheHit())
+	}
+	if info.Usage() != (TokenUsage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}) {
+		t.Errorf("usage = %+v", info.Usage())
+	}
+	if want := client.EstimateCostUSD("gpt-4o", 1000, 500); want == 0 || info.CostUSD() != want {
+		t.Errorf("cost = %v, want %v", info.CostUSD(), want)
+	}
+	if info.Latency() < 0 || info.RequestID() == "" {
+		t.Errorf("latency %v, request ID %q", info.Latency(), info.RequestID())
+	}
+}
@@ -0,0 +1,479 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRequestLogFileBytes is the size at which a request log file
+	// is rotated
+	DefaultRequestLogFileBytes = 64 << 20
+	// DefaultRequestLogFiles is how many request log files are kept
+	DefaultRequestLogFiles = 10
+	// DefaultRequestLogBodyBytes is how much of each body is logged
+	DefaultRequestLogBodyBytes = 1 << 20
+)
+
+// RequestLogFormat is the file format of WithRequestLog
+type RequestLogFormat int
+
+const (
+	// RequestLogJSONL writes a line per request with the fields of an
+	// OpenAI Batch API input line, custom_id, method, url and body, and
+	// the response as in a Batch output line
+	RequestLogJSONL RequestLogFormat = iota
+	// RequestLogHAR writes HTTP Archive 1.2 files, which browsers' network
+	// panels and HAR viewers open. Files are valid after every request.
+	RequestLogHAR
+)
+
+// RequestLogConfig configures WithRequestLog. Zero sizes take the
+// defaults.
+type RequestLogConfig struct {
+	// Dir holds the log files, named requests-<time>.jsonl or .har
+	Dir    string
+	Format RequestLogFormat
+	// MaxFileBytes starts a new file once the current one reaches it
+	MaxFileBytes int64
+	// MaxFiles is how many files are kept; the oldest are deleted
+	MaxFiles int
+	// MaxBodyBytes truncates longer request and response bodies
+	MaxBodyBytes int
+}
+
+// WithRequestLog logs every upstream request and its response, bodies
+// included, to rotating files in cfg.Dir, for debugging and for curating
+// datasets and fine-tuning data. String values in JSON bodies pass
+// through WithRedaction first; credentials and other headers are left
+// out. Entries are written once the response body is read or closed.
+// Write failures are logged at LogTelemetry and never fail the call.
+func WithRequestLog(cfg RequestLogConfig) Option {
+	return func(c *Client) {
+		if cfg.MaxFileBytes <= 0 {
+			cfg.MaxFileBytes = DefaultRequestLogFileBytes
+		}
+		if cfg.MaxFiles <= 0 {
+			cfg.MaxFiles = DefaultRequestLogFiles
+		}
+		if cfg.MaxBodyBytes <= 0 {
+			cfg.MaxBodyBytes = DefaultRequestLogBodyBytes
+		}
+		c.requestLog = &requestLog{cfg: cfg, client: c}
+	}
+}
+
+// RequestLogEntry is a line of a RequestLogJSONL file
+type RequestLogEntry struct {
+	// CustomID is the call's request ID
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Response *LoggedResponse `json:"response,omitempty"`
+	// Error is set instead of Response when the request failed
+	Error string `json:"error,omitempty"`
+
+	Timestamp  time.Time `json:"timestamp"`
+	DurationMs int64     `json:"duration_ms"`
+	// Truncated marks bodies cut at MaxBodyBytes. They are logged as JSON
+	// strings, like other bodies that are not JSON, such as streams.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// LoggedResponse is the response of a RequestLogEntry
+type LoggedResponse struct {
+	StatusCode int `json:"status_code"`
+	// RequestID is OpenAI's x-request-id
+	RequestID string          `json:"request_id,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+// ReadRequestLog decodes a RequestLogJSONL file
+func ReadRequestLog(r io.Reader) ([]RequestLogEntry, error) {
+	var entries []RequestLogEntry
+	dec := json.NewDecoder(r)
+	for {
+		var entry RequestLogEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("langmesh: request log entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// requestLog writes entries to the current file, rotating it
+type requestLog struct {
+	cfg    RequestLogConfig
+	client *Client
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// entries counts the current HAR file's entries
+	entries int
+}
+
+// harTrailer closes a HAR file's entries; each entry is written over it
+const harTrailer = "]}}\n"
+
+func (l *requestLog) write(ctx context.Context, entry RequestLogEntry, har harEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writeLocked(entry, har); err != nil {
+		l.client.log(ctx, LogTelemetry, "request log write failed", "request_id", entry.CustomID, "error", err)
+	}
+}
+
+func (l *requestLog) writeLocked(entry RequestLogEntry, har harEntry) error {
+	if l.file != nil && l.size >= l.cfg.MaxFileBytes {
+		l.file.Close()
+		l.file = nil
+	}
+	if l.file == nil {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if l.cfg.Format == RequestLogJSONL {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		n, err := l.file.Write(append(data, '\n'))
+		l.size += int64(n)
+		return err
+	}
+
+	data, err := json.Marshal(har)
+	if err != nil {
+		return err
+	}
+	if l.entries > 0 {
+		data = append([]byte{','}, data...)
+	}
+	at := l.size - int64(len(harTrailer))
+	n, err := l.file.WriteAt(append(data, harTrailer...), at)
+	if err != nil {
+		return err
+	}
+	l.size = at + int64(n)
+	l.entries++
+	return nil
+}
+
+// rotate opens a new file and deletes the oldest beyond MaxFiles
+func (l *requestLog) rotate() error {
+	if err := os.MkdirAll(l.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	ext := ".jsonl"
+	if l.cfg.Format == RequestLogHAR {
+		ext = ".har"
+	}
+	name := filepath.Join(l.cfg.Dir, "requests-"+time.Now().UTC().Format("20060102T150405.000000")+ext)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	l.file, l.size, l.entries = f, 0, 0
+	if l.cfg.Format == RequestLogHAR {
+		creator, _ := json.Marshal(map[string]string{"name": "langmesh", "version": currentRuntime().sdkVersion})
+		header := `{"log":{"version":"1.2","creator":` + string(creator) + `,"entries":[` + harTrailer
+		n, err := f.WriteString(header)
+		l.size = int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	old, err := filepath.Glob(filepath.Join(l.cfg.Dir, "requests-*"+ext))
+	if err != nil {
+		return err
+	}
+	// Names sort by time
+	sort.Strings(old)
+	for len(old) > l.cfg.MaxFiles {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+	return nil
+}
+
+func (l *requestLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// cappedBuffer keeps the first max bytes written to it
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+	b.Buffer.Write(p)
+	return len(p), nil
+}
+
+// requestLogTransport logs each request and its response
+type requestLogTransport struct {
+	base http.RoundTripper
+	log  *requestLog
+}
+
+func (t requestLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+	reqBody := &cappedBuffer{max: t.log.cfg.MaxBodyBytes}
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		if body, err := req.GetBody(); err == nil {
+			io.Copy(reqBody, body)
+			body.Close()
+		}
+	default:
+		req = req.Clone(ctx)
+		req.Body = hashingBody{ReadCloser: req.Body, w: reqBody}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry, har := t.entry(req, start, reqBody, nil, nil)
+		entry.Error = err.Error()
+		t.log.write(ctx, entry, har)
+		return nil, err
+	}
+	respBody := &cappedBuffer{max: t.log.cfg.MaxBodyBytes}
+	resp.Body = &auditedBody{
+		hashingBody: hashingBody{ReadCloser: resp.Body, w: respBody},
+		done: func() {
+			entry, har := t.entry(req, start, reqBody, resp, respBody)
+			t.log.write(context.WithoutCancel(ctx), entry, har)
+		},
+	}
+	return resp, nil
+}
+
+// entry builds both formats' records of an exchange
+func (t requestLogTransport) entry(req *http.Request, start time.Time, reqBody *cappedBuffer, resp *http.Response, respBody *cappedBuffer) (RequestLogEntry, harEntry) {
+	elapsed := time.Since(start)
+	redact := t.log.client.redact
+	entry := RequestLogEntry{
+		CustomID:   callStateFrom(req.Context()).id(),
+		Method:     req.Method,
+		URL:        req.URL.Path,
+		Body:       loggedBody(reqBody, redact),
+		Timestamp:  start.UTC(),
+		DurationMs: elapsed.Milliseconds(),
+		Truncated:  reqBody.truncated,
+	}
+	har := harEntry{
+		StartedDateTime: start.UTC().Format(time.RFC3339Nano),
+		Time:            float64(elapsed.Microseconds()) / 1000,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(req.Header, []string{"Content-Type", "Openai-Beta", clientRequestIDHeader}),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			HTTPVersion: "HTTP/1.1",
+			Headers:     []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache:     struct{}{},
+		Timings:   harTimings{Send: 0, Wait: float64(elapsed.Microseconds()) / 1000, Receive: 0},
+		RequestID: entry.CustomID,
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			har.Request.QueryString = append(har.Request.QueryString, harNameValue{name, v})
+		}
+	}
+	if reqBody.Len() > 0 {
+		har.Request.BodySize = int64(reqBody.Len())
+		har.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: bodyText(entry.Body)}
+	}
+	if resp == nil {
+		har.Response.StatusText = "request failed"
+		return entry, har
+	}
+
+	entry.Response = &LoggedResponse{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(upstreamRequestIDHeader),
+		Body:       loggedBody(respBody, redact),
+	}
+	entry.Truncated = entry.Truncated || respBody.truncated
+	har.Response.Status = resp.StatusCode
+	har.Response.StatusText = http.StatusText(resp.StatusCode)
+	har.Response.Headers = harHeaders(fixtureHeaders(resp.Header), nil)
+	har.Response.BodySize = int64(respBody.Len())
+	har.Response.Content = harContent{
+		Size:     int64(respBody.Len()),
+		MimeType: resp.Header.Get("Content-Type"),
+		Text:     bodyText(entry.Response.Body),
+	}
+	return entry, har
+}
+
+// loggedBody is the redacted body as JSON, or as a JSON string if it is
+// not JSON or was truncated
+func loggedBody(body *cappedBuffer, redact func(string) string) json.RawMessage {
+	if body.Len() == 0 {
+		return nil
+	}
+	if !body.truncated {
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(body.Bytes()))
+		dec.UseNumber()
+		if dec.Decode(&v) == nil {
+			if data, err := json.Marshal(redactJSON(v, redact)); err == nil {
+				return data
+			}
+		}
+	}
+	data, _ := json.Marshal(redact(string(body.Bytes())))
+	return data
+}
+
+// redactJSON redacts every string in a decoded JSON value
+func redactJSON(v any, redact func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return redact(v)
+	case []any:
+		for i := range v {
+			v[i] = redactJSON(v[i], redact)
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = redactJSON(v[k], redact)
+		}
+	}
+	return v
+}
+
+// bodyText is a logged body as HAR text: a JSON string's value, or the
+// JSON itself
+func bodyText(body json.RawMessage) string {
+	var s string
+	if json.Unmarshal(body, &s) == nil {
+		return s
+	}
+	return string(body)
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// RequestID is a custom field, as HAR allows with a leading underscore
+	RequestID string `json:"_requestId,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harHeaders lists h's headers, only those in keep if it is set, sorted
+func harHeaders(h http.Header, keep []string) []harNameValue {
+	out := []harNameValue{}
+	for name, values := range h {
+		if keep != nil && !containsFold(keep, name) {
+			continue
+		}
+		for _, v := range values {
+			out = append(out, harNameValue{name, v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogJSONL(t *testing.T) {
+	srv, _ := newChatServer(t, "reach me at bob@example.com")
+	dir := t.TempDir()
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithRedaction(RedactorFunc(func(s string) string { return strings.ReplaceAll(s, "bob@example.com", "[EMAIL]") })),
+		WithRequestLog(RequestLogConfig{Dir: dir}),
+	)
+	ctx, info := CaptureCallInfo(context.Background())
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("I am bob@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "requests-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "bob@example.com") || strings.Contains(string(data), "test-key") {
+		t.Errorf("log leaks redacted text or the key: %s", data)
+	}
+	entries, err := ReadRequestLog(strings.NewReader(string(data)))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	e := entries[0]
+	if e.CustomID != info.RequestID() || e.Method != "POST" || e.URL != "/v1/chat/completions" || e.Response.StatusCode != 200 {
+		t.Errorf("entry = %+v", e)
+	}
+	var body struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(e.Body, &body); err != nil || body.Model != "gpt-4o-mini" || body.Messages[0].Content != "I am [EMAIL]" {
+		t.Errorf("request body = %s", e.Body)
+	}
+	if !strings.Contains(string(e.Response.Body), "reach me at [EMAIL]") {
+		t.Errorf("response body = %s", e.Response.Body)
+	}
+}
+
+func TestRequestLogHAR(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	dir := t.TempDir()
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithRequestLog(RequestLogConfig{Dir: dir, Format: RequestLogHAR}))
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The file is a complete archive after every entry, before Close
+	files, _ := filepath.Glob(filepath.Join(dir, "requests-*.har"))
+	if len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	var har struct {
+		Log struct {
+			Version string     `json:"version"`
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("har = %+v", har.Log)
+	}
+	e := har.Log.Entries[1]
+	if e.Request.Method != "POST" || !strings.HasSuffix(e.Request.URL, "/v1/chat/completions") || e.Response.Status != 200 ||
+		!strings.Contains(e.Request.PostData.Text, `"hello"`) || !strings.Contains(e.Response.Content.Text, `"hi"`) {
+		t.Errorf("entry = %+v", e)
+	}
+	for _, h := range e.Request.Headers {
+		if strings.EqualFold(h.Name, "Authorization") {
+			t.Error("Authorization header logged")
+		}
+	}
+	client.Close()
+}
+
+func TestRequestLogRotation(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	dir := t.TempDir()
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithRequestLog(RequestLogConfig{Dir: dir, MaxFileBytes: 1, MaxFiles: 2, MaxBodyBytes: 40}),
+	)
+	defer client.Close()
+	for i := 0; i < 4; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "requests-*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("kept %d files, want 2", len(files))
+	}
+	f, _ := os.Open(files[1])
+	defer f.Close()
+	entries, err := ReadRequestLog(f)
+	if err != nil || len(entries) != 1 || !entries[0].Truncated {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	var body string
+	if err := json.Unmarshal(entries[0].Response.Body, &body); err != nil || len(body) != 40 {
+		t.Errorf("truncated body = %s", entries[0].Response.Body)
+	}
+}
@@ -0,0 +1,230 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// GuardReasonModelNotAllowed is the GuardReason for requests a
+// RequestPolicy rejects for their model
+const GuardReasonModelNotAllowed GuardReason = "model_not_allowed"
+
+// Rewrites recorded in TelemetryEvent.PolicyRewrites
+const (
+	RewriteMaxTokens    = "max_tokens"
+	RewriteTemperature  = "temperature"
+	RewriteSystemPrompt = "system_prompt"
+)
+
+// RequestPolicy holds organization rules enforced on every chat request.
+// Zero fields impose nothing.
+type RequestPolicy struct {
+	// MaxTokens caps max_tokens, and sets it on requests that leave it out
+	MaxTokens int `json:"max_tokens"`
+	// Temperature clamps temperature into a range
+	Temperature *TemperatureRange `json:"temperature"`
+	// AllowedModels, if set, rejects requests for any other model. Entries
+	// may be path.Match patterns, such as "gpt-4o*".
+	AllowedModels []string `json:"allowed_models"`
+	// BlockedModels rejects requests for these models, also patterns
+	BlockedModels []string `json:"blocked_models"`
+	// SystemPrompt is put first in every request's messages. A request
+	// already starting with it is left alone.
+	SystemPrompt string `json:"system_prompt"`
+}
+
+// TemperatureRange bounds a request's temperature
+type TemperatureRange struct {
+	Min float32 `json:"min"`
+	Max float32 `json:"max"`
+}
+
+// WithRequestPolicy rewrites and checks chat requests against p before
+// they are sent: max_tokens and temperature are clamped, the system prompt
+// is inserted, and requests for disallowed models fail with a GuardError.
+// Each event lists the rewrites made to its request in PolicyRewrites.
+// Policies registered with WithPolicies can set their own.
+func WithRequestPolicy(p RequestPolicy) Option {
+	return func(c *Client) {
+		c.requestPolicy = &p
+	}
+}
+
+// applyRequestPolicy rewrites request to comply with the client's policy,
+// noting the rewrites on ctx's call
+func (c *Client) applyRequestPolicy(ctx context.Context, request openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	p := c.requestPolicy
+	if p == nil {
+		return request
+	}
+	var rewrites []string
+	if p.MaxTokens > 0 && (request.MaxTokens == 0 || request.MaxTokens > p.MaxTokens) {
+		request.MaxTokens = p.MaxTokens
+		rewrites = append(rewrites, RewriteMaxTokens)
+	}
+	if r := p.Temperature; r != nil {
+		if t := min(max(request.Temperature, r.Min), r.Max); t != request.Temperature {
+			request.Temperature = t
+			rewrites = append(rewrites, RewriteTemperature)
+		}
+	}
+	if p.SystemPrompt != "" {
+		msgs := request.Messages
+		if len(msgs) == 0 || msgs[0].Role != openai.ChatMessageRoleSystem || msgs[0].Content != p.SystemPrompt {
+			request.Messages = append([]openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: p.SystemPrompt},
+			}, msgs...)
+			rewrites = append(rewrites, RewriteSystemPrompt)
+		}
+	}
+	if len(rewrites) > 0 {
+		c.log(ctx, LogRequest, "request rewritten by policy", "model", request.Model, "rewrites", rewrites)
+		if state := callStateFrom(ctx); state != nil {
+			state.mu.Lock()
+			state.policyRewrites = rewrites
+			state.mu.Unlock()
+		}
+	}
+	return request
+}
+
+// checkRequestPolicy rejects a request for a model the policy disallows
+func (c *Client) checkRequestPolicy(model string) error {
+	p := c.requestPolicy
+	if p == nil {
+		return nil
+	}
+	var violation string
+	switch {
+	case matchModel(p.BlockedModels, model):
+		violation = fmt.Sprintf("model %s is blocked", model)
+	case len(p.AllowedModels) > 0 && !matchModel(p.AllowedModels, model):
+		violation = fmt.Sprintf("model %s is not allowed", model)
+	default:
+		return nil
+	}
+	return &GuardError{Reason: GuardReasonModelNotAllowed, Guard: "request_policy", Violation: violation}
+}
+
+func matchModel(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, model); ok || pattern == model {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRequestPolicy reads a RequestPolicy from a YAML file
+func LoadRequestPolicy(file string) (RequestPolicy, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return RequestPolicy{}, err
+	}
+	defer f.Close()
+	return ParseRequestPolicy(f)
+}
+
+// ParseRequestPolicy reads a RequestPolicy from YAML such as:
+//
+//	max_tokens: 1024
+//	min_temperature: 0
+//	max_temperature: 0.7
+//	allowed_models: [gpt-4o, gpt-4o-mini]
+//	blocked_models:
+//	  - gpt-4-32k*
+//	system_prompt: |
+//	  Follow the Acme acceptable use policy.
+//
+// Only these keys are accepted. The file is read with the same YAML subset
+// as LoadConfig, without environment references.
+func ParseRequestPolicy(r io.Reader) (RequestPolicy, error) {
+	var p RequestPolicy
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return p, err
+	}
+	tree, err := parseYAML(string(raw))
+	if err != nil {
+		return p, err
+	}
+	entries, ok := tree.(map[string]any)
+	if !ok {
+		return p, fmt.Errorf("langmesh: request policy: expected key: value lines")
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var temperature *TemperatureRange
+	for _, key := range keys {
+		value := entries[key]
+		var err error
+		switch key {
+		case "max_tokens":
+			p.MaxTokens, err = strconv.Atoi(policyScalar(value))
+		case "min_temperature", "max_temperature":
+			var t float64
+			if t, err = strconv.ParseFloat(policyScalar(value), 32); err == nil {
+				if temperature == nil {
+					temperature = &TemperatureRange{Max: 2}
+				}
+				if key == "min_temperature" {
+					temperature.Min = float32(t)
+				} else {
+					temperature.Max = float32(t)
+				}
+			}
+		case "allowed_models":
+			p.AllowedModels, err = policyList(value)
+		case "blocked_models":
+			p.BlockedModels, err = policyList(value)
+		case "system_prompt":
+			p.SystemPrompt = policyScalar(value)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return RequestPolicy{}, fmt.Errorf("langmesh: request policy: %s: %w", key, err)
+		}
+	}
+	p.Temperature = temperature
+	return p, nil
+}
+
+// policyScalar is a parsed scalar as text
+func policyScalar(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// policyList is a parsed list of scalars, or a single scalar
+func policyList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		list := make([]string, len(v))
+		for i, item := range v {
+			if _, nested := item.(map[string]any); nested {
+				return nil, fmt.Errorf("expected a list of model names")
+			}
+			list[i] = policyScalar(item)
+		}
+		return list, nil
+	case map[string]any:
+		return nil, fmt.Errorf("expected a list of model names")
+	}
+	return []string{policyScalar(value)}, nil
+}
@@ -0,0 +1,460 @@
+package langmesh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultResponsePollInterval is how often WaitForResponse checks a
+// background response when no interval is given
+const DefaultResponsePollInterval = 2 * time.Second
+
+// ErrResponseFailed is returned by WaitForResponse when a response ends in
+// any status other than completed
+var ErrResponseFailed = errors.New("langmesh: response did not complete")
+
+// ResponseRequest is a request to the Responses API (/v1/responses), which
+// the wrapped go-openai version does not cover
+type ResponseRequest struct {
+	Model string `json:"model"`
+	// Input is a string or a list of input items such as
+	// {"role": "user", "content": "..."}
+	Input        any    `json:"input"`
+	Instructions string `json:"instructions,omitempty"`
+	// PreviousResponseID continues the conversation of an earlier stored
+	// response without resending it
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
+	// Background runs the response asynchronously; poll it with
+	// RetrieveResponse or WaitForResponse
+	Background      bool              `json:"background,omitempty"`
+	Store           *bool             `json:"store,omitempty"`
+	Tools           []any             `json:"tools,omitempty"`
+	Temperature     *float32          `json:"temperature,omitempty"`
+	MaxOutputTokens int               `json:"max_output_tokens,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+
+	stream bool
+}
+
+// MarshalJSON adds the stream flag set by StreamResponse
+func (r ResponseRequest) MarshalJSON() ([]byte, error) {
+	type plain ResponseRequest
+	return json.Marshal(struct {
+		plain
+		Stream bool `json:"stream,omitempty"`
+	}{plain(r), r.stream})
+}
+
+// Response is a Responses API response object
+type Response struct {
+	ID                 string               `json:"id"`
+	Object             string               `json:"object"`
+	CreatedAt          int64                `json:"created_at"`
+	Status             string               `json:"status"`
+	Model              string               `json:"model"`
+	Output             []ResponseOutputItem `json:"output"`
+	PreviousResponseID string               `json:"previous_response_id,omitempty"`
+	Usage              ResponseUsage        `json:"usage"`
+	Error              *ResponseError       `json:"error,omitempty"`
+}
+
+// ResponseOutputItem is one item of a response's output
+type ResponseOutputItem struct {
+	Type    string                  `json:"type"`
+	ID      string                  `json:"id"`
+	Role    string                  `json:"role,omitempty"`
+	Content []ResponseOutputContent `json:"content,omitempty"`
+	// Raw is the complete item, for types this package does not model
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON keeps the raw item alongside the decoded fields
+func (i *ResponseOutputItem) UnmarshalJSON(data []byte) error {
+	type plain ResponseOutputItem
+	if err := json.Unmarshal(data, (*plain)(i)); err != nil {
+		return err
+	}
+	i.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// ResponseOutputContent is a content part of an output message
+type ResponseOutputContent struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// ResponseUsage is a response's token usage
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ResponseError describes why a response failed
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// OutputText concatenates the text of every output message
+func (r Response) OutputText() string {
+	var b strings.Builder
+	for _, item := range r.Output {
+		for _, part := range item.Content {
+			if part.Type == "output_text" {
+				b.WriteString(part.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// CreateResponse creates a response, recording telemetry with its usage
+func (c *Client) CreateResponse(ctx context.Context, request ResponseRequest) (Response, error) {
+	request.stream = false
+	return c.responseCall(ctx, "responses.create", request.Model, http.MethodPost, "/responses", request)
+}
+
+// RetrieveResponse fetches a stored or background response
+func (c *Client) RetrieveResponse(ctx context.Context, responseID string) (Response, error) {
+	return c.responseCall(ctx, "responses.retrieve", "", http.MethodGet, "/responses/"+url.PathEscape(responseID), nil)
+}
+
+// CancelResponse cancels a background response
+func (c *Client) CancelResponse(ctx context.Context, responseID string) (Response, error) {
+	return c.responseCall(ctx, "responses.cancel", "", http.MethodPost, "/responses/"+url.PathEscape(responseID)+"/cancel", nil)
+}
+
+// WaitForResponse polls a background response every interval until it
+// finishes. A failed, cancelled or incomplete response returns an error
+// wrapping ErrResponseFailed along with the response.
+func (c *Client) WaitForResponse(ctx context.Context, responseID string, interval time.Duration) (Response, error) {
+	if interval <= 0 {
+		interval = DefaultResponsePollInterval
+	}
+	for {
+		resp, err := c.RetrieveResponse(ctx, responseID)
+		if err != nil {
+			return resp, err
+		}
+		switch resp.Status {
+		case "completed":
+			return resp, nil
+		case "failed", "cancelled", "incomplete":
+			if resp.Error != nil {
+				return resp, fmt.Errorf("%w: %s: %s: %s", ErrResponseFailed, resp.Status, resp.Error.Code, resp.Error.Message)
+			}
+			return resp, fmt.Errorf("%w: %s", ErrResponseFailed, resp.Status)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) responseCall(
+	ctx context.Context,
+	endpoint, model, method, path string,
+	body any,
+) (Response, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.responseCall(ctx, endpoint, model, method, path, body)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointResponses)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	var resp Response
+	err := c.configErr
+	if err == nil && model != "" {
+		err = c.checkStrict(model, false)
+	}
+	if request, ok := body.(ResponseRequest); ok && err == nil {
+		err = c.checkResponseCost(ctx, request)
+	}
+	if err == nil {
+		err = c.doJSON(ctx, method, path, body, &resp)
+		err = upstreamError(ctx, err)
+	}
+
+	if c.instrumented(ctx) {
+		if resp.Model != "" {
+			model = resp.Model
+		}
+		event := c.newEvent(ctx, requestID, endpoint, model, startTime, err)
+		event.ResponseID = resp.ID
+		if err == nil {
+			c.applyResponseUsage(&event, model, resp.Usage)
+		}
+		c.recordTelemetry(event)
+	}
+
+	return resp, err
+}
+
+// checkResponseCost runs the spend guards for a Responses API request
+func (c *Client) checkResponseCost(ctx context.Context, request ResponseRequest) error {
+	prompt := c.countTokens(request.Model, request.Instructions) + c.countTokens(request.Model, inputText(request.Input))
+	return c.checkCostGuards(ctx, request.Model, prompt, request.MaxOutputTokens)
+}
+
+func (c *Client) applyResponseUsage(event *TelemetryEvent, model string, usage ResponseUsage) {
+	event.TokenUsage = TokenUsage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	event.CostEstimateUSD = c.estimateCost(model, usage.InputTokens, usage.OutputTokens)
+}
+
+// ResponseStreamEvent is one server-sent event of a streamed response.
+// Delta is set for text deltas and Response for events that carry the
+// response, such as response.completed.
+type ResponseStreamEvent struct {
+	Type     string
+	Data     json.RawMessage
+	Delta    string
+	Response *Response
+}
+
+// ResponseStream reads a streamed response. It records one telemetry event
+// when the stream completes, fails, or is closed, with the usage reported
+// by the final response event.
+type ResponseStream struct {
+	client    *Client
+	ctx       context.Context
+	cancel    context.CancelFunc
+	body      io.ReadCloser
+	reader    *bufio.Reader
+	requestID string
+	model     string
+	startTime time.Time
+
+	mu       sync.Mutex
+	final    *Response
+	recorded bool
+}
+
+// StreamResponse creates a response and streams its events
+func (c *Client) StreamResponse(ctx context.Context, request ResponseRequest) (*ResponseStream, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.StreamResponse(ctx, request)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	// Released when the stream is closed, as for chat streams
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointResponses)
+	ctx, _ = withCallState(ctx, requestID)
+
+	stream := &ResponseStream{
+		client:    c,
+		ctx:       ctx,
+		cancel:    cancel,
+		requestID: requestID,
+		model:     request.Model,
+		startTime: startTime,
+	}
+	err := c.checkStrict(request.Model, false)
+	if err == nil {
+		err = c.checkResponseCost(ctx, request)
+	}
+	var httpResp *http.Response
+	if err == nil {
+		request.stream = true
+		httpResp, err = c.doAPI(ctx, http.MethodPost, "/responses", request)
+		err = upstreamError(ctx, err)
+	}
+	if err != nil {
+		stream.finishWith(err)
+		cancel()
+		return nil, err
+	}
+	stream.body = httpResp.Body
+	stream.reader = bufio.NewReader(httpResp.Body)
+	return stream, nil
+}
+
+// Recv returns the next event, or io.EOF once the stream has ended
+func (s *ResponseStream) Recv() (ResponseStreamEvent, error) {
+	for {
+		event, err := s.readEvent()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.finishWith(nil)
+			} else {
+				s.finishWith(err)
+			}
+			return ResponseStreamEvent{}, err
+		}
+		if event == nil {
+			continue
+		}
+		if event.Response != nil {
+			s.mu.Lock()
+			s.final = event.Response
+			s.mu.Unlock()
+		}
+		if event.Type == "response.failed" || event.Type == "error" {
+			err := fmt.Errorf("%w: %s", ErrResponseFailed, event.Data)
+			s.finishWith(err)
+			return *event, err
+		}
+		return *event, nil
+	}
+}
+
+// readEvent reads one server-sent event, returning nil for comments and
+// keep-alives
+func (s *ResponseStream) readEvent() (*ResponseStreamEvent, error) {
+	var data []byte
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil && (len(line) == 0 || !errors.Is(err, io.EOF)) {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if rest, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(rest, []byte(" "))...)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return nil, io.EOF
+	}
+
+	var payload struct {
+		Type     string    `json:"type"`
+		Delta    string    `json:"delta"`
+		Response *Response `json:"response"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("langmesh: decode response event: %w", err)
+	}
+	return &ResponseStreamEvent{
+		Type:     payload.Type,
+		Data:     json.RawMessage(data),
+		Delta:    payload.Delta,
+		Response: payload.Response,
+	}, nil
+}
+
+// Close releases the stream, recording its telemetry if it has not ended
+func (s *ResponseStream) Close() {
+	if s.body != nil {
+		s.body.Close()
+	}
+	s.finishWith(nil)
+	s.cancel()
+}
+
+func (s *ResponseStream) finishWith(err error) {
+	s.mu.Lock()
+	if s.recorded {
+		s.mu.Unlock()
+		return
+	}
+	s.recorded = true
+	final := s.final
+	s.mu.Unlock()
+
+	c := s.client
+	if !c.instrumented(s.ctx) {
+		return
+	}
+	model := s.model
+	if final != nil && final.Model != "" {
+		model = final.Model
+	}
+	event := c.newEvent(s.ctx, s.requestID, "responses.create", model, s.startTime, err)
+	if final != nil {
+		event.ResponseID = final.ID
+		c.applyResponseUsage(&event, model, final.Usage)
+	}
+	c.recordTelemetry(event)
+}
+
+// doJSON sends body as JSON to the API path and decodes the reply into out
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.doAPI(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("langmesh: decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// doAPI sends body as JSON to the API path, returning the response when it
+// succeeds and the go-openai error types when it does not
+func (c *Client) doAPI(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := c.newAPIRequest(ctx, method, path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp)
+	}
+	return resp, nil
+}
+
+// newAPIRequest builds an authenticated request for an API path that the
+// underlying client has no method for
+func (c *Client) newAPIRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.apiBase, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	return req, nil
+}
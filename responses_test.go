@@ -0,0 +1,155 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const testResponse = `{"id":%q,"object":"response","status":%q,"model":"gpt-4o-mini",` +
+	`"output":[{"type":"message","id":"msg_1","role":"assistant","content":[{"type":"output_text","text":"hello"}]}],` +
+	`"usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`
+
+// newResponsesServer serves the Responses API. Background responses report
+// in_progress on their first retrieval and completed after that.
+func newResponsesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/responses":
+			var req map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["stream"] == true {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hel\"}\n\n")
+				fmt.Fprint(w, ": keep-alive\n\n")
+				fmt.Fprint(w, "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"lo\"}\n\n")
+				fmt.Fprintf(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":"+testResponse+"}\n\n", "resp_s", "completed")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			id := "resp_1"
+			if prev, _ := req["previous_response_id"].(string); prev != "" {
+				id = prev + "_next"
+			}
+			status := "completed"
+			if req["background"] == true {
+				status = "queued"
+			}
+			fmt.Fprintf(w, testResponse, id, status)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/responses/"):
+			w.Header().Set("Content-Type", "application/json")
+			status := "completed"
+			if polls.Add(1) == 1 {
+				status = "in_progress"
+			}
+			fmt.Fprintf(w, testResponse, strings.TrimPrefix(r.URL.Path, "/v1/responses/"), status)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"not found","type":"invalid_request_error"}}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCreateResponseChaining(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newResponsesServer(t).URL+"/v1"), withRecorder(rec))
+
+	first, err := client.CreateResponse(context.Background(), ResponseRequest{Model: "gpt-4o-mini", Input: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.CreateResponse(context.Background(), ResponseRequest{
+		Model:              "gpt-4o-mini",
+		Input:              "and again",
+		PreviousResponseID: first.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != "resp_1_next" || second.OutputText() != "hello" {
+		t.Errorf("second = %+v", second)
+	}
+
+	event := rec.all()[1]
+	if event.Endpoint != "responses.create" || event.ResponseID != "resp_1_next" ||
+		event.TokenUsage.TotalTokens != 15 || event.CostEstimateUSD == 0 {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestBackgroundResponse(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newResponsesServer(t).URL+"/v1"), withRecorder(rec))
+
+	resp, err := client.CreateResponse(context.Background(), ResponseRequest{Model: "gpt-4o-mini", Input: "hi", Background: true})
+	if err != nil || resp.Status != "queued" {
+		t.Fatalf("resp = %+v, %v", resp, err)
+	}
+	done, err := client.WaitForResponse(context.Background(), resp.ID, time.Millisecond)
+	if err != nil || done.Status != "completed" {
+		t.Fatalf("done = %+v, %v", done, err)
+	}
+	events := rec.all()
+	if len(events) != 3 || events[2].Endpoint != "responses.retrieve" || events[2].Model != "gpt-4o-mini" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(newResponsesServer(t).URL+"/v1"), withRecorder(rec))
+
+	stream, err := client.StreamResponse(context.Background(), ResponseRequest{Model: "gpt-4o-mini", Input: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var text strings.Builder
+	var final *Response
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		text.WriteString(event.Delta)
+		if event.Type == "response.completed" {
+			final = event.Response
+		}
+	}
+	if text.String() != "hello" || final == nil || final.ID != "resp_s" {
+		t.Errorf("text = %q, final = %+v", text.String(), final)
+	}
+
+	stream.Close()
+	events := rec.all()
+	if len(events) != 1 || events[0].ResponseID != "resp_s" || events[0].TokenUsage.TotalTokens != 15 {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestCancelResponseAPIError(t *testing.T) {
+	client := NewClient("test-key", WithBaseURL(newResponsesServer(t).URL+"/v1"))
+	_, err := client.CancelResponse(context.Background(), "resp_1")
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v", err)
+	}
+}
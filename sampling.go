@@ -0,0 +1,81 @@
+package langmesh
+
+import (
+	"hash/fnv"
+)
+
+// TelemetrySampling controls which events are shipped to telemetry sinks.
+// Local consumers such as budgets, error budgets, and usage exporters always
+// see every event. Unset rates keep everything; a rate of 0 drops
+// everything.
+type TelemetrySampling struct {
+	// SuccessRate is the fraction of successful events kept, in [0, 1]
+	SuccessRate *float64 `json:"success_rate"`
+	// ErrorRate is the fraction of failed and cancelled events kept, in [0, 1]
+	ErrorRate *float64 `json:"error_rate"`
+	// EndpointRates overrides SuccessRate for specific endpoints, e.g.
+	// {"embeddings": 0.01}
+	EndpointRates map[string]float64 `json:"endpoint_rates"`
+	// ExcludeEndpoints are never shipped
+	ExcludeEndpoints []string `json:"exclude_endpoints"`
+}
+
+// SampleRate returns a pointer to rate, for TelemetrySampling's fields
+func SampleRate(rate float64) *float64 {
+	return &rate
+}
+
+// WithTelemetrySampling applies s before events reach any sink. Kept events
+// carry their sample rate so backends can re-weight counts.
+func WithTelemetrySampling(s TelemetrySampling) Option {
+	return func(c *Client) {
+		c.sampling = &s
+	}
+}
+
+// WithTelemetryFilter drops events for which keep returns false. It runs
+// after sampling, on the request goroutine.
+func WithTelemetryFilter(keep func(TelemetryEvent) bool) Option {
+	return func(c *Client) {
+		c.telemetryFilter = keep
+	}
+}
+
+// sampleEvent decides whether event is shipped and stamps its sample rate
+func (c *Client) sampleEvent(event *TelemetryEvent) bool {
+	if s := c.sampling; s != nil {
+		for _, ep := range s.ExcludeEndpoints {
+			if ep == event.Endpoint {
+				c.sampledOut.Add(1)
+				return false
+			}
+		}
+		rate := s.SuccessRate
+		if r, ok := s.EndpointRates[event.Endpoint]; ok {
+			rate = &r
+		}
+		if event.Status == "error" || event.Status == "cancelled" {
+			rate = s.ErrorRate
+		}
+		if rate != nil && *rate < 1 {
+			if *rate <= 0 || !sampledIn(event.RequestID, *rate) {
+				c.sampledOut.Add(1)
+				return false
+			}
+			event.SampleRate = *rate
+		}
+	}
+	if c.telemetryFilter != nil && !c.telemetryFilter(*event) {
+		c.sampledOut.Add(1)
+		return false
+	}
+	return true
+}
+
+// sampledIn hashes the request ID so every sink makes the same decision for
+// the same request
+func sampledIn(requestID string, rate float64) bool {
+	h := fnv.New64a()
+	h.Write([]byte(requestID))
+	return float64(h.Sum64()%10000) < rate*10000
+}
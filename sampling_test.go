@@ -0,0 +1,74 @@
+package langmesh
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTelemetrySampling(t *testing.T) {
+	client := NewClient("test-key",
+		WithTelemetrySampling(TelemetrySampling{
+			SuccessRate:      SampleRate(0.1),
+			ExcludeEndpoints: []string{"moderations"},
+		}),
+		WithTelemetryFilter(func(e TelemetryEvent) bool { return e.Model != "internal-probe" }),
+	)
+
+	successes := 0
+	for i := 0; i < 1000; i++ {
+		event := TelemetryEvent{RequestID: fmt.Sprintf("req_%d", i), Endpoint: "chat.completions", Status: "success"}
+		if client.sampleEvent(&event) {
+			successes++
+			if event.SampleRate != 0.1 {
+				t.Fatalf("kept event missing sample rate: %+v", event)
+			}
+		}
+	}
+	if successes < 60 || successes > 140 {
+		t.Errorf("kept %d of 1000 successes at 10%%", successes)
+	}
+
+	for i := 0; i < 20; i++ {
+		event := TelemetryEvent{RequestID: fmt.Sprintf("err_%d", i), Endpoint: "chat.completions", Status: "error"}
+		if !client.sampleEvent(&event) || event.SampleRate != 0 {
+			t.Fatalf("errors should be kept unsampled: %+v", event)
+		}
+	}
+
+	if client.sampleEvent(&TelemetryEvent{RequestID: "m", Endpoint: "moderations", Status: "error"}) {
+		t.Error("excluded endpoint was kept")
+	}
+	if client.sampleEvent(&TelemetryEvent{RequestID: "p", Status: "error", Model: "internal-probe"}) {
+		t.Error("filtered event was kept")
+	}
+	if got := client.TelemetryStats().SampledOut; got != int64(1000-successes+2) {
+		t.Errorf("SampledOut = %d, want %d", got, 1000-successes+2)
+	}
+}
+
+func TestSamplingIsConsistentPerRequest(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("req_%d", i)
+		if sampledIn(id, 0.5) != sampledIn(id, 0.5) {
+			t.Fatalf("sampling decision for %s is not deterministic", id)
+		}
+	}
+}
+
+func TestTelemetrySamplingZeroRateDropsAll(t *testing.T) {
+	client := NewClient("test-key", WithTelemetrySampling(TelemetrySampling{
+		SuccessRate:   SampleRate(0),
+		EndpointRates: map[string]float64{"embeddings": 0},
+	}))
+	for i := 0; i < 100; i++ {
+		for _, endpoint := range []string{"chat.completions", "embeddings"} {
+			if client.sampleEvent(&TelemetryEvent{RequestID: fmt.Sprintf("req_%d", i), Endpoint: endpoint, Status: "success"}) {
+				t.Fatalf("%s success kept at rate 0", endpoint)
+			}
+		}
+	}
+	// ErrorRate is unset, so every error is kept
+	if !client.sampleEvent(&TelemetryEvent{RequestID: "err", Endpoint: "chat.completions", Status: "error"}) {
+		t.Error("error dropped with ErrorRate unset")
+	}
+}
@@ -0,0 +1,151 @@
+package langmesh
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority orders requests held by adaptive throttling: when the rate
+// limit has no room for everyone, higher priorities are sent first and
+// equal priorities in arrival order. Any int is allowed; the zero value is
+// PriorityNormal.
+type Priority int
+
+const (
+	// PriorityLow suits background jobs that can wait
+	PriorityLow Priority = -10
+	// PriorityNormal is the priority of requests that set none
+	PriorityNormal Priority = 0
+	// PriorityHigh suits interactive traffic with a user waiting
+	PriorityHigh Priority = 10
+)
+
+type priorityKey struct{}
+
+// ContextWithPriority sets the priority of calls made with the returned context
+func ContextWithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority set on ctx
+func PriorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// applyPriority copies the priority on ctx onto event
+func applyPriority(ctx context.Context, event *TelemetryEvent) {
+	event.Priority = PriorityFrom(ctx)
+}
+
+// scheduler queues the requests adaptive throttling holds, releasing one
+// per paced slot in priority order
+type scheduler struct {
+	mu          sync.Mutex
+	queue       waitQueue
+	seq         uint64
+	dispatching bool
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+	// index is the waiter's position in the queue, or -1 once removed
+	index int
+}
+
+// acquire returns once the request on ctx may be sent, having waited for
+// its slot behind any higher-priority requests. It returns how long it
+// waited, or ctx's error if ctx ended first. The dispatch loop runs on one
+// of c's goroutines.
+func (s *scheduler) acquire(ctx context.Context, c *Client, t *rateLimitTracker, reserve float64) (time.Duration, error) {
+	s.mu.Lock()
+	var first time.Duration
+	if len(s.queue) == 0 && !s.dispatching {
+		if first = t.delay(reserve); first == 0 {
+			s.mu.Unlock()
+			return 0, nil
+		}
+	}
+	start := time.Now()
+	s.seq++
+	w := &waiter{priority: PriorityFrom(ctx), seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.queue, w)
+	if !s.dispatching {
+		s.dispatching = true
+		c.goroutine("scheduler.dispatch", func() { s.dispatch(t, reserve, first) })
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.index < 0 {
+			// Released as ctx ended; the slot is spent either way
+			return time.Since(start), ctx.Err()
+		}
+		heap.Remove(&s.queue, w.index)
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// dispatch releases queued requests one slot at a time until the queue is
+// empty, the first after wait
+func (s *scheduler) dispatch(t *rateLimitTracker, reserve float64, wait time.Duration) {
+	for {
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			w := heap.Pop(&s.queue).(*waiter)
+			close(w.ready)
+		}
+		if len(s.queue) == 0 {
+			s.dispatching = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		wait = t.delay(reserve)
+	}
+}
+
+// waitQueue is a heap of waiters, highest priority and then earliest first
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
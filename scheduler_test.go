@@ -0,0 +1,135 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newPacedServer reports remaining of 100 requests, resetting in resetIn,
+// and records the prompts it is sent
+func newPacedServer(t *testing.T, remaining int, resetIn time.Duration) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		prompts = append(prompts, req.Messages[0].Content)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Ratelimit-Limit-Requests", "100")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", strconv.Itoa(remaining))
+		w.Header().Set("X-Ratelimit-Reset-Requests", resetIn.String())
+		w.Write([]byte(`{"id":"c1","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), prompts...)
+	}
+}
+
+// waitForQueue polls until n requests are held by the scheduler
+func waitForQueue(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		queued := len(s.queue)
+		s.mu.Unlock()
+		if queued >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPrioritySchedulingUnderThrottling(t *testing.T) {
+	// Half the reserve left: requests are sent 50ms apart
+	srv, prompts := newPacedServer(t, 5, 100*time.Millisecond)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec), WithAdaptiveThrottling(0))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	send := func(prompt string, p Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CreateChatCompletion(ContextWithPriority(context.Background(), p), chatRequest(prompt)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// The first paced request takes the open slot; the rest queue
+	send("batch-1", PriorityLow)
+	for len(prompts()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	send("batch-2", PriorityLow)
+	waitForQueue(t, &client.rateLimits.sched, 1)
+	if n := client.DebugState().Goroutines["scheduler.dispatch"]; n != 1 {
+		t.Errorf("dispatch goroutines = %d, want 1 counted while requests queue", n)
+	}
+	send("default", PriorityNormal)
+	waitForQueue(t, &client.rateLimits.sched, 2)
+	send("interactive", PriorityHigh)
+	wg.Wait()
+
+	got := prompts()
+	want := []string{"first", "batch-1", "interactive", "default", "batch-2"}
+	if len(got) != len(want) {
+		t.Fatalf("prompts = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("prompts = %v, want %v", got, want)
+		}
+	}
+	for _, e := range rec.all() {
+		if e.Priority == PriorityHigh && e.QueueWaitMs <= 0 {
+			t.Errorf("high priority event = %+v, want its queue wait", e)
+		}
+	}
+}
+
+func TestPrioritySchedulingCancelledWaiter(t *testing.T) {
+	srv, prompts := newPacedServer(t, 0, 100*time.Millisecond)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithAdaptiveThrottling(0))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(ContextWithPriority(context.Background(), PriorityHigh))
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.CreateChatCompletion(ctx, chatRequest("abandoned"))
+		done <- err
+	}()
+	waitForQueue(t, &client.rateLimits.sched, 1)
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("cancelled request was sent")
+	}
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("next")); err != nil {
+		t.Fatal(err)
+	}
+	if got := prompts(); len(got) != 2 || got[1] != "next" {
+		t.Errorf("prompts = %v", got)
+	}
+}
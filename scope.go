@@ -0,0 +1,186 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrScopeEnded is returned, with WithStrictScopes, for calls made with a
+// context whose request scope has already been ended
+var ErrScopeEnded = errors.New("langmesh: request scope already ended")
+
+// Scope is the attribution attached to a request: who it is for and how its
+// telemetry should be tagged. Values are copied in and out of the context,
+// so a Scope cannot be changed after it is attached.
+type Scope struct {
+	User string
+	Tags map[string]string
+}
+
+func (s Scope) clone() Scope {
+	if s.Tags != nil {
+		tags := make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			tags[k] = v
+		}
+		s.Tags = tags
+	}
+	return s
+}
+
+// scopeCarrier is the single context value holding everything langmesh scopes
+// to a request. Children derived with ContextWithUser, ContextWithTag, or
+// ContextWithPolicy copy their parent's values and share its lifetime.
+type scopeCarrier struct {
+	scope      Scope
+	policy     string
+	loop       toolLoop
+	prompt     promptRef
+	experiment experimentRef
+	route      string
+	sinkURL    string
+	muted      bool
+	session    string
+	ended      *atomic.Bool
+	jsonRepair int
+	attributes map[string]any
+	trace      traceContext
+}
+
+type scopeKey struct{}
+
+func carrierFrom(ctx context.Context) *scopeCarrier {
+	carrier, _ := ctx.Value(scopeKey{}).(*scopeCarrier)
+	return carrier
+}
+
+// liveCarrier returns the carrier on ctx, or nil if there is none or its
+// request has ended
+func liveCarrier(ctx context.Context) *scopeCarrier {
+	carrier := carrierFrom(ctx)
+	if carrier == nil || carrier.ended.Load() {
+		return nil
+	}
+	return carrier
+}
+
+// deriveCarrier attaches a copy of the carrier on ctx, modified by update
+func deriveCarrier(ctx context.Context, update func(*scopeCarrier)) context.Context {
+	next := &scopeCarrier{ended: new(atomic.Bool)}
+	if parent := carrierFrom(ctx); parent != nil {
+		// Everything is inherited; only the scope's maps are copied, so
+		// updates to them do not reach the parent
+		*next = *parent
+		next.scope = parent.scope.clone()
+	}
+	update(next)
+	return context.WithValue(ctx, scopeKey{}, next)
+}
+
+// BeginRequest starts a request scope carrying s, replacing anything
+// inherited from ctx. Call end once the request is finished; calls made
+// afterwards with the returned context, or any context derived from it, no
+// longer carry its attribution and are counted as scope violations.
+func BeginRequest(ctx context.Context, s Scope) (scoped context.Context, end func()) {
+	carrier := &scopeCarrier{scope: s.clone(), ended: new(atomic.Bool)}
+	return context.WithValue(ctx, scopeKey{}, carrier), func() { carrier.ended.Store(true) }
+}
+
+// ContextWithoutScope detaches ctx from any inherited request scope, e.g.
+// before handing it to background work that outlives the request
+func ContextWithoutScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scopeCarrier{ended: new(atomic.Bool)})
+}
+
+// ContextWithUser sets the user that calls made with the returned context are
+// attributed to
+func ContextWithUser(ctx context.Context, user string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) { c.scope.User = user })
+}
+
+// ContextWithTag adds a telemetry tag for calls made with the returned context
+func ContextWithTag(ctx context.Context, key, value string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		if c.scope.Tags == nil {
+			c.scope.Tags = make(map[string]string)
+		}
+		c.scope.Tags[key] = value
+	})
+}
+
+// WithTags adds telemetry tags to every event the client records. Tags set
+// on the context with ContextWithTag take precedence.
+func WithTags(tags map[string]string) Option {
+	return func(c *Client) {
+		if c.tags == nil {
+			c.tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+// ScopeFrom returns a copy of the attribution on ctx. It is empty if the
+// request scope has ended.
+func ScopeFrom(ctx context.Context) Scope {
+	carrier := liveCarrier(ctx)
+	if carrier == nil {
+		return Scope{}
+	}
+	return carrier.scope.clone()
+}
+
+// WithStrictScopes makes calls fail with ErrScopeEnded, before anything is
+// sent upstream, when their context's request scope has ended. Without it
+// such calls proceed without attribution.
+func WithStrictScopes() Option {
+	return func(c *Client) {
+		c.strictScopes = true
+	}
+}
+
+// applyScope copies the attribution on ctx onto event
+func applyScope(ctx context.Context, event *TelemetryEvent) {
+	s := ScopeFrom(ctx)
+	event.User = s.User
+	event.Tags = s.Tags
+}
+
+// applyTags adds the client's tags to event beneath those from its context
+func (c *Client) applyTags(event *TelemetryEvent) {
+	if len(c.tags) == 0 {
+		return
+	}
+	tags := make(map[string]string, len(c.tags)+len(event.Tags))
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	for k, v := range event.Tags {
+		tags[k] = v
+	}
+	event.Tags = tags
+}
+
+// scopeTransport counts, and with strict scopes rejects, HTTP requests made
+// with an ended request scope
+type scopeTransport struct {
+	base       http.RoundTripper
+	strict     bool
+	violations *atomic.Int64
+}
+
+func (t scopeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if carrier := carrierFrom(req.Context()); carrier != nil && carrier.ended.Load() {
+		t.violations.Add(1)
+		if t.strict {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, ErrScopeEnded
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,94 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestScopeAttributionOnEvents(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	ctx, end := BeginRequest(context.Background(), Scope{User: "alice"})
+	defer end()
+	ctx = ContextWithTag(ctx, "feature", "search")
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	event := rec.all()[0]
+	if event.User != "alice" || event.Tags["feature"] != "search" {
+		t.Errorf("attribution not recorded: user=%q tags=%v", event.User, event.Tags)
+	}
+}
+
+func TestScopeValuesAreCopied(t *testing.T) {
+	tags := map[string]string{"team": "a"}
+	ctx, end := BeginRequest(context.Background(), Scope{Tags: tags})
+	defer end()
+	tags["team"] = "b"
+
+	child := ContextWithTag(ctx, "team", "c")
+	if got := ScopeFrom(ctx).Tags["team"]; got != "a" {
+		t.Errorf("parent tag = %q, want a", got)
+	}
+	if got := ScopeFrom(child).Tags["team"]; got != "c" {
+		t.Errorf("child tag = %q, want c", got)
+	}
+	if got := ScopeFrom(ContextWithoutScope(child)); got.User != "" || got.Tags != nil {
+		t.Errorf("ContextWithoutScope kept values: %+v", got)
+	}
+}
+
+func TestEndedScopeDoesNotLeak(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	ctx, end := BeginRequest(context.Background(), Scope{User: "alice"})
+	ctx = ContextWithPolicy(ContextWithTag(ctx, "feature", "search"), "batch")
+	end()
+
+	if got := PolicyFromContext(ctx); got != "" {
+		t.Errorf("policy survived end: %q", got)
+	}
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if event := rec.all()[0]; event.User != "" || event.Tags != nil {
+		t.Errorf("ended scope leaked into event: %+v", event)
+	}
+	if got := client.Stats().ScopeViolations; got != 1 {
+		t.Errorf("ScopeViolations = %d, want 1", got)
+	}
+
+	strict := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithStrictScopes())
+	before := *calls
+	if _, err := strict.CreateChatCompletion(ctx, req); !errors.Is(err, ErrScopeEnded) {
+		t.Fatalf("err = %v, want ErrScopeEnded", err)
+	}
+	if *calls != before {
+		t.Error("strict client still sent the request upstream")
+	}
+}
+
+func TestDerivedCarrierInheritsEverything(t *testing.T) {
+	ctx := ContextWithUser(context.Background(), "u1")
+	ctx = ContextWithSession(ctx, "sess_1")
+	ctx = ContextWithAttribute(ctx, "tier", 3)
+	ctx = ContextWithTelemetryEndpoint(ctx, "https://telemetry.example.com")
+	ctx = ContextWithoutTelemetry(ctx)
+	parent := carrierFrom(ctx)
+
+	derived := carrierFrom(deriveCarrier(ctx, func(*scopeCarrier) {}))
+	if !reflect.DeepEqual(*derived, *parent) {
+		t.Errorf("derived carrier = %+v, want %+v", *derived, *parent)
+	}
+}
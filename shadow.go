@@ -0,0 +1,154 @@
+package langmesh
+
+import (
+	"context"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultShadowTimeout bounds each shadow request
+	DefaultShadowTimeout = 30 * time.Second
+	// DefaultShadowMaxInFlight caps concurrent shadow requests
+	DefaultShadowMaxInFlight = 8
+)
+
+// ShadowMode configures WithShadowMode. Zero fields take the defaults.
+type ShadowMode struct {
+	// Model is the model shadow requests are sent to
+	Model string
+	// SampleRate is the fraction of chat requests shadowed, in (0, 1]; zero
+	// shadows every request
+	SampleRate float64
+	Timeout    time.Duration
+	// MaxInFlight caps concurrent shadow requests; requests sampled while
+	// it is reached are not shadowed
+	MaxInFlight int
+}
+
+// ShadowComparison is recorded on a shadow request's telemetry event,
+// pairing it with the primary request whose prompt it replayed
+type ShadowComparison struct {
+	PrimaryRequestID string  `json:"primary_request_id"`
+	PrimaryModel     string  `json:"primary_model"`
+	PrimaryLatencyMs int64   `json:"primary_latency_ms"`
+	PrimaryCostUSD   float64 `json:"primary_cost_usd"`
+	// PrimaryCompletion and PrimaryCompletionHash follow
+	// WithContentCapture, like the shadow event's own Completion
+	PrimaryCompletion     string `json:"primary_completion,omitempty"`
+	PrimaryCompletionHash string `json:"primary_completion_hash,omitempty"`
+	// OutputsMatch reports whether both models returned the same text
+	OutputsMatch bool `json:"outputs_match"`
+}
+
+// WithShadowMode replays a sample of successful chat completions against
+// cfg.Model in the background, to compare a candidate model's quality,
+// latency and cost with production traffic. The primary response is
+// returned as usual and never waits for, or sees errors from, its shadow.
+// Each shadow request is recorded as its own telemetry event with Shadow
+// set. Shadow requests skip guards and guardrails, but their spend reaches
+// budgets and other observers.
+func WithShadowMode(cfg ShadowMode) Option {
+	return func(c *Client) {
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultShadowTimeout
+		}
+		if cfg.MaxInFlight <= 0 {
+			cfg.MaxInFlight = DefaultShadowMaxInFlight
+		}
+		c.shadow = &shadowRunner{cfg: cfg, slots: make(chan struct{}, cfg.MaxInFlight)}
+	}
+}
+
+type shadowRunner struct {
+	cfg   ShadowMode
+	slots chan struct{}
+}
+
+// shadowChat starts the shadow of a successful chat completion described
+// by primary, if the request is sampled
+func (c *Client) shadowChat(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	resp openai.ChatCompletionResponse,
+	primary TelemetryEvent,
+) {
+	s := c.shadow
+	if s == nil || s.cfg.Model == "" || request.Model == s.cfg.Model {
+		return
+	}
+	if rate := s.cfg.SampleRate; rate > 0 && rate < 1 && !sampledIn(primary.RequestID, rate) {
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		c.log(ctx, LogRequest, "shadow request skipped, too many in flight", "request_id", primary.RequestID)
+		return
+	}
+
+	comparison := &ShadowComparison{
+		PrimaryRequestID: primary.RequestID,
+		PrimaryModel:     primary.Model,
+		PrimaryLatencyMs: primary.LatencyMs,
+		PrimaryCostUSD:   primary.CostEstimateUSD,
+	}
+	primaryText := firstChoiceText(resp)
+	request.Model = s.cfg.Model
+	ctx = backgroundContext(ctx)
+	c.goroutine("shadow", func() {
+		defer func() { <-s.slots }()
+		c.runShadow(ctx, request, primaryText, comparison)
+	})
+}
+
+func (c *Client) runShadow(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	primaryText string,
+	comparison *ShadowComparison,
+) {
+	startTime := time.Now()
+	requestID := newRequestID()
+	ctx, cancel := context.WithTimeout(ctx, c.shadow.cfg.Timeout)
+	defer cancel()
+	ctx, _ = withCallState(ctx, requestID)
+
+	resp, err := c.Client.CreateChatCompletion(ctx, request)
+
+	event := c.newEvent(ctx, requestID, "chat.completions", request.Model, startTime, err)
+	event.TokenUsage = TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+	event.CostEstimateUSD = c.estimateCost(request.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	if err == nil {
+		if len(resp.Choices) > 0 {
+			event.FinishReason = string(resp.Choices[0].FinishReason)
+		}
+		event.SystemFingerprint = resp.SystemFingerprint
+		text := firstChoiceText(resp)
+		comparison.OutputsMatch = text == primaryText
+		if cfg := c.contentCapture; cfg != nil {
+			text, primaryText = c.redact(text), c.redact(primaryText)
+			if cfg.HashOnly {
+				event.CompletionHash = hashContent(text)
+				comparison.PrimaryCompletionHash = hashContent(primaryText)
+			} else {
+				event.Completion = truncate(text, cfg.MaxLength)
+				comparison.PrimaryCompletion = truncate(primaryText, cfg.MaxLength)
+			}
+		}
+	}
+	event.Shadow = comparison
+	c.recordTelemetry(event)
+}
+
+func firstChoiceText(resp openai.ChatCompletionResponse) string {
+	if len(resp.Choices) == 0 {
+		return ""
+	}
+	return resp.Choices[0].Message.Content
+}
@@ -0,0 +1,91 @@
+package langmesh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitForEvents polls rec until it holds n events
+func waitForEvents(t *testing.T, rec *eventRecorder, n int) []TelemetryEvent {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		events := rec.all()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShadowModeRecordsComparison(t *testing.T) {
+	srv, models := newFallbackServer(t, nil, "")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithContentCapture(ContentCaptureConfig{HashOnly: true}),
+		WithShadowMode(ShadowMode{Model: "gpt-4o"}))
+
+	ctx, cancel := context.WithCancel(ContextWithUser(context.Background(), "u1"))
+	resp, err := client.CreateChatCompletion(ctx, chatRequest("hi"))
+	cancel()
+	if err != nil || resp.Model != "gpt-4o-mini" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+
+	events := waitForEvents(t, rec, 2)
+	primary, shadow := events[0], events[1]
+	if primary.Shadow != nil || shadow.Shadow == nil {
+		t.Fatalf("events = %+v", events)
+	}
+	c := shadow.Shadow
+	if shadow.Model != "gpt-4o" || shadow.Status != "success" || shadow.User != "u1" ||
+		c.PrimaryRequestID != primary.RequestID || c.PrimaryModel != "gpt-4o-mini" ||
+		c.PrimaryCostUSD != primary.CostEstimateUSD || !c.OutputsMatch ||
+		c.PrimaryCompletionHash != shadow.CompletionHash || shadow.CompletionHash == "" {
+		t.Errorf("shadow = %+v, comparison = %+v", shadow, c)
+	}
+	if got := models(); len(got) != 2 || got[1] != "gpt-4o" {
+		t.Errorf("models = %v", got)
+	}
+}
+
+func TestShadowModeFailureDoesNotAffectPrimary(t *testing.T) {
+	srv, _ := newFallbackServer(t, map[string]int{"gpt-4o": 500}, "server_error")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithShadowMode(ShadowMode{Model: "gpt-4o"}))
+
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, 2)
+	if events[0].Status != "success" || events[1].Status != "error" || events[1].Shadow.OutputsMatch {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestShadowModeSampling(t *testing.T) {
+	srv, models := newFallbackServer(t, nil, "")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(&eventRecorder{}),
+		WithShadowMode(ShadowMode{Model: "gpt-4o", SampleRate: 0.25}))
+
+	for i := 0; i < 200; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	shadows := 0
+	for _, m := range models() {
+		if m == "gpt-4o" {
+			shadows++
+		}
+	}
+	if shadows < 20 || shadows > 80 {
+		t.Errorf("shadowed %d of 200 requests at rate 0.25", shadows)
+	}
+}
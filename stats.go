@@ -0,0 +1,102 @@
+package langmesh
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const latencyWindowSize = 1024
+
+// Stats is a snapshot of the client's in-process health tracking
+type Stats struct {
+	// ErrorBudgets is keyed by model; empty unless WithErrorBudget is set
+	ErrorBudgets map[string]ErrorBudgetStatus
+
+	// Latency is keyed by model and endpoint; empty unless
+	// WithLatencyTracking is set
+	Latency map[LatencyKey]LatencySummary
+
+	// ScopeViolations counts upstream requests made with a context whose
+	// request scope had already ended
+	ScopeViolations int64
+
+	// UninstrumentedCalls counts upstream requests made through methods
+	// that record no telemetry
+	UninstrumentedCalls int64
+
+	// CancelledCalls counts calls, streams included, that ended because
+	// their caller cancelled the context
+	CancelledCalls int64
+}
+
+// Stats returns the current in-process statistics
+func (c *Client) Stats() Stats {
+	s := Stats{
+		ScopeViolations:     c.scopeViolations.Load(),
+		UninstrumentedCalls: c.uninstrumentedCalls.Load(),
+		CancelledCalls:      c.cancelledCalls.Load(),
+	}
+	if c.errorBudgets != nil {
+		s.ErrorBudgets = c.errorBudgets.snapshot()
+	}
+	if c.latency != nil {
+		s.Latency = c.latency.snapshot()
+	}
+	return s
+}
+
+// LatencySummary describes a latency distribution over recent samples
+type LatencySummary struct {
+	Count int64
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// latencyWindow keeps the most recent samples in a ring buffer and reports
+// percentiles over them
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.count++
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) summary() LatencySummary {
+	w.mu.Lock()
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	count := w.count
+	w.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return LatencySummary{
+		Count: count,
+		P50:   percentile(sorted, 0.50),
+		P95:   percentile(sorted, 0.95),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
@@ -0,0 +1,265 @@
+package langmesh
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultStatsDAddr is where a local Datadog agent listens for DogStatsD
+	DefaultStatsDAddr = "127.0.0.1:8125"
+	// DefaultStatsDPacketSize keeps UDP packets under a typical MTU
+	DefaultStatsDPacketSize = 1432
+	// DefaultStatsDFlushInterval bounds how long a metric waits in a
+	// partly filled packet
+	DefaultStatsDFlushInterval = time.Second
+
+	statsDQueueSize = 4096
+)
+
+// StatsDConfig configures NewStatsDEmitter. Zero fields take the defaults.
+type StatsDConfig struct {
+	// Addr is host:port for UDP, or unix:///path for a Unix socket. It
+	// defaults to DD_AGENT_HOST and DD_DOGSTATSD_PORT if set, else
+	// DefaultStatsDAddr.
+	Addr string
+	// Namespace prefixes every metric name; default "langmesh."
+	Namespace string
+	// Tags are added to every metric, e.g. "env:prod"
+	Tags []string
+	// TagKeys copies these request tags (ContextWithTag) onto call metrics. Other
+	// tags are left off to bound cardinality.
+	TagKeys       []string
+	FlushInterval time.Duration
+	MaxPacketSize int
+}
+
+// StatsDEmitter sends DogStatsD metrics over UDP or a Unix socket. Metrics
+// are queued and packed into packets in the background, so emitting never
+// blocks; metrics arriving while the queue is full are dropped and counted.
+type StatsDEmitter struct {
+	cfg     StatsDConfig
+	conn    net.Conn
+	queue   chan string
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// NewStatsDEmitter connects to the agent at cfg.Addr
+func NewStatsDEmitter(cfg StatsDConfig) (*StatsDEmitter, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultStatsDAddr
+		if host := os.Getenv("DD_AGENT_HOST"); host != "" {
+			cfg.Addr = net.JoinHostPort(host, getEnv("DD_DOGSTATSD_PORT", "8125"))
+		}
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "langmesh."
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultStatsDFlushInterval
+	}
+	if cfg.MaxPacketSize <= 0 {
+		cfg.MaxPacketSize = DefaultStatsDPacketSize
+	}
+	network, addr := "udp", cfg.Addr
+	if path, ok := strings.CutPrefix(cfg.Addr, "unix://"); ok {
+		network, addr = "unixgram", path
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &StatsDEmitter{
+		cfg:     cfg,
+		conn:    conn,
+		queue:   make(chan string, statsDQueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// WithStatsD emits metrics for every call through e: langmesh.requests,
+// langmesh.latency, langmesh.tokens.prompt and .completion, and
+// langmesh.cost_usd, tagged with model, endpoint, status, provider and
+// cache_hit; and rate limit gauges when OpenAI reports them. Metrics count
+// every call, whatever the telemetry sampling.
+func WithStatsD(e *StatsDEmitter) Option {
+	return func(c *Client) {
+		c.observers = append(c.observers, e)
+	}
+}
+
+// Count adds value to a counter
+func (e *StatsDEmitter) Count(name string, value float64, tags ...string) {
+	e.emit(name, value, "c", tags)
+}
+
+// Gauge sets a gauge
+func (e *StatsDEmitter) Gauge(name string, value float64, tags ...string) {
+	e.emit(name, value, "g", tags)
+}
+
+// Timing records a duration, in milliseconds
+func (e *StatsDEmitter) Timing(name string, d time.Duration, tags ...string) {
+	e.emit(name, float64(d)/float64(time.Millisecond), "ms", tags)
+}
+
+// Dropped counts metrics lost to a full queue
+func (e *StatsDEmitter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Close flushes queued metrics and closes the connection
+func (e *StatsDEmitter) Close() error {
+	var err error
+	e.once.Do(func() {
+		close(e.done)
+		<-e.stopped
+		err = e.conn.Close()
+	})
+	return err
+}
+
+func (e *StatsDEmitter) observe(event TelemetryEvent) {
+	if event.Heartbeat {
+		return
+	}
+	tags := []string{
+		"model:" + event.Model,
+		"endpoint:" + event.Endpoint,
+		"status:" + event.Status,
+		"cache_hit:" + strconv.FormatBool(event.CacheHit),
+	}
+	if event.Provider != "" {
+		tags = append(tags, "provider:"+event.Provider)
+	}
+	if event.ErrorClass != "" {
+		tags = append(tags, "error_class:"+event.ErrorClass)
+	}
+	for _, key := range e.cfg.TagKeys {
+		if v, ok := event.Tags[key]; ok {
+			tags = append(tags, key+":"+v)
+		}
+	}
+
+	e.Count("requests", 1, tags...)
+	e.Timing("latency", time.Duration(event.LatencyMs)*time.Millisecond, tags...)
+	if u := event.TokenUsage; u.TotalTokens > 0 {
+		e.Count("tokens.prompt", float64(u.PromptTokens), tags...)
+		e.Count("tokens.completion", float64(u.CompletionTokens), tags...)
+	}
+	if event.CostEstimateUSD > 0 {
+		e.Count("cost_usd", event.CostEstimateUSD, tags...)
+	}
+	if rl := event.RateLimit; rl != nil {
+		model := "model:" + event.Model
+		e.Gauge("ratelimit.remaining_requests", float64(rl.RemainingRequests), model)
+		e.Gauge("ratelimit.remaining_tokens", float64(rl.RemainingTokens), model)
+	}
+}
+
+// emit formats a metric line and queues it, dropping it if the queue is
+// full or the emitter closed
+func (e *StatsDEmitter) emit(name string, value float64, kind string, tags []string) {
+	var b strings.Builder
+	b.WriteString(e.cfg.Namespace)
+	b.WriteString(statsDName(name))
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if len(tags)+len(e.cfg.Tags) > 0 {
+		b.WriteString("|#")
+		for i, tag := range append(append([]string(nil), e.cfg.Tags...), tags...) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(statsDTag(tag))
+		}
+	}
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	select {
+	case e.queue <- b.String():
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// run packs queued lines into packets, writing each when full or at the
+// flush interval
+func (e *StatsDEmitter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	var packet []byte
+	flush := func() {
+		if len(packet) > 0 {
+			// Delivery is best effort; an absent agent must not fail calls
+			_, _ = e.conn.Write(packet)
+			packet = packet[:0]
+		}
+	}
+	add := func(line string) {
+		if len(packet) > 0 && len(packet)+1+len(line) > e.cfg.MaxPacketSize {
+			flush()
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	for {
+		select {
+		case line := <-e.queue:
+			add(line)
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case line := <-e.queue:
+					add(line)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// statsDName replaces characters DogStatsD reserves in metric names
+func statsDName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// statsDTag replaces characters that would end a tag or the line
+func statsDTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, tag)
+}
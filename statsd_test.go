@@ -0,0 +1,88 @@
+package langmesh
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statsDListener receives DogStatsD packets, returning a function that
+// collects the lines received until none arrive for a while
+func statsDListener(t *testing.T) (string, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+}
+
+func TestStatsDEmitsCallMetrics(t *testing.T) {
+	addr, received := statsDListener(t)
+	emitter, err := NewStatsDEmitter(StatsDConfig{Addr: addr, Tags: []string{"env:test"}, TagKeys: []string{"team"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := newChatServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithStatsD(emitter))
+
+	ctx := ContextWithTag(ContextWithTag(context.Background(), "team", "search"), "user_email", "a@b.c")
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	emitter.Close()
+
+	lines := received()
+	byName := make(map[string]string)
+	for _, line := range lines {
+		byName[line[:strings.IndexByte(line, ':')]] = line
+	}
+	const tags = "|#env:test,model:gpt-4o-mini,endpoint:chat.completions,status:success,cache_hit:false,provider:openai,team:search"
+	for name, want := range map[string]string{
+		"langmesh.requests":          "langmesh.requests:1|c" + tags,
+		"langmesh.tokens.prompt":     "langmesh.tokens.prompt:10|c" + tags,
+		"langmesh.tokens.completion": "langmesh.tokens.completion:5|c" + tags,
+	} {
+		if byName[name] != want {
+			t.Errorf("%s = %q, want %q", name, byName[name], want)
+		}
+	}
+	if !strings.Contains(byName["langmesh.latency"], "|ms|#") || !strings.HasPrefix(byName["langmesh.cost_usd"], "langmesh.cost_usd:0.") {
+		t.Errorf("lines = %q", lines)
+	}
+	if strings.Contains(strings.Join(lines, "\n"), "user_email") {
+		t.Error("tag not in TagKeys was emitted")
+	}
+}
+
+func TestStatsDPacksPackets(t *testing.T) {
+	addr, received := statsDListener(t)
+	emitter, err := NewStatsDEmitter(StatsDConfig{Addr: addr, MaxPacketSize: 64, Namespace: "app."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		emitter.Gauge("queue depth", float64(i), "shard:a|b")
+	}
+	emitter.Close()
+	emitter.Count("after_close", 1)
+
+	lines := received()
+	if len(lines) != 20 || lines[3] != "app.queue_depth:3|g|#shard:a_b" {
+		t.Errorf("received %d lines: %q", len(lines), lines)
+	}
+}
@@ -0,0 +1,265 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatCompletionStream wraps openai.ChatCompletionStream and records one
+// telemetry event when the stream finishes, fails, or is closed. Streaming
+// responses carry no usage block, so token counts are estimated.
+type ChatCompletionStream struct {
+	*openai.ChatCompletionStream
+
+	client    *Client
+	ctx       context.Context
+	cancel    context.CancelFunc
+	requestID string
+	request   openai.ChatCompletionRequest
+	requested string
+	truncated int
+	startTime time.Time
+
+	// violations are the request's annotated guardrail violations
+	violations  []string
+	compression compressionResult
+	// journalKey is the stream's RequestJournal entry, completed when the
+	// stream ends
+	journalKey string
+
+	mu        sync.Mutex
+	assembled streamAssembler
+	usage     TokenUsage
+	recorded  bool
+	stop      chan struct{}
+	// release stops finishOnCancel's watch of ctx
+	release func() bool
+}
+
+// WithStreamHeartbeat records an in-progress telemetry event every interval
+// while a stream is open, carrying the tokens received and time elapsed so
+// far, so long-running streams are visible before they finish. Heartbeats
+// have Status "in_progress", no cost, and share the stream's request ID.
+func WithStreamHeartbeat(interval time.Duration) Option {
+	return func(c *Client) {
+		c.streamHeartbeat = interval
+	}
+}
+
+// CreateChatCompletionStream wraps the original method with guards,
+// redaction, and telemetry
+func (c *Client) CreateChatCompletionStream(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+) (*ChatCompletionStream, error) {
+	if v := c.policyView(ctx); v != nil {
+		return v.CreateChatCompletionStream(ctx, request)
+	}
+
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	// The timeout must outlive this call, so it is released when the
+	// stream is closed rather than deferred here
+	ctx, cancel := c.withEndpointTimeout(ctx, EndpointChat)
+	ctx, _ = withCallState(ctx, requestID)
+
+	original := request
+	ctx, request = c.assignExperiment(ctx, request)
+	request = c.applySystemPrompt(ctx, request)
+	request = c.applyRequestPolicy(ctx, request)
+	request = c.redactRequest(request)
+	request, compression := c.compressPrompt(ctx, request)
+	request, truncated := c.manageContext(ctx, request)
+
+	var inner *openai.ChatCompletionStream
+	var violations []string
+	requested := request.Model
+	err := c.checkModel(request, true)
+	if err == nil {
+		err = c.checkGuards(ctx, request)
+	}
+	if err == nil {
+		violations, err = c.checkRequestGuardrails(ctx, request)
+	}
+	var journalKey string
+	if err == nil {
+		journalKey, err = c.beginJournal(ctx, original, true)
+	}
+	if err == nil {
+		inner, request, err = withFallback(ctx, c, request, true, c.Client.CreateChatCompletionStream)
+		err = upstreamError(ctx, err)
+	}
+
+	stream := &ChatCompletionStream{
+		ChatCompletionStream: inner,
+		client:               c,
+		ctx:                  ctx,
+		cancel:               cancel,
+		requestID:            requestID,
+		request:              request,
+		requested:            requested,
+		truncated:            truncated,
+		violations:           violations,
+		compression:          compression,
+		startTime:            startTime,
+		journalKey:           journalKey,
+	}
+	if err != nil {
+		stream.finishWith(err)
+		cancel()
+		return nil, err
+	}
+	stream.finishOnCancel()
+	if c.streamHeartbeat > 0 && c.instrumented(ctx) {
+		stream.stop = make(chan struct{})
+		c.goroutine("stream.heartbeat", func() { stream.heartbeat(c.streamHeartbeat) })
+	}
+	return stream, nil
+}
+
+// Recv returns the next chunk, recording telemetry once the stream ends
+func (s *ChatCompletionStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	resp, err := s.ChatCompletionStream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			s.finishWith(nil)
+		} else {
+			s.finishWith(err)
+		}
+		return resp, err
+	}
+
+	s.mu.Lock()
+	s.assembled.add(resp)
+	s.mu.Unlock()
+	return resp, nil
+}
+
+// Close releases the stream, recording telemetry if it has not ended yet
+func (s *ChatCompletionStream) Close() {
+	if s.ChatCompletionStream != nil {
+		s.ChatCompletionStream.Close()
+	}
+	s.finishWith(nil)
+	s.cancel()
+}
+
+// Content returns the assistant text received so far on choice 0
+func (s *ChatCompletionStream) Content() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.assembled.text(0)
+}
+
+// toolCalls returns choice 0's tool calls received so far, the last one
+// possibly incomplete
+func (s *ChatCompletionStream) toolCalls() []openai.ToolCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.assembled.message(0).ToolCalls
+}
+
+// response returns the assembled response, with the usage estimated once
+// the stream has ended
+func (s *ChatCompletionStream) response() openai.ChatCompletionResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := s.assembled.response()
+	resp.Usage = openai.Usage{
+		PromptTokens:     s.usage.PromptTokens,
+		CompletionTokens: s.usage.CompletionTokens,
+		TotalTokens:      s.usage.TotalTokens,
+	}
+	return resp
+}
+
+func (s *ChatCompletionStream) finishWith(err error) {
+	s.mu.Lock()
+	if s.recorded {
+		s.mu.Unlock()
+		return
+	}
+	s.recorded = true
+	if s.release != nil {
+		s.release()
+	}
+	message := s.assembled.message(0)
+	var finish openai.FinishReason
+	if len(s.assembled.choices) > 0 {
+		finish = s.assembled.choices[0].finish
+	}
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	c := s.client
+	c.completeJournal(s.ctx, s.journalKey)
+	// A cancelled stream is billed for what was generated before it stopped
+	partial := err == nil || isCancelled(err)
+	var usage TokenUsage
+	if partial {
+		prompt := c.countPromptTokens(s.request.Model, s.request.Messages)
+		completion := c.countTokens(s.request.Model, completionText(message))
+		usage = TokenUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+		s.mu.Lock()
+		s.usage = usage
+		s.mu.Unlock()
+	}
+	if !c.instrumented(s.ctx) {
+		return
+	}
+	event := c.newEvent(s.ctx, s.requestID, "chat.completions", s.request.Model, s.startTime, err)
+	if s.request.Model != s.requested {
+		event.FallbackFrom = s.requested
+	}
+	event.Stream = true
+	event.TruncatedMessages = s.truncated
+	event.GuardrailViolations = s.violations
+	s.compression.apply(&event)
+	if partial {
+		event.FinishReason = string(finish)
+		event.TokenUsage = usage
+		event.CostEstimateUSD = c.estimateCost(s.request.Model, usage.PromptTokens, usage.CompletionTokens)
+		c.captureContent(&event, s.request, openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: message}},
+		})
+	}
+	c.recordTelemetry(event)
+}
+
+func (s *ChatCompletionStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// Holding mu keeps a heartbeat from landing after the final event
+		s.mu.Lock()
+		if !s.recorded {
+			c := s.client
+			event := c.newEvent(s.ctx, s.requestID, "chat.completions", s.request.Model, s.startTime, nil)
+			event.Status = "in_progress"
+			event.Heartbeat = true
+			completionTokens := c.countTokens(s.request.Model, completionText(s.assembled.message(0)))
+			prompt := c.countPromptTokens(s.request.Model, s.request.Messages)
+			event.TokenUsage = TokenUsage{
+				PromptTokens:     prompt,
+				CompletionTokens: completionTokens,
+				TotalTokens:      prompt + completionTokens,
+			}
+			c.recordTelemetry(event)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,202 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// StreamCollector reads a chat completion stream to the end and assembles
+// the response it would have returned unstreamed: every choice's message,
+// with tool call fragments joined, and the usage recorded in telemetry.
+type StreamCollector struct {
+	// OnChunk, if set, is called with every chunk as it arrives
+	OnChunk func(chunk openai.ChatCompletionStreamResponse)
+	// OnContent, if set, is called with each piece of choice 0's text
+	OnContent func(delta string)
+}
+
+// Collect drains and closes stream. On error it returns what was assembled
+// before the failure.
+func (sc StreamCollector) Collect(stream *ChatCompletionStream) (openai.ChatCompletionResponse, error) {
+	defer stream.Close()
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stream.response(), err
+		}
+		if sc.OnChunk != nil {
+			sc.OnChunk(chunk)
+		}
+		if sc.OnContent != nil {
+			for _, choice := range chunk.Choices {
+				if choice.Index == 0 && choice.Delta.Content != "" {
+					sc.OnContent(choice.Delta.Content)
+				}
+			}
+		}
+	}
+	return stream.response(), nil
+}
+
+// CollectChatCompletionStream creates a stream and collects it, for callers
+// that want streaming's callbacks but the complete response at the end
+func (c *Client) CollectChatCompletionStream(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	collector StreamCollector,
+) (openai.ChatCompletionResponse, error) {
+	stream, err := c.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	return collector.Collect(stream)
+}
+
+// streamAssembler joins chunk deltas into complete choices
+type streamAssembler struct {
+	id      string
+	model   string
+	created int64
+	choices []*assembledChoice
+}
+
+type assembledChoice struct {
+	role      string
+	content   strings.Builder
+	function  *openai.FunctionCall
+	toolCalls []openai.ToolCall
+	// arguments holds each tool call's argument fragments
+	arguments    []*strings.Builder
+	functionArgs strings.Builder
+	finish       openai.FinishReason
+}
+
+func (a *streamAssembler) add(chunk openai.ChatCompletionStreamResponse) {
+	if a.id == "" {
+		a.id, a.model, a.created = chunk.ID, chunk.Model, chunk.Created
+	}
+	for _, delta := range chunk.Choices {
+		if delta.Index < 0 {
+			continue
+		}
+		for len(a.choices) <= delta.Index {
+			a.choices = append(a.choices, &assembledChoice{})
+		}
+		choice := a.choices[delta.Index]
+		if delta.Delta.Role != "" {
+			choice.role = delta.Delta.Role
+		}
+		choice.content.WriteString(delta.Delta.Content)
+		if fc := delta.Delta.FunctionCall; fc != nil {
+			if choice.function == nil {
+				choice.function = &openai.FunctionCall{}
+			}
+			if fc.Name != "" {
+				choice.function.Name = fc.Name
+			}
+			choice.functionArgs.WriteString(fc.Arguments)
+		}
+		for _, call := range delta.Delta.ToolCalls {
+			choice.addToolCall(call)
+		}
+		if delta.FinishReason != "" {
+			choice.finish = delta.FinishReason
+		}
+	}
+}
+
+// addToolCall starts a tool call on its first fragment, which carries the
+// ID and name, and appends later fragments' arguments to it
+func (choice *assembledChoice) addToolCall(call openai.ToolCall) {
+	i := len(choice.toolCalls) - 1
+	if call.Index != nil {
+		i = *call.Index
+	}
+	if i < 0 || (call.Index == nil && call.ID != "") {
+		i = len(choice.toolCalls)
+	}
+	for len(choice.toolCalls) <= i {
+		choice.toolCalls = append(choice.toolCalls, openai.ToolCall{})
+		choice.arguments = append(choice.arguments, &strings.Builder{})
+	}
+	tc := &choice.toolCalls[i]
+	if call.ID != "" {
+		tc.ID = call.ID
+	}
+	if call.Type != "" {
+		tc.Type = call.Type
+	}
+	if call.Function.Name != "" {
+		tc.Function.Name = call.Function.Name
+	}
+	choice.arguments[i].WriteString(call.Function.Arguments)
+}
+
+// text returns choice i's content so far
+func (a *streamAssembler) text(i int) string {
+	if i >= len(a.choices) {
+		return ""
+	}
+	return a.choices[i].content.String()
+}
+
+func (a *streamAssembler) message(i int) openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	if i >= len(a.choices) {
+		return msg
+	}
+	choice := a.choices[i]
+	if choice.role != "" {
+		msg.Role = choice.role
+	}
+	msg.Content = choice.content.String()
+	if choice.function != nil {
+		msg.FunctionCall = &openai.FunctionCall{Name: choice.function.Name, Arguments: choice.functionArgs.String()}
+	}
+	for j, call := range choice.toolCalls {
+		call.Index = nil
+		call.Function.Arguments = choice.arguments[j].String()
+		msg.ToolCalls = append(msg.ToolCalls, call)
+	}
+	return msg
+}
+
+func (a *streamAssembler) response() openai.ChatCompletionResponse {
+	resp := openai.ChatCompletionResponse{
+		ID:      a.id,
+		Object:  "chat.completion",
+		Created: a.created,
+		Model:   a.model,
+	}
+	for i, choice := range a.choices {
+		resp.Choices = append(resp.Choices, openai.ChatCompletionChoice{
+			Index:        i,
+			Message:      a.message(i),
+			FinishReason: choice.finish,
+		})
+	}
+	return resp
+}
+
+// completionText is the text of msg that the model generated, for
+// estimating its tokens
+func completionText(msg openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	b.WriteString(msg.Content)
+	if msg.FunctionCall != nil {
+		b.WriteString(msg.FunctionCall.Name)
+		b.WriteString(msg.FunctionCall.Arguments)
+	}
+	for _, call := range msg.ToolCalls {
+		b.WriteString(call.Function.Name)
+		b.WriteString(call.Function.Arguments)
+	}
+	return b.String()
+}
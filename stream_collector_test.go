@@ -0,0 +1,69 @@
+package langmesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStreamCollectorAssemblesToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"index":0,"delta":{"role":"assistant","content":"Checking"}}`,
+		`{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}`,
+		`{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}`,
+		`{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"time","arguments":"{}"}}]}}`,
+		`{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Oslo\"}"}}]}}`,
+		`{"index":0,"delta":{},"finish_reason":"tool_calls"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, choice := range chunks {
+			fmt.Fprintf(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[%s]}\n\n", choice)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+
+	var seen int
+	var text strings.Builder
+	resp, err := client.CollectChatCompletionStream(context.Background(), chatRequest("weather in Oslo?"), StreamCollector{
+		OnChunk:   func(openai.ChatCompletionStreamResponse) { seen++ },
+		OnContent: func(delta string) { text.WriteString(delta) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(chunks) || text.String() != "Checking" {
+		t.Errorf("callbacks saw %d chunks, text %q", seen, text.String())
+	}
+	if resp.ID != "c1" || len(resp.Choices) != 1 || resp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Fatalf("resp = %+v", resp)
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content != "Checking" || len(msg.ToolCalls) != 2 {
+		t.Fatalf("message = %+v", msg)
+	}
+	if call := msg.ToolCalls[0]; call.ID != "call_1" || call.Function.Name != "weather" ||
+		call.Function.Arguments != `{"city":"Oslo"}` || call.Index != nil {
+		t.Errorf("first call = %+v", call)
+	}
+	if call := msg.ToolCalls[1]; call.ID != "call_2" || call.Function.Arguments != "{}" {
+		t.Errorf("second call = %+v", call)
+	}
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events", len(events))
+	}
+	usage := events[0].TokenUsage
+	if resp.Usage.TotalTokens != usage.TotalTokens || usage.CompletionTokens <= 1 {
+		t.Errorf("response usage %+v, telemetry %+v", resp.Usage, usage)
+	}
+}
@@ -0,0 +1,226 @@
+package langmesh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultRelayHeartbeat is how long a relayed stream may sit idle before
+// the client is sent a keepalive, unless configured
+const DefaultRelayHeartbeat = 15 * time.Second
+
+// WriteTo writes choice 0's content to w piece by piece as it streams in,
+// flushing w after each piece when it supports flushing, and closes the
+// stream once it ends. It implements io.WriterTo.
+func (s *ChatCompletionStream) WriteTo(w io.Writer) (int64, error) {
+	defer s.Close()
+	flusher, _ := w.(http.Flusher)
+	var written int64
+	for {
+		chunk, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 || choice.Delta.Content == "" {
+				continue
+			}
+			n, err := io.WriteString(w, choice.Delta.Content)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// StreamRelay relays a ChatCompletionStream to an HTTP client as it
+// arrives, flushing every chunk. Create the stream with the request's
+// context, so a client that disconnects cancels the upstream call and it
+// is recorded as cancelled.
+type StreamRelay struct {
+	// Heartbeat is how long the connection may sit idle before a keepalive
+	// is sent, so proxies do not time it out. Zero means
+	// DefaultRelayHeartbeat; negative disables keepalives.
+	Heartbeat time.Duration
+	// ContentOnly sends only choice 0's content, as {"content": "..."},
+	// instead of whole chunks in OpenAI's format
+	ContentOnly bool
+}
+
+// RelaySSE relays stream to the client as server-sent events with the
+// default StreamRelay
+func RelaySSE(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	return StreamRelay{}.SSE(w, r, stream)
+}
+
+// RelayNDJSON relays stream to the client as newline-delimited JSON with
+// the default StreamRelay
+func RelayNDJSON(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	return StreamRelay{}.NDJSON(w, r, stream)
+}
+
+// SSE relays stream as server-sent events, the way OpenAI streams: a data
+// event per chunk, then "data: [DONE]". A stream that fails midway ends
+// with an "error" event. Keepalives are SSE comments. It returns once the
+// stream ends, with its error, or the client disconnects, with the
+// request context's error, and closes the stream either way.
+func (rl StreamRelay) SSE(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	return rl.relay(w, r, stream, relayFormat{
+		contentType: "text/event-stream",
+		data:        "data: %s\n\n",
+		done:        "data: [DONE]\n\n",
+		fail:        "event: error\ndata: %s\n\n",
+		heartbeat:   ": ping\n\n",
+	})
+}
+
+// NDJSON relays stream as newline-delimited JSON, a line per chunk. A
+// stream that fails midway ends with an {"error": ...} line. Keepalives
+// are blank lines, which readers should skip. It returns like SSE.
+func (rl StreamRelay) NDJSON(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	return rl.relay(w, r, stream, relayFormat{
+		contentType: "application/x-ndjson",
+		data:        "%s\n",
+		fail:        "%s\n",
+		heartbeat:   "\n",
+	})
+}
+
+// relayFormat frames a relay's messages; data and fail take a JSON payload
+type relayFormat struct {
+	contentType string
+	data        string
+	done        string
+	fail        string
+	heartbeat   string
+}
+
+type relayChunk struct {
+	chunk openai.ChatCompletionStreamResponse
+	err   error
+}
+
+func (rl StreamRelay) relay(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream, f relayFormat) error {
+	defer stream.Close()
+	header := w.Header()
+	header.Set("Content-Type", f.contentType)
+	header.Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the response
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	// Chunks are received one at a time, so a slow client slows the read
+	// of the upstream stream rather than piling chunks up in memory
+	chunks := make(chan relayChunk)
+	done := make(chan struct{})
+	defer close(done)
+	stream.client.goroutine("stream.relay", func() {
+		for {
+			chunk, err := stream.Recv()
+			select {
+			case chunks <- relayChunk{chunk, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	interval := rl.Heartbeat
+	if interval == 0 {
+		interval = DefaultRelayHeartbeat
+	}
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if interval > 0 {
+		timer = time.NewTimer(interval)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			stream.abort()
+			return r.Context().Err()
+		case <-idle:
+			if err := write(f.heartbeat); err != nil {
+				return err
+			}
+			timer.Reset(interval)
+		case next := <-chunks:
+			if errors.Is(next.err, io.EOF) {
+				if f.done != "" {
+					return write(f.done)
+				}
+				return nil
+			}
+			if next.err != nil {
+				data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": next.err.Error()}})
+				write(f.fail, data)
+				return next.err
+			}
+			data, ok := rl.payload(next.chunk)
+			if !ok {
+				continue
+			}
+			if err := write(f.data, data); err != nil {
+				return err
+			}
+			if timer != nil {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(interval)
+			}
+		}
+	}
+}
+
+// payload encodes chunk for the client, reporting false for a chunk with
+// nothing to send
+func (rl StreamRelay) payload(chunk openai.ChatCompletionStreamResponse) ([]byte, bool) {
+	if !rl.ContentOnly {
+		data, err := json.Marshal(chunk)
+		return data, err == nil
+	}
+	var content string
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 {
+			content += choice.Delta.Content
+		}
+	}
+	if content == "" {
+		return nil, false
+	}
+	data, err := json.Marshal(map[string]string{"content": content})
+	return data, err == nil
+}
@@ -0,0 +1,128 @@
+package langmesh
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// relayServer serves client's stream of the request through relay
+func relayServer(t *testing.T, client *Client, relay func(http.ResponseWriter, *http.Request, *ChatCompletionStream) error) (*httptest.Server, chan error) {
+	t.Helper()
+	result := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream, err := client.CreateChatCompletionStream(r.Context(), chatRequest("hi"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			result <- err
+			return
+		}
+		result <- relay(w, r, stream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, result
+}
+
+func TestRelaySSE(t *testing.T) {
+	upstream := newStreamServer(t, "Hel", "lo")
+	client := NewClient("test-key", WithBaseURL(upstream.URL))
+	srv, result := relayServer(t, client, RelaySSE)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %q", ct)
+	}
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if len(events) != 3 || !strings.Contains(events[0], `"content":"Hel"`) || events[2] != "data: [DONE]" {
+		t.Errorf("events = %q", events)
+	}
+}
+
+func TestRelayNDJSONContentOnly(t *testing.T) {
+	upstream := newStreamServer(t, "Hel", "lo")
+	client := NewClient("test-key", WithBaseURL(upstream.URL))
+	srv, result := relayServer(t, client, StreamRelay{ContentOnly: true}.NDJSON)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "{\"content\":\"Hel\"}\n{\"content\":\"lo\"}\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestRelayHeartbeatAndDisconnect(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"slow\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(upstream.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(upstream.URL), withRecorder(rec))
+	srv, result := relayServer(t, client, StreamRelay{Heartbeat: 10 * time.Millisecond}.SSE)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	pings := 0
+	for pings < 2 && lines.Scan() {
+		if lines.Text() == ": ping" {
+			pings++
+		}
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("relay err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop when the client went away")
+	}
+	if events := rec.all(); len(events) != 1 || events[0].Status != "cancelled" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestStreamWriteTo(t *testing.T) {
+	srv := newStreamServer(t, "Hello", ", ", "world")
+	client := NewClient("test-key", WithBaseURL(srv.URL))
+	stream, err := client.CreateChatCompletionStream(context.Background(), chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	n, err := stream.WriteTo(&out)
+	if err != nil || n != 12 || out.String() != "Hello, world" {
+		t.Errorf("WriteTo = %d, %v, %q", n, err, out.String())
+	}
+}
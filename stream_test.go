@@ -0,0 +1,115 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newStreamServer streams each piece as a content delta, then [DONE]
+func newStreamServer(t *testing.T, pieces ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, p := range pieces {
+			finish := "null"
+			if i == len(pieces)-1 {
+				finish = `"stop"`
+			}
+			fmt.Fprintf(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":%s}]}\n\n", p, finish)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestChatStreamRecordsTelemetryAtEOF(t *testing.T) {
+	srv := newStreamServer(t, "Hello", ", ", "world")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Close()
+
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+	}
+	if stream.Content() != "Hello, world" {
+		t.Errorf("content = %q", stream.Content())
+	}
+	stream.Close()
+
+	events := rec.all()
+	if len(events) != 1 {
+		t.Fatalf("expected exactly one event, got %d", len(events))
+	}
+	if events[0].Status != "success" || events[0].TokenUsage.CompletionTokens == 0 {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestChatStreamHeartbeats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"thinking hard\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(80 * time.Millisecond)
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" done\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithStreamHeartbeat(20*time.Millisecond), withRecorder(rec))
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+	time.Sleep(40 * time.Millisecond)
+
+	events := rec.all()
+	if len(events) < 2 {
+		t.Fatalf("got %d events, want heartbeats before the final event", len(events))
+	}
+	final := events[len(events)-1]
+	if final.Heartbeat || final.Status != "success" {
+		t.Errorf("last event = %+v, want the final success event", final)
+	}
+	for _, event := range events[:len(events)-1] {
+		if !event.Heartbeat || event.Status != "in_progress" || event.RequestID != final.RequestID {
+			t.Errorf("heartbeat = %+v", event)
+		}
+		if event.CostEstimateUSD != 0 || event.TokenUsage.CompletionTokens == 0 {
+			t.Errorf("heartbeat usage = %+v cost=%v", event.TokenUsage, event.CostEstimateUSD)
+		}
+	}
+}
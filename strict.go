@@ -0,0 +1,132 @@
+package langmesh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ErrMisconfigured matches every error strict mode reports via errors.Is
+var ErrMisconfigured = errors.New("langmesh: misconfigured")
+
+// strictProbeTimeout bounds the reachability check of each telemetry
+// endpoint at construction
+const strictProbeTimeout = 3 * time.Second
+
+// WithStrictMode turns misconfigurations that otherwise degrade quietly into
+// errors: an unreachable telemetry endpoint, the proxy enabled without a
+// langmesh key, models with no known pricing, and token counts that would be
+// estimated because no tokenizer is configured. Problems found at
+// construction fail every call; per-request problems fail that request.
+func WithStrictMode() Option {
+	return func(c *Client) {
+		c.strict = true
+	}
+}
+
+// NewStrictClient is NewClient with strict mode, returning the problems
+// found at construction instead of deferring them to the first call. The
+// client is closed when it is not returned.
+func NewStrictClient(authToken string, opts ...Option) (*Client, error) {
+	client := NewClient(authToken, append(opts, WithStrictMode())...)
+	if err := client.configErr; err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// checkConfig reports misconfigurations visible without network access
+func (c *Client) checkConfig() error {
+	var errs []error
+	if langmeshProxyEnabled && langmeshAPIKey == "" {
+		errs = append(errs, misconfigured("langmesh_PROXY_ENABLED is set but langmesh_API_KEY is not"))
+	}
+	if err := c.telemetrySecurity.err; err != nil {
+		errs = append(errs, misconfigured("%v", err))
+	}
+	for primary, chain := range c.fallbacks {
+		for _, model := range append([]string{primary}, chain...) {
+			if !c.knownPricing(model) {
+				errs = append(errs, misconfigured("fallback model %s has no known pricing", model))
+			}
+		}
+	}
+	if c.tokenizer == nil {
+		for _, g := range c.guards {
+			if _, ok := g.(maxCostGuard); ok {
+				errs = append(errs, misconfigured("max request cost guard needs WithTokenizer"))
+			}
+		}
+	}
+	if c.proxyTokens != nil && c.keyPool != nil && langmeshProxyEnabled {
+		errs = append(errs, misconfigured("proxy token exchange does not send key pool keys"))
+	}
+	if c.audit != nil && c.audit.cfg.Store == nil {
+		errs = append(errs, misconfigured("audit log has no store"))
+	}
+	if c.latency != nil {
+		for _, slo := range c.latency.cfg.SLOs {
+			if slo.Percentile <= 0 || slo.Percentile > 1 {
+				errs = append(errs, misconfigured("latency SLO percentile %v is not between 0 and 1", slo.Percentile))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkSinks dials each HTTP telemetry endpoint
+func (c *Client) checkSinks() error {
+	var errs []error
+	for _, p := range c.sinks {
+		sink, ok := p.sink.(*HTTPSink)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(sink.URL)
+		if err != nil || u.Host == "" {
+			errs = append(errs, misconfigured("telemetry sink %s has invalid URL %q", p.name, sink.URL))
+			continue
+		}
+		host := u.Host
+		if u.Port() == "" {
+			port := "443"
+			if u.Scheme == "http" {
+				port = "80"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		conn, err := net.DialTimeout("tcp", host, strictProbeTimeout)
+		if err != nil {
+			errs = append(errs, misconfigured("telemetry sink %s is unreachable: %v", p.name, err))
+			continue
+		}
+		conn.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// checkStrict fails a call in strict mode when the client is misconfigured
+// or model has no pricing. estimated marks calls whose token counts come
+// from the tokenizer rather than reported usage.
+func (c *Client) checkStrict(model string, estimated bool) error {
+	if !c.strict {
+		return nil
+	}
+	if c.configErr != nil {
+		return c.configErr
+	}
+	if !c.knownPricing(model) {
+		return misconfigured("model %s has no known pricing", model)
+	}
+	if estimated && c.tokenizer == nil {
+		return misconfigured("stream token counts for %s need WithTokenizer", model)
+	}
+	return nil
+}
+
+func misconfigured(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrMisconfigured, fmt.Sprintf(format, args...))
+}
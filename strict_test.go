@@ -0,0 +1,129 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStrictUnreachableTelemetry(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	_, err := NewStrictClient("test-key", WithTelemetrySink("dead", NewHTTPSink(dead.URL, "k")))
+	if !errors.Is(err, ErrMisconfigured) || !strings.Contains(err.Error(), "unreachable") {
+		t.Fatalf("err = %v", err)
+	}
+
+	live := httptest.NewServer(http.NotFoundHandler())
+	defer live.Close()
+	if _, err := NewStrictClient("test-key", WithTelemetrySink("live", NewHTTPSink(live.URL, "k"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictClientClosedOnError(t *testing.T) {
+	sink := TelemetrySinkFunc(func(context.Context, []TelemetryEvent) error { return nil })
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		// A max cost guard without a tokenizer is misconfigured
+		if _, err := NewStrictClient("test-key", WithTelemetrySink("s", sink), WithMaxRequestCost(1)); !errors.Is(err, ErrMisconfigured) {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before+5 {
+		t.Errorf("%d goroutines after failed constructions, %d before", n, before)
+	}
+}
+
+func TestStrictProxyWithoutKey(t *testing.T) {
+	defer func(enabled bool, key string) { langmeshProxyEnabled, langmeshAPIKey = enabled, key }(langmeshProxyEnabled, langmeshAPIKey)
+	langmeshProxyEnabled, langmeshAPIKey = true, ""
+
+	if _, err := NewStrictClient("test-key"); !errors.Is(err, ErrMisconfigured) {
+		t.Fatalf("err = %v", err)
+	}
+	if client := NewClient("test-key"); client.configErr != nil {
+		t.Errorf("non-strict client reported %v", client.configErr)
+	}
+}
+
+func TestStrictConstructionErrorFailsCalls(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithStrictMode(),
+		WithMaxRequestCost(1),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); !errors.Is(err, ErrMisconfigured) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := client.CreateImage(context.Background(), openai.ImageRequest{Prompt: "x"}); !errors.Is(err, ErrMisconfigured) {
+		t.Fatalf("image err = %v", err)
+	}
+	if atomic.LoadInt32(calls) != 0 {
+		t.Error("misconfigured client sent requests")
+	}
+}
+
+func TestStrictUnknownPricing(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), WithStrictMode())
+
+	req := openai.ChatCompletionRequest{Model: "mystery-1", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, err := client.CreateChatCompletion(context.Background(), req); !errors.Is(err, ErrMisconfigured) {
+		t.Fatalf("err = %v", err)
+	}
+	req.Model = "gpt-4o"
+	if _, err := client.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(calls) != 1 {
+		t.Errorf("calls = %d", atomic.LoadInt32(calls))
+	}
+
+	if _, err := NewStrictClient("test-key", WithModelFallback("gpt-4o", "mystery-1")); !errors.Is(err, ErrMisconfigured) {
+		t.Errorf("fallback err = %v", err)
+	}
+}
+
+func TestStrictStreamNeedsTokenizer(t *testing.T) {
+	srv := newStreamServer(t, "hello ", "world")
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithStrictMode())
+	if _, err := client.CreateChatCompletionStream(context.Background(), req); !errors.Is(err, ErrMisconfigured) {
+		t.Fatalf("err = %v", err)
+	}
+
+	rec := &eventRecorder{}
+	words := TokenizerFunc(func(_, text string) int { return len(strings.Fields(text)) })
+	client = NewClient("test-key", WithBaseURL(srv.URL), WithStrictMode(), WithTokenizer(words), withRecorder(rec))
+	stream, err := client.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+	if got := rec.all()[0].TokenUsage.CompletionTokens; got != 2 {
+		t.Errorf("completion tokens = %d, want the tokenizer's 2", got)
+	}
+}
@@ -0,0 +1,116 @@
+package langmesh
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// SystemPromptRequest describes the chat request a SystemPromptProvider
+// picks a system prompt for
+type SystemPromptRequest struct {
+	Model string
+	// User and Tags are those of the request scope, tags including the
+	// client's WithTags
+	User string
+	Tags map[string]string
+	// Experiment and Variant are the request's experiment assignment
+	Experiment string
+	Variant    string
+	// Current is the content of the request's leading system message, if
+	// it has one
+	Current string
+}
+
+// SystemPrompt is the system prompt a SystemPromptProvider chose
+type SystemPrompt struct {
+	Content string
+	// Version is recorded on the request's event as SystemPromptVersion
+	Version string
+	// Replace swaps out the request's own leading system message, instead
+	// of putting Content in front of it
+	Replace bool
+}
+
+// SystemPromptProvider picks the system prompt for a chat request, or
+// reports false to leave the request as it is
+type SystemPromptProvider func(ctx context.Context, req SystemPromptRequest) (SystemPrompt, bool)
+
+// WithSystemPromptProvider has p pick a system prompt for every chat
+// request, streamed or not, after any experiment variant is assigned and
+// before the RequestPolicy applies. Events record the version picked, so
+// the effect of a prompt change can be followed as it rolls out.
+func WithSystemPromptProvider(p SystemPromptProvider) Option {
+	return func(c *Client) {
+		c.systemPrompts = p
+	}
+}
+
+// SystemPromptRollout sends fraction of traffic, in [0, 1], the candidate
+// prompt and the rest the stable one. Requests with a user are assigned by
+// a hash of the user, so each user sees one prompt throughout, and move
+// from stable to candidate only once as fraction grows; others are split
+// at random.
+func SystemPromptRollout(stable, candidate SystemPrompt, fraction float64) SystemPromptProvider {
+	return func(ctx context.Context, req SystemPromptRequest) (SystemPrompt, bool) {
+		point := rand.Float64()
+		if req.User != "" {
+			h := fnv.New64a()
+			h.Write([]byte(req.User))
+			point = float64(h.Sum64()%10000) / 10000
+		}
+		if point < fraction {
+			return candidate, true
+		}
+		return stable, true
+	}
+}
+
+// applySystemPrompt puts the provider's system prompt into request,
+// noting its version on ctx's call
+func (c *Client) applySystemPrompt(ctx context.Context, request openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	if c.systemPrompts == nil {
+		return request
+	}
+	scope := ScopeFrom(ctx)
+	req := SystemPromptRequest{Model: request.Model, User: scope.User, Tags: scope.Tags}
+	if len(c.tags) > 0 {
+		tags := make(map[string]string, len(c.tags)+len(scope.Tags))
+		for k, v := range c.tags {
+			tags[k] = v
+		}
+		for k, v := range scope.Tags {
+			tags[k] = v
+		}
+		req.Tags = tags
+	}
+	if carrier := carrierFrom(ctx); carrier != nil {
+		req.Experiment = carrier.experiment.name
+		req.Variant = carrier.experiment.variant.Name
+	}
+	msgs := request.Messages
+	leading := len(msgs) > 0 && msgs[0].Role == openai.ChatMessageRoleSystem
+	if leading {
+		req.Current = msgs[0].Content
+	}
+
+	prompt, ok := c.systemPrompts(ctx, req)
+	if !ok {
+		return request
+	}
+	system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: prompt.Content}
+	switch {
+	case leading && prompt.Replace:
+		request.Messages = append([]openai.ChatCompletionMessage{system}, msgs[1:]...)
+	case !leading || msgs[0].Content != prompt.Content:
+		request.Messages = append([]openai.ChatCompletionMessage{system}, msgs...)
+	}
+	if state := callStateFrom(ctx); state != nil {
+		state.mu.Lock()
+		state.systemPromptVersion = prompt.Version
+		state.mu.Unlock()
+	}
+	return request
+}
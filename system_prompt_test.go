@@ -0,0 +1,85 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestSystemPromptProvider(t *testing.T) {
+	var mu sync.Mutex
+	var sent []openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		sent = append(sent, req)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, chatResponseBody)
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec), WithTags(map[string]string{"app": "support"}),
+		WithSystemPromptProvider(func(ctx context.Context, req SystemPromptRequest) (SystemPrompt, bool) {
+			if req.Tags["tier"] == "free" {
+				return SystemPrompt{}, false
+			}
+			return SystemPrompt{Content: "Be kind to " + req.Tags["app"] + " users.", Version: "v2", Replace: req.Current == "old"}, true
+		}))
+
+	request := chatRequest("hi")
+	request.Messages = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "old"}}, request.Messages...)
+	ctx := context.Background()
+	for _, call := range []struct {
+		ctx     context.Context
+		request openai.ChatCompletionRequest
+	}{
+		{ctx, request},
+		{ctx, chatRequest("hi")},
+		{ContextWithTag(ctx, "tier", "free"), chatRequest("hi")},
+	} {
+		if _, err := client.CreateChatCompletion(call.ctx, call.request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := sent[0].Messages; len(got) != 2 || got[0].Content != "Be kind to support users." {
+		t.Errorf("replaced = %+v", got)
+	}
+	if got := sent[1].Messages; len(got) != 2 || got[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("injected = %+v", got)
+	}
+	if got := sent[2].Messages; len(got) != 1 {
+		t.Errorf("skipped = %+v", got)
+	}
+	events := rec.all()
+	if events[0].SystemPromptVersion != "v2" || events[1].SystemPromptVersion != "v2" || events[2].SystemPromptVersion != "" {
+		t.Errorf("versions = %q, %q, %q", events[0].SystemPromptVersion, events[1].SystemPromptVersion, events[2].SystemPromptVersion)
+	}
+}
+
+func TestSystemPromptRollout(t *testing.T) {
+	stable := SystemPrompt{Content: "stable", Version: "v1"}
+	candidate := SystemPrompt{Content: "candidate", Version: "v2"}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		small, _ := SystemPromptRollout(stable, candidate, 0.1)(context.Background(), SystemPromptRequest{User: user})
+		large, _ := SystemPromptRollout(stable, candidate, 0.5)(context.Background(), SystemPromptRequest{User: user})
+		if small.Version == "v2" && large.Version != "v2" {
+			t.Fatalf("%s left the candidate as the rollout grew", user)
+		}
+		counts[small.Version]++
+	}
+	if counts["v2"] < 50 || counts["v2"] > 150 {
+		t.Errorf("candidate share at 10%% = %d of 1000", counts["v2"])
+	}
+}
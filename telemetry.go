@@ -0,0 +1,600 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const telemetryBatchSize = 10
+
+// TelemetrySink delivers batches of telemetry events to a backend. The
+// events slice is reused once Send returns, so sinks must copy anything they
+// keep.
+type TelemetrySink interface {
+	Send(ctx context.Context, events []TelemetryEvent) error
+}
+
+// TelemetrySinkFunc adapts a function to TelemetrySink
+type TelemetrySinkFunc func(ctx context.Context, events []TelemetryEvent) error
+
+// Send calls f
+func (f TelemetrySinkFunc) Send(ctx context.Context, events []TelemetryEvent) error {
+	return f(ctx, events)
+}
+
+// HTTPSink posts JSON batches to a langmesh-compatible telemetry endpoint
+type HTTPSink struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+	// Encryption, if set, envelope-encrypts each batch; see
+	// WithTelemetryEncryption
+	Encryption KeyWrapper
+}
+
+// NewHTTPSink creates a sink posting to url with the given bearer key
+func NewHTTPSink(url, apiKey string) *HTTPSink {
+	return &HTTPSink{
+		URL:        url,
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// maxPooledPayload keeps unusually large batch payloads from pinning memory
+// in payloadPool
+const maxPooledPayload = 1 << 20
+
+// batchPayload is a reusable buffer and encoder for HTTPSink request bodies
+type batchPayload struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var payloadPool = sync.Pool{New: func() any {
+	p := &batchPayload{}
+	p.enc = json.NewEncoder(&p.buf)
+	return p
+}}
+
+// Send posts events as {"events": [...]}
+func (s *HTTPSink) Send(ctx context.Context, events []TelemetryEvent) error {
+	payload := payloadPool.Get().(*batchPayload)
+	payload.buf.Reset()
+	payload.buf.WriteString(`{"events":[`)
+	for i := range events {
+		if i > 0 {
+			payload.buf.WriteByte(',')
+		}
+		if err := payload.enc.Encode(eventJSON(&events[i])); err != nil {
+			releasePayload(payload)
+			return err
+		}
+	}
+	payload.buf.WriteString("]}")
+
+	var body io.Reader = &pooledPayloadReader{payload: payload, r: bytes.NewReader(payload.buf.Bytes())}
+	size := payload.buf.Len()
+	if s.Encryption != nil {
+		sealed, err := sealEnvelope(s.Encryption, payload.buf.Bytes())
+		releasePayload(payload)
+		if err != nil {
+			return err
+		}
+		body, size = bytes.NewReader(sealed), len(sealed)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(size)
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.Encryption != nil {
+		req.Header.Set(encryptionHeader, envelopeAlgorithm)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("langmesh: telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func releasePayload(p *batchPayload) {
+	if p.buf.Cap() <= maxPooledPayload {
+		payloadPool.Put(p)
+	}
+}
+
+// pooledPayloadReader is a request body that returns its payload to
+// payloadPool when the transport closes it. Do can return while the
+// transport is still writing the body, after an early response, so the
+// payload cannot be released then.
+type pooledPayloadReader struct {
+	mu      sync.Mutex
+	payload *batchPayload
+	r       *bytes.Reader
+}
+
+func (p *pooledPayloadReader) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.payload == nil {
+		return 0, errors.New("langmesh: read of a closed telemetry payload")
+	}
+	return p.r.Read(b)
+}
+
+func (p *pooledPayloadReader) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.payload != nil {
+		releasePayload(p.payload)
+		p.payload = nil
+	}
+	return nil
+}
+
+// WithTelemetrySink adds a sink alongside the hosted endpoint. Each sink has
+// its own buffer and delivery stats, so several can be active at once while
+// migrating between backends.
+func WithTelemetrySink(name string, sink TelemetrySink) Option {
+	return func(c *Client) {
+		c.sinks = append(c.sinks, newSinkPipeline(name, sink))
+	}
+}
+
+// WithDedicatedTelemetrySink adds a sink that receives only the events of
+// requests routed to name with ContextWithTelemetryRoute, e.g. a customer whose
+// contract requires its metadata to go to its own endpoint and credentials.
+// Routed events never reach the general sinks.
+func WithDedicatedTelemetrySink(name string, sink TelemetrySink) Option {
+	return func(c *Client) {
+		p := newSinkPipeline(name, sink)
+		p.dedicated = true
+		c.sinks = append(c.sinks, p)
+	}
+}
+
+// ContextWithTelemetryRoute sends the telemetry of calls made with the returned
+// context to the dedicated sink named name instead of the general sinks. Events
+// routed to a name with no dedicated sink are dropped and counted in
+// TelemetryStats.Unrouted. BeginRequest starts a fresh scope, so route after
+// it.
+func ContextWithTelemetryRoute(ctx context.Context, name string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.route = name
+	})
+}
+
+// ContextWithoutTelemetry stops calls made with the returned context from
+// sending telemetry to any sink, e.g. health checks or sensitive requests.
+// Local observers such as budgets and error budgets still see them.
+func ContextWithoutTelemetry(ctx context.Context) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.muted = true
+	})
+}
+
+// ContextWithTelemetryEndpoint sends the telemetry of calls made with the
+// returned context to the HTTP endpoint at url, authenticated with
+// langmesh_API_KEY, instead of the client's sinks. It has no effect on a client
+// that sends no telemetry.
+func ContextWithTelemetryEndpoint(ctx context.Context, url string) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		c.sinkURL = url
+	})
+}
+
+// applyRoute copies the telemetry route on ctx onto event
+func applyRoute(ctx context.Context, event *TelemetryEvent) {
+	if carrier := carrierFrom(ctx); carrier != nil {
+		event.route = carrier.route
+		event.sinkURL = carrier.sinkURL
+		event.muted = carrier.muted
+	}
+}
+
+// urlSinks holds the pipelines created on demand for
+// ContextWithTelemetryEndpoint, one per URL, shared by a client and its policy
+// views
+type urlSinks struct {
+	mu       sync.Mutex
+	byURL    map[string]*sinkPipeline
+	security *telemetrySecurity
+}
+
+func (u *urlSinks) get(url string) *sinkPipeline {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p, ok := u.byURL[url]
+	if !ok {
+		if u.byURL == nil {
+			u.byURL = make(map[string]*sinkPipeline)
+		}
+		sink := NewHTTPSink(url, langmeshAPIKey)
+		if u.security != nil {
+			u.security.secure(sink)
+		}
+		p = newSinkPipeline(url, sink)
+		u.byURL[url] = p
+	}
+	return p
+}
+
+func (u *urlSinks) all() []*sinkPipeline {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make([]*sinkPipeline, 0, len(u.byURL))
+	for _, p := range u.byURL {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// SinkStats reports delivery results for one telemetry sink
+type SinkStats struct {
+	Name          string
+	EventsSent    int64
+	EventsFailed  int64
+	BatchesSent   int64
+	BatchesFailed int64
+	Pending       int
+	LastSuccess   time.Time
+	LastError     string
+	LastErrorAt   time.Time
+	// FlushLatency is the time from an event being recorded to its
+	// successful delivery
+	FlushLatency LatencySummary
+}
+
+// TelemetryStats is a snapshot of telemetry delivery across all sinks
+type TelemetryStats struct {
+	Sinks []SinkStats
+	// SampledOut counts events dropped by sampling or filtering
+	SampledOut int64
+	// Unrouted counts routed events dropped because no dedicated sink has
+	// the route's name
+	Unrouted int64
+}
+
+// TelemetryStats returns per-sink delivery stats in configuration order
+func (c *Client) TelemetryStats() TelemetryStats {
+	stats := TelemetryStats{
+		Sinks:      make([]SinkStats, 0, len(c.sinks)),
+		SampledOut: c.sampledOut.Load(),
+		Unrouted:   c.unrouted.Load(),
+	}
+	for _, p := range c.sinks {
+		stats.Sinks = append(stats.Sinks, p.snapshot())
+	}
+	for _, p := range c.urlSinks.all() {
+		stats.Sinks = append(stats.Sinks, p.snapshot())
+	}
+	return stats
+}
+
+// eventBatch holds buffered events and when each was queued. Batches are
+// handed from the pipeline to delivery and then recycled through batchPool.
+type eventBatch struct {
+	events   []TelemetryEvent
+	queuedAt []time.Time
+}
+
+var batchPool = sync.Pool{New: func() any {
+	return &eventBatch{
+		events:   make([]TelemetryEvent, 0, telemetryBatchSize),
+		queuedAt: make([]time.Time, 0, telemetryBatchSize),
+	}
+}}
+
+func (b *eventBatch) release() {
+	// Drop references held by the events before pooling
+	clear(b.events)
+	b.events = b.events[:0]
+	b.queuedAt = b.queuedAt[:0]
+	batchPool.Put(b)
+}
+
+type sinkPipeline struct {
+	name    string
+	sink    TelemetrySink
+	mu      sync.Mutex
+	buffer  *eventBatch
+	stats   SinkStats
+	latency latencyWindow
+
+	// dedicated pipelines take only events routed to them by name
+	dedicated bool
+}
+
+func newSinkPipeline(name string, sink TelemetrySink) *sinkPipeline {
+	return &sinkPipeline{
+		name:   name,
+		sink:   sink,
+		buffer: batchPool.Get().(*eventBatch),
+		stats:  SinkStats{Name: name},
+	}
+}
+
+// accepts reports whether event belongs in p: routed events go only to the
+// dedicated sink they name, others only to general sinks
+func (p *sinkPipeline) accepts(event *TelemetryEvent) bool {
+	if p.dedicated {
+		return event.route == p.name
+	}
+	return event.route == ""
+}
+
+func (p *sinkPipeline) add(event *TelemetryEvent) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buffer.events = append(p.buffer.events, *event)
+	p.buffer.queuedAt = append(p.buffer.queuedAt, time.Now())
+	return len(p.buffer.events) >= telemetryBatchSize
+}
+
+// take swaps out the buffered batch, or returns nil if it is empty
+func (p *sinkPipeline) take() *eventBatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buffer.events) == 0 {
+		return nil
+	}
+	batch := p.buffer
+	p.buffer = batchPool.Get().(*eventBatch)
+	return batch
+}
+
+// deliver sends batch to the sink, returning the error it failed with
+func (p *sinkPipeline) deliver(batch *eventBatch) error {
+	defer batch.release()
+	err := p.sink.Send(context.Background(), batch.events)
+	if err == nil {
+		now := time.Now()
+		for _, t := range batch.queuedAt {
+			p.latency.add(now.Sub(t))
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		// Silent drop - telemetry must never break user's app
+		p.stats.BatchesFailed++
+		p.stats.EventsFailed += int64(len(batch.events))
+		p.stats.LastError = err.Error()
+		p.stats.LastErrorAt = time.Now()
+		return err
+	}
+	p.stats.BatchesSent++
+	p.stats.EventsSent += int64(len(batch.events))
+	p.stats.LastSuccess = time.Now()
+	return nil
+}
+
+func (p *sinkPipeline) snapshot() SinkStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Pending = len(p.buffer.events)
+	s.FlushLatency = p.latency.summary()
+	return s
+}
+
+func (c *Client) recordTelemetry(event TelemetryEvent) {
+	if event.Status == "cancelled" {
+		c.cancelledCalls.Add(1)
+	}
+	c.applyCurrency(&event)
+	c.logFinished(&event)
+	event.callInfo.finish(&event)
+	for _, o := range c.observers {
+		o.observe(event)
+	}
+	if len(c.sinks) == 0 || event.muted || !c.sampleEvent(&event) {
+		return
+	}
+	if event.sinkURL != "" {
+		c.queueEvent(c.urlSinks.get(event.sinkURL), &event)
+		return
+	}
+	delivered := false
+	for _, p := range c.sinks {
+		if !p.accepts(&event) {
+			continue
+		}
+		delivered = true
+		c.queueEvent(p, &event)
+	}
+	if !delivered && event.route != "" {
+		c.unrouted.Add(1)
+	}
+}
+
+// queueEvent buffers event in p, flushing p once its batch is full
+func (c *Client) queueEvent(p *sinkPipeline, event *TelemetryEvent) {
+	if p.add(event) || (c.telemetryStopped != nil && c.telemetryStopped.Load()) {
+		c.flushSink(p)
+	} else if c.flushWake != nil {
+		select {
+		case c.flushWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flushTelemetry starts delivery of every buffered event and returns how
+// many were taken
+func (c *Client) flushTelemetry() int {
+	n := 0
+	for _, p := range c.sinks {
+		n += c.flushSink(p)
+	}
+	for _, p := range c.urlSinks.all() {
+		n += c.flushSink(p)
+	}
+	return n
+}
+
+func (c *Client) flushSink(p *sinkPipeline) int {
+	batch := p.take()
+	if batch == nil {
+		return 0
+	}
+	n := len(batch.events)
+	c.goroutine("telemetry.deliver", func() {
+		if err := p.deliver(batch); err != nil {
+			c.log(context.Background(), LogTelemetry, "telemetry delivery failed",
+				"sink", p.name, "events", n, "error", err)
+		}
+	})
+	return n
+}
+
+// FlushSchedule tunes adaptive telemetry flushing. Full batches are always
+// sent immediately; otherwise the client flushes every MinInterval while
+// events keep arriving and doubles the interval up to MaxInterval while idle.
+// No buffered event waits longer than MaxLatency.
+type FlushSchedule struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	MaxLatency  time.Duration
+}
+
+// DefaultFlushSchedule is used unless WithFlushSchedule overrides it
+var DefaultFlushSchedule = FlushSchedule{
+	MinInterval: time.Second,
+	MaxInterval: 30 * time.Second,
+	MaxLatency:  5 * time.Second,
+}
+
+// WithFlushSchedule overrides DefaultFlushSchedule. Zero fields keep their
+// default values.
+func WithFlushSchedule(s FlushSchedule) Option {
+	return func(c *Client) {
+		c.flushSchedule = s
+	}
+}
+
+func (s FlushSchedule) withDefaults() FlushSchedule {
+	if s.MinInterval <= 0 {
+		s.MinInterval = DefaultFlushSchedule.MinInterval
+	}
+	if s.MaxInterval < s.MinInterval {
+		s.MaxInterval = DefaultFlushSchedule.MaxInterval
+		if s.MaxInterval < s.MinInterval {
+			s.MaxInterval = s.MinInterval
+		}
+	}
+	if s.MaxLatency <= 0 {
+		s.MaxLatency = DefaultFlushSchedule.MaxLatency
+	}
+	return s
+}
+
+// nextFlushInterval backs off while idle and snaps back once events flow
+func (s FlushSchedule) nextFlushInterval(current time.Duration, flushed int) time.Duration {
+	if flushed > 0 {
+		return s.MinInterval
+	}
+	next := current * 2
+	if next > s.MaxInterval {
+		next = s.MaxInterval
+	}
+	return next
+}
+
+func (c *Client) startTelemetry() {
+	c.flushSchedule = c.flushSchedule.withDefaults()
+	c.flushWake = make(chan struct{}, 1)
+	c.flushStop = make(chan struct{})
+	c.telemetryStopped = new(atomic.Bool)
+	c.goroutine("telemetry.flush", c.runFlushScheduler)
+}
+
+func (c *Client) runFlushScheduler() {
+	sched := c.flushSchedule
+	interval := sched.MinInterval
+	timer := time.NewTimer(interval)
+	deadline := time.Now().Add(interval)
+
+	for {
+		select {
+		case <-timer.C:
+			interval = sched.nextFlushInterval(interval, c.flushTelemetry())
+			timer.Reset(interval)
+			deadline = time.Now().Add(interval)
+		case <-c.flushWake:
+			// A new event arrived while backed off; pull the next flush in
+			// so it is not held longer than MaxLatency
+			if time.Until(deadline) <= sched.MaxLatency {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(sched.MaxLatency)
+			deadline = time.Now().Add(sched.MaxLatency)
+		case <-c.flushStop:
+			timer.Stop()
+			c.flushTelemetry()
+			return
+		}
+	}
+}
+
+// stopTelemetry ends the flush scheduler after a final flush. Events
+// recorded afterwards are flushed as they arrive.
+func (c *Client) stopTelemetry() {
+	if c.telemetryStopped != nil && c.telemetryStopped.CompareAndSwap(false, true) {
+		close(c.flushStop)
+	}
+}
+
+// timestampCache holds the RFC 3339 rendering of one wall-clock second,
+// since nearly every event recorded within a second shares its timestamps
+type timestampCache struct {
+	unix int64
+	text string
+}
+
+// recentTimestamps caches odd and even seconds separately, so a call's start
+// and end timestamps don't evict each other when it spans a second boundary
+var recentTimestamps [2]atomic.Pointer[timestampCache]
+
+// formatTimestamp formats t as RFC 3339, reusing the cached text for its
+// second when there is one
+func formatTimestamp(t time.Time) string {
+	if t.Location() != time.Local {
+		return t.Format(time.RFC3339)
+	}
+	unix := t.Unix()
+	slot := &recentTimestamps[unix&1]
+	if cached := slot.Load(); cached != nil && cached.unix == unix {
+		return cached.text
+	}
+	text := t.Format(time.RFC3339)
+	slot.Store(&timestampCache{unix: unix, text: text})
+	return text
+}
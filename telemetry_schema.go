@@ -0,0 +1,116 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// TelemetrySchemaVersion is the version of the TelemetryEvent JSON schema
+// this client sends. Version 2 added attributes, runtime and host metadata,
+// finish reasons, fingerprints, and stream, retry and cache flags, all
+// optional, so version 1 readers can ignore them.
+const TelemetrySchemaVersion = 2
+
+// modulePath is this module's import path, for finding its version
+const modulePath = "github.com/langmesh-ai/openai-go"
+
+// runtimeInfo is the metadata every event carries about the process
+type runtimeInfo struct {
+	sdkVersion string
+	goVersion  string
+	hostname   string
+	os         string
+	arch       string
+}
+
+var currentRuntime = sync.OnceValue(func() runtimeInfo {
+	info := runtimeInfo{
+		sdkVersion: "devel",
+		goVersion:  runtime.Version(),
+		os:         runtime.GOOS,
+		arch:       runtime.GOARCH,
+	}
+	info.hostname, _ = os.Hostname()
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range build.Deps {
+			if dep.Path == modulePath {
+				info.sdkVersion = dep.Version
+			}
+		}
+	}
+	return info
+})
+
+// applyRuntime stamps event with the schema version and process metadata
+func applyRuntime(event *TelemetryEvent) {
+	info := currentRuntime()
+	event.SchemaVersion = TelemetrySchemaVersion
+	event.SDKVersion = info.sdkVersion
+	event.GoVersion = info.goVersion
+	event.Hostname = info.hostname
+	event.OS = info.os
+	event.Arch = info.arch
+}
+
+// ContextWithAttribute adds a typed telemetry attribute for calls made with the
+// returned context. Unlike tags, values may be numbers, booleans or any
+// other JSON value.
+func ContextWithAttribute(ctx context.Context, key string, value any) context.Context {
+	return deriveCarrier(ctx, func(c *scopeCarrier) {
+		attrs := make(map[string]any, len(c.attributes)+1)
+		for k, v := range c.attributes {
+			attrs[k] = v
+		}
+		attrs[key] = value
+		c.attributes = attrs
+	})
+}
+
+// applyAttributes copies the attributes on ctx onto event
+func applyAttributes(ctx context.Context, event *TelemetryEvent) {
+	carrier := liveCarrier(ctx)
+	if carrier == nil || len(carrier.attributes) == 0 {
+		return
+	}
+	event.Attributes = make(map[string]any, len(carrier.attributes))
+	for k, v := range carrier.attributes {
+		event.Attributes[k] = v
+	}
+}
+
+// telemetryEventJSON has TelemetryEvent's fields without its methods
+type telemetryEventJSON TelemetryEvent
+
+// MarshalJSON encodes the event, stamping events built outside the client
+// with the current schema version
+func (e TelemetryEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(eventJSON(&e))
+}
+
+// eventJSON is e as its method-less alias, which encoders write directly
+// instead of through MarshalJSON. Only an unversioned event is copied, to
+// stamp it.
+func eventJSON(e *TelemetryEvent) *telemetryEventJSON {
+	if e.SchemaVersion == 0 {
+		stamped := *e
+		stamped.SchemaVersion = TelemetrySchemaVersion
+		e = &stamped
+	}
+	return (*telemetryEventJSON)(e)
+}
+
+// UnmarshalJSON decodes an event of any schema version. Version 1 events
+// had no schema_version and decode as version 1.
+func (e *TelemetryEvent) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*telemetryEventJSON)(e)); err != nil {
+		return err
+	}
+	if e.SchemaVersion == 0 {
+		e.SchemaVersion = 1
+	}
+	return nil
+}
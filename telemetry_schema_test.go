@@ -0,0 +1,91 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestTelemetrySchemaV2Fields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Langmesh-Cache", "hit")
+		w.Write([]byte(`{"id":"1","system_fingerprint":"fp_44709d6fcb","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"length"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	t.Cleanup(srv.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	ctx := ContextWithAttribute(context.Background(), "tenant_tier", 3)
+	ctx = ContextWithAttribute(ctx, "beta", true)
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	event := rec.all()[0]
+	if event.SchemaVersion != TelemetrySchemaVersion || event.GoVersion != runtime.Version() ||
+		event.OS != runtime.GOOS || event.SDKVersion == "" {
+		t.Errorf("runtime metadata = %+v", event)
+	}
+	if event.FinishReason != "length" || event.SystemFingerprint != "fp_44709d6fcb" || !event.CacheHit ||
+		event.Stream || event.RetryCount != 0 {
+		t.Errorf("response fields = %+v", event)
+	}
+	if event.Attributes["tenant_tier"] != 3 || event.Attributes["beta"] != true {
+		t.Errorf("Attributes = %v", event.Attributes)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"schema_version":2`, `"finish_reason":"length"`, `"attributes":{"beta":true,"tenant_tier":3}`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("JSON missing %s: %s", field, data)
+		}
+	}
+}
+
+func TestTelemetryEventJSONVersions(t *testing.T) {
+	var v1 TelemetryEvent
+	if err := json.Unmarshal([]byte(`{"request_id":"req_1","model":"gpt-4o","status":"success"}`), &v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.SchemaVersion != 1 || v1.RequestID != "req_1" {
+		t.Errorf("v1 event decoded as %+v", v1)
+	}
+
+	data, err := json.Marshal([]TelemetryEvent{{RequestID: "req_2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"schema_version":2`) {
+		t.Errorf("unversioned event encoded as %s", data)
+	}
+	var back []TelemetryEvent
+	if err := json.Unmarshal(data, &back); err != nil || back[0].SchemaVersion != 2 {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+}
+
+func TestTelemetryRetryCount(t *testing.T) {
+	srv, _ := newFallbackServer(t, map[string]int{"gpt-4o": 429}, "rate_limit_exceeded")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec),
+		WithModelFallback("gpt-4o", "gpt-4o-mini"))
+	_, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := rec.all()[0]; event.RetryCount != 1 || event.FallbackFrom != "gpt-4o" {
+		t.Errorf("RetryCount = %d, FallbackFrom = %q", event.RetryCount, event.FallbackFrom)
+	}
+}
@@ -0,0 +1,272 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// envelopeAlgorithm is the cipher sealing telemetry payloads
+const envelopeAlgorithm = "AES-256-GCM"
+
+// encryptionHeader marks telemetry requests whose body is an envelope
+const encryptionHeader = "X-Langmesh-Payload-Encryption"
+
+// ErrEnvelope is returned by OpenTelemetryEnvelope for payloads that are not
+// a valid envelope or fail to decrypt
+var ErrEnvelope = errors.New("langmesh: invalid telemetry envelope")
+
+// KeyWrapper encrypts the per-batch data keys of envelope-encrypted
+// telemetry with a customer-held key, e.g. through a KMS
+type KeyWrapper interface {
+	// KeyID names the wrapping key, so the receiver knows which to unwrap with
+	KeyID() string
+	WrapKey(dataKey []byte) ([]byte, error)
+}
+
+// AESKeyWrapper wraps data keys with a symmetric key using AES-GCM
+type AESKeyWrapper struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewAESKeyWrapper creates a wrapper for a 16, 24 or 32 byte key named id
+func NewAESKeyWrapper(id string, key []byte) (*AESKeyWrapper, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: telemetry key %s: %w", id, err)
+	}
+	return &AESKeyWrapper{id: id, aead: aead}, nil
+}
+
+// KeyID returns the key's name
+func (w *AESKeyWrapper) KeyID() string { return w.id }
+
+// WrapKey seals dataKey, prefixed with its nonce
+func (w *AESKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, dataKey, []byte(w.id)), nil
+}
+
+// UnwrapKey opens a data key wrapped by WrapKey, for OpenTelemetryEnvelope
+func (w *AESKeyWrapper) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != w.id {
+		return nil, fmt.Errorf("%w: wrapped with key %q, not %q", ErrEnvelope, keyID, w.id)
+	}
+	n := w.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, ErrEnvelope
+	}
+	return w.aead.Open(nil, wrapped[:n], wrapped[n:], []byte(w.id))
+}
+
+// RSAKeyWrapper wraps data keys with an RSA public key using OAEP and
+// SHA-256, so only the holder of the private key can read telemetry
+type RSAKeyWrapper struct {
+	id  string
+	pub *rsa.PublicKey
+}
+
+// NewRSAKeyWrapper creates a wrapper for the public key named id
+func NewRSAKeyWrapper(id string, pub *rsa.PublicKey) *RSAKeyWrapper {
+	return &RSAKeyWrapper{id: id, pub: pub}
+}
+
+// KeyID returns the key's name
+func (w *RSAKeyWrapper) KeyID() string { return w.id }
+
+// WrapKey encrypts dataKey to the public key
+func (w *RSAKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, w.pub, dataKey, []byte(w.id))
+}
+
+// telemetryEnvelope is the body of an encrypted telemetry request. Byte
+// fields are base64 in JSON.
+type telemetryEnvelope struct {
+	Version    int    `json:"envelope_version"`
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealEnvelope encrypts payload with a fresh data key wrapped by w
+func sealEnvelope(w KeyWrapper, payload []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := w.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: wrapping telemetry key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	id := w.KeyID()
+	return json.Marshal(telemetryEnvelope{
+		Version:    1,
+		Algorithm:  envelopeAlgorithm,
+		KeyID:      id,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, payload, []byte(id)),
+	})
+}
+
+// OpenTelemetryEnvelope decrypts the body of an encrypted telemetry
+// request, for collectors receiving it. unwrapKey recovers the data key,
+// e.g. AESKeyWrapper.UnwrapKey or a KMS decrypt call.
+func OpenTelemetryEnvelope(body []byte, unwrapKey func(keyID string, wrapped []byte) ([]byte, error)) ([]byte, error) {
+	var env telemetryEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEnvelope, err)
+	}
+	if env.Version != 1 || env.Algorithm != envelopeAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported version %d, algorithm %q", ErrEnvelope, env.Version, env.Algorithm)
+	}
+	dataKey, err := unwrapKey(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unwrapping key %s: %v", ErrEnvelope, env.KeyID, err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil || len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: bad data key or nonce", ErrEnvelope)
+	}
+	payload, err := aead.Open(nil, env.Nonce, env.Ciphertext, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEnvelope, err)
+	}
+	return payload, nil
+}
+
+// TelemetryTLS configures the TLS connection to telemetry endpoints
+type TelemetryTLS struct {
+	// CertFile and KeyFile hold a PEM client certificate and key for mTLS
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle of CAs to trust instead of the system roots
+	CAFile string
+
+	// Certificates and RootCAs are used as well as, or instead of, files
+	Certificates []tls.Certificate
+	RootCAs      *x509.CertPool
+	ServerName   string
+}
+
+// Config builds the tls.Config, loading the files
+func (t TelemetryTLS) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: append([]tls.Certificate(nil), t.Certificates...),
+		RootCAs:      t.RootCAs,
+		ServerName:   t.ServerName,
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("langmesh: telemetry client certificate: %w", err)
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("langmesh: telemetry CA bundle: %w", err)
+		}
+		if cfg.RootCAs == nil {
+			cfg.RootCAs = x509.NewCertPool()
+		} else {
+			cfg.RootCAs = cfg.RootCAs.Clone()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("langmesh: telemetry CA bundle %s has no certificates", t.CAFile)
+		}
+	}
+	return cfg, nil
+}
+
+// telemetrySecurity is what WithTelemetryEncryption and WithTelemetryTLS
+// apply to a client's HTTP sinks
+type telemetrySecurity struct {
+	encryption KeyWrapper
+	tls        *tls.Config
+	err        error
+}
+
+// WithTelemetryEncryption envelope-encrypts every HTTP telemetry payload:
+// each batch is sealed with a fresh AES-256-GCM data key, which is sent
+// wrapped by w. It applies to the hosted endpoint, ContextWithTelemetryEndpoint
+// URLs and every HTTPSink without its own Encryption.
+func WithTelemetryEncryption(w KeyWrapper) Option {
+	return func(c *Client) {
+		c.telemetrySecurity.encryption = w
+	}
+}
+
+// WithTelemetryTLS delivers HTTP telemetry over the TLS configuration in
+// cfg, e.g. mTLS with a private CA. It applies to the same sinks as
+// WithTelemetryEncryption. Files that cannot be loaded leave the sinks
+// unchanged, are logged, and fail NewStrictClient.
+func WithTelemetryTLS(cfg TelemetryTLS) Option {
+	return func(c *Client) {
+		c.telemetrySecurity.tls, c.telemetrySecurity.err = cfg.Config()
+	}
+}
+
+// secure applies the client's telemetry security to s
+func (t *telemetrySecurity) secure(s *HTTPSink) {
+	if t.encryption != nil && s.Encryption == nil {
+		s.Encryption = t.encryption
+	}
+	if t.tls != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = t.tls.Clone()
+		client := &http.Client{Transport: transport}
+		if s.HTTPClient != nil {
+			client.Timeout = s.HTTPClient.Timeout
+		}
+		s.HTTPClient = client
+	}
+}
+
+// secureSinks applies the telemetry security options to the client's HTTP
+// sinks and those ContextWithTelemetryEndpoint creates
+func (c *Client) secureSinks() {
+	if c.telemetrySecurity.err != nil {
+		c.log(context.Background(), LogTelemetry, "telemetry TLS not applied", "error", c.telemetrySecurity.err)
+	}
+	for _, p := range c.sinks {
+		if s, ok := p.sink.(*HTTPSink); ok {
+			c.telemetrySecurity.secure(s)
+		}
+	}
+	c.urlSinks.security = &c.telemetrySecurity
+}
@@ -0,0 +1,177 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deliverAll flushes every sink of client synchronously
+func deliverAll(client *Client) {
+	for _, p := range append(client.sinks, client.urlSinks.all()...) {
+		if batch := p.take(); batch != nil {
+			p.deliver(batch)
+		}
+	}
+}
+
+func TestTelemetryEncryption(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	var mu sync.Mutex
+	var bodies [][]byte
+	var headers []string
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		headers = append(headers, r.Header.Get(encryptionHeader))
+		mu.Unlock()
+	}))
+	t.Cleanup(endpoint.Close)
+
+	kek := make([]byte, 32)
+	rand.Read(kek)
+	wrapper, err := NewAESKeyWrapper("kek-2024", kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithTelemetrySink("vpc", NewHTTPSink(endpoint.URL, "lm-key")),
+		WithTelemetryEncryption(wrapper),
+	)
+	ctx := context.Background()
+	for _, callCtx := range []context.Context{ctx, ContextWithTelemetryEndpoint(ctx, endpoint.URL+"/other")} {
+		if _, err := client.CreateChatCompletion(callCtx, chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliverAll(client)
+
+	if len(bodies) != 2 {
+		t.Fatalf("endpoint got %d batches", len(bodies))
+	}
+	for i, body := range bodies {
+		if headers[i] != "AES-256-GCM" || strings.Contains(string(body), "chat.completions") {
+			t.Errorf("batch %d sent in plaintext: %s", i, body)
+		}
+		plain, err := OpenTelemetryEnvelope(body, wrapper.UnwrapKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batch map[string][]TelemetryEvent
+		if err := json.Unmarshal(plain, &batch); err != nil || len(batch["events"]) != 1 ||
+			batch["events"][0].Model != "gpt-4o-mini" {
+			t.Errorf("decrypted batch = %s, %v", plain, err)
+		}
+	}
+
+	if _, err := OpenTelemetryEnvelope(bodies[0], func(string, []byte) ([]byte, error) {
+		return make([]byte, 32), nil
+	}); !errors.Is(err, ErrEnvelope) {
+		t.Errorf("wrong data key: err = %v", err)
+	}
+}
+
+func TestRSAKeyWrapper(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealEnvelope(NewRSAKeyWrapper("rsa-1", &priv.PublicKey), []byte(`{"events":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := OpenTelemetryEnvelope(sealed, func(keyID string, wrapped []byte) ([]byte, error) {
+		return rsa.DecryptOAEP(sha256.New(), nil, priv, wrapped, []byte(keyID))
+	})
+	if err != nil || string(plain) != `{"events":[]}` {
+		t.Errorf("opened %q, %v", plain, err)
+	}
+}
+
+// selfSignedCert makes a certificate for client authentication
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "telemetry-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTelemetryMutualTLS(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	clientCert, parsed := selfSignedCert(t)
+	var mu sync.Mutex
+	var clients []string
+	endpoint := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clients = append(clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(parsed)
+	endpoint.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	endpoint.StartTLS()
+	t.Cleanup(endpoint.Close)
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(endpoint.Certificate())
+
+	sink := NewHTTPSink(endpoint.URL, "lm-key")
+	if err := sink.Send(context.Background(), []TelemetryEvent{{RequestID: "a"}}); err == nil {
+		t.Fatal("endpoint accepted a client without a certificate")
+	}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithTelemetrySink("mtls", sink),
+		WithTelemetryTLS(TelemetryTLS{Certificates: []tls.Certificate{clientCert}, RootCAs: serverCAs}),
+	)
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	deliverAll(client)
+	if stats := client.TelemetryStats().Sinks[0]; stats.EventsSent != 1 || len(clients) != 1 ||
+		clients[0] != "telemetry-client" {
+		t.Errorf("stats = %+v, clients = %v", stats, clients)
+	}
+}
+
+func TestTelemetryTLSStrict(t *testing.T) {
+	_, err := NewStrictClient("test-key", WithTelemetryTLS(TelemetryTLS{CAFile: "/nonexistent/ca.pem"}))
+	if !errors.Is(err, ErrMisconfigured) || !strings.Contains(err.Error(), "CA bundle") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestDualWriteSinkStats(t *testing.T) {
+	var legacy, next []TelemetryEvent
+	client := NewClient("test-key",
+		WithTelemetrySink("legacy", TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+			legacy = append(legacy, events...)
+			return nil
+		})),
+		WithTelemetrySink("otlp", TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+			next = append(next, events...)
+			return errors.New("collector unavailable")
+		})),
+	)
+
+	for i := 0; i < 3; i++ {
+		for _, p := range client.sinks {
+			p.add(&TelemetryEvent{RequestID: "req"})
+		}
+	}
+	for _, p := range client.sinks {
+		p.deliver(p.take())
+	}
+	for _, s := range client.TelemetryStats().Sinks {
+		if s.Name == "legacy" && s.FlushLatency.Count != 3 {
+			t.Errorf("expected 3 latency samples, got %+v", s.FlushLatency)
+		}
+	}
+
+	stats := client.TelemetryStats()
+	byName := map[string]SinkStats{}
+	for _, s := range stats.Sinks {
+		byName[s.Name] = s
+	}
+	if got := byName["legacy"]; got.EventsSent != 3 || got.BatchesSent != 1 || got.EventsFailed != 0 {
+		t.Errorf("legacy stats = %+v", got)
+	}
+	if got := byName["otlp"]; got.EventsFailed != 3 || got.LastError != "collector unavailable" {
+		t.Errorf("otlp stats = %+v", got)
+	}
+	if len(legacy) != 3 || len(next) != 3 {
+		t.Errorf("both sinks should receive every event: %d, %d", len(legacy), len(next))
+	}
+}
+
+func TestRouteTelemetryToDedicatedSink(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	var general, acme []TelemetryEvent
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		WithTelemetrySink("general", TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+			general = append(general, events...)
+			return nil
+		})),
+		WithDedicatedTelemetrySink("acme", TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+			acme = append(acme, events...)
+			return nil
+		})),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	ctx := context.Background()
+	for _, routed := range []context.Context{ctx, ContextWithTelemetryRoute(ctx, "acme"), ContextWithTelemetryRoute(ctx, "unknown")} {
+		if _, err := client.CreateChatCompletion(ContextWithUser(routed, "u1"), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range client.sinks {
+		if batch := p.take(); batch != nil {
+			p.deliver(batch)
+		}
+	}
+
+	if len(general) != 1 || len(acme) != 1 {
+		t.Fatalf("general got %d events, acme got %d", len(general), len(acme))
+	}
+	if acme[0].User != "u1" {
+		t.Errorf("routed event lost its scope: %+v", acme[0])
+	}
+	if got := client.TelemetryStats().Unrouted; got != 1 {
+		t.Errorf("Unrouted = %d", got)
+	}
+}
+
+func TestContextTelemetryOverrides(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	var override []TelemetryEvent
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string][]TelemetryEvent
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		override = append(override, body["events"]...)
+	}))
+	defer endpoint.Close()
+
+	var general []TelemetryEvent
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL+"/v1"),
+		withRecorder(rec),
+		WithTelemetrySink("general", TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+			general = append(general, events...)
+			return nil
+		})),
+	)
+
+	req := openai.ChatCompletionRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	ctx := context.Background()
+	for _, callCtx := range []context.Context{ctx, ContextWithoutTelemetry(ctx), ContextWithTelemetryEndpoint(ctx, endpoint.URL)} {
+		if _, err := client.CreateChatCompletion(callCtx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range append(client.sinks, client.urlSinks.all()...) {
+		if batch := p.take(); batch != nil {
+			p.deliver(batch)
+		}
+	}
+
+	if len(general) != 1 || len(override) != 1 {
+		t.Fatalf("general got %d events, override endpoint got %d", len(general), len(override))
+	}
+	if got := len(rec.all()); got != 3 {
+		t.Errorf("observers saw %d events, want all 3", got)
+	}
+	stats := client.TelemetryStats()
+	if last := stats.Sinks[len(stats.Sinks)-1]; last.Name != endpoint.URL || last.EventsSent != 1 {
+		t.Errorf("endpoint stats = %+v", last)
+	}
+}
+
+func TestHTTPSinkReportsStatus(t *testing.T) {
+	var body map[string][]TelemetryEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer lm-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	if err := NewHTTPSink(srv.URL, "lm-key").Send(context.Background(), []TelemetryEvent{{RequestID: "a"}}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(body["events"]) != 1 || body["events"][0].RequestID != "a" {
+		t.Errorf("unexpected payload %+v", body)
+	}
+	if err := NewHTTPSink(srv.URL, "wrong").Send(context.Background(), nil); err == nil {
+		t.Error("expected error on 401")
+	}
+}
+
+// earlyResponseTransport answers before reading the request body, as a
+// server replying early lets net/http do, keeping the bodies to read later
+type earlyResponseTransport struct {
+	bodies []io.ReadCloser
+}
+
+func (t *earlyResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.bodies = append(t.bodies, req.Body)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestHTTPSinkKeepsPayloadUntilBodyClosed(t *testing.T) {
+	transport := &earlyResponseTransport{}
+	sink := NewHTTPSink("http://telemetry.invalid", "lm-key")
+	sink.HTTPClient = &http.Client{Transport: transport}
+
+	for _, id := range []string{"first", "second"} {
+		if err := sink.Send(context.Background(), []TelemetryEvent{{RequestID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, id := range []string{"first", "second"} {
+		data, err := io.ReadAll(transport.bodies[i])
+		transport.bodies[i].Close()
+		if err != nil || !strings.Contains(string(data), `"request_id":"`+id+`"`) {
+			t.Errorf("body %d = %s, %v; want the %s batch", i, data, err, id)
+		}
+	}
+}
+
+func TestFlushScheduleBackoff(t *testing.T) {
+	s := FlushSchedule{MinInterval: time.Second, MaxInterval: 8 * time.Second}.withDefaults()
+	interval := s.MinInterval
+	var seen []time.Duration
+	for i := 0; i < 5; i++ {
+		interval = s.nextFlushInterval(interval, 0)
+		seen = append(seen, interval)
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("idle backoff = %v, want %v", seen, want)
+		}
+	}
+	if got := s.nextFlushInterval(interval, 3); got != time.Second {
+		t.Errorf("interval after activity = %v, want %v", got, time.Second)
+	}
+	if s.MaxLatency != DefaultFlushSchedule.MaxLatency {
+		t.Errorf("max latency default not applied: %v", s.MaxLatency)
+	}
+}
+
+func BenchmarkRecordTelemetry(b *testing.B) {
+	client := NewClient("test-key", WithTelemetrySink("discard", TelemetrySinkFunc(func(context.Context, []TelemetryEvent) error {
+		return nil
+	})))
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		client.recordTelemetry(client.newEvent(ctx, newRequestID(), "chat.completions", "gpt-4o", time.Now(), nil))
+	}
+}
+
+func BenchmarkHTTPSinkEncode(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+	sink := NewHTTPSink(srv.URL, "lm-key")
+	batch := make([]TelemetryEvent, telemetryBatchSize)
+	for i := range batch {
+		batch[i] = TelemetryEvent{SchemaVersion: TelemetrySchemaVersion, RequestID: newRequestID(), Model: "gpt-4o", Endpoint: "chat.completions", Status: "success"}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = sink.Send(context.Background(), batch)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	now := time.Now()
+	for _, ts := range []time.Time{now, now.Add(time.Second), now, now.UTC(), now.Add(-time.Hour)} {
+		if got, want := formatTimestamp(ts), ts.Format(time.RFC3339); got != want {
+			t.Errorf("formatTimestamp(%v) = %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestNewRequestIDFormat(t *testing.T) {
+	id := newRequestID()
+	parts := strings.Split(id, "_")
+	if len(parts) != 3 || parts[0] != "req" || len(parts[2]) != 8 {
+		t.Fatalf("unexpected request ID %q", id)
+	}
+	if _, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
+		t.Errorf("request ID timestamp %q: %v", parts[1], err)
+	}
+	if newRequestID() == id {
+		t.Error("request IDs repeat")
+	}
+}
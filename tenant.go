@@ -0,0 +1,224 @@
+package langmesh
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrUnknownTenant is returned by ClientManager.Client for a tenant it has
+// no configuration for
+var ErrUnknownTenant = errors.New("langmesh: unknown tenant")
+
+// TenantConfig configures one tenant's client
+type TenantConfig struct {
+	// APIKey is the tenant's OpenAI key
+	APIKey string
+	// Budget caps the tenant's spend. Return the same Budget for a tenant
+	// each time, so its spend survives the client being evicted.
+	Budget *Budget
+	// RateLimits cap the requests and tokens of all the tenant's calls
+	// together, whichever end user makes them
+	RateLimits []Quota
+	// Tags are added to every event the tenant's client records, along
+	// with "tenant"
+	Tags map[string]string
+	// Options apply after the manager's
+	Options []Option
+}
+
+// ClientManagerConfig configures NewClientManager
+type ClientManagerConfig struct {
+	// Options apply to every tenant's client
+	Options []Option
+	// Tenants configures tenants known up front
+	Tenants map[string]TenantConfig
+	// Lookup loads tenants missing from Tenants, e.g. from a database. It
+	// may return ErrUnknownTenant.
+	Lookup func(ctx context.Context, tenant string) (TenantConfig, error)
+	// MaxClients caps the clients held at once, evicting the least
+	// recently used; zero is no cap
+	MaxClients int
+	// IdleTimeout evicts clients unused for this long; zero keeps them
+	IdleTimeout time.Duration
+	// QuotaStore holds the counters of tenants' RateLimits, in memory if
+	// nil
+	QuotaStore QuotaStore
+}
+
+// ClientManager holds a client per tenant for multi-tenant services. Each
+// tenant's client is created on first use with its own key, budget, rate
+// limits and tags, and evicted when idle or when MaxClients is reached.
+// An evicted client flushes its telemetry; callers still holding it may
+// keep using it.
+type ClientManager struct {
+	cfg ClientManagerConfig
+
+	mu      sync.Mutex
+	clients map[string]*list.Element
+	// lru orders tenantClients, most recently used first
+	lru *list.List
+}
+
+type tenantClient struct {
+	tenant   string
+	ready    chan struct{}
+	client   *Client
+	err      error
+	lastUsed time.Time
+}
+
+// NewClientManager creates a manager for cfg's tenants
+func NewClientManager(cfg ClientManagerConfig) *ClientManager {
+	if cfg.QuotaStore == nil {
+		cfg.QuotaStore = NewMemoryQuotaStore()
+	}
+	return &ClientManager{cfg: cfg, clients: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Client returns tenant's client, creating it if needed. Concurrent calls
+// for a new tenant share one creation.
+func (m *ClientManager) Client(ctx context.Context, tenant string) (*Client, error) {
+	now := time.Now()
+	m.mu.Lock()
+	m.evictIdle(now)
+	if el, ok := m.clients[tenant]; ok {
+		tc := el.Value.(*tenantClient)
+		tc.lastUsed = now
+		m.lru.MoveToFront(el)
+		m.mu.Unlock()
+		select {
+		case <-tc.ready:
+			return tc.client, tc.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	tc := &tenantClient{tenant: tenant, ready: make(chan struct{}), lastUsed: now}
+	m.clients[tenant] = m.lru.PushFront(tc)
+	m.mu.Unlock()
+
+	tc.client, tc.err = m.create(ctx, tenant)
+	close(tc.ready)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tc.err != nil {
+		// Let the next call retry
+		if el, ok := m.clients[tenant]; ok && el.Value == tc {
+			m.removeLocked(el)
+		}
+		return nil, tc.err
+	}
+	for m.cfg.MaxClients > 0 && m.lru.Len() > m.cfg.MaxClients {
+		m.removeLocked(m.lru.Back())
+	}
+	return tc.client, nil
+}
+
+func (m *ClientManager) create(ctx context.Context, tenant string) (*Client, error) {
+	cfg, ok := m.cfg.Tenants[tenant]
+	if !ok {
+		if m.cfg.Lookup == nil {
+			return nil, ErrUnknownTenant
+		}
+		var err error
+		if cfg, err = m.cfg.Lookup(ctx, tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := append([]Option(nil), m.cfg.Options...)
+	opts = append(opts, WithTags(cfg.Tags), WithTags(map[string]string{"tenant": tenant}))
+	if cfg.Budget != nil {
+		opts = append(opts, WithBudget(cfg.Budget))
+	}
+	if len(cfg.RateLimits) > 0 {
+		limits := NewQuotaManager(m.cfg.QuotaStore, cfg.RateLimits...)
+		limits.prefix = "langmesh:tenant:"
+		opts = append(opts, func(c *Client) {
+			g := tenantLimits{limits: limits, tenant: tenant}
+			c.guards = append(c.guards, g)
+			c.observers = append(c.observers, g)
+		})
+	}
+	opts = append(opts, cfg.Options...)
+	return NewClient(cfg.APIKey, opts...), nil
+}
+
+// Evict drops tenant's client, flushing its telemetry. The next Client
+// call for tenant creates a new one.
+func (m *ClientManager) Evict(tenant string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.clients[tenant]; ok {
+		m.removeLocked(el)
+	}
+}
+
+// Len returns how many clients the manager holds
+func (m *ClientManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// Close evicts every client, flushing their telemetry
+func (m *ClientManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.lru.Len() > 0 {
+		m.removeLocked(m.lru.Back())
+	}
+}
+
+// evictIdle drops clients unused for IdleTimeout, oldest first
+func (m *ClientManager) evictIdle(now time.Time) {
+	if m.cfg.IdleTimeout <= 0 {
+		return
+	}
+	for el := m.lru.Back(); el != nil; el = m.lru.Back() {
+		if now.Sub(el.Value.(*tenantClient).lastUsed) < m.cfg.IdleTimeout {
+			return
+		}
+		m.removeLocked(el)
+	}
+}
+
+func (m *ClientManager) removeLocked(el *list.Element) {
+	tc := el.Value.(*tenantClient)
+	m.lru.Remove(el)
+	delete(m.clients, tc.tenant)
+	go func() {
+		<-tc.ready
+		if tc.client != nil {
+			tc.client.stopTelemetry()
+		}
+	}()
+}
+
+// tenantLimits enforces a tenant's RateLimits across all its users
+type tenantLimits struct {
+	limits *QuotaManager
+	tenant string
+}
+
+func (t tenantLimits) check(ctx context.Context, c *Client, _ openai.ChatCompletionRequest) error {
+	err := t.limits.checkUser(ctx, c, t.tenant)
+	var guardErr *GuardError
+	if errors.As(err, &guardErr) {
+		guardErr.Guard = "tenant_rate_limit"
+	}
+	return err
+}
+
+func (t tenantLimits) checkCost(ctx context.Context, c *Client, _ string, _, _ int) error {
+	return t.check(ctx, c, openai.ChatCompletionRequest{})
+}
+
+func (t tenantLimits) observe(event TelemetryEvent) {
+	t.limits.count(event, t.tenant)
+}
@@ -0,0 +1,151 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientManagerTenants(t *testing.T) {
+	var mu sync.Mutex
+	keys := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.Header.Get("Authorization")]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(chatResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	var lookups int32
+	manager := NewClientManager(ClientManagerConfig{
+		Options: []Option{WithBaseURL(srv.URL + "/v1"), withRecorder(rec)},
+		Tenants: map[string]TenantConfig{
+			"acme": {APIKey: "sk-acme", Tags: map[string]string{"plan": "enterprise"}},
+		},
+		Lookup: func(_ context.Context, tenant string) (TenantConfig, error) {
+			atomic.AddInt32(&lookups, 1)
+			if tenant != "globex" {
+				return TenantConfig{}, ErrUnknownTenant
+			}
+			return TenantConfig{APIKey: "sk-globex", RateLimits: []Quota{{Requests: 1, Window: time.Minute}}}, nil
+		},
+	})
+	defer manager.Close()
+	ctx := context.Background()
+
+	acme, err := manager.Client(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := manager.Client(ctx, "acme"); again != acme {
+		t.Error("second Client call created a new client")
+	}
+	if _, err := acme.CreateChatCompletion(ContextWithTag(ctx, "plan", "trial"), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if tags := rec.all()[0].Tags; tags["tenant"] != "acme" || tags["plan"] != "trial" {
+		t.Errorf("tags = %v", tags)
+	}
+
+	globex, err := manager.Client(ctx, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tenant's limit holds across its users
+	if _, err := globex.CreateChatCompletion(ContextWithUser(ctx, "alice"), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = globex.CreateChatCompletion(ContextWithUser(ctx, "bob"), chatRequest("hi"))
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.Guard != "tenant_rate_limit" {
+		t.Errorf("err = %v, want tenant rate limit", err)
+	}
+
+	if _, err := manager.Client(ctx, "initech"); !errors.Is(err, ErrUnknownTenant) {
+		t.Errorf("err = %v, want ErrUnknownTenant", err)
+	}
+	if _, err := manager.Client(ctx, "initech"); !errors.Is(err, ErrUnknownTenant) || atomic.LoadInt32(&lookups) != 3 {
+		t.Errorf("failed lookup was cached: %v, %d lookups", err, lookups)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if keys["Bearer sk-acme"] != 1 || keys["Bearer sk-globex"] != 1 {
+		t.Errorf("keys = %v", keys)
+	}
+}
+
+func TestClientManagerEviction(t *testing.T) {
+	tenants := map[string]TenantConfig{"a": {APIKey: "a"}, "b": {APIKey: "b"}, "c": {APIKey: "c"}}
+	manager := NewClientManager(ClientManagerConfig{
+		Options:    []Option{withRecorder(&eventRecorder{})},
+		Tenants:    tenants,
+		MaxClients: 2,
+	})
+	ctx := context.Background()
+	a, _ := manager.Client(ctx, "a")
+	manager.Client(ctx, "b")
+	manager.Client(ctx, "a")
+	manager.Client(ctx, "c")
+	if n := manager.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+	if again, _ := manager.Client(ctx, "a"); again != a {
+		t.Error("recently used tenant was evicted")
+	}
+	manager.Evict("a")
+	if again, _ := manager.Client(ctx, "a"); again == a {
+		t.Error("Evict kept the client")
+	}
+
+	idle := NewClientManager(ClientManagerConfig{
+		Options:     []Option{withRecorder(&eventRecorder{})},
+		Tenants:     tenants,
+		IdleTimeout: 20 * time.Millisecond,
+	})
+	idle.Client(ctx, "a")
+	time.Sleep(30 * time.Millisecond)
+	idle.Client(ctx, "b")
+	if n := idle.Len(); n != 1 {
+		t.Errorf("Len = %d, want idle tenant evicted", n)
+	}
+}
+
+func TestClientManagerEvictionFlushesTelemetry(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	var sent int32
+	sink := TelemetrySinkFunc(func(_ context.Context, events []TelemetryEvent) error {
+		atomic.AddInt32(&sent, int32(len(events)))
+		return nil
+	})
+	manager := NewClientManager(ClientManagerConfig{
+		Options: []Option{WithBaseURL(srv.URL + "/v1"), WithTelemetrySink("test", sink),
+			WithFlushSchedule(FlushSchedule{MinInterval: time.Hour, MaxInterval: time.Hour})},
+		Tenants: map[string]TenantConfig{"acme": {APIKey: "sk-acme"}},
+	})
+	ctx := context.Background()
+	client, _ := manager.Client(ctx, "acme")
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	manager.Evict("acme")
+	// A caller still holding the client has its events sent straight away
+	if _, err := client.CreateChatCompletion(ctx, chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&sent) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&sent); n != 2 {
+		t.Errorf("sent %d events, want 2", n)
+	}
+}
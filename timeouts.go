@@ -0,0 +1,84 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Endpoint identifies a group of API endpoints sharing timeout settings
+type Endpoint string
+
+const (
+	EndpointChat       Endpoint = "chat"
+	EndpointEmbeddings Endpoint = "embeddings"
+	EndpointImages     Endpoint = "images"
+	EndpointAudio      Endpoint = "audio"
+	EndpointAssistants Endpoint = "assistants"
+	EndpointFineTuning Endpoint = "fine_tuning"
+	EndpointFiles      Endpoint = "files"
+	EndpointResponses  Endpoint = "responses"
+)
+
+// timeoutHeader tells the upstream how long the caller is prepared to wait,
+// matching the header sent by OpenAI's official SDKs
+const timeoutHeader = "X-Stainless-Timeout"
+
+// WithEndpointTimeout bounds every call to endpoint by d. A shorter deadline
+// already on the caller's context still wins.
+func WithEndpointTimeout(endpoint Endpoint, d time.Duration) Option {
+	return func(c *Client) {
+		if c.endpointTimeouts == nil {
+			c.endpointTimeouts = make(map[Endpoint]time.Duration)
+		}
+		c.endpointTimeouts[endpoint] = d
+	}
+}
+
+// WithDeadlineHeader sends the time remaining on each request's context
+// deadline upstream, in whole seconds, so the server can stop work the
+// caller will no longer wait for
+func WithDeadlineHeader() Option {
+	return func(c *Client) {
+		c.transportWrappers = append(c.transportWrappers, func(base http.RoundTripper) http.RoundTripper {
+			return deadlineTransport{base: base}
+		})
+	}
+}
+
+func (c *Client) withEndpointTimeout(ctx context.Context, endpoint Endpoint) (context.Context, context.CancelFunc) {
+	d, ok := c.endpointTimeouts[endpoint]
+	if !ok || d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+type deadlineTransport struct {
+	base http.RoundTripper
+}
+
+func (t deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if deadline, ok := req.Context().Deadline(); ok {
+		if remaining := time.Until(deadline); remaining > 0 {
+			req = req.Clone(req.Context())
+			secs := int64(remaining / time.Second)
+			if secs < 1 {
+				secs = 1
+			}
+			req.Header.Set(timeoutHeader, strconv.FormatInt(secs, 10))
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
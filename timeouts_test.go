@@ -0,0 +1,59 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestEndpointTimeoutClassifiedAsTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key",
+		WithBaseURL(srv.URL),
+		WithEndpointTimeout(EndpointEmbeddings, 20*time.Millisecond),
+		withRecorder(rec),
+	)
+	_, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+		Input: []string{"hello"},
+		Model: openai.SmallEmbedding3,
+	})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	events := rec.all()
+	if len(events) != 1 || events[0].ErrorClass != "Timeout" || events[0].Endpoint != "embeddings" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(timeoutHeader)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient("test-key", WithBaseURL(srv.URL), WithDeadlineHeader())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if header != "29" && header != "30" {
+		t.Errorf("%s = %q", timeoutHeader, header)
+	}
+}
@@ -0,0 +1,57 @@
+package langmesh
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Tokenizer counts the tokens text encodes to for model. It replaces the
+// four-characters-per-token estimate wherever the API does not report usage.
+type Tokenizer interface {
+	CountTokens(model, text string) int
+}
+
+// TokenizerFunc adapts a function to Tokenizer
+type TokenizerFunc func(model, text string) int
+
+// CountTokens calls f
+func (f TokenizerFunc) CountTokens(model, text string) int {
+	return f(model, text)
+}
+
+// WithTokenizer counts stream and max-cost guard tokens with t
+func WithTokenizer(t Tokenizer) Option {
+	return func(c *Client) {
+		c.tokenizer = t
+	}
+}
+
+// estimateTokens approximates the token count of text using the common
+// four-characters-per-token heuristic
+func estimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
+
+// countTokens counts text with the configured tokenizer, falling back to
+// the estimate
+func (c *Client) countTokens(model, text string) int {
+	if c.tokenizer == nil || text == "" {
+		return estimateTokens(text)
+	}
+	return c.tokenizer.CountTokens(model, text)
+}
+
+// countPromptTokens counts the prompt tokens of a chat request, including
+// images and the per-message overhead OpenAI adds for role framing
+func (c *Client) countPromptTokens(model string, messages []openai.ChatCompletionMessage) int {
+	total := 3
+	for _, m := range messages {
+		total += 4 + c.countTokens(model, m.Content) + c.countTokens(model, m.Name)
+		for _, part := range m.MultiContent {
+			total += c.countTokens(model, part.Text) + imagePartTokens(part)
+		}
+	}
+	return total
+}
@@ -0,0 +1,265 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var (
+	// ErrToolNotAllowed is returned for a call to a tool outside
+	// RunToolsOptions.AllowedTools
+	ErrToolNotAllowed = errors.New("langmesh: tool not allowed")
+	// ErrInvalidToolArguments is returned for a call whose arguments do not
+	// match its tool's parameter schema, with RunToolsOptions.ValidateArguments
+	ErrInvalidToolArguments = errors.New("langmesh: invalid tool arguments")
+	// ErrToolDenied is returned for a call RunToolsOptions.Approve did not
+	// approve
+	ErrToolDenied = errors.New("langmesh: tool call denied")
+)
+
+// ToolApprover decides whether a call to a tool that requires approval
+// may run, for instance by asking the user. It is called with the loop's
+// context, not bounded by the tool's timeout.
+type ToolApprover func(ctx context.Context, call openai.ToolCall) (bool, error)
+
+// toolGate enforces the allow-list, argument schemas and approvals of
+// RunToolsOptions before a tool runs
+type toolGate struct {
+	allowed  map[string]bool
+	schemas  map[string]*argumentSchema
+	validate bool
+	approval map[string]bool
+	approve  ToolApprover
+}
+
+// newToolGate builds the gate for opts, with the parameter schemas of
+// definitions, or returns nil when opts restricts nothing
+func newToolGate(definitions []openai.Tool, opts RunToolsOptions) *toolGate {
+	if opts.AllowedTools == nil && !opts.ValidateArguments && len(opts.RequireApproval) == 0 {
+		return nil
+	}
+	g := &toolGate{validate: opts.ValidateArguments, approve: opts.Approve}
+	if opts.AllowedTools != nil {
+		g.allowed = make(map[string]bool, len(opts.AllowedTools))
+		for _, name := range opts.AllowedTools {
+			g.allowed[name] = true
+		}
+	}
+	if len(opts.RequireApproval) > 0 {
+		g.approval = make(map[string]bool, len(opts.RequireApproval))
+		for _, name := range opts.RequireApproval {
+			g.approval[name] = true
+		}
+	}
+	if g.validate {
+		g.schemas = make(map[string]*argumentSchema, len(definitions))
+		for _, def := range definitions {
+			if def.Function == nil {
+				continue
+			}
+			g.schemas[def.Function.Name] = parseArgumentSchema(def.Function.Parameters)
+		}
+	}
+	return g
+}
+
+// check fails a call the options do not let run
+func (g *toolGate) check(ctx context.Context, call openai.ToolCall) error {
+	if g == nil {
+		return nil
+	}
+	name := call.Function.Name
+	if g.allowed != nil && !g.allowed[name] {
+		return fmt.Errorf("%w: %q", ErrToolNotAllowed, name)
+	}
+	if g.validate {
+		schema, ok := g.schemas[name]
+		if !ok || schema == nil {
+			return fmt.Errorf("%w for %q: no parameter schema to validate against", ErrInvalidToolArguments, name)
+		}
+		var value any
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &value); err != nil {
+			return fmt.Errorf("%w for %q: %v", ErrInvalidToolArguments, name, err)
+		}
+		if err := schema.check("arguments", value); err != nil {
+			return fmt.Errorf("%w for %q: %v", ErrInvalidToolArguments, name, err)
+		}
+	}
+	if g.approval[name] {
+		if g.approve == nil {
+			return fmt.Errorf("%w: %q needs approval but no approver is set", ErrToolDenied, name)
+		}
+		ok, err := g.approve(ctx, call)
+		if err != nil {
+			return fmt.Errorf("langmesh: approving tool %q: %w", name, err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrToolDenied, name)
+		}
+	}
+	return nil
+}
+
+// argumentSchema is the part of JSON Schema that tool arguments are
+// checked against; other keywords are ignored
+type argumentSchema struct {
+	Type                 any                        `json:"type,omitempty"`
+	Enum                 []any                      `json:"enum,omitempty"`
+	Properties           map[string]*argumentSchema `json:"properties,omitempty"`
+	Required             []string                   `json:"required,omitempty"`
+	Items                *argumentSchema            `json:"items,omitempty"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties,omitempty"`
+	Minimum              *float64                   `json:"minimum,omitempty"`
+	Maximum              *float64                   `json:"maximum,omitempty"`
+	MinLength            *int                       `json:"minLength,omitempty"`
+	MaxLength            *int                       `json:"maxLength,omitempty"`
+	Pattern              string                     `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// parseArgumentSchema reads a tool's Parameters, whatever type holds them,
+// or returns nil if they are not a JSON schema
+func parseArgumentSchema(parameters any) *argumentSchema {
+	data, ok := parameters.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(parameters); err != nil {
+			return nil
+		}
+	}
+	var schema argumentSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil
+	}
+	return &schema
+}
+
+func (s *argumentSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+// check validates value, found at path
+func (s *argumentSchema) check(path string, value any) error {
+	if types := s.types(); len(types) > 0 {
+		got := jsonType(value)
+		if !slices.Contains(types, got) && !(got == "integer" && slices.Contains(types, "number")) {
+			return fmt.Errorf("%s must be %s, got %s", path, strings.Join(types, " or "), got)
+		}
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return jsonEqual(e, value) }) {
+		return fmt.Errorf("%s is not one of the allowed values", path)
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", path, *s.Maximum)
+		}
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s must be at most %d characters", path, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if s.pattern == nil {
+				re, err := regexp.Compile(s.Pattern)
+				if err != nil {
+					return fmt.Errorf("%s has an invalid pattern in its schema", path)
+				}
+				s.pattern = re
+			}
+			if !s.pattern.MatchString(v) {
+				return fmt.Errorf("%s does not match %s", path, s.Pattern)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.check(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is missing required %s", path, name)
+			}
+		}
+		var extra *argumentSchema
+		closed := string(s.AdditionalProperties) == "false"
+		if len(s.AdditionalProperties) > 0 && !closed {
+			extra = parseArgumentSchema(s.AdditionalProperties)
+		}
+		for name, field := range v {
+			prop, ok := s.Properties[name]
+			switch {
+			case ok && prop != nil:
+				if err := prop.check(path+"."+name, field); err != nil {
+					return err
+				}
+			case closed:
+				return fmt.Errorf("%s has unexpected field %s", path, name)
+			case extra != nil:
+				if err := extra.check(path+"."+name, field); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonEqual(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(x) == string(y)
+}
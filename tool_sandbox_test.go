@@ -0,0 +1,155 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func sandboxCall(name, arguments string) openai.ToolCall {
+	return openai.ToolCall{ID: "call_" + name, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+func sandboxTools(t *testing.T) ([]openai.Tool, map[string]ToolFunc, *int) {
+	t.Helper()
+	ran := 0
+	weather := MustNewTool("weather", "", func(args weatherArgs) (string, error) {
+		ran++
+		return "sunny in " + args.City, nil
+	})
+	remove := MustNewTool("delete_file", "", func(args struct {
+		Path string `json:"path"`
+	}) (string, error) {
+		ran++
+		return "deleted " + args.Path, nil
+	})
+	definitions, tools := ToolSet(weather, remove)
+	return definitions, tools, &ran
+}
+
+func TestToolAllowList(t *testing.T) {
+	definitions, tools, ran := sandboxTools(t)
+	opts := RunToolsOptions{AllowedTools: []string{"weather"}}
+	ctx := context.Background()
+
+	if _, err := ExecuteToolCalls(ctx, definitions, tools, []openai.ToolCall{sandboxCall("delete_file", `{"path":"/"}`)}, opts); !errors.Is(err, ErrToolNotAllowed) {
+		t.Fatalf("err = %v, want ErrToolNotAllowed", err)
+	}
+	if *ran != 0 {
+		t.Error("a disallowed tool ran")
+	}
+	outputs, err := ExecuteToolCalls(ctx, definitions, tools, []openai.ToolCall{sandboxCall("weather", `{"city":"Rome"}`)}, opts)
+	if err != nil || outputs[0] != "sunny in Rome" {
+		t.Errorf("outputs = %q, %v", outputs, err)
+	}
+}
+
+func TestToolArgumentValidation(t *testing.T) {
+	definitions, tools, ran := sandboxTools(t)
+	opts := RunToolsOptions{ValidateArguments: true}
+	ctx := context.Background()
+
+	for arguments, want := range map[string]string{
+		`{"units":"celsius"}`:              "missing required city",
+		`{"city":7}`:                       "arguments.city must be string",
+		`{"city":"Rome","units":"kelvin"}`: "arguments.units is not one of",
+		`{"city":"Rome","tags":["a",1]}`:   "arguments.tags[1] must be string",
+		`{"city":"Rome","wind":true}`:      "unexpected field wind",
+		`not json`:                         "invalid tool arguments",
+	} {
+		_, err := ExecuteToolCalls(ctx, definitions, tools, []openai.ToolCall{sandboxCall("weather", arguments)}, opts)
+		if !errors.Is(err, ErrInvalidToolArguments) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", arguments, err, want)
+		}
+	}
+	if *ran != 0 {
+		t.Error("a tool ran with invalid arguments")
+	}
+	if _, err := ExecuteToolCalls(ctx, definitions, tools, []openai.ToolCall{sandboxCall("weather", `{"city":"Rome","days":3}`)}, opts); err != nil {
+		t.Errorf("valid call: %v", err)
+	}
+
+	// Without definitions there is nothing to validate against
+	if _, err := ExecuteToolCalls(ctx, nil, tools, []openai.ToolCall{sandboxCall("weather", `{"city":"Rome"}`)}, opts); !errors.Is(err, ErrInvalidToolArguments) {
+		t.Errorf("err = %v, want ErrInvalidToolArguments", err)
+	}
+}
+
+func checkSchema(schema *argumentSchema, arguments string) error {
+	var value any
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return err
+	}
+	return schema.check("arguments", value)
+}
+
+func TestArgumentSchemaBounds(t *testing.T) {
+	schema := parseArgumentSchema(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"n":    map[string]any{"type": "integer", "minimum": 1, "maximum": 10},
+			"code": map[string]any{"type": "string", "pattern": "^[A-Z]{3}$", "maxLength": 3},
+			"x":    map[string]any{"type": []string{"number", "null"}},
+		},
+		"additionalProperties": map[string]any{"type": "boolean"},
+	})
+	for value, want := range map[string]string{
+		`{"n":0}`:         "arguments.n must be at least 1",
+		`{"n":2.5}`:       "arguments.n must be integer",
+		`{"code":"abc"}`:  "does not match",
+		`{"x":"1"}`:       "number or null",
+		`{"extra":"yes"}`: "arguments.extra must be boolean",
+	} {
+		err := checkSchema(schema, value)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", value, err, want)
+		}
+	}
+	if err := checkSchema(schema, `{"n":10,"code":"EUR","x":null,"extra":true}`); err != nil {
+		t.Errorf("valid arguments: %v", err)
+	}
+}
+
+func TestToolApproval(t *testing.T) {
+	definitions, tools, ran := sandboxTools(t)
+	var asked []string
+	approve := true
+	opts := RunToolsOptions{
+		RequireApproval:  []string{"delete_file"},
+		ReportToolErrors: true,
+		Approve: func(_ context.Context, call openai.ToolCall) (bool, error) {
+			asked = append(asked, call.Function.Arguments)
+			return approve, nil
+		},
+	}
+	ctx := context.Background()
+	calls := []openai.ToolCall{sandboxCall("weather", `{"city":"Rome"}`), sandboxCall("delete_file", `{"path":"/tmp/x"}`)}
+
+	approve = false
+	outputs, err := ExecuteToolCalls(ctx, definitions, tools, calls, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0] != "sunny in Rome" || !strings.Contains(outputs[1], "denied") || *ran != 1 {
+		t.Errorf("denied outputs = %q, ran = %d", outputs, *ran)
+	}
+
+	approve = true
+	outputs, err = ExecuteToolCalls(ctx, definitions, tools, calls[1:], opts)
+	if err != nil || outputs[0] != "deleted /tmp/x" {
+		t.Errorf("approved outputs = %q, %v", outputs, err)
+	}
+	if len(asked) != 2 {
+		t.Errorf("approver asked %d times, want only for delete_file", len(asked))
+	}
+
+	opts.Approve = nil
+	opts.ReportToolErrors = false
+	if _, err := ExecuteToolCalls(ctx, definitions, tools, calls[1:], opts); !errors.Is(err, ErrToolDenied) {
+		t.Errorf("without an approver: err = %v, want ErrToolDenied", err)
+	}
+}
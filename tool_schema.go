@@ -0,0 +1,298 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// Tool is a Go function exposed to the model, with its parameter schema
+// generated from the function's argument type
+type Tool struct {
+	Definition openai.Tool
+	Func       ToolFunc
+}
+
+// NewTool builds a tool from fn, which must have the form
+//
+//	func([ctx context.Context,] args T) (R, error)
+//
+// where T is a struct (or pointer to one). The parameter schema is generated
+// from T's fields: names come from json tags, descriptions from
+// `description:"..."` tags, allowed values from comma-separated
+// `enum:"..."` tags, and every field is required unless it is a pointer or
+// tagged omitempty. Arguments from the model are validated against T before
+// fn is called. A string R is returned to the model as is; anything else is
+// marshaled to JSON.
+func NewTool(name, description string, fn any) (Tool, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return Tool{}, fmt.Errorf("langmesh: tool %q: want a func, got %T", name, fn)
+	}
+	t := v.Type()
+	withCtx := t.NumIn() == 2 && t.In(0) == contextType
+	if (t.NumIn() != 1 && !withCtx) || t.NumOut() != 2 || t.Out(1) != errorType {
+		return Tool{}, fmt.Errorf("langmesh: tool %q: want func([context.Context,] T) (R, error), got %s", name, t)
+	}
+	argType := t.In(t.NumIn() - 1)
+	structType := argType
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return Tool{}, fmt.Errorf("langmesh: tool %q: arguments must be a struct, got %s", name, argType)
+	}
+
+	schema := schemaFor(structType, map[reflect.Type]bool{})
+	call := func(ctx context.Context, arguments string) (string, error) {
+		if err := validateArguments(schema, arguments); err != nil {
+			return "", err
+		}
+		arg := reflect.New(structType)
+		dec := json.NewDecoder(strings.NewReader(arguments))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(arg.Interface()); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		if argType.Kind() != reflect.Pointer {
+			arg = arg.Elem()
+		}
+
+		in := []reflect.Value{arg}
+		if withCtx {
+			in = []reflect.Value{reflect.ValueOf(ctx), arg}
+		}
+		out := v.Call(in)
+		if err, _ := out[1].Interface().(error); err != nil {
+			return "", err
+		}
+		if s, ok := out[0].Interface().(string); ok {
+			return s, nil
+		}
+		data, err := json.Marshal(out[0].Interface())
+		if err != nil {
+			return "", fmt.Errorf("marshal result: %w", err)
+		}
+		return string(data), nil
+	}
+
+	return Tool{
+		Definition: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        name,
+				Description: description,
+				Parameters:  schema,
+			},
+		},
+		Func: call,
+	}, nil
+}
+
+// MustNewTool is like NewTool but panics if fn has an unsupported signature
+func MustNewTool(name, description string, fn any) Tool {
+	tool, err := NewTool(name, description, fn)
+	if err != nil {
+		panic(err)
+	}
+	return tool
+}
+
+// ToolSet splits tools into the definitions for a chat request and the
+// handlers for RunTools
+func ToolSet(tools ...Tool) ([]openai.Tool, map[string]ToolFunc) {
+	defs := make([]openai.Tool, 0, len(tools))
+	funcs := make(map[string]ToolFunc, len(tools))
+	for _, tool := range tools {
+		defs = append(defs, tool.Definition)
+		funcs[tool.Definition.Function.Name] = tool.Func
+	}
+	return defs, funcs
+}
+
+// toolSchema is the subset of JSON Schema generated for tool parameters
+type toolSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*toolSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *toolSchema            `json:"items,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+}
+
+// schemaFor generates t's schema. visiting holds the struct types being
+// generated above t; a recursive type is cut off at its first repeat with
+// an open object.
+func schemaFor(t reflect.Type, visiting map[reflect.Type]bool) *toolSchema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &toolSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &toolSchema{Type: "string"}
+	case reflect.Bool:
+		return &toolSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &toolSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &toolSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json encodes []byte as a base64 string
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &toolSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &toolSchema{Type: "array", Items: schemaFor(t.Elem(), visiting)}
+	case reflect.Map:
+		return &toolSchema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return &toolSchema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		schema := &toolSchema{Type: "object", Properties: map[string]*toolSchema{}, AdditionalProperties: false}
+		structFields(schema, t, true, visiting)
+		sort.Strings(schema.Required)
+		return schema
+	}
+	// Interfaces and anything else accept any JSON value
+	return &toolSchema{}
+}
+
+// structFields adds t's fields to schema, flattening untagged embedded
+// structs as encoding/json does. Fields of t take precedence over the ones
+// it embeds, and embedded fields are only required when required is set,
+// that is when no pointer embeds them.
+func structFields(schema *toolSchema, t reflect.Type, required bool, visiting map[reflect.Type]bool) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitempty := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && !hasJSONName(field) {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				if !field.IsExported() {
+					// encoding/json cannot allocate these
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, field)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		prop := schemaFor(field.Type, visiting)
+		prop.Description = field.Tag.Get("description")
+		if enum := field.Tag.Get("enum"); enum != "" {
+			prop.Enum = strings.Split(enum, ",")
+		}
+		schema.Properties[name] = prop
+		if required && !omitempty && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	for _, field := range embedded {
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if visiting[ft] {
+			continue
+		}
+		visiting[ft] = true
+		inner := &toolSchema{Properties: map[string]*toolSchema{}}
+		structFields(inner, ft, required && field.Type.Kind() != reflect.Pointer, visiting)
+		delete(visiting, ft)
+		for name, prop := range inner.Properties {
+			if _, ok := schema.Properties[name]; !ok {
+				schema.Properties[name] = prop
+				if slices.Contains(inner.Required, name) {
+					schema.Required = append(schema.Required, name)
+				}
+			}
+		}
+	}
+}
+
+// hasJSONName reports whether field's json tag names it, which keeps an
+// embedded struct from being flattened
+func hasJSONName(field reflect.StructField) bool {
+	tag, _ := field.Tag.Lookup("json")
+	name, _, _ := strings.Cut(tag, ",")
+	return name != ""
+}
+
+func jsonFieldName(field reflect.StructField) (name string, omitempty bool) {
+	name = field.Name
+	tag, ok := field.Tag.Lookup("json")
+	if !ok {
+		return name, false
+	}
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
+
+// validateArguments checks the model's arguments for missing required
+// fields and values outside their enum before they are decoded
+func validateArguments(schema *toolSchema, arguments string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &fields); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	var missing []string
+	for _, name := range schema.Required {
+		if _, ok := fields[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("invalid arguments: missing required %s", strings.Join(missing, ", "))
+	}
+	for name, raw := range fields {
+		prop, ok := schema.Properties[name]
+		if !ok || len(prop.Enum) == 0 {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || !slices.Contains(prop.Enum, value) {
+			return fmt.Errorf("invalid arguments: %s must be one of %s", name, strings.Join(prop.Enum, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type weatherArgs struct {
+	City  string   `json:"city" description:"City name"`
+	Units string   `json:"units,omitempty" enum:"celsius,fahrenheit"`
+	Days  *int     `json:"days"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type weatherResult struct {
+	TempC float64 `json:"temp_c"`
+}
+
+func TestNewToolSchema(t *testing.T) {
+	tool, err := NewTool("weather", "Current weather", func(ctx context.Context, args weatherArgs) (weatherResult, error) {
+		return weatherResult{TempC: 21.5}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(tool.Definition.Function.Parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	_ = json.Unmarshal(data, &schema)
+
+	props := schema["properties"].(map[string]any)
+	city := props["city"].(map[string]any)
+	if city["type"] != "string" || city["description"] != "City name" {
+		t.Errorf("city schema = %v", city)
+	}
+	if units := props["units"].(map[string]any); len(units["enum"].([]any)) != 2 {
+		t.Errorf("units schema = %v", units)
+	}
+	if tags := props["tags"].(map[string]any); tags["type"] != "array" {
+		t.Errorf("tags schema = %v", tags)
+	}
+	if req := schema["required"].([]any); len(req) != 1 || req[0] != "city" {
+		t.Errorf("required = %v, want [city]", req)
+	}
+	if schema["additionalProperties"] != false {
+		t.Errorf("additionalProperties = %v, want false", schema["additionalProperties"])
+	}
+}
+
+func TestNewToolCall(t *testing.T) {
+	var got weatherArgs
+	tool := MustNewTool("weather", "", func(args weatherArgs) (weatherResult, error) {
+		got = args
+		return weatherResult{TempC: 21.5}, nil
+	})
+
+	out, err := tool.Func(context.Background(), `{"city":"Paris","units":"celsius"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"temp_c":21.5}` || got.City != "Paris" {
+		t.Errorf("out = %s, args = %+v", out, got)
+	}
+
+	cases := map[string]string{
+		`{"units":"celsius"}`:          "missing required city",
+		`{"city":"Paris","units":"k"}`: "units must be one of",
+		`{"city":"Paris","wind":true}`: "unknown field",
+		`{"city":42}`:                  "invalid arguments",
+	}
+	for args, want := range cases {
+		if _, err := tool.Func(context.Background(), args); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("args %s: err = %v, want %q", args, err, want)
+		}
+	}
+}
+
+func TestNewToolRejectsBadSignatures(t *testing.T) {
+	for _, fn := range []any{
+		"not a func",
+		nil,
+		func(string) (string, error) { return "", nil },
+		func(weatherArgs) string { return "" },
+		func(context.Context, weatherArgs, int) (string, error) { return "", nil },
+	} {
+		if _, err := NewTool("bad", "", fn); err == nil {
+			t.Errorf("NewTool accepted %T", fn)
+		}
+	}
+}
+
+func TestToolSetWithRunTools(t *testing.T) {
+	srv := newToolServer(t, "weather")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+
+	defs, funcs := ToolSet(MustNewTool("weather", "", func(args weatherArgs) (string, error) {
+		return "sunny in " + args.City, nil
+	}))
+	request := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "weather?"}},
+		Tools:    defs,
+	}
+	result, err := client.RunTools(context.Background(), request, funcs, RunToolsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Response.Choices[0].Message.Content; got != "answer: sunny in Paris" {
+		t.Errorf("answer = %q", got)
+	}
+}
+
+type treeArgs struct {
+	Name string     `json:"name"`
+	Kids []treeArgs `json:"kids,omitempty"`
+}
+
+func TestNewToolRecursiveType(t *testing.T) {
+	tool, err := NewTool("tree", "", func(args treeArgs) (string, error) {
+		return args.Kids[0].Name, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := tool.Definition.Function.Parameters.(*toolSchema)
+	kids := schema.Properties["kids"]
+	if kids.Type != "array" || kids.Items.Type != "object" || kids.Items.Properties != nil {
+		t.Errorf("kids schema = %+v, want an array of open objects", kids)
+	}
+	out, err := tool.Func(context.Background(), `{"name":"root","kids":[{"name":"leaf"}]}`)
+	if err != nil || out != "leaf" {
+		t.Errorf("out = %q, err = %v", out, err)
+	}
+}
+
+type baseArgs struct {
+	ID   string `json:"id"`
+	Note string `json:"note,omitempty"`
+}
+
+type embeddedArgs struct {
+	baseArgs
+	Name string `json:"name"`
+	Note int    `json:"note"`
+	Data []byte `json:"data,omitempty"`
+}
+
+func TestNewToolEmbeddedStruct(t *testing.T) {
+	var got embeddedArgs
+	tool := MustNewTool("embedded", "", func(args embeddedArgs) (string, error) {
+		got = args
+		return "ok", nil
+	})
+	schema := tool.Definition.Function.Parameters.(*toolSchema)
+	if _, ok := schema.Properties["baseArgs"]; ok {
+		t.Error("embedded struct is a property")
+	}
+	if schema.Properties["id"] == nil || schema.Properties["note"].Type != "integer" {
+		t.Errorf("properties = %v, want id flattened and the outer note", schema.Properties)
+	}
+	if strings.Join(schema.Required, ",") != "id,name,note" {
+		t.Errorf("required = %v", schema.Required)
+	}
+	if data := schema.Properties["data"]; data.Type != "string" || data.ContentEncoding != "base64" {
+		t.Errorf("data schema = %+v, want a base64 string", data)
+	}
+
+	if _, err := tool.Func(context.Background(), `{"id":"a1","name":"x","note":3,"data":"aGk="}`); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "a1" || got.Name != "x" || got.Note != 3 || string(got.Data) != "hi" {
+		t.Errorf("args = %+v", got)
+	}
+}
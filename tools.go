@@ -0,0 +1,313 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultMaxToolIterations bounds RunTools when RunToolsOptions.MaxIterations
+// is unset
+const DefaultMaxToolIterations = 10
+
+var (
+	// ErrMaxToolIterations is returned by RunTools when the model is still
+	// calling tools after MaxIterations completions
+	ErrMaxToolIterations = errors.New("langmesh: tool loop did not finish within the iteration limit")
+
+	// ErrUnknownTool is returned by RunTools when the model calls a tool
+	// that was not registered
+	ErrUnknownTool = errors.New("langmesh: unknown tool")
+
+	// ErrToolPanicked wraps the value a tool panicked with, which RunTools
+	// treats as that tool's error
+	ErrToolPanicked = errors.New("langmesh: tool panicked")
+)
+
+// ToolFunc executes one tool call. arguments is the JSON object produced by
+// the model; the returned string is sent back as the tool's result.
+type ToolFunc func(ctx context.Context, arguments string) (string, error)
+
+// RunToolsOptions configures RunTools
+type RunToolsOptions struct {
+	// MaxIterations caps the number of chat completions. Defaults to
+	// DefaultMaxToolIterations.
+	MaxIterations int
+
+	// ReportToolErrors sends tool failures, including calls to unknown
+	// tools, back to the model as the tool result instead of ending the
+	// loop, so it can retry or answer without them
+	ReportToolErrors bool
+
+	// Parallelism is how many of one completion's tool calls run at once.
+	// Zero or one runs them in order. Results are sent back in the order
+	// of the calls either way; without ReportToolErrors the first failure
+	// cancels the calls still running.
+	Parallelism int
+
+	// ToolTimeout bounds each tool call, unless ToolTimeouts has an entry
+	// for the tool; zero means no limit. A call that times out fails with
+	// context.DeadlineExceeded, and a tool that panics fails with
+	// ErrToolPanicked.
+	ToolTimeout  time.Duration
+	ToolTimeouts map[string]time.Duration
+
+	// AllowedTools, if non-nil, lists the only tools the model may call;
+	// a call to any other fails with ErrToolNotAllowed
+	AllowedTools []string
+
+	// ValidateArguments checks each call's arguments against its tool's
+	// Parameters schema before the tool runs, failing a mismatch with
+	// ErrInvalidToolArguments
+	ValidateArguments bool
+
+	// RequireApproval lists tools that only run once Approve confirms the
+	// call; a call Approve declines, or any with no Approve set, fails with
+	// ErrToolDenied
+	RequireApproval []string
+	Approve         ToolApprover
+}
+
+// ToolRunResult is the outcome of RunTools
+type ToolRunResult struct {
+	// Response is the last chat completion received
+	Response openai.ChatCompletionResponse
+
+	// Messages is the full conversation, including the assistant's tool
+	// calls and the tool results
+	Messages []openai.ChatCompletionMessage
+
+	// Iterations is the number of chat completions made
+	Iterations int
+}
+
+// toolLoop identifies a chat completion made by RunTools
+type toolLoop struct {
+	id        string
+	iteration int
+}
+
+// RunTools sends request and executes the tool calls the model asks for
+// with the matching entry in tools, appending their results and repeating
+// until the model answers without calling a tool. request.Tools must
+// describe the tools to the model. Every completion is recorded as its own
+// telemetry event, tagged with the loop ID and iteration number.
+func (c *Client) RunTools(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	tools map[string]ToolFunc,
+	opts RunToolsOptions,
+) (ToolRunResult, error) {
+	maxIterations := opts.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxToolIterations
+	}
+
+	loopID := newRequestID()
+	result := ToolRunResult{
+		Messages: append([]openai.ChatCompletionMessage(nil), request.Messages...),
+	}
+
+	for result.Iterations < maxIterations {
+		result.Iterations++
+		iterCtx := deriveCarrier(ctx, func(s *scopeCarrier) {
+			s.loop = toolLoop{id: loopID, iteration: result.Iterations}
+		})
+
+		request.Messages = result.Messages
+		resp, err := c.CreateChatCompletion(iterCtx, request)
+		if err != nil {
+			return result, err
+		}
+		result.Response = resp
+		if len(resp.Choices) == 0 {
+			return result, fmt.Errorf("langmesh: tool loop got a completion with no choices")
+		}
+
+		message := resp.Choices[0].Message
+		result.Messages = append(result.Messages, message)
+		if len(message.ToolCalls) == 0 {
+			return result, nil
+		}
+
+		outputs, err := ExecuteToolCalls(ctx, request.Tools, tools, message.ToolCalls, opts)
+		if err != nil {
+			return result, err
+		}
+		for i, call := range message.ToolCalls {
+			result.Messages = append(result.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    outputs[i],
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return result, ErrMaxToolIterations
+}
+
+// ExecuteToolCalls runs one completion's tool calls the way RunTools does,
+// with up to opts.Parallelism at once, returning their outputs in call
+// order. definitions are the tools offered to the model, for
+// opts.ValidateArguments. It is for tool loops built outside RunTools, such
+// as agents.
+func ExecuteToolCalls(
+	ctx context.Context,
+	definitions []openai.Tool,
+	tools map[string]ToolFunc,
+	calls []openai.ToolCall,
+	opts RunToolsOptions,
+) ([]string, error) {
+	r := newToolRunner(ctx, definitions, tools, opts, min(max(opts.Parallelism, 1), len(calls)))
+	for _, call := range calls {
+		if !r.submit(call) {
+			break
+		}
+	}
+	return r.wait()
+}
+
+// toolRunner executes tool calls as they are submitted, with up to workers
+// at once
+type toolRunner struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tools  map[string]ToolFunc
+	opts   RunToolsOptions
+	gate   *toolGate
+	next   chan int
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	calls    []openai.ToolCall
+	outputs  []string
+	firstErr error
+}
+
+func newToolRunner(ctx context.Context, definitions []openai.Tool, tools map[string]ToolFunc, opts RunToolsOptions, workers int) *toolRunner {
+	r := &toolRunner{tools: tools, opts: opts, gate: newToolGate(definitions, opts), next: make(chan int)}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	for w := 0; w < workers; w++ {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for i := range r.next {
+				r.run(i)
+			}
+		}()
+	}
+	return r
+}
+
+// submit queues call, waiting for a free worker. It reports false once a
+// failure has stopped the run.
+func (r *toolRunner) submit(call openai.ToolCall) bool {
+	if !r.opts.ReportToolErrors && r.ctx.Err() != nil {
+		return false
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.outputs = append(r.outputs, "")
+	i := len(r.calls) - 1
+	r.mu.Unlock()
+	r.next <- i
+	return true
+}
+
+func (r *toolRunner) run(i int) {
+	r.mu.Lock()
+	call := r.calls[i]
+	r.mu.Unlock()
+	output, err := runTool(r.ctx, r.tools, r.gate, call, r.opts)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.opts.ReportToolErrors {
+			output = "error: " + err.Error()
+		} else if r.firstErr == nil {
+			r.firstErr = err
+			r.cancel()
+		}
+	}
+	r.outputs[i] = output
+}
+
+// wait returns the submitted calls' outputs in order once they finish
+func (r *toolRunner) wait() ([]string, error) {
+	close(r.next)
+	r.wg.Wait()
+	r.cancel()
+	return r.outputs, r.firstErr
+}
+
+// toolOutcome is what a tool call returned
+type toolOutcome struct {
+	output string
+	err    error
+}
+
+// runTool calls the tool in its own goroutine, so that a timeout or
+// cancellation ends the call even if the tool ignores its context. gate
+// is checked first, so a timeout does not cover waiting for approval.
+func runTool(
+	ctx context.Context,
+	tools map[string]ToolFunc,
+	gate *toolGate,
+	call openai.ToolCall,
+	opts RunToolsOptions,
+) (string, error) {
+	name := call.Function.Name
+	fn, ok := tools[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownTool, name)
+	}
+	if err := gate.check(ctx, call); err != nil {
+		return "", err
+	}
+	timeout := opts.ToolTimeout
+	if t, ok := opts.ToolTimeouts[name]; ok {
+		timeout = t
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan toolOutcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- toolOutcome{err: fmt.Errorf("langmesh: tool %q: %w: %v", name, ErrToolPanicked, r)}
+			}
+		}()
+		output, err := fn(ctx, call.Function.Arguments)
+		if err != nil {
+			err = fmt.Errorf("langmesh: tool %q: %w", name, err)
+		}
+		done <- toolOutcome{output: output, err: err}
+	}()
+	select {
+	case outcome := <-done:
+		if outcome.err != nil {
+			return "", outcome.err
+		}
+		return outcome.output, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("langmesh: tool %q: %w", name, ctx.Err())
+	}
+}
+
+// applyToolLoop copies RunTools loop details on ctx onto event
+func applyToolLoop(ctx context.Context, event *TelemetryEvent) {
+	carrier := carrierFrom(ctx)
+	if carrier == nil {
+		return
+	}
+	event.ToolLoopID = carrier.loop.id
+	event.ToolIteration = carrier.loop.iteration
+}
@@ -0,0 +1,181 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// toolStreamBuffer is how many content pieces ToolStream.Tokens holds
+// before the loop waits for the caller
+const toolStreamBuffer = 64
+
+// ToolStream is a RunToolsStream loop in progress
+type ToolStream struct {
+	// Tokens receives each completion's content as it streams in, and is
+	// closed when the loop ends. It must be drained, or the loop stalls.
+	Tokens <-chan string
+
+	done   chan struct{}
+	result ToolRunResult
+	err    error
+}
+
+// Wait blocks until the loop ends and returns its outcome
+func (s *ToolStream) Wait() (ToolRunResult, error) {
+	<-s.done
+	return s.result, s.err
+}
+
+// RunToolsStream is RunTools over streamed completions. Each tool call
+// starts as soon as its arguments are complete, that is once the model
+// moves on to the next call or ends the completion, while the rest of the
+// completion is still streaming. The answer's content is sent to Tokens
+// piece by piece; so is any content the model streams alongside its tool
+// calls. ToolRunResult.Response is the last completion, assembled.
+func (c *Client) RunToolsStream(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	tools map[string]ToolFunc,
+	opts RunToolsOptions,
+) *ToolStream {
+	tokens := make(chan string, toolStreamBuffer)
+	s := &ToolStream{Tokens: tokens, done: make(chan struct{})}
+	c.goroutine("tools.stream", func() {
+		defer close(s.done)
+		defer close(tokens)
+		s.result, s.err = c.runToolsStream(ctx, request, tools, opts, tokens)
+	})
+	return s
+}
+
+func (c *Client) runToolsStream(
+	ctx context.Context,
+	request openai.ChatCompletionRequest,
+	tools map[string]ToolFunc,
+	opts RunToolsOptions,
+	tokens chan<- string,
+) (ToolRunResult, error) {
+	maxIterations := opts.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxToolIterations
+	}
+
+	loopID := newRequestID()
+	result := ToolRunResult{
+		Messages: append([]openai.ChatCompletionMessage(nil), request.Messages...),
+	}
+
+	for result.Iterations < maxIterations {
+		result.Iterations++
+		iterCtx := deriveCarrier(ctx, func(s *scopeCarrier) {
+			s.loop = toolLoop{id: loopID, iteration: result.Iterations}
+		})
+
+		request.Messages = result.Messages
+		resp, outputs, err := c.streamToolIteration(ctx, iterCtx, request, tools, opts, tokens)
+		result.Response = resp
+		if err != nil {
+			return result, err
+		}
+		if len(resp.Choices) == 0 {
+			return result, fmt.Errorf("langmesh: tool loop got a completion with no choices")
+		}
+
+		message := resp.Choices[0].Message
+		result.Messages = append(result.Messages, message)
+		if len(message.ToolCalls) == 0 {
+			return result, nil
+		}
+		for i, call := range message.ToolCalls {
+			result.Messages = append(result.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    outputs[i],
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return result, ErrMaxToolIterations
+}
+
+// streamToolIteration streams one completion, forwarding its content to
+// tokens and running each of its tool calls once the call is complete. It
+// returns the assembled completion and the outputs of its tool calls.
+func (c *Client) streamToolIteration(
+	ctx, iterCtx context.Context,
+	request openai.ChatCompletionRequest,
+	tools map[string]ToolFunc,
+	opts RunToolsOptions,
+	tokens chan<- string,
+) (openai.ChatCompletionResponse, []string, error) {
+	stream, err := c.CreateChatCompletionStream(iterCtx, request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, nil, err
+	}
+	defer stream.Close()
+
+	var runner *toolRunner
+	submitted := 0
+	// submit hands the runner every call before the n-th
+	submit := func(calls []openai.ToolCall, n int) {
+		if runner == nil && n > submitted {
+			runner = newToolRunner(ctx, request.Tools, tools, opts, max(opts.Parallelism, 1))
+		}
+		for ; submitted < n; submitted++ {
+			if !runner.submit(calls[submitted]) {
+				return
+			}
+		}
+	}
+	stop := func() {
+		if runner != nil {
+			runner.wait()
+		}
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stop()
+			return stream.response(), nil, err
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.Delta.Content != "" {
+				select {
+				case tokens <- choice.Delta.Content:
+				case <-ctx.Done():
+					stop()
+					return stream.response(), nil, ctx.Err()
+				}
+			}
+			if len(choice.Delta.ToolCalls) > 0 {
+				// Every call but the last one started is complete
+				calls := stream.toolCalls()
+				submit(calls, len(calls)-1)
+			}
+		}
+	}
+
+	resp := stream.response()
+	if len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+		stop()
+		return resp, nil, nil
+	}
+	calls := resp.Choices[0].Message.ToolCalls
+	submit(calls, len(calls))
+	outputs, err := runner.wait()
+	if err == nil && len(outputs) < len(calls) {
+		err = ctx.Err()
+	}
+	return resp, outputs, err
+}
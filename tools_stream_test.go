@@ -0,0 +1,109 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRunToolsStream(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(delta string, finish string) {
+			fmt.Fprintf(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":%s,\"finish_reason\":%s}]}\n\n", delta, finish)
+			w.(http.Flusher).Flush()
+		}
+
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != openai.ChatMessageRoleTool {
+			send(`{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":"}}]}`, "null")
+			send(`{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}`, "null")
+			send(`{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Rome\"}"}}]}`, "null")
+			// The first call must be running before the completion ends
+			select {
+			case <-started:
+			case <-time.After(2 * time.Second):
+				t.Error("first tool call did not start while streaming")
+			}
+			send(`{}`, `"tool_calls"`)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		results := []string{req.Messages[len(req.Messages)-2].Content, last.Content}
+		send(`{"role":"assistant","content":"Weather: "}`, "null")
+		send(fmt.Sprintf(`{"content":%q}`, strings.Join(results, ", ")), `"stop"`)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+	tools := map[string]ToolFunc{
+		"weather": func(ctx context.Context, arguments string) (string, error) {
+			var args struct{ City string }
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", err
+			}
+			if args.City == "Paris" {
+				close(started)
+			}
+			return "sunny in " + args.City, nil
+		},
+	}
+	stream := client.RunToolsStream(context.Background(), chatRequest("weather?"), tools, RunToolsOptions{Parallelism: 2})
+	var answer strings.Builder
+	for token := range stream.Tokens {
+		answer.WriteString(token)
+	}
+	result, err := stream.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := answer.String(); got != "Weather: sunny in Paris, sunny in Rome" {
+		t.Errorf("streamed answer = %q", got)
+	}
+	if result.Iterations != 2 || len(result.Messages) != 5 || result.Messages[2].ToolCallID != "call_1" {
+		t.Errorf("result = %+v", result)
+	}
+	if got := result.Response.Choices[0].Message.Content; got != answer.String() {
+		t.Errorf("response content = %q", got)
+	}
+	events := rec.all()
+	if len(events) != 2 || events[0].ToolLoopID == "" || events[1].ToolIteration != 2 {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestRunToolsStreamToolError(t *testing.T) {
+	srv := newStreamToolServer(t)
+	client := NewClient("test-key", WithBaseURL(srv.URL))
+	stream := client.RunToolsStream(context.Background(), chatRequest("hi"), map[string]ToolFunc{}, RunToolsOptions{})
+	for range stream.Tokens {
+	}
+	if _, err := stream.Wait(); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("err = %v, want ErrUnknownTool", err)
+	}
+}
+
+// newStreamToolServer streams a single call to a tool named "missing"
+func newStreamToolServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"missing\",\"arguments\":\"{}\"}}]},\"finish_reason\":\"tool_calls\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -0,0 +1,212 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newToolServer asks for the named tool until it is sent a tool result, then
+// answers with that result
+func newToolServer(t *testing.T, tool string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != openai.ChatMessageRoleTool {
+			fmt.Fprintf(w, `{"id":"c1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":%q,"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, tool)
+			return
+		}
+		if last.ToolCallID != "call_1" {
+			t.Errorf("tool result for %q, want call_1", last.ToolCallID)
+		}
+		fmt.Fprintf(w, `{"id":"c2","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"usage":{"prompt_tokens":20,"completion_tokens":5,"total_tokens":25}}`, "answer: "+last.Content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunToolsLoop(t *testing.T) {
+	srv := newToolServer(t, "weather")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec))
+
+	var gotArgs string
+	tools := map[string]ToolFunc{
+		"weather": func(_ context.Context, arguments string) (string, error) {
+			gotArgs = arguments
+			return "sunny", nil
+		},
+	}
+	request := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "weather in Paris?"}},
+	}
+	result, err := client.RunTools(context.Background(), request, tools, RunToolsOptions{})
+	if err != nil {
+		t.Fatalf("RunTools: %v", err)
+	}
+	if gotArgs != `{"city":"Paris"}` {
+		t.Errorf("tool arguments = %q", gotArgs)
+	}
+	if result.Iterations != 2 || result.Response.Choices[0].Message.Content != "answer: sunny" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(result.Messages) != 4 || len(request.Messages) != 1 {
+		t.Errorf("messages = %d (request %d), want 4 (1)", len(result.Messages), len(request.Messages))
+	}
+
+	events := rec.all()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want one per iteration", len(events))
+	}
+	for i, event := range events {
+		if event.ToolIteration != i+1 || event.ToolLoopID == "" || event.ToolLoopID != events[0].ToolLoopID {
+			t.Errorf("event %d: loop=%q iteration=%d", i, event.ToolLoopID, event.ToolIteration)
+		}
+	}
+}
+
+func TestRunToolsUnknownTool(t *testing.T) {
+	srv := newToolServer(t, "missing")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	request := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}
+
+	if _, err := client.RunTools(context.Background(), request, nil, RunToolsOptions{}); !errors.Is(err, ErrUnknownTool) {
+		t.Fatalf("err = %v, want ErrUnknownTool", err)
+	}
+
+	result, err := client.RunTools(context.Background(), request, nil, RunToolsOptions{ReportToolErrors: true})
+	if err != nil {
+		t.Fatalf("RunTools with ReportToolErrors: %v", err)
+	}
+	if got := result.Response.Choices[0].Message.Content; !strings.Contains(got, "unknown tool") {
+		t.Errorf("final answer = %q, want the reported error", got)
+	}
+}
+
+func TestRunToolsMaxIterations(t *testing.T) {
+	srv := newToolServer(t, "weather")
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+	tools := map[string]ToolFunc{
+		"weather": func(context.Context, string) (string, error) { return "sunny", nil },
+	}
+	request := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}
+
+	result, err := client.RunTools(context.Background(), request, tools, RunToolsOptions{MaxIterations: 1})
+	if !errors.Is(err, ErrMaxToolIterations) {
+		t.Fatalf("err = %v, want ErrMaxToolIterations", err)
+	}
+	if result.Iterations != 1 {
+		t.Errorf("iterations = %d, want 1", result.Iterations)
+	}
+}
+
+func TestRunToolsParallel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Messages[len(req.Messages)-1].Role != openai.ChatMessageRoleTool {
+			calls := make([]string, 0, 4)
+			for i, name := range []string{"slow", "fast", "panic", "hang"} {
+				calls = append(calls, fmt.Sprintf(`{"id":"call_%d","type":"function","function":{"name":%q,"arguments":"{}"}}`, i, name))
+			}
+			fmt.Fprintf(w, `{"id":"c1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","tool_calls":[%s]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, strings.Join(calls, ","))
+			return
+		}
+		fmt.Fprint(w, `{"id":"c2","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}],"usage":{"prompt_tokens":20,"completion_tokens":5,"total_tokens":25}}`)
+	}))
+	t.Cleanup(srv.Close)
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"))
+
+	var running, peak int32
+	track := func() func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		return func() { atomic.AddInt32(&running, -1) }
+	}
+	release := make(chan struct{})
+	slowStarted := make(chan struct{})
+	var once sync.Once
+	tools := map[string]ToolFunc{
+		"slow": func(ctx context.Context, _ string) (string, error) {
+			defer track()()
+			once.Do(func() { close(slowStarted) })
+			time.Sleep(20 * time.Millisecond)
+			return "slow result", nil
+		},
+		"fast": func(ctx context.Context, _ string) (string, error) {
+			<-slowStarted
+			defer track()()
+			return "fast result", nil
+		},
+		"panic": func(ctx context.Context, _ string) (string, error) {
+			panic("boom")
+		},
+		// hang ignores its context; the timeout still ends the call
+		"hang": func(ctx context.Context, _ string) (string, error) {
+			<-release
+			return "", nil
+		},
+	}
+	defer close(release)
+
+	result, err := client.RunTools(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "go"}},
+	}, tools, RunToolsOptions{
+		Parallelism:      3,
+		ReportToolErrors: true,
+		ToolTimeouts:     map[string]time.Duration{"hang": 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := result.Messages[2:6]
+	for i, msg := range outputs {
+		if msg.ToolCallID != fmt.Sprintf("call_%d", i) {
+			t.Errorf("result %d is for %s", i, msg.ToolCallID)
+		}
+	}
+	if outputs[0].Content != "slow result" || outputs[1].Content != "fast result" ||
+		!strings.Contains(outputs[2].Content, "tool panicked: boom") ||
+		!strings.Contains(outputs[3].Content, context.DeadlineExceeded.Error()) {
+		t.Errorf("outputs = %+v", outputs)
+	}
+	if atomic.LoadInt32(&peak) != 2 {
+		t.Errorf("peak concurrency %d, want slow and fast together", peak)
+	}
+
+	_, err = client.RunTools(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "go"}},
+	}, tools, RunToolsOptions{Parallelism: 4, ToolTimeout: time.Second})
+	if !errors.Is(err, ErrToolPanicked) {
+		t.Errorf("err = %v, want the panic", err)
+	}
+}
@@ -0,0 +1,369 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultLangfuseHost is Langfuse Cloud's EU region
+	DefaultLangfuseHost = "https://cloud.langfuse.com"
+	// DefaultLangSmithURL is LangSmith's API
+	DefaultLangSmithURL = "https://api.smith.langchain.com"
+)
+
+// traceKey groups events into one trace: the ContextWithTraceParent or
+// Middleware trace, else the agent run or tool loop, else the call alone
+func traceKey(e TelemetryEvent) string {
+	for _, key := range []string{e.TraceID, e.RunID, e.ToolLoopID} {
+		if key != "" {
+			return key
+		}
+	}
+	return e.RequestID
+}
+
+// eventTimes are an event's start and end, the end to the millisecond
+// from its latency
+func eventTimes(e TelemetryEvent) (start, end time.Time) {
+	start, err := time.Parse(time.RFC3339, e.TimestampStart)
+	if err != nil {
+		return e.EndTime(), e.EndTime()
+	}
+	return start.UTC(), start.UTC().Add(time.Duration(e.LatencyMs) * time.Millisecond)
+}
+
+// exportID is a UUID for the event's record of kind, the same on every
+// delivery so retried batches are deduplicated
+func exportID(kind string, e TelemetryEvent) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("langmesh:"+kind+":"+e.RequestID)).String()
+}
+
+// exportMetadata is what the trace formats have no field for
+func exportMetadata(e TelemetryEvent) map[string]any {
+	m := map[string]any{"request_id": e.RequestID, "endpoint": e.Endpoint, "status": e.Status}
+	for key, value := range map[string]string{
+		"provider":            e.Provider,
+		"project":             e.Project,
+		"error_class":         e.ErrorClass,
+		"finish_reason":       e.FinishReason,
+		"fallback_from":       e.FallbackFrom,
+		"upstream_request_id": e.UpstreamRequestID,
+		"trace_id":            e.TraceID,
+		"parent_span_id":      e.ParentSpanID,
+		"prompt_template":     e.PromptTemplate,
+		"prompt_version":      e.PromptVersion,
+		"prompt_hash":         e.PromptHash,
+		"completion_hash":     e.CompletionHash,
+	} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	m["cost_usd"] = e.CostEstimateUSD
+	if e.RetryCount > 0 {
+		m["retry_count"] = e.RetryCount
+	}
+	for key, value := range e.Attributes {
+		m[key] = value
+	}
+	return m
+}
+
+// exportTags renders the event's tags as sorted "key:value" labels
+func exportTags(e TelemetryEvent) []string {
+	tags := make([]string, 0, len(e.Tags))
+	for key, value := range e.Tags {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// postJSON posts body and returns the response for status codes under 300
+func postJSON(ctx context.Context, hc *http.Client, url string, body any, header http.Header) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// LangfuseSink sends telemetry to Langfuse's ingestion API, each call as a
+// generation within a trace. Calls sharing a ContextWithTraceParent trace, an
+// agent run or a tool loop share a trace. Prompts and completions are
+// included when WithContentCapture captures them.
+type LangfuseSink struct {
+	// Host defaults to DefaultLangfuseHost
+	Host       string
+	PublicKey  string
+	SecretKey  string
+	HTTPClient *http.Client
+}
+
+// NewLangfuseSink creates a sink for the Langfuse project with these API
+// keys
+func NewLangfuseSink(publicKey, secretKey string) *LangfuseSink {
+	return &LangfuseSink{
+		Host:       DefaultLangfuseHost,
+		PublicKey:  publicKey,
+		SecretKey:  secretKey,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type langfuseEvent struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Body      any    `json:"body"`
+}
+
+type langfuseTrace struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Timestamp string   `json:"timestamp"`
+	UserID    string   `json:"userId,omitempty"`
+	SessionID string   `json:"sessionId,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+type langfuseGeneration struct {
+	ID            string         `json:"id"`
+	TraceID       string         `json:"traceId"`
+	Name          string         `json:"name"`
+	StartTime     string         `json:"startTime"`
+	EndTime       string         `json:"endTime"`
+	Model         string         `json:"model,omitempty"`
+	Input         string         `json:"input,omitempty"`
+	Output        string         `json:"output,omitempty"`
+	Usage         langfuseUsage  `json:"usage"`
+	Level         string         `json:"level"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+	Metadata      map[string]any `json:"metadata,omitempty"`
+}
+
+type langfuseUsage struct {
+	Input     int     `json:"input"`
+	Output    int     `json:"output"`
+	Total     int     `json:"total"`
+	Unit      string  `json:"unit"`
+	TotalCost float64 `json:"totalCost"`
+}
+
+// Send posts events as one ingestion batch
+func (s *LangfuseSink) Send(ctx context.Context, events []TelemetryEvent) error {
+	batch := make([]langfuseEvent, 0, 2*len(events))
+	for _, e := range events {
+		if e.Heartbeat {
+			continue
+		}
+		start, end := eventTimes(e)
+		at := end.Format(time.RFC3339Nano)
+		trace := traceKey(e)
+		batch = append(batch, langfuseEvent{
+			ID:        exportID("langfuse-trace", e),
+			Timestamp: at,
+			Type:      "trace-create",
+			Body: langfuseTrace{
+				ID:        trace,
+				Name:      e.Endpoint,
+				Timestamp: start.Format(time.RFC3339Nano),
+				UserID:    e.User,
+				SessionID: e.SessionID,
+				Tags:      exportTags(e),
+			},
+		})
+		gen := langfuseGeneration{
+			ID:        e.RequestID,
+			TraceID:   trace,
+			Name:      e.Endpoint,
+			StartTime: start.Format(time.RFC3339Nano),
+			EndTime:   at,
+			Model:     e.Model,
+			Input:     e.Prompt,
+			Output:    e.Completion,
+			Usage: langfuseUsage{
+				Input:     e.TokenUsage.PromptTokens,
+				Output:    e.TokenUsage.CompletionTokens,
+				Total:     e.TokenUsage.TotalTokens,
+				Unit:      "TOKENS",
+				TotalCost: e.CostEstimateUSD,
+			},
+			Level:    "DEFAULT",
+			Metadata: exportMetadata(e),
+		}
+		if e.Status == "error" {
+			gen.Level, gen.StatusMessage = "ERROR", e.ErrorMessage
+		}
+		batch = append(batch, langfuseEvent{ID: exportID("langfuse-generation", e), Timestamp: at, Type: "generation-create", Body: gen})
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	host := s.Host
+	if host == "" {
+		host = DefaultLangfuseHost
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(s.PublicKey+":"+s.SecretKey)))
+	resp, err := postJSON(ctx, s.HTTPClient, strings.TrimRight(host, "/")+"/api/public/ingestion", map[string]any{"batch": batch}, header)
+	if err != nil {
+		return fmt.Errorf("langmesh: langfuse ingestion: %w", err)
+	}
+	defer resp.Body.Close()
+	// Langfuse answers 207 with the events it rejected
+	var result struct {
+		Errors []struct {
+			ID      string `json:"id"`
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&result) == nil && len(result.Errors) > 0 {
+		first := result.Errors[0]
+		return fmt.Errorf("langmesh: langfuse rejected %d of %d events, e.g. %s: %d %s", len(result.Errors), len(batch), first.ID, first.Status, first.Message)
+	}
+	return nil
+}
+
+// LangSmithSink sends telemetry to LangSmith, each call as an LLM run in
+// Project. Prompts and completions are included when WithContentCapture
+// captures them.
+type LangSmithSink struct {
+	// APIURL defaults to DefaultLangSmithURL
+	APIURL string
+	APIKey string
+	// Project is the LangSmith project runs are logged to; empty uses
+	// LangSmith's default project
+	Project    string
+	HTTPClient *http.Client
+}
+
+// NewLangSmithSink creates a sink logging runs to project
+func NewLangSmithSink(apiKey, project string) *LangSmithSink {
+	return &LangSmithSink{
+		APIURL:     DefaultLangSmithURL,
+		APIKey:     apiKey,
+		Project:    project,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type langSmithRun struct {
+	ID          string         `json:"id"`
+	TraceID     string         `json:"trace_id"`
+	DottedOrder string         `json:"dotted_order"`
+	Name        string         `json:"name"`
+	RunType     string         `json:"run_type"`
+	StartTime   string         `json:"start_time"`
+	EndTime     string         `json:"end_time"`
+	Inputs      map[string]any `json:"inputs"`
+	Outputs     map[string]any `json:"outputs"`
+	Error       string         `json:"error,omitempty"`
+	Extra       map[string]any `json:"extra"`
+	Tags        []string       `json:"tags,omitempty"`
+	SessionName string         `json:"session_name,omitempty"`
+}
+
+// Send posts events as one batch of runs
+func (s *LangSmithSink) Send(ctx context.Context, events []TelemetryEvent) error {
+	runs := make([]langSmithRun, 0, len(events))
+	for _, e := range events {
+		if e.Heartbeat {
+			continue
+		}
+		start, end := eventTimes(e)
+		id := exportID("langsmith-run", e)
+		metadata := exportMetadata(e)
+		metadata["ls_model_name"] = e.Model
+		metadata["ls_provider"] = e.Provider
+		if e.User != "" {
+			metadata["user"] = e.User
+		}
+		if e.SessionID != "" {
+			metadata["session_id"] = e.SessionID
+		}
+		if trace := traceKey(e); trace != e.RequestID {
+			metadata["thread_id"] = trace
+		}
+		run := langSmithRun{
+			ID:      id,
+			TraceID: id,
+			// A root run's dotted order is its start time and ID
+			DottedOrder: strings.Replace(start.Format("20060102T150405.000000Z"), ".", "", 1) + id,
+			Name:        e.Endpoint,
+			RunType:     "llm",
+			StartTime:   start.Format(time.RFC3339Nano),
+			EndTime:     end.Format(time.RFC3339Nano),
+			Inputs:      map[string]any{},
+			Outputs: map[string]any{"usage_metadata": map[string]int{
+				"input_tokens":  e.TokenUsage.PromptTokens,
+				"output_tokens": e.TokenUsage.CompletionTokens,
+				"total_tokens":  e.TokenUsage.TotalTokens,
+			}},
+			Extra:       map[string]any{"metadata": metadata},
+			Tags:        exportTags(e),
+			SessionName: s.Project,
+		}
+		if strings.HasPrefix(e.Endpoint, "embeddings") {
+			run.RunType = "embedding"
+		}
+		if e.Prompt != "" {
+			run.Inputs["prompt"] = e.Prompt
+		}
+		if e.Completion != "" {
+			run.Outputs["completion"] = e.Completion
+		}
+		if e.Status == "error" {
+			run.Error = e.ErrorMessage
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = DefaultLangSmithURL
+	}
+	header := http.Header{}
+	header.Set("X-Api-Key", s.APIKey)
+	resp, err := postJSON(ctx, s.HTTPClient, strings.TrimRight(apiURL, "/")+"/runs/batch", map[string]any{"post": runs}, header)
+	if err != nil {
+		return fmt.Errorf("langmesh: langsmith runs: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
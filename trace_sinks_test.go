@@ -0,0 +1,147 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var traceEvents = []TelemetryEvent{
+	{
+		RequestID:       "req_1",
+		TimestampStart:  "2024-05-01T12:00:00Z",
+		TimestampEnd:    "2024-05-01T12:00:01Z",
+		Model:           "gpt-4o",
+		Endpoint:        "chat.completions",
+		LatencyMs:       1250,
+		TokenUsage:      TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		CostEstimateUSD: 0.0001,
+		Status:          "success",
+		Prompt:          "user: hi\n",
+		Completion:      "Hello",
+		User:            "u1",
+		Tags:            map[string]string{"tenant": "acme"},
+		TraceID:         "4bf92f3577b34da6a3ce929d0e0e4736",
+		Provider:        "openai",
+	},
+	{
+		RequestID:      "req_2",
+		TimestampStart: "2024-05-01T12:00:02Z",
+		Model:          "gpt-4o",
+		Endpoint:       "chat.completions",
+		Status:         "error",
+		ErrorMessage:   "rate limited",
+	},
+	{RequestID: "req_3", Heartbeat: true},
+}
+
+// captureServer answers with status and body, keeping the last request
+func captureServer(t *testing.T, status int, body string) (*httptest.Server, *http.Request, *map[string]json.RawMessage) {
+	t.Helper()
+	var got http.Request
+	payload := map[string]json.RawMessage{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = *r
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got, &payload
+}
+
+func TestLangfuseSink(t *testing.T) {
+	srv, req, payload := captureServer(t, http.StatusMultiStatus, `{"successes":[],"errors":[]}`)
+	sink := NewLangfuseSink("pk-lf", "sk-lf")
+	sink.Host = srv.URL
+	if err := sink.Send(context.Background(), traceEvents); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/api/public/ingestion" {
+		t.Errorf("path = %s", req.URL.Path)
+	}
+	if user, pass, _ := req.BasicAuth(); user != "pk-lf" || pass != "sk-lf" {
+		t.Errorf("auth = %q:%q", user, pass)
+	}
+	var batch []struct {
+		ID   string          `json:"id"`
+		Type string          `json:"type"`
+		Body json.RawMessage `json:"body"`
+	}
+	json.Unmarshal((*payload)["batch"], &batch)
+	if len(batch) != 4 || batch[0].Type != "trace-create" || batch[1].Type != "generation-create" {
+		t.Fatalf("batch = %+v", batch)
+	}
+	var trace langfuseTrace
+	json.Unmarshal(batch[0].Body, &trace)
+	if trace.ID != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.UserID != "u1" || trace.Tags[0] != "tenant:acme" {
+		t.Errorf("trace = %+v", trace)
+	}
+	var gen langfuseGeneration
+	json.Unmarshal(batch[1].Body, &gen)
+	if gen.TraceID != trace.ID || gen.Input != "user: hi\n" || gen.Output != "Hello" || gen.Usage.Total != 15 ||
+		gen.StartTime != "2024-05-01T12:00:00Z" || gen.EndTime != "2024-05-01T12:00:01.25Z" {
+		t.Errorf("generation = %+v", gen)
+	}
+	json.Unmarshal(batch[3].Body, &gen)
+	if gen.TraceID != "req_2" || gen.Level != "ERROR" || gen.StatusMessage != "rate limited" {
+		t.Errorf("failed generation = %+v", gen)
+	}
+
+	// Retried batches keep their IDs, so Langfuse drops the duplicates
+	first := batch[1].ID
+	sink.Send(context.Background(), traceEvents)
+	json.Unmarshal((*payload)["batch"], &batch)
+	if batch[1].ID != first {
+		t.Errorf("event ID changed on resend: %s, then %s", first, batch[1].ID)
+	}
+}
+
+func TestLangfuseSinkRejectedEvents(t *testing.T) {
+	srv, _, _ := captureServer(t, http.StatusMultiStatus, `{"errors":[{"id":"x","status":400,"message":"invalid model"}]}`)
+	sink := &LangfuseSink{Host: srv.URL}
+	err := sink.Send(context.Background(), traceEvents[:1])
+	if err == nil || !strings.Contains(err.Error(), "invalid model") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLangSmithSink(t *testing.T) {
+	srv, req, payload := captureServer(t, http.StatusOK, `{}`)
+	sink := NewLangSmithSink("ls-key", "support-bot")
+	sink.APIURL = srv.URL
+	if err := sink.Send(context.Background(), traceEvents); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/runs/batch" || req.Header.Get("X-Api-Key") != "ls-key" {
+		t.Errorf("request = %s %v", req.URL.Path, req.Header)
+	}
+	var runs []langSmithRun
+	json.Unmarshal((*payload)["post"], &runs)
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v", runs)
+	}
+	run := runs[0]
+	if run.TraceID != run.ID || run.DottedOrder != "20240501T120000000000Z"+run.ID || run.RunType != "llm" || run.SessionName != "support-bot" {
+		t.Errorf("run = %+v", run)
+	}
+	if run.Inputs["prompt"] != "user: hi\n" || run.Outputs["completion"] != "Hello" {
+		t.Errorf("content = %v %v", run.Inputs, run.Outputs)
+	}
+	metadata := run.Extra["metadata"].(map[string]any)
+	if metadata["ls_model_name"] != "gpt-4o" || metadata["thread_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("metadata = %v", metadata)
+	}
+	if runs[1].Error != "rate limited" {
+		t.Errorf("failed run = %+v", runs[1])
+	}
+
+	failing, _, _ := captureServer(t, http.StatusUnauthorized, `{"detail":"bad key"}`)
+	sink.APIURL = failing.URL
+	if err := sink.Send(context.Background(), traceEvents); err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("err = %v", err)
+	}
+}
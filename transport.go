@@ -0,0 +1,122 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportConfig tunes the HTTP connections the client opens, upstream
+// and to the langmesh proxy. Zero fields keep http.DefaultTransport's
+// settings.
+type TransportConfig struct {
+	// MaxIdleConns caps idle connections across all hosts
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps idle connections kept per host; raise it
+	// for high-throughput services, since the default of 2 makes most
+	// concurrent requests dial a new connection
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections per host, including those in use
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout bounds each TLS handshake
+	TLSHandshakeTimeout time.Duration
+	// TLSConfig replaces the TLS settings, e.g. for a private CA or client
+	// certificates
+	TLSConfig *tls.Config
+	// ForceHTTP2 makes HTTPS connections use HTTP/2 only, failing against
+	// servers that do not offer it instead of falling back to HTTP/1.1.
+	// Connections through a Proxy prefer HTTP/2 but do not require it.
+	ForceHTTP2 bool
+	// Proxy is the HTTP proxy to connect through; nil uses the
+	// HTTP_PROXY/HTTPS_PROXY environment
+	Proxy *url.URL
+	// DialContext replaces how TCP connections are made
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithTransport sends requests over a transport tuned by cfg. Policy views
+// share its connection pool.
+func WithTransport(cfg TransportConfig) Option {
+	return func(c *Client) {
+		c.baseTransport = cfg.transport()
+	}
+}
+
+// transport builds an http.Transport from http.DefaultTransport and cfg
+func (cfg TransportConfig) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.TLSConfig != nil {
+		t.TLSClientConfig = cfg.TLSConfig.Clone()
+	}
+	if cfg.Proxy != nil {
+		t.Proxy = http.ProxyURL(cfg.Proxy)
+	}
+	if cfg.DialContext != nil {
+		t.DialContext = cfg.DialContext
+	}
+	if cfg.ForceHTTP2 {
+		t.DialTLSContext = dialHTTP2(t.DialContext, t.TLSClientConfig, t.TLSHandshakeTimeout)
+	}
+	// A custom TLS config or dialer otherwise turns HTTP/2 off
+	t.ForceAttemptHTTP2 = true
+	return t
+}
+
+// dialHTTP2 returns a TLS dialer that fails unless the server agrees to
+// HTTP/2
+func dialHTTP2(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	config *tls.Config,
+	timeout time.Duration,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &tls.Config{}
+		if config != nil {
+			cfg = config.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		cfg.NextProtos = []string{"h2"}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if tc.ConnectionState().NegotiatedProtocol != "h2" {
+			tc.Close()
+			return nil, fmt.Errorf("langmesh: %s does not support HTTP/2", addr)
+		}
+		return tc, nil
+	}
+}
@@ -0,0 +1,85 @@
+package langmesh
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+const chatResponseBody = `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+
+func TestTransportDialerAndPooling(t *testing.T) {
+	srv, _ := newChatServer(t, "hi")
+	var dials int32
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(&eventRecorder{}),
+		WithTransport(TransportConfig{
+			MaxIdleConnsPerHost: 16,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}))
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("dials = %d, want connections reused", n)
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "api.example.test" {
+			atomic.AddInt32(&proxied, 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(chatResponseBody))
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := NewClient("test-key", WithBaseURL("http://api.example.test/v1"), withRecorder(&eventRecorder{}),
+		WithTransport(TransportConfig{Proxy: proxyURL}))
+	if _, err := client.CreateChatCompletion(context.Background(), chatRequest("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Error("request did not go through the proxy")
+	}
+}
+
+func TestTransportForceHTTP2(t *testing.T) {
+	for _, h2 := range []bool{true, false} {
+		var proto int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.StoreInt32(&proto, int32(r.ProtoMajor))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(chatResponseBody))
+		}))
+		srv.EnableHTTP2 = h2
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+
+		tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		tlsConfig.RootCAs = roots
+		client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(&eventRecorder{}),
+			WithTransport(TransportConfig{TLSConfig: tlsConfig, ForceHTTP2: true}))
+		_, err := client.CreateChatCompletion(context.Background(), chatRequest("hi"))
+		if h2 && (err != nil || atomic.LoadInt32(&proto) != 2) {
+			t.Errorf("HTTP/2 server: HTTP/%d, %v", atomic.LoadInt32(&proto), err)
+		}
+		if !h2 && err == nil {
+			t.Error("HTTP/1.1-only server: expected an error")
+		}
+	}
+}
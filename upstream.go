@@ -0,0 +1,236 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTierScanBytes bounds how much of a JSON response is inspected for
+// service_tier
+const maxTierScanBytes = 1 << 20
+
+// callState carries per-call data between the wrapper methods and the HTTP
+// transport through the request context
+type callState struct {
+	// requestID is sent upstream with each of the call's requests
+	requestID string
+
+	mu          sync.Mutex
+	header      http.Header
+	statusCode  int
+	serviceTier string
+	// apiKeyID is the hashed KeyPool key last used
+	apiKeyID string
+	// attempts counts the call's upstream requests
+	attempts int
+	// coalescedInto is the request ID of the call whose response this one
+	// shared; coalesced counts the calls that shared this one's response
+	coalescedInto string
+	coalesced     int
+	// queueWait is how long adaptive throttling held the call's requests
+	queueWait time.Duration
+	// policyRewrites lists what the RequestPolicy changed in the request
+	policyRewrites []string
+	// hedge describes the call's hedge, once one was sent
+	hedge *HedgeInfo
+	// systemPromptVersion is the version of the provider's system prompt
+	systemPromptVersion string
+	// idempotencyKey is the journaled call's key, sent upstream
+	idempotencyKey string
+}
+
+type callStateKey struct{}
+
+// withCallState attaches a fresh callState for the call requestID to ctx
+func withCallState(ctx context.Context, requestID string) (context.Context, *callState) {
+	state := &callState{requestID: requestID}
+	return context.WithValue(ctx, callStateKey{}, state), state
+}
+
+// backgroundContext returns a context for background work a call starts,
+// such as shadow requests. It keeps ctx's attribution, but not its
+// cancellation, CallInfo or the lifetime of its request scope.
+func backgroundContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(context.WithoutCancel(ctx), callInfoKey{}, (*CallInfo)(nil))
+	return deriveCarrier(ctx, func(c *scopeCarrier) { c.ended = new(atomic.Bool) })
+}
+
+func callStateFrom(ctx context.Context) *callState {
+	state, _ := ctx.Value(callStateKey{}).(*callState)
+	return state
+}
+
+// id returns the call's request ID, or "" outside a call
+func (s *callState) id() string {
+	if s == nil {
+		return ""
+	}
+	return s.requestID
+}
+
+func (s *callState) setAPIKey(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKeyID = id
+}
+
+func (s *callState) addQueueWait(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueWait += d
+}
+
+func (s *callState) responseHeader() http.Header {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.header
+}
+
+// captureTransport records upstream response metadata into the callState
+// found on the request context
+type captureTransport struct {
+	base http.RoundTripper
+}
+
+func (t captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state := callStateFrom(req.Context())
+	if state != nil && state.requestID != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(clientRequestIDHeader, state.requestID)
+	}
+	if tp := upstreamTraceparent(req.Context()); tp != "" && req.Header.Get(traceparentHeader) == "" {
+		if state == nil || state.requestID == "" {
+			req = req.Clone(req.Context())
+		}
+		req.Header.Set(traceparentHeader, tp)
+	}
+	if state != nil {
+		state.mu.Lock()
+		state.attempts++
+		key := state.idempotencyKey
+		state.mu.Unlock()
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || state == nil {
+		return resp, err
+	}
+	callInfoFrom(req.Context()).record(state.requestID, resp.Header)
+
+	tier := ""
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		resp.ContentLength >= 0 && resp.ContentLength <= maxTierScanBytes {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr == nil {
+			tier = scanServiceTier(body)
+		}
+	}
+
+	state.mu.Lock()
+	state.header = resp.Header
+	state.statusCode = resp.StatusCode
+	state.serviceTier = tier
+	state.mu.Unlock()
+	return resp, nil
+}
+
+// scanServiceTier pulls "service_tier" out of a JSON body without a second
+// full decode
+func scanServiceTier(body []byte) string {
+	key := []byte(`"service_tier"`)
+	i := bytes.Index(body, key)
+	if i < 0 {
+		return ""
+	}
+	rest := bytes.TrimLeft(body[i+len(key):], " \t\r\n")
+	if len(rest) == 0 || rest[0] != ':' {
+		return ""
+	}
+	rest = bytes.TrimLeft(rest[1:], " \t\r\n")
+	if len(rest) == 0 || rest[0] != '"' {
+		return ""
+	}
+	end := bytes.IndexByte(rest[1:], '"')
+	if end < 0 {
+		return ""
+	}
+	return string(rest[1 : end+1])
+}
+
+// annotateUpstream copies upstream processing, overhead, and region hints,
+// OpenAI's request ID and rate limits, the KeyPool key used, retries,
+// request coalescing, throttling waits, hedges and proxy cache hits onto
+// event
+func annotateUpstream(event *TelemetryEvent, state *callState) {
+	if state == nil {
+		return
+	}
+	state.mu.Lock()
+	h := state.header
+	tier := state.serviceTier
+	event.APIKeyID = state.apiKeyID
+	if state.attempts > 1 {
+		event.RetryCount = state.attempts - 1
+	}
+	event.CoalescedInto = state.coalescedInto
+	event.CoalescedCount = state.coalesced
+	event.QueueWaitMs = state.queueWait.Milliseconds()
+	event.PolicyRewrites = state.policyRewrites
+	event.Hedge = state.hedge
+	event.SystemPromptVersion = state.systemPromptVersion
+	state.mu.Unlock()
+	if h == nil {
+		return
+	}
+
+	event.ServiceTier = tier
+	processing := h.Get("Openai-Processing-Ms")
+	if processing == "" {
+		processing = h.Get("X-Envoy-Upstream-Service-Time")
+	}
+	if ms, err := strconv.ParseInt(processing, 10, 64); err == nil {
+		event.UpstreamProcessingMs = ms
+		// Whatever the server didn't spend processing was spent connecting,
+		// in transit, or waiting in a queue; the headers don't tell which
+		if overhead := event.LatencyMs - ms; overhead > 0 {
+			event.UpstreamOverheadMs = overhead
+		}
+	}
+	event.UpstreamRegion = upstreamRegion(h)
+	event.UpstreamRequestID = h.Get(upstreamRequestIDHeader)
+	event.RateLimit = parseRateLimit(h)
+	event.CacheHit = h.Get("X-Langmesh-Cache") == "hit"
+}
+
+func upstreamRegion(h http.Header) string {
+	if region := h.Get("X-Ms-Region"); region != "" {
+		return region
+	}
+	// Cloudflare ray IDs end in the serving colo, e.g. "8a1b2c3d4e5f6a7b-SJC"
+	if ray := h.Get("Cf-Ray"); ray != "" {
+		if i := strings.LastIndexByte(ray, '-'); i >= 0 && i < len(ray)-1 {
+			return ray[i+1:]
+		}
+	}
+	return ""
+}
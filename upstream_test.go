@@ -0,0 +1,36 @@
+package langmesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestUpstreamAnnotations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Openai-Processing-Ms", "5")
+		w.Header().Set("Cf-Ray", "8a1b2c3d4e5f6a7b-SJC")
+		_, _ = w.Write([]byte(`{"id":"x","choices":[],"service_tier":"default","usage":{}}`))
+	}))
+	defer srv.Close()
+
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL), withRecorder(rec))
+	if _, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+
+	event := rec.all()[0]
+	if event.UpstreamProcessingMs != 5 || event.UpstreamRegion != "SJC" || event.ServiceTier != "default" {
+		t.Errorf("unexpected annotations %+v", event)
+	}
+	if event.UpstreamOverheadMs < 20 {
+		t.Errorf("overhead = %dms, expected most of the 30ms delay", event.UpstreamOverheadMs)
+	}
+}
@@ -0,0 +1,403 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UsageFormat selects the file layout written by a UsageExporter
+type UsageFormat string
+
+const (
+	// UsageFormatCSV is a simple one-row-per-model-and-endpoint CSV
+	UsageFormatCSV UsageFormat = "csv"
+	// UsageFormatFOCUS follows the FinOps Open Cost and Usage Specification columns
+	UsageFormatFOCUS UsageFormat = "focus"
+)
+
+// UsageRecord is one hourly rollup for a model and endpoint
+type UsageRecord struct {
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Model       string
+	Endpoint    string
+	// Provider is the backend that served the model, as in TelemetryEvent.
+	// Only UsageFormatFOCUS files record it.
+	Provider         string
+	Requests         int
+	Errors           int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+}
+
+// UsageDestination stores a finished rollup file. Implement it with your
+// cloud SDK to ship rollups to S3 or GCS; DirectoryDestination covers the
+// local case.
+type UsageDestination interface {
+	WriteUsage(ctx context.Context, name string, data []byte) error
+}
+
+// UsageDestinationFunc adapts a function to UsageDestination
+type UsageDestinationFunc func(ctx context.Context, name string, data []byte) error
+
+// WriteUsage calls f
+func (f UsageDestinationFunc) WriteUsage(ctx context.Context, name string, data []byte) error {
+	return f(ctx, name, data)
+}
+
+// DirectoryDestination writes rollup files into a local directory
+type DirectoryDestination struct {
+	Dir string
+}
+
+// WriteUsage writes data to Dir/name, creating Dir if needed
+func (d DirectoryDestination) WriteUsage(_ context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(d.Dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.Dir, name))
+}
+
+type usageKey struct {
+	hour     int64
+	model    string
+	endpoint string
+	provider string
+}
+
+// usageGrace is how long a finished hour's totals are kept after the hour
+// ends, so late events (a long stream that started in the previous hour)
+// are merged into them and the hour's file is rewritten whole
+const usageGrace = 2 * time.Hour
+
+// UsageExporter aggregates telemetry events into hourly buckets and writes
+// each finished hour to a UsageDestination. An hour's file is rewritten when
+// late events arrive within usageGrace of the hour's end; events arriving
+// later still go to a separate langmesh-usage-<hour>-late-<time>.csv file
+// so the hour's totals are never overwritten.
+type UsageExporter struct {
+	dest     UsageDestination
+	format   UsageFormat
+	mu       sync.Mutex
+	buckets  map[usageKey]*UsageRecord
+	dirty    map[int64]bool
+	failed   map[int64]bool
+	pruned   int64
+	lateSeq  int
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	now      func() time.Time
+}
+
+// NewUsageExporter creates an exporter writing to dest in the given format.
+// It checks for finished hours every minute until Close is called.
+func NewUsageExporter(dest UsageDestination, format UsageFormat) *UsageExporter {
+	if format == "" {
+		format = UsageFormatCSV
+	}
+	e := &UsageExporter{
+		dest:    dest,
+		format:  format,
+		buckets: make(map[usageKey]*UsageRecord),
+		dirty:   make(map[int64]bool),
+		failed:  make(map[int64]bool),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		now:     time.Now,
+	}
+	go e.run()
+	return e
+}
+
+// WithUsageExporter feeds every request's telemetry into e
+func WithUsageExporter(e *UsageExporter) Option {
+	return func(c *Client) {
+		c.observers = append(c.observers, e)
+	}
+}
+
+func (e *UsageExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = e.export(context.Background(), false)
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *UsageExporter) observe(event TelemetryEvent) {
+	if event.Heartbeat {
+		return
+	}
+	start, err := time.Parse(time.RFC3339, event.TimestampStart)
+	if err != nil {
+		start = e.now()
+	}
+	hour := start.UTC().Truncate(time.Hour)
+	key := usageKey{hour: hour.Unix(), model: event.Model, endpoint: event.Endpoint, provider: event.Provider}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec, ok := e.buckets[key]
+	if !ok {
+		rec = &UsageRecord{
+			PeriodStart: hour,
+			PeriodEnd:   hour.Add(time.Hour),
+			Model:       event.Model,
+			Endpoint:    event.Endpoint,
+			Provider:    event.Provider,
+		}
+		e.buckets[key] = rec
+	}
+	e.dirty[key.hour] = true
+	rec.Requests++
+	if event.Status == "error" {
+		rec.Errors++
+	}
+	rec.PromptTokens += event.TokenUsage.PromptTokens
+	rec.CompletionTokens += event.TokenUsage.CompletionTokens
+	rec.TotalTokens += event.TokenUsage.TotalTokens
+	rec.CostUSD = addUSD(rec.CostUSD, event.CostEstimateUSD)
+}
+
+// Flush writes every hour that changed since it was last written,
+// including the current partial hour. Partial hours are rewritten in place
+// when they are exported again.
+func (e *UsageExporter) Flush(ctx context.Context) error {
+	return e.export(ctx, true)
+}
+
+// Close stops the background loop and flushes remaining buckets. Calling
+// it again only flushes.
+func (e *UsageExporter) Close() error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+	return e.Flush(context.Background())
+}
+
+func (e *UsageExporter) export(ctx context.Context, includeOpen bool) error {
+	current := e.now().UTC().Truncate(time.Hour).Unix()
+
+	e.mu.Lock()
+	byHour := make(map[int64][]UsageRecord)
+	late := make(map[int64]bool)
+	for hour := range e.dirty {
+		if hour >= current && !includeOpen {
+			continue
+		}
+		delete(e.dirty, hour)
+		late[hour] = hour < e.pruned && !e.failed[hour]
+	}
+	for key, rec := range e.buckets {
+		if _, ok := late[key.hour]; !ok {
+			continue
+		}
+		byHour[key.hour] = append(byHour[key.hour], *rec)
+		// The hour's file was already written and its totals dropped, so
+		// late records go to their own file and must not be counted twice.
+		if late[key.hour] {
+			delete(e.buckets, key)
+		}
+	}
+	e.mu.Unlock()
+
+	var firstErr error
+	for hour, records := range byHour {
+		sort.Slice(records, func(i, j int) bool {
+			if records[i].Model != records[j].Model {
+				return records[i].Model < records[j].Model
+			}
+			if records[i].Endpoint != records[j].Endpoint {
+				return records[i].Endpoint < records[j].Endpoint
+			}
+			return records[i].Provider < records[j].Provider
+		})
+		data, err := encodeUsage(e.format, records)
+		if err == nil {
+			err = e.dest.WriteUsage(ctx, e.fileName(hour, late[hour]), data)
+		}
+		if err != nil {
+			e.retry(hour, late[hour], records)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		e.mu.Lock()
+		delete(e.failed, hour)
+		e.mu.Unlock()
+	}
+
+	e.prune(current - int64(usageGrace/time.Second))
+	return firstErr
+}
+
+func (e *UsageExporter) fileName(hour int64, late bool) string {
+	name := "langmesh-usage-" + time.Unix(hour, 0).UTC().Format("20060102T15")
+	if late {
+		e.mu.Lock()
+		e.lateSeq++
+		name += fmt.Sprintf("-late-%s-%d", e.now().UTC().Format("20060102T150405"), e.lateSeq)
+		e.mu.Unlock()
+	}
+	return name + ".csv"
+}
+
+// retry marks a failed hour for the next pass. Late records were taken out
+// of the buckets and are put back; an hour whose own file was never written
+// keeps that name however late the retry is.
+func (e *UsageExporter) retry(hour int64, late bool, records []UsageRecord) {
+	if late {
+		e.restore(records)
+	}
+	e.mu.Lock()
+	e.dirty[hour] = true
+	if !late {
+		e.failed[hour] = true
+	}
+	e.mu.Unlock()
+}
+
+// prune drops the totals of hours that ended before cutoff and have been
+// written
+func (e *UsageExporter) prune(cutoff int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.buckets {
+		if key.hour < cutoff && !e.dirty[key.hour] {
+			delete(e.buckets, key)
+		}
+	}
+	if cutoff > e.pruned {
+		e.pruned = cutoff
+	}
+}
+
+func (e *UsageExporter) restore(records []UsageRecord) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rec := range records {
+		key := usageKey{hour: rec.PeriodStart.Unix(), model: rec.Model, endpoint: rec.Endpoint, provider: rec.Provider}
+		if existing, ok := e.buckets[key]; ok {
+			existing.Requests += rec.Requests
+			existing.Errors += rec.Errors
+			existing.PromptTokens += rec.PromptTokens
+			existing.CompletionTokens += rec.CompletionTokens
+			existing.TotalTokens += rec.TotalTokens
+			existing.CostUSD = addUSD(existing.CostUSD, rec.CostUSD)
+			continue
+		}
+		r := rec
+		e.buckets[key] = &r
+	}
+}
+
+func encodeUsage(format UsageFormat, records []UsageRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	switch format {
+	case UsageFormatFOCUS:
+		_ = w.Write([]string{
+			"ChargePeriodStart", "ChargePeriodEnd", "ChargeCategory", "ProviderName",
+			"ServiceName", "ResourceId", "SkuId", "ConsumedQuantity", "ConsumedUnit",
+			"BilledCost", "EffectiveCost", "BillingCurrency",
+		})
+		for _, r := range records {
+			cost := strconv.FormatFloat(r.CostUSD, 'f', 8, 64)
+			_ = w.Write([]string{
+				r.PeriodStart.Format(time.RFC3339), r.PeriodEnd.Format(time.RFC3339), "Usage", focusProviderName(r.Provider),
+				r.Endpoint, r.Model, r.Model, strconv.Itoa(r.TotalTokens), "Tokens",
+				cost, cost, "USD",
+			})
+		}
+	case UsageFormatCSV:
+		_ = w.Write([]string{
+			"period_start", "period_end", "model", "endpoint", "requests", "errors",
+			"prompt_tokens", "completion_tokens", "total_tokens", "cost_usd",
+		})
+		for _, r := range records {
+			_ = w.Write([]string{
+				r.PeriodStart.Format(time.RFC3339), r.PeriodEnd.Format(time.RFC3339), r.Model, r.Endpoint,
+				strconv.Itoa(r.Requests), strconv.Itoa(r.Errors), strconv.Itoa(r.PromptTokens),
+				strconv.Itoa(r.CompletionTokens), strconv.Itoa(r.TotalTokens),
+				strconv.FormatFloat(r.CostUSD, 'f', 8, 64),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("langmesh: unknown usage format %q", format)
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// focusProviderName is the FOCUS ProviderName of a TelemetryEvent provider
+func focusProviderName(provider string) string {
+	switch provider {
+	case "", providerOpenAI:
+		return "OpenAI"
+	case providerAnthropic:
+		return "Anthropic"
+	case providerLocal:
+		return "Local"
+	}
+	return provider
+}
+
+// ReadUsage parses a rollup file in UsageFormatCSV, as a UsageExporter
+// writes it
+func ReadUsage(r io.Reader) ([]UsageRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: reading usage: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if len(rows[0]) != 10 || rows[0][0] != "period_start" {
+		return nil, fmt.Errorf("langmesh: reading usage: not a %s rollup", UsageFormatCSV)
+	}
+	records := make([]UsageRecord, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		var rec UsageRecord
+		var errs [8]error
+		rec.PeriodStart, errs[0] = time.Parse(time.RFC3339, row[0])
+		rec.PeriodEnd, errs[1] = time.Parse(time.RFC3339, row[1])
+		rec.Model, rec.Endpoint = row[2], row[3]
+		rec.Requests, errs[2] = strconv.Atoi(row[4])
+		rec.Errors, errs[3] = strconv.Atoi(row[5])
+		rec.PromptTokens, errs[4] = strconv.Atoi(row[6])
+		rec.CompletionTokens, errs[5] = strconv.Atoi(row[7])
+		rec.TotalTokens, errs[6] = strconv.Atoi(row[8])
+		rec.CostUSD, errs[7] = strconv.ParseFloat(row[9], 64)
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("langmesh: reading usage: row %d: %w", i+2, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
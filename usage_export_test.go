@@ -0,0 +1,200 @@
+package langmesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageExporterHourlyRollup(t *testing.T) {
+	dir := t.TempDir()
+	e := NewUsageExporter(DirectoryDestination{Dir: dir}, UsageFormatCSV)
+	defer e.Close()
+
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return hour.Add(2 * time.Hour) }
+	for i := 0; i < 3; i++ {
+		e.observe(TelemetryEvent{
+			TimestampStart:  hour.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+			Model:           "gpt-4o",
+			Endpoint:        "chat.completions",
+			Status:          "success",
+			TokenUsage:      TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			CostEstimateUSD: 0.001,
+		})
+	}
+	e.observe(TelemetryEvent{
+		TimestampStart: hour.Format(time.RFC3339),
+		Model:          "gpt-4o",
+		Endpoint:       "chat.completions",
+		Status:         "error",
+	})
+
+	if err := e.export(context.Background(), false); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "langmesh-usage-20240501T10.csv"))
+	if err != nil {
+		t.Fatalf("read rollup: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got %d lines", len(lines))
+	}
+	want := "2024-05-01T10:00:00Z,2024-05-01T11:00:00Z,gpt-4o,chat.completions,4,1,30,15,45,0.00300000"
+	if lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[1], want)
+	}
+}
+
+func TestUsageExporterFOCUSFormat(t *testing.T) {
+	data, err := encodeUsage(UsageFormatFOCUS, []UsageRecord{{
+		PeriodStart: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		Model:       "gpt-4o-mini",
+		Endpoint:    "chat.completions",
+		TotalTokens: 100,
+		CostUSD:     0.5,
+	}})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "ChargePeriodStart,") {
+		t.Errorf("missing FOCUS header: %q", data)
+	}
+	if !strings.Contains(string(data), ",Usage,OpenAI,chat.completions,gpt-4o-mini,") {
+		t.Errorf("unexpected FOCUS row: %q", data)
+	}
+
+	data, _ = encodeUsage(UsageFormatFOCUS, []UsageRecord{{Model: "claude-sonnet-4", Endpoint: "chat.completions", Provider: providerAnthropic}})
+	if !strings.Contains(string(data), ",Usage,Anthropic,chat.completions,claude-sonnet-4,") {
+		t.Errorf("unexpected Anthropic FOCUS row: %q", data)
+	}
+}
+
+func TestUsageExporterFailedFlushKeepsOpenHour(t *testing.T) {
+	var fail bool
+	var written []byte
+	e := NewUsageExporter(UsageDestinationFunc(func(_ context.Context, _ string, data []byte) error {
+		if fail {
+			return errors.New("bucket unavailable")
+		}
+		written = data
+		return nil
+	}), UsageFormatCSV)
+
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return hour.Add(30 * time.Minute) }
+	e.observe(TelemetryEvent{
+		TimestampStart: hour.Format(time.RFC3339),
+		Model:          "gpt-4o",
+		Endpoint:       "chat.completions",
+		Status:         "success",
+		TokenUsage:     TokenUsage{TotalTokens: 15},
+	})
+
+	fail = true
+	if err := e.Flush(context.Background()); err == nil {
+		t.Fatal("expected the write error")
+	}
+	fail = false
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadUsage(bytes.NewReader(written))
+	if err != nil || len(records) != 1 || records[0].Requests != 1 || records[0].TotalTokens != 15 {
+		t.Errorf("records = %+v, %v; want the hour counted once", records, err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestUsageExporterLateEvents(t *testing.T) {
+	dir := t.TempDir()
+	e := NewUsageExporter(DirectoryDestination{Dir: dir}, UsageFormatCSV)
+	defer e.Close()
+
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := hour.Add(61 * time.Minute)
+	e.now = func() time.Time { return now }
+	event := TelemetryEvent{
+		TimestampStart: hour.Add(59 * time.Minute).Format(time.RFC3339),
+		Model:          "gpt-4o",
+		Endpoint:       "chat.completions",
+		Status:         "success",
+		TokenUsage:     TokenUsage{TotalTokens: 10},
+	}
+	read := func(name string) []UsageRecord {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := ReadUsage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	e.observe(event)
+	e.observe(event)
+	if err := e.export(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	// A stream that started in the finished hour ends within the grace period
+	e.observe(event)
+	if err := e.export(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if records := read("langmesh-usage-20240501T10.csv"); len(records) != 1 || records[0].Requests != 3 || records[0].TotalTokens != 30 {
+		t.Errorf("hour rewritten as %+v, want the late event merged", records)
+	}
+
+	now = hour.Add(4 * time.Hour)
+	if err := e.export(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	e.observe(event)
+	if err := e.export(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if records := read("langmesh-usage-20240501T10.csv"); len(records) != 1 || records[0].Requests != 3 {
+		t.Errorf("hour overwritten after the grace period: %+v", records)
+	}
+	late, _ := filepath.Glob(filepath.Join(dir, "langmesh-usage-20240501T10-late-*.csv"))
+	if len(late) != 1 {
+		t.Fatalf("late files = %v, want one", late)
+	}
+	if records := read(filepath.Base(late[0])); len(records) != 1 || records[0].Requests != 1 {
+		t.Errorf("late file = %+v, want the one late event", records)
+	}
+}
+
+func TestReadUsageRoundTrip(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	records := []UsageRecord{{
+		PeriodStart: hour, PeriodEnd: hour.Add(time.Hour), Model: "gpt-4o", Endpoint: "chat.completions",
+		Requests: 4, Errors: 1, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45, CostUSD: 0.003,
+	}}
+	data, err := encodeUsage(UsageFormatCSV, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadUsage(strings.NewReader(string(data)))
+	if err != nil || len(got) != 1 || got[0] != records[0] {
+		t.Errorf("ReadUsage = %+v, %v", got, err)
+	}
+
+	focus, _ := encodeUsage(UsageFormatFOCUS, records)
+	if _, err := ReadUsage(strings.NewReader(string(focus))); err == nil {
+		t.Error("expected an error for a FOCUS file")
+	}
+}
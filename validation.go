@@ -0,0 +1,103 @@
+package langmesh
+
+import (
+	"errors"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrInvalidRequest matches every ValidationError via errors.Is
+var ErrInvalidRequest = errors.New("langmesh: invalid request")
+
+// ValidationReason is a machine-readable code explaining why a request
+// failed validation
+type ValidationReason string
+
+const (
+	ValidationEmptyMessages       ValidationReason = "empty_messages"
+	ValidationToolsUnsupported    ValidationReason = "tools_unsupported"
+	ValidationVisionUnsupported   ValidationReason = "vision_unsupported"
+	ValidationJSONModeUnsupported ValidationReason = "json_mode_unsupported"
+	ValidationMaxTokensExceeded   ValidationReason = "max_tokens_exceeded"
+	ValidationContextExceeded     ValidationReason = "context_exceeded"
+)
+
+// ValidationError is returned, before anything is sent, for a request the
+// model would reject
+type ValidationError struct {
+	Reason ValidationReason
+	Model  string
+	// Detail describes the problem
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("langmesh: invalid request for %s (%s): %s", e.Model, e.Reason, e.Detail)
+}
+
+// Is reports whether target is ErrInvalidRequest
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// WithRequestValidation checks chat requests before they are sent and
+// fails those the model would reject with a ValidationError: no messages,
+// tools, images or JSON mode the model does not support, or max_tokens
+// beyond the model's output limit or what its context window leaves after
+// the prompt. Models without ModelInfo are only checked for messages.
+// Prompt tokens use the configured tokenizer, or the estimate.
+func WithRequestValidation() Option {
+	return func(c *Client) {
+		c.validateRequests = true
+	}
+}
+
+// validateRequest returns a ValidationError for a request the model
+// would reject
+func (c *Client) validateRequest(request openai.ChatCompletionRequest) error {
+	if !c.validateRequests {
+		return nil
+	}
+	invalid := func(reason ValidationReason, format string, args ...any) error {
+		return &ValidationError{Reason: reason, Model: request.Model, Detail: fmt.Sprintf(format, args...)}
+	}
+	if len(request.Messages) == 0 {
+		return invalid(ValidationEmptyMessages, "the request has no messages")
+	}
+	info, ok := c.ModelInfo(request.Model)
+	if !ok {
+		return nil
+	}
+	if !info.Tools && (len(request.Tools) > 0 || len(request.Functions) > 0) {
+		return invalid(ValidationToolsUnsupported, "the model does not support tools")
+	}
+	if !info.Vision && hasImages(request.Messages) {
+		return invalid(ValidationVisionUnsupported, "the model does not accept images")
+	}
+	if !info.JSONMode && request.ResponseFormat != nil && request.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeText {
+		return invalid(ValidationJSONModeUnsupported, "the model does not support response format %s", request.ResponseFormat.Type)
+	}
+	if info.MaxOutputTokens > 0 && request.MaxTokens > info.MaxOutputTokens {
+		return invalid(ValidationMaxTokensExceeded, "max_tokens %d exceeds the model's limit of %d", request.MaxTokens, info.MaxOutputTokens)
+	}
+	if info.ContextWindow > 0 {
+		prompt := c.countPromptTokens(request.Model, request.Messages)
+		if prompt+request.MaxTokens > info.ContextWindow {
+			return invalid(ValidationContextExceeded, "%d prompt tokens and max_tokens %d exceed the model's %d token context window",
+				prompt, request.MaxTokens, info.ContextWindow)
+		}
+	}
+	return nil
+}
+
+func hasImages(messages []openai.ChatCompletionMessage) bool {
+	for _, m := range messages {
+		for _, part := range m.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
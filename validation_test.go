@@ -0,0 +1,80 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRequestValidation(t *testing.T) {
+	srv, calls := newChatServer(t, "hi")
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(srv.URL+"/v1"), withRecorder(rec), WithRequestValidation())
+
+	image := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: "what is this?"},
+		{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/cat.png"}},
+	}}
+	tool := openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "lookup"}}
+	cases := []struct {
+		name   string
+		modify func(*openai.ChatCompletionRequest)
+		reason ValidationReason
+	}{
+		{"empty", func(r *openai.ChatCompletionRequest) { r.Messages = nil }, ValidationEmptyMessages},
+		{"image", func(r *openai.ChatCompletionRequest) {
+			r.Model, r.Messages = "gpt-4", []openai.ChatCompletionMessage{image}
+		}, ValidationVisionUnsupported},
+		{"json", func(r *openai.ChatCompletionRequest) {
+			r.Model = "gpt-4"
+			r.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		}, ValidationJSONModeUnsupported},
+		{"output", func(r *openai.ChatCompletionRequest) { r.MaxTokens = 20000 }, ValidationMaxTokensExceeded},
+		{"window", func(r *openai.ChatCompletionRequest) {
+			r.Model, r.MaxTokens = "gpt-4", 4000
+			r.Messages[0].Content = strings.Repeat("word ", 4000)
+		}, ValidationContextExceeded},
+		{"valid", func(r *openai.ChatCompletionRequest) {
+			r.Messages = []openai.ChatCompletionMessage{image}
+			r.Tools = []openai.Tool{tool}
+		}, ""},
+		{"unknown model", func(r *openai.ChatCompletionRequest) { r.Model, r.MaxTokens = "ft:custom", 1_000_000 }, ""},
+	}
+	for _, tc := range cases {
+		request := chatRequest("hi")
+		tc.modify(&request)
+		_, err := client.CreateChatCompletion(context.Background(), request)
+		var validationErr *ValidationError
+		switch {
+		case tc.reason == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.reason != "" && (!errors.As(err, &validationErr) || validationErr.Reason != tc.reason || !errors.Is(err, ErrInvalidRequest)):
+			t.Errorf("%s: err = %v, want %s", tc.name, err, tc.reason)
+		}
+	}
+	if n := *calls; n != 2 {
+		t.Errorf("sent %d requests, want only the 2 valid ones", n)
+	}
+	if class := rec.all()[0].ErrorClass; class != "InvalidRequest" {
+		t.Errorf("error class = %q", class)
+	}
+}
+
+func TestRequestValidationToolsUnsupported(t *testing.T) {
+	client := NewClient("test-key", WithRequestValidation(),
+		WithModelManifest(ModelManifest{URL: "http://127.0.0.1:1/manifest.json"}))
+	client.modelManifest.models = map[string]ModelInfo{"text-only": {ID: "text-only", ContextWindow: 4096}}
+	client.modelManifest.fetchedAt = time.Now()
+	request := chatRequest("hi")
+	request.Model = "text-only"
+	request.Tools = []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "lookup"}}}
+	err := client.validateRequest(request)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Reason != ValidationToolsUnsupported {
+		t.Errorf("err = %v", err)
+	}
+}
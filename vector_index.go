@@ -0,0 +1,230 @@
+package langmesh
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrDimensionMismatch is returned when a vector's length differs from the
+// vectors already in an index
+var ErrDimensionMismatch = errors.New("langmesh: vector dimension mismatch")
+
+// VectorEntry is one item in a vector index
+type VectorEntry struct {
+	ID       string
+	Vector   []float32
+	Text     string
+	Metadata map[string]string
+}
+
+// SearchResult is an entry found by a search, scored by cosine similarity
+// to the query
+type SearchResult struct {
+	VectorEntry
+	Score float32
+}
+
+// VectorIndex stores embeddings for similarity search. Vectors are
+// normalized when added. Adding an entry with an ID already present
+// replaces it. Implementations are safe for concurrent use.
+type VectorIndex interface {
+	Add(entries ...VectorEntry) error
+	// Search returns the k entries most similar to query, best first
+	Search(query []float32, k int) []SearchResult
+	// Delete removes the entry with id, reporting whether it was present
+	Delete(id string) bool
+	Len() int
+	// Entries returns every entry, in the order they were added
+	Entries() []VectorEntry
+}
+
+// FlatIndex compares the query with every entry: exact, and fast enough
+// for up to tens of thousands of entries
+type FlatIndex struct {
+	mu      sync.RWMutex
+	entries []VectorEntry
+	ids     map[string]int
+	dim     int
+}
+
+// NewFlatIndex creates an empty flat index
+func NewFlatIndex() *FlatIndex {
+	return &FlatIndex{ids: make(map[string]int)}
+}
+
+// Add inserts or replaces entries
+func (x *FlatIndex) Add(entries ...VectorEntry) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, e := range entries {
+		if err := checkDimension(&x.dim, len(e.Vector), len(x.entries) == 0); err != nil {
+			return err
+		}
+		e.Vector = normalized(e.Vector)
+		if i, ok := x.ids[e.ID]; ok {
+			x.entries[i] = e
+			continue
+		}
+		x.ids[e.ID] = len(x.entries)
+		x.entries = append(x.entries, e)
+	}
+	return nil
+}
+
+// Search scores every entry against query
+func (x *FlatIndex) Search(query []float32, k int) []SearchResult {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if k <= 0 || len(query) != x.dim {
+		return nil
+	}
+	q := normalized(query)
+	results := make([]SearchResult, 0, len(x.entries))
+	for _, e := range x.entries {
+		results = append(results, SearchResult{VectorEntry: e, Score: dot(q, e.Vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results[:min(k, len(results))]
+}
+
+// Delete removes the entry with id
+func (x *FlatIndex) Delete(id string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	i, ok := x.ids[id]
+	if !ok {
+		return false
+	}
+	delete(x.ids, id)
+	x.entries = append(x.entries[:i], x.entries[i+1:]...)
+	for j := i; j < len(x.entries); j++ {
+		x.ids[x.entries[j].ID] = j
+	}
+	return true
+}
+
+// Len returns the number of entries
+func (x *FlatIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Entries returns every entry
+func (x *FlatIndex) Entries() []VectorEntry {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return append([]VectorEntry(nil), x.entries...)
+}
+
+// savedIndex is the on-disk form of an index. HNSW graphs are rebuilt on
+// load rather than stored.
+type savedIndex struct {
+	Kind    string
+	HNSW    HNSWConfig
+	Entries []VectorEntry
+}
+
+// SaveIndex writes index to path, replacing the file atomically
+func SaveIndex(path string, index VectorIndex) error {
+	saved := savedIndex{Kind: "flat", Entries: index.Entries()}
+	if h, ok := index.(*HNSWIndex); ok {
+		saved.Kind = "hnsw"
+		saved.HNSW = h.config
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("langmesh: save index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(saved); err != nil {
+		tmp.Close()
+		return fmt.Errorf("langmesh: save index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("langmesh: save index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("langmesh: save index: %w", err)
+	}
+	return nil
+}
+
+// LoadIndex reads an index written by SaveIndex
+func LoadIndex(path string) (VectorIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("langmesh: load index: %w", err)
+	}
+	defer f.Close()
+	var saved savedIndex
+	if err := gob.NewDecoder(f).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("langmesh: load index %s: %w", path, err)
+	}
+	var index VectorIndex
+	switch saved.Kind {
+	case "flat":
+		index = NewFlatIndex()
+	case "hnsw":
+		index = NewHNSWIndex(saved.HNSW)
+	default:
+		return nil, fmt.Errorf("langmesh: load index %s: unknown kind %q", path, saved.Kind)
+	}
+	if err := index.Add(saved.Entries...); err != nil {
+		return nil, fmt.Errorf("langmesh: load index %s: %w", path, err)
+	}
+	return index, nil
+}
+
+// checkDimension fixes an index's dimension on its first vector and checks
+// later ones against it
+func checkDimension(dim *int, n int, empty bool) error {
+	if n == 0 {
+		return fmt.Errorf("%w: empty vector", ErrDimensionMismatch)
+	}
+	if empty {
+		*dim = n
+	}
+	if n != *dim {
+		return fmt.Errorf("%w: got %d, index has %d", ErrDimensionMismatch, n, *dim)
+	}
+	return nil
+}
+
+func normalized(vec []float32) []float32 {
+	out := make([]float32, len(vec))
+	copy(out, vec)
+	normalize(out)
+	return out
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, over
+// their common length, or 0 if either is all zeros
+func CosineSimilarity(a, b []float32) float64 {
+	n := min(len(a), len(b))
+	a, b = a[:n], b[:n]
+	na, nb := float64(dot(a, a)), float64(dot(b, b))
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float64(dot(a, b)) / math.Sqrt(na*nb)
+}
+
+func dot(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return float32(sum)
+}
+
+// angularDistance orders normalized vectors by similarity, nearest first
+func angularDistance(a, b []float32) float64 {
+	return 1 - math.Min(float64(dot(a, b)), 1)
+}
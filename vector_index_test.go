@@ -0,0 +1,92 @@
+package langmesh
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlatIndex(t *testing.T) {
+	index := NewFlatIndex()
+	err := index.Add(
+		VectorEntry{ID: "x", Vector: []float32{1, 0, 0}, Text: "along x"},
+		VectorEntry{ID: "y", Vector: []float32{0, 2, 0}, Text: "along y"},
+		VectorEntry{ID: "xy", Vector: []float32{1, 1, 0}, Text: "between"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := index.Search([]float32{3, 0.5, 0}, 2)
+	if len(results) != 2 || results[0].ID != "x" || results[1].ID != "xy" {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].Score < 0.98 || results[0].Score > 1.0001 {
+		t.Errorf("score = %v, want cosine similarity", results[0].Score)
+	}
+
+	if err := index.Add(VectorEntry{ID: "x", Vector: []float32{0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := index.Search([]float32{0, 0, 1}, 1); got[0].ID != "x" || index.Len() != 3 {
+		t.Errorf("replaced entry not found: %+v, len %d", got, index.Len())
+	}
+	if !index.Delete("x") || index.Delete("x") || index.Len() != 2 {
+		t.Errorf("delete: len %d", index.Len())
+	}
+	if err := index.Add(VectorEntry{ID: "z", Vector: []float32{1, 2}}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 3}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{3, 4, 9}, []float32{3, 4}, 1},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	} {
+		if got := CosineSimilarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSaveLoadIndex(t *testing.T) {
+	for _, index := range []VectorIndex{NewFlatIndex(), NewHNSWIndex(HNSWConfig{M: 4})} {
+		entries := []VectorEntry{
+			{ID: "a", Vector: []float32{1, 0}, Text: "first", Metadata: map[string]string{"source": "doc1"}},
+			{ID: "b", Vector: []float32{0, 1}, Text: "second"},
+		}
+		if err := index.Add(entries...); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "index.gob")
+		if err := SaveIndex(path, index); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isFlat(loaded) != isFlat(index) {
+			t.Errorf("loaded %T from %T", loaded, index)
+		}
+		got := loaded.Search([]float32{0, 1}, 1)
+		if loaded.Len() != 2 || len(got) != 1 || got[0].Text != "second" {
+			t.Errorf("%T: search after load = %+v", index, got)
+		}
+		if first := loaded.Search([]float32{1, 0}, 1); first[0].Metadata["source"] != "doc1" {
+			t.Errorf("%T: metadata lost: %+v", index, first)
+		}
+	}
+}
+
+func isFlat(index VectorIndex) bool {
+	_, ok := index.(*FlatIndex)
+	return ok
+}
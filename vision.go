@@ -0,0 +1,264 @@
+package langmesh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// MaxImageBytes is the largest image OpenAI accepts
+	MaxImageBytes = 20 << 20
+	// MaxImageSide is the longest side OpenAI processes an image at; larger
+	// images are scaled down before they are sent
+	MaxImageSide = 2048
+)
+
+var (
+	// ErrUnsupportedImage is returned for images OpenAI cannot read: formats
+	// other than PNG, JPEG, WebP and GIF, and animated GIFs
+	ErrUnsupportedImage = errors.New("langmesh: unsupported image")
+
+	// ErrImageTooLarge is returned for images over MaxImageBytes that
+	// cannot be scaled down
+	ErrImageTooLarge = errors.New("langmesh: image too large")
+)
+
+// Image is an image input for a chat message
+type Image struct {
+	// URL is an http(s) URL or a data URL holding the image
+	URL    string
+	Detail openai.ImageURLDetail
+	// Width and Height are the image's size in pixels, zero if unknown
+	Width  int
+	Height int
+}
+
+// ImageFromURL refers to an image by URL. Remote images are fetched by
+// OpenAI, so their size is unknown.
+func ImageFromURL(rawURL string) (Image, error) {
+	if strings.HasPrefix(rawURL, "data:") {
+		img := Image{URL: rawURL}
+		img.Width, img.Height = dataURLSize(rawURL)
+		return img, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Image{}, fmt.Errorf("%w: want an http(s) or data URL, got %q", ErrUnsupportedImage, rawURL)
+	}
+	return Image{URL: rawURL}, nil
+}
+
+// ImageFromFile reads an image file into a data URL
+func ImageFromFile(path string) (Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Image{}, err
+	}
+	defer f.Close()
+	return ImageFromReader(f, mime.TypeByExtension(filepath.Ext(path)))
+}
+
+// ImageFromReader reads an image into a data URL, scaling it down to
+// MaxImageSide if it is larger. mimeType is detected from the content if
+// empty or generic.
+func ImageFromReader(r io.Reader, mimeType string) (Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, _, _ = mime.ParseMediaType(mimeType)
+
+	var img Image
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		data, mimeType, img.Width, img.Height, err = fitImage(data, mimeType)
+		if err != nil {
+			return Image{}, err
+		}
+	case "image/webp":
+		// The standard library cannot decode WebP, so it is sent as is
+	default:
+		return Image{}, fmt.Errorf("%w: type %q", ErrUnsupportedImage, mimeType)
+	}
+	if len(data) > MaxImageBytes {
+		return Image{}, fmt.Errorf("%w: %d bytes, limit %d", ErrImageTooLarge, len(data), MaxImageBytes)
+	}
+	img.URL = "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return img, nil
+}
+
+// WithDetail returns img requested at detail
+func (img Image) WithDetail(detail openai.ImageURLDetail) Image {
+	img.Detail = detail
+	return img
+}
+
+// Part returns img as a chat message part
+func (img Image) Part() openai.ChatMessagePart {
+	return openai.ChatMessagePart{
+		Type:     openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{URL: img.URL, Detail: img.Detail},
+	}
+}
+
+// Tokens estimates the prompt tokens img costs
+func (img Image) Tokens() int {
+	return ImageTokens(img.Width, img.Height, img.Detail)
+}
+
+// UserImageMessage builds a user message of text followed by images
+func UserImageMessage(text string, images ...Image) openai.ChatCompletionMessage {
+	parts := make([]openai.ChatMessagePart, 0, len(images)+1)
+	if text != "" {
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: text})
+	}
+	for _, img := range images {
+		parts = append(parts, img.Part())
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts}
+}
+
+// ImageTokens estimates the prompt tokens of a width by height image the
+// way GPT-4o bills them: 85 at low detail, otherwise 85 plus 170 for each
+// 512px tile once the image is scaled to fit 2048px and then to 768px on
+// its short side. An unknown size counts as 768px square.
+func ImageTokens(width, height int, detail openai.ImageURLDetail) int {
+	if detail == openai.ImageURLDetailLow {
+		return 85
+	}
+	if width <= 0 || height <= 0 {
+		width, height = 768, 768
+	}
+	w, h := float64(width), float64(height)
+	if long := math.Max(w, h); long > MaxImageSide {
+		w, h = w*MaxImageSide/long, h*MaxImageSide/long
+	}
+	if short := math.Min(w, h); short > 768 {
+		w, h = w*768/short, h*768/short
+	}
+	tiles := int(math.Ceil(w/512) * math.Ceil(h/512))
+	return 85 + 170*tiles
+}
+
+// EstimateImageCostUSD estimates what sending images to model costs
+func EstimateImageCostUSD(model string, images ...Image) float64 {
+	tokens := 0
+	for _, img := range images {
+		tokens += img.Tokens()
+	}
+	return estimateCost(model, tokens, 0)
+}
+
+// imagePartTokens estimates an image part's tokens, reading the size of
+// data URLs
+func imagePartTokens(part openai.ChatMessagePart) int {
+	if part.Type != openai.ChatMessagePartTypeImageURL || part.ImageURL == nil {
+		return 0
+	}
+	w, h := 0, 0
+	if part.ImageURL.Detail != openai.ImageURLDetailLow {
+		w, h = dataURLSize(part.ImageURL.URL)
+	}
+	return ImageTokens(w, h, part.ImageURL.Detail)
+}
+
+// dataURLSize decodes just enough of a base64 data URL to read the image's
+// size, returning zeros if it cannot
+func dataURLSize(rawURL string) (int, int) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(rawURL, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return 0, 0
+	}
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(payload)))
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// fitImage checks a PNG, JPEG or GIF and scales it to fit MaxImageSide,
+// returning the data to send, its type and size
+func fitImage(data []byte, mimeType string) ([]byte, string, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if mimeType == "image/gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", 0, 0, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+		}
+		if len(anim.Image) > 1 {
+			return nil, "", 0, 0, fmt.Errorf("%w: animated GIF", ErrUnsupportedImage)
+		}
+	}
+	long := max(config.Width, config.Height)
+	if long <= MaxImageSide {
+		return data, mimeType, config.Width, config.Height, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	w := max(config.Width*MaxImageSide/long, 1)
+	h := max(config.Height*MaxImageSide/long, 1)
+	scaled := downscale(src, w, h)
+	var buf bytes.Buffer
+	if mimeType == "image/jpeg" {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 90})
+	} else {
+		// GIFs are re-encoded as PNG to keep their colors
+		mimeType = "image/png"
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("langmesh: encode scaled image: %w", err)
+	}
+	return buf.Bytes(), mimeType, w, h, nil
+}
+
+// downscale shrinks src to w by h, averaging the source pixels under each
+// destination pixel
+func downscale(src image.Image, w, h int) *image.RGBA64 {
+	b := src.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
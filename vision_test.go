@@ -0,0 +1,109 @@
+package langmesh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func writePNG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	path := filepath.Join(t.TempDir(), "image.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImageFromFileDownscales(t *testing.T) {
+	img, err := ImageFromFile(writePNG(t, 3000, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 2048 || img.Height != 682 {
+		t.Errorf("size = %dx%d, want 2048x682", img.Width, img.Height)
+	}
+	payload, ok := strings.CutPrefix(img.URL, "data:image/png;base64,")
+	if !ok {
+		t.Fatalf("URL = %.40s", img.URL)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded.Width != 2048 {
+		t.Errorf("encoded image %+v, %v", decoded, err)
+	}
+
+	small, err := ImageFromFile(writePNG(t, 100, 50))
+	if err != nil || small.Width != 100 || small.Height != 50 {
+		t.Errorf("small image %dx%d, %v", small.Width, small.Height, err)
+	}
+	if w, h := dataURLSize(small.URL); w != 100 || h != 50 {
+		t.Errorf("dataURLSize = %dx%d", w, h)
+	}
+}
+
+func TestImageValidation(t *testing.T) {
+	if _, err := ImageFromReader(strings.NewReader("plain text"), ""); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("text: err = %v", err)
+	}
+	if _, err := ImageFromURL("ftp://example.com/cat.png"); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("ftp URL: err = %v", err)
+	}
+	img, err := ImageFromURL("https://example.com/cat.png")
+	if err != nil || img.Width != 0 {
+		t.Errorf("remote image %+v, %v", img, err)
+	}
+}
+
+func TestImageTokens(t *testing.T) {
+	for _, tc := range []struct {
+		w, h   int
+		detail openai.ImageURLDetail
+		want   int
+	}{
+		{1024, 1024, openai.ImageURLDetailHigh, 765},
+		{2048, 4096, openai.ImageURLDetailHigh, 1105},
+		{4096, 8192, openai.ImageURLDetailLow, 85},
+		{0, 0, openai.ImageURLDetailAuto, 765},
+		{200, 100, "", 255},
+	} {
+		if got := ImageTokens(tc.w, tc.h, tc.detail); got != tc.want {
+			t.Errorf("ImageTokens(%d, %d, %q) = %d, want %d", tc.w, tc.h, tc.detail, got, tc.want)
+		}
+	}
+
+	img, err := ImageFromFile(writePNG(t, 200, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("test-key")
+	msg := UserImageMessage("what is this?", img)
+	text := client.countPromptTokens("gpt-4o", []openai.ChatCompletionMessage{UserImageMessage("what is this?")})
+	if got := client.countPromptTokens("gpt-4o", []openai.ChatCompletionMessage{msg}); got != text+255 {
+		t.Errorf("prompt tokens = %d, want %d", got, text+255)
+	}
+	if cost := EstimateImageCostUSD("gpt-4o", img); cost <= 0 {
+		t.Errorf("cost = %v", cost)
+	}
+}
@@ -0,0 +1,223 @@
+package langmesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultWebSocketPing is how often WebSocketRelay pings the client
+	// unless configured
+	DefaultWebSocketPing = 30 * time.Second
+	// DefaultWebSocketWriteTimeout is how long WebSocketRelay waits on a
+	// client to take a message unless configured
+	DefaultWebSocketWriteTimeout = 10 * time.Second
+)
+
+// WebSocketConn is an open WebSocket to a client, for relaying over a
+// connection another library upgraded. Adapting gorilla/websocket takes a
+// few lines:
+//
+//	type gorillaConn struct{ *websocket.Conn }
+//
+//	func (c gorillaConn) WriteText(ctx context.Context, data []byte) error {
+//		deadline, _ := ctx.Deadline()
+//		c.SetWriteDeadline(deadline)
+//		return c.WriteMessage(websocket.TextMessage, data)
+//	}
+//	func (c gorillaConn) Ping(ctx context.Context) error {
+//		deadline, _ := ctx.Deadline()
+//		return c.WriteControl(websocket.PingMessage, nil, deadline)
+//	}
+//	func (c gorillaConn) ReadMessage(context.Context) ([]byte, error) {
+//		_, data, err := c.Conn.ReadMessage()
+//		return data, err
+//	}
+//
+// and nhooyr.io/websocket maps onto it just as directly.
+type WebSocketConn interface {
+	// WriteText sends a text message, giving up once ctx ends
+	WriteText(ctx context.Context, data []byte) error
+	// Ping sends a keepalive ping
+	Ping(ctx context.Context) error
+	// ReadMessage returns the client's next message, and an error once the
+	// connection is closed
+	ReadMessage(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// WebSocketRelay relays a ChatCompletionStream to a browser over a
+// WebSocket, a text message per chunk in OpenAI's format, or per piece of
+// content with ContentOnly, then "[DONE]". A stream that fails midway
+// ends with an {"error": ...} message. Messages are written one at a time,
+// so a slow client slows the read of the upstream stream; one that takes
+// longer than WriteTimeout over a message is dropped. A client that
+// closes the socket, or stops answering pings, cancels the upstream call,
+// and it is recorded as cancelled. Messages from the client are ignored.
+type WebSocketRelay struct {
+	// PingInterval is how often the client is pinged. Zero means
+	// DefaultWebSocketPing; negative disables pings.
+	PingInterval time.Duration
+	WriteTimeout time.Duration
+	ContentOnly  bool
+}
+
+// RelayWebSocket upgrades r to a WebSocket and relays stream over it with
+// the default WebSocketRelay
+func RelayWebSocket(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	return WebSocketRelay{}.Upgrade(w, r, stream)
+}
+
+// Upgrade upgrades r to a WebSocket and relays stream over it, returning
+// like Relay. A request that is not a WebSocket upgrade is answered with
+// an error status and stream is closed.
+func (rl WebSocketRelay) Upgrade(w http.ResponseWriter, r *http.Request, stream *ChatCompletionStream) error {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		stream.Close()
+		return err
+	}
+	conn := &serverWebSocket{ws: ws, idle: 2 * rl.pingInterval()}
+	if conn.idle > 0 {
+		ws.onPong = conn.touch
+		conn.touch()
+	}
+	return rl.Relay(r.Context(), conn, stream)
+}
+
+func (rl WebSocketRelay) pingInterval() time.Duration {
+	if rl.PingInterval == 0 {
+		return DefaultWebSocketPing
+	}
+	return max(rl.PingInterval, 0)
+}
+
+// Relay relays stream over conn until the stream ends, returning its
+// error, or the client goes away, returning context.Canceled, or ctx ends.
+// It closes both the stream and conn.
+func (rl WebSocketRelay) Relay(ctx context.Context, conn WebSocketConn, stream *ChatCompletionStream) error {
+	defer conn.Close()
+	defer stream.Close()
+	timeout := rl.WriteTimeout
+	if timeout <= 0 {
+		timeout = DefaultWebSocketWriteTimeout
+	}
+	write := func(data []byte) error {
+		writeCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return conn.WriteText(writeCtx, data)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	gone := make(chan struct{})
+	stream.client.goroutine("websocket.read", func() {
+		defer close(gone)
+		for {
+			if _, err := conn.ReadMessage(ctx); err != nil {
+				return
+			}
+		}
+	})
+	chunks := make(chan relayChunk)
+	stream.client.goroutine("stream.relay", func() {
+		for {
+			chunk, err := stream.Recv()
+			select {
+			case chunks <- relayChunk{chunk, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	var pings <-chan time.Time
+	if interval := rl.pingInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	format := StreamRelay{ContentOnly: rl.ContentOnly}
+	for {
+		select {
+		case <-ctx.Done():
+			stream.abort()
+			return ctx.Err()
+		case <-gone:
+			stream.abort()
+			return context.Canceled
+		case <-pings:
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				stream.abort()
+				return err
+			}
+		case next := <-chunks:
+			if errors.Is(next.err, io.EOF) {
+				return write([]byte("[DONE]"))
+			}
+			if next.err != nil {
+				data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": next.err.Error()}})
+				write(data)
+				return next.err
+			}
+			data, ok := format.payload(next.chunk)
+			if !ok {
+				continue
+			}
+			if err := write(data); err != nil {
+				stream.abort()
+				return err
+			}
+		}
+	}
+}
+
+// serverWebSocket is a WebSocketConn over the module's own WebSocket
+// implementation. A client silent for idle, not even answering pings, is
+// taken to be gone.
+type serverWebSocket struct {
+	ws   *wsConn
+	idle time.Duration
+}
+
+// touch pushes back the read deadline after hearing from the client
+func (s *serverWebSocket) touch() {
+	_ = s.ws.conn.SetReadDeadline(time.Now().Add(s.idle))
+}
+
+func (s *serverWebSocket) WriteText(ctx context.Context, data []byte) error {
+	return s.write(ctx, wsText, data)
+}
+
+func (s *serverWebSocket) Ping(ctx context.Context) error {
+	return s.write(ctx, wsPing, nil)
+}
+
+func (s *serverWebSocket) write(ctx context.Context, opcode byte, data []byte) error {
+	deadline, _ := ctx.Deadline()
+	_ = s.ws.conn.SetWriteDeadline(deadline)
+	return s.ws.writeMessage(opcode, data)
+}
+
+func (s *serverWebSocket) ReadMessage(context.Context) ([]byte, error) {
+	_, data, err := s.ws.readMessage()
+	if err == nil && s.idle > 0 {
+		s.touch()
+	}
+	return data, err
+}
+
+func (s *serverWebSocket) Close() error {
+	_ = s.ws.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	return s.ws.close()
+}
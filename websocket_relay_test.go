@@ -0,0 +1,144 @@
+package langmesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRelayWebSocket(t *testing.T) {
+	upstream := newStreamServer(t, "Hel", "lo")
+	client := NewClient("test-key", WithBaseURL(upstream.URL))
+	srv, result := relayServer(t, client, WebSocketRelay{ContentOnly: true}.Upgrade)
+
+	ws, err := dialWebSocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.close()
+	var got []string
+	for {
+		_, data, err := ws.readMessage()
+		if err != nil {
+			break
+		}
+		got = append(got, string(data))
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`{"content":"Hel"}`, `{"content":"lo"}`, "[DONE]"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestRelayWebSocketClientCloses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"slow\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(upstream.Close)
+	rec := &eventRecorder{}
+	client := NewClient("test-key", WithBaseURL(upstream.URL), withRecorder(rec))
+	srv, result := relayServer(t, client, RelayWebSocket)
+
+	ws, err := dialWebSocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ws.readMessage(); err != nil {
+		t.Fatal(err)
+	}
+	ws.close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("relay err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop when the socket closed")
+	}
+	if events := rec.all(); len(events) != 1 || events[0].Status != "cancelled" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestRelayWebSocketRejectsPlainRequests(t *testing.T) {
+	upstream := newStreamServer(t, "hi")
+	client := NewClient("test-key", WithBaseURL(upstream.URL))
+	srv, result := relayServer(t, client, RelayWebSocket)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+	if err := <-result; err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// stalledConn is a client that answers pings but never reads messages
+type stalledConn struct {
+	pings  atomic.Int32
+	closed chan struct{}
+}
+
+func (c *stalledConn) WriteText(ctx context.Context, _ []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *stalledConn) Ping(context.Context) error {
+	c.pings.Add(1)
+	return nil
+}
+
+func (c *stalledConn) ReadMessage(context.Context) ([]byte, error) {
+	<-c.closed
+	return nil, errors.New("closed")
+}
+
+func (c *stalledConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestWebSocketRelayDropsStalledClient(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"late\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(upstream.Close)
+	client := NewClient("test-key", WithBaseURL(upstream.URL))
+	stream, err := client.CreateChatCompletionStream(context.Background(), chatRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &stalledConn{closed: make(chan struct{})}
+	relay := WebSocketRelay{PingInterval: 10 * time.Millisecond, WriteTimeout: 20 * time.Millisecond}
+	err = relay.Relay(context.Background(), conn, stream)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the write timeout", err)
+	}
+	if conn.pings.Load() == 0 {
+		t.Error("idle client was not pinged")
+	}
+}
@@ -0,0 +1,287 @@
+package langmesh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a YAML document with its indentation
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+// yamlParser parses the subset of YAML config files use: nested block
+// mappings and sequences, flow lists of scalars, literal block scalars and
+// comments
+type yamlParser struct {
+	raw   []string
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(text string) (any, error) {
+	p := &yamlParser{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		p.raw = append(p.raw, raw)
+		if strings.Contains(raw[:len(raw)-len(strings.TrimLeft(raw, " \t"))], "\t") {
+			return nil, fmt.Errorf("langmesh: config line %d: tabs are not allowed in indentation", n)
+		}
+		line := strings.TrimRight(stripYAMLComment(raw), " ")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		p.lines = append(p.lines, yamlLine{n: n, indent: indent, text: line[indent:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.lines) == 0 {
+		return map[string]any{}, nil
+	}
+	node, err := p.node(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("langmesh: config line %d: unexpected indentation", p.lines[p.pos].n)
+	}
+	return node, nil
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits a "key: value" line, reporting false for other lines
+func splitKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return unquoteYAML(text[:end+2]), strings.TrimSpace(rest[1:]), true
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return text[:len(text)-1], "", true
+	}
+	return "", "", false
+}
+
+// node parses the mapping or sequence starting at the current line
+func (p *yamlParser) node(indent int) (any, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("langmesh: config line %d: unexpected indentation", line.n)
+		}
+		key, value, ok := splitKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("langmesh: config line %d: expected key: value", line.n)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("langmesh: config line %d: %s is set twice", line.n, key)
+		}
+		p.pos++
+		v, err := p.value(indent, value, line)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSequenceItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("langmesh: config line %d: unexpected indentation", line.n)
+			}
+			break
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if _, _, isMap := splitKey(item); isMap {
+			// A mapping starting on the item's line continues at the
+			// column its first key is in
+			offset := len(line.text) - len(item)
+			p.lines[p.pos] = yamlLine{n: line.n, indent: indent + offset, text: item}
+			v, err := p.mapping(indent + offset)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		p.pos++
+		v, err := p.value(indent, item, line)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// value parses the value of a key or sequence item at indent whose inline
+// text is value
+func (p *yamlParser) value(indent int, value string, line yamlLine) (any, error) {
+	switch {
+	case value == "|" || value == "|-":
+		return p.block(indent, line.n, value == "|-"), nil
+	case value != "":
+		return yamlScalar(value)
+	}
+	if p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		// Sequences may sit at their key's indentation
+		if next.indent > indent || (next.indent == indent && isSequenceItem(next.text) && !isSequenceItem(line.text)) {
+			return p.node(next.indent)
+		}
+	}
+	return nil, nil
+}
+
+// block reads the literal block scalar following line n, indented more
+// than indent
+func (p *yamlParser) block(indent, n int, chomp bool) string {
+	var b strings.Builder
+	blockIndent := -1
+	last := n
+	for i := n; i < len(p.raw); i++ {
+		raw := p.raw[i]
+		if strings.TrimSpace(raw) == "" {
+			b.WriteString("\n")
+			continue
+		}
+		lineIndent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if lineIndent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		b.WriteString(raw[blockIndent:] + "\n")
+		last = i + 1
+	}
+	for p.pos < len(p.lines) && p.lines[p.pos].n <= last {
+		p.pos++
+	}
+	text := strings.TrimRight(b.String(), "\n")
+	if !chomp {
+		text += "\n"
+	}
+	return text
+}
+
+var yamlNumber = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d+)?$`)
+
+// yamlPlain is an unquoted scalar holding an environment reference, typed
+// by plainScalar once the reference is expanded
+type yamlPlain string
+
+// yamlScalar converts an inline value: quoted strings, flow lists, and
+// unquoted booleans, nulls, numbers and strings
+func yamlScalar(value string) (any, error) {
+	switch {
+	case value[0] == '"' || value[0] == '\'':
+		return unquoteYAML(value), nil
+	case value[0] == '[':
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("langmesh: config: unterminated list %s", value)
+		}
+		list := []any{}
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				v, err := yamlScalar(item)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+		}
+		return list, nil
+	case value == "{}":
+		return map[string]any{}, nil
+	case envReference.MatchString(value):
+		return yamlPlain(value), nil
+	}
+	return plainScalar(value), nil
+}
+
+// plainScalar types an unquoted scalar as a boolean, null, number or string
+func plainScalar(value string) any {
+	switch {
+	case value == "true" || value == "false":
+		return value == "true"
+	case value == "null" || value == "~":
+		return nil
+	case yamlNumber.MatchString(value):
+		return json.Number(value)
+	}
+	return value
+}
+
+// stripYAMLComment removes a trailing # comment outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '"' && s[len(s)-1] == '"':
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		case s[0] == '\'' && s[len(s)-1] == '\'':
+			return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+		}
+	}
+	return s
+}
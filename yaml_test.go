@@ -0,0 +1,46 @@
+package langmesh
+
+import "testing"
+
+func TestParseYAML(t *testing.T) {
+	tree, err := parseYAML(`
+prompt: |
+  line one
+    indented
+  # not a comment
+items:
+- a
+- "b # c"
+- name: x
+  tags: [1, two]
+empty:
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tree.(map[string]any)
+	if m["prompt"] != "line one\n  indented\n# not a comment\n" {
+		t.Errorf("prompt = %q", m["prompt"])
+	}
+	items := m["items"].([]any)
+	if len(items) != 3 || items[1] != "b # c" || items[2].(map[string]any)["name"] != "x" {
+		t.Errorf("items = %#v", items)
+	}
+	if m["empty"] != nil {
+		t.Errorf("empty = %#v", m["empty"])
+	}
+}
+
+func TestStripYAMLComment(t *testing.T) {
+	for line, want := range map[string]string{
+		"a: b # c":         "a: b ",
+		"a: 'b # c'":       "a: 'b # c'",
+		`a: "b # c" # d`:   `a: "b # c" `,
+		"a: b#c":           "a: b#c",
+		"# only a comment": "",
+	} {
+		if got := stripYAMLComment(line); got != want {
+			t.Errorf("stripYAMLComment(%q) = %q, want %q", line, got, want)
+		}
+	}
+}